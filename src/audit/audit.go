@@ -16,7 +16,9 @@ import (
 
 	"config"
 	"xbase"
+	"xbase/sync2"
 
+	"github.com/pkg/errors"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -37,6 +39,12 @@ const (
 
 	// ALL enum.
 	ALL = "A"
+
+	// ADMIN is the command type of the admin api calls.
+	ADMIN = "ADMIN"
+
+	// batchMax is the max events written to the sink at once.
+	batchMax = 256
 )
 
 // easyjson:json
@@ -48,6 +56,7 @@ type event struct {
 	Cost        time.Duration `json:"cost"`         // Cost.
 	User        string        `json:"user"`         // User.
 	UserHost    string        `json:"user_host"`    // User and host combination.
+	Database    string        `json:"database"`     // Current database of the session.
 	ThreadID    uint32        `json:"thread_id"`    // Thread id.
 	CommandType string        `json:"command_type"` // Type of command.
 	Argument    string        `json:"argument"`     // Full query.
@@ -55,26 +64,55 @@ type event struct {
 	QueryRows   uint64        `json:"query_rows"`   // Query rows.
 }
 
+// Status tuple, the statistics of the audit.
+type Status struct {
+	Mode        string
+	Sink        string
+	FullPolicy  string
+	QueueSize   int
+	QueueLength int
+	Filtered    uint64 // the events dropped by the filters
+	Dropped     uint64 // the events dropped since the queue is full
+	Written     uint64 // the events written to the sink
+	Errors      uint64 // the events lost by the sink errors
+}
+
 // Audit tuple.
 type Audit struct {
-	log    *xlog.Log
-	conf   *config.AuditConfig
-	ticker *time.Ticker
-	queue  chan *event
-	done   chan bool
-	rfile  xbase.RotateFile
-	wg     sync.WaitGroup
+	log      *xlog.Log
+	conf     *config.AuditConfig
+	ticker   *time.Ticker
+	queue    chan *event
+	done     chan bool
+	rfile    xbase.RotateFile
+	sink     sink
+	filters  []*filter
+	wg       sync.WaitGroup
+	filtered sync2.AtomicInt64
+	dropped  sync2.AtomicInt64
+	written  sync2.AtomicInt64
+	errors   sync2.AtomicInt64
 }
 
 // NewAudit creates the new audit.
 func NewAudit(log *xlog.Log, conf *config.AuditConfig) *Audit {
+	if conf.Sink == "" {
+		conf.Sink = config.AuditSinkFile
+	}
+	if conf.QueueSize <= 0 {
+		conf.QueueSize = config.DefaultAuditConfig().QueueSize
+	}
+	if conf.FullPolicy == "" {
+		conf.FullPolicy = config.AuditPolicyBlock
+	}
 	return &Audit{
-		log:    log,
-		conf:   conf,
-		done:   make(chan bool),
-		queue:  make(chan *event, 1024),
-		ticker: time.NewTicker(time.Duration(time.Second * 300)), // 5 minutes
-		rfile:  xbase.NewRotateFile(conf.LogDir, prefix, extension, conf.MaxSize),
+		log:     log,
+		conf:    conf,
+		done:    make(chan bool),
+		queue:   make(chan *event, conf.QueueSize),
+		ticker:  time.NewTicker(time.Duration(time.Second * 300)), // 5 minutes
+		rfile:   xbase.NewRotateFile(conf.LogDir, prefix, extension, conf.MaxSize),
+		filters: newFilters(conf.Filters),
 	}
 }
 
@@ -83,9 +121,21 @@ func (a *Audit) Init() error {
 	log := a.log
 
 	log.Info("audit.init.conf:%+v", a.conf)
-	if err := os.MkdirAll(a.conf.LogDir, 0744); err != nil {
+	switch a.conf.FullPolicy {
+	case config.AuditPolicyBlock, config.AuditPolicyDrop:
+	default:
+		return errors.Errorf("audit.full-policy[%s].unsupported", a.conf.FullPolicy)
+	}
+	sink, err := newSink(a.conf, a.rfile)
+	if err != nil {
 		return err
 	}
+	if a.conf.Sink == config.AuditSinkFile {
+		if err := os.MkdirAll(a.conf.LogDir, 0744); err != nil {
+			return err
+		}
+	}
+	a.sink = sink
 
 	a.wg.Add(1)
 	go func(audit *Audit) {
@@ -103,7 +153,7 @@ func (a *Audit) Init() error {
 }
 
 // LogReadEvent used to handle the read-only event.
-func (a *Audit) LogReadEvent(t, user, host string, threadID uint32, query string, status uint16, affected uint64, startTime time.Time) {
+func (a *Audit) LogReadEvent(t, user, host, database string, threadID uint32, query string, status uint16, affected uint64, startTime time.Time) {
 	if a.conf.Mode == ALL || a.conf.Mode == READ {
 		e := &event{
 			Start:       startTime,
@@ -111,18 +161,19 @@ func (a *Audit) LogReadEvent(t, user, host string, threadID uint32, query string
 			Cost:        time.Since(startTime),
 			User:        user,
 			UserHost:    host,
+			Database:    database,
 			ThreadID:    threadID,
 			CommandType: t,
 			Argument:    query,
 			Status:      status,
 			QueryRows:   affected,
 		}
-		a.queue <- e
+		a.push(e)
 	}
 }
 
 // LogWriteEvent used to handle the write event.
-func (a *Audit) LogWriteEvent(t, user, host string, threadID uint32, query string, status uint16, affected uint64, startTime time.Time) {
+func (a *Audit) LogWriteEvent(t, user, host, database string, threadID uint32, query string, status uint16, affected uint64, startTime time.Time) {
 	if a.conf.Mode == ALL || a.conf.Mode == WRITE {
 		e := &event{
 			Start:       startTime,
@@ -130,46 +181,116 @@ func (a *Audit) LogWriteEvent(t, user, host string, threadID uint32, query strin
 			Cost:        time.Since(startTime),
 			User:        user,
 			UserHost:    host,
+			Database:    database,
 			ThreadID:    threadID,
 			CommandType: t,
 			Argument:    query,
 			Status:      status,
 			QueryRows:   affected,
 		}
-		a.queue <- e
+		a.push(e)
+	}
+}
+
+// LogAdminEvent used to handle the call of the admin api, it's always recorded regardless of the mode.
+func (a *Audit) LogAdminEvent(user, host string, call string, status uint16, startTime time.Time) {
+	e := &event{
+		Start:       startTime,
+		End:         time.Now(),
+		Cost:        time.Since(startTime),
+		User:        user,
+		UserHost:    host,
+		CommandType: ADMIN,
+		Argument:    call,
+		Status:      status,
+	}
+	a.push(e)
+}
+
+// push used to queue the event if it passes the filters,
+// the event is dropped if the queue is full and the full policy is drop.
+func (a *Audit) push(e *event) {
+	if !a.audited(e) {
+		a.filtered.Add(1)
+		return
+	}
+	if a.conf.FullPolicy == config.AuditPolicyDrop {
+		select {
+		case a.queue <- e:
+		default:
+			a.dropped.Add(1)
+		}
+		return
+	}
+	a.queue <- e
+}
+
+// Status returns the statistics of the audit.
+func (a *Audit) Status() *Status {
+	return &Status{
+		Mode:        a.conf.Mode,
+		Sink:        a.conf.Sink,
+		FullPolicy:  a.conf.FullPolicy,
+		QueueSize:   cap(a.queue),
+		QueueLength: len(a.queue),
+		Filtered:    uint64(a.filtered.Get()),
+		Dropped:     uint64(a.dropped.Get()),
+		Written:     uint64(a.written.Get()),
+		Errors:      uint64(a.errors.Get()),
 	}
 }
 
 // Close used to close the audit log.
 func (a *Audit) Close() {
-	// wait the queue event flush to file.
+	// wait the queue event flush to the sink.
 	close(a.done)
 	close(a.queue)
 	a.wg.Wait()
-	a.rfile.Sync()
-	a.rfile.Close()
+	if a.sink != nil {
+		a.sink.Close()
+	}
 	a.log.Info("audit.closed")
 }
 
 func (a *Audit) eventConsumer() {
+	batch := make([][]byte, 0, batchMax)
 	for e := range a.queue {
-		a.writeEvent(e)
+		batch = append(batch[:0], a.marshal(e))
+	drain:
+		for len(batch) < batchMax {
+			select {
+			case e, ok := <-a.queue:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, a.marshal(e))
+			default:
+				break drain
+			}
+		}
+		a.writeEvents(batch)
 	}
 }
 
-func (a *Audit) writeEvent(e *event) {
-	log := a.log
+func (a *Audit) marshal(e *event) []byte {
+	if a.conf.MaskLiterals && e.CommandType != ADMIN {
+		e.Argument = maskLiterals(e.Argument)
+	}
 	b, err := e.MarshalJSON()
 	if err != nil {
 		b = []byte(err.Error())
 	}
-	b = append(b, '\n')
+	return b
+}
 
-	// write
-	_, err = a.rfile.Write(b)
-	if err != nil {
-		log.Error("audit.write.file.error:%v", err)
+func (a *Audit) writeEvents(batch [][]byte) {
+	log := a.log
+	if err := a.sink.Write(batch); err != nil {
+		a.errors.Add(int64(len(batch)))
+		log.Error("audit.write.%s.error:%v", a.conf.Sink, err)
+		return
 	}
+	a.written.Add(int64(len(batch)))
 }
 
 func (a *Audit) purge() {
@@ -184,9 +305,10 @@ func (a *Audit) purge() {
 	}
 }
 
+// doPurge removes the old files expired or beyond the max files.
 func (a *Audit) doPurge() {
 	log := a.log
-	if a.conf.ExpireHours == 0 {
+	if a.conf.Sink != config.AuditSinkFile || (a.conf.ExpireHours == 0 && a.conf.MaxFiles == 0) {
 		return
 	}
 
@@ -196,9 +318,14 @@ func (a *Audit) doPurge() {
 		return
 	}
 
-	for _, old := range oldLogs {
+	// The old logs are sorted by ts asc.
+	excess := 0
+	if a.conf.MaxFiles > 0 && len(oldLogs) > a.conf.MaxFiles {
+		excess = len(oldLogs) - a.conf.MaxFiles
+	}
+	for i, old := range oldLogs {
 		diff := time.Now().UTC().Sub(time.Unix(0, old.Ts))
-		if int(diff.Hours()) > a.conf.ExpireHours {
+		if i < excess || (a.conf.ExpireHours > 0 && int(diff.Hours()) > a.conf.ExpireHours) {
 			os.Remove(filepath.Join(a.conf.LogDir, old.Name))
 		}
 	}
@@ -55,6 +55,12 @@ func easyjsonF2c44427EncodeAudit(out *jwriter.Writer, in event) {
 		out.RawByte(',')
 	}
 	first = false
+	out.RawString("\"database\":")
+	out.String(string(in.Database))
+	if !first {
+		out.RawByte(',')
+	}
+	first = false
 	out.RawString("\"thread_id\":")
 	out.Uint32(uint32(in.ThreadID))
 	if !first {
@@ -10,8 +10,10 @@ package audit
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -49,9 +51,9 @@ func TestAudit(t *testing.T) {
 		threadID := uint32(i)
 		query := "select a,b,cd from table1 where a=b and c=d and e=d group by id order\n by desc"
 		if i%2 == 0 {
-			audit.LogWriteEvent(typ, user, host, threadID, query, 0, 0, time.Now())
+			audit.LogWriteEvent(typ, user, host, "", threadID, query, 0, 0, time.Now())
 		} else {
-			audit.LogReadEvent(typ, user, host, threadID, query, 0, 0, time.Now())
+			audit.LogReadEvent(typ, user, host, "", threadID, query, 0, 0, time.Now())
 		}
 	}
 }
@@ -85,9 +87,9 @@ func TestAuditMultiThread(t *testing.T) {
 				threadID := uint32(i)
 				query := "select a,b,cd from table1 where a=b and c=d and e=d group by id order\n by desc"
 				if i%2 == 0 {
-					a.LogWriteEvent(typ, user, host, threadID, query, 0, 0, time.Now())
+					a.LogWriteEvent(typ, user, host, "", threadID, query, 0, 0, time.Now())
 				} else {
-					a.LogReadEvent(typ, user, host, threadID, query, 0, 0, time.Now())
+					a.LogReadEvent(typ, user, host, "", threadID, query, 0, 0, time.Now())
 				}
 			}
 			wait.Done()
@@ -122,9 +124,9 @@ func TestPurge(t *testing.T) {
 		threadID := uint32(i)
 		query := "select a,b,cd from table1 where a=b and c=d and e=d group by id order\n by desc"
 		if i%2 == 0 {
-			audit.LogWriteEvent(typ, user, host, threadID, query, 0, 0, time.Now())
+			audit.LogWriteEvent(typ, user, host, "", threadID, query, 0, 0, time.Now())
 		} else {
-			audit.LogReadEvent(typ, user, host, threadID, query, 0, 0, time.Now())
+			audit.LogReadEvent(typ, user, host, "", threadID, query, 0, 0, time.Now())
 		}
 	}
 	// first the close the audit to stop the event writing.
@@ -170,9 +172,73 @@ func TestAuditBench(t *testing.T) {
 			host := "127.0.0.1:8899"
 			threadID := uint32(i)
 			query := "select a,b,cd from table1 where a=b and c=d and e=d group by id order\n by desc"
-			audit.LogWriteEvent(typ, user, host, threadID, query, 0, 0, time.Now())
+			audit.LogWriteEvent(typ, user, host, "", threadID, query, 0, 0, time.Now())
 		}
 		took := time.Since(now)
 		fmt.Printf(" LOOP\t%v COST %v, avg:%v/s\n", N, took, (int64(N)/(took.Nanoseconds()/1e6))*1000)
 	}
 }
+
+func TestAuditAdminEvent(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	tmpDir := fakedb.GetTmpDir("", "radon_audit_", log)
+	defer os.RemoveAll(tmpDir)
+	conf := &config.AuditConfig{
+		Mode:        NULL,
+		MaxSize:     102400,
+		ExpireHours: 1,
+		LogDir:      tmpDir,
+	}
+
+	audit := NewAudit(log, conf)
+	err := audit.Init()
+	assert.Nil(t, err)
+	audit.LogReadEvent("SELECT", "root", "127.0.0.1:8899", "", 1, "select 1", 0, 0, time.Now())
+	audit.LogAdminEvent("admin", "127.0.0.1:8899", "DELETE /v1/radon/backend/node1", 0, time.Now())
+	audit.Close()
+
+	// The admin event is recorded in the mode NULL.
+	files, err := filepath.Glob(filepath.Join(tmpDir, prefix+"*"+extension))
+	assert.Nil(t, err)
+	var data []byte
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		assert.Nil(t, err)
+		data = append(data, b...)
+	}
+	assert.Equal(t, 1, strings.Count(string(data), "\n"))
+	assert.True(t, strings.Contains(string(data), `"command_type":"ADMIN","argument":"DELETE /v1/radon/backend/node1"`))
+}
+
+func TestPurgeMaxFiles(t *testing.T) {
+	fileFormat := "20060102150405.000"
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	tmpDir := fakedb.GetTmpDir("", "radon_audit_", log)
+	defer os.RemoveAll(tmpDir)
+	conf := &config.AuditConfig{
+		Mode:     ALL,
+		MaxSize:  102400,
+		MaxFiles: 2,
+		LogDir:   tmpDir,
+	}
+
+	audit := NewAudit(log, conf)
+	err := audit.Init()
+	assert.Nil(t, err)
+	defer audit.Close()
+
+	// 5 files, the last one is the current writing file.
+	now := time.Now().UTC()
+	for i := 0; i < 5; i++ {
+		ts := now.Add(time.Duration(i-5) * time.Minute).Format(fileFormat)
+		name := filepath.Join(conf.LogDir, fmt.Sprintf("%s%s%s", prefix, ts, extension))
+		err := ioutil.WriteFile(name, []byte("{}\n"), 0644)
+		assert.Nil(t, err)
+	}
+	audit.doPurge()
+
+	logs, _ := audit.rfile.GetOldLogInfos()
+	assert.Equal(t, 2, len(logs))
+	files, _ := filepath.Glob(filepath.Join(tmpDir, prefix+"*"+extension))
+	assert.Equal(t, 3, len(files))
+}
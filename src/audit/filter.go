@@ -0,0 +1,199 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package audit
+
+import (
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"config"
+
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+// literalRegexp matches the quoted strings and the numbers, used if the statement can't be parsed.
+var literalRegexp = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'|"(?:[^"\\]|\\.|"")*"|\b\d+(?:\.\d+)?\b`)
+
+func toSet(vals []string, lower bool) map[string]bool {
+	if len(vals) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(vals))
+	for _, v := range vals {
+		if lower {
+			v = strings.ToLower(v)
+		}
+		set[v] = true
+	}
+	return set
+}
+
+// filter is the compiled config.AuditFilter, the databases, tables and commands are case insensitive.
+type filter struct {
+	exclude   bool
+	users     map[string]bool
+	hosts     map[string]bool
+	databases map[string]bool
+	tables    map[string]bool
+	commands  map[string]bool
+	status    string
+	minCost   time.Duration
+}
+
+func newFilters(confs []*config.AuditFilter) []*filter {
+	var filters []*filter
+	for _, conf := range confs {
+		filters = append(filters, &filter{
+			exclude:   conf.Exclude,
+			users:     toSet(conf.Users, false),
+			hosts:     toSet(conf.Hosts, false),
+			databases: toSet(conf.Databases, true),
+			tables:    toSet(conf.Tables, true),
+			commands:  toSet(conf.Commands, true),
+			status:    strings.ToLower(conf.Status),
+			minCost:   time.Duration(conf.MinCost) * time.Millisecond,
+		})
+	}
+	return filters
+}
+
+// match returns true if the event matches all the conditions of the filter,
+// tables returns the tables of the event which are parsed only once on demand.
+func (f *filter) match(e *event, tables func() []string) bool {
+	if f.users != nil && !f.users[e.User] {
+		return false
+	}
+	if f.hosts != nil {
+		host, _, err := net.SplitHostPort(e.UserHost)
+		if err != nil {
+			host = e.UserHost
+		}
+		if !f.hosts[host] {
+			return false
+		}
+	}
+	if f.databases != nil && !f.databases[strings.ToLower(e.Database)] {
+		return false
+	}
+	if f.commands != nil && !f.commands[strings.ToLower(e.CommandType)] {
+		return false
+	}
+	switch f.status {
+	case "success":
+		if e.Status != 0 {
+			return false
+		}
+	case "failure":
+		if e.Status == 0 {
+			return false
+		}
+	}
+	if e.Cost < f.minCost {
+		return false
+	}
+	if f.tables != nil {
+		for _, table := range tables() {
+			if f.tables[table] || f.tables[table[strings.Index(table, ".")+1:]] {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// audited returns false if the event matches an exclude filter,
+// or there are include filters but the event matches none of them.
+func (a *Audit) audited(e *event) bool {
+	if len(a.filters) == 0 {
+		return true
+	}
+
+	var tables []string
+	parsed := false
+	tablesFn := func() []string {
+		if !parsed {
+			tables = eventTables(e)
+			parsed = true
+		}
+		return tables
+	}
+
+	included, includes := false, 0
+	for _, f := range a.filters {
+		if f.exclude {
+			if f.match(e, tablesFn) {
+				return false
+			}
+			continue
+		}
+		includes++
+		if !included && f.match(e, tablesFn) {
+			included = true
+		}
+	}
+	return includes == 0 || included
+}
+
+// eventTables returns the tables of the statement as 'db.table' in lower case,
+// the unqualified tables are in the current database.
+func eventTables(e *event) []string {
+	if e.CommandType == ADMIN {
+		return nil
+	}
+	node, err := sqlparser.Parse(e.Argument)
+	if err != nil {
+		return nil
+	}
+
+	var tables []string
+	add := func(table sqlparser.TableName) {
+		if table.Name.IsEmpty() {
+			return
+		}
+		db := table.Qualifier.String()
+		if db == "" {
+			db = e.Database
+		}
+		tables = append(tables, strings.ToLower(db+"."+table.Name.String()))
+	}
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch node := node.(type) {
+		case *sqlparser.ColName:
+			// The qualifier of the column may be the alias.
+			return false, nil
+		case *sqlparser.Show:
+			add(node.Table)
+			return false, nil
+		case sqlparser.TableName:
+			add(node)
+		}
+		return true, nil
+	}, node)
+	return tables
+}
+
+// maskLiterals replaces the literals of the query with '?'.
+func maskLiterals(query string) string {
+	node, err := sqlparser.Parse(query)
+	if err != nil {
+		return literalRegexp.ReplaceAllString(query, "?")
+	}
+	buf := sqlparser.NewTrackedBuffer(func(buf *sqlparser.TrackedBuffer, node sqlparser.SQLNode) {
+		if _, ok := node.(*sqlparser.SQLVal); ok {
+			buf.WriteString("?")
+			return
+		}
+		node.Format(buf)
+	})
+	buf.Myprintf("%v", node)
+	return buf.String()
+}
@@ -0,0 +1,127 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"config"
+	"fakedb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestAuditFilters(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := &config.AuditConfig{
+		Mode: ALL,
+		Filters: []*config.AuditFilter{
+			{Exclude: true, Users: []string{"monitor"}},
+			{Users: []string{"app"}, Hosts: []string{"10.0.0.1"}, Commands: []string{"insert", "update"}},
+			{Tables: []string{"db1.secret", "salary"}},
+			{Status: "failure"},
+			{Databases: []string{"DB2"}, MinCost: 100},
+		},
+	}
+	audit := NewAudit(log, conf)
+
+	tests := []struct {
+		e    *event
+		want bool
+	}{
+		{&event{User: "monitor", Status: 1}, false},
+		{&event{User: "app", UserHost: "10.0.0.1:3306", CommandType: "INSERT", Argument: "insert into t1 values(1)"}, true},
+		{&event{User: "app", UserHost: "10.0.0.2:3306", CommandType: "INSERT", Argument: "insert into t1 values(1)"}, false},
+		{&event{User: "app", UserHost: "10.0.0.1:3306", CommandType: "SELECT", Argument: "select 1"}, false},
+		{&event{User: "u1", Database: "db1", CommandType: "SELECT", Argument: "select a.id from secret as a join t2 on a.id=t2.id"}, true},
+		{&event{User: "u1", Database: "db2", CommandType: "SELECT", Argument: "select * from db1.Secret"}, true},
+		{&event{User: "u1", Database: "db2", CommandType: "SELECT", Argument: "select * from secret"}, false},
+		{&event{User: "u1", Database: "db3", CommandType: "UPDATE", Argument: "update hr.salary set a=1 where id=1"}, true},
+		{&event{User: "u1", Database: "db3", CommandType: "SELECT", Argument: "select secret.a from t1 as secret"}, false},
+		{&event{User: "u1", CommandType: ADMIN, Argument: "PUT /v1/radon/config", Status: 401}, true},
+		{&event{User: "u1", Database: "db2", Cost: 50 * time.Millisecond}, false},
+		{&event{User: "u1", Database: "db2", Cost: 150 * time.Millisecond}, true},
+	}
+	for i, test := range tests {
+		assert.Equal(t, test.want, audit.audited(test.e), "test[%d]", i)
+	}
+
+	// Only the exclude filters.
+	conf.Filters = []*config.AuditFilter{{Exclude: true, Commands: []string{"select"}}}
+	audit = NewAudit(log, conf)
+	assert.False(t, audit.audited(&event{CommandType: "SELECT"}))
+	assert.True(t, audit.audited(&event{CommandType: "INSERT"}))
+}
+
+func TestAuditMaskLiterals(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{
+			"select * from t1 where name='bob' and age > 30",
+			"select * from t1 where name = ? and age > ?",
+		},
+		{
+			"insert into t1(a, b) values (1, 'x'), (2, 'y')",
+			"insert into t1(a, b) values (?, ?), (?, ?)",
+		},
+		{
+			// Can't be parsed.
+			"select * from t1 where name='bob\\'s' and id in (1,2.5) xxx",
+			"select * from t1 where name=? and id in (?,?) xxx",
+		},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, maskLiterals(test.query))
+	}
+}
+
+func TestAuditFilterAndMask(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	tmpDir := fakedb.GetTmpDir("", "radon_audit_", log)
+	defer os.RemoveAll(tmpDir)
+	conf := &config.AuditConfig{
+		Mode:         ALL,
+		MaxSize:      102400,
+		LogDir:       tmpDir,
+		MaskLiterals: true,
+		Filters: []*config.AuditFilter{
+			{Commands: []string{"insert"}},
+		},
+	}
+
+	audit := NewAudit(log, conf)
+	err := audit.Init()
+	assert.Nil(t, err)
+	audit.LogReadEvent("SELECT", "root", "127.0.0.1:8899", "db1", 1, "select 1", 0, 0, time.Now())
+	audit.LogWriteEvent("INSERT", "root", "127.0.0.1:8899", "db1", 1, "insert into t1(a) values('secret')", 0, 1, time.Now())
+	audit.Close()
+
+	status := audit.Status()
+	assert.Equal(t, uint64(1), status.Filtered)
+	assert.Equal(t, uint64(1), status.Written)
+
+	files, err := filepath.Glob(filepath.Join(tmpDir, prefix+"*"+extension))
+	assert.Nil(t, err)
+	var data []byte
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		assert.Nil(t, err)
+		data = append(data, b...)
+	}
+	assert.Equal(t, 1, strings.Count(string(data), "\n"))
+	assert.True(t, strings.Contains(string(data), `"database":"db1","thread_id":1,"command_type":"INSERT","argument":"insert into t1(a) values (?)"`))
+}
@@ -0,0 +1,179 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package audit
+
+import (
+	"bytes"
+	"log/syslog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"config"
+	"xbase"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// sinkTimeout is the timeout of the dial and the write of the remote sinks.
+	sinkTimeout = 5 * time.Second
+
+	// syslogTag is the tag of the syslog messages.
+	syslogTag = "radon-audit"
+)
+
+// sink is the destination of the events, the events are the json lines without the '\n'.
+type sink interface {
+	Write(events [][]byte) error
+	Close() error
+}
+
+// newSink creates the sink of the config, the remote sinks connect lazily,
+// so radon starts even if the destination is unavailable.
+func newSink(conf *config.AuditConfig, rfile xbase.RotateFile) (sink, error) {
+	switch conf.Sink {
+	case config.AuditSinkFile:
+		return &fileSink{rfile: rfile}, nil
+	case config.AuditSinkSyslog:
+		network, raddr := "", ""
+		if conf.SinkAddress != "" {
+			parts := strings.SplitN(conf.SinkAddress, "://", 2)
+			if len(parts) != 2 {
+				return nil, errors.Errorf("audit.syslog.address[%s].must.be.network://host:port", conf.SinkAddress)
+			}
+			network, raddr = parts[0], parts[1]
+		}
+		return &syslogSink{network: network, raddr: raddr}, nil
+	case config.AuditSinkUnix:
+		if conf.SinkAddress == "" {
+			return nil, errors.New("audit.unix.sink-address.can.not.be.empty")
+		}
+		return &unixSink{path: conf.SinkAddress}, nil
+	case config.AuditSinkHTTP:
+		if conf.SinkAddress == "" {
+			return nil, errors.New("audit.http.sink-address.can.not.be.empty")
+		}
+		return &httpSink{url: conf.SinkAddress, client: &http.Client{Timeout: sinkTimeout}}, nil
+	}
+	return nil, errors.Errorf("audit.sink[%s].unsupported", conf.Sink)
+}
+
+// fileSink writes the events to the rotating local files.
+type fileSink struct {
+	rfile xbase.RotateFile
+}
+
+func (s *fileSink) Write(events [][]byte) error {
+	for _, e := range events {
+		if _, err := s.rfile.Write(append(e, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fileSink) Close() error {
+	s.rfile.Sync()
+	s.rfile.Close()
+	return nil
+}
+
+// syslogSink writes the events to the local syslog, or the remote one if the network is set.
+type syslogSink struct {
+	network string
+	raddr   string
+	writer  *syslog.Writer
+}
+
+func (s *syslogSink) Write(events [][]byte) error {
+	if s.writer == nil {
+		writer, err := syslog.Dial(s.network, s.raddr, syslog.LOG_INFO|syslog.LOG_LOCAL0, syslogTag)
+		if err != nil {
+			return err
+		}
+		s.writer = writer
+	}
+	for _, e := range events {
+		if err := s.writer.Info(string(e)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *syslogSink) Close() error {
+	if s.writer != nil {
+		return s.writer.Close()
+	}
+	return nil
+}
+
+// unixSink writes the json lines to the local unix socket, it reconnects at the next write if failed.
+type unixSink struct {
+	path string
+	conn net.Conn
+}
+
+func (s *unixSink) Write(events [][]byte) error {
+	if s.conn == nil {
+		conn, err := net.DialTimeout("unix", s.path, sinkTimeout)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	var buf bytes.Buffer
+	for _, e := range events {
+		buf.Write(e)
+		buf.WriteByte('\n')
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(sinkTimeout))
+	if _, err := s.conn.Write(buf.Bytes()); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (s *unixSink) Close() error {
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	return nil
+}
+
+// httpSink posts the events to the collector as the newline delimited json.
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *httpSink) Write(events [][]byte) error {
+	var buf bytes.Buffer
+	for _, e := range events {
+		buf.Write(e)
+		buf.WriteByte('\n')
+	}
+	resp, err := s.client.Post(s.url, "application/x-ndjson", &buf)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return errors.Errorf("audit.http.post[%s].status[%d]", s.url, resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *httpSink) Close() error {
+	return nil
+}
@@ -0,0 +1,200 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package audit
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"config"
+	"fakedb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestAuditSinkUnix(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	tmpDir := fakedb.GetTmpDir("", "radon_audit_", log)
+	defer os.RemoveAll(tmpDir)
+	path := filepath.Join(tmpDir, "audit.sock")
+
+	listener, err := net.Listen("unix", path)
+	assert.Nil(t, err)
+	defer listener.Close()
+	lines := make(chan string, 16)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	conf := &config.AuditConfig{
+		Mode:        ALL,
+		Sink:        config.AuditSinkUnix,
+		SinkAddress: path,
+	}
+	audit := NewAudit(log, conf)
+	err = audit.Init()
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		audit.LogReadEvent("SELECT", "root", "127.0.0.1:8899", "db1", uint32(i), "select 1", 0, 0, time.Now())
+	}
+	audit.Close()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case line := <-lines:
+			assert.True(t, strings.Contains(line, fmt.Sprintf(`"thread_id":%d,"command_type":"SELECT"`, i)))
+		case <-time.After(5 * time.Second):
+			t.Fatal("audit.unix.sink.timeout")
+		}
+	}
+	assert.Equal(t, uint64(3), audit.Status().Written)
+}
+
+func TestAuditSinkHTTP(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	var mu sync.Mutex
+	var lines []string
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		lines = append(lines, strings.Split(strings.TrimSpace(string(body)), "\n")...)
+	}))
+	defer server.Close()
+
+	conf := &config.AuditConfig{
+		Mode:        ALL,
+		Sink:        config.AuditSinkHTTP,
+		SinkAddress: server.URL,
+	}
+	audit := NewAudit(log, conf)
+	err := audit.Init()
+	assert.Nil(t, err)
+	audit.LogWriteEvent("INSERT", "root", "127.0.0.1:8899", "db1", 1, "insert into t1 values(1)", 0, 1, time.Now())
+	audit.LogAdminEvent("admin", "127.0.0.1:8899", "PUT /v1/radon/config", 0, time.Now())
+	audit.Close()
+
+	mu.Lock()
+	assert.Equal(t, 2, len(lines))
+	assert.True(t, strings.Contains(lines[1], `"command_type":"ADMIN"`))
+	fail = true
+	mu.Unlock()
+	assert.Equal(t, uint64(2), audit.Status().Written)
+
+	// The collector fails.
+	audit = NewAudit(log, conf)
+	err = audit.Init()
+	assert.Nil(t, err)
+	audit.LogWriteEvent("INSERT", "root", "127.0.0.1:8899", "db1", 1, "insert into t1 values(1)", 0, 1, time.Now())
+	audit.Close()
+	assert.Equal(t, uint64(1), audit.Status().Errors)
+}
+
+func TestAuditSinkSyslog(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	conf := &config.AuditConfig{
+		Mode:        ALL,
+		Sink:        config.AuditSinkSyslog,
+		SinkAddress: "udp://" + conn.LocalAddr().String(),
+	}
+	audit := NewAudit(log, conf)
+	err = audit.Init()
+	assert.Nil(t, err)
+	audit.LogReadEvent("SELECT", "root", "127.0.0.1:8899", "db1", 1, "select 1", 0, 0, time.Now())
+	audit.Close()
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.Nil(t, err)
+	msg := string(buf[:n])
+	assert.True(t, strings.Contains(msg, syslogTag))
+	assert.True(t, strings.Contains(msg, `"argument":"select 1"`))
+}
+
+func TestAuditSinkErrors(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	confs := []*config.AuditConfig{
+		{Sink: "kafka"},
+		{Sink: config.AuditSinkUnix},
+		{Sink: config.AuditSinkHTTP},
+		{Sink: config.AuditSinkSyslog, SinkAddress: "127.0.0.1:514"},
+		{Sink: config.AuditSinkFile, FullPolicy: "wait"},
+	}
+	wants := []string{
+		"audit.sink[kafka].unsupported",
+		"audit.unix.sink-address.can.not.be.empty",
+		"audit.http.sink-address.can.not.be.empty",
+		"audit.syslog.address[127.0.0.1:514].must.be.network://host:port",
+		"audit.full-policy[wait].unsupported",
+	}
+	for i, conf := range confs {
+		audit := NewAudit(log, conf)
+		err := audit.Init()
+		assert.NotNil(t, err)
+		assert.Equal(t, wants[i], err.Error())
+	}
+}
+
+func TestAuditFullPolicyDrop(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := &config.AuditConfig{
+		Mode:        ALL,
+		Sink:        config.AuditSinkUnix,
+		SinkAddress: "/tmp/radon_audit_not_exists.sock",
+		QueueSize:   4,
+		FullPolicy:  config.AuditPolicyDrop,
+	}
+
+	// Not started, nobody consumes the queue.
+	audit := NewAudit(log, conf)
+	for i := 0; i < 10; i++ {
+		audit.LogReadEvent("SELECT", "root", "127.0.0.1:8899", "db1", uint32(i), "select 1", 0, 0, time.Now())
+	}
+	status := audit.Status()
+	assert.Equal(t, 4, status.QueueSize)
+	assert.Equal(t, 4, status.QueueLength)
+	assert.Equal(t, uint64(6), status.Dropped)
+
+	// The queued events are lost since the socket doesn't exist.
+	err := audit.Init()
+	assert.Nil(t, err)
+	audit.Close()
+	status = audit.Status()
+	assert.Equal(t, uint64(4), status.Errors)
+	assert.Equal(t, uint64(0), status.Written)
+}
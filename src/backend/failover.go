@@ -0,0 +1,318 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"sync"
+	"time"
+
+	"config"
+	"monitor"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// probe checks the pool can dial and ping the mysqld.
+func probe(pool *Pool) error {
+	conn, err := pool.Get()
+	if err != nil {
+		return err
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return err
+	}
+	conn.Recycle()
+	return nil
+}
+
+// probeAddress checks the address is reachable with a temporary pool of the backend.
+func probeAddress(log *xlog.Log, conf *config.BackendConfig, address string) error {
+	pool := NewPool(log, conf, address)
+	defer pool.Close()
+	return probe(pool)
+}
+
+// promote runs the promotion statements on the candidate address.
+func promote(log *xlog.Log, conf *config.BackendConfig, address string, querys []string) error {
+	if len(querys) == 0 {
+		return nil
+	}
+
+	pool := NewPool(log, conf, address)
+	defer pool.Close()
+	conn, err := pool.Get()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for _, query := range querys {
+		log.Warning("scatter.promote.backend[%s].address[%s].execute:%s", conf.Name, address, query)
+		if _, err := conn.Execute(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// switchoverConfig returns a copy of the backend config whose primary is the address,
+// the old primary becomes a candidate and the address is removed from the replicas.
+func switchoverConfig(old *config.BackendConfig, address string) *config.BackendConfig {
+	conf := *old
+	conf.Address = address
+	conf.Candidates = nil
+	for _, candidate := range old.Candidates {
+		if candidate != address {
+			conf.Candidates = append(conf.Candidates, candidate)
+		}
+	}
+	conf.Candidates = append(conf.Candidates, old.Address)
+
+	if conf.Replica == address {
+		conf.Replica = ""
+	}
+	conf.Replicas = nil
+	for _, r := range old.Replicas {
+		if r.Address != address {
+			conf.Replicas = append(conf.Replicas, r)
+		}
+	}
+	return &conf
+}
+
+// Switchover used to switch the primary of the backend to the address.
+// The promotion statements are executed on the address before switching,
+// the commits are blocked during the switching.
+// The caller should FlushConfig to persist the topology and push it to the peers.
+func (scatter *Scatter) Switchover(name string, address string) error {
+	log := scatter.log
+
+	scatter.txnMgr.CommitLock()
+	defer scatter.txnMgr.CommitUnlock()
+	if err := scatter.switchover(name, address); err != nil {
+		log.Error("scatter.switchover.backend[%s].to[%s].error:%v", name, address, err)
+		return err
+	}
+	scatter.recoverXA(name)
+	return nil
+}
+
+func (scatter *Scatter) switchover(name string, address string) error {
+	log := scatter.log
+
+	old, err := scatter.switchoverCheck(name, address)
+	if err != nil {
+		return err
+	}
+	// The promotion dials the address, it runs without the lock so that the others are not blocked.
+	if err := promote(log, old.conf, address, scatter.promoteSQL); err != nil {
+		return err
+	}
+
+	scatter.mu.Lock()
+	defer scatter.mu.Unlock()
+	if scatter.backends[name] != old {
+		return errors.Errorf("scatter.backend[%v].is.changed.during.the.switchover", name)
+	}
+	scatter.backends[name] = NewPoolz(log, switchoverConfig(old.conf, address))
+	old.Close()
+	monitor.FailoverInc(name)
+	log.Warning("scatter.switchover.backend[%s].from[%s].to[%s].done", name, old.conf.Address, address)
+	return nil
+}
+
+// switchoverCheck returns the Poolz of the backend if the address can be switched to.
+func (scatter *Scatter) switchoverCheck(name string, address string) (*Poolz, error) {
+	scatter.mu.RLock()
+	defer scatter.mu.RUnlock()
+	old, ok := scatter.backends[name]
+	if !ok {
+		return nil, errors.Errorf("scatter.backend[%v].can.not.be.found", name)
+	}
+	if old.conf.Address == address {
+		return nil, errors.Errorf("scatter.backend[%v].address[%v].is.already.the.primary", name, address)
+	}
+	for _, poolz := range scatter.backends {
+		if poolz.conf.Address == address {
+			return nil, errors.Errorf("scatter.address[%v].already.exists.in.backends", address)
+		}
+	}
+	if !switchable(old.conf, address) {
+		return nil, errors.Errorf("scatter.backend[%v].address[%v].is.not.a.replica.or.candidate", name, address)
+	}
+	return old, nil
+}
+
+// switchable returns true if the address is one of the replicas or candidates of the backend.
+func switchable(conf *config.BackendConfig, address string) bool {
+	if conf.Replica == address {
+		return true
+	}
+	for _, r := range conf.Replicas {
+		if r.Address == address {
+			return true
+		}
+	}
+	for _, candidate := range conf.Candidates {
+		if candidate == address {
+			return true
+		}
+	}
+	return false
+}
+
+// recoverXA lists the prepared XA transactions left on the new primary and retries the commit logs.
+// The ones which are not in the commit logs must be handled by the operator with 'xa commit/rollback'.
+func (scatter *Scatter) recoverXA(name string) {
+	log := scatter.log
+
+	scatter.mu.RLock()
+	poolz := scatter.backends[name]
+	scatter.mu.RUnlock()
+	if poolz == nil {
+		return
+	}
+
+	conn, err := poolz.normal.Get()
+	if err != nil {
+		log.Error("scatter.switchover.backend[%s].xa.recover.error:%v", name, err)
+		return
+	}
+	qr, err := conn.Execute("xa recover")
+	if err != nil {
+		conn.Close()
+		log.Error("scatter.switchover.backend[%s].xa.recover.error:%v", name, err)
+		return
+	}
+	conn.Recycle()
+	for _, row := range qr.Rows {
+		log.Warning("scatter.switchover.backend[%s].prepared.xa:%v", name, row)
+	}
+
+	if len(qr.Rows) > 0 && scatter.txnMgr.xaCheck != nil {
+		if err := scatter.txnMgr.xaCheck.xaCommitsRetry(); err != nil {
+			log.Error("scatter.switchover.backend[%s].xa.commits.retry.error:%v", name, err)
+		}
+	}
+}
+
+// Failover used to monitor the primary of the backends,
+// switch to the first reachable candidate when the primary fails continuously.
+type Failover struct {
+	log         *xlog.Log
+	scatter     *Scatter
+	maxFailures int
+	failures    map[string]int
+	done        chan bool
+	ticker      *time.Ticker
+	wg          sync.WaitGroup
+}
+
+// NewFailover creates the Failover.
+func NewFailover(scatter *Scatter, conf *config.ScatterConfig) *Failover {
+	defaults := config.DefaultScatterConfig()
+	interval := conf.FailoverCheckInterval
+	if interval <= 0 {
+		interval = defaults.FailoverCheckInterval
+	}
+	maxFailures := conf.FailoverMaxFailures
+	if maxFailures <= 0 {
+		maxFailures = defaults.FailoverMaxFailures
+	}
+	return &Failover{
+		log:         scatter.log,
+		scatter:     scatter,
+		maxFailures: maxFailures,
+		failures:    make(map[string]int),
+		done:        make(chan bool),
+		ticker:      time.NewTicker(time.Second * time.Duration(interval)),
+	}
+}
+
+// Init used to start the check thread.
+func (f *Failover) Init() {
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		defer f.ticker.Stop()
+		for {
+			select {
+			case <-f.ticker.C:
+				f.check()
+			case <-f.done:
+				return
+			}
+		}
+	}()
+	f.log.Info("failover.init.done")
+}
+
+// check used to probe the primary of the backends which have candidates.
+// Only the leading peer checks, the others wait for the config pushed by it.
+func (f *Failover) check() {
+	log := f.log
+	scatter := f.scatter
+
+	if !scatter.isLeading() {
+		f.failures = make(map[string]int)
+		return
+	}
+
+	scatter.mu.RLock()
+	poolzs := make(map[string]*Poolz, len(scatter.backends))
+	for name, poolz := range scatter.backends {
+		if len(poolz.conf.Candidates) > 0 {
+			poolzs[name] = poolz
+		}
+	}
+	scatter.mu.RUnlock()
+
+	for name, poolz := range poolzs {
+		err := probe(poolz.normal)
+		if err == nil {
+			delete(f.failures, name)
+			continue
+		}
+		f.failures[name]++
+		log.Warning("failover.backend[%s].primary[%s].probe.failed[%d/%d]:%v", name, poolz.conf.Address, f.failures[name], f.maxFailures, err)
+		if f.failures[name] < f.maxFailures {
+			continue
+		}
+
+		delete(f.failures, name)
+		if err := f.failover(name, poolz.conf); err != nil {
+			log.Error("failover.backend[%s].error:%v", name, err)
+		}
+	}
+}
+
+// failover switches the backend to the first reachable candidate and flushes the config.
+func (f *Failover) failover(name string, conf *config.BackendConfig) error {
+	log := f.log
+	scatter := f.scatter
+
+	for _, candidate := range conf.Candidates {
+		if err := probeAddress(log, conf, candidate); err != nil {
+			log.Warning("failover.backend[%s].candidate[%s].probe.error:%v", name, candidate, err)
+			continue
+		}
+		if err := scatter.Switchover(name, candidate); err != nil {
+			return err
+		}
+		return scatter.FlushConfig()
+	}
+	return errors.Errorf("failover.backend[%s].has.no.reachable.candidate", name)
+}
+
+// Close used to stop the check thread.
+func (f *Failover) Close() {
+	close(f.done)
+	f.wg.Wait()
+}
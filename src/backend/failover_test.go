@@ -0,0 +1,172 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"config"
+	"fakedb"
+
+	"github.com/stretchr/testify/assert"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// deadAddress is a closed port to mock the dead primary.
+const deadAddress = "127.0.0.1:1"
+
+func mockXaRecoverResult(xids ...string) *sqltypes.Result {
+	qr := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "formatID", Type: querypb.Type_INT64},
+			{Name: "data", Type: querypb.Type_VARCHAR},
+		},
+	}
+	for _, xid := range xids {
+		qr.Rows = append(qr.Rows, []sqltypes.Value{
+			sqltypes.MakeTrusted(querypb.Type_INT64, []byte("1")),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(xid)),
+		})
+	}
+	return qr
+}
+
+func TestScatterSwitchover(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedb := fakedb.New(log, 3)
+	defer fakedb.Close()
+	scatter := NewScatter(log, "")
+	defer scatter.Close()
+	scatter.promoteSQL = []string{"stop slave", "set global read_only=0"}
+
+	addrs := fakedb.Addrs()
+	conf := MockBackendConfigReplica("node1", addrs[0], addrs[1])
+	conf.Candidates = []string{addrs[1]}
+	err := scatter.Add(conf)
+	assert.Nil(t, err)
+	err = scatter.Add(MockBackendConfigDefault("node2", addrs[2]))
+	assert.Nil(t, err)
+	fakedb.AddQuery("stop slave", &sqltypes.Result{})
+	fakedb.AddQuery("set global read_only=0", &sqltypes.Result{})
+	fakedb.AddQuery("xa recover", mockXaRecoverResult("RXID-1"))
+
+	// Switch to the candidate.
+	{
+		err := scatter.Switchover("node1", addrs[1])
+		assert.Nil(t, err)
+		got := scatter.backends["node1"].conf
+		assert.Equal(t, addrs[1], got.Address)
+		assert.Equal(t, []string{addrs[0]}, got.Candidates)
+		assert.Equal(t, "", got.Replica)
+		assert.Equal(t, 0, len(scatter.backends["node1"].Replicas()))
+		assert.Equal(t, 1, fakedb.GetQueryCalledNum("stop slave"))
+		assert.Equal(t, 1, fakedb.GetQueryCalledNum("xa recover"))
+		// The old config is not changed.
+		assert.Equal(t, addrs[0], conf.Address)
+	}
+
+	// Switch back.
+	{
+		err := scatter.Switchover("node1", addrs[0])
+		assert.Nil(t, err)
+		got := scatter.backends["node1"].conf
+		assert.Equal(t, addrs[0], got.Address)
+		assert.Equal(t, []string{addrs[1]}, got.Candidates)
+	}
+
+	// Errors.
+	{
+		err := scatter.Switchover("xx", addrs[1])
+		assert.Equal(t, "scatter.backend[xx].can.not.be.found", err.Error())
+
+		err = scatter.Switchover("node1", addrs[0])
+		assert.Equal(t, "scatter.backend[node1].address["+addrs[0]+"].is.already.the.primary", err.Error())
+
+		err = scatter.Switchover("node1", addrs[2])
+		assert.Equal(t, "scatter.address["+addrs[2]+"].already.exists.in.backends", err.Error())
+
+		err = scatter.Switchover("node1", "127.0.0.1:2")
+		assert.Equal(t, "scatter.backend[node1].address[127.0.0.1:2].is.not.a.replica.or.candidate", err.Error())
+
+		scatter.backends["node1"].conf.Candidates = append(scatter.backends["node1"].conf.Candidates, deadAddress)
+		err = scatter.Switchover("node1", deadAddress)
+		assert.NotNil(t, err)
+		assert.Equal(t, addrs[0], scatter.backends["node1"].conf.Address)
+	}
+}
+
+func TestScatterFailover(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	tmpDir := fakedb.GetTmpDir("", "radon_backend_", log)
+	defer os.RemoveAll(tmpDir)
+	fakedb := fakedb.New(log, 1)
+	defer fakedb.Close()
+	scatter := NewScatter(log, tmpDir)
+	defer scatter.Close()
+
+	addrs := fakedb.Addrs()
+	conf := MockBackendConfigDefault("node1", deadAddress)
+	conf.Candidates = []string{"127.0.0.1:2", addrs[0]}
+	err := scatter.Add(conf)
+	assert.Nil(t, err)
+	fakedb.AddQuery("xa recover", mockXaRecoverResult())
+
+	scatterConf := MockScatterDefault(log)
+	scatterConf.FailoverMaxFailures = 2
+	failover := NewFailover(scatter, scatterConf)
+
+	// The peer is not leading.
+	{
+		scatter.SetLeading(func() bool { return false })
+		failover.check()
+		failover.check()
+		assert.Equal(t, deadAddress, scatter.backends["node1"].conf.Address)
+		assert.Equal(t, 0, failover.failures["node1"])
+		scatter.SetLeading(nil)
+	}
+
+	// The first failure is not confirmed.
+	{
+		failover.check()
+		assert.Equal(t, deadAddress, scatter.backends["node1"].conf.Address)
+		assert.Equal(t, 1, failover.failures["node1"])
+	}
+
+	// Switch to the reachable candidate and flush the config.
+	{
+		failover.check()
+		assert.Equal(t, addrs[0], scatter.backends["node1"].conf.Address)
+		assert.Equal(t, 0, failover.failures["node1"])
+
+		data, err := ioutil.ReadFile(path.Join(tmpDir, backendjson))
+		assert.Nil(t, err)
+		backends, err := config.ReadBackendsConfig(string(data))
+		assert.Nil(t, err)
+		assert.Equal(t, addrs[0], backends.Backends[0].Address)
+		assert.Equal(t, []string{"127.0.0.1:2", deadAddress}, backends.Backends[0].Candidates)
+	}
+
+	// The primary is alive.
+	{
+		failover.check()
+		assert.Equal(t, addrs[0], scatter.backends["node1"].conf.Address)
+		assert.Equal(t, 0, failover.failures["node1"])
+	}
+
+	// No reachable candidate.
+	{
+		err := failover.failover("node1", MockBackendConfigDefault("node1", deadAddress))
+		assert.Equal(t, "failover.backend[node1].has.no.reachable.candidate", err.Error())
+	}
+}
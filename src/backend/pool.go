@@ -47,19 +47,19 @@ var (
 // Add replica and normal pool to distribute SQL between
 // read and write in some cases for load-balance.
 type Poolz struct {
-	log     *xlog.Log
-	conf    *config.BackendConfig
-	normal  *Pool
-	replica *Pool
+	log      *xlog.Log
+	conf     *config.BackendConfig
+	normal   *Pool
+	replicas []*Replica
 }
 
 // NewPoolz create the new Poolz.
 func NewPoolz(log *xlog.Log, conf *config.BackendConfig) *Poolz {
 	return &Poolz{
-		log:     log,
-		conf:    conf,
-		normal:  NewPool(log, conf, conf.Address),
-		replica: NewPool(log, conf, conf.Replica),
+		log:      log,
+		conf:     conf,
+		normal:   NewPool(log, conf, conf.Address),
+		replicas: newReplicas(log, conf),
 	}
 }
 
@@ -68,16 +68,16 @@ func (p *Poolz) Close() {
 	if p.normal != nil {
 		p.normal.Close()
 	}
-	if p.replica != nil {
-		p.replica.Close()
+	for _, r := range p.replicas {
+		r.pool.Close()
 	}
 }
 
 // JSON returns the available string.
 func (p *Poolz) JSON() string {
 	str := p.normal.JSON()
-	if p.replica != nil {
-		str += ", " + p.replica.JSON()
+	for _, r := range p.replicas {
+		str += ", " + r.pool.JSON()
 	}
 	return str
 }
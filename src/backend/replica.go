@@ -0,0 +1,260 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"config"
+	"monitor"
+
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const (
+	// replicaLagUnknown means the replica is not checked yet or the replication is broken.
+	replicaLagUnknown = -1
+
+	replicaRouteReplica = "replica"
+	replicaRoutePrimary = "primary"
+
+	// appliersLagQuery gets the lag of the applier workers from the performance_schema(MySQL 8.0+),
+	// the lag of a worker is 0 if it's applying nothing.
+	appliersLagQuery = "select service_state, applying_transaction, timestampdiff(second, applying_transaction_original_commit_timestamp, now(6)) from performance_schema.replication_applier_status_by_worker"
+)
+
+// Replica tuple.
+type Replica struct {
+	pool   *Pool
+	weight int
+	// lag is the seconds behind the primary.
+	lag int64
+}
+
+// newReplicas creates the replicas of the backend, the replica-address is a replica with weight 1.
+func newReplicas(log *xlog.Log, conf *config.BackendConfig) []*Replica {
+	var replicas []*Replica
+	add := func(address string, weight int) {
+		if address == "" {
+			return
+		}
+		if weight <= 0 {
+			weight = 1
+		}
+		replicas = append(replicas, &Replica{
+			pool:   NewPool(log, conf, address),
+			weight: weight,
+			lag:    replicaLagUnknown,
+		})
+	}
+
+	add(conf.Replica, 1)
+	for _, r := range conf.Replicas {
+		add(r.Address, r.Weight)
+	}
+	return replicas
+}
+
+// Address returns the replica address.
+func (r *Replica) Address() string {
+	return r.pool.address
+}
+
+// Lag returns the seconds behind the primary, -1 if unknown.
+func (r *Replica) Lag() int64 {
+	return atomic.LoadInt64(&r.lag)
+}
+
+func (r *Replica) setLag(lag int64) {
+	atomic.StoreInt64(&r.lag, lag)
+	monitor.ReplicaLagSet(r.pool.conf.Name, r.pool.address, float64(lag))
+}
+
+// checkLag gets the lag from the replica.
+func (r *Replica) checkLag() int64 {
+	conn, err := r.pool.Get()
+	if err != nil {
+		return replicaLagUnknown
+	}
+	lag, err := checkLag(conn)
+	if err != nil {
+		conn.Close()
+		return replicaLagUnknown
+	}
+	conn.Recycle()
+	return lag
+}
+
+// checkLag gets the Seconds_Behind_Master of the 'show slave status', or the lag of the appliers
+// in the performance_schema if the slave status is not available, such as the user has no REPLICATION CLIENT privilege.
+func checkLag(conn Connection) (int64, error) {
+	qr, err := conn.Execute("show slave status")
+	if err == nil && len(qr.Rows) > 0 {
+		return slaveStatusLag(qr), nil
+	}
+	if qr, err = conn.Execute(appliersLagQuery); err != nil {
+		return replicaLagUnknown, err
+	}
+	return appliersLag(qr), nil
+}
+
+func parseLag(v sqltypes.Value) int64 {
+	if v.IsNull() {
+		return replicaLagUnknown
+	}
+	lag, err := strconv.ParseInt(v.String(), 10, 64)
+	if err != nil {
+		return replicaLagUnknown
+	}
+	return lag
+}
+
+// slaveStatusLag returns the Seconds_Behind_Master of the 'show slave status'.
+func slaveStatusLag(qr *sqltypes.Result) int64 {
+	for i, field := range qr.Fields {
+		if strings.EqualFold(field.Name, "Seconds_Behind_Master") {
+			return parseLag(qr.Rows[0][i])
+		}
+	}
+	return replicaLagUnknown
+}
+
+// appliersLag returns the max lag of the applier workers, it's unknown if no worker or any worker is not running.
+func appliersLag(qr *sqltypes.Result) int64 {
+	if len(qr.Rows) == 0 {
+		return replicaLagUnknown
+	}
+	var max int64
+	for _, row := range qr.Rows {
+		if len(row) < 3 || !strings.EqualFold(row[0].String(), "ON") {
+			return replicaLagUnknown
+		}
+		if row[1].String() == "" {
+			continue
+		}
+		lag := parseLag(row[2])
+		if lag == replicaLagUnknown {
+			return replicaLagUnknown
+		}
+		if lag > max {
+			max = lag
+		}
+	}
+	return max
+}
+
+// Replicas returns the replicas of the backend.
+func (p *Poolz) Replicas() []*Replica {
+	return p.replicas
+}
+
+// replica picks a replica pool by the weights from the replicas whose lag is in the maxLag.
+// If maxLag is 0, all the replicas are qualified.
+// Returns nil if no replica qualifies.
+func (p *Poolz) replica(maxLag int) *Pool {
+	total := 0
+	qualified := make([]*Replica, 0, len(p.replicas))
+	for _, r := range p.replicas {
+		if maxLag > 0 {
+			if lag := r.Lag(); lag == replicaLagUnknown || lag > int64(maxLag) {
+				continue
+			}
+		}
+		qualified = append(qualified, r)
+		total += r.weight
+	}
+	if total == 0 {
+		return nil
+	}
+
+	n := rand.Intn(total)
+	for _, r := range qualified {
+		if n < r.weight {
+			return r.pool
+		}
+		n -= r.weight
+	}
+	return nil
+}
+
+// checkReplicas updates the lag of all the replicas.
+func (p *Poolz) checkReplicas() {
+	for _, r := range p.replicas {
+		r.setLag(r.checkLag())
+	}
+}
+
+// ReplicaCheck used to poll the replication lag of the replicas.
+type ReplicaCheck struct {
+	log     *xlog.Log
+	scatter *Scatter
+	done    chan bool
+	ticker  *time.Ticker
+	wg      sync.WaitGroup
+}
+
+// NewReplicaCheck creates the ReplicaCheck.
+func NewReplicaCheck(scatter *Scatter, conf *config.ScatterConfig) *ReplicaCheck {
+	interval := conf.ReplicaCheckInterval
+	if interval <= 0 {
+		interval = config.DefaultScatterConfig().ReplicaCheckInterval
+	}
+	return &ReplicaCheck{
+		log:     scatter.log,
+		scatter: scatter,
+		done:    make(chan bool),
+		ticker:  time.NewTicker(time.Second * time.Duration(interval)),
+	}
+}
+
+// Init used to start the check thread.
+func (rc *ReplicaCheck) Init() {
+	rc.wg.Add(1)
+	go func() {
+		defer rc.wg.Done()
+		defer rc.ticker.Stop()
+		rc.check()
+		for {
+			select {
+			case <-rc.ticker.C:
+				rc.check()
+			case <-rc.done:
+				return
+			}
+		}
+	}()
+	rc.log.Info("replicacheck.init.done")
+}
+
+// check used to check the replicas of all the backends.
+func (rc *ReplicaCheck) check() {
+	scatter := rc.scatter
+	scatter.mu.RLock()
+	poolzs := make([]*Poolz, 0, len(scatter.backends))
+	for _, poolz := range scatter.backends {
+		poolzs = append(poolzs, poolz)
+	}
+	scatter.mu.RUnlock()
+
+	for _, poolz := range poolzs {
+		poolz.checkReplicas()
+	}
+}
+
+// Close used to stop the check thread.
+func (rc *ReplicaCheck) Close() {
+	close(rc.done)
+	rc.wg.Wait()
+}
@@ -0,0 +1,232 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"testing"
+	"time"
+	"xcontext"
+
+	"config"
+	"fakedb"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func mockSlaveStatusResult(lag string) *sqltypes.Result {
+	v := sqltypes.NULL
+	if lag != "" {
+		v = sqltypes.MakeTrusted(querypb.Type_INT64, []byte(lag))
+	}
+	return &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "Slave_IO_Running", Type: querypb.Type_VARCHAR},
+			{Name: "Seconds_Behind_Master", Type: querypb.Type_INT64},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("Yes")),
+				v,
+			},
+		},
+	}
+}
+
+func mockAppliersLagResult(rows ...[]string) *sqltypes.Result {
+	qr := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "service_state", Type: querypb.Type_VARCHAR},
+			{Name: "applying_transaction", Type: querypb.Type_VARCHAR},
+			{Name: "lag", Type: querypb.Type_INT64},
+		},
+	}
+	for _, row := range rows {
+		lag := sqltypes.NULL
+		if row[2] != "" {
+			lag = sqltypes.MakeTrusted(querypb.Type_INT64, []byte(row[2]))
+		}
+		qr.Rows = append(qr.Rows, []sqltypes.Value{
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(row[0])),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(row[1])),
+			lag,
+		})
+	}
+	return qr
+}
+
+func TestReplicaPick(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := MockBackendConfigReplica("node1", "127.0.0.1:3306", "127.0.0.1:3307")
+	conf.Replicas = []*config.ReplicaConfig{
+		{Address: "127.0.0.1:3308", Weight: 3},
+		{Address: "127.0.0.1:3309"},
+	}
+	poolz := NewPoolz(log, conf)
+	defer poolz.Close()
+
+	replicas := poolz.Replicas()
+	assert.Equal(t, 3, len(replicas))
+	assert.Equal(t, "127.0.0.1:3307", replicas[0].Address())
+	assert.Equal(t, 1, replicas[0].weight)
+	assert.Equal(t, 3, replicas[1].weight)
+	assert.Equal(t, 1, replicas[2].weight)
+
+	// No lag check.
+	{
+		got := make(map[string]int)
+		for i := 0; i < 1000; i++ {
+			got[poolz.replica(0).address]++
+		}
+		assert.Equal(t, 3, len(got))
+		assert.True(t, got["127.0.0.1:3308"] > got["127.0.0.1:3307"])
+	}
+
+	// The lag is unknown.
+	{
+		assert.Nil(t, poolz.replica(10))
+	}
+
+	// Only the replicas in the lag.
+	{
+		replicas[0].setLag(5)
+		replicas[1].setLag(100)
+		replicas[2].setLag(10)
+		got := make(map[string]int)
+		for i := 0; i < 100; i++ {
+			got[poolz.replica(10).address]++
+		}
+		assert.Equal(t, 2, len(got))
+		assert.Equal(t, 0, got["127.0.0.1:3308"])
+	}
+}
+
+func TestReplicaCheck(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedb := fakedb.New(log, 2)
+	defer fakedb.Close()
+	scatter := NewScatter(log, "")
+	defer scatter.Close()
+
+	addrs := fakedb.Addrs()
+	conf := MockBackendConfigReplica("node1", addrs[0], addrs[1])
+	err := scatter.Add(conf)
+	assert.Nil(t, err)
+	poolz := scatter.backends["node1"]
+	replica := poolz.Replicas()[0]
+
+	// Seconds_Behind_Master.
+	{
+		fakedb.AddQuery("show slave status", mockSlaveStatusResult("3"))
+		scatterConf := MockScatterDefault(log)
+		scatterConf.ReplicaCheckInterval = 1
+		rc := NewReplicaCheck(scatter, scatterConf)
+		rc.Init()
+		defer rc.Close()
+		for replica.Lag() != 3 {
+			time.Sleep(time.Millisecond * 10)
+		}
+	}
+
+	// The replication is broken.
+	{
+		fakedb.AddQuery("show slave status", mockSlaveStatusResult(""))
+		poolz.checkReplicas()
+		assert.Equal(t, int64(replicaLagUnknown), replica.Lag())
+	}
+
+	// Not a replica.
+	{
+		fakedb.AddQuery("show slave status", &sqltypes.Result{})
+		poolz.checkReplicas()
+		assert.Equal(t, int64(replicaLagUnknown), replica.Lag())
+	}
+
+	// The performance_schema.
+	{
+		tcases := []struct {
+			qr  *sqltypes.Result
+			lag int64
+		}{
+			{
+				qr:  mockAppliersLagResult([]string{"ON", "uuid:10", "7"}, []string{"ON", "", ""}, []string{"ON", "uuid:9", "2"}),
+				lag: 7,
+			},
+			{
+				qr:  mockAppliersLagResult([]string{"ON", "", ""}),
+				lag: 0,
+			},
+			{
+				qr:  mockAppliersLagResult([]string{"ON", "uuid:10", "7"}, []string{"OFF", "", ""}),
+				lag: replicaLagUnknown,
+			},
+			{
+				qr:  mockAppliersLagResult(),
+				lag: replicaLagUnknown,
+			},
+		}
+		fakedb.AddQueryError("show slave status", errors.New("mock.access.denied"))
+		for _, tcase := range tcases {
+			fakedb.AddQuery(appliersLagQuery, tcase.qr)
+			poolz.checkReplicas()
+			assert.Equal(t, tcase.lag, replica.Lag())
+		}
+
+		// Seconds_Behind_Master first.
+		fakedb.AddQuery("show slave status", mockSlaveStatusResult("3"))
+		poolz.checkReplicas()
+		assert.Equal(t, int64(3), replica.Lag())
+	}
+}
+
+func TestTxnExecuteReplicaLag(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedb, txnMgr, backends, addrs, cleanup := MockTxnMgrWithReplica(log, 1)
+	defer cleanup()
+
+	fakedb.AddQuery("select * from node1", result1)
+	rctx := &xcontext.RequestContext{
+		Querys:  []xcontext.QueryTuple{{Query: "select * from node1", Backend: addrs[0]}},
+		TxnMode: xcontext.TxnRead,
+	}
+	replica := backends[addrs[0]].Replicas()[0]
+
+	// The replica lags, read on the primary.
+	{
+		replica.setLag(100)
+		txn, err := txnMgr.CreateTxn(backends)
+		assert.Nil(t, err)
+		txn.SetIsExecOnRep(true)
+		txn.SetMaxReplicaLag(10)
+		_, err = txn.Execute(rctx)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(txn.replicaConnections))
+		assert.Equal(t, 1, len(txn.normalConnections))
+		txn.Finish()
+	}
+
+	// The replica is in the lag.
+	{
+		replica.setLag(1)
+		txn, err := txnMgr.CreateTxn(backends)
+		assert.Nil(t, err)
+		txn.SetIsExecOnRep(true)
+		txn.SetMaxReplicaLag(10)
+		_, err = txn.Execute(rctx)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(txn.replicaConnections))
+		assert.Equal(t, 0, len(txn.normalConnections))
+		txn.Finish()
+	}
+}
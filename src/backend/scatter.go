@@ -9,13 +9,11 @@
 package backend
 
 import (
-	"io/ioutil"
-	"os"
-	"path"
 	"sort"
 	"sync"
 
 	"config"
+	"metastore"
 	"monitor"
 
 	"github.com/pkg/errors"
@@ -28,26 +26,59 @@ const (
 
 // Scatter tuple.
 type Scatter struct {
-	log      *xlog.Log
-	mu       sync.RWMutex
-	txnMgr   *TxnManager
-	metadir  string
-	backends map[string]*Poolz
+	log          *xlog.Log
+	mu           sync.RWMutex
+	txnMgr       *TxnManager
+	replicaCheck *ReplicaCheck
+	failover     *Failover
+	promoteSQL   []string
+	leading      func() bool
+	store        metastore.Store
+	backends     map[string]*Poolz
+
+	// revision is the revision of the backend.json read or written by the scatter.
+	revision int64
 }
 
-// NewScatter creates a new scatter.
+// NewScatter creates a new scatter which stores the backends in the file of the metadir.
 func NewScatter(log *xlog.Log, metadir string) *Scatter {
+	return NewScatterWithStore(log, metastore.NewFileStore(metadir))
+}
+
+// NewScatterWithStore creates a new scatter which stores the backends in the store.
+func NewScatterWithStore(log *xlog.Log, store metastore.Store) *Scatter {
 	return &Scatter{
 		log:      log,
 		txnMgr:   NewTxnManager(log),
-		metadir:  metadir,
+		store:    store,
 		backends: make(map[string]*Poolz),
 	}
 }
 
-// Init is used to init the xaCheck and start the xaCheck thread.
+// Init is used to init the xaCheck and start the xaCheck, replicaCheck and failover threads.
 func (scatter *Scatter) Init(scatterConf *config.ScatterConfig) error {
-	return scatter.txnMgr.Init(scatter, scatterConf)
+	if err := scatter.txnMgr.Init(scatter, scatterConf); err != nil {
+		return err
+	}
+	scatter.replicaCheck = NewReplicaCheck(scatter, scatterConf)
+	scatter.replicaCheck.Init()
+	scatter.promoteSQL = scatterConf.FailoverPromoteSQL
+	if scatterConf.FailoverEnable {
+		scatter.failover = NewFailover(scatter, scatterConf)
+		scatter.failover.Init()
+	}
+	return nil
+}
+
+// SetLeading used to set the function which tells whether this peer runs the failover,
+// all the peers run it if it's not set. It must be called before Init.
+func (scatter *Scatter) SetLeading(leading func() bool) {
+	scatter.leading = leading
+}
+
+// isLeading returns true if this peer runs the failover.
+func (scatter *Scatter) isLeading() bool {
+	return scatter.leading == nil || scatter.leading()
 }
 
 // Add backend node.
@@ -100,6 +131,16 @@ func (scatter *Scatter) Remove(config *config.BackendConfig) error {
 
 // Close used to clean the pools connections.
 func (scatter *Scatter) Close() {
+	// The replicaCheck and failover hold the lock when checking, stop them first.
+	if scatter.replicaCheck != nil {
+		scatter.replicaCheck.Close()
+		scatter.replicaCheck = nil
+	}
+	if scatter.failover != nil {
+		scatter.failover.Close()
+		scatter.failover = nil
+	}
+
 	scatter.mu.Lock()
 	defer scatter.mu.Unlock()
 
@@ -118,32 +159,44 @@ func (scatter *Scatter) clear() {
 	scatter.backends = make(map[string]*Poolz)
 }
 
-// FlushConfig used to write the backends to file.
+// FlushConfig used to write the backends to the store.
 func (scatter *Scatter) FlushConfig() error {
 	scatter.mu.Lock()
 	defer scatter.mu.Unlock()
 
 	log := scatter.log
-	file := path.Join(scatter.metadir, backendjson)
-
 	var backends config.BackendsConfig
 	for _, v := range scatter.backends {
 		backends.Backends = append(backends.Backends, v.conf)
 	}
 
-	log.Warning("scatter.flush.to.file[%v].backends.conf:%+v", file, backends.Backends)
-	if err := config.WriteConfig(file, backends); err != nil {
-		log.Panicf("scatter.flush.config.to.file[%v].error:%v", file, err)
+	log.Warning("scatter.flush.to.store[%v].backends.conf:%+v", backendjson, backends.Backends)
+	if err := scatter.writeConfig(&backends); err != nil {
+		log.Error("scatter.flush.config.to.store[%v].error:%v", backendjson, err)
 		return err
 	}
-	if err := config.UpdateVersion(scatter.metadir); err != nil {
+	if err := metastore.UpdateVersion(scatter.store); err != nil {
 		log.Panicf("scatter.flush.config.update.version.error:%v", err)
 		return err
 	}
 	return nil
 }
 
-// LoadConfig used to load all backends from metadir/backend.json file.
+// writeConfig writes the backends to the store if the backend.json is not changed since it's read.
+func (scatter *Scatter) writeConfig(backends *config.BackendsConfig) error {
+	data, err := config.MarshalConfig(backends)
+	if err != nil {
+		return err
+	}
+	rev, err := scatter.store.Put(backendjson, data, scatter.revision)
+	if err != nil {
+		return err
+	}
+	scatter.revision = rev
+	return nil
+}
+
+// LoadConfig used to load all backends from the backend.json of the store.
 func (scatter *Scatter) LoadConfig() error {
 	scatter.mu.Lock()
 	defer scatter.mu.Unlock()
@@ -152,28 +205,27 @@ func (scatter *Scatter) LoadConfig() error {
 	scatter.clear()
 
 	log := scatter.log
-	metadir := scatter.metadir
-	file := path.Join(metadir, backendjson)
-
 	// Create it if the backends config not exists.
-	if _, err := os.Stat(file); os.IsNotExist(err) {
+	kv, err := scatter.store.Get(backendjson)
+	if err == metastore.ErrNotFound {
+		scatter.revision = metastore.RevisionNotExist
 		backends := config.BackendsConfig{}
-		if err := config.WriteConfig(file, backends); err != nil {
-			log.Error("scatter.flush.backends.to.file[%v].error:%v", file, err)
+		if err := scatter.writeConfig(&backends); err != nil {
+			log.Error("scatter.flush.backends.to.store[%v].error:%v", backendjson, err)
 			return err
 		}
+		kv, err = scatter.store.Get(backendjson)
 	}
-
-	data, err := ioutil.ReadFile(file)
 	if err != nil {
-		log.Error("scatter.load.from.file[%v].error:%v", file, err)
+		log.Error("scatter.load.from.store[%v].error:%v", backendjson, err)
 		return err
 	}
-	conf, err := config.ReadBackendsConfig(string(data))
+	conf, err := config.ReadBackendsConfig(string(kv.Value))
 	if err != nil {
-		log.Error("scatter.parse.json.file[%v].error:%v", file, err)
+		log.Error("scatter.parse.json[%v].error:%v", backendjson, err)
 		return err
 	}
+	scatter.revision = kv.Revision
 	for _, backend := range conf.Backends {
 		if err := scatter.add(backend); err != nil {
 			log.Error("scatter.add.backend[%+v].error:%v", backend.Name, err)
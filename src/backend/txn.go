@@ -15,6 +15,7 @@ import (
 	"xcontext"
 
 	"config"
+	"monitor"
 	"xbase/sync2"
 
 	"github.com/golang/sync/errgroup"
@@ -68,10 +69,15 @@ type Transaction interface {
 	SetSessionID(id uint32)
 
 	SetIsExecOnRep(isExecOnRep bool)
+	SetMaxReplicaLag(lag int)
 	SetTimeout(timeout int)
 	SetMaxResult(max int)
 	SetMaxJoinRows(max int)
 	MaxJoinRows() int
+	SetGroupConcatMaxLen(max int)
+	GroupConcatMaxLen() int
+	Shards() uint64
+	TwoPC() bool
 
 	Execute(req *xcontext.RequestContext) (*sqltypes.Result, error)
 	ExecuteRaw(database string, query string) (*sqltypes.Result, error)
@@ -89,6 +95,7 @@ type Txn struct {
 	txnd               *TxnDetail
 	twopc              bool
 	isExecOnRep        bool
+	maxReplicaLag      int
 	isMultiStmtTxn     bool
 	start              time.Time
 	state              sync2.AtomicInt32
@@ -97,7 +104,9 @@ type Txn struct {
 	timeout            int
 	maxResult          int
 	maxJoinRows        int
+	groupConcatMaxLen  int
 	errors             int
+	shards             sync2.AtomicInt64
 	twopcConnections   map[string]Connection
 	normalConnections  []Connection
 	replicaConnections []Connection
@@ -131,6 +140,11 @@ func (txn *Txn) SetIsExecOnRep(isExecOnRep bool) {
 	txn.isExecOnRep = isExecOnRep
 }
 
+// SetMaxReplicaLag used to set the max seconds of the replica lag to serve the reads, 0 -- no limit.
+func (txn *Txn) SetMaxReplicaLag(lag int) {
+	txn.maxReplicaLag = lag
+}
+
 // SetTimeout used to set the txn timeout.
 func (txn *Txn) SetTimeout(timeout int) {
 	txn.timeout = timeout
@@ -151,6 +165,16 @@ func (txn *Txn) MaxJoinRows() int {
 	return txn.maxJoinRows
 }
 
+// SetGroupConcatMaxLen used to set the txn max length of the group_concat result.
+func (txn *Txn) SetGroupConcatMaxLen(max int) {
+	txn.groupConcatMaxLen = max
+}
+
+// GroupConcatMaxLen returns txn groupConcatMaxLen.
+func (txn *Txn) GroupConcatMaxLen() int {
+	return txn.groupConcatMaxLen
+}
+
 // TxID returns txn id.
 func (txn *Txn) TxID() uint64 {
 	return txn.id
@@ -175,6 +199,27 @@ func (txn *Txn) incErrors() {
 	txn.errors++
 }
 
+// resultBytes returns the bytes of the row values in the result.
+func resultBytes(qr *sqltypes.Result) int {
+	bytes := 0
+	for _, row := range qr.Rows {
+		for _, v := range row {
+			bytes += v.Len()
+		}
+	}
+	return bytes
+}
+
+// Shards returns the number of the shards touched by the txn executions.
+func (txn *Txn) Shards() uint64 {
+	return uint64(txn.shards.Get())
+}
+
+// TwoPC returns true if the executions are in the XA transaction on the sticky connections.
+func (txn *Txn) TwoPC() bool {
+	return txn.twopc
+}
+
 // twopcConnection used to get a connection via backend name from pool.
 // The connection is stored in twopcConnections.
 func (txn *Txn) twopcConnection(backend string) (Connection, error) {
@@ -231,11 +276,16 @@ func (txn *Txn) normalConnection(backend string) (Connection, error) {
 
 func (txn *Txn) replicaConnection(backend string) (Connection, error) {
 	poolz, ok := txn.backends[backend]
-	if !ok || poolz.replica == nil {
+	if !ok {
 		txnCounters.Add(txnCounterReplicaConnectionError, 1)
 		return nil, errors.Errorf("txn.can.not.get.replica.connection.by.backend[%+v].from.pool", backend)
 	}
-	conn, err := poolz.replica.Get()
+	replica := poolz.replica(txn.maxReplicaLag)
+	if replica == nil {
+		txnCounters.Add(txnCounterReplicaConnectionError, 1)
+		return nil, errors.Errorf("txn.can.not.get.replica.connection.by.backend[%+v].from.pool", backend)
+	}
+	conn, err := replica.Get()
 	if err != nil {
 		return nil, err
 	}
@@ -253,9 +303,11 @@ func (txn *Txn) fetchOneConnection(back string) (Connection, error) {
 	if txn.isExecOnRep {
 		conn, err = txn.replicaConnection(back)
 		if err == nil {
+			monitor.ReplicaRouteInc(back, replicaRouteReplica)
 			return conn, nil
 		}
 		log.Warning("txn.can.not.get.replica.connection.by.backend[%+v].from.pool", back)
+		monitor.ReplicaRouteInc(back, replicaRoutePrimary)
 	}
 
 	if txn.twopc {
@@ -484,16 +536,36 @@ func (txn *Txn) execute(req *xcontext.RequestContext) (*sqltypes.Result, error)
 
 		if c, x = txn.fetchOneConnection(back); x != nil {
 			log.Error("txn.fetch.connection.on[%s].querys[%v].error:%+v", back, querys, x)
+			span := req.Span.StartChild("backend.execute")
+			span.SetAttr("backend", back)
+			span.SetError(x)
+			span.Finish()
 		} else {
 			log.Debug("conn[%v].txn.sessid[%v].execute[%v]", c.ID(), txn.sessionID, querys[0])
 			for _, query := range querys {
 				var innerqr *sqltypes.Result
 
+				// Every query is a span with the rows and the bytes received.
+				span := req.Span.StartChild("backend.execute")
+				span.SetAttr("backend", back)
+				span.SetAttr("address", c.Address())
+				span.SetAttr("query", query)
+
 				// Execute to backends.
 				if innerqr, x = c.ExecuteWithLimits(query, txn.timeout, txn.maxResult); x != nil {
 					log.Error("txn.execute.on[%v].query[%v].error:%+v", c.Address(), query, x)
+					span.SetError(x)
+					span.Finish()
 					break
 				}
+				if span != nil {
+					span.SetAttr("rows", len(innerqr.Rows))
+					span.SetAttr("bytes", resultBytes(innerqr))
+					if innerqr.RowsAffected > 0 {
+						span.SetAttr("affected", innerqr.RowsAffected)
+					}
+					span.Finish()
+				}
 				mu.Lock()
 				qr.AppendResult(innerqr)
 				mu.Unlock()
@@ -511,6 +583,7 @@ func (txn *Txn) execute(req *xcontext.RequestContext) (*sqltypes.Result, error)
 			if poolz.conf.Role != config.NormalBackend {
 				continue
 			}
+			txn.shards.Add(1)
 			return qr, oneShard(back, txn, qs)
 		}
 	// ReqScatter mode: execute on the all shards of txn.backends.
@@ -523,6 +596,7 @@ func (txn *Txn) execute(req *xcontext.RequestContext) (*sqltypes.Result, error)
 			}
 
 			back := b
+			txn.shards.Add(1)
 			if beLen > 1 {
 				eg.Go(func() error {
 					return oneShard(back, txn, qs)
@@ -545,6 +619,7 @@ func (txn *Txn) execute(req *xcontext.RequestContext) (*sqltypes.Result, error)
 			queryMap[query.Backend] = v
 		}
 		beLen := len(queryMap)
+		txn.shards.Add(int64(beLen))
 		for b, qs := range queryMap {
 			back := b
 			querys := qs
@@ -575,8 +650,15 @@ func (txn *Txn) ExecuteStreamFetch(req *xcontext.RequestContext, callback func(*
 		}
 	}()
 
-	oneShard := func(c Connection, query string) error {
+	oneShard := func(c Connection, back string, query string) error {
+		span := req.Span.StartChild("backend.stream")
+		span.SetAttr("backend", back)
+		span.SetAttr("address", c.Address())
+		span.SetAttr("query", query)
+		defer span.Finish()
+
 		cursor, x := c.ExecuteStreamFetch(query)
+		span.SetError(x)
 		if x == nil {
 			mu.Lock()
 			cursors = append(cursors, cursor)
@@ -585,14 +667,15 @@ func (txn *Txn) ExecuteStreamFetch(req *xcontext.RequestContext, callback func(*
 		return x
 	}
 
+	txn.shards.Add(int64(len(req.Querys)))
 	for _, qt := range req.Querys {
 		var conn Connection
 		if conn, err = txn.fetchOneConnection(qt.Backend); err != nil {
 			return err
 		}
-		query := qt.Query
+		back, query := qt.Backend, qt.Query
 		eg.Go(func() error {
-			return oneShard(conn, query)
+			return oneShard(conn, back, query)
 		})
 	}
 	if err = eg.Wait(); err != nil {
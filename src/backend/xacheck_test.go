@@ -178,6 +178,7 @@ func TestReadXaCommitErrorLogsWithoutBackend(t *testing.T) {
 	time.Sleep(1 * time.Second)
 
 	scatter.txnMgr.xaCheck.Close()
+	scatter.replicaCheck.Close()
 }
 
 func TestTxnTwoPCExecuteCommitError(t *testing.T) {
@@ -24,21 +24,34 @@ const (
 
 // ProxyConfig tuple.
 type ProxyConfig struct {
-	IPS         []string `json:"allowip"`
-	MetaDir     string   `json:"meta-dir"`
-	Endpoint    string   `json:"endpoint"`
-	TwopcEnable bool     `json:"twopc-enable"`
-	LoadBalance int      `json:"load-balance"` // 0 -- disable balance, 1 -- enable balance to replica
-
-	MaxConnections   int    `json:"max-connections"`
-	MaxResultSize    int    `json:"max-result-size"`
-	MaxJoinRows      int    `json:"max-join-rows"`
-	DDLTimeout       int    `json:"ddl-timeout"`
-	QueryTimeout     int    `json:"query-timeout"`
-	PeerAddress      string `json:"peer-address,omitempty"`
-	LongQueryTime    int    `json:"long-query-time"`
-	StreamBufferSize int    `json:"stream-buffer-size"`
-	IdleTxnTimeout   uint32 `json:"kill-idle-transaction"` //is consistent with the official 8.0 kill_idle_transaction
+	IPS           []string `json:"allowip"`
+	MetaDir       string   `json:"meta-dir"`
+	Endpoint      string   `json:"endpoint"`
+	TwopcEnable   bool     `json:"twopc-enable"`
+	LoadBalance   int      `json:"load-balance"`    // 0 -- disable balance, 1 -- enable balance to replica
+	MaxReplicaLag int      `json:"max-replica-lag"` // 0 -- disable lag check, the max seconds a replica can lag to serve reads
+
+	MaxConnections    int    `json:"max-connections"`
+	MaxResultSize     int    `json:"max-result-size"`
+	MaxJoinRows       int    `json:"max-join-rows"`
+	GroupConcatMaxLen int    `json:"group-concat-max-len"` // the max bytes of the cross-shard group_concat result, 0 -- unlimited
+	DDLTimeout        int    `json:"ddl-timeout"`
+	DDLConcurrency    int    `json:"ddl-concurrency"` // the max concurrent ddl tasks per backend
+	DDLLockWait       int    `json:"ddl-lock-wait"`   // milliseconds to wait for the cluster lock held by others, 0 -- fail fast
+	DDLLockLease      int    `json:"ddl-lock-lease"`  // seconds of the cluster lock lease, renewed by the holder
+	QueryTimeout      int    `json:"query-timeout"`
+	PeerAddress       string `json:"peer-address,omitempty"`
+	LongQueryTime     int    `json:"long-query-time"`
+	SlowLogDir        string `json:"slow-log-dir,omitempty"` // the dir of the slow log files, empty -- disable
+	SlowLogMaxSize    int    `json:"slow-log-max-size"`      // the file is rotated beyond the size
+	SlowLogMaxFiles   int    `json:"slow-log-max-files"`     // the max old files kept, 0 -- unlimited
+	StreamBufferSize  int    `json:"stream-buffer-size"`
+	IdleTxnTimeout    uint32 `json:"kill-idle-transaction"` //is consistent with the official 8.0 kill_idle_transaction
+	SequenceCache     int    `json:"sequence-cache"`        // the values allocated per round trip to the sequence storage
+	SequenceBackend   string `json:"sequence-backend"`      // the backend which stores the sequences, pinned to the first backend if empty
+
+	QueryDigestMax     int `json:"query-digest-max"`     // the max digests kept, the others are counted in the overflow digest, 0 -- disable
+	QueryDigestMetrics int `json:"query-digest-metrics"` // the top digests by latency exported to prometheus
 
 	//If autocommit-false-is-txn=true (false by default), a client connection with cmd: set autocommit=0
 	//is treated as start a transaction, e.g. begin, start transaction.
@@ -48,18 +61,26 @@ type ProxyConfig struct {
 // DefaultProxyConfig returns default proxy config.
 func DefaultProxyConfig() *ProxyConfig {
 	return &ProxyConfig{
-		MetaDir:          "./radon-meta",
-		Endpoint:         "127.0.0.1:3308",
-		LoadBalance:      0,
-		MaxConnections:   1024,
-		MaxResultSize:    1024 * 1024 * 1024, // 1GB
-		MaxJoinRows:      32768,
-		DDLTimeout:       10 * 3600 * 1000, // 10hours
-		QueryTimeout:     5 * 60 * 1000,    // 5minutes
-		PeerAddress:      "127.0.0.1:8080",
-		LongQueryTime:    5,                // 5 seconds
-		StreamBufferSize: 1024 * 1024 * 32, // 32MB
-		IdleTxnTimeout:   60,               // 60 seconds
+		MetaDir:           "./radon-meta",
+		Endpoint:          "127.0.0.1:3308",
+		LoadBalance:       0,
+		MaxConnections:    1024,
+		MaxResultSize:     1024 * 1024 * 1024, // 1GB
+		MaxJoinRows:       32768,
+		GroupConcatMaxLen: 1024,
+		DDLTimeout:        10 * 3600 * 1000, // 10hours
+		DDLConcurrency:    1,                // 1 task per backend
+		DDLLockLease:      30,               // 30 seconds
+		QueryTimeout:      5 * 60 * 1000,    // 5minutes
+		PeerAddress:       "127.0.0.1:8080",
+		LongQueryTime:     5,                 // 5 seconds
+		SlowLogMaxSize:    1024 * 1024 * 256, // 256MB
+		StreamBufferSize:  1024 * 1024 * 32,  // 32MB
+		IdleTxnTimeout:    60,                // 60 seconds
+		SequenceCache:     1000,
+
+		QueryDigestMax:     1000,
+		QueryDigestMetrics: 100,
 	}
 }
 
@@ -74,12 +95,47 @@ func (c *ProxyConfig) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+const (
+	// AuditSinkFile writes the events to the rotating local files.
+	AuditSinkFile = "file"
+	// AuditSinkSyslog writes the events to the syslog.
+	AuditSinkSyslog = "syslog"
+	// AuditSinkUnix writes the events to the local unix socket.
+	AuditSinkUnix = "unix"
+	// AuditSinkHTTP posts the events to the http collector.
+	AuditSinkHTTP = "http"
+
+	// AuditPolicyBlock blocks the statements when the audit queue is full.
+	AuditPolicyBlock = "block"
+	// AuditPolicyDrop drops the events when the audit queue is full.
+	AuditPolicyDrop = "drop"
+)
+
+// AuditFilter tuple, the event matches the filter if it matches all the non-empty conditions.
+type AuditFilter struct {
+	Exclude   bool     `json:"exclude,omitempty"`   // the matched events are not audited
+	Users     []string `json:"users,omitempty"`     // the users
+	Hosts     []string `json:"hosts,omitempty"`     // the client hosts without the port
+	Databases []string `json:"databases,omitempty"` // the current databases of the sessions
+	Tables    []string `json:"tables,omitempty"`    // the tables in the statements, such as 't1' or 'db1.t1'
+	Commands  []string `json:"commands,omitempty"`  // the command types, such as SELECT, INSERT, DDL, ADMIN
+	Status    string   `json:"status,omitempty"`    // success or failure
+	MinCost   int      `json:"min-cost,omitempty"`  // the min cost in milliseconds
+}
+
 // AuditConfig tuple.
 type AuditConfig struct {
-	Mode        string `json:"mode"`
-	LogDir      string `json:"audit-dir"`
-	MaxSize     int    `json:"max-size"`
-	ExpireHours int    `json:"expire-hours"`
+	Mode         string         `json:"mode"`
+	LogDir       string         `json:"audit-dir"`
+	MaxSize      int            `json:"max-size"`
+	ExpireHours  int            `json:"expire-hours"`
+	MaxFiles     int            `json:"max-files,omitempty"`     // the max old files kept, 0 is unlimited
+	Filters      []*AuditFilter `json:"filters,omitempty"`       // the excluded events are dropped first, then the events must match one of the others if any
+	MaskLiterals bool           `json:"mask-literals,omitempty"` // replace the literals in the argument with '?'
+	Sink         string         `json:"sink"`                    // file, syslog, unix or http
+	SinkAddress  string         `json:"sink-address,omitempty"`  // the syslog address, the unix socket path or the collector url
+	QueueSize    int            `json:"queue-size"`              // the events buffered for the sink
+	FullPolicy   string         `json:"full-policy"`             // block or drop when the queue is full
 }
 
 // DefaultAuditConfig returns default audit config.
@@ -89,6 +145,9 @@ func DefaultAuditConfig() *AuditConfig {
 		LogDir:      "/tmp/auditlog",
 		MaxSize:     1024 * 1024 * 256, // 256MB
 		ExpireHours: 1,                 // 1hours
+		Sink:        AuditSinkFile,
+		QueueSize:   1024,
+		FullPolicy:  AuditPolicyBlock,
 	}
 }
 
@@ -149,17 +208,25 @@ func (c *MonitorConfig) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// ReplicaConfig tuple.
+type ReplicaConfig struct {
+	Address string `json:"address"`
+	Weight  int    `json:"weight"`
+}
+
 // BackendConfig tuple.
 type BackendConfig struct {
-	Name           string `json:"name"`
-	Address        string `json:"address"`
-	Replica        string `json:"replica-address"`
-	User           string `json:"user"`
-	Password       string `json:"password"`
-	DBName         string `json:"database"`
-	Charset        string `json:"charset"`
-	MaxConnections int    `json:"max-connections"`
-	Role           int    `json:"role"`
+	Name           string           `json:"name"`
+	Address        string           `json:"address"`
+	Replica        string           `json:"replica-address"`
+	Replicas       []*ReplicaConfig `json:"replicas,omitempty"`
+	Candidates     []string         `json:"candidates,omitempty"` // the addresses to failover when the primary is down
+	User           string           `json:"user"`
+	Password       string           `json:"password"`
+	DBName         string           `json:"database"`
+	Charset        string           `json:"charset"`
+	MaxConnections int              `json:"max-connections"`
+	Role           int              `json:"role"`
 }
 
 // BackendsConfig tuple.
@@ -182,13 +249,22 @@ type AutoIncrement struct {
 
 // TableConfig tuple.
 type TableConfig struct {
-	Name          string             `json:"name"`
-	Slots         int                `json:"slots-readonly"`
-	Blocks        int                `json:"blocks-readonly"`
-	ShardType     string             `json:"shardtype"`
-	ShardKey      string             `json:"shardkey"`
-	Partitions    []*PartitionConfig `json:"partitions"`
-	AutoIncrement *AutoIncrement     `json:"auto-increment,omitempty"`
+	Name            string             `json:"name"`
+	Slots           int                `json:"slots-readonly"`
+	Blocks          int                `json:"blocks-readonly"`
+	ShardType       string             `json:"shardtype"`
+	ShardKey        string             `json:"shardkey"`
+	ShardKeyDefault string             `json:"shardkey-default,omitempty"`
+	Partitions      []*PartitionConfig `json:"partitions"`
+	AutoIncrement   *AutoIncrement     `json:"auto-increment,omitempty"`
+	WriteFence      uint64             `json:"write-fence,omitempty"` // the reshard ddl job which fences the writes
+}
+
+// ViewConfig tuple.
+type ViewConfig struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns,omitempty"`
+	Query   string   `json:"query"`
 }
 
 // SchemaConfig tuple.
@@ -224,17 +300,26 @@ func (c *RouterConfig) UnmarshalJSON(b []byte) error {
 
 // ScatterConfig tuple.
 type ScatterConfig struct {
-	XaCheckInterval int    `json:"xa-check-interval"`
-	XaCheckDir      string `json:"xa-check-dir"`
-	XaCheckRetrys   int    `json:"xa-check-retrys"`
+	XaCheckInterval      int    `json:"xa-check-interval"`
+	XaCheckDir           string `json:"xa-check-dir"`
+	XaCheckRetrys        int    `json:"xa-check-retrys"`
+	ReplicaCheckInterval int    `json:"replica-check-interval"` // seconds between the replica lag checks
+
+	FailoverEnable        bool     `json:"failover-enable"`
+	FailoverCheckInterval int      `json:"failover-check-interval"`        // seconds between the primary health checks
+	FailoverMaxFailures   int      `json:"failover-max-failures"`          // the continuous failed checks to confirm the primary is down
+	FailoverPromoteSQL    []string `json:"failover-promote-sql,omitempty"` // the statements to promote the candidate, such as 'stop slave'
 }
 
 // DefaultScatterConfig returns default ScatterConfig config.
 func DefaultScatterConfig() *ScatterConfig {
 	return &ScatterConfig{
-		XaCheckInterval: 10,
-		XaCheckDir:      "./xacheck", //In the production environment, don't set the tmp dir
-		XaCheckRetrys:   10,
+		XaCheckInterval:       10,
+		XaCheckDir:            "./xacheck", //In the production environment, don't set the tmp dir
+		XaCheckRetrys:         10,
+		ReplicaCheckInterval:  5,
+		FailoverCheckInterval: 1,
+		FailoverMaxFailures:   3,
 	}
 }
 
@@ -249,6 +334,124 @@ func (c *ScatterConfig) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// MetaStoreConfig tuple.
+type MetaStoreConfig struct {
+	Type          string `json:"type"`    // file or mysql
+	Address       string `json:"address"` // the address of the mysql
+	User          string `json:"user"`
+	Password      string `json:"password"`
+	Database      string `json:"database"`
+	Table         string `json:"table"`
+	WatchInterval int    `json:"watch-interval"` // milliseconds between the change polls
+	HistoryMax    int    `json:"history-max"`    // the max snapshots of the meta history
+}
+
+// DefaultMetaStoreConfig returns the default MetaStoreConfig.
+func DefaultMetaStoreConfig() *MetaStoreConfig {
+	return &MetaStoreConfig{
+		Type:          "file",
+		Database:      "radon",
+		Table:         "meta",
+		WatchInterval: 1000,
+		HistoryMax:    100,
+	}
+}
+
+// UnmarshalJSON interface on MetaStoreConfig.
+func (c *MetaStoreConfig) UnmarshalJSON(b []byte) error {
+	type confAlias *MetaStoreConfig
+	conf := confAlias(DefaultMetaStoreConfig())
+	if err := json.Unmarshal(b, conf); err != nil {
+		return err
+	}
+	*c = MetaStoreConfig(*conf)
+	return nil
+}
+
+const (
+	// AdminRoleRead can only do the GET requests of the admin api.
+	AdminRoleRead = "read"
+
+	// AdminRoleAdmin can do all the requests of the admin api.
+	AdminRoleAdmin = "admin"
+
+	// AdminPeerUser is the user of the http basic auth with the cluster-secret, used by the shift callbacks.
+	AdminPeerUser = "radon-peer"
+)
+
+// AdminToken tuple, the static token of the admin api.
+type AdminToken struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+	Role  string `json:"role"` // read or admin
+}
+
+// AdminConfig tuple, the authentication and the tls of the REST admin api.
+type AdminConfig struct {
+	Auth          bool          `json:"auth"`                     // require the credentials, the peers must share the same cluster-secret
+	Tokens        []*AdminToken `json:"tokens,omitempty"`         // the static bearer tokens
+	BasicAuth     bool          `json:"basic-auth"`               // authenticate the radon users by the http basic auth
+	AdminUsers    []string      `json:"admin-users,omitempty"`    // the radon users with the admin role, the others are read only
+	ClusterSecret string        `json:"cluster-secret,omitempty"` // the token of the calls between the peers
+	TLSCert       string        `json:"tls-cert,omitempty"`       // the cert file to serve https
+	TLSKey        string        `json:"tls-key,omitempty"`
+	TLSCA         string        `json:"tls-ca,omitempty"` // the ca file to verify the peers, the system roots if empty
+}
+
+// DefaultAdminConfig returns the default AdminConfig.
+func DefaultAdminConfig() *AdminConfig {
+	return &AdminConfig{
+		Auth: false,
+	}
+}
+
+// UnmarshalJSON interface on AdminConfig.
+func (c *AdminConfig) UnmarshalJSON(b []byte) error {
+	type confAlias *AdminConfig
+	conf := confAlias(DefaultAdminConfig())
+	if err := json.Unmarshal(b, conf); err != nil {
+		return err
+	}
+	*c = AdminConfig(*conf)
+	return nil
+}
+
+const (
+	// TraceExporterFile writes the traces to the local file in the readable tree format.
+	TraceExporterFile = "file"
+
+	// TraceExporterOTLP sends the traces to the OpenTelemetry collector by OTLP/HTTP in json.
+	TraceExporterOTLP = "otlp"
+)
+
+// TraceConfig tuple.
+type TraceConfig struct {
+	SampleRate   float64 `json:"sample-rate"`             // the ratio of the statements traced, the statements with the hint '/*+ trace */' are always traced
+	Exporter     string  `json:"exporter"`                // file or otlp, empty to disable the tracing
+	File         string  `json:"file,omitempty"`          // the file of the file exporter
+	OTLPEndpoint string  `json:"otlp-endpoint,omitempty"` // the traces url of the collector, such as http://127.0.0.1:4318/v1/traces
+	MaxSpans     int     `json:"max-spans"`               // the max spans of a trace, the others are dropped
+}
+
+// DefaultTraceConfig returns the default TraceConfig.
+func DefaultTraceConfig() *TraceConfig {
+	return &TraceConfig{
+		SampleRate: 0,
+		MaxSpans:   1024,
+	}
+}
+
+// UnmarshalJSON interface on TraceConfig.
+func (c *TraceConfig) UnmarshalJSON(b []byte) error {
+	type confAlias *TraceConfig
+	conf := confAlias(DefaultTraceConfig())
+	if err := json.Unmarshal(b, conf); err != nil {
+		return err
+	}
+	*c = TraceConfig(*conf)
+	return nil
+}
+
 // Config tuple.
 type Config struct {
 	Proxy   *ProxyConfig   `json:"proxy"`
@@ -257,6 +460,10 @@ type Config struct {
 	Log     *LogConfig     `json:"log"`
 	Monitor *MonitorConfig `json:"monitor"`
 	Scatter *ScatterConfig `json:"scatter"`
+
+	MetaStore *MetaStoreConfig `json:"meta-store"`
+	Admin     *AdminConfig     `json:"admin"`
+	Trace     *TraceConfig     `json:"trace"`
 }
 
 func checkConfig(conf *Config) {
@@ -283,6 +490,18 @@ func checkConfig(conf *Config) {
 	if conf.Scatter == nil {
 		conf.Scatter = DefaultScatterConfig()
 	}
+
+	if conf.MetaStore == nil {
+		conf.MetaStore = DefaultMetaStoreConfig()
+	}
+
+	if conf.Admin == nil {
+		conf.Admin = DefaultAdminConfig()
+	}
+
+	if conf.Trace == nil {
+		conf.Trace = DefaultTraceConfig()
+	}
 }
 
 // LoadConfig used to load the config from file.
@@ -308,6 +527,15 @@ func ReadTableConfig(data string) (*TableConfig, error) {
 	return conf, nil
 }
 
+// ReadViewConfig used to read the view config from the data.
+func ReadViewConfig(data string) (*ViewConfig, error) {
+	conf := &ViewConfig{}
+	if err := json.Unmarshal([]byte(data), conf); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return conf, nil
+}
+
 // ReadBackendsConfig used to read the backend config from the data.
 func ReadBackendsConfig(data string) (*BackendsConfig, error) {
 	conf := &BackendsConfig{}
@@ -317,11 +545,20 @@ func ReadBackendsConfig(data string) (*BackendsConfig, error) {
 	return conf, nil
 }
 
+// MarshalConfig used to marshal the conf to the indented json.
+func MarshalConfig(conf interface{}) ([]byte, error) {
+	b, err := json.MarshalIndent(conf, "", "\t")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return b, nil
+}
+
 // WriteConfig used to write the conf to file.
 func WriteConfig(path string, conf interface{}) error {
-	b, err := json.MarshalIndent(conf, "", "\t")
+	b, err := MarshalConfig(conf)
 	if err != nil {
-		return errors.WithStack(err)
+		return err
 	}
 	return xbase.WriteFile(path, b)
 }
@@ -29,12 +29,15 @@ func TestWriteConfig(t *testing.T) {
 	defer os.RemoveAll(tmpDir)
 
 	conf := &Config{
-		Proxy:   MockProxyConfig,
-		Log:     MockLogConfig,
-		Audit:   DefaultAuditConfig(),
-		Router:  DefaultRouterConfig(),
-		Monitor: DefaultMonitorConfig(),
-		Scatter: DefaultScatterConfig(),
+		Proxy:     MockProxyConfig,
+		Log:       MockLogConfig,
+		Audit:     DefaultAuditConfig(),
+		Router:    DefaultRouterConfig(),
+		Monitor:   DefaultMonitorConfig(),
+		Scatter:   DefaultScatterConfig(),
+		MetaStore: DefaultMetaStoreConfig(),
+		Admin:     DefaultAdminConfig(),
+		Trace:     DefaultTraceConfig(),
 	}
 
 	path := path.Join(tmpDir, radonTestJSON)
@@ -66,12 +69,15 @@ func TestLoadConfig(t *testing.T) {
 			PeerAddress:    ":8080",
 		}
 		conf := &Config{
-			Proxy:   mockProxyConfig,
-			Audit:   DefaultAuditConfig(),
-			Router:  DefaultRouterConfig(),
-			Monitor: DefaultMonitorConfig(),
-			Log:     MockLogConfig,
-			Scatter: DefaultScatterConfig(),
+			Proxy:     mockProxyConfig,
+			Audit:     DefaultAuditConfig(),
+			Router:    DefaultRouterConfig(),
+			Monitor:   DefaultMonitorConfig(),
+			Log:       MockLogConfig,
+			Scatter:   DefaultScatterConfig(),
+			MetaStore: DefaultMetaStoreConfig(),
+			Admin:     DefaultAdminConfig(),
+			Trace:     DefaultTraceConfig(),
 		}
 
 		err := WriteConfig(path, conf)
@@ -97,12 +103,15 @@ func TestLoadConfig(t *testing.T) {
 		assert.Nil(t, err)
 		{
 			want := &Config{
-				Proxy:   MockProxyConfig,
-				Log:     MockLogConfig,
-				Audit:   DefaultAuditConfig(),
-				Router:  DefaultRouterConfig(),
-				Monitor: DefaultMonitorConfig(),
-				Scatter: DefaultScatterConfig(),
+				Proxy:     MockProxyConfig,
+				Log:       MockLogConfig,
+				Audit:     DefaultAuditConfig(),
+				Router:    DefaultRouterConfig(),
+				Monitor:   DefaultMonitorConfig(),
+				Scatter:   DefaultScatterConfig(),
+				MetaStore: DefaultMetaStoreConfig(),
+				Admin:     DefaultAdminConfig(),
+				Trace:     DefaultTraceConfig(),
 			}
 			got, err := LoadConfig(path)
 			assert.Nil(t, err)
@@ -112,12 +121,15 @@ func TestLoadConfig(t *testing.T) {
 
 	{
 		want := &Config{
-			Proxy:   MockProxyConfig,
-			Log:     MockLogConfig,
-			Audit:   DefaultAuditConfig(),
-			Router:  DefaultRouterConfig(),
-			Monitor: DefaultMonitorConfig(),
-			Scatter: DefaultScatterConfig(),
+			Proxy:     MockProxyConfig,
+			Log:       MockLogConfig,
+			Audit:     DefaultAuditConfig(),
+			Router:    DefaultRouterConfig(),
+			Monitor:   DefaultMonitorConfig(),
+			Scatter:   DefaultScatterConfig(),
+			MetaStore: DefaultMetaStoreConfig(),
+			Admin:     DefaultAdminConfig(),
+			Trace:     DefaultTraceConfig(),
 		}
 
 		err := WriteConfig(path, want)
@@ -147,12 +159,15 @@ func TestWriteLoadConfig(t *testing.T) {
 		conf, err := LoadConfig(path)
 		assert.Nil(t, err)
 		want := &Config{
-			Proxy:   MockProxyConfig,
-			Log:     MockLogConfig,
-			Audit:   DefaultAuditConfig(),
-			Router:  DefaultRouterConfig(),
-			Monitor: DefaultMonitorConfig(),
-			Scatter: DefaultScatterConfig(),
+			Proxy:     MockProxyConfig,
+			Log:       MockLogConfig,
+			Audit:     DefaultAuditConfig(),
+			Router:    DefaultRouterConfig(),
+			Monitor:   DefaultMonitorConfig(),
+			Scatter:   DefaultScatterConfig(),
+			MetaStore: DefaultMetaStoreConfig(),
+			Admin:     DefaultAdminConfig(),
+			Trace:     DefaultTraceConfig(),
 		}
 		got := conf
 		assert.Equal(t, want, got)
@@ -241,6 +256,22 @@ func TestReadTableConfigList(t *testing.T) {
 	assert.Equal(t, want, got)
 }
 
+func TestReadViewConfig(t *testing.T) {
+	data := `{
+	"name": "v1",
+	"columns": ["a", "b"],
+	"query": "select id, name from t1"
+}`
+
+	view, err := ReadViewConfig(data)
+	assert.Nil(t, err)
+	want := &ViewConfig{Name: "v1", Columns: []string{"a", "b"}, Query: "select id, name from t1"}
+	assert.Equal(t, want, view)
+
+	_, err = ReadViewConfig("{")
+	assert.NotNil(t, err)
+}
+
 func TestRouterConfigUnmarshalJSON(t *testing.T) {
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
 	tmpDir := getTmpDir("", "radon_config_", log)
@@ -257,12 +288,15 @@ func TestRouterConfigUnmarshalJSON(t *testing.T) {
 		got, err := LoadConfig(path)
 		assert.Nil(t, err)
 		want := &Config{
-			Proxy:   DefaultProxyConfig(),
-			Router:  DefaultRouterConfig(),
-			Audit:   DefaultAuditConfig(),
-			Log:     DefaultLogConfig(),
-			Monitor: DefaultMonitorConfig(),
-			Scatter: DefaultScatterConfig(),
+			Proxy:     DefaultProxyConfig(),
+			Router:    DefaultRouterConfig(),
+			Audit:     DefaultAuditConfig(),
+			Log:       DefaultLogConfig(),
+			Monitor:   DefaultMonitorConfig(),
+			Scatter:   DefaultScatterConfig(),
+			MetaStore: DefaultMetaStoreConfig(),
+			Admin:     DefaultAdminConfig(),
+			Trace:     DefaultTraceConfig(),
 		}
 		assert.Equal(t, want, got)
 	}
@@ -299,12 +333,15 @@ func TestRouterConfigUnmarshalJSON(t *testing.T) {
 		proxy := DefaultProxyConfig()
 		proxy.Endpoint = ":5566"
 		want := &Config{
-			Proxy:   proxy,
-			Router:  DefaultRouterConfig(),
-			Audit:   DefaultAuditConfig(),
-			Log:     DefaultLogConfig(),
-			Monitor: DefaultMonitorConfig(),
-			Scatter: DefaultScatterConfig(),
+			Proxy:     proxy,
+			Router:    DefaultRouterConfig(),
+			Audit:     DefaultAuditConfig(),
+			Log:       DefaultLogConfig(),
+			Monitor:   DefaultMonitorConfig(),
+			Scatter:   DefaultScatterConfig(),
+			MetaStore: DefaultMetaStoreConfig(),
+			Admin:     DefaultAdminConfig(),
+			Trace:     DefaultTraceConfig(),
 		}
 		assert.Equal(t, want, got)
 	}
@@ -22,6 +22,9 @@ import (
 const (
 	// versionJSONFile version file name.
 	versionJSONFile = "version.json"
+
+	// DDLJobsJSONFile ddl jobs file name, it's local to the node and not synced to the peers.
+	DDLJobsJSONFile = "ddljobs.json"
 )
 
 // Version tuple.
@@ -14,6 +14,7 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 
+	v1 "ctl/v1"
 	"proxy"
 
 	"github.com/ant0ine/go-json-rest/rest"
@@ -49,14 +50,23 @@ func (admin *Admin) Start() {
 		panic(err)
 	}
 
+	// The recorder sets the status code for the audit.
+	api.Use(v1.AuthMiddleware(admin.log, admin.proxy), v1.MetaHistoryMiddleware(admin.log, admin.proxy), &rest.RecorderMiddleware{})
 	api.SetApp(router)
 	handlers := api.MakeHandler()
 	admin.server = &http.Server{Addr: admin.proxy.PeerAddress(), Handler: handlers}
 
 	go func() {
 		log := admin.log
+		conf := admin.proxy.Config().Admin
 		log.Info("http.server.start[%v]...", admin.proxy.PeerAddress())
-		if err := admin.server.ListenAndServe(); err != http.ErrServerClosed {
+		var err error
+		if conf != nil && conf.TLSCert != "" {
+			err = admin.server.ListenAndServeTLS(conf.TLSCert, conf.TLSKey)
+		} else {
+			err = admin.server.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
 			log.Panic("%v", err)
 		}
 	}()
@@ -29,6 +29,7 @@ func (admin *Admin) NewRouter() (rest.App, error) {
 		rest.Put("/v1/radon/throttle", v1.ThrottleHandler(log, proxy)),
 		rest.Post("/v1/radon/backend", v1.AddBackendHandler(log, proxy)),
 		rest.Delete("/v1/radon/backend/:name", v1.RemoveBackendHandler(log, proxy)),
+		rest.Put("/v1/radon/backend/:name/switchover", v1.SwitchoverBackendHandler(log, proxy)),
 		rest.Get("/v1/radon/restapiaddress", v1.RestAPIAddressHandler(log, proxy)),
 		rest.Get("/v1/radon/status", v1.StatusHandler(log, proxy)),
 
@@ -38,6 +39,10 @@ func (admin *Admin) NewRouter() (rest.App, error) {
 		rest.Post("/v1/user/remove", v1.DropUserHandler(log, proxy)),
 		rest.Get("/v1/user/userz", v1.UserzHandler(log, proxy)),
 
+		// ddl job
+		rest.Put("/v1/ddl/jobs/:id/v1/radon/readonly", v1.DDLJobReadonlyHandler(log, proxy)),
+		rest.Put("/v1/ddl/jobs/:id/v1/radon/throttle", v1.DDLJobThrottleHandler(log, proxy)),
+
 		// shard
 		rest.Get("/v1/shard/shardz", v1.ShardzHandler(log, proxy)),
 		rest.Get("/v1/shard/globals", v1.GlobalsHandler(log, proxy)),
@@ -50,6 +55,15 @@ func (admin *Admin) NewRouter() (rest.App, error) {
 		rest.Get("/v1/meta/versions", v1.VersionzHandler(log, proxy)),
 		rest.Get("/v1/meta/versioncheck", v1.VersionCheckHandler(log, proxy)),
 		rest.Get("/v1/meta/metas", v1.MetazHandler(log, proxy)),
+		rest.Get("/v1/meta/raft", v1.RaftStatusHandler(log, proxy)),
+		rest.Post("/v1/meta/raft/vote", v1.RaftVoteHandler(log, proxy)),
+		rest.Post("/v1/meta/raft/append", v1.RaftAppendHandler(log, proxy)),
+		rest.Post("/v1/meta/raft/propose", v1.RaftProposeHandler(log, proxy)),
+		rest.Get("/v1/meta/history", v1.MetaHistoryHandler(log, proxy)),
+		rest.Get("/v1/meta/history/diff/:from/:to", v1.MetaHistoryDiffHandler(log, proxy)),
+		rest.Post("/v1/meta/history/rollback", v1.MetaHistoryRollbackHandler(log, proxy)),
+		rest.Post("/v1/meta/lock", v1.LockHandler(log, proxy)),
+		rest.Get("/v1/meta/locks", v1.LocksHandler(log, proxy)),
 
 		// peer
 		rest.Get("/v1/peer/peerz", v1.PeerzHandler(log, proxy)),
@@ -60,6 +74,7 @@ func (admin *Admin) NewRouter() (rest.App, error) {
 		rest.Get("/v1/debug/processlist", v1.ProcesslistHandler(log, proxy)),
 		rest.Get("/v1/debug/queryz/:limit", v1.QueryzHandler(log, proxy)),
 		rest.Get("/v1/debug/txnz/:limit", v1.TxnzHandler(log, proxy)),
+		rest.Get("/v1/debug/querydigest/:limit", v1.QueryDigestHandler(log, proxy)),
 		rest.Get("/v1/debug/configz", v1.ConfigzHandler(log, proxy)),
 		rest.Get("/v1/debug/backendz", v1.BackendzHandler(log, proxy)),
 		rest.Get("/v1/debug/schemaz", v1.SchemazHandler(log, proxy)),
@@ -0,0 +1,200 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package v1
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"config"
+	"proxy"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// rolePeer is the role of the other radon peers which send the cluster secret.
+const rolePeer = "peer"
+
+// roleShift is the role of the shift callbacks which send the shift token of the spanner.
+const roleShift = "shift"
+
+// authFreePaths can be requested without the credentials.
+var authFreePaths = map[string]bool{
+	"/v1/radon/ping": true,
+}
+
+// readPosts are the POST requests which change nothing.
+var readPosts = map[string]bool{
+	"/v1/radon/explain": true,
+}
+
+// secretPaths are the GET requests which return the cluster secret, the admin tokens or the backend passwords,
+// they are only for the admin and the peers.
+var secretPaths = map[string]bool{
+	"/v1/debug/configz":  true,
+	"/v1/debug/backendz": true,
+	"/v1/meta/metas":     true,
+}
+
+// peerPaths are the calls between the peers, they need the cluster secret and are not audited.
+var peerPaths = []string{
+	"/v1/meta/raft/",
+	"/v1/meta/lock",
+	"/v1/meta/versions",
+}
+
+// shiftPaths are the callbacks of the shifts, see the RadonURL of the spanner.
+var shiftPaths = []string{
+	"/v1/radon/readonly",
+	"/v1/radon/throttle",
+	"/v1/shard/shift",
+	"/v1/ddl/jobs/",
+}
+
+func isShiftPath(path string) bool {
+	for _, prefix := range shiftPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isPeerPath(path string) bool {
+	for _, prefix := range peerPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func secretEqual(a, b string) bool {
+	return a != "" && subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// authenticate returns the user and the role of the request.
+func authenticate(p *proxy.Proxy, conf *config.AdminConfig, r *rest.Request) (string, string, error) {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token := strings.TrimPrefix(auth, "Bearer ")
+		if secretEqual(conf.ClusterSecret, token) {
+			return config.AdminPeerUser, rolePeer, nil
+		}
+		for _, t := range conf.Tokens {
+			if secretEqual(t.Token, token) {
+				return t.Name, t.Role, nil
+			}
+		}
+		return "", "", errors.New("api.v1.auth.token.invalid")
+	}
+
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return "", "", errors.New("api.v1.auth.credentials.required")
+	}
+	if user == config.AdminPeerUser {
+		if secretEqual(conf.ClusterSecret, password) {
+			return user, rolePeer, nil
+		}
+		if secretEqual(p.Spanner().ShiftToken(), password) {
+			return user, roleShift, nil
+		}
+	}
+	if !conf.BasicAuth {
+		return "", "", errors.Errorf("api.v1.auth.basic.user[%s].disabled", user)
+	}
+	if err := p.Spanner().PasswordCheck(user, password); err != nil {
+		return "", "", err
+	}
+	for _, admin := range conf.AdminUsers {
+		if admin == user {
+			return user, config.AdminRoleAdmin, nil
+		}
+	}
+	return user, config.AdminRoleRead, nil
+}
+
+// authorize checks the role can do the request.
+func authorize(role string, r *rest.Request) error {
+	path := r.URL.Path
+	switch role {
+	case rolePeer:
+		return nil
+	case roleShift:
+		if isShiftPath(path) {
+			return nil
+		}
+	case config.AdminRoleAdmin:
+		if isPeerPath(path) && r.Method != http.MethodGet {
+			return errors.Errorf("api.v1.auth.%s.is.only.for.peers", path)
+		}
+		return nil
+	case config.AdminRoleRead:
+		if (r.Method == http.MethodGet && !secretPaths[path]) || (r.Method == http.MethodPost && readPosts[path]) {
+			return nil
+		}
+	}
+	return errors.Errorf("api.v1.auth.role[%s].can.not.%s.%s", role, r.Method, path)
+}
+
+// AuthMiddleware used to authenticate and authorize the requests of the admin api if the admin auth is enabled,
+// and record the admin calls in the audit log, the calls between the peers are not recorded.
+func AuthMiddleware(log *xlog.Log, proxy *proxy.Proxy) rest.Middleware {
+	return rest.MiddlewareSimple(func(handler rest.HandlerFunc) rest.HandlerFunc {
+		return func(w rest.ResponseWriter, r *rest.Request) {
+			start := time.Now()
+			user := r.RemoteAddr
+			status := http.StatusOK
+
+			conf := proxy.Config().Admin
+			if conf != nil && conf.Auth && !authFreePaths[r.URL.Path] {
+				name, role, err := authenticate(proxy, conf, r)
+				if err == nil {
+					user = name
+					r.Env["REMOTE_USER"] = name
+					if err = authorize(role, r); err != nil {
+						status = http.StatusForbidden
+					}
+				} else {
+					status = http.StatusUnauthorized
+					w.Header().Set("WWW-Authenticate", `Basic realm="radon"`)
+				}
+				if err != nil {
+					log.Warning("api.v1.auth[%s %s].from[%s].denied:%v", r.Method, r.URL.Path, r.RemoteAddr, err)
+					rest.Error(w, err.Error(), status)
+					adminAudit(proxy, user, r, status, start)
+					return
+				}
+			}
+
+			handler(w, r)
+			if code, ok := r.Env["STATUS_CODE"].(int); ok {
+				status = code
+			}
+			adminAudit(proxy, user, r, status, start)
+		}
+	})
+}
+
+func adminAudit(proxy *proxy.Proxy, user string, r *rest.Request, status int, start time.Time) {
+	if isPeerPath(r.URL.Path) {
+		return
+	}
+	code := uint16(0)
+	if status >= http.StatusBadRequest {
+		code = uint16(status)
+	}
+	call := fmt.Sprintf("%s %s", r.Method, r.URL.Path)
+	proxy.Audit().LogAdminEvent(user, r.RemoteAddr, call, code, start)
+}
@@ -0,0 +1,153 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package v1
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"testing"
+
+	"config"
+	"proxy"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/stretchr/testify/assert"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestCtlV1Auth(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := proxy.MockDefaultConfig()
+	conf.Admin = &config.AdminConfig{
+		Auth: true,
+		Tokens: []*config.AdminToken{
+			{Name: "monitor", Token: "read-token", Role: config.AdminRoleRead},
+			{Name: "ops", Token: "admin-token", Role: config.AdminRoleAdmin},
+		},
+		BasicAuth:     true,
+		AdminUsers:    []string{"u1"},
+		ClusterSecret: "cluster-secret",
+	}
+	fakedbs, proxy, cleanup := proxy.MockProxy1(log, conf)
+	defer cleanup()
+
+	// The radon users u1 and u2 with the password 'pwd'.
+	{
+		stage1 := sha1.Sum([]byte("pwd"))
+		stage2 := sha1.Sum(stage1[:])
+		qr := &sqltypes.Result{
+			Fields: []*querypb.Field{
+				{Name: "authentication_string", Type: querypb.Type_VARCHAR},
+			},
+			Rows: [][]sqltypes.Value{
+				{sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("*"+hex.EncodeToString(stage2[:])))},
+			},
+		}
+		fakedbs.AddQueryPattern("select .* from mysql.user where user='u1'", qr)
+		fakedbs.AddQueryPattern("select .* from mysql.user where user='u2'", qr)
+		fakedbs.AddQueryPattern("select .* from mysql.user where user='u3'", &sqltypes.Result{})
+		fakedbs.AddQuery("select 1", &sqltypes.Result{})
+	}
+
+	api := rest.NewApi()
+	api.Use(AuthMiddleware(log, proxy), &rest.RecorderMiddleware{})
+	router, _ := rest.MakeRouter(
+		rest.Get("/v1/radon/ping", PingHandler(log, proxy)),
+		rest.Get("/v1/meta/raft", RaftStatusHandler(log, proxy)),
+		rest.Post("/v1/meta/raft/propose", func(w rest.ResponseWriter, r *rest.Request) {}),
+		rest.Put("/v1/radon/readonly", ReadonlyHandler(log, proxy)),
+		rest.Get("/v1/debug/configz", ConfigzHandler(log, proxy)),
+		rest.Get("/v1/debug/backendz", BackendzHandler(log, proxy)),
+		rest.Get("/v1/meta/metas", MetazHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	request := func(method, url string, payload interface{}, set func(r *http.Request)) *test.Recorded {
+		req := test.MakeSimpleRequest(method, "http://localhost"+url, payload)
+		if set != nil {
+			set(req)
+		}
+		return test.RunRequest(t, handler, req)
+	}
+	bearer := func(token string) func(r *http.Request) {
+		return func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+	basic := func(user, password string) func(r *http.Request) {
+		return func(r *http.Request) {
+			r.SetBasicAuth(user, password)
+		}
+	}
+	readonly := &readonlyParams{ReadOnly: false}
+
+	// No credentials.
+	{
+		request("GET", "/v1/radon/ping", nil, nil).CodeIs(200)
+		recorded := request("GET", "/v1/meta/raft", nil, nil)
+		recorded.CodeIs(401)
+		recorded.HeaderIs("WWW-Authenticate", `Basic realm="radon"`)
+		request("GET", "/v1/meta/raft", nil, bearer("bad-token")).CodeIs(401)
+	}
+
+	// Tokens.
+	{
+		request("GET", "/v1/meta/raft", nil, bearer("read-token")).CodeIs(200)
+		request("PUT", "/v1/radon/readonly", readonly, bearer("read-token")).CodeIs(403)
+		request("PUT", "/v1/radon/readonly", readonly, bearer("admin-token")).CodeIs(200)
+		request("POST", "/v1/meta/raft/propose", nil, bearer("admin-token")).CodeIs(403)
+	}
+
+	// The secrets are not readable by the read role.
+	{
+		for _, path := range []string{"/v1/debug/configz", "/v1/debug/backendz", "/v1/meta/metas"} {
+			recorded := request("GET", path, nil, bearer("read-token"))
+			recorded.CodeIs(403)
+			assert.NotContains(t, recorded.Recorder.Body.String(), "cluster-secret")
+			request("GET", path, nil, basic("u2", "pwd")).CodeIs(403)
+		}
+		recorded := request("GET", "/v1/debug/configz", nil, bearer("admin-token"))
+		recorded.CodeIs(200)
+		assert.Contains(t, recorded.Recorder.Body.String(), "cluster-secret")
+		request("GET", "/v1/meta/metas", nil, bearer("cluster-secret")).CodeIs(200)
+	}
+
+	// Basic auth of the radon users.
+	{
+		request("GET", "/v1/meta/raft", nil, basic("u2", "pwd")).CodeIs(200)
+		request("PUT", "/v1/radon/readonly", readonly, basic("u2", "pwd")).CodeIs(403)
+		request("PUT", "/v1/radon/readonly", readonly, basic("u1", "pwd")).CodeIs(200)
+		request("GET", "/v1/meta/raft", nil, basic("u1", "bad")).CodeIs(401)
+		request("GET", "/v1/meta/raft", nil, basic("u3", "pwd")).CodeIs(401)
+		request("GET", "/v1/meta/raft", nil, basic("u'1", "pwd")).CodeIs(401)
+	}
+
+	// The peers.
+	{
+		request("POST", "/v1/meta/raft/propose", nil, bearer("cluster-secret")).CodeIs(200)
+		request("PUT", "/v1/radon/readonly", readonly, basic(config.AdminPeerUser, "cluster-secret")).CodeIs(200)
+		request("PUT", "/v1/radon/readonly", readonly, basic(config.AdminPeerUser, "bad")).CodeIs(401)
+	}
+
+	// The shift callbacks.
+	{
+		token := proxy.Spanner().ShiftToken()
+		assert.Equal(t, 32, len(token))
+		assert.Equal(t, "http://"+config.AdminPeerUser+":"+token+"@"+conf.Proxy.PeerAddress, proxy.Spanner().RadonURL())
+		request("PUT", "/v1/radon/readonly", readonly, basic(config.AdminPeerUser, token)).CodeIs(200)
+		request("GET", "/v1/meta/raft", nil, basic(config.AdminPeerUser, token)).CodeIs(403)
+		request("POST", "/v1/meta/raft/propose", nil, basic(config.AdminPeerUser, token)).CodeIs(403)
+		request("PUT", "/v1/radon/readonly", readonly, basic("u1", token)).CodeIs(401)
+	}
+}
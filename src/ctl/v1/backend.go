@@ -20,12 +20,14 @@ import (
 )
 
 type backendParams struct {
-	Name           string `json:"name"`
-	Address        string `json:"address"`
-	Replica        string `json:"replica-address"`
-	User           string `json:"user"`
-	Password       string `json:"password"`
-	MaxConnections int    `json:"max-connections"`
+	Name           string                  `json:"name"`
+	Address        string                  `json:"address"`
+	Replica        string                  `json:"replica-address"`
+	Replicas       []*config.ReplicaConfig `json:"replicas,omitempty"`
+	Candidates     []string                `json:"candidates,omitempty"`
+	User           string                  `json:"user"`
+	Password       string                  `json:"password"`
+	MaxConnections int                     `json:"max-connections"`
 }
 
 // AddBackendHandler impl.
@@ -67,6 +69,8 @@ func addBackendHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter,
 		Name:           p.Name,
 		Address:        p.Address,
 		Replica:        p.Replica,
+		Replicas:       p.Replicas,
+		Candidates:     p.Candidates,
 		User:           p.User,
 		Password:       p.Password,
 		Charset:        "utf8",
@@ -121,3 +125,45 @@ func removeBackendHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWrit
 		return
 	}
 }
+
+type switchoverParams struct {
+	Address string `json:"address"`
+}
+
+// SwitchoverBackendHandler impl.
+func SwitchoverBackendHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		switchoverBackendHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+func switchoverBackendHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	scatter := proxy.Scatter()
+	backend := r.PathParam("name")
+	p := switchoverParams{}
+	err := r.DecodeJsonPayload(&p)
+	if err != nil {
+		log.Error("api.v1.switchover.backend.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if p.Address == "" {
+		log.Error("api.v1.switchover.backend[%v].error:address.is.empty", backend)
+		rest.Error(w, "api.v1.switchover.request.address.is.null", http.StatusInternalServerError)
+		return
+	}
+	log.Warning("api.v1.switchover[from:%v].backend[%v].to[%v]", r.RemoteAddr, backend, p.Address)
+
+	if err := scatter.Switchover(backend, p.Address); err != nil {
+		log.Error("api.v1.switchover.backend[%v].error:%+v", backend, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := scatter.FlushConfig(); err != nil {
+		log.Error("api.v1.switchover.backend.flush.config.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"testing"
 
 	"backend"
+	"fakedb"
 	"proxy"
 
 	"github.com/ant0ine/go-json-rest/rest"
@@ -198,3 +199,87 @@ func TestCtlV1BackendRemoveError(t *testing.T) {
 		recorded.CodeIs(500)
 	}
 }
+
+func TestCtlV1BackendSwitchover(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	_, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+	candidates := fakedb.New(log, 1)
+	defer candidates.Close()
+	candidates.AddQuery("xa recover", &sqltypes.Result{})
+	candidate := candidates.Addrs()[0]
+
+	// server
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Put("/v1/radon/backend/:name/switchover", SwitchoverBackendHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// Not a candidate.
+	{
+		p := &switchoverParams{Address: candidate}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("PUT", "http://localhost/v1/radon/backend/backend1/switchover", p))
+		recorded.CodeIs(500)
+	}
+
+	scatter := proxy.Scatter()
+	for _, conf := range scatter.BackendConfigsClone() {
+		if conf.Name == "backend1" {
+			err := scatter.Remove(conf)
+			assert.Nil(t, err)
+			conf.Candidates = []string{candidate}
+			err = scatter.Add(conf)
+			assert.Nil(t, err)
+		}
+	}
+
+	{
+		p := &switchoverParams{Address: candidate}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("PUT", "http://localhost/v1/radon/backend/backend1/switchover", p))
+		recorded.CodeIs(200)
+
+		confs := proxy.Scatter().BackendConfigsClone()
+		for _, conf := range confs {
+			if conf.Name == "backend1" {
+				assert.Equal(t, candidate, conf.Address)
+			}
+		}
+	}
+}
+
+func TestCtlV1BackendSwitchoverError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	_, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+
+	// server
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Put("/v1/radon/backend/:name/switchover", SwitchoverBackendHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// 404.
+	{
+		p := &switchoverParams{Address: "127.0.0.1:1"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("PUT", "http://localhost/v1/radon/backend/xx/switchover", p))
+		recorded.CodeIs(500)
+	}
+
+	// Bad payload.
+	{
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("PUT", "http://localhost/v1/radon/backend/backend1/switchover", "xx"))
+		recorded.CodeIs(500)
+	}
+
+	// Empty address.
+	{
+		p := &switchoverParams{}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("PUT", "http://localhost/v1/radon/backend/backend1/switchover", p))
+		recorded.CodeIs(500)
+		recorded.BodyIs("{\"Error\":\"api.v1.switchover.request.address.is.null\"}")
+	}
+}
@@ -0,0 +1,83 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package v1
+
+import (
+	"net/http"
+	"strconv"
+
+	"proxy"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// DDLJobReadonlyHandler impl.
+// It's the readonly api for the shifts of the reshard ddl job, the RadonURL of the shift is /v1/ddl/jobs/:id.
+func DDLJobReadonlyHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		ddlJobReadonlyHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+func ddlJobReadonlyHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	id, err := strconv.ParseUint(r.PathParam("id"), 10, 64)
+	if err != nil {
+		log.Error("api.v1.ddl.job.readonly.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	p := readonlyParams{}
+	if err := r.DecodeJsonPayload(&p); err != nil {
+		log.Error("api.v1.ddl.job[%d].readonly.error:%+v", id, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Warning("api.v1.ddl.job[%d].readonly[from:%v].body:%+v", id, r.RemoteAddr, p)
+	if err := proxy.ReshardReadOnly(id, p.ReadOnly); err != nil {
+		log.Error("api.v1.ddl.job[%d].readonly.error:%+v", id, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DDLJobThrottleHandler impl.
+// The shifts of the reshard ddl job throttle the writes to the table being resharded rather than the whole radon.
+func DDLJobThrottleHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		ddlJobThrottleHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+func ddlJobThrottleHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	id, err := strconv.ParseUint(r.PathParam("id"), 10, 64)
+	if err != nil {
+		log.Error("api.v1.ddl.job.throttle.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	p := throttleParams{}
+	if err := r.DecodeJsonPayload(&p); err != nil {
+		log.Error("api.v1.ddl.job[%d].throttle.error:%+v", id, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Info("api.v1.ddl.job[%d].throttle[from:%v].body:%+v", id, r.RemoteAddr, p)
+	if err := proxy.ReshardThrottle(id, p.Limits); err != nil {
+		log.Error("api.v1.ddl.job[%d].throttle.error:%+v", id, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,82 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package v1
+
+import (
+	"testing"
+
+	"proxy"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestCtlV1DDLJobReadonly(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	_, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+
+	{
+		// server
+		api := rest.NewApi()
+		router, _ := rest.MakeRouter(
+			rest.Put("/v1/ddl/jobs/:id/v1/radon/readonly", DDLJobReadonlyHandler(log, proxy)),
+			rest.Put("/v1/ddl/jobs/:id/v1/radon/throttle", DDLJobThrottleHandler(log, proxy)),
+		)
+		api.SetApp(router)
+		handler := api.MakeHandler()
+
+		// 200.
+		{
+			p := &readonlyParams{
+				ReadOnly: false,
+			}
+			recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("PUT", "http://localhost/v1/ddl/jobs/1/v1/radon/readonly", p))
+			recorded.CodeIs(200)
+		}
+
+		// 500, the job is not a running reshard.
+		{
+			p := &throttleParams{
+				Limits: 100,
+			}
+			recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("PUT", "http://localhost/v1/ddl/jobs/1/v1/radon/throttle", p))
+			recorded.CodeIs(500)
+			recorded = test.RunRequest(t, handler, test.MakeSimpleRequest("PUT", "http://localhost/v1/ddl/jobs/x/v1/radon/throttle", p))
+			recorded.CodeIs(500)
+		}
+
+		// 500, the job is not a running reshard.
+		{
+			p := &readonlyParams{
+				ReadOnly: true,
+			}
+			recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("PUT", "http://localhost/v1/ddl/jobs/1/v1/radon/readonly", p))
+			recorded.CodeIs(500)
+		}
+
+		// 500, invalid job id.
+		{
+			p := &readonlyParams{
+				ReadOnly: true,
+			}
+			recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("PUT", "http://localhost/v1/ddl/jobs/x/v1/radon/readonly", p))
+			recorded.CodeIs(500)
+		}
+
+		// 500, invalid body.
+		{
+			recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("PUT", "http://localhost/v1/ddl/jobs/1/v1/radon/readonly", nil))
+			recorded.CodeIs(500)
+			recorded = test.RunRequest(t, handler, test.MakeSimpleRequest("PUT", "http://localhost/v1/ddl/jobs/1/v1/radon/throttle", nil))
+			recorded.CodeIs(500)
+		}
+	}
+}
@@ -19,6 +19,11 @@ import (
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
+// isAnalyze returns true if the query is the ANALYZE of 'EXPLAIN ANALYZE'.
+func isAnalyze(query string) bool {
+	return proxy.AnalyzeRegexp.MatchString(query)
+}
+
 type explainParams struct {
 	Query string `json:"query"`
 }
@@ -46,6 +51,14 @@ func explainHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r
 	rsp := &resp{}
 	router := proxy.Router()
 	query := p.Query
+	// The EXPLAIN ANALYZE executes the statement on the backends with the privileges of the session,
+	// the api has no session so it only returns the static plan.
+	if isAnalyze(query) {
+		log.Error("ctl.v1.explain[%s].analyze.not.supported", query)
+		rsp.Msg = "explain analyze is not supported by the api, use the sql 'EXPLAIN ANALYZE' instead"
+		w.WriteJson(rsp)
+		return
+	}
 	node, err := sqlparser.Parse(query)
 	if err != nil {
 		log.Error("ctl.v1.explain[%s].parser.error:%+v", query, err)
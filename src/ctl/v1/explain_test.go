@@ -64,5 +64,15 @@ func TestCtlV1Explain(t *testing.T) {
 		}
 		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/radon/explain", p))
 		recorded.CodeIs(200)
+
+		// explain analyze.
+		p = &explainParams{
+			Query: "analyze select id from test.t1",
+		}
+		recorded = test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/radon/explain", p))
+		recorded.CodeIs(200)
+		want := "{\"Msg\":\"explain analyze is not supported by the api, use the sql 'EXPLAIN ANALYZE' instead\"}"
+		got := recorded.Recorder.Body.String()
+		assert.Equal(t, want, got)
 	}
 }
@@ -0,0 +1,190 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package v1
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"metastore"
+	"proxy"
+	"syncer"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+type historyVersion struct {
+	Version int64  `json:"version"`
+	Time    string `json:"time"`
+	Author  string `json:"author"`
+	Cause   string `json:"cause"`
+}
+
+// MetaHistoryHandler impl.
+func MetaHistoryHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		metaHistoryHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+func metaHistoryHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	snapshots, err := proxy.MetaHistory().Snapshots()
+	if err != nil {
+		log.Error("api.v1.meta.history.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	versions := make([]*historyVersion, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		versions = append(versions, &historyVersion{
+			Version: snapshot.Version,
+			Time:    snapshot.Time().Format("2006-01-02 15:04:05.000000"),
+			Author:  snapshot.Author,
+			Cause:   snapshot.Cause,
+		})
+	}
+	w.WriteJson(versions)
+}
+
+// MetaHistoryDiffHandler impl.
+func MetaHistoryDiffHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		metaHistoryDiffHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+func metaHistoryDiffHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	from, err := strconv.ParseInt(r.PathParam("from"), 10, 64)
+	if err != nil {
+		log.Error("api.v1.meta.history.diff.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	to, err := strconv.ParseInt(r.PathParam("to"), 10, 64)
+	if err != nil {
+		log.Error("api.v1.meta.history.diff.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	changes, err := proxy.MetaHistory().Diff(from, to)
+	if err != nil {
+		log.Error("api.v1.meta.history.diff[%d:%d].error:%+v", from, to, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if changes == nil {
+		changes = []*metastore.Change{}
+	}
+	w.WriteJson(changes)
+}
+
+type rollbackParams struct {
+	Version int64 `json:"version"`
+}
+
+// MetaHistoryRollbackHandler impl.
+func MetaHistoryRollbackHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		metaHistoryRollbackHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+func metaHistoryRollbackHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	p := rollbackParams{}
+	if err := r.DecodeJsonPayload(&p); err != nil {
+		log.Error("api.v1.meta.history.rollback.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Warning("api.v1.meta.history.rollback[from:%v].body:%+v", r.RemoteAddr, p)
+	// Same as the radon meta rollback statement, the rollback holds the cluster lock.
+	owner := fmt.Sprintf("%s/rest:%s", proxy.PeerAddress(), r.RemoteAddr)
+	cause := fmt.Sprintf("meta rollback to %d", p.Version)
+	guard, err := proxy.Spanner().ClusterLock(owner, cause, syncer.LockCluster)
+	if err != nil {
+		log.Error("api.v1.meta.history.rollback.lock.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer guard.Unlock()
+	if err := guard.Err(); err != nil {
+		log.Error("api.v1.meta.history.rollback.lock.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	author := r.RemoteAddr
+	if user, ok := r.Env["REMOTE_USER"].(string); ok {
+		author = user
+	}
+	changes, err := proxy.MetaHistory().Rollback(p.Version, author)
+	if err != nil {
+		log.Error("api.v1.meta.history.rollback[%d].error:%+v", p.Version, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if changes == nil {
+		changes = []*metastore.Change{}
+	}
+	w.WriteJson(changes)
+}
+
+// metaPaths are the REST requests which may change the backends, databases or tables.
+var metaPaths = []string{
+	"/v1/radon/backend",
+	"/v1/shard/shift",
+	"/v1/shard/reload",
+	"/v1/shard/migrate",
+}
+
+func isMetaPath(path string) bool {
+	for _, prefix := range metaPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// MetaHistoryMiddleware used to record the meta history after the succeeded REST requests which may change the metadata,
+// the author is the authenticated user or the remote address and the cause is the method and the path.
+// The status is read from the rest.RecorderMiddleware, so it must be used before the recorder.
+func MetaHistoryMiddleware(log *xlog.Log, proxy *proxy.Proxy) rest.Middleware {
+	return rest.MiddlewareSimple(func(handler rest.HandlerFunc) rest.HandlerFunc {
+		return func(w rest.ResponseWriter, r *rest.Request) {
+			handler(w, r)
+
+			// The rollback records itself.
+			if r.Method == http.MethodGet || !isMetaPath(r.URL.Path) {
+				return
+			}
+			if code, ok := r.Env["STATUS_CODE"].(int); ok && code >= http.StatusBadRequest {
+				return
+			}
+			author := r.RemoteAddr
+			if user, ok := r.Env["REMOTE_USER"].(string); ok {
+				author = user
+			}
+			history := proxy.Spanner().History()
+			cause := fmt.Sprintf("rest: %s %s", r.Method, r.URL.Path)
+			if _, err := history.Record(author, cause); err != nil {
+				log.Error("api.v1.meta.history.record[%s].error:%+v", cause, err)
+			}
+		}
+	})
+}
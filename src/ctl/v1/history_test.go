@@ -0,0 +1,138 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"proxy"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestCtlV1MetaHistory(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+	}
+
+	// create database and table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		_, err = client.FetchAll("create database test", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("create table test.t1(id int, b int) partition by hash(id) partitions 8", -1)
+		assert.Nil(t, err)
+	}
+
+	api := rest.NewApi()
+	api.Use(MetaHistoryMiddleware(log, proxy), &rest.RecorderMiddleware{})
+	router, _ := rest.MakeRouter(
+		rest.Get("/v1/meta/history", MetaHistoryHandler(log, proxy)),
+		rest.Get("/v1/meta/history/diff/:from/:to", MetaHistoryDiffHandler(log, proxy)),
+		rest.Post("/v1/meta/history/rollback", MetaHistoryRollbackHandler(log, proxy)),
+		rest.Post("/v1/shard/reload", func(w rest.ResponseWriter, r *rest.Request) {
+			proxy.Router().CreateDatabase("db2")
+		}),
+		rest.Post("/v1/shard/shift", func(w rest.ResponseWriter, r *rest.Request) {
+			proxy.Router().CreateDatabase("db3")
+			rest.Error(w, "mock.error", 500)
+		}),
+		rest.Put("/v1/radon/twopc", func(w rest.ResponseWriter, r *rest.Request) {
+			proxy.Router().CreateDatabase("db4")
+		}),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// The REST request is recorded by the middleware.
+	{
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/shard/reload", nil))
+		recorded.CodeIs(200)
+	}
+
+	// The failed request and the request which is not for the metadata are not recorded.
+	{
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/shard/shift", nil))
+		recorded.CodeIs(500)
+		recorded = test.RunRequest(t, handler, test.MakeSimpleRequest("PUT", "http://localhost/v1/radon/twopc", nil))
+		recorded.CodeIs(200)
+	}
+
+	var versions []*historyVersion
+	{
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/v1/meta/history", nil))
+		recorded.CodeIs(200)
+		err := json.Unmarshal(recorded.Recorder.Body.Bytes(), &versions)
+		assert.Nil(t, err)
+		assert.Equal(t, 3, len(versions))
+		assert.Equal(t, "mock", versions[1].Author)
+		assert.Equal(t, "rest: POST /v1/shard/reload", versions[2].Cause)
+	}
+
+	// Diff.
+	{
+		url := fmt.Sprintf("http://localhost/v1/meta/history/diff/%d/%d", versions[0].Version, versions[1].Version)
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("GET", url, nil))
+		recorded.CodeIs(200)
+		assert.Equal(t, `[{"type":"table","name":"test.t1","action":"add","from":"","to":"HASH(id)"}]`, recorded.Recorder.Body.String())
+
+		recorded = test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/v1/meta/history/diff/x/1", nil))
+		recorded.CodeIs(500)
+		recorded = test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/v1/meta/history/diff/1/2", nil))
+		recorded.CodeIs(500)
+	}
+
+	// Rollback.
+	{
+		qr := &sqltypes.Result{
+			Fields: []*querypb.Field{
+				{Name: "table_schema", Type: querypb.Type_VARCHAR},
+				{Name: "table_name", Type: querypb.Type_VARCHAR},
+			},
+		}
+		for i := 0; i < 8; i++ {
+			qr.Rows = append(qr.Rows, []sqltypes.Value{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("test")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(fmt.Sprintf("t1_%04d", i))),
+			})
+		}
+		fakedbs.AddQueryPattern("select table_schema, table_name from information_schema.tables .*", qr)
+
+		p := &rollbackParams{Version: versions[1].Version}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/meta/history/rollback", p))
+		recorded.CodeIs(200)
+		want := `[{"type":"database","name":"db2","action":"drop","from":"","to":""},` +
+			`{"type":"database","name":"db3","action":"drop","from":"","to":""},` +
+			`{"type":"database","name":"db4","action":"drop","from":"","to":""}]`
+		assert.Equal(t, want, recorded.Recorder.Body.String())
+		assert.NotNil(t, proxy.Router().CheckDatabase("db2"))
+
+		p = &rollbackParams{Version: 1}
+		recorded = test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/meta/history/rollback", p))
+		recorded.CodeIs(500)
+		assert.True(t, strings.Contains(recorded.Recorder.Body.String(), "meta.history.version[1].not.found"))
+	}
+}
@@ -13,6 +13,7 @@ import (
 
 	"config"
 	"proxy"
+	"syncer"
 
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/xelabs/go-mysqlstack/xlog"
@@ -74,3 +75,120 @@ func metazHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *r
 	}
 	w.WriteJson(meta)
 }
+
+// RaftVoteHandler impl.
+func RaftVoteHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		raftVoteHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+func raftVoteHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	req := &syncer.VoteRequest{}
+	if err := r.DecodeJsonPayload(req); err != nil {
+		log.Error("api.v1.raft.vote.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteJson(proxy.Syncer().RaftVote(req))
+}
+
+// RaftAppendHandler impl.
+func RaftAppendHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		raftAppendHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+func raftAppendHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	req := &syncer.AppendRequest{}
+	if err := r.DecodeJsonPayload(req); err != nil {
+		log.Error("api.v1.raft.append.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteJson(proxy.Syncer().RaftAppend(req))
+}
+
+// RaftProposeHandler impl.
+func RaftProposeHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		raftProposeHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+func raftProposeHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	entry := &syncer.Entry{}
+	if err := r.DecodeJsonPayload(entry); err != nil {
+		log.Error("api.v1.raft.propose.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rsp, err := proxy.Syncer().RaftPropose(entry)
+	if err != nil {
+		log.Error("api.v1.raft.propose.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteJson(rsp)
+}
+
+// RaftStatusHandler impl.
+func RaftStatusHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		raftStatusHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+func raftStatusHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	w.WriteJson(proxy.Syncer().RaftStatus())
+}
+
+// LockHandler impl, it handles the lock requests as the coordinator.
+func LockHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		lockHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+func lockHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	req := &syncer.LockRequest{}
+	if err := r.DecodeJsonPayload(req); err != nil {
+		log.Error("api.v1.meta.lock.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rsp, err := proxy.Syncer().HandleLock(req)
+	if err != nil {
+		log.Error("api.v1.meta.lock.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteJson(rsp)
+}
+
+// LocksHandler impl, it returns the locks held in the cluster.
+func LocksHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		locksHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+func locksHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	locks, err := proxy.Syncer().Locks()
+	if err != nil {
+		log.Error("api.v1.meta.locks.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if locks == nil {
+		locks = []*syncer.Lock{}
+	}
+	w.WriteJson(locks)
+}
@@ -13,6 +13,7 @@ import (
 	"testing"
 
 	"proxy"
+	"syncer"
 
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/ant0ine/go-json-rest/rest/test"
@@ -158,3 +159,121 @@ func TestCtlV1Metaz(t *testing.T) {
 		assert.True(t, got)
 	}
 }
+
+func TestCtlV1Raft(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	_, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Get("/v1/meta/raft", RaftStatusHandler(log, proxy)),
+		rest.Post("/v1/meta/raft/vote", RaftVoteHandler(log, proxy)),
+		rest.Post("/v1/meta/raft/append", RaftAppendHandler(log, proxy)),
+		rest.Post("/v1/meta/raft/propose", RaftProposeHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// Vote for a candidate of the higher term.
+	{
+		req := &syncer.VoteRequest{Term: 100, Candidate: "127.0.0.1:9999", LastIndex: 100, LastTerm: 100}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/meta/raft/vote", req))
+		recorded.CodeIs(200)
+		rsp := &syncer.VoteResponse{}
+		err := recorded.DecodeJsonPayload(rsp)
+		assert.Nil(t, err)
+		assert.True(t, rsp.Granted)
+		assert.Equal(t, uint64(100), rsp.Term)
+	}
+
+	// Heartbeat from the leader.
+	{
+		req := &syncer.AppendRequest{Term: 100, Leader: "127.0.0.1:9999"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/meta/raft/append", req))
+		recorded.CodeIs(200)
+		rsp := &syncer.AppendResponse{}
+		err := recorded.DecodeJsonPayload(rsp)
+		assert.Nil(t, err)
+		assert.True(t, rsp.Success)
+	}
+
+	// Status.
+	{
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/v1/meta/raft", nil))
+		recorded.CodeIs(200)
+		status := &syncer.RaftStatus{}
+		err := recorded.DecodeJsonPayload(status)
+		assert.Nil(t, err)
+		assert.Equal(t, syncer.RaftFollower, status.Role)
+		assert.Equal(t, "127.0.0.1:9999", status.Leader)
+	}
+
+	// Propose to a follower.
+	{
+		entry := &syncer.Entry{Puts: map[string]string{"a.json": "{}"}}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/meta/raft/propose", entry))
+		recorded.CodeIs(500)
+	}
+
+	// Bad payload.
+	{
+		for _, url := range []string{"vote", "append", "propose"} {
+			recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/meta/raft/"+url, "xx"))
+			recorded.CodeIs(500)
+		}
+	}
+}
+
+func TestCtlV1Locks(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	_, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Post("/v1/meta/lock", LockHandler(log, proxy)),
+		rest.Get("/v1/meta/locks", LocksHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// Lock.
+	{
+		req := &syncer.LockRequest{Op: syncer.LockOpLock, Name: "db1.t1", Owner: "peer1", Cause: "create table db1.t1", Lease: 3000}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/meta/lock", req))
+		recorded.CodeIs(200)
+		rsp := &syncer.LockResponse{}
+		err := recorded.DecodeJsonPayload(rsp)
+		assert.Nil(t, err)
+		assert.Nil(t, rsp.Holder)
+	}
+
+	// Conflict.
+	{
+		req := &syncer.LockRequest{Op: syncer.LockOpLock, Name: "db1", Owner: "peer2", Lease: 3000}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/meta/lock", req))
+		recorded.CodeIs(200)
+		rsp := &syncer.LockResponse{}
+		err := recorded.DecodeJsonPayload(rsp)
+		assert.Nil(t, err)
+		assert.Equal(t, "peer1", rsp.Holder.Owner)
+	}
+
+	// Locks.
+	{
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/v1/meta/locks", nil))
+		recorded.CodeIs(200)
+		var locks []*syncer.Lock
+		err := recorded.DecodeJsonPayload(&locks)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(locks))
+		assert.Equal(t, "create table db1.t1", locks[0].Cause)
+	}
+
+	// Bad payload.
+	{
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/meta/lock", "xx"))
+		recorded.CodeIs(500)
+	}
+}
@@ -0,0 +1,41 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package v1
+
+import (
+	"net/http"
+	"strconv"
+
+	"proxy"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// QueryDigestHandler impl.
+func QueryDigestHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		queryDigestHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+func queryDigestHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	digests := proxy.Spanner().QueryDigests()
+	if digests == nil {
+		rest.Error(w, "api.v1.query.digest.disabled", http.StatusNotFound)
+		return
+	}
+
+	limit := 100
+	if v, err := strconv.Atoi(r.PathParam("limit")); err == nil {
+		limit = v
+	}
+	w.WriteJson(digests.Rows(limit))
+}
@@ -0,0 +1,83 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package v1
+
+import (
+	"encoding/json"
+	"testing"
+
+	"proxy"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestCtlV1QueryDigest(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select .*", &sqltypes.Result{})
+	}
+
+	// create database and table, select twice.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		querys := []string{
+			"create database test",
+			"create table test.t1(id int, b int) partition by hash(id)",
+			"select * from test.t1 where id=1",
+			"select * from test.t1 where id=2",
+		}
+		for _, query := range querys {
+			_, err = client.FetchAll(query, -1)
+			assert.Nil(t, err)
+		}
+	}
+
+	{
+		api := rest.NewApi()
+		router, _ := rest.MakeRouter(
+			rest.Get("/v1/debug/querydigest/:limit", QueryDigestHandler(log, proxy)),
+		)
+		api.SetApp(router)
+		handler := api.MakeHandler()
+
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/v1/debug/querydigest/10", nil))
+		recorded.CodeIs(200)
+
+		var rows []struct {
+			Text   string `json:"digest-text"`
+			Count  uint64 `json:"count"`
+			Shards uint64 `json:"shards"`
+		}
+		err := json.Unmarshal(recorded.Recorder.Body.Bytes(), &rows)
+		assert.Nil(t, err)
+		assert.Equal(t, 3, len(rows))
+		var found bool
+		for _, row := range rows {
+			if row.Text == "select * from test.t1 where id = ?" {
+				found = true
+				assert.EqualValues(t, 2, row.Count)
+				assert.EqualValues(t, 2, row.Shards)
+			}
+		}
+		assert.True(t, found)
+	}
+}
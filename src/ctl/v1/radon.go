@@ -18,17 +18,19 @@ import (
 )
 
 type radonParams struct {
-	MaxConnections   *int     `json:"max-connections"`
-	MaxResultSize    *int     `json:"max-result-size"`
-	MaxJoinRows      *int     `json:"max-join-rows"`
-	DDLTimeout       *int     `json:"ddl-timeout"`
-	QueryTimeout     *int     `json:"query-timeout"`
-	TwoPCEnable      *bool    `json:"twopc-enable"`
-	LoadBalance      *int     `json:"load-balance"`
-	AllowIP          []string `json:"allowip,omitempty"`
-	AuditMode        *string  `json:"audit-mode"`
-	StreamBufferSize *int     `json:"stream-buffer-size"`
-	Blocks           *int     `json:"blocks-readonly"`
+	MaxConnections    *int     `json:"max-connections"`
+	MaxResultSize     *int     `json:"max-result-size"`
+	MaxJoinRows       *int     `json:"max-join-rows"`
+	GroupConcatMaxLen *int     `json:"group-concat-max-len"`
+	DDLTimeout        *int     `json:"ddl-timeout"`
+	QueryTimeout      *int     `json:"query-timeout"`
+	TwoPCEnable       *bool    `json:"twopc-enable"`
+	LoadBalance       *int     `json:"load-balance"`
+	MaxReplicaLag     *int     `json:"max-replica-lag"`
+	AllowIP           []string `json:"allowip,omitempty"`
+	AuditMode         *string  `json:"audit-mode"`
+	StreamBufferSize  *int     `json:"stream-buffer-size"`
+	Blocks            *int     `json:"blocks-readonly"`
 }
 
 // RadonConfigHandler impl.
@@ -58,6 +60,9 @@ func radonConfigHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter
 	if p.MaxJoinRows != nil {
 		proxy.SetMaxJoinRows(*p.MaxJoinRows)
 	}
+	if p.GroupConcatMaxLen != nil {
+		proxy.SetGroupConcatMaxLen(*p.GroupConcatMaxLen)
+	}
 	if p.DDLTimeout != nil {
 		proxy.SetDDLTimeout(*p.DDLTimeout)
 	}
@@ -70,6 +75,9 @@ func radonConfigHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter
 	if p.LoadBalance != nil {
 		proxy.SetLoadBalance(*p.LoadBalance)
 	}
+	if p.MaxReplicaLag != nil {
+		proxy.SetMaxReplicaLag(*p.MaxReplicaLag)
+	}
 	proxy.SetAllowIP(p.AllowIP)
 	if p.AuditMode != nil {
 		proxy.SetAuditMode(*p.AuditMode)
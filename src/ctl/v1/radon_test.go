@@ -43,6 +43,7 @@ func TestCtlV1RadonConfig(t *testing.T) {
 			QueryTimeout     int      `json:"query-timeout"`
 			TwoPCEnable      bool     `json:"twopc-enable"`
 			LoadBalance      int      `json:"load-balance"`
+			MaxReplicaLag    int      `json:"max-replica-lag"`
 			AllowIP          []string `json:"allowip,omitempty"`
 			AuditMode        string   `json:"audit-mode"`
 			StreamBufferSize int      `json:"stream-buffer-size"`
@@ -59,6 +60,7 @@ func TestCtlV1RadonConfig(t *testing.T) {
 				QueryTimeout:     33,
 				TwoPCEnable:      true,
 				LoadBalance:      1,
+				MaxReplicaLag:    30,
 				AllowIP:          []string{"127.0.0.1", "127.0.0.2"},
 				AuditMode:        "A",
 				StreamBufferSize: 16777216,
@@ -75,6 +77,7 @@ func TestCtlV1RadonConfig(t *testing.T) {
 			assert.Equal(t, 33, radonConf.Proxy.QueryTimeout)
 			assert.Equal(t, true, radonConf.Proxy.TwopcEnable)
 			assert.Equal(t, 1, radonConf.Proxy.LoadBalance)
+			assert.Equal(t, 30, radonConf.Proxy.MaxReplicaLag)
 			assert.Equal(t, []string{"127.0.0.1", "127.0.0.2"}, radonConf.Proxy.IPS)
 			assert.Equal(t, "A", radonConf.Audit.Mode)
 			assert.Equal(t, 16777216, radonConf.Proxy.StreamBufferSize)
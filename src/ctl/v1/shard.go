@@ -15,6 +15,7 @@ import (
 
 	"plugins/shiftmanager"
 	"proxy"
+	"xbase"
 
 	"github.com/ant0ine/go-json-rest/rest"
 	shiftlog "github.com/radondb/shift/xlog"
@@ -165,6 +166,7 @@ func shardRuleShiftHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWri
 		return
 	}
 
+	// The lock is held by the migrate or the rebalance which shifts the rule, so it's not taken here.
 	if err := router.PartitionRuleShift(fromBackend, toBackend, p.Database, p.Table); err != nil {
 		log.Error("api.v1.shard.rule.PartitionRuleShift.error:%+v", err)
 		rest.Error(w, err.Error(), http.StatusInternalServerError)
@@ -276,7 +278,7 @@ func shardMigrateHandler(proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Requ
 	scatter := proxy.Scatter()
 	log := shiftlog.NewStdLog(shiftlog.Level(shiftlog.INFO))
 	p := &migrateParams{
-		RadonURL:               "http://" + proxy.Config().Proxy.PeerAddress,
+		RadonURL:               proxy.Spanner().RadonURL(),
 		Rebalance:              false,
 		Cleanup:                false,
 		MySQLDump:              "mysqldump",
@@ -301,7 +303,9 @@ func shardMigrateHandler(proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Requ
 	// check args.
 	if len(p.FromUser) == 0 || len(p.FromDatabase) == 0 || len(p.FromTable) == 0 ||
 		len(p.ToUser) == 0 || len(p.ToDatabase) == 0 || len(p.ToTable) == 0 {
-		log.Error("api.v1.shard.migrate[%+v].error:some param is empty", p)
+		logp := *p
+		logp.RadonURL = xbase.RedactURL(p.RadonURL)
+		log.Error("api.v1.shard.migrate[%+v].error:some param is empty", &logp)
 		rest.Error(w, "some args are empty", http.StatusNoContent)
 		return
 	}
@@ -322,6 +326,17 @@ func shardMigrateHandler(proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Requ
 		return
 	}
 
+	// The shift calls back the ShardRuleShiftHandler which takes no lock.
+	owner := fmt.Sprintf("%s/rest:%s", proxy.PeerAddress(), r.RemoteAddr)
+	cause := fmt.Sprintf("shard migrate %s.%s to %s", p.ToDatabase, p.ToTable, p.To)
+	guard, err := proxy.Spanner().ClusterLock(owner, cause, p.FromDatabase+"."+p.FromTable, p.ToDatabase+"."+p.ToTable)
+	if err != nil {
+		log.Error("api.v1.shard.migrate.lock.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer guard.Unlock()
+
 	cfg := &shiftmanager.ShiftInfo{
 		From:                   p.From,
 		FromUser:               p.FromUser,
@@ -354,7 +369,18 @@ func shardMigrateHandler(proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Requ
 		return
 	}
 
+	// The shift is stopped if the cluster locks are lost.
+	finished := make(chan bool)
+	go func() {
+		select {
+		case <-guard.Lost():
+			log.Error("api.v1.shard.migrate.stop.shift[%s].since.the.locks.are.lost:%v", key, guard.Err())
+			shiftMgr.StopOneInstance(key)
+		case <-finished:
+		}
+	}()
 	err = shiftMgr.WaitInstanceFinish(key)
+	close(finished)
 	if err != nil {
 		log.Error("shift.wait.finish.error:%+v", err)
 		rest.Error(w, err.Error(), http.StatusInternalServerError)
@@ -43,6 +43,7 @@ func (executor *DDLExecutor) Execute(ctx *xcontext.ResultContext) error {
 	reqCtx.Mode = plan.ReqMode
 	reqCtx.Querys = plan.Querys
 	reqCtx.RawQuery = plan.RawQuery
+	reqCtx.Span = ctx.Span
 
 	res, err := executor.txn.Execute(reqCtx)
 	if err != nil {
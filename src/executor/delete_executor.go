@@ -13,6 +13,7 @@ import (
 	"planner"
 	"xcontext"
 
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -39,11 +40,24 @@ func NewDeleteExecutor(log *xlog.Log, plan planner.Plan, txn backend.Transaction
 // Execute used to execute the executor.
 func (executor *DeleteExecutor) Execute(ctx *xcontext.ResultContext) error {
 	plan := executor.plan.(*planner.DeletePlan)
+	querys := plan.Querys
+	if plan.Join != nil {
+		var err error
+		if querys, err = executeJoinDML(executor.log, plan.Join, executor.txn, ctx.Span); err != nil {
+			return err
+		}
+		if len(querys) == 0 {
+			ctx.Results = &sqltypes.Result{}
+			return nil
+		}
+	}
+
 	reqCtx := xcontext.NewRequestContext()
 	reqCtx.Mode = plan.ReqMode
 	reqCtx.TxnMode = xcontext.TxnWrite
-	reqCtx.Querys = plan.Querys
+	reqCtx.Querys = querys
 	reqCtx.RawQuery = plan.RawQuery
+	reqCtx.Span = ctx.Span
 
 	rs, err := executor.txn.Execute(reqCtx)
 	if err != nil {
@@ -18,6 +18,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -66,3 +68,90 @@ func TestDeleteExecutor(t *testing.T) {
 		}
 	}
 }
+
+func TestDeleteExecutorCrossShard(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	// Create scatter and query handler.
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.CreateDatabase(database)
+	assert.Nil(t, err)
+	err = route.AddForTest(database, router.MockTableMConfig(), router.MockTableBConfig())
+	assert.Nil(t, err)
+
+	keys := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "column_name", Type: querypb.Type_VARCHAR},
+			{Name: "column_key", Type: querypb.Type_VARCHAR},
+		},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("id")), sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("PRI"))},
+		},
+	}
+	lefts := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "id", Type: querypb.Type_INT32},
+		},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1"))},
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("2"))},
+		},
+	}
+	rights := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "k", Type: querypb.Type_INT32},
+		},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1"))},
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("2"))},
+		},
+	}
+
+	// Add querys.
+	fakedbs.AddQueryPattern("select column_name, column_key from information_schema.columns .*", keys)
+	fakedbs.AddQueryPattern("select A.id from sbtest.A.*", lefts)
+	fakedbs.AddQueryPattern("select B.k from sbtest.B.*", rights)
+	fakedbs.AddQuery("delete from sbtest.A6 where id in (1, 2)", fakedb.Result3)
+
+	query := "delete A from A join B on A.id = B.k where B.z = 1"
+	node, err := sqlparser.Parse(query)
+	assert.Nil(t, err)
+
+	plan := planner.NewDeletePlan(log, database, query, node.(*sqlparser.Delete), route)
+	err = plan.Build()
+	assert.Nil(t, err)
+
+	txn, err := scatter.CreateTransaction()
+	assert.Nil(t, err)
+	defer txn.Finish()
+	txn.SetMaxJoinRows(32768)
+	executor := NewDeleteExecutor(log, plan, txn)
+	// The twopc is required.
+	{
+		ctx := xcontext.NewResultContext()
+		err := executor.Execute(ctx)
+		assert.Equal(t, "unsupported: cross-shard.dml.of.table.'sbtest.A'.without.twopc", err.Error())
+	}
+
+	assert.Nil(t, txn.Begin())
+	{
+		ctx := xcontext.NewResultContext()
+		err := executor.Execute(ctx)
+		assert.Nil(t, err)
+	}
+
+	// The target table has no primary key.
+	fakedbs.ResetAll()
+	fakedbs.AddQueryPattern("select column_name, column_key from information_schema.columns .*", &sqltypes.Result{Fields: keys.Fields})
+	{
+		ctx := xcontext.NewResultContext()
+		err := executor.Execute(ctx)
+		assert.Equal(t, "unsupported: table.'A'.has.no.primary.key", err.Error())
+	}
+}
@@ -8,7 +8,29 @@
 
 package engine
 
-import "sync"
+import (
+	"sync"
+
+	"backend"
+	"executor/engine/operator"
+	"planner/builder"
+	"xcontext"
+	"xtrace"
+
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// execSubPlan executes the operators of the node under the span of the engine,
+// and sets the rows of the engine.
+func execSubPlan(log *xlog.Log, node builder.PlanNode, txn backend.Transaction, ctx *xcontext.ResultContext, span *xtrace.Span) error {
+	sctx := &xcontext.ResultContext{Results: ctx.Results, Span: span, GroupConcatMaxLen: txn.GroupConcatMaxLen()}
+	err := operator.ExecSubPlan(log, node, sctx)
+	ctx.Results = sctx.Results
+	if err == nil && ctx.Results != nil {
+		span.SetAttr("rows", len(ctx.Results.Rows))
+	}
+	return err
+}
 
 // calcPool used to the merge join calc.
 type calcPool struct {
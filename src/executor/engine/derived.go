@@ -0,0 +1,151 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package engine
+
+import (
+	"encoding/binary"
+
+	"backend"
+	"planner/builder"
+	"xcontext"
+	"xtrace"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const (
+	// maxRecursionDepth is the max iterations of the recursive common table expression.
+	maxRecursionDepth = 1000
+)
+
+// materializeDerived materializes the derived tables of the node, returns the rows by the bind names.
+func materializeDerived(log *xlog.Log, node *builder.MergeNode, txn backend.Transaction, span *xtrace.Span) (map[string]sqlparser.Encodable, error) {
+	tables := node.Derived()
+	if len(tables) == 0 {
+		return nil, nil
+	}
+	extras := make(map[string]sqlparser.Encodable, len(tables))
+	for name, d := range tables {
+		if err := materialize(log, d, txn, span); err != nil {
+			return nil, err
+		}
+		extras[name] = d
+	}
+	return extras, nil
+}
+
+// materialize executes the derived table only once, the rows are kept in the derived table.
+// The rows of the Self are set by its recursive common table expression.
+// The rows are buffered in memory, so they are limited by the max join rows like the join.
+func materialize(log *xlog.Log, d *builder.Derived, txn backend.Transaction, span *xtrace.Span) error {
+	d.Lock()
+	defer d.Unlock()
+	if d.Result() != nil {
+		return nil
+	}
+
+	switch {
+	case d.Root != nil:
+		rs, err := executeNode(log, d.Root, txn, span)
+		if err != nil {
+			return err
+		}
+		if maxrow := txn.MaxJoinRows(); len(rs.Rows) > maxrow {
+			return errors.Errorf("unsupported: derived.row.count.exceeded.allowed.limit.of.'%d'", maxrow)
+		}
+		d.SetResult(rs)
+	case d.Anchor != nil:
+		rs, err := executeRecursive(log, d, txn, span)
+		if err != nil {
+			return err
+		}
+		d.SetResult(rs)
+	}
+	return nil
+}
+
+// executeRecursive executes the anchor part, then executes the recursive part over the rows
+// of the last iteration until no new rows are produced.
+func executeRecursive(log *xlog.Log, d *builder.Derived, txn backend.Transaction, span *xtrace.Span) (*sqltypes.Result, error) {
+	anchor, err := executeNode(log, d.Anchor, txn, span)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{})
+	distinct := func(rows [][]sqltypes.Value) [][]sqltypes.Value {
+		if !d.Distinct {
+			return rows
+		}
+		var news [][]sqltypes.Value
+		for _, row := range rows {
+			key := distinctKey(row)
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				news = append(news, row)
+			}
+		}
+		return news
+	}
+
+	maxrow := txn.MaxJoinRows()
+	result := &sqltypes.Result{Fields: anchor.Fields}
+	work := distinct(anchor.Rows)
+	for depth := 0; len(work) > 0; depth++ {
+		if depth >= maxRecursionDepth {
+			return nil, errors.Errorf("recursive.query.aborted.after.%d.iterations", maxRecursionDepth)
+		}
+		if len(result.Rows)+len(work) > maxrow {
+			return nil, errors.Errorf("unsupported: derived.row.count.exceeded.allowed.limit.of.'%d'", maxrow)
+		}
+		result.Rows = append(result.Rows, work...)
+		d.Self.SetResult(&sqltypes.Result{Fields: anchor.Fields, Rows: work})
+		rs, err := executeNode(log, d.Recursive, txn, span)
+		if err != nil {
+			return nil, err
+		}
+		if len(rs.Fields) != len(anchor.Fields) {
+			return nil, errors.New("unsupported: the.used.'select'.statements.have.a.different.number.of.columns")
+		}
+		work = distinct(rs.Rows)
+	}
+	result.RowsAffected = uint64(len(result.Rows))
+	return result, nil
+}
+
+// distinctKey returns the key of the row to remove the duplicates, every value is encoded with
+// a null flag and the length, so the NULL, the '' and the values containing the 0x00 never collide.
+func distinctKey(row []sqltypes.Value) string {
+	var key []byte
+	var buf [binary.MaxVarintLen64]byte
+	for _, v := range row {
+		if v.IsNull() {
+			key = append(key, 0)
+			continue
+		}
+		raw := v.Raw()
+		key = append(key, 1)
+		key = append(key, buf[:binary.PutUvarint(buf[:], uint64(len(raw)))]...)
+		key = append(key, raw...)
+	}
+	return string(key)
+}
+
+// executeNode executes the plan node and returns the rows.
+func executeNode(log *xlog.Log, node builder.PlanNode, txn backend.Transaction, span *xtrace.Span) (*sqltypes.Result, error) {
+	ctx := xcontext.NewResultContext()
+	ctx.Span = span
+	if err := BuildEngine(log, node, txn).Execute(ctx); err != nil {
+		return nil, err
+	}
+	return ctx.Results, nil
+}
@@ -0,0 +1,221 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package engine
+
+import (
+	"fmt"
+	"testing"
+
+	"backend"
+	"planner"
+	"router"
+	"xcontext"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestDerivedMaterialize(t *testing.T) {
+	r1 := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{
+				Name: "a",
+				Type: querypb.Type_INT32,
+			},
+			{
+				Name: "n",
+				Type: querypb.Type_INT64,
+			},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1")),
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("2")),
+			},
+			{
+				sqltypes.MakeTrusted(querypb.Type_INT32, []byte("3")),
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("1")),
+			},
+		},
+	}
+	r2 := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{
+				Name: "a",
+				Type: querypb.Type_INT32,
+			},
+			{
+				Name: "n",
+				Type: querypb.Type_INT64,
+			},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1")),
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("2")),
+			},
+		},
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.CreateDatabase(database)
+	assert.Nil(t, err)
+	err = route.AddForTest(database, router.MockTableAConfig())
+	assert.Nil(t, err)
+
+	// Create scatter and query handler.
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+	fakedbs.AddQuery("select a, count(*) as n from sbtest.A0 as A group by a order by a asc", r1)
+	fakedbs.AddQuery("select a, count(*) as n from sbtest.A2 as A group by a order by a asc", r2)
+	fakedbs.AddQuery("select a, count(*) as n from sbtest.A4 as A group by a order by a asc", &sqltypes.Result{Fields: r1.Fields})
+	fakedbs.AddQuery("select a, count(*) as n from sbtest.A8 as A group by a order by a asc", &sqltypes.Result{Fields: r1.Fields})
+	fakedbs.AddQuery("select * from (select 1 as a, 4 as n union all select 3, 1) as t where n > 1", r2)
+
+	query := "with t as (select a, count(*) as n from A group by a) select * from t where n > 1"
+	node, err := sqlparser.Parse(query)
+	assert.Nil(t, err)
+
+	plan := planner.NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+	err = plan.Build()
+	assert.Nil(t, err)
+
+	// The rows of the derived table exceed the max join rows, they are not kept.
+	{
+		txn, err := scatter.CreateTransaction()
+		assert.Nil(t, err)
+		defer txn.Finish()
+		txn.SetMaxJoinRows(1)
+		planEngine := BuildEngine(log, plan.Root, txn)
+		ctx := xcontext.NewResultContext()
+		err = planEngine.Execute(ctx)
+		assert.Equal(t, "unsupported: derived.row.count.exceeded.allowed.limit.of.'1'", err.Error())
+	}
+
+	txn, err := scatter.CreateTransaction()
+	assert.Nil(t, err)
+	defer txn.Finish()
+	txn.SetMaxJoinRows(32768)
+	planEngine := BuildEngine(log, plan.Root, txn)
+	ctx := xcontext.NewResultContext()
+	err = planEngine.Execute(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "[[1 2]]", fmt.Sprintf("%v", ctx.Results.Rows))
+}
+
+func TestDerivedRecursive(t *testing.T) {
+	fields := []*querypb.Field{
+		{
+			Name: "id",
+			Type: querypb.Type_INT32,
+		},
+		{
+			Name: "p",
+			Type: querypb.Type_INT32,
+		},
+		{
+			Name: "lvl",
+			Type: querypb.Type_INT64,
+		},
+	}
+	row := func(vals ...string) []sqltypes.Value {
+		var r []sqltypes.Value
+		for i, v := range vals {
+			if v == "" {
+				r = append(r, sqltypes.NULL)
+				continue
+			}
+			r = append(r, sqltypes.MakeTrusted(fields[i].Type, []byte(v)))
+		}
+		return r
+	}
+	anchor := &sqltypes.Result{Fields: fields, Rows: [][]sqltypes.Value{row("1", "", "1")}}
+	level2 := &sqltypes.Result{Fields: fields, Rows: [][]sqltypes.Value{row("2", "1", "2"), row("3", "1", "2")}}
+	level3 := &sqltypes.Result{Fields: fields, Rows: [][]sqltypes.Value{row("4", "2", "3")}}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.CreateDatabase(database)
+	assert.Nil(t, err)
+	err = route.AddForTest(database, router.MockTableGConfig())
+	assert.Nil(t, err)
+
+	// Create scatter and query handler.
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+	fakedbs.AddQuery("select id as id, p as p, 1 as lvl from sbtest.G where p is null", anchor)
+	fakedbs.AddQuery("select G.id, G.p, r.lvl + 1 from sbtest.G join (select 1 as id, null as p, 1 as lvl) as r on G.p = r.id", level2)
+	fakedbs.AddQuery("select G.id, G.p, r.lvl + 1 from sbtest.G join (select 2 as id, 1 as p, 2 as lvl union all select 3, 1, 2) as r on G.p = r.id", level3)
+	fakedbs.AddQuery("select G.id, G.p, r.lvl + 1 from sbtest.G join (select 4 as id, 2 as p, 3 as lvl) as r on G.p = r.id", &sqltypes.Result{Fields: fields})
+	fakedbs.AddQuery("select * from (select 1 as id, null as p, 1 as lvl union all select 2, 1, 2 union all select 3, 1, 2 union all select 4, 2, 3) as r where lvl > 2", level3)
+
+	query := "with recursive r(id, p, lvl) as (select id, p, 1 from G where p is null union all select G.id, G.p, r.lvl+1 from G join r on G.p=r.id) select * from r where lvl > 2"
+	node, err := sqlparser.Parse(query)
+	assert.Nil(t, err)
+
+	plan := planner.NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+	err = plan.Build()
+	assert.Nil(t, err)
+
+	// The rows of the iterations exceed the max join rows, they are not kept.
+	{
+		txn, err := scatter.CreateTransaction()
+		assert.Nil(t, err)
+		defer txn.Finish()
+		txn.SetMaxJoinRows(3)
+		planEngine := BuildEngine(log, plan.Root, txn)
+		ctx := xcontext.NewResultContext()
+		err = planEngine.Execute(ctx)
+		assert.Equal(t, "unsupported: derived.row.count.exceeded.allowed.limit.of.'3'", err.Error())
+	}
+
+	txn, err := scatter.CreateTransaction()
+	assert.Nil(t, err)
+	defer txn.Finish()
+	txn.SetMaxJoinRows(32768)
+	planEngine := BuildEngine(log, plan.Root, txn)
+	ctx := xcontext.NewResultContext()
+	err = planEngine.Execute(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "[[4 2 3]]", fmt.Sprintf("%v", ctx.Results.Rows))
+}
+
+func TestDerivedDistinctKey(t *testing.T) {
+	str := func(v string) sqltypes.Value {
+		return sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(v))
+	}
+	rows := [][]sqltypes.Value{
+		{sqltypes.NULL, str("a")},
+		{str(""), str("a")},
+		{str("a\x00"), str("")},
+		{str("a"), str("\x00")},
+		{str("a"), str("")},
+		{str(""), str("a")},
+	}
+	keys := make(map[string]int)
+	for i, row := range rows {
+		if _, ok := keys[distinctKey(row)]; !ok {
+			keys[distinctKey(row)] = i
+		}
+	}
+	assert.Equal(t, 5, len(keys))
+	assert.Equal(t, 1, keys[distinctKey(rows[5])])
+}
@@ -10,7 +10,6 @@ package engine
 
 import (
 	"backend"
-	"executor/engine/operator"
 	"planner/builder"
 	"xcontext"
 
@@ -42,20 +41,34 @@ func NewJoinEngine(log *xlog.Log, node *builder.JoinNode, txn backend.Transactio
 	}
 }
 
+// joinStrategies are the names of the join strategies in the trace.
+var joinStrategies = map[builder.JoinStrategy]string{
+	builder.Cartesian: "cartesian",
+	builder.SortMerge: "sort-merge",
+	builder.NestLoop:  "nest-loop",
+}
+
 // Execute used to execute the executor.
 func (j *JoinEngine) Execute(ctx *xcontext.ResultContext) error {
 	var eg errgroup.Group
 	var err error
 
+	span := ctx.Span.StartChild("engine.join")
+	span.SetAttr("strategy", joinStrategies[j.node.Strategy])
+	defer span.Finish()
+
 	maxrow := j.txn.MaxJoinRows()
 	if j.node.Strategy == builder.NestLoop {
 		joinVars := make(map[string]*querypb.BindVariable)
-		if err := j.execBindVars(ctx, joinVars, true); err != nil {
+		nctx := &xcontext.ResultContext{Span: span}
+		if err := j.execBindVars(nctx, joinVars, true); err != nil {
 			return err
 		}
+		ctx.Results = nctx.Results
 	} else {
 		lctx := xcontext.NewResultContext()
 		rctx := xcontext.NewResultContext()
+		lctx.Span, rctx.Span = span, span
 
 		eg.Go(func() error {
 			return j.left.Execute(lctx)
@@ -89,7 +102,7 @@ func (j *JoinEngine) Execute(ctx *xcontext.ResultContext) error {
 		}
 	}
 
-	return operator.ExecSubPlan(j.log, j.node, ctx)
+	return execSubPlan(j.log, j.node, j.txn, ctx, span)
 }
 
 // execBindVars used to execute querys with bindvars.
@@ -97,6 +110,7 @@ func (j *JoinEngine) execBindVars(ctx *xcontext.ResultContext, bindVars map[stri
 	var err error
 	lctx := xcontext.NewResultContext()
 	rctx := xcontext.NewResultContext()
+	lctx.Span, rctx.Span = ctx.Span, ctx.Span
 	maxrow := j.txn.MaxJoinRows()
 	ctx.Results = &sqltypes.Result{}
 
@@ -168,6 +182,7 @@ func (j *JoinEngine) getFields(ctx *xcontext.ResultContext, bindVars map[string]
 	var err error
 	lctx := xcontext.NewResultContext()
 	rctx := xcontext.NewResultContext()
+	lctx.Span, rctx.Span = ctx.Span, ctx.Span
 
 	joinVars := make(map[string]*querypb.BindVariable)
 	if err = j.left.getFields(lctx, bindVars); err != nil {
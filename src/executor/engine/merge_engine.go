@@ -10,7 +10,6 @@ package engine
 
 import (
 	"backend"
-	"executor/engine/operator"
 	"planner/builder"
 	"xcontext"
 
@@ -41,56 +40,80 @@ func NewMergeEngine(log *xlog.Log, node *builder.MergeNode, txn backend.Transact
 
 // Execute used to execute the executor.
 func (m *MergeEngine) Execute(ctx *xcontext.ResultContext) error {
-	var err error
+	span := ctx.Span.StartChild("engine.merge")
+	defer span.Finish()
+
+	extras, err := materializeDerived(m.log, m.node, m.txn, span)
+	if err != nil {
+		span.SetError(err)
+		return err
+	}
 
 	reqCtx := xcontext.NewRequestContext()
+	reqCtx.Span = span
 	reqCtx.Mode = m.node.ReqMode
 	reqCtx.TxnMode = xcontext.TxnRead
-	if reqCtx.Mode == xcontext.ReqNormal {
+	switch {
+	case reqCtx.Mode == xcontext.ReqNormal:
+		if extras != nil {
+			if err = m.generateQuerys(nil, extras); err != nil {
+				return err
+			}
+		}
 		reqCtx.Querys = m.node.Querys
-	} else {
+	case extras != nil:
+		if reqCtx.RawQuery, err = m.node.ParsedQuerys[0].GenerateQuery(nil, extras); err != nil {
+			return err
+		}
+	default:
 		buf := sqlparser.NewTrackedBuffer(nil)
 		m.node.Sel.Format(buf)
 		reqCtx.RawQuery = buf.String()
 	}
 
 	if ctx.Results, err = m.txn.Execute(reqCtx); err != nil {
+		span.SetError(err)
 		return err
 	}
-	return operator.ExecSubPlan(m.log, m.node, ctx)
+	return execSubPlan(m.log, m.node, m.txn, ctx, span)
 }
 
 // execBindVars used to execute querys with bindvas.
 func (m *MergeEngine) execBindVars(ctx *xcontext.ResultContext, bindVars map[string]*querypb.BindVariable, wantfields bool) error {
-	var query string
-	var err error
+	span := ctx.Span.StartChild("engine.merge")
+	defer span.Finish()
 
-	querys := m.node.Querys
-	for i, p := range m.node.ParsedQuerys {
-		query, err = p.GenerateQuery(bindVars, nil)
-		if err != nil {
-			return err
-		}
-		querys[i].Query = query
+	extras, err := materializeDerived(m.log, m.node, m.txn, span)
+	if err != nil {
+		span.SetError(err)
+		return err
+	}
+	if err = m.generateQuerys(bindVars, extras); err != nil {
+		return err
 	}
 
 	reqCtx := xcontext.NewRequestContext()
 	reqCtx.Mode = xcontext.ReqNormal
 	reqCtx.TxnMode = xcontext.TxnRead
-	reqCtx.Querys = querys
+	reqCtx.Querys = m.node.Querys
+	reqCtx.Span = span
 
 	if ctx.Results, err = m.txn.Execute(reqCtx); err != nil {
+		span.SetError(err)
 		return err
 	}
-	return operator.ExecSubPlan(m.log, m.node, ctx)
+	return execSubPlan(m.log, m.node, m.txn, ctx, span)
 }
 
 // getFields fetches the field info.
 func (m *MergeEngine) getFields(ctx *xcontext.ResultContext, bindVars map[string]*querypb.BindVariable) error {
-	var err error
+	extras, err := materializeDerived(m.log, m.node, m.txn, ctx.Span)
+	if err != nil {
+		return err
+	}
 
 	query := m.node.Querys[len(m.node.Querys)-1]
-	query.Query, err = m.node.GenerateFieldQuery().GenerateQuery(bindVars, nil)
+	query.Query, err = m.node.GenerateFieldQuery().GenerateQuery(bindVars, extras)
 	if err != nil {
 		return err
 	}
@@ -99,9 +122,22 @@ func (m *MergeEngine) getFields(ctx *xcontext.ResultContext, bindVars map[string
 	reqCtx.Mode = xcontext.ReqNormal
 	reqCtx.TxnMode = xcontext.TxnRead
 	reqCtx.Querys = []xcontext.QueryTuple{query}
+	reqCtx.Span = ctx.Span
 
 	if ctx.Results, err = m.txn.Execute(reqCtx); err != nil {
 		return err
 	}
 	return nil
 }
+
+// generateQuerys used to generate the querys with the bindvars and the rows of the derived tables.
+func (m *MergeEngine) generateQuerys(bindVars map[string]*querypb.BindVariable, extras map[string]sqlparser.Encodable) error {
+	for i, p := range m.node.ParsedQuerys {
+		query, err := p.GenerateQuery(bindVars, extras)
+		if err != nil {
+			return err
+		}
+		m.node.Querys[i].Query = query
+	}
+	return nil
+}
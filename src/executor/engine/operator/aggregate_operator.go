@@ -23,7 +23,7 @@ var (
 )
 
 // AggregateOperator represents aggregate operator.
-// Including: COUNT/MAX/MIN/SUM/AVG/GROUPBY.
+// Including: COUNT/MAX/MIN/SUM/AVG/GROUP_CONCAT/STDDEV/VARIANCE/BIT_AND/BIT_OR/BIT_XOR/GROUPBY.
 type AggregateOperator struct {
 	log  *xlog.Log
 	plan builder.ChildPlan
@@ -40,7 +40,7 @@ func NewAggregateOperator(log *xlog.Log, plan builder.ChildPlan) *AggregateOpera
 // Execute used to execute the operator.
 func (operator *AggregateOperator) Execute(ctx *xcontext.ResultContext) error {
 	rs := ctx.Results
-	operator.aggregate(rs)
+	operator.aggregate(rs, ctx.GroupConcatMaxLen)
 	return nil
 }
 
@@ -50,7 +50,8 @@ func (operator *AggregateOperator) Execute(ctx *xcontext.ResultContext) error {
 // eg: select a,b from tb group by b.        ×
 //     select count(a),b from tb group by b. √
 //     select b from tb group by b.          √
-func (operator *AggregateOperator) aggregate(result *sqltypes.Result) {
+// The group_concat result is truncated to the maxLen.
+func (operator *AggregateOperator) aggregate(result *sqltypes.Result, maxLen int) {
 	var deIdxs []int
 	plan := operator.plan.(*builder.AggregatePlan)
 	if plan.Empty() {
@@ -81,6 +82,12 @@ func (operator *AggregateOperator) aggregate(result *sqltypes.Result) {
 	var aggrs []*sqltypes.Aggregation
 	for _, aggPlan := range aggPlans {
 		aggr := sqltypes.NewAggregation(aggPlan.Index, aggPlan.Type, aggPlan.Distinct, plan.IsPushDown)
+		switch {
+		case aggPlan.Type == sqltypes.AggrTypeGroupConcat:
+			aggr.SetConcat(aggPlan.Separator, maxLen, aggPlan.Orders)
+		case aggPlan.Type.IsApprox():
+			aggr.SetSketch(aggPlan.Keys, aggPlan.Percentile)
+		}
 		aggr.FixField(result.Fields[aggPlan.Index])
 		aggrs = append(aggrs, aggr)
 	}
@@ -120,7 +127,13 @@ func (operator *AggregateOperator) aggregate(result *sqltypes.Result) {
 		evalCtxs := sqltypes.NewAggEvalCtxs(aggrs, nil)
 		result.Rows[0], deIdxs = sqltypes.GetResults(aggrs, evalCtxs, make([]sqltypes.Value, len(result.Fields)))
 	}
-	// Remove avg decompose columns.
+	// Remove the decomposed columns of avg/stddev/variance, the order by keys of group_concat
+	// and the hidden group by keys.
+	for _, key := range groupAggrs {
+		if key.Hidden {
+			deIdxs = append(deIdxs, key.Index)
+		}
+	}
 	result.RemoveColumns(deIdxs...)
 }
 
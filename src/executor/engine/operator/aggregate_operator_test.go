@@ -14,6 +14,7 @@ import (
 
 	"backend"
 	"planner"
+	"planner/builder"
 	"router"
 	"xcontext"
 
@@ -379,3 +380,134 @@ func TestAggregateGroup(t *testing.T) {
 		}
 	}
 }
+
+func TestAggregateDecomposeOperator(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.CreateDatabase(database)
+	assert.Nil(t, err)
+	err = route.AddForTest(database, router.MockTableAConfig())
+	assert.Nil(t, err)
+
+	row := func(vals ...string) []sqltypes.Value {
+		var r []sqltypes.Value
+		for _, v := range vals {
+			r = append(r, sqltypes.MakeTrusted(querypb.Type_INT64, []byte(v)))
+		}
+		return r
+	}
+	tcases := []struct {
+		query  string
+		typ    querypb.Type
+		maxLen int
+		rows   [][]sqltypes.Value
+		want   string
+	}{
+		// Needs all the rows, the order by key is the hidden column.
+		{
+			query:  "select group_concat(distinct score order by score desc separator '-') from A",
+			maxLen: 1024,
+			rows:   [][]sqltypes.Value{row("3", "3"), row("7", "7"), row("3", "3"), row("5", "5")},
+			want:   "[[7-5-3]]",
+		},
+		// Truncated by the max length.
+		{
+			query:  "select group_concat(distinct score order by score desc separator '-') from A",
+			maxLen: 3,
+			rows:   [][]sqltypes.Value{row("3", "3"), row("7", "7"), row("3", "3"), row("5", "5")},
+			want:   "[[7-5]]",
+		},
+		// Pushed down, merged by the partial results.
+		{
+			query: "select group_concat(score) from A",
+			typ:   querypb.Type_VARCHAR,
+			rows: [][]sqltypes.Value{
+				{sqltypes.NewVarChar("3,7")},
+				{sqltypes.MakeTrusted(sqltypes.Null, nil)},
+				{sqltypes.NewVarChar("5")},
+			},
+			want: "[[3,7,5]]",
+		},
+		{
+			query: "select bit_or(score), bit_and(score), bit_xor(score) from A",
+			rows:  [][]sqltypes.Value{row("3", "3", "3"), row("5", "1", "5")},
+			want:  "[[7 1 6]]",
+		},
+		// Pushed down, count(x), sum(x) and sum(x*x) of the shards are {2, 3, 5} and {2, 7, 25}.
+		{
+			query: "select var_pop(score), stddev_samp(score) from A",
+			typ:   sqltypes.Decimal,
+			rows:  [][]sqltypes.Value{row("2", "3", "5", "2", "3", "5"), row("2", "7", "25", "2", "7", "25")},
+			want:  "[[1.25 1.2909944487358056]]",
+		},
+		// Needs all the rows.
+		{
+			query: "select var_pop(score), count(distinct score), bit_and(score) from A",
+			rows:  [][]sqltypes.Value{row("1", "1", "1"), row("2", "2", "2"), row("3", "3", "3"), row("4", "4", "4"), row("4", "4", "4")},
+			want:  "[[1.36 4 0]]",
+		},
+		// Pushed down, the rank grouped by the register of the shards.
+		{
+			query: "select approx_count_distinct(score) from A",
+			rows:  [][]sqltypes.Value{row("1", "0"), row("3", "0"), row("2", "5")},
+			want:  "[[2]]",
+		},
+		// Pushed down, the count grouped by the sign and the bucket index of the shards.
+		{
+			query: "select approx_percentile(score, 0.9) from A",
+			rows:  [][]sqltypes.Value{row("3", "1", "10"), row("1", "0", "0"), row("2", "-1", "5")},
+			want:  "[[1.2091967923473546]]",
+		},
+		// Needs all the rows.
+		{
+			query: "select approx_count_distinct(score), approx_percentile(score, 0.5), count(distinct score) from A",
+			rows:  [][]sqltypes.Value{row("1", "1", "1"), row("2", "2", "2"), row("3", "3", "3"), row("2", "2", "2")},
+			want:  "[[3 1.993661701417341 3]]",
+		},
+		// Grouped by the hidden key.
+		{
+			query: "select count(*) from A group by score % 2",
+			rows:  [][]sqltypes.Value{row("2", "1"), row("4", "0"), row("1", "1")},
+			want:  "[[4] [3]]",
+		},
+		// No rows.
+		{
+			query: "select var_samp(score), bit_and(score), group_concat(score order by id) from A",
+			want:  "[[ 18446744073709551615 ]]",
+		},
+		{
+			query: "select approx_count_distinct(score), approx_percentile(score, 0.5) from A",
+			want:  "[[0 ]]",
+		},
+	}
+
+	for _, tcase := range tcases {
+		node, err := sqlparser.Parse(tcase.query)
+		assert.Nil(t, err)
+
+		plan := planner.NewSelectPlan(log, database, tcase.query, node.(*sqlparser.Select), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		log.Debug("plan:%+v", plan.JSON())
+
+		ctx := xcontext.NewResultContext()
+		ctx.GroupConcatMaxLen = tcase.maxLen
+		ctx.Results = &sqltypes.Result{Rows: tcase.rows}
+		typ := tcase.typ
+		if typ == 0 {
+			typ = querypb.Type_INT64
+		}
+		cols := len(plan.Root.(*builder.MergeNode).Sel.(*sqlparser.Select).SelectExprs)
+		for i := 0; i < cols; i++ {
+			ctx.Results.Fields = append(ctx.Results.Fields, &querypb.Field{Name: fmt.Sprintf("c%d", i), Type: typ})
+		}
+		err = ExecSubPlan(log, plan.Root, ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, tcase.want, fmt.Sprintf("%v", ctx.Results.Rows), tcase.query)
+		assert.Equal(t, len(ctx.Results.Rows[0]), len(ctx.Results.Fields))
+	}
+}
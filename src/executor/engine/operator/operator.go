@@ -21,26 +21,35 @@ type Operator interface {
 }
 
 // ExecSubPlan used to execute all the children plan.
+// Every operator is a span under the ctx.Span with the rows after it.
 func ExecSubPlan(log *xlog.Log, node builder.PlanNode, ctx *xcontext.ResultContext) error {
 	subPlanTree := node.Children()
 	if subPlanTree != nil {
 		for _, subPlan := range subPlanTree {
+			var name string
+			var operator Operator
 			switch subPlan.Type() {
 			case builder.ChildTypeAggregate:
-				aggrOperator := NewAggregateOperator(log, subPlan)
-				if err := aggrOperator.Execute(ctx); err != nil {
-					return err
-				}
+				name, operator = "operator.aggregate", NewAggregateOperator(log, subPlan)
+			case builder.ChildTypeWindow:
+				name, operator = "operator.window", NewWindowOperator(log, subPlan)
 			case builder.ChildTypeOrderby:
-				orderByOperator := NewOrderByOperator(log, subPlan)
-				if err := orderByOperator.Execute(ctx); err != nil {
-					return err
-				}
+				name, operator = "operator.orderby", NewOrderByOperator(log, subPlan)
 			case builder.ChildTypeLimit:
-				limitOperator := NewLimitOperator(log, subPlan)
-				if err := limitOperator.Execute(ctx); err != nil {
-					return err
-				}
+				name, operator = "operator.limit", NewLimitOperator(log, subPlan)
+			default:
+				continue
+			}
+
+			span := ctx.Span.StartChild(name)
+			err := operator.Execute(ctx)
+			if err == nil && ctx.Results != nil {
+				span.SetAttr("rows", len(ctx.Results.Rows))
+			}
+			span.SetError(err)
+			span.Finish()
+			if err != nil {
+				return err
 			}
 		}
 	}
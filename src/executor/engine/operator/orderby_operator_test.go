@@ -115,6 +115,48 @@ func TestOrderByOperator(t *testing.T) {
 	}
 }
 
+func TestOrderByOperatorExpr(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.CreateDatabase(database)
+	assert.Nil(t, err)
+	err = route.AddForTest(database, router.MockTableAConfig())
+	assert.Nil(t, err)
+
+	query := "select id, name from A order by id % 3 desc, id"
+	node, err := sqlparser.Parse(query)
+	assert.Nil(t, err)
+	plan := planner.NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+	err = plan.Build()
+	assert.Nil(t, err)
+
+	// The hidden column `id % 3 as tmpo_0`.
+	row := func(id, name, mod string) []sqltypes.Value {
+		return []sqltypes.Value{
+			sqltypes.MakeTrusted(querypb.Type_INT32, []byte(id)),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(name)),
+			sqltypes.MakeTrusted(querypb.Type_INT64, []byte(mod)),
+		}
+	}
+	ctx := xcontext.NewResultContext()
+	ctx.Results = &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "id", Type: querypb.Type_INT32},
+			{Name: "name", Type: querypb.Type_VARCHAR},
+			{Name: "tmpo_0", Type: querypb.Type_INT64},
+		},
+		Rows: [][]sqltypes.Value{row("3", "z", "0"), row("4", "x", "1"), row("5", "g", "2"), row("1", "go", "1")},
+	}
+	err = ExecSubPlan(log, plan.Root, ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "[[5 g] [1 go] [4 x] [3 z]]", fmt.Sprintf("%v", ctx.Results.Rows))
+	assert.Equal(t, 2, len(ctx.Results.Fields))
+}
+
 func TestOrderByError(t *testing.T) {
 	r1 := &sqltypes.Result{
 		Fields: []*querypb.Field{
@@ -0,0 +1,171 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package operator
+
+import (
+	"sort"
+
+	"planner/builder"
+	"xcontext"
+
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+var (
+	_ Operator = &WindowOperator{}
+)
+
+// WindowOperator represents window operator.
+// Including: ROW_NUMBER/RANK/DENSE_RANK/LAG/LEAD/SUM/COUNT/AVG/MIN/MAX OVER.
+type WindowOperator struct {
+	log  *xlog.Log
+	plan builder.ChildPlan
+}
+
+// NewWindowOperator creates new WindowOperator.
+func NewWindowOperator(log *xlog.Log, plan builder.ChildPlan) *WindowOperator {
+	return &WindowOperator{
+		log:  log,
+		plan: plan,
+	}
+}
+
+// Execute used to execute the operator.
+func (operator *WindowOperator) Execute(ctx *xcontext.ResultContext) error {
+	rs := ctx.Results
+	operator.window(rs)
+	return nil
+}
+
+// window used to evaluate the window functions, for every window the rows are sorted
+// by the partition by and order by keys, then the window function is evaluated per partition.
+// The result of the window function is written to the column of its argument, so the results
+// of the partition are buffered until the whole partition is evaluated.
+func (operator *WindowOperator) window(result *sqltypes.Result) {
+	plan := operator.plan.(*builder.WindowPlan)
+	for _, win := range plan.Windows {
+		var aggr *sqltypes.Aggregation
+		field := result.Fields[win.Index]
+		switch win.Type {
+		case builder.WindowTypeRowNumber, builder.WindowTypeRank, builder.WindowTypeDenseRank:
+			field.Type = querypb.Type_UINT64
+			field.ColumnLength = 21
+			field.Decimals = 0
+		case builder.WindowTypeAggregate:
+			aggr = sqltypes.NewAggregation(win.Index, win.Aggregate, false, false)
+			aggr.FixField(field)
+		}
+
+		sort.SliceStable(result.Rows, func(i, j int) bool {
+			if cmp := comparePartition(result.Rows[i], result.Rows[j], win); cmp != 0 {
+				return cmp < 0
+			}
+			return compareOrder(result.Rows[i], result.Rows[j], win) < 0
+		})
+
+		for start := 0; start < len(result.Rows); {
+			end := start + 1
+			for end < len(result.Rows) && comparePartition(result.Rows[start], result.Rows[end], win) == 0 {
+				end++
+			}
+			rows := result.Rows[start:end]
+			values := evalWindow(rows, win, aggr)
+			for i, row := range rows {
+				row[win.Index] = values[i]
+			}
+			start = end
+		}
+	}
+	// Remove the hidden partition by, order by and default columns.
+	result.RemoveColumns(plan.RemovedIdxs...)
+}
+
+// evalWindow returns the window function values of the partition rows.
+func evalWindow(rows [][]sqltypes.Value, win builder.WindowFunc, aggr *sqltypes.Aggregation) []sqltypes.Value {
+	values := make([]sqltypes.Value, len(rows))
+	switch win.Type {
+	case builder.WindowTypeRowNumber:
+		for i := range rows {
+			values[i] = sqltypes.NewUint64(uint64(i + 1))
+		}
+	case builder.WindowTypeRank, builder.WindowTypeDenseRank:
+		var rank, dense uint64
+		for i := range rows {
+			if i == 0 || compareOrder(rows[i-1], rows[i], win) != 0 {
+				rank = uint64(i + 1)
+				dense++
+			}
+			values[i] = sqltypes.NewUint64(rank)
+			if win.Type == builder.WindowTypeDenseRank {
+				values[i] = sqltypes.NewUint64(dense)
+			}
+		}
+	case builder.WindowTypeLag, builder.WindowTypeLead:
+		for i, row := range rows {
+			j := i - win.Offset
+			if win.Type == builder.WindowTypeLead {
+				j = i + win.Offset
+			}
+			switch {
+			case j >= 0 && j < len(rows):
+				values[i] = rows[j][win.Index]
+			case win.Default >= 0:
+				values[i] = row[win.Default]
+			default:
+				values[i] = sqltypes.MakeTrusted(sqltypes.Null, nil)
+			}
+		}
+	case builder.WindowTypeAggregate:
+		// Without order by the frame is the whole partition, otherwise it is
+		// from the start of the partition to the last peer of the current row.
+		evalCtx := aggr.InitEvalCtx(nil)
+		for start := 0; start < len(rows); {
+			end := start + 1
+			for end < len(rows) && (len(win.Orders) == 0 || compareOrder(rows[start], rows[end], win) == 0) {
+				end++
+			}
+			for _, row := range rows[start:end] {
+				aggr.Update(row, evalCtx)
+			}
+			val := aggr.GetResult(evalCtx)
+			for i := start; i < end; i++ {
+				values[i] = val
+			}
+			start = end
+		}
+	}
+	return values
+}
+
+// comparePartition compares the partition by keys of the rows.
+func comparePartition(row1, row2 []sqltypes.Value, win builder.WindowFunc) int {
+	for _, idx := range win.Partitions {
+		if cmp := sqltypes.NullsafeCompare(row1[idx], row2[idx]); cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+// compareOrder compares the order by keys of the rows.
+func compareOrder(row1, row2 []sqltypes.Value, win builder.WindowFunc) int {
+	for _, order := range win.Orders {
+		cmp := sqltypes.NullsafeCompare(row1[order.Index], row2[order.Index])
+		if cmp == 0 {
+			continue
+		}
+		if order.Desc {
+			cmp = -cmp
+		}
+		return cmp
+	}
+	return 0
+}
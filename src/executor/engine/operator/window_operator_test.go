@@ -0,0 +1,127 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package operator
+
+import (
+	"fmt"
+	"testing"
+
+	"planner"
+	"router"
+	"xcontext"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestWindowOperator(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.CreateDatabase(database)
+	assert.Nil(t, err)
+	err = route.AddForTest(database, router.MockTableAConfig())
+	assert.Nil(t, err)
+
+	query := "select name, row_number() over (partition by age order by id) as rn, rank() over (order by age) as r, " +
+		"lag(id) over (partition by age order by id) as prev, sum(id) over (partition by age) as s from A order by name"
+	node, err := sqlparser.Parse(query)
+	assert.Nil(t, err)
+	plan := planner.NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+	err = plan.Build()
+	assert.Nil(t, err)
+
+	// The shards return `name, null as rn, null as r, id as prev, id as s, age as tmpw_0, id as tmpw_1`.
+	row := func(name, id, age string) []sqltypes.Value {
+		return []sqltypes.Value{
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(name)),
+			sqltypes.MakeTrusted(sqltypes.Null, nil),
+			sqltypes.MakeTrusted(sqltypes.Null, nil),
+			sqltypes.MakeTrusted(querypb.Type_INT32, []byte(id)),
+			sqltypes.MakeTrusted(querypb.Type_INT32, []byte(id)),
+			sqltypes.MakeTrusted(querypb.Type_INT32, []byte(age)),
+			sqltypes.MakeTrusted(querypb.Type_INT32, []byte(id)),
+		}
+	}
+	ctx := xcontext.NewResultContext()
+	ctx.Results = &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "name", Type: querypb.Type_VARCHAR},
+			{Name: "rn", Type: querypb.Type_NULL_TYPE},
+			{Name: "r", Type: querypb.Type_NULL_TYPE},
+			{Name: "prev", Type: querypb.Type_INT32},
+			{Name: "s", Type: querypb.Type_INT32},
+			{Name: "tmpw_0", Type: querypb.Type_INT32},
+			{Name: "tmpw_1", Type: querypb.Type_INT32},
+		},
+		Rows: [][]sqltypes.Value{row("d", "4", "10"), row("b", "2", "20"), row("a", "1", "10"), row("e", "5", "20"), row("c", "3", "10")},
+	}
+	err = ExecSubPlan(log, plan.Root, ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "[[a 1 1  8] [b 1 4  7] [c 2 1 1 8] [d 3 1 3 8] [e 2 4 2 7]]", fmt.Sprintf("%v", ctx.Results.Rows))
+	assert.Equal(t, 5, len(ctx.Results.Fields))
+	assert.Equal(t, querypb.Type_UINT64, ctx.Results.Fields[1].Type)
+	assert.Equal(t, querypb.Type_DECIMAL, ctx.Results.Fields[4].Type)
+}
+
+func TestWindowOperatorPeers(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.CreateDatabase(database)
+	assert.Nil(t, err)
+	err = route.AddForTest(database, router.MockTableAConfig())
+	assert.Nil(t, err)
+
+	query := "select id, dense_rank() over (order by age desc), count(*) over (order by age desc), lead(id, 1, -1) over (order by id) from A"
+	node, err := sqlparser.Parse(query)
+	assert.Nil(t, err)
+	plan := planner.NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+	err = plan.Build()
+	assert.Nil(t, err)
+
+	// The shards return `id, null, 1, id, age as tmpw_0, -1 as tmpw_1, id as tmpw_2`.
+	row := func(id, age string) []sqltypes.Value {
+		return []sqltypes.Value{
+			sqltypes.MakeTrusted(querypb.Type_INT32, []byte(id)),
+			sqltypes.MakeTrusted(sqltypes.Null, nil),
+			sqltypes.MakeTrusted(querypb.Type_INT64, []byte("1")),
+			sqltypes.MakeTrusted(querypb.Type_INT32, []byte(id)),
+			sqltypes.MakeTrusted(querypb.Type_INT32, []byte(age)),
+			sqltypes.MakeTrusted(querypb.Type_INT64, []byte("-1")),
+			sqltypes.MakeTrusted(querypb.Type_INT32, []byte(id)),
+		}
+	}
+	ctx := xcontext.NewResultContext()
+	ctx.Results = &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "id", Type: querypb.Type_INT32},
+			{Name: "dense_rank", Type: querypb.Type_NULL_TYPE},
+			{Name: "count", Type: querypb.Type_INT64},
+			{Name: "lead", Type: querypb.Type_INT32},
+			{Name: "tmpw_0", Type: querypb.Type_INT32},
+			{Name: "tmpw_1", Type: querypb.Type_INT64},
+			{Name: "tmpw_2", Type: querypb.Type_INT32},
+		},
+		Rows: [][]sqltypes.Value{row("1", "10"), row("2", "30"), row("3", "10"), row("4", "20")},
+	}
+	err = ExecSubPlan(log, plan.Root, ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "[[1 3 4 2] [2 1 1 3] [3 3 4 4] [4 2 2 -1]]", fmt.Sprintf("%v", ctx.Results.Rows))
+	assert.Equal(t, 4, len(ctx.Results.Fields))
+}
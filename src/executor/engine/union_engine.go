@@ -12,7 +12,6 @@ import (
 	"errors"
 
 	"backend"
-	"executor/engine/operator"
 	"planner/builder"
 	"xcontext"
 
@@ -48,8 +47,12 @@ func NewUnionEngine(log *xlog.Log, node *builder.UnionNode, txn backend.Transact
 func (u *UnionEngine) Execute(ctx *xcontext.ResultContext) error {
 	var eg errgroup.Group
 
+	span := ctx.Span.StartChild("engine.union")
+	defer span.Finish()
+
 	lctx := xcontext.NewResultContext()
 	rctx := xcontext.NewResultContext()
+	lctx.Span, rctx.Span = span, span
 
 	eg.Go(func() error {
 		return u.left.Execute(lctx)
@@ -89,7 +92,7 @@ func (u *UnionEngine) Execute(ctx *xcontext.ResultContext) error {
 		ctx.Results.Rows = lctx.Results.Rows
 		ctx.Results.RowsAffected = lctx.Results.RowsAffected
 	}
-	return operator.ExecSubPlan(u.log, u.node, ctx)
+	return execSubPlan(u.log, u.node, u.txn, ctx, span)
 }
 
 // execBindVars used to execute querys with bindvas.
@@ -9,9 +9,12 @@
 package executor
 
 import (
+	"strings"
+
 	"backend"
 	"planner"
 	"xcontext"
+	"xtrace"
 
 	"github.com/pkg/errors"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
@@ -29,6 +32,8 @@ type Tree struct {
 	children []Executor
 	txn      backend.Transaction
 	planTree *planner.PlanTree
+	names    []string
+	span     *xtrace.Span
 }
 
 // NewTree creates the new execute tree.
@@ -41,6 +46,11 @@ func NewTree(log *xlog.Log, planTree *planner.PlanTree, txn backend.Transaction)
 	}
 }
 
+// SetTrace sets the parent span of the executions, nil if not traced.
+func (et *Tree) SetTrace(span *xtrace.Span) {
+	et.span = span
+}
+
 // Add adds a executor to the tree
 func (et *Tree) Add(executor Executor) error {
 	et.children = append(et.children, executor)
@@ -51,6 +61,7 @@ func (et *Tree) Add(executor Executor) error {
 func (et *Tree) Execute() (*sqltypes.Result, error) {
 	// build tree
 	for _, plan := range et.planTree.Plans() {
+		et.names = append(et.names, "executor."+strings.ToLower(strings.TrimPrefix(string(plan.Type()), "PlanType")))
 		switch plan.Type() {
 		case planner.PlanTypeDDL:
 			executor := NewDDLExecutor(et.log, plan, et.txn)
@@ -94,8 +105,13 @@ func (et *Tree) Execute() (*sqltypes.Result, error) {
 
 	// execute all
 	rsCtx := xcontext.NewResultContext()
-	for _, executor := range et.children {
-		if err := executor.Execute(rsCtx); err != nil {
+	for i, executor := range et.children {
+		span := et.span.StartChild(et.names[i])
+		rsCtx.Span = span
+		err := executor.Execute(rsCtx)
+		span.SetError(err)
+		span.Finish()
+		if err != nil {
 			return nil, err
 		}
 	}
@@ -44,6 +44,7 @@ func (executor *InsertExecutor) Execute(ctx *xcontext.ResultContext) error {
 	reqCtx.TxnMode = xcontext.TxnWrite
 	reqCtx.Querys = plan.Querys
 	reqCtx.RawQuery = plan.RawQuery
+	reqCtx.Span = ctx.Span
 
 	rs, err := executor.txn.Execute(reqCtx)
 	if err != nil {
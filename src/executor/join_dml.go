@@ -0,0 +1,58 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package executor
+
+import (
+	"backend"
+	"executor/engine"
+	"planner"
+	"xcontext"
+	"xtrace"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// executeJoinDML reads the target rows of the cross-shard multiple-table UPDATE/DELETE,
+// returns the primary key DML querys of the rows.
+// The rows are locked by the 'select ... for update' until they're written, so it must be in the XA transaction.
+func executeJoinDML(log *xlog.Log, join *planner.JoinDML, txn backend.Transaction, span *xtrace.Span) ([]xcontext.QueryTuple, error) {
+	if !txn.TwoPC() {
+		return nil, errors.Errorf("unsupported: cross-shard.dml.of.table.'%s'.without.twopc", join.Target())
+	}
+
+	// Fetch the primary key columns of the target table.
+	reqCtx := xcontext.NewRequestContext()
+	reqCtx.Mode = xcontext.ReqNormal
+	reqCtx.TxnMode = xcontext.TxnRead
+	reqCtx.Querys = []xcontext.QueryTuple{join.KeyQuery}
+	reqCtx.RawQuery = join.KeyQuery.Query
+	reqCtx.Span = span
+	qr, err := txn.Execute(reqCtx)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, row := range qr.Rows {
+		if row[1].String() == "PRI" {
+			keys = append(keys, row[0].String())
+		}
+	}
+	if err := join.Build(keys); err != nil {
+		return nil, err
+	}
+
+	// Read the target rows by the select plan.
+	ctx := xcontext.NewResultContext()
+	ctx.Span = span
+	if err := engine.BuildEngine(log, join.Root, txn).Execute(ctx); err != nil {
+		return nil, err
+	}
+	return join.Querys(ctx.Results)
+}
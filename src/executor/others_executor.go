@@ -44,6 +44,7 @@ func (executor *OthersExecutor) Execute(ctx *xcontext.ResultContext) error {
 	reqCtx.TxnMode = xcontext.TxnRead
 	reqCtx.Querys = plan.Querys
 	reqCtx.RawQuery = plan.RawQuery
+	reqCtx.Span = ctx.Span
 
 	rs, err := executor.txn.Execute(reqCtx)
 	if err != nil {
@@ -19,6 +19,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -66,3 +68,94 @@ func TestUpdateExecutor(t *testing.T) {
 		}
 	}
 }
+
+func TestUpdateExecutorCrossShard(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	// Create scatter and query handler.
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.CreateDatabase(database)
+	assert.Nil(t, err)
+	err = route.AddForTest(database, router.MockTableMConfig(), router.MockTableBConfig())
+	assert.Nil(t, err)
+
+	keys := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "column_name", Type: querypb.Type_VARCHAR},
+			{Name: "column_key", Type: querypb.Type_VARCHAR},
+		},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("id")), sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("PRI"))},
+			{sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("x")), sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(""))},
+		},
+	}
+	lefts := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "id", Type: querypb.Type_INT32},
+		},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1"))},
+		},
+	}
+	rights := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "y", Type: querypb.Type_VARCHAR},
+			{Name: "k", Type: querypb.Type_INT32},
+		},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("a")), sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1"))},
+		},
+	}
+
+	// Add querys.
+	fakedbs.AddQueryPattern("select column_name, column_key from information_schema.columns .*", keys)
+	fakedbs.AddQueryPattern("select A.id from sbtest.A.*", lefts)
+	fakedbs.AddQueryPattern("select B.y, B.k from sbtest.B.*", rights)
+	fakedbs.AddQuery("update sbtest.A6 set x = 'a' where id = 1", fakedb.Result3)
+
+	query := "update A join B on A.id = B.k set A.x = B.y where B.z = 1"
+	node, err := sqlparser.Parse(query)
+	assert.Nil(t, err)
+
+	plan := planner.NewUpdatePlan(log, database, query, node.(*sqlparser.Update), route)
+	err = plan.Build()
+	assert.Nil(t, err)
+
+	txn, err := scatter.CreateTransaction()
+	assert.Nil(t, err)
+	defer txn.Finish()
+	txn.SetMaxJoinRows(32768)
+	executor := NewUpdateExecutor(log, plan, txn)
+	// The twopc is required.
+	{
+		ctx := xcontext.NewResultContext()
+		err := executor.Execute(ctx)
+		assert.Equal(t, "unsupported: cross-shard.dml.of.table.'sbtest.A'.without.twopc", err.Error())
+	}
+
+	assert.Nil(t, txn.Begin())
+	{
+		ctx := xcontext.NewResultContext()
+		err := executor.Execute(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, fakedb.Result3.RowsAffected, ctx.Results.RowsAffected)
+	}
+
+	// No rows matched, no update is sent.
+	fakedbs.ResetAll()
+	fakedbs.AddQueryPattern("select column_name, column_key from information_schema.columns .*", keys)
+	fakedbs.AddQueryPattern("select A.id from sbtest.A.*", lefts)
+	fakedbs.AddQueryPattern("select B.y, B.k from sbtest.B.*", &sqltypes.Result{Fields: rights.Fields})
+	{
+		ctx := xcontext.NewResultContext()
+		err := executor.Execute(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(0), ctx.Results.RowsAffected)
+	}
+}
@@ -0,0 +1,246 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package metastore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"xbase"
+
+	"github.com/pkg/errors"
+)
+
+var _ Store = &FileStore{}
+
+// FileStore stores the metadata in the files of the dir,
+// the revision of the key is the modification time of the file in nanoseconds.
+type FileStore struct {
+	mu       sync.Mutex
+	dir      string
+	interval time.Duration
+}
+
+// NewFileStore creates the file store rooted at the dir.
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{
+		dir:      dir,
+		interval: time.Second,
+	}
+}
+
+// Dir returns the root dir of the store.
+func (s *FileStore) Dir() string {
+	return s.dir
+}
+
+func (s *FileStore) get(key string) (*KV, error) {
+	file := path.Join(s.dir, key)
+	info, err := os.Stat(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, errors.WithStack(err)
+	}
+	if info.IsDir() != IsDir(key) {
+		return nil, ErrNotFound
+	}
+
+	kv := &KV{Key: key, Revision: info.ModTime().UnixNano()}
+	if !info.IsDir() {
+		if kv.Value, err = ioutil.ReadFile(file); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return kv, nil
+}
+
+// current returns the key or nil if it does not exist.
+func (s *FileStore) current(key string) (*KV, error) {
+	kv, err := s.get(key)
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	return kv, err
+}
+
+// Get used to read the file of the key.
+func (s *FileStore) Get(key string) (*KV, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(key)
+}
+
+// Put used to write the file of the key or create the dir of the dir key.
+// The dir of the file must exist.
+func (s *FileStore) Put(key string, value []byte, revision int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.current(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := check(current, revision); err != nil {
+		return 0, err
+	}
+
+	return s.put(key, value, current)
+}
+
+// put writes the key on the current, it must be called with the lock held.
+func (s *FileStore) put(key string, value []byte, current *KV) (int64, error) {
+	file := path.Join(s.dir, key)
+	if IsDir(key) {
+		if current != nil {
+			return current.Revision, nil
+		}
+		if err := os.MkdirAll(file, os.ModePerm); err != nil {
+			return 0, errors.WithStack(err)
+		}
+	} else if current != nil && bytes.Equal(current.Value, value) {
+		return current.Revision, nil
+	} else if err := xbase.WriteFile(file, value); err != nil {
+		return 0, err
+	}
+
+	// The mtime resolution of some file systems is coarse, make the revision increase.
+	rev := time.Now().UnixNano()
+	if current != nil && rev <= current.Revision {
+		rev = current.Revision + 1
+	}
+	mtime := time.Unix(0, rev)
+	if err := os.Chtimes(file, mtime, mtime); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return rev, nil
+}
+
+// Delete used to remove the file of the key or the dir of the dir key.
+func (s *FileStore) Delete(key string, revision int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.current(key)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return ErrNotFound
+	}
+	if err := check(current, revision); err != nil {
+		return err
+	}
+	return errors.WithStack(os.RemoveAll(path.Join(s.dir, key)))
+}
+
+// Batch used to remove the files of the deletes and write the puts in the key order,
+// it's not atomic but nothing else changes the files in the middle.
+func (s *FileStore) Batch(puts map[string][]byte, deletes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range deletes {
+		if err := os.RemoveAll(path.Join(s.dir, key)); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	// The dir keys are put before the keys under them.
+	keys := make([]string, 0, len(puts))
+	for key := range puts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		current, err := s.current(key)
+		if err != nil {
+			return err
+		}
+		if _, err := s.put(key, puts[key], current); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List used to walk the dir and returns the files and dirs with the prefix.
+func (s *FileStore) List(prefix string) ([]*KV, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var kvs []*KV
+	info, err := os.Stat(s.dir)
+	switch {
+	case os.IsNotExist(err):
+		return kvs, nil
+	case err != nil:
+		return nil, errors.WithStack(err)
+	case !info.IsDir():
+		return nil, errors.Errorf("metastore.dir[%s].is.not.a.directory", s.dir)
+	}
+	root := path.Clean(s.dir)
+	if err := filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if file == root {
+			return nil
+		}
+
+		key := strings.TrimPrefix(strings.TrimPrefix(file, root), "/")
+		if info.IsDir() {
+			key += "/"
+		}
+		if !strings.HasPrefix(key, prefix) {
+			// Skip the dir which can not contain the prefix.
+			if info.IsDir() && !strings.HasPrefix(prefix, key) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		kv := &KV{Key: key, Revision: info.ModTime().UnixNano()}
+		if !info.IsDir() {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			kv.Value = data
+		}
+		kvs = append(kvs, kv)
+		return nil
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	return kvs, nil
+}
+
+// Watch used to poll the changes of the files with the prefix.
+func (s *FileStore) Watch(prefix string) (*Watcher, error) {
+	return newWatcher(s, prefix, s.interval)
+}
+
+// Shared returns false, the files are local to the node.
+func (s *FileStore) Shared() bool {
+	return false
+}
+
+// Close does nothing.
+func (s *FileStore) Close() error {
+	return nil
+}
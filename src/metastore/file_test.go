@@ -0,0 +1,175 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package metastore
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"fakedb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestFileStore(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	dir := fakedb.GetTmpDir("", "radon_metastore_", log)
+	defer os.RemoveAll(dir)
+	store := NewFileStore(dir)
+	defer store.Close()
+	assert.False(t, store.Shared())
+
+	// Put and get.
+	{
+		_, err := store.Get("db1/t1.json")
+		assert.Equal(t, ErrNotFound, err)
+
+		_, err = store.Put("db1/t1.json", []byte("t1"), RevisionAny)
+		assert.NotNil(t, err)
+
+		rev, err := store.Put("db1/", nil, RevisionNotExist)
+		assert.Nil(t, err)
+		assert.True(t, rev > 0)
+		rev1, err := store.Put("db1/t1.json", []byte("t1"), RevisionNotExist)
+		assert.Nil(t, err)
+
+		kv, err := store.Get("db1/t1.json")
+		assert.Nil(t, err)
+		assert.Equal(t, "t1", string(kv.Value))
+		assert.Equal(t, rev1, kv.Revision)
+
+		_, err = store.Get("db1/t1.json/")
+		assert.Equal(t, ErrNotFound, err)
+	}
+
+	// Compare and swap.
+	{
+		kv, err := store.Get("db1/t1.json")
+		assert.Nil(t, err)
+		_, err = store.Put("db1/t1.json", []byte("t1-new"), RevisionNotExist)
+		assert.Equal(t, ErrConflict, err)
+		_, err = store.Put("db1/t1.json", []byte("t1-new"), kv.Revision+1)
+		assert.Equal(t, ErrConflict, err)
+
+		rev, err := store.Put("db1/t1.json", []byte("t1-new"), kv.Revision)
+		assert.Nil(t, err)
+		assert.True(t, rev > kv.Revision)
+
+		// The same value keeps the revision.
+		same, err := store.Put("db1/t1.json", []byte("t1-new"), RevisionAny)
+		assert.Nil(t, err)
+		assert.Equal(t, rev, same)
+
+		err = store.Delete("db1/t1.json", kv.Revision)
+		assert.Equal(t, ErrConflict, err)
+	}
+
+	// List.
+	{
+		_, err := store.Put("db1/t2.json", []byte("t2"), RevisionAny)
+		assert.Nil(t, err)
+		_, err = store.Put("db2/", nil, RevisionAny)
+		assert.Nil(t, err)
+		_, err = store.Put("backend.json", []byte("{}"), RevisionAny)
+		assert.Nil(t, err)
+
+		kvs, err := store.List("")
+		assert.Nil(t, err)
+		var keys []string
+		for _, kv := range kvs {
+			keys = append(keys, kv.Key)
+		}
+		assert.Equal(t, []string{"backend.json", "db1/", "db1/t1.json", "db1/t2.json", "db2/"}, keys)
+
+		kvs, err = store.List("db1/")
+		assert.Nil(t, err)
+		assert.Equal(t, 3, len(kvs))
+		assert.Equal(t, "t2", string(kvs[2].Value))
+	}
+
+	// Delete the dir.
+	{
+		err := store.Delete("db1/", RevisionAny)
+		assert.Nil(t, err)
+		_, err = os.Stat(path.Join(dir, "db1"))
+		assert.True(t, os.IsNotExist(err))
+		err = store.Delete("db1/", RevisionAny)
+		assert.Equal(t, ErrNotFound, err)
+	}
+
+	// Batch.
+	{
+		_, err := store.Put("db3/", nil, RevisionAny)
+		assert.Nil(t, err)
+		puts := map[string][]byte{
+			"db1/":         nil,
+			"db1/t1.json":  []byte("t1"),
+			"backend.json": []byte("{}"),
+		}
+		err = store.Batch(puts, []string{"db3/", "db4/"})
+		assert.Nil(t, err)
+
+		kvs, err := store.List("")
+		assert.Nil(t, err)
+		var keys []string
+		for _, kv := range kvs {
+			keys = append(keys, kv.Key)
+		}
+		assert.Equal(t, []string{"backend.json", "db1/", "db1/t1.json", "db2/"}, keys)
+	}
+
+	// Version.
+	{
+		assert.Nil(t, UpdateVersion(store))
+		assert.True(t, ReadVersion(store) > 0)
+	}
+}
+
+func TestFileStoreWatch(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	dir := fakedb.GetTmpDir("", "radon_metastore_", log)
+	defer os.RemoveAll(dir)
+	store := NewFileStore(dir)
+	store.interval = time.Millisecond * 10
+
+	_, err := store.Put("db1/", nil, RevisionAny)
+	assert.Nil(t, err)
+	_, err = store.Put("db1/t1.json", []byte("t1"), RevisionAny)
+	assert.Nil(t, err)
+	watcher, err := store.Watch("db1/")
+	assert.Nil(t, err)
+	defer watcher.Close()
+
+	_, err = store.Put("db1/t1.json", []byte("t1-new"), RevisionAny)
+	assert.Nil(t, err)
+	_, err = store.Put("backend.json", []byte("{}"), RevisionAny)
+	assert.Nil(t, err)
+	for {
+		event := <-watcher.C
+		assert.NotEqual(t, "backend.json", event.KV.Key)
+		if event.KV.Key == "db1/t1.json" {
+			assert.Equal(t, EventPut, event.Type)
+			assert.Equal(t, "t1-new", string(event.KV.Value))
+			break
+		}
+	}
+
+	err = store.Delete("db1/t1.json", RevisionAny)
+	assert.Nil(t, err)
+	for {
+		event := <-watcher.C
+		if event.Type == EventDelete {
+			assert.Equal(t, "db1/t1.json", event.KV.Key)
+			break
+		}
+	}
+}
@@ -0,0 +1,502 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package metastore
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"config"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const (
+	// HistoryPrefix is the dir key of the snapshots,
+	// the '.' is not allowed in the database name so it never conflicts with the databases.
+	HistoryPrefix = ".history/"
+
+	// historyPutRetries is the max retries of the record if the version is taken.
+	historyPutRetries = 3
+
+	// BackendKey is the key of the backends.
+	BackendKey = "backend.json"
+
+	ChangeBackend   = "backend"
+	ChangeDatabase  = "database"
+	ChangeTable     = "table"
+	ChangePartition = "partition"
+	ChangeView      = "view"
+
+	ChangeAdd    = "add"
+	ChangeDrop   = "drop"
+	ChangeModify = "modify"
+)
+
+// Snapshot is the immutable copy of the metadata recorded after a change.
+type Snapshot struct {
+	Version int64             `json:"version"`
+	Author  string            `json:"author"`
+	Cause   string            `json:"cause"`
+	Metas   map[string]string `json:"metas"`
+}
+
+// Time returns the time of the snapshot.
+func (s *Snapshot) Time() time.Time {
+	return time.Unix(0, s.Version)
+}
+
+// Change is a difference between two snapshots.
+type Change struct {
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// History used to record the snapshots of the metadata in the store.
+// The snapshots are stored as the keys under HistoryPrefix, they are not replicated by the syncer,
+// every peer records the changes made by itself.
+type History struct {
+	log   *xlog.Log
+	mu    sync.Mutex
+	store Store
+	max   int
+}
+
+// NewHistory creates the history which keeps the max snapshots at most.
+func NewHistory(log *xlog.Log, store Store, max int) *History {
+	if max <= 0 {
+		max = config.DefaultMetaStoreConfig().HistoryMax
+	}
+	return &History{
+		log:   log,
+		store: store,
+		max:   max,
+	}
+}
+
+// IsHistoryKey returns true if the key is a snapshot key.
+func IsHistoryKey(key string) bool {
+	return strings.HasPrefix(key, HistoryPrefix)
+}
+
+// isRoutingKey returns true if the key is a database, a table or a view.
+func isRoutingKey(key string) bool {
+	return strings.Contains(key, "/") && !IsHistoryKey(key)
+}
+
+// isDatabaseKey returns true if the key is the dir key of a database: [database]/.
+func isDatabaseKey(key string) bool {
+	return isRoutingKey(key) && IsDir(key) && strings.Count(key, "/") == 1
+}
+
+// isTableKey returns true if the key is a table: [database]/[table].json,
+// the views are kept under '[database]/views/'.
+func isTableKey(key string) bool {
+	return isRoutingKey(key) && !IsDir(key) && strings.Count(key, "/") == 1
+}
+
+// isViewKey returns true if the key is a view: [database]/views/[view].json.
+func isViewKey(key string) bool {
+	return isRoutingKey(key) && !IsDir(key) && strings.Count(key, "/") == 2 && strings.Contains(key, "/views/")
+}
+
+func snapshotKey(version int64) string {
+	return fmt.Sprintf("%s%019d.json", HistoryPrefix, version)
+}
+
+// metas returns the backends with the passwords masked, the databases and tables in the store.
+func (h *History) metas() (map[string]string, error) {
+	kvs, err := h.store.List("")
+	if err != nil {
+		return nil, err
+	}
+	metas := make(map[string]string)
+	for _, kv := range kvs {
+		switch {
+		case kv.Key == BackendKey:
+			value, err := redactBackends(kv.Value)
+			if err != nil {
+				return nil, err
+			}
+			metas[kv.Key] = value
+		case isRoutingKey(kv.Key):
+			metas[kv.Key] = string(kv.Value)
+		}
+	}
+	return metas, nil
+}
+
+// redactBackends returns the backends with the passwords masked, the backends are never restored
+// so the snapshots do not need the passwords.
+func redactBackends(data []byte) (string, error) {
+	conf, err := config.ReadBackendsConfig(string(data))
+	if err != nil {
+		return "", err
+	}
+	for _, backend := range conf.Backends {
+		if backend.Password != "" {
+			backend.Password = "xxxxx"
+		}
+	}
+	value, err := config.MarshalConfig(conf)
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+// Snapshots returns all the snapshots in the version order.
+func (h *History) Snapshots() ([]*Snapshot, error) {
+	kvs, err := h.store.List(HistoryPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []*Snapshot
+	for _, kv := range kvs {
+		if IsDir(kv.Key) {
+			continue
+		}
+		snapshot := &Snapshot{}
+		if err := json.Unmarshal(kv.Value, snapshot); err != nil {
+			h.log.Error("meta.history.unmarshal.snapshot[%s].error:%v", kv.Key, err)
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
+
+// Snapshot returns the snapshot of the version.
+func (h *History) Snapshot(version int64) (*Snapshot, error) {
+	kv, err := h.store.Get(snapshotKey(version))
+	if err != nil {
+		if err == ErrNotFound {
+			return nil, errors.Errorf("meta.history.version[%d].not.found", version)
+		}
+		return nil, err
+	}
+	snapshot := &Snapshot{}
+	if err := json.Unmarshal(kv.Value, snapshot); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return snapshot, nil
+}
+
+// Current returns the snapshot of the current metadata which is not recorded.
+func (h *History) Current() (*Snapshot, error) {
+	metas, err := h.metas()
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{Version: time.Now().UnixNano(), Metas: metas}, nil
+}
+
+// Record used to record the current metadata as a new snapshot if it's changed since the last one,
+// it returns nil if nothing changed. The oldest snapshots beyond the max are removed.
+func (h *History) Record(author string, cause string) (*Snapshot, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	log := h.log
+	snapshots, err := h.Snapshots()
+	if err != nil {
+		return nil, err
+	}
+	current, err := h.Current()
+	if err != nil {
+		return nil, err
+	}
+	if n := len(snapshots); n > 0 {
+		last := snapshots[n-1]
+		if reflect.DeepEqual(last.Metas, current.Metas) {
+			return nil, nil
+		}
+		if current.Version <= last.Version {
+			current.Version = last.Version + 1
+		}
+	}
+	current.Author = author
+	current.Cause = cause
+
+	data, err := json.Marshal(current)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if _, err := h.store.Put(HistoryPrefix, nil, RevisionAny); err != nil {
+		return nil, err
+	}
+	// The version may be taken by the other peer if the store is shared.
+	for i := 0; ; i++ {
+		_, err := h.store.Put(snapshotKey(current.Version), data, RevisionNotExist)
+		if err == nil {
+			break
+		}
+		if err != ErrConflict || i >= historyPutRetries {
+			return nil, err
+		}
+		current.Version++
+		if data, err = json.Marshal(current); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	log.Warning("meta.history.record.version[%d].author[%s].cause[%s]", current.Version, author, cause)
+
+	snapshots = append(snapshots, current)
+	for len(snapshots) > h.max {
+		if err := h.store.Delete(snapshotKey(snapshots[0].Version), RevisionAny); err != nil && err != ErrNotFound {
+			log.Error("meta.history.remove.version[%d].error:%v", snapshots[0].Version, err)
+			break
+		}
+		snapshots = snapshots[1:]
+	}
+	return current, nil
+}
+
+// Restore used to write the databases and tables of the snapshot to the store in one batch,
+// the backends are not restored since they are the topology rather than the routing.
+func (h *History) Restore(snapshot *Snapshot) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	store := h.store
+	current, err := h.metas()
+	if err != nil {
+		return err
+	}
+
+	var drops []string
+	for key := range current {
+		if _, ok := snapshot.Metas[key]; !ok && isRoutingKey(key) {
+			drops = append(drops, key)
+		}
+	}
+	sort.Strings(drops)
+	puts := make(map[string][]byte)
+	for key, value := range snapshot.Metas {
+		if old, ok := current[key]; (!ok || old != value) && isRoutingKey(key) {
+			puts[key] = []byte(value)
+		}
+	}
+	if err := store.Batch(puts, drops); err != nil {
+		return err
+	}
+	return UpdateVersion(store)
+}
+
+// Tables returns the table configs of the snapshot, the key is 'db.table'.
+func (s *Snapshot) Tables() (map[string]*config.TableConfig, error) {
+	tables := make(map[string]*config.TableConfig)
+	for key, value := range s.Metas {
+		if !isTableKey(key) {
+			continue
+		}
+		conf, err := config.ReadTableConfig(value)
+		if err != nil {
+			return nil, err
+		}
+		db := key[:strings.Index(key, "/")]
+		tables[db+"."+conf.Name] = conf
+	}
+	return tables, nil
+}
+
+// Views returns the view configs of the snapshot, the key is 'db.view'.
+func (s *Snapshot) Views() (map[string]*config.ViewConfig, error) {
+	views := make(map[string]*config.ViewConfig)
+	for key, value := range s.Metas {
+		if !isViewKey(key) {
+			continue
+		}
+		conf, err := config.ReadViewConfig(value)
+		if err != nil {
+			return nil, err
+		}
+		db := key[:strings.Index(key, "/")]
+		views[db+"."+conf.Name] = conf
+	}
+	return views, nil
+}
+
+// Backends returns the backend configs of the snapshot, the key is the backend name.
+func (s *Snapshot) Backends() (map[string]*config.BackendConfig, error) {
+	backends := make(map[string]*config.BackendConfig)
+	data, ok := s.Metas[BackendKey]
+	if !ok {
+		return backends, nil
+	}
+	conf, err := config.ReadBackendsConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, backend := range conf.Backends {
+		backends[backend.Name] = backend
+	}
+	return backends, nil
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	for _, k := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// viewDefinition returns the definition of the view, such as '(a, b) select x, y from t'.
+func viewDefinition(conf *config.ViewConfig) string {
+	if len(conf.Columns) == 0 {
+		return conf.Query
+	}
+	return fmt.Sprintf("(%s) %s", strings.Join(conf.Columns, ", "), conf.Query)
+}
+
+// shardRule returns the sharding scheme of the table, such as 'HASH(id)'.
+func shardRule(conf *config.TableConfig) string {
+	if conf.ShardKey == "" {
+		return conf.ShardType
+	}
+	return fmt.Sprintf("%s(%s)", conf.ShardType, conf.ShardKey)
+}
+
+// Diff returns the changes from the snapshot 'from' to the snapshot 'to',
+// the tables are compared at the partition level and the views by the definitions.
+func Diff(from, to *Snapshot) ([]*Change, error) {
+	var changes []*Change
+
+	// Backends.
+	fromBackends, err := from.Backends()
+	if err != nil {
+		return nil, err
+	}
+	toBackends, err := to.Backends()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range sortedKeys(fromBackends) {
+		old := fromBackends[name]
+		backend, ok := toBackends[name]
+		switch {
+		case !ok:
+			changes = append(changes, &Change{Type: ChangeBackend, Name: name, Action: ChangeDrop, From: old.Address})
+		case !reflect.DeepEqual(old, backend):
+			changes = append(changes, &Change{Type: ChangeBackend, Name: name, Action: ChangeModify, From: old.Address, To: backend.Address})
+		}
+	}
+	for _, name := range sortedKeys(toBackends) {
+		if _, ok := fromBackends[name]; !ok {
+			changes = append(changes, &Change{Type: ChangeBackend, Name: name, Action: ChangeAdd, To: toBackends[name].Address})
+		}
+	}
+
+	// Databases.
+	for _, key := range sortedKeys(from.Metas) {
+		if _, ok := to.Metas[key]; !ok && isDatabaseKey(key) {
+			changes = append(changes, &Change{Type: ChangeDatabase, Name: strings.TrimSuffix(key, "/"), Action: ChangeDrop})
+		}
+	}
+	for _, key := range sortedKeys(to.Metas) {
+		if _, ok := from.Metas[key]; !ok && isDatabaseKey(key) {
+			changes = append(changes, &Change{Type: ChangeDatabase, Name: strings.TrimSuffix(key, "/"), Action: ChangeAdd})
+		}
+	}
+
+	// Tables.
+	fromTables, err := from.Tables()
+	if err != nil {
+		return nil, err
+	}
+	toTables, err := to.Tables()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range sortedKeys(fromTables) {
+		old := fromTables[name]
+		table, ok := toTables[name]
+		if !ok {
+			changes = append(changes, &Change{Type: ChangeTable, Name: name, Action: ChangeDrop, From: shardRule(old)})
+			continue
+		}
+		if shardRule(old) != shardRule(table) {
+			changes = append(changes, &Change{Type: ChangeTable, Name: name, Action: ChangeModify, From: shardRule(old), To: shardRule(table)})
+		}
+		changes = append(changes, diffPartitions(name, old, table)...)
+	}
+	for _, name := range sortedKeys(toTables) {
+		if _, ok := fromTables[name]; !ok {
+			changes = append(changes, &Change{Type: ChangeTable, Name: name, Action: ChangeAdd, To: shardRule(toTables[name])})
+		}
+	}
+
+	// Views.
+	fromViews, err := from.Views()
+	if err != nil {
+		return nil, err
+	}
+	toViews, err := to.Views()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range sortedKeys(fromViews) {
+		old := viewDefinition(fromViews[name])
+		view, ok := toViews[name]
+		switch {
+		case !ok:
+			changes = append(changes, &Change{Type: ChangeView, Name: name, Action: ChangeDrop, From: old})
+		case old != viewDefinition(view):
+			changes = append(changes, &Change{Type: ChangeView, Name: name, Action: ChangeModify, From: old, To: viewDefinition(view)})
+		}
+	}
+	for _, name := range sortedKeys(toViews) {
+		if _, ok := fromViews[name]; !ok {
+			changes = append(changes, &Change{Type: ChangeView, Name: name, Action: ChangeAdd, To: viewDefinition(toViews[name])})
+		}
+	}
+	return changes, nil
+}
+
+// diffPartitions compares the backends of the partitions of the table, the partition is '[db].[physical table]'.
+func diffPartitions(name string, from, to *config.TableConfig) []*Change {
+	var changes []*Change
+	db := name[:strings.Index(name, ".")]
+	backends := func(conf *config.TableConfig) map[string]string {
+		m := make(map[string]string)
+		for _, part := range conf.Partitions {
+			m[db+"."+part.Table] = part.Backend
+		}
+		return m
+	}
+
+	fromParts, toParts := backends(from), backends(to)
+	for _, part := range sortedKeys(fromParts) {
+		backend, ok := toParts[part]
+		switch {
+		case !ok:
+			changes = append(changes, &Change{Type: ChangePartition, Name: part, Action: ChangeDrop, From: fromParts[part]})
+		case backend != fromParts[part]:
+			changes = append(changes, &Change{Type: ChangePartition, Name: part, Action: ChangeModify, From: fromParts[part], To: backend})
+		}
+	}
+	for _, part := range sortedKeys(toParts) {
+		if _, ok := fromParts[part]; !ok {
+			changes = append(changes, &Change{Type: ChangePartition, Name: part, Action: ChangeAdd, To: toParts[part]})
+		}
+	}
+	return changes
+}
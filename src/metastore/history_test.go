@@ -0,0 +1,186 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package metastore
+
+import (
+	"os"
+	"testing"
+
+	"fakedb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const (
+	historyBackends  = `{"backends":[{"name":"node1","address":"127.0.0.1:3306","password":"secret"},{"name":"node2","address":"127.0.0.1:3307"}]}`
+	historyBackends1 = `{"backends":[{"name":"node1","address":"127.0.0.1:3306","password":"secret"},{"name":"node3","address":"127.0.0.1:3308"}]}`
+	historyT1        = `{"name":"t1","shardtype":"HASH","shardkey":"id","partitions":[{"table":"t1_0000","backend":"node1"},{"table":"t1_0001","backend":"node2"}]}`
+	historyT1Moved   = `{"name":"t1","shardtype":"HASH","shardkey":"id","partitions":[{"table":"t1_0000","backend":"node1"},{"table":"t1_0001","backend":"node1"}]}`
+	historyT2        = `{"name":"t2","shardtype":"GLOBAL","partitions":[{"table":"t2","backend":"node1"}]}`
+)
+
+func TestHistory(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	dir := fakedb.GetTmpDir("", "radon_history_", log)
+	defer os.RemoveAll(dir)
+	store := NewFileStore(dir)
+	history := NewHistory(log, store, 2)
+
+	put := func(key, value string) {
+		_, err := store.Put(key, []byte(value), RevisionAny)
+		assert.Nil(t, err)
+	}
+	put(BackendKey, historyBackends)
+	put("db1/", "")
+	put("db1/t1.json", historyT1)
+
+	// Record.
+	snap1, err := history.Record("root", "create table db1.t1")
+	assert.Nil(t, err)
+	assert.Equal(t, "root", snap1.Author)
+	assert.Equal(t, 3, len(snap1.Metas))
+	// The passwords are not kept in the snapshots.
+	assert.NotContains(t, snap1.Metas[BackendKey], "secret")
+	assert.Contains(t, snap1.Metas[BackendKey], "node1")
+
+	// Nothing changed.
+	{
+		snap, err := history.Record("root", "select 1")
+		assert.Nil(t, err)
+		assert.Nil(t, snap)
+	}
+
+	put("db1/t1.json", historyT1Moved)
+	put("db1/t2.json", historyT2)
+	put("db2/", "")
+	put("db2/views/", "")
+	put("db2/views/v1.json", `{"name":"v1","query":"select 1"}`)
+	put(BackendKey, historyBackends1)
+	snap2, err := history.Record("admin", "radon reshard")
+	assert.Nil(t, err)
+	assert.True(t, snap2.Version > snap1.Version)
+
+	// The snapshots are not the routing keys of the next snapshot.
+	snap, err := history.Current()
+	assert.Nil(t, err)
+	assert.Equal(t, 7, len(snap.Metas))
+
+	// Diff.
+	{
+		changes, err := Diff(snap1, snap2)
+		assert.Nil(t, err)
+		want := []*Change{
+			{Type: ChangeBackend, Name: "node2", Action: ChangeDrop, From: "127.0.0.1:3307"},
+			{Type: ChangeBackend, Name: "node3", Action: ChangeAdd, To: "127.0.0.1:3308"},
+			{Type: ChangeDatabase, Name: "db2", Action: ChangeAdd},
+			{Type: ChangePartition, Name: "db1.t1_0001", Action: ChangeModify, From: "node2", To: "node1"},
+			{Type: ChangeTable, Name: "db1.t2", Action: ChangeAdd, To: "GLOBAL"},
+			{Type: ChangeView, Name: "db2.v1", Action: ChangeAdd, To: "select 1"},
+		}
+		assert.Equal(t, want, changes)
+	}
+
+	// Diff the views.
+	{
+		from := &Snapshot{Metas: map[string]string{
+			"db2/views/v1.json": `{"name":"v1","query":"select 1"}`,
+			"db2/views/v2.json": `{"name":"v2","query":"select 2"}`,
+		}}
+		to := &Snapshot{Metas: map[string]string{
+			"db2/views/v1.json": `{"name":"v1","columns":["a"],"query":"select 1"}`,
+		}}
+		changes, err := Diff(from, to)
+		assert.Nil(t, err)
+		want := []*Change{
+			{Type: ChangeView, Name: "db2.v1", Action: ChangeModify, From: "select 1", To: "(a) select 1"},
+			{Type: ChangeView, Name: "db2.v2", Action: ChangeDrop, From: "select 2"},
+		}
+		assert.Equal(t, want, changes)
+
+		to.Metas["db2/views/v3.json"] = "{"
+		_, err = Diff(from, to)
+		assert.NotNil(t, err)
+	}
+
+	// Snapshots and prune.
+	{
+		put("db2/t3.json", `{"name":"t3","shardtype":"SINGLE","partitions":[{"table":"t3","backend":"node1"}]}`)
+		_, err := history.Record("root", "create table db2.t3")
+		assert.Nil(t, err)
+
+		snapshots, err := history.Snapshots()
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(snapshots))
+		assert.Equal(t, snap2.Version, snapshots[0].Version)
+
+		_, err = history.Snapshot(snap1.Version)
+		assert.NotNil(t, err)
+		got, err := history.Snapshot(snap2.Version)
+		assert.Nil(t, err)
+		assert.Equal(t, "radon reshard", got.Cause)
+	}
+
+	// Restore, the backends are kept.
+	{
+		err := history.Restore(snap1)
+		assert.Nil(t, err)
+		kvs, err := store.List("db")
+		assert.Nil(t, err)
+		var keys []string
+		for _, kv := range kvs {
+			keys = append(keys, kv.Key)
+		}
+		assert.Equal(t, []string{"db1/", "db1/t1.json"}, keys)
+		kv, err := store.Get("db1/t1.json")
+		assert.Nil(t, err)
+		assert.Equal(t, historyT1, string(kv.Value))
+		kv, err = store.Get(BackendKey)
+		assert.Nil(t, err)
+		assert.Equal(t, historyBackends1, string(kv.Value))
+		assert.True(t, ReadVersion(store) > 0)
+	}
+}
+
+// conflictStore returns ErrConflict on the first puts of the snapshots, as the versions are taken by the others.
+type conflictStore struct {
+	Store
+	conflicts int
+}
+
+func (s *conflictStore) Put(key string, value []byte, revision int64) (int64, error) {
+	if IsHistoryKey(key) && !IsDir(key) && s.conflicts > 0 {
+		s.conflicts--
+		return 0, ErrConflict
+	}
+	return s.Store.Put(key, value, revision)
+}
+
+func TestHistoryRecordConflict(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	dir := fakedb.GetTmpDir("", "radon_history_", log)
+	defer os.RemoveAll(dir)
+	store := &conflictStore{Store: NewFileStore(dir), conflicts: 2}
+	history := NewHistory(log, store, 2)
+
+	_, err := store.Put(BackendKey, []byte(historyBackends), RevisionAny)
+	assert.Nil(t, err)
+	snap, err := history.Record("root", "create table db1.t1")
+	assert.Nil(t, err)
+	got, err := history.Snapshot(snap.Version)
+	assert.Nil(t, err)
+	assert.Equal(t, snap.Version, got.Version)
+
+	// Too many conflicts.
+	store.conflicts = historyPutRetries + 1
+	_, err = store.Put(BackendKey, []byte(historyBackends1), RevisionAny)
+	assert.Nil(t, err)
+	_, err = history.Record("root", "radon attach")
+	assert.Equal(t, ErrConflict, err)
+}
@@ -0,0 +1,276 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package metastore
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"config"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+var _ Store = &MySQLStore{}
+
+// MySQLStore stores the metadata in a table of the MySQL server,
+// the radon nodes which share the table start from the same metadata.
+// The revision of the key starts from 1 and increases on every put.
+type MySQLStore struct {
+	log      *xlog.Log
+	mu       sync.Mutex
+	conf     *config.MetaStoreConfig
+	conn     driver.Conn
+	table    string
+	interval time.Duration
+}
+
+// NewMySQLStore creates the MySQL store, the connection is created on the first access.
+func NewMySQLStore(log *xlog.Log, conf *config.MetaStoreConfig) *MySQLStore {
+	return &MySQLStore{
+		log:      log,
+		conf:     conf,
+		table:    fmt.Sprintf("`%s`.`%s`", conf.Database, conf.Table),
+		interval: time.Second,
+	}
+}
+
+// encode returns the quoted and escaped sql string of the value.
+func encode(value []byte) string {
+	buf := &bytes.Buffer{}
+	sqltypes.MakeTrusted(sqltypes.VarBinary, value).EncodeSQL(buf)
+	return buf.String()
+}
+
+// connect creates the connection and the meta table if they are not exist.
+func (s *MySQLStore) connect() error {
+	if s.conn != nil && !s.conn.Closed() {
+		return nil
+	}
+
+	log := s.log
+	conf := s.conf
+	conn, err := driver.NewConn(conf.User, conf.Password, conf.Address, "", "utf8")
+	if err != nil {
+		log.Error("metastore.mysql.connect[%s].error:%v", conf.Address, err)
+		return errors.WithStack(err)
+	}
+	querys := []string{
+		fmt.Sprintf("create database if not exists `%s`", conf.Database),
+		fmt.Sprintf("create table if not exists %s(`name` varchar(255) not null, `value` longblob not null, `revision` bigint not null, primary key(`name`)) engine=innodb", s.table),
+	}
+	for _, query := range querys {
+		if _, err := conn.FetchAll(query, -1); err != nil {
+			log.Error("metastore.mysql.execute[%s].error:%v", query, err)
+			conn.Close()
+			return errors.WithStack(err)
+		}
+	}
+	s.conn = conn
+	return nil
+}
+
+// execute runs the querys in order with the lock held, the connection is closed on error.
+func (s *MySQLStore) execute(querys ...string) (*sqltypes.Result, error) {
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+
+	var qr *sqltypes.Result
+	for _, query := range querys {
+		var err error
+		if qr, err = s.conn.FetchAll(query, -1); err != nil {
+			s.log.Error("metastore.mysql.execute[%s].error:%v", query, err)
+			s.conn.Close()
+			s.conn = nil
+			return nil, errors.WithStack(err)
+		}
+	}
+	return qr, nil
+}
+
+// current returns the key or nil if it does not exist, the row is locked in the transaction.
+func (s *MySQLStore) current(key string) (*KV, error) {
+	qr, err := s.execute(fmt.Sprintf("select `name`, `value`, `revision` from %s where `name` = %s for update", s.table, encode([]byte(key))))
+	if err != nil {
+		return nil, err
+	}
+	kvs, err := rowsToKVs(qr)
+	if err != nil || len(kvs) == 0 {
+		return nil, err
+	}
+	return kvs[0], nil
+}
+
+func rowsToKVs(qr *sqltypes.Result) ([]*KV, error) {
+	var kvs []*KV
+	for _, row := range qr.Rows {
+		rev, err := strconv.ParseInt(row[2].ToString(), 10, 64)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		kvs = append(kvs, &KV{Key: row[0].ToString(), Value: row[1].Raw(), Revision: rev})
+	}
+	return kvs, nil
+}
+
+// Get used to read the row of the key.
+func (s *MySQLStore) Get(key string) (*KV, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	qr, err := s.execute(fmt.Sprintf("select `name`, `value`, `revision` from %s where `name` = %s", s.table, encode([]byte(key))))
+	if err != nil {
+		return nil, err
+	}
+	kvs, err := rowsToKVs(qr)
+	if err != nil {
+		return nil, err
+	}
+	if len(kvs) == 0 {
+		return nil, ErrNotFound
+	}
+	return kvs[0], nil
+}
+
+// Put used to write the row of the key in a transaction.
+func (s *MySQLStore) Put(key string, value []byte, revision int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.execute("begin"); err != nil {
+		return 0, err
+	}
+	current, err := s.current(key)
+	if err == nil {
+		err = check(current, revision)
+	}
+	if err != nil {
+		s.execute("rollback")
+		return 0, err
+	}
+
+	var query string
+	rev := int64(1)
+	switch {
+	case current != nil && bytes.Equal(current.Value, value):
+		_, err := s.execute("commit")
+		return current.Revision, err
+	case current == nil:
+		query = fmt.Sprintf("insert into %s(`name`, `value`, `revision`) values(%s, %s, %d)", s.table, encode([]byte(key)), encode(value), rev)
+	default:
+		rev = current.Revision + 1
+		query = fmt.Sprintf("update %s set `value` = %s, `revision` = %d where `name` = %s", s.table, encode(value), rev, encode([]byte(key)))
+	}
+	if _, err := s.execute(query, "commit"); err != nil {
+		return 0, err
+	}
+	return rev, nil
+}
+
+// Delete used to remove the row of the key, or the rows under the dir key.
+func (s *MySQLStore) Delete(key string, revision int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.execute("begin"); err != nil {
+		return err
+	}
+	current, err := s.current(key)
+	if err == nil && current == nil {
+		err = ErrNotFound
+	}
+	if err == nil {
+		err = check(current, revision)
+	}
+	if err != nil {
+		s.execute("rollback")
+		return err
+	}
+
+	query := fmt.Sprintf("delete from %s where `name` = %s", s.table, encode([]byte(key)))
+	if IsDir(key) {
+		query = fmt.Sprintf("delete from %s where left(`name`, %d) = %s", s.table, len(key), encode([]byte(key)))
+	}
+	_, err = s.execute(query, "commit")
+	return err
+}
+
+// Batch used to remove the rows of the deletes and write the puts in a transaction,
+// the revision increases only if the value is changed.
+func (s *MySQLStore) Batch(puts map[string][]byte, deletes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	querys := []string{"begin"}
+	for _, key := range deletes {
+		query := fmt.Sprintf("delete from %s where `name` = %s", s.table, encode([]byte(key)))
+		if IsDir(key) {
+			query = fmt.Sprintf("delete from %s where left(`name`, %d) = %s", s.table, len(key), encode([]byte(key)))
+		}
+		querys = append(querys, query)
+	}
+	keys := make([]string, 0, len(puts))
+	for key := range puts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		querys = append(querys, fmt.Sprintf("insert into %s(`name`, `value`, `revision`) values(%s, %s, 1) on duplicate key update `revision` = if(`value` = values(`value`), `revision`, `revision` + 1), `value` = values(`value`)",
+			s.table, encode([]byte(key)), encode(puts[key])))
+	}
+	querys = append(querys, "commit")
+	// The transaction is rolled back by closing the connection on error.
+	_, err := s.execute(querys...)
+	return err
+}
+
+// List used to read the rows with the prefix.
+func (s *MySQLStore) List(prefix string) ([]*KV, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query := fmt.Sprintf("select `name`, `value`, `revision` from %s order by `name`", s.table)
+	if prefix != "" {
+		query = fmt.Sprintf("select `name`, `value`, `revision` from %s where left(`name`, %d) = %s order by `name`", s.table, len(prefix), encode([]byte(prefix)))
+	}
+	qr, err := s.execute(query)
+	if err != nil {
+		return nil, err
+	}
+	return rowsToKVs(qr)
+}
+
+// Watch used to poll the changes of the rows with the prefix.
+func (s *MySQLStore) Watch(prefix string) (*Watcher, error) {
+	return newWatcher(s, prefix, s.interval)
+}
+
+// Shared returns true, the table is shared by all the nodes.
+func (s *MySQLStore) Shared() bool {
+	return true
+}
+
+// Close used to close the connection.
+func (s *MySQLStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package metastore
+
+import (
+	"testing"
+
+	"config"
+	"fakedb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func mockKVResult(kvs ...*KV) *sqltypes.Result {
+	qr := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "name", Type: querypb.Type_VARCHAR},
+			{Name: "value", Type: querypb.Type_BLOB},
+			{Name: "revision", Type: querypb.Type_INT64},
+		},
+	}
+	for _, kv := range kvs {
+		qr.Rows = append(qr.Rows, []sqltypes.Value{
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(kv.Key)),
+			sqltypes.MakeTrusted(querypb.Type_BLOB, kv.Value),
+			sqltypes.MakeTrusted(querypb.Type_INT64, []byte(sqltypes.NewInt64(kv.Revision).ToString())),
+		})
+	}
+	return qr
+}
+
+func mockMySQLStore(log *xlog.Log) (*fakedb.DB, *MySQLStore) {
+	fakedb := fakedb.New(log, 1)
+	conf := config.DefaultMetaStoreConfig()
+	conf.Type = TypeMySQL
+	conf.Address = fakedb.Addrs()[0]
+	conf.User = "mock"
+	conf.Password = "pwd"
+	store, err := New(log, "", conf)
+	if err != nil {
+		panic(err)
+	}
+
+	fakedb.AddQuery("create database if not exists `radon`", &sqltypes.Result{})
+	fakedb.AddQueryPattern("create table if not exists `radon`.`meta`.*", &sqltypes.Result{})
+	fakedb.AddQuery("begin", &sqltypes.Result{})
+	fakedb.AddQuery("commit", &sqltypes.Result{})
+	fakedb.AddQuery("rollback", &sqltypes.Result{})
+	return fakedb, store.(*MySQLStore)
+}
+
+func TestMySQLStore(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedb, store := mockMySQLStore(log)
+	defer fakedb.Close()
+	defer store.Close()
+	assert.True(t, store.Shared())
+
+	// Get.
+	{
+		fakedb.AddQuery("select `name`, `value`, `revision` from `radon`.`meta` where `name` = 'db1/t1.json'", mockKVResult(&KV{Key: "db1/t1.json", Value: []byte(`{"name":"t1"}`), Revision: 3}))
+		kv, err := store.Get("db1/t1.json")
+		assert.Nil(t, err)
+		assert.Equal(t, `{"name":"t1"}`, string(kv.Value))
+		assert.Equal(t, int64(3), kv.Revision)
+
+		fakedb.AddQuery("select `name`, `value`, `revision` from `radon`.`meta` where `name` = 'db1/t2.json'", mockKVResult())
+		_, err = store.Get("db1/t2.json")
+		assert.Equal(t, ErrNotFound, err)
+	}
+
+	// Put a new key, the value is escaped.
+	{
+		fakedb.AddQuery("select `name`, `value`, `revision` from `radon`.`meta` where `name` = 'db1/t2.json' for update", mockKVResult())
+		fakedb.AddQuery("insert into `radon`.`meta`(`name`, `value`, `revision`) values('db1/t2.json', '{\\\"name\\\":\\'t2\\'}', 1)", &sqltypes.Result{})
+		rev, err := store.Put("db1/t2.json", []byte(`{"name":'t2'}`), RevisionNotExist)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), rev)
+	}
+
+	// Compare and swap.
+	{
+		fakedb.AddQuery("select `name`, `value`, `revision` from `radon`.`meta` where `name` = 'db1/t1.json' for update", mockKVResult(&KV{Key: "db1/t1.json", Value: []byte("t1"), Revision: 3}))
+		_, err := store.Put("db1/t1.json", []byte("t1-new"), 2)
+		assert.Equal(t, ErrConflict, err)
+		assert.Equal(t, 1, fakedb.GetQueryCalledNum("rollback"))
+
+		fakedb.AddQuery("update `radon`.`meta` set `value` = 't1-new', `revision` = 4 where `name` = 'db1/t1.json'", &sqltypes.Result{})
+		rev, err := store.Put("db1/t1.json", []byte("t1-new"), 3)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(4), rev)
+
+		rev, err = store.Put("db1/t1.json", []byte("t1"), RevisionAny)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(3), rev)
+	}
+
+	// Delete the dir.
+	{
+		fakedb.AddQuery("select `name`, `value`, `revision` from `radon`.`meta` where `name` = 'db1/' for update", mockKVResult(&KV{Key: "db1/", Revision: 1}))
+		fakedb.AddQuery("delete from `radon`.`meta` where left(`name`, 4) = 'db1/'", &sqltypes.Result{})
+		err := store.Delete("db1/", RevisionAny)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, fakedb.GetQueryCalledNum("delete from `radon`.`meta` where left(`name`, 4) = 'db1/'"))
+
+		fakedb.AddQuery("select `name`, `value`, `revision` from `radon`.`meta` where `name` = 'db2/' for update", mockKVResult())
+		err = store.Delete("db2/", RevisionAny)
+		assert.Equal(t, ErrNotFound, err)
+	}
+
+	// Batch.
+	{
+		fakedb.AddQuery("delete from `radon`.`meta` where left(`name`, 4) = 'db3/'", &sqltypes.Result{})
+		fakedb.AddQuery("insert into `radon`.`meta`(`name`, `value`, `revision`) values('db1/', '', 1) on duplicate key update `revision` = if(`value` = values(`value`), `revision`, `revision` + 1), `value` = values(`value`)", &sqltypes.Result{})
+		fakedb.AddQuery("insert into `radon`.`meta`(`name`, `value`, `revision`) values('db1/t1.json', 't1', 1) on duplicate key update `revision` = if(`value` = values(`value`), `revision`, `revision` + 1), `value` = values(`value`)", &sqltypes.Result{})
+		err := store.Batch(map[string][]byte{"db1/t1.json": []byte("t1"), "db1/": nil}, []string{"db3/"})
+		assert.Nil(t, err)
+		assert.Equal(t, 1, fakedb.GetQueryCalledNum("delete from `radon`.`meta` where left(`name`, 4) = 'db3/'"))
+	}
+
+	// List.
+	{
+		fakedb.AddQuery("select `name`, `value`, `revision` from `radon`.`meta` where left(`name`, 4) = 'db1/' order by `name`", mockKVResult(&KV{Key: "db1/", Revision: 1}, &KV{Key: "db1/t1.json", Value: []byte("t1"), Revision: 3}))
+		kvs, err := store.List("db1/")
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(kvs))
+		assert.Equal(t, "db1/t1.json", kvs[1].Key)
+	}
+
+	// The table is created once.
+	assert.Equal(t, 1, fakedb.GetQueryCalledNum("create database if not exists `radon`"))
+}
+
+func TestMySQLStoreError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+
+	// Unsupported type.
+	{
+		_, err := New(log, "", &config.MetaStoreConfig{Type: "etcd"})
+		assert.Equal(t, "metastore.unsupported.type[etcd]", err.Error())
+	}
+
+	// Connect error.
+	{
+		conf := config.DefaultMetaStoreConfig()
+		conf.Address = "127.0.0.1:1"
+		store := NewMySQLStore(log, conf)
+		_, err := store.Get("backend.json")
+		assert.NotNil(t, err)
+	}
+
+	// The connection is recreated after the error.
+	{
+		fakedb, store := mockMySQLStore(log)
+		defer fakedb.Close()
+		defer store.Close()
+		fakedb.AddQueryErrorPattern("select .*", sqldb.NewSQLError1(1105, "HY000", "mock.error"))
+		_, err := store.List("")
+		assert.NotNil(t, err)
+		assert.Nil(t, store.conn)
+
+		fakedb.ResetPatternErrors()
+		fakedb.AddQuery("select `name`, `value`, `revision` from `radon`.`meta` order by `name`", mockKVResult())
+		kvs, err := store.List("")
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(kvs))
+		assert.Equal(t, 2, fakedb.GetQueryCalledNum("create database if not exists `radon`"))
+	}
+}
@@ -0,0 +1,254 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package metastore
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"config"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const (
+	// RevisionAny skips the revision check of Put and Delete.
+	RevisionAny = int64(-1)
+
+	// RevisionNotExist requires the key not exists when Put.
+	RevisionNotExist = int64(0)
+
+	// VersionKey is the key of the meta version.
+	VersionKey = "version.json"
+
+	// TypeFile stores the metadata in the files of the meta-dir.
+	TypeFile = "file"
+
+	// TypeMySQL stores the metadata in a table of the MySQL server.
+	TypeMySQL = "mysql"
+)
+
+var (
+	// ErrNotFound returns when the key does not exist.
+	ErrNotFound = errors.New("metastore.key.not.found")
+
+	// ErrConflict returns when the revision of the key does not match.
+	ErrConflict = errors.New("metastore.revision.conflict")
+)
+
+// KV tuple.
+type KV struct {
+	Key      string
+	Value    []byte
+	Revision int64
+}
+
+// EventType is the type of the watch event.
+type EventType int
+
+const (
+	// EventPut is sent when the key is created or updated.
+	EventPut EventType = iota
+
+	// EventDelete is sent when the key is deleted.
+	EventDelete
+)
+
+// Event tuple.
+type Event struct {
+	Type EventType
+	KV   *KV
+}
+
+// Store is the interface of the metadata storage.
+// The keys are the paths relative to the meta root, such as 'db/t1.json',
+// the key with the suffix '/' is a dir key, deleting it removes all the keys under it.
+type Store interface {
+	// Get returns the key, ErrNotFound if it does not exist.
+	Get(key string) (*KV, error)
+
+	// Put writes the key if the revision matches and returns the new revision,
+	// RevisionAny to skip the check and RevisionNotExist to create the key only.
+	// Putting the same value keeps the revision.
+	Put(key string, value []byte, revision int64) (int64, error)
+
+	// Delete removes the key if the revision matches.
+	Delete(key string, revision int64) error
+
+	// Batch removes the deletes and writes the puts without the revision check at once,
+	// the keys of the puts and the deletes must not overlap. It's atomic if the store supports.
+	Batch(puts map[string][]byte, deletes []string) error
+
+	// List returns the keys with the prefix in the key order.
+	List(prefix string) ([]*KV, error)
+
+	// Watch returns the watcher of the keys with the prefix.
+	Watch(prefix string) (*Watcher, error)
+
+	// Shared returns true if the store is shared by the peers, the changes need not to be replicated.
+	Shared() bool
+
+	// Close used to release the resources.
+	Close() error
+}
+
+// New creates the store by the config, the file store is rooted at the metadir.
+func New(log *xlog.Log, metadir string, conf *config.MetaStoreConfig) (Store, error) {
+	if conf == nil {
+		conf = config.DefaultMetaStoreConfig()
+	}
+	interval := time.Millisecond * time.Duration(conf.WatchInterval)
+	switch strings.ToLower(conf.Type) {
+	case "", TypeFile:
+		store := NewFileStore(metadir)
+		store.interval = interval
+		return store, nil
+	case TypeMySQL:
+		store := NewMySQLStore(log, conf)
+		store.interval = interval
+		return store, nil
+	}
+	return nil, errors.Errorf("metastore.unsupported.type[%s]", conf.Type)
+}
+
+// IsDir returns true if the key is a dir key.
+func IsDir(key string) bool {
+	return strings.HasSuffix(key, "/")
+}
+
+// check used to check the revision of the key, the current is nil if the key does not exist.
+func check(current *KV, revision int64) error {
+	switch {
+	case revision == RevisionAny:
+		return nil
+	case current == nil:
+		if revision == RevisionNotExist {
+			return nil
+		}
+		return ErrConflict
+	case current.Revision != revision:
+		return ErrConflict
+	}
+	return nil
+}
+
+// UpdateVersion used to update the meta version of the store.
+func UpdateVersion(store Store) error {
+	version := &config.Version{
+		Ts: time.Now().UnixNano(),
+	}
+	b, err := json.Marshal(version)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = store.Put(VersionKey, b, RevisionAny)
+	return err
+}
+
+// ReadVersion used to read the meta version from the store.
+func ReadVersion(store Store) int64 {
+	version := &config.Version{}
+	kv, err := store.Get(VersionKey)
+	if err != nil {
+		return 0
+	}
+	if err := json.Unmarshal(kv.Value, version); err != nil {
+		return 0
+	}
+	return version.Ts
+}
+
+// Watcher polls the store and sends the changes of the keys with the prefix to C.
+type Watcher struct {
+	C      chan *Event
+	store  Store
+	prefix string
+	revs   map[string]int64
+	done   chan bool
+	ticker *time.Ticker
+	wg     sync.WaitGroup
+}
+
+// newWatcher creates the watcher and starts the polling thread,
+// the keys exist at the creation are not sent.
+func newWatcher(store Store, prefix string, interval time.Duration) (*Watcher, error) {
+	kvs, err := store.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+	w := &Watcher{
+		C:      make(chan *Event, 64),
+		store:  store,
+		prefix: prefix,
+		revs:   make(map[string]int64),
+		done:   make(chan bool),
+		ticker: time.NewTicker(interval),
+	}
+	for _, kv := range kvs {
+		w.revs[kv.Key] = kv.Revision
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer w.ticker.Stop()
+		for {
+			select {
+			case <-w.ticker.C:
+				w.poll()
+			case <-w.done:
+				return
+			}
+		}
+	}()
+	return w, nil
+}
+
+// poll sends the changes since the last poll, the errors are retried at the next poll.
+func (w *Watcher) poll() {
+	kvs, err := w.store.List(w.prefix)
+	if err != nil {
+		return
+	}
+
+	var events []*Event
+	revs := make(map[string]int64, len(kvs))
+	for _, kv := range kvs {
+		revs[kv.Key] = kv.Revision
+		if rev, ok := w.revs[kv.Key]; !ok || rev != kv.Revision {
+			events = append(events, &Event{Type: EventPut, KV: kv})
+		}
+	}
+	for key := range w.revs {
+		if _, ok := revs[key]; !ok {
+			events = append(events, &Event{Type: EventDelete, KV: &KV{Key: key}})
+		}
+	}
+	w.revs = revs
+
+	for _, event := range events {
+		select {
+		case w.C <- event:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// Close used to stop the polling thread.
+func (w *Watcher) Close() {
+	close(w.done)
+	w.wg.Wait()
+}
@@ -11,6 +11,7 @@ package monitor
 import (
 	"net"
 	"net/http"
+	"sync"
 
 	"config"
 
@@ -75,8 +76,94 @@ var (
 			Name: "peer_number",
 			Help: "radon peer Number",
 		})
+
+	replicaLag = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "replica_lag_seconds",
+			Help: "replica lag seconds, -1 if unknown",
+		},
+		[]string{"backend", "address"},
+	)
+
+	replicaRouteCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "replica_route_total",
+			Help: "Counter of the reads routed to replica or primary.",
+		},
+		[]string{"backend", "target"},
+	)
+
+	failoverCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "backend_failover_total",
+			Help: "Counter of the backend primary switchovers.",
+		},
+		[]string{"backend"},
+	)
+
+	queryDigests = newQueryDigestCollector()
 )
 
+// QueryDigestMetric is the statistics of a query digest exported to prometheus.
+type QueryDigestMetric struct {
+	Digest  string
+	Text    string
+	Count   uint64
+	Errors  uint64
+	Latency float64 // total seconds
+	Rows    uint64
+	Shards  uint64
+}
+
+// queryDigestCollector collects the digests from the source on every scrape,
+// the source limits the cardinality by returning the top digests only.
+type queryDigestCollector struct {
+	mu      sync.RWMutex
+	source  func() []*QueryDigestMetric
+	count   *prometheus.Desc
+	errors  *prometheus.Desc
+	latency *prometheus.Desc
+	rows    *prometheus.Desc
+	shards  *prometheus.Desc
+}
+
+func newQueryDigestCollector() *queryDigestCollector {
+	labels := []string{"digest", "digest_text"}
+	return &queryDigestCollector{
+		count:   prometheus.NewDesc("query_digest_total", "Counter of the queries by digest.", labels, nil),
+		errors:  prometheus.NewDesc("query_digest_errors_total", "Counter of the failed queries by digest.", labels, nil),
+		latency: prometheus.NewDesc("query_digest_latency_seconds_total", "Total latency of the queries by digest.", labels, nil),
+		rows:    prometheus.NewDesc("query_digest_rows_total", "Counter of the rows sent or affected by digest.", labels, nil),
+		shards:  prometheus.NewDesc("query_digest_shards_total", "Counter of the shards touched by digest.", labels, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *queryDigestCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.count
+	ch <- c.errors
+	ch <- c.latency
+	ch <- c.rows
+	ch <- c.shards
+}
+
+// Collect implements prometheus.Collector.
+func (c *queryDigestCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	source := c.source
+	c.mu.RUnlock()
+	if source == nil {
+		return
+	}
+	for _, m := range source() {
+		ch <- prometheus.MustNewConstMetric(c.count, prometheus.CounterValue, float64(m.Count), m.Digest, m.Text)
+		ch <- prometheus.MustNewConstMetric(c.errors, prometheus.CounterValue, float64(m.Errors), m.Digest, m.Text)
+		ch <- prometheus.MustNewConstMetric(c.latency, prometheus.CounterValue, m.Latency, m.Digest, m.Text)
+		ch <- prometheus.MustNewConstMetric(c.rows, prometheus.CounterValue, float64(m.Rows), m.Digest, m.Text)
+		ch <- prometheus.MustNewConstMetric(c.shards, prometheus.CounterValue, float64(m.Shards), m.Digest, m.Text)
+	}
+}
+
 func init() {
 	prometheus.MustRegister(clientConnectionNum)
 	prometheus.MustRegister(backendConnectionNum)
@@ -85,6 +172,10 @@ func init() {
 	prometheus.MustRegister(diskUsage)
 	prometheus.MustRegister(slowQueryTotalCounter)
 	prometheus.MustRegister(peerNum)
+	prometheus.MustRegister(replicaLag)
+	prometheus.MustRegister(replicaRouteCounter)
+	prometheus.MustRegister(failoverCounter)
+	prometheus.MustRegister(queryDigests)
 }
 
 // Start monitor
@@ -162,3 +253,25 @@ func PeerNumDec() {
 func PeerNumSet(v float64) {
 	peerNum.Set(v)
 }
+
+// ReplicaLagSet set the lag of the replica
+func ReplicaLagSet(backend string, address string, v float64) {
+	replicaLag.WithLabelValues(backend, address).Set(v)
+}
+
+// ReplicaRouteInc add 1
+func ReplicaRouteInc(backend string, target string) {
+	replicaRouteCounter.WithLabelValues(backend, target).Inc()
+}
+
+// FailoverInc add 1
+func FailoverInc(backend string) {
+	failoverCounter.WithLabelValues(backend).Inc()
+}
+
+// QueryDigestSourceSet set the source of the query digests, nil to stop the export.
+func QueryDigestSourceSet(source func() []*QueryDigestMetric) {
+	queryDigests.mu.Lock()
+	defer queryDigests.mu.Unlock()
+	queryDigests.source = source
+}
@@ -13,6 +13,7 @@ import (
 
 	"config"
 
+	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/xlog"
@@ -184,6 +185,57 @@ func TestPeerNum(t *testing.T) {
 	assert.EqualValues(t, 1, v)
 }
 
+func TestReplicaLagSet(t *testing.T) {
+	ReplicaLagSet("backend1", "127.0.0.1:3306", 10)
+
+	var m dto.Metric
+	g, _ := replicaLag.GetMetricWithLabelValues("backend1", "127.0.0.1:3306")
+	err := g.Write(&m)
+	assert.Nil(t, err)
+	v := m.GetGauge().GetValue()
+
+	assert.EqualValues(t, 10, v)
+}
+
+func TestReplicaRouteInc(t *testing.T) {
+	ReplicaRouteInc("backend1", "replica")
+
+	var m dto.Metric
+	c, _ := replicaRouteCounter.GetMetricWithLabelValues("backend1", "replica")
+	err := c.Write(&m)
+	assert.Nil(t, err)
+	v := m.GetCounter().GetValue()
+
+	assert.EqualValues(t, 1, v)
+}
+
+func TestQueryDigestSourceSet(t *testing.T) {
+	collect := func() []prometheus.Metric {
+		ch := make(chan prometheus.Metric, 16)
+		queryDigests.Collect(ch)
+		close(ch)
+		var metrics []prometheus.Metric
+		for m := range ch {
+			metrics = append(metrics, m)
+		}
+		return metrics
+	}
+	assert.Equal(t, 0, len(collect()))
+
+	QueryDigestSourceSet(func() []*QueryDigestMetric {
+		return []*QueryDigestMetric{{Digest: "d1", Text: "select * from t1 where a = ?", Count: 3, Latency: 0.5}}
+	})
+	defer QueryDigestSourceSet(nil)
+	metrics := collect()
+	assert.Equal(t, 5, len(metrics))
+
+	var m dto.Metric
+	err := metrics[0].Write(&m)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3, m.GetCounter().GetValue())
+	assert.Equal(t, "d1", m.GetLabel()[0].GetValue())
+}
+
 func TestMonitorStart(t *testing.T) {
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
 	var conf config.Config
@@ -194,3 +246,15 @@ func TestMonitorStart(t *testing.T) {
 	conf.Monitor = config.DefaultMonitorConfig()
 	Start(log, &conf)
 }
+
+func TestFailoverInc(t *testing.T) {
+	FailoverInc("backend1")
+
+	var m dto.Metric
+	c, _ := failoverCounter.GetMetricWithLabelValues("backend1")
+	err := c.Write(&m)
+	assert.Nil(t, err)
+	v := m.GetCounter().GetValue()
+
+	assert.EqualValues(t, 1, v)
+}
@@ -11,6 +11,7 @@ package optimizer
 import (
 	"planner"
 	"router"
+	"xtrace"
 
 	"github.com/pkg/errors"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
@@ -28,6 +29,7 @@ type SimpleOptimizer struct {
 	query    string
 	node     sqlparser.Statement
 	router   *router.Router
+	span     *xtrace.Span
 }
 
 // NewSimpleOptimizer creates the new simple optimizer.
@@ -41,8 +43,26 @@ func NewSimpleOptimizer(log *xlog.Log, database string, query string, node sqlpa
 	}
 }
 
+// SetTrace sets the parent span of the planning, nil if not traced.
+func (so *SimpleOptimizer) SetTrace(span *xtrace.Span) {
+	so.span = span
+}
+
 // BuildPlanTree used to build plan trees for the query.
 func (so *SimpleOptimizer) BuildPlanTree() (*planner.PlanTree, error) {
+	span := so.span.StartChild("optimizer.build")
+	defer span.Finish()
+
+	plans, err := so.buildPlanTree()
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetAttr("plans", len(plans.Plans()))
+	return plans, nil
+}
+
+func (so *SimpleOptimizer) buildPlanTree() (*planner.PlanTree, error) {
 	log := so.log
 	database := so.database
 	query := so.query
@@ -11,6 +11,7 @@ package builder
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -29,6 +30,16 @@ type Aggregator struct {
 	Index    int
 	Type     sqltypes.AggrType
 	Distinct bool
+	// Separator and Orders are the group_concat arguments,
+	// the order by keys are the hidden columns which will be removed.
+	Separator string                 `json:",omitempty"`
+	Orders    []sqltypes.ConcatOrder `json:",omitempty"`
+	// Keys are the hidden sketch columns grouped by the shards, Percentile is the
+	// argument of the approx_percentile.
+	Keys       []int   `json:",omitempty"`
+	Percentile float64 `json:",omitempty"`
+	// Hidden marks the group by key not in the select list, it will be removed.
+	Hidden bool `json:",omitempty"`
 }
 
 // AggregatePlan represents order-by plan.
@@ -41,6 +52,9 @@ type AggregatePlan struct {
 	normalAggrs []Aggregator
 	groupAggrs  []Aggregator
 
+	// sketchGroups are the sketch keys which the shards group by.
+	sketchGroups sqlparser.GroupBy
+
 	// type
 	typ ChildType
 	// IsPushDown whether aggfunc can be pushed down.
@@ -61,13 +75,24 @@ func NewAggregatePlan(log *xlog.Log, exprs []sqlparser.SelectExpr, tuples, group
 
 // analyze used to check the aggregator is at the support level.
 // Supports:
-// SUM/COUNT/MIN/MAX/AVG/GROUPBY
+// SUM/COUNT/MIN/MAX/AVG/GROUP_CONCAT/STDDEV/VARIANCE/BIT_AND/BIT_OR/BIT_XOR/
+// APPROX_COUNT_DISTINCT/APPROX_PERCENTILE/GROUPBY
+// If pushed down, AVG is decomposed to SUM and COUNT, STDDEV/VARIANCE is decomposed to
+// COUNT(a), SUM(a) and SUM(a*a), the approximate aggregates are decomposed to the sketches
+// grouped by the hidden keys, the others are merged by the partial results.
 // Notes:
 // group by fields must be in the select list, for example:
 // select count(a), a from t group by a --[OK]
 // select count(a) from t group by a    --[ER]
 func (p *AggregatePlan) analyze() error {
 	var nullAggrs []Aggregator
+	// concats is the index of the group_concat aggregators which need all the rows.
+	var concats []int
+	var orderBys []sqlparser.OrderBy
+	// sketches is the index of the approximate aggregators, sketchKeys are their hidden keys.
+	var sketches []int
+	var sketchKeys [][]sqlparser.Expr
+	distinct := false
 	tuples := p.tuples
 
 	// aggregators.
@@ -95,13 +120,49 @@ func (p *AggregatePlan) analyze() error {
 			aggType = sqltypes.AggrTypeMax
 		case "avg":
 			aggType = sqltypes.AggrTypeAvg
+		case "group_concat":
+			aggType = sqltypes.AggrTypeGroupConcat
+		case "std", "stddev", "stddev_pop":
+			aggType = sqltypes.AggrTypeStddevPop
+		case "stddev_samp":
+			aggType = sqltypes.AggrTypeStddevSamp
+		case "variance", "var_pop":
+			aggType = sqltypes.AggrTypeVarPop
+		case "var_samp":
+			aggType = sqltypes.AggrTypeVarSamp
+		case "bit_and":
+			aggType = sqltypes.AggrTypeBitAnd
+		case "bit_or":
+			aggType = sqltypes.AggrTypeBitOr
+		case "bit_xor":
+			aggType = sqltypes.AggrTypeBitXor
+		case "approx_count_distinct":
+			aggType = sqltypes.AggrTypeApproxCountDistinct
+		case "approx_percentile":
+			aggType = sqltypes.AggrTypeApproxPercentile
 		default:
 			return errors.Errorf("unsupported: function:%+v", tuple.aggrFuc)
 		}
+		if tuple.distinct && (aggType.IsVariance() || aggType.IsBit() || aggType.IsApprox()) {
+			return errors.Errorf("unsupported: distinct.in.function:%+v", tuple.aggrFuc)
+		}
+		distinct = distinct || tuple.distinct
 
-		p.normalAggrs = append(p.normalAggrs, Aggregator{Field: tuple.field, Index: k, Type: aggType, Distinct: tuple.distinct})
+		aggr := Aggregator{Field: tuple.field, Index: k, Type: aggType, Distinct: tuple.distinct}
+		switch aggType {
+		case sqltypes.AggrTypeGroupConcat:
+			aggr.Separator = concatSeparator(tuple.expr.(*sqlparser.AliasedExpr).Expr.(*sqlparser.GroupConcatExpr))
+		case sqltypes.AggrTypeApproxPercentile:
+			percentile, err := approxPercentile(tuple.expr.(*sqlparser.AliasedExpr).Expr.(*sqlparser.FuncExpr))
+			if err != nil {
+				return err
+			}
+			aggr.Percentile = percentile
+		}
+		p.normalAggrs = append(p.normalAggrs, aggr)
 		if p.IsPushDown {
-			if aggType == sqltypes.AggrTypeAvg {
+			switch {
+			case aggType == sqltypes.AggrTypeAvg:
 				p.normalAggrs = append(p.normalAggrs, Aggregator{Field: fmt.Sprintf("sum(%s)", tuple.aggrField), Index: k, Type: sqltypes.AggrTypeSum})
 				p.normalAggrs = append(p.normalAggrs, Aggregator{Field: fmt.Sprintf("count(%s)", tuple.aggrField), Index: k + 1, Type: sqltypes.AggrTypeCount})
 				avgs := decomposeAvg(&tuple)
@@ -110,16 +171,92 @@ func (p *AggregatePlan) analyze() error {
 				p.rewritten[k] = avgs[0]
 				p.rewritten[(k + 1)] = avgs[1]
 				k++
+			case aggType.IsVariance():
+				vars := decomposeVariance(&tuple)
+				p.normalAggrs = append(p.normalAggrs, Aggregator{Field: fmt.Sprintf("count(%s)", tuple.aggrField), Index: k, Type: sqltypes.AggrTypeCount})
+				p.normalAggrs = append(p.normalAggrs, Aggregator{Field: fmt.Sprintf("sum(%s)", tuple.aggrField), Index: k + 1, Type: sqltypes.AggrTypeSum})
+				p.normalAggrs = append(p.normalAggrs, Aggregator{Field: sqlparser.String(vars[2].Expr), Index: k + 2, Type: sqltypes.AggrTypeSum})
+				p.rewritten = append(p.rewritten, &sqlparser.AliasedExpr{}, &sqlparser.AliasedExpr{})
+				copy(p.rewritten[(k+3):], p.rewritten[k+1:])
+				p.rewritten[k] = vars[0]
+				p.rewritten[(k + 1)] = vars[1]
+				p.rewritten[(k + 2)] = vars[2]
+				k += 2
+			case aggType.IsApprox():
+				var expr *sqlparser.AliasedExpr
+				var keys []sqlparser.Expr
+				var err error
+				if aggType == sqltypes.AggrTypeApproxCountDistinct {
+					expr, keys, err = decomposeApproxCountDistinct(&tuple)
+				} else {
+					expr, keys, err = decomposeApproxPercentile(&tuple)
+				}
+				if err != nil {
+					return err
+				}
+				p.rewritten[k] = expr
+				sketches = append(sketches, len(p.normalAggrs)-1)
+				sketchKeys = append(sketchKeys, keys)
 			}
 		} else {
 			p.rewritten[k] = decomposeAgg(&tuple)
 			p.tuples[k].expr = p.rewritten[k]
+			if aggType == sqltypes.AggrTypeGroupConcat {
+				concats = append(concats, len(p.normalAggrs)-1)
+				orderBys = append(orderBys, tuple.expr.(*sqlparser.AliasedExpr).Expr.(*sqlparser.GroupConcatExpr).OrderBy)
+			}
 		}
 		k++
 	}
 
+	// The order by keys of the group_concat are appended as the hidden columns.
+	for i, idx := range concats {
+		for j, order := range orderBys[i] {
+			tuple := parseExpr(order.Expr)
+			tuple.alias = fmt.Sprintf("tmpo_%d_%d", idx, j)
+			tuple.expr.(*sqlparser.AliasedExpr).As = sqlparser.NewColIdent(tuple.alias)
+			tuple.isCol = false
+			p.rewritten = append(p.rewritten, tuple.expr)
+			p.tuples = append(p.tuples, tuple)
+			p.normalAggrs[idx].Orders = append(p.normalAggrs[idx].Orders, sqltypes.ConcatOrder{
+				Index: len(p.rewritten) - 1,
+				Desc:  order.Direction == sqlparser.DescScr,
+			})
+		}
+	}
+
+	// The sketch keys are appended as the hidden columns, the same key is shared.
+	if len(sketches) > 0 && distinct {
+		return errors.Errorf("unsupported: distinct.with.approximate.aggregates")
+	}
+	keyIdxs := make(map[string]int)
+	for i, idx := range sketches {
+		for _, key := range sketchKeys[i] {
+			field := sqlparser.String(key)
+			keyIdx, ok := keyIdxs[field]
+			if !ok {
+				alias := fmt.Sprintf("tmpa_%d", len(keyIdxs))
+				p.rewritten = append(p.rewritten, &sqlparser.AliasedExpr{Expr: key, As: sqlparser.NewColIdent(alias)})
+				p.sketchGroups = append(p.sketchGroups, &sqlparser.ColName{Name: sqlparser.NewColIdent(alias)})
+				keyIdx = len(p.rewritten) - 1
+				keyIdxs[field] = keyIdx
+			}
+			p.normalAggrs[idx].Keys = append(p.normalAggrs[idx].Keys, keyIdx)
+		}
+	}
+
 	// Groupbys.
-	for _, by := range p.groups {
+	for i, by := range p.groups {
+		// The group by key not in the select list is appended as the hidden column.
+		if by.hidden {
+			by.alias = fmt.Sprintf("tmpg_%d", i)
+			by.expr = &sqlparser.AliasedExpr{Expr: by.info.expr, As: sqlparser.NewColIdent(by.alias)}
+			p.rewritten = append(p.rewritten, by.expr)
+			p.tuples = append(p.tuples, by)
+			p.groupAggrs = append(p.groupAggrs, Aggregator{Field: by.field, Index: len(p.rewritten) - 1, Type: sqltypes.AggrTypeGroupBy, Hidden: true})
+			continue
+		}
+
 		// check: groupby field in select list
 		idx := -1
 		for _, null := range nullAggrs {
@@ -136,6 +273,28 @@ func (p *AggregatePlan) analyze() error {
 	return nil
 }
 
+// concatSeparator returns the separator of the group_concat, the default is ','.
+func concatSeparator(expr *sqlparser.GroupConcatExpr) string {
+	if expr.Separator == "" {
+		return ","
+	}
+	sep := strings.TrimPrefix(expr.Separator, " separator '")
+	return strings.TrimSuffix(sep, "'")
+}
+
+// approxPercentile returns the percentile argument of the approx_percentile, it must be a number between 0 and 1.
+func approxPercentile(expr *sqlparser.FuncExpr) (float64, error) {
+	if aliased, ok := expr.Exprs[1].(*sqlparser.AliasedExpr); ok {
+		if val, ok := aliased.Expr.(*sqlparser.SQLVal); ok && (val.Type == sqlparser.IntVal || val.Type == sqlparser.FloatVal) {
+			percentile, err := strconv.ParseFloat(string(val.Val), 64)
+			if err == nil && percentile >= 0 && percentile <= 1 {
+				return percentile, nil
+			}
+		}
+	}
+	return 0, errors.Errorf("unsupported: approx_percentile.percentile.must.be.a.number.between.0.and.1")
+}
+
 // Build used to build distributed querys.
 func (p *AggregatePlan) Build() error {
 	return p.analyze()
@@ -177,6 +336,11 @@ func (p *AggregatePlan) GroupAggregators() []Aggregator {
 	return p.groupAggrs
 }
 
+// SketchGroupBy returns the sketch keys which the shards must group by.
+func (p *AggregatePlan) SketchGroupBy() sqlparser.GroupBy {
+	return p.sketchGroups
+}
+
 // ReWritten used to re-write the SelectExprs clause.
 func (p *AggregatePlan) ReWritten() sqlparser.SelectExprs {
 	return p.rewritten
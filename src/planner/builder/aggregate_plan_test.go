@@ -374,12 +374,16 @@ func TestAggregatePlanHaving(t *testing.T) {
 
 func TestAggregatePlanUnsupported(t *testing.T) {
 	querys := []string{
-		"select sum(a)  from A group by d",
+		"select sum(a)  from A group by sum(d)",
 		"select sum(a),d  from A group by db.t.d",
+		"select sum(a) as s from A group by s",
+		"select sum(a) from A group by 1",
 	}
 	results := []string{
-		"unsupported: group.by.field[d].should.be.in.select.list",
+		"unsupported: aggregation.in.group.by.clause[sum(d)]",
 		"unsupported: unknow.table.in.group.by.field[t.d]",
+		"unsupported: group.by.field[sum(a)].should.be.in.noaggregate.select.list",
+		"unsupported: group.by.[1].type.should.be.colname.or.expression",
 	}
 
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
@@ -514,3 +518,251 @@ func TestAggregatePlans(t *testing.T) {
 		}
 	}
 }
+
+func TestAggregatePlanDecompose(t *testing.T) {
+	querys := []string{
+		"select std(a), var_samp(a+1), bit_and(b), group_concat(str separator ';') from A",
+		"select group_concat(distinct a, b order by c desc, b), var_pop(b) from A",
+	}
+	results := []string{
+		`{
+	"Aggrs": [
+		{
+			"Field": "std(a)",
+			"Index": 0,
+			"Type": "STDDEV_POP",
+			"Distinct": false
+		},
+		{
+			"Field": "count(a)",
+			"Index": 0,
+			"Type": "COUNT",
+			"Distinct": false
+		},
+		{
+			"Field": "sum(a)",
+			"Index": 1,
+			"Type": "SUM",
+			"Distinct": false
+		},
+		{
+			"Field": "sum(a * a)",
+			"Index": 2,
+			"Type": "SUM",
+			"Distinct": false
+		},
+		{
+			"Field": "var_samp(a + 1)",
+			"Index": 3,
+			"Type": "VAR_SAMP",
+			"Distinct": false
+		},
+		{
+			"Field": "count(a + 1)",
+			"Index": 3,
+			"Type": "COUNT",
+			"Distinct": false
+		},
+		{
+			"Field": "sum(a + 1)",
+			"Index": 4,
+			"Type": "SUM",
+			"Distinct": false
+		},
+		{
+			"Field": "sum((a + 1) * (a + 1))",
+			"Index": 5,
+			"Type": "SUM",
+			"Distinct": false
+		},
+		{
+			"Field": "bit_and(b)",
+			"Index": 6,
+			"Type": "BIT_AND",
+			"Distinct": false
+		},
+		{
+			"Field": "group_concat(str separator ';')",
+			"Index": 7,
+			"Type": "GROUP_CONCAT",
+			"Distinct": false,
+			"Separator": ";"
+		}
+	],
+	"ReWritten": "count(a) as ` + "`std(a)`" + `, sum(a), sum(a * a), count(a + 1) as ` + "`var_samp(a + 1)`" + `, sum(a + 1), sum((a + 1) * (a + 1)), bit_and(b), group_concat(str separator ';')"
+}`,
+		`{
+	"Aggrs": [
+		{
+			"Field": "group_concat(distinct a, b order by c desc, b asc)",
+			"Index": 0,
+			"Type": "GROUP_CONCAT",
+			"Distinct": true,
+			"Separator": ",",
+			"Orders": [
+				{
+					"Index": 2,
+					"Desc": true
+				},
+				{
+					"Index": 3,
+					"Desc": false
+				}
+			]
+		},
+		{
+			"Field": "var_pop(b)",
+			"Index": 1,
+			"Type": "VAR_POP",
+			"Distinct": false
+		}
+	],
+	"ReWritten": "concat(a, b) as ` + "`group_concat(distinct a, b order by c desc, b asc)`" + `, b as ` + "`var_pop(b)`" + `, c as tmpo_0_0, b as tmpo_0_1"
+}`,
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.CreateDatabase("sbtest")
+	assert.Nil(t, err)
+	err = route.AddForTest("sbtest", router.MockTableMConfig())
+	assert.Nil(t, err)
+	for i, query := range querys {
+		tree, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		node := tree.(*sqlparser.Select)
+		p, err := scanTableExprs(log, route, "sbtest", node.From)
+		assert.Nil(t, err)
+		tuples, aggTyp, err := parseSelectExprs(node.SelectExprs, p)
+		assert.Nil(t, err)
+		plan := NewAggregatePlan(log, node.SelectExprs, tuples, nil, aggTyp == canPush)
+		// plan build
+		{
+			err := plan.Build()
+			assert.Nil(t, err)
+			want := results[i]
+			got := plan.JSON()
+			log.Debug("%s", got)
+			assert.Equal(t, want, got)
+		}
+	}
+}
+
+func TestAggregatePlanApprox(t *testing.T) {
+	querys := []string{
+		"select a, approx_count_distinct(b), approx_percentile(b, 0.99), count(*) from A group by a",
+	}
+	results := []string{
+		`{
+	"Aggrs": [
+		{
+			"Field": "approx_count_distinct(b)",
+			"Index": 1,
+			"Type": "APPROX_COUNT_DISTINCT",
+			"Distinct": false,
+			"Keys": [
+				4
+			]
+		},
+		{
+			"Field": "approx_percentile(b, 0.99)",
+			"Index": 2,
+			"Type": "APPROX_PERCENTILE",
+			"Distinct": false,
+			"Keys": [
+				5,
+				6
+			],
+			"Percentile": 0.99
+		},
+		{
+			"Field": "count(*)",
+			"Index": 3,
+			"Type": "COUNT",
+			"Distinct": false
+		},
+		{
+			"Field": "a",
+			"Index": 0,
+			"Type": "GROUP BY",
+			"Distinct": false
+		}
+	],
+	"ReWritten": "a, max(ifnull(48 - floor(log2(conv(substr(md5(b), 5, 12), 16, 10))), 49)) as ` + "`approx_count_distinct(b)`" + `, count(b) as ` + "`approx_percentile(b, 0.99)`" + `, count(*), conv(left(md5(b), 4), 16, 10) \u003e\u003e 2 as tmpa_0, sign(b) as tmpa_1, ceil(ln(abs(b)) / 0.020000666706669435) as tmpa_2"
+}`,
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.CreateDatabase("sbtest")
+	assert.Nil(t, err)
+	err = route.AddForTest("sbtest", router.MockTableMConfig())
+	assert.Nil(t, err)
+	for i, query := range querys {
+		tree, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		node := tree.(*sqlparser.Select)
+		p, err := scanTableExprs(log, route, "sbtest", node.From)
+		assert.Nil(t, err)
+		tuples, aggTyp, err := parseSelectExprs(node.SelectExprs, p)
+		assert.Nil(t, err)
+		groups, err := checkGroupBy(node.GroupBy, tuples, route, p.getReferTables(), false)
+		assert.Nil(t, err)
+		plan := NewAggregatePlan(log, node.SelectExprs, tuples, groups, aggTyp == canPush)
+		// plan build
+		{
+			err := plan.Build()
+			assert.Nil(t, err)
+			want := results[i]
+			got := plan.JSON()
+			log.Debug("%s", got)
+			assert.Equal(t, want, got)
+			assert.Equal(t, " group by tmpa_0, tmpa_1, tmpa_2", sqlparser.String(plan.SketchGroupBy()))
+		}
+	}
+}
+
+func TestAggregatePlanApproxError(t *testing.T) {
+	querys := []string{
+		"select approx_percentile(b, 2) from A",
+		"select approx_percentile(b, c) from A",
+		"select approx_count_distinct(distinct b) from A",
+		"select approx_count_distinct(b), count(distinct a) from A",
+	}
+	results := []string{
+		"unsupported: approx_percentile.percentile.must.be.a.number.between.0.and.1",
+		"unsupported: approx_percentile.percentile.must.be.a.number.between.0.and.1",
+		"unsupported: distinct.in.function:approx_count_distinct",
+		"unsupported: distinct.with.approximate.aggregates",
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.CreateDatabase("sbtest")
+	assert.Nil(t, err)
+	err = route.AddForTest("sbtest", router.MockTableMConfig())
+	assert.Nil(t, err)
+	for i, query := range querys {
+		tree, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		node := tree.(*sqlparser.Select)
+		p, err := scanTableExprs(log, route, "sbtest", node.From)
+		assert.Nil(t, err)
+		tuples, _, err := parseSelectExprs(node.SelectExprs, p)
+		assert.Nil(t, err)
+		plan := NewAggregatePlan(log, node.SelectExprs, tuples, nil, true)
+		// plan build
+		{
+			err := plan.Build()
+			want := results[i]
+			got := err.Error()
+			assert.Equal(t, want, got)
+		}
+	}
+}
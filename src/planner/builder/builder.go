@@ -23,6 +23,10 @@ import (
 func BuildNode(log *xlog.Log, router *router.Router, database string, node sqlparser.SelectStatement) (PlanNode, error) {
 	var err error
 	var root PlanNode
+	links, err := expandWith(log, router, database, node)
+	if err != nil {
+		return nil, err
+	}
 	switch node := node.(type) {
 	case *sqlparser.Select:
 		root, err = processSelect(log, router, database, node)
@@ -35,6 +39,7 @@ func BuildNode(log *xlog.Log, router *router.Router, database string, node sqlpa
 		return nil, err
 	}
 
+	linkDerived(root, links)
 	root.buildQuery(root)
 	return root, nil
 }
@@ -55,8 +60,10 @@ func processSelect(log *xlog.Log, router *router.Router, database string, node *
 		return nil, err
 	}
 
+	// The approximate aggregates are unknown to the backends, must be computed by radon.
+	approx := hasApproxAggregates(node.SelectExprs)
 	mn, ok := root.(*MergeNode)
-	if ok && mn.routeLen == 1 {
+	if ok && mn.routeLen == 1 && !approx {
 		sel := mn.Sel.(*sqlparser.Select)
 		node.From = sel.From
 		node.Where = sel.Where
@@ -73,18 +80,46 @@ func processSelect(log *xlog.Log, router *router.Router, database string, node *
 		return nil, err
 	}
 
-	if groups, err = checkGroupBy(node.GroupBy, fields, router, tbInfos, ok); err != nil {
+	if ok && aggTyp == notPush {
+		if aggTyp, err = checkDistinctAggrs(fields, router, tbInfos); err != nil {
+			return nil, err
+		}
+	}
+
+	canOpt := ok && !approx
+	if groups, err = checkGroupBy(node.GroupBy, fields, router, tbInfos, canOpt); err != nil {
 		return nil, err
 	}
 
-	if groups, err = checkDistinct(node, groups, fields, router, tbInfos, ok); err != nil {
+	if groups, err = checkDistinct(node, groups, fields, router, tbInfos, canOpt); err != nil {
 		return nil, err
 	}
 
+	// The window functions are pushed down if every window is partitioned by the shard key,
+	// otherwise they are evaluated by radon over the merged rows.
+	windowed := false
+	if hasWindowFuncs(node.SelectExprs) {
+		pushDown, err := checkWindowFuncs(node.SelectExprs, root, router)
+		if err != nil {
+			return nil, err
+		}
+		if pushDown && (len(groups) > 0 || (aggTyp != nullAgg && len(node.GroupBy) == 0)) ||
+			!pushDown && (aggTyp != nullAgg || len(node.GroupBy) > 0) {
+			return nil, errors.New("unsupported: window.function.with.cross-shard.aggregation")
+		}
+		windowed = !pushDown
+	}
+
 	if err = root.pushSelectExprs(fields, groups, node, aggTyp); err != nil {
 		return nil, err
 	}
 
+	if windowed {
+		if err = root.(*MergeNode).pushWindows(fields); err != nil {
+			return nil, err
+		}
+	}
+
 	if node.Having != nil {
 		if err = pushHavings(root, node.Having.Expr); err != nil {
 			return nil, err
@@ -210,12 +210,12 @@ func TestProcessSelect(t *testing.T) {
 			project: "tmp, b, sum(id), count(id)",
 			out: []xcontext.QueryTuple{
 				{
-					Query:   "select id as tmp, b, id as `sum(id)`, id as `count(id)` from sbtest.B0 as B group by b order by b asc",
+					Query:   "select sum(distinct id) as tmp, count(distinct id), b, sum(id), count(id) from sbtest.B0 as B group by b order by b asc",
 					Backend: "backend1",
 					Range:   "[0-512)",
 				},
 				{
-					Query:   "select id as tmp, b, id as `sum(id)`, id as `count(id)` from sbtest.B1 as B group by b order by b asc",
+					Query:   "select sum(distinct id) as tmp, count(distinct id), b, sum(id), count(id) from sbtest.B1 as B group by b order by b asc",
 					Backend: "backend2",
 					Range:   "[512-4096)",
 				}},
@@ -490,14 +490,14 @@ func TestSelectDatabaseIsNull(t *testing.T) {
 func TestSelectUnsupported(t *testing.T) {
 	querys := []string{
 		"select * from A as A1 where id in (select id from B)",
-		"select distinct(b) from A",
+		"select distinct count(b) from A",
 		"select * from A join B on B.id=A.id",
 		"select id from A limit x",
 		"select age,count(*) from A group by age having count(*) >=2",
 		"select * from A where B.a >1",
 		"select count() from A",
 		"select round(avg(id)) from A",
-		"select id,group_concat(distinct name) from A group by id",
+		"select a,group_concat(distinct name order by 1) from A group by a",
 		"select next value for A",
 		"select A.*,(select b.str from b where A.id=B.id) str from A",
 		"select avg(id)*1000 from A",
@@ -520,13 +520,14 @@ func TestSelectUnsupported(t *testing.T) {
 		"select A.id from G, A left join B on A.id=B.id where abs(B.a) > G.a",
 		"select A.id from (G, A left join B on A.id=B.id),C where abs(B.a) > G.a",
 		"select A.id from C,(G, A left join B on A.id=B.id) where abs(B.a+B.b) > G.a",
-		"select a+1 from A order by a+1",
-		"select b as a from A group by A.a",
-		"select a+1 from A group by a+1",
 		"select count(distinct *) from A",
 		"select t1.a from G",
 		"select S.id from A join B on B.id=A.id",
 		"select eeeee from A join B on B.id=A.id",
+		"select var_pop(distinct a) from A",
+		"select a from A order by count(b)",
+		"select count(*) from A join B on A.id=B.id group by a",
+		"select a from A group by 1",
 	}
 	results := []string{
 		"unsupported: subqueries.in.select",
@@ -537,7 +538,7 @@ func TestSelectUnsupported(t *testing.T) {
 		"unsupported: unknown.column.'B.a'.in.clause",
 		"unsupported: invalid.use.of.group.function[count]",
 		"unsupported: 'round(avg(id))'.contain.aggregate.in.select.exprs",
-		"unsupported: group_concat.in.select.exprs",
+		"unsupported: group_concat.order.by.position",
 		"unsupported: nextval.in.select.exprs",
 		"unsupported: subqueries.in.select.exprs",
 		"unsupported: 'avg(id) * 1000'.contain.aggregate.in.select.exprs",
@@ -560,13 +561,14 @@ func TestSelectUnsupported(t *testing.T) {
 		"unsupported: expr.'abs(B.a)'.in.cross-shard.left.join",
 		"unsupported: expr.'abs(B.a)'.in.cross-shard.left.join",
 		"unsupported: expr.'abs(B.a + B.b)'.in.cross-shard.left.join",
-		"unsupported: orderby:[a + 1].type.should.be.colname",
-		"unsupported: group.by.field[A.a].should.be.in.select.list",
-		"unsupported: group.by.[a + 1].type.should.be.colname",
 		"unsupported: syntax.error.at.'count(distinct *)'",
 		"unsupported: unknown.column.'t1.a'.in.exprs",
 		"unsupported: unknown.column.'S.id'.in.field.list",
 		"unsupported: unknown.column.'eeeee'.in.select.exprs",
+		"unsupported: distinct.in.function:var_pop",
+		"unsupported: aggregation.in.order.by.clause[count(b)]",
+		"unsupported: column.'a'.in.group.by.clause.is.ambiguous",
+		"unsupported: group.by.[1].type.should.be.colname.or.expression",
 	}
 
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
@@ -623,6 +625,26 @@ func TestSelectSupported(t *testing.T) {
 		"select A.id from A left join B on B.id+1=A.id where B.str1+B.str2 is null",
 		"select A.id from A join B on A.id=B.id where A.id in (1,2) or B.a=1",
 		"select A.id from A join B on A.id = B.id join G on A.id+B.id<=G.id where A.str + B.str is null",
+		"select distinct(b) from A",
+		"select distinct a+1, b from A",
+		"select id,group_concat(distinct name) from A group by id",
+		"select group_concat(A.a, B.b order by A.b desc separator ';') from A join B on A.id=B.id",
+		"select std(a), stddev_samp(a), variance(a+1), var_samp(a), bit_and(a), bit_or(a), bit_xor(a) from A",
+		"select bit_xor(A.a), stddev(B.b) from A join B on A.id=B.id",
+		"select approx_count_distinct(a), approx_percentile(b, 0.5) from A where id=1",
+		"select id, approx_count_distinct(a) from A group by id",
+		"select approx_percentile(A.a, 0.9), approx_count_distinct(B.b) from A join B on A.id=B.id",
+		"select a+1 from A order by a+1",
+		"select b as a from A group by A.a",
+		"select a+1 from A group by a+1",
+		"select count(*) from A group by date(b) order by date(b) desc",
+		"select a, sum(b) from A group by a, c order by sum(b), c",
+		"select A.a, count(*) from A join B on A.id=B.id group by A.a, B.b % 10 order by A.a * 2, B.b",
+		"select A.a from A join B on A.id=B.id order by A.a + B.a desc",
+		"select a, rank() over (order by b desc) as r from A where id=1",
+		"select a, row_number() over (partition by id order by b) from A",
+		"select A.a, sum(G.b) over (partition by A.id) from A join G on A.id=G.id",
+		"select a, lead(b) over (partition by c order by a), avg(b) over (partition by c) from A order by a limit 10",
 	}
 
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
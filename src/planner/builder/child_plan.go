@@ -20,6 +20,9 @@ const (
 
 	// ChildTypeAggregate enum.
 	ChildTypeAggregate ChildType = "ChildTypeAggregate"
+
+	// ChildTypeWindow enum.
+	ChildTypeWindow ChildType = "ChildTypeWindow"
 )
 
 // ChildPlan interface.
@@ -17,6 +17,10 @@ import (
 
 func checkTbName(tbInfos map[string]*tableInfo, node sqlparser.SQLNode) error {
 	return sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		// The columns in the derived tables are checked when planning them.
+		if _, ok := node.(*sqlparser.Subquery); ok {
+			return false, nil
+		}
 		if col, ok := node.(*sqlparser.ColName); ok {
 			tableName := col.Qualifier.Name.String()
 			if tableName != "" {
@@ -0,0 +1,161 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package builder
+
+import (
+	"strings"
+	"sync"
+
+	"router"
+
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+var (
+	_ sqlparser.Encodable = &Derived{}
+)
+
+// Derived represents a derived table in the FROM clause, such as the reference of a common table expression.
+// If the derived table can be pushed down to one backend, it's formatted inline in the query.
+// Otherwise it's materialized once by radon, and the rows are passed to the backends as a constant table.
+type Derived struct {
+	sync.Mutex
+	Name string
+	// Root is the plan of the derived table.
+	Root PlanNode
+	// Anchor and Recursive are the plans of the recursive common table expression,
+	// the Recursive part reads the rows of the last iteration from the Self.
+	Anchor    PlanNode
+	Recursive PlanNode
+	Self      *Derived
+	// Distinct is true if the parts of the recursive common table expression are combined by UNION DISTINCT.
+	Distinct bool
+
+	pushed bool
+	built  bool
+	result *sqltypes.Result
+}
+
+// newDerived used to plan the derived table.
+func newDerived(log *xlog.Log, router *router.Router, database, name string, node *sqlparser.Subquery) (*Derived, error) {
+	root, err := processPart(log, router, database, node.Select)
+	if err != nil {
+		return nil, err
+	}
+	d := &Derived{Name: name, Root: root}
+	if pushable(root) {
+		d.pushed = true
+		node.Select = root.(*MergeNode).Sel
+	}
+	return d, nil
+}
+
+// nonGlobal returns true if the pushed derived table refers to the non-global tables,
+// the materialized derived table can be joined with any table like a global table.
+func (d *Derived) nonGlobal() bool {
+	if !d.pushed {
+		return false
+	}
+	return d.Root.(*MergeNode).nonGlobalCnt > 0
+}
+
+// buildQuery used to build the querys of the derived table, only once.
+func (d *Derived) buildQuery() {
+	if d.built {
+		return
+	}
+	d.built = true
+	for _, node := range []PlanNode{d.Root, d.Anchor, d.Recursive} {
+		if node != nil {
+			node.buildQuery(node)
+		}
+	}
+}
+
+// Result returns the materialized rows, nil if not materialized.
+func (d *Derived) Result() *sqltypes.Result {
+	return d.result
+}
+
+// SetResult sets the materialized rows.
+func (d *Derived) SetResult(result *sqltypes.Result) {
+	d.result = result
+}
+
+// EncodeSQL encodes the materialized rows as a constant table, such as:
+// (select 1 as `a`, 'x' as `b` union all select 2, 'y').
+func (d *Derived) EncodeSQL(buf *strings.Builder) {
+	var fields []string
+	var rows [][]sqltypes.Value
+	if d.result != nil {
+		for _, field := range d.result.Fields {
+			fields = append(fields, sqlparser.String(sqlparser.NewColIdent(field.Name)))
+		}
+		rows = d.result.Rows
+	}
+
+	buf.WriteString("(")
+	if len(rows) == 0 {
+		buf.WriteString("select ")
+		for i, field := range fields {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString("null as ")
+			buf.WriteString(field)
+		}
+		buf.WriteString(" from dual where 1 != 1)")
+		return
+	}
+	for i, row := range rows {
+		if i > 0 {
+			buf.WriteString(" union all ")
+		}
+		buf.WriteString("select ")
+		for j, v := range row {
+			if j > 0 {
+				buf.WriteString(", ")
+			}
+			v.EncodeSQL(buf)
+			if i == 0 {
+				buf.WriteString(" as ")
+				buf.WriteString(fields[j])
+			}
+		}
+	}
+	buf.WriteString(")")
+}
+
+// linkDerived replaces the placeholders of the common table expressions in the plan tree by the
+// materialized derived tables.
+func linkDerived(node PlanNode, links map[*sqlparser.Subquery]*Derived) {
+	switch node := node.(type) {
+	case *MergeNode:
+		for _, tbInfo := range node.referTables {
+			if tbInfo.derived == nil {
+				continue
+			}
+			if sub, ok := tbInfo.tableExpr.Expr.(*sqlparser.Subquery); ok {
+				if d, ok := links[sub]; ok {
+					tbInfo.derived = d
+					continue
+				}
+			}
+			linkDerived(tbInfo.derived.Root, links)
+		}
+	case *JoinNode:
+		linkDerived(node.Left, links)
+		linkDerived(node.Right, links)
+	case *UnionNode:
+		linkDerived(node.Left, links)
+		linkDerived(node.Right, links)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package builder
+
+import (
+	"router"
+	"xcontext"
+
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// BuildDMLNode used to plan the table references and the where clause of the multiple-table UPDATE/DELETE.
+// Returns the MergeNode if the tables can be pushed down as a whole(the tables are co-located or global),
+// otherwise returns nil.
+func BuildDMLNode(log *xlog.Log, router *router.Router, database string, sel *sqlparser.Select) (*MergeNode, error) {
+	// The qualifiers of the DML refer to the table names, which are rewritten to the shard tables' name.
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		if expr, ok := node.(*sqlparser.AliasedTableExpr); ok {
+			if tb, ok := expr.Expr.(sqlparser.TableName); ok && expr.As.IsEmpty() {
+				expr.As = tb.Name
+			}
+		}
+		return true, nil
+	}, sel.From)
+
+	root, err := scanTableExprs(log, router, database, sel.From)
+	if err != nil {
+		return nil, err
+	}
+	if sel.Where != nil {
+		if root, err = pushFilters(root, sel.Where.Expr); err != nil {
+			return nil, err
+		}
+	}
+	if root, err = root.calcRoute(); err != nil {
+		return nil, err
+	}
+	m, ok := root.(*MergeNode)
+	if !ok {
+		return nil, nil
+	}
+	return m, nil
+}
+
+// GenerateDMLQuerys generates the DML querys of all the routes, the format writes the DML by the
+// rewritten select of the route. If all the tables are global, the DML is sent to all the backends.
+func (m *MergeNode) GenerateDMLQuerys(format func(buf *sqlparser.TrackedBuffer, sel *sqlparser.Select)) ([]xcontext.QueryTuple, error) {
+	sel := m.Sel.(*sqlparser.Select)
+	querys := make([]xcontext.QueryTuple, 0, m.routeLen)
+	if m.nonGlobalCnt == 0 {
+		for _, tbInfo := range m.referTables {
+			segments, err := m.router.Lookup(tbInfo.database, tbInfo.tableName, nil, nil)
+			if err != nil {
+				return nil, err
+			}
+			for _, segment := range segments {
+				buf := sqlparser.NewTrackedBuffer(nil)
+				format(buf, sel)
+				querys = append(querys, xcontext.QueryTuple{
+					Query:   buf.String(),
+					Backend: segment.Backend,
+					Range:   segment.Range.String(),
+				})
+			}
+			break
+		}
+		return querys, nil
+	}
+
+	for i := 0; i < m.routeLen; i++ {
+		backend, Range := m.route(i)
+		buf := sqlparser.NewTrackedBuffer(nil)
+		format(buf, sel)
+		querys = append(querys, xcontext.QueryTuple{
+			Query:   buf.String(),
+			Backend: backend,
+			Range:   Range,
+		})
+	}
+	return querys, nil
+}
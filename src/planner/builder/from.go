@@ -35,6 +35,8 @@ type tableInfo struct {
 	tableExpr *sqlparser.AliasedTableExpr
 	// table's route.
 	Segments []router.Segment `json:",omitempty"`
+	// derived table, nil if the table is a base table.
+	derived *Derived
 	// table's parent node, the type always a MergeNode.
 	parent *MergeNode
 }
@@ -92,6 +94,9 @@ func scanAliasedTableExpr(log *xlog.Log, r *router.Router, database string, tabl
 		if expr.Qualifier.IsEmpty() {
 			expr.Qualifier = sqlparser.NewTableIdent(database)
 		}
+		if view := r.View(expr.Qualifier.String(), expr.Name.String()); view != nil {
+			return scanView(log, r, expr.Qualifier.String(), tableExpr, view)
+		}
 		tn := &tableInfo{
 			database: expr.Qualifier.String(),
 			Segments: make([]router.Segment, 0, 16),
@@ -131,7 +136,23 @@ func scanAliasedTableExpr(log *xlog.Log, r *router.Router, database string, tabl
 			mn.referTables[tn.tableName] = tn
 		}
 	case *sqlparser.Subquery:
-		err = errors.New("unsupported: subquery.in.select")
+		if tableExpr.As.IsEmpty() {
+			return nil, errors.New("unsupported: every.derived.table.must.have.its.own.alias")
+		}
+		tn := &tableInfo{
+			database:  database,
+			tableName: tableExpr.As.String(),
+			alias:     tableExpr.As.String(),
+			tableExpr: tableExpr,
+			parent:    mn,
+		}
+		if tn.derived, err = newDerived(log, r, database, tn.alias, expr); err != nil {
+			return nil, err
+		}
+		if tn.derived.nonGlobal() {
+			mn.nonGlobalCnt = 1
+		}
+		mn.referTables[tn.alias] = tn
 	}
 	mn.Sel = &sqlparser.Select{From: sqlparser.TableExprs([]sqlparser.TableExpr{tableExpr})}
 	return mn, err
@@ -345,6 +345,25 @@ func TestScanTableExprs(t *testing.T) {
 		assert.Equal(t, 2, len(j2.joinOn))
 		assert.Equal(t, j2.Right, tbInfo.parent)
 	}
+	// derived tables.
+	{
+		query := "select * from (select * from A where id=1) as D join (select * from B) as E on D.a=E.a join G on G.a=D.a"
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+
+		planNode, err := scanTableExprs(log, route, database, node.(*sqlparser.Select).From)
+		assert.Nil(t, err)
+
+		m, ok := planNode.(*MergeNode)
+		if !ok {
+			t.Errorf("scanTableExprs returned plannode error")
+		}
+		tbMaps := m.getReferTables()
+		assert.Equal(t, 3, len(tbMaps))
+		assert.True(t, tbMaps["D"].derived.pushed)
+		assert.False(t, tbMaps["E"].derived.pushed)
+		assert.Equal(t, 1, m.nonGlobalCnt)
+	}
 }
 
 func TestScanTableExprsList(t *testing.T) {
@@ -692,7 +711,7 @@ func TestScanTableExprsListErrorDebug(t *testing.T) {
 func TestScanTableExprsError(t *testing.T) {
 	querys := []string{
 		"select * from  C where C.id=1",
-		"select * from (select * from A) as D",
+		"select * from (select * from C) as D",
 		"select * from A natural join B",
 		"select * from A join B on A.id=B.id and id=1",
 		"select * from A join B on A.id=B.id and C.id=1",
@@ -708,7 +727,7 @@ func TestScanTableExprsError(t *testing.T) {
 	}
 	wants := []string{
 		"Table 'C' doesn't exist (errno 1146) (sqlstate 42S02)",
-		"unsupported: subquery.in.select",
+		"Table 'C' doesn't exist (errno 1146) (sqlstate 42S02)",
 		"unsupported: join.type:natural join",
 		"unsupported: unknown.column.'id'.in.clause",
 		"unsupported: unknown.column.'C.id'.in.clause",
@@ -743,7 +762,7 @@ func TestScanTableExprsError(t *testing.T) {
 
 func TestScanTableExprsListError(t *testing.T) {
 	querys := []string{
-		"select * from (select * from L) as L",
+		"select * from (select * from L join C on L.id=C.id) as L",
 		"select * from L natural join B",
 		"select * from A join L on A.id=L.id and id=1",
 		"select * from A join L on A.id=L.id and C.id=1",
@@ -757,7 +776,7 @@ func TestScanTableExprsListError(t *testing.T) {
 		"select * from L join A as L where L.id=1",
 	}
 	wants := []string{
-		"unsupported: subquery.in.select",
+		"Table 'C' doesn't exist (errno 1146) (sqlstate 42S02)",
 		"unsupported: join.type:natural join",
 		"unsupported: unknown.column.'id'.in.clause",
 		"unsupported: unknown.column.'C.id'.in.clause",
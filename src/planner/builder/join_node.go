@@ -475,6 +475,7 @@ func (j *JoinNode) calcRoute() (PlanNode, error) {
 func (j *JoinNode) pushSelectExprs(fields, groups []selectTuple, sel *sqlparser.Select, aggTyp aggrType) error {
 	j.reOrder(0)
 
+	visible := len(j.fields) + len(fields)
 	if len(groups) > 0 || aggTyp != nullAgg {
 		aggrPlan := NewAggregatePlan(j.log, sel.SelectExprs, fields, groups, false)
 		if err := aggrPlan.Build(); err != nil {
@@ -489,6 +490,9 @@ func (j *JoinNode) pushSelectExprs(fields, groups []selectTuple, sel *sqlparser.
 			return err
 		}
 	}
+	// The hidden columns are removed by the aggregate operator, the columns pushed
+	// later(such as the order by keys) are indexed after the removal.
+	j.fields = j.fields[:visible]
 
 	if err := j.handleOthers(); err != nil {
 		return err
@@ -54,6 +54,10 @@ type MergeNode struct {
 	ReqMode xcontext.RequestMode
 	// aliasIndex is the tmp col's alias index.
 	aliasIndex int
+	// windowed marks the window functions are evaluated by radon.
+	windowed bool
+	// derived are the materialized derived tables by the bind names.
+	derived map[string]*Derived
 }
 
 // newMergeNode used to create MergeNode.
@@ -143,6 +147,9 @@ func (m *MergeNode) addNoTableFilter(exprs []sqlparser.Expr) {
 func (m *MergeNode) calcRoute() (PlanNode, error) {
 	var err error
 	for _, tbInfo := range m.referTables {
+		if tbInfo.derived != nil {
+			continue
+		}
 		if m.nonGlobalCnt == 0 {
 			segments, err := m.router.Lookup(tbInfo.database, tbInfo.tableName, nil, nil)
 			if err != nil {
@@ -169,6 +176,24 @@ func (m *MergeNode) calcRoute() (PlanNode, error) {
 			m.routeLen = len(tbInfo.Segments)
 		}
 	}
+
+	// All the base tables are pushed into the derived tables, take the route of the
+	// pushed one, the node only refers to the materialized ones is sent to any backend.
+	if m.routeLen == 0 {
+		m.routeLen = 1
+		for _, tbInfo := range m.referTables {
+			if d := tbInfo.derived; d != nil && d.pushed {
+				inner := d.Root.(*MergeNode)
+				if m.backend == "" || inner.nonGlobalCnt > 0 {
+					m.backend = inner.backend
+					m.indexes = inner.indexes
+				}
+			}
+		}
+		if m.backend == "" {
+			m.ReqMode = xcontext.ReqSingle
+		}
+	}
 	return m, nil
 }
 
@@ -209,7 +234,22 @@ func (m *MergeNode) pushSelectExprs(fields, groups []selectTuple, sel *sqlparser
 		}
 		m.children = append(m.children, aggrPlan)
 		node.SelectExprs = aggrPlan.ReWritten()
+		node.GroupBy = append(node.GroupBy, aggrPlan.SketchGroupBy()...)
+	}
+	return nil
+}
+
+// pushWindows used to push the window functions which are evaluated by radon,
+// the shards only return the arguments and the partition by, order by keys.
+func (m *MergeNode) pushWindows(fields []selectTuple) error {
+	node := m.Sel.(*sqlparser.Select)
+	windowPlan := NewWindowPlan(m.log, node.SelectExprs, fields)
+	if err := windowPlan.Build(); err != nil {
+		return err
 	}
+	m.children = append(m.children, windowPlan)
+	node.SelectExprs = windowPlan.ReWritten()
+	m.windowed = true
 	return nil
 }
 
@@ -248,7 +288,8 @@ func (m *MergeNode) pushLimit(limit *sqlparser.Limit) error {
 		return err
 	}
 	m.children = append(m.children, limitPlan)
-	if len(m.Sel.(*sqlparser.Select).GroupBy) == 0 {
+	// The window functions need all the rows.
+	if len(m.Sel.(*sqlparser.Select).GroupBy) == 0 && !m.windowed {
 		// Rewrite the limit clause.
 		m.Sel.SetLimit(limitPlan.ReWritten())
 	}
@@ -277,9 +318,27 @@ func (m *MergeNode) Order() int {
 	return m.order
 }
 
+// route used to rewrite the shard tables' name to the i-th route, returns the backend and the range.
+func (m *MergeNode) route(i int) (string, string) {
+	var Range string
+	backend := m.backend
+	for _, tbInfo := range m.referTables {
+		if tbInfo.shardKey == "" {
+			continue
+		}
+		if backend == "" {
+			backend = tbInfo.Segments[i].Backend
+		}
+		Range = tbInfo.Segments[i].Range.String()
+		expr, _ := tbInfo.tableExpr.Expr.(sqlparser.TableName)
+		expr.Name = sqlparser.NewTableIdent(tbInfo.Segments[i].Table)
+		tbInfo.tableExpr.Expr = expr
+	}
+	return backend, Range
+}
+
 // buildQuery used to build the QueryTuple.
 func (m *MergeNode) buildQuery(root PlanNode) {
-	var Range string
 	tbInfos := root.getReferTables()
 	if sel, ok := m.Sel.(*sqlparser.Select); ok {
 		if len(sel.SelectExprs) == 0 {
@@ -288,11 +347,31 @@ func (m *MergeNode) buildQuery(root PlanNode) {
 		}
 	}
 
-	varFormatter := func(buf *sqlparser.TrackedBuffer, node sqlparser.SQLNode) {
+	for _, tbInfo := range m.referTables {
+		if tbInfo.derived != nil {
+			tbInfo.derived.buildQuery()
+		}
+	}
+
+	// inDerived marks the node is in a pushed derived table, whose columns are not join vars.
+	var inDerived int
+	var varFormatter func(buf *sqlparser.TrackedBuffer, node sqlparser.SQLNode)
+	varFormatter = func(buf *sqlparser.TrackedBuffer, node sqlparser.SQLNode) {
 		switch node := node.(type) {
+		case *sqlparser.Subquery:
+			if alias, d := m.findDerived(node); d != nil {
+				if d.pushed {
+					inDerived++
+					node.Format(buf)
+					inDerived--
+				} else {
+					buf.Myprintf("%a", ":"+m.bindDerived(alias, d))
+				}
+				return
+			}
 		case *sqlparser.ColName:
 			tableName := node.Qualifier.Name.String()
-			if tableName != "" {
+			if tableName != "" && inDerived == 0 {
 				if _, ok := m.referTables[tableName]; !ok {
 					// The lowest common ancestors node must be JoinNode.
 					// `m` in parent.Right, `tbInfos[tableName].parent` in left.
@@ -307,21 +386,7 @@ func (m *MergeNode) buildQuery(root PlanNode) {
 	}
 
 	for i := 0; i < m.routeLen; i++ {
-		// Rewrite the shard table's name.
-		backend := m.backend
-		for _, tbInfo := range m.referTables {
-			if tbInfo.shardKey == "" {
-				continue
-			}
-			if backend == "" {
-				backend = tbInfo.Segments[i].Backend
-			}
-			Range = tbInfo.Segments[i].Range.String()
-			expr, _ := tbInfo.tableExpr.Expr.(sqlparser.TableName)
-			expr.Name = sqlparser.NewTableIdent(tbInfo.Segments[i].Table)
-			tbInfo.tableExpr.Expr = expr
-		}
-
+		backend, Range := m.route(i)
 		buf := sqlparser.NewTrackedBuffer(varFormatter)
 		varFormatter(buf, m.Sel)
 		pq := buf.ParsedQuery()
@@ -345,11 +410,24 @@ func (m *MergeNode) GetQuery() []xcontext.QueryTuple {
 // This will be used on the RHS node to fetch field info if the LHS
 // returns no result.
 func (m *MergeNode) GenerateFieldQuery() *sqlparser.ParsedQuery {
-	formatter := func(buf *sqlparser.TrackedBuffer, node sqlparser.SQLNode) {
+	var inDerived int
+	var formatter func(buf *sqlparser.TrackedBuffer, node sqlparser.SQLNode)
+	formatter = func(buf *sqlparser.TrackedBuffer, node sqlparser.SQLNode) {
 		switch node := node.(type) {
+		case *sqlparser.Subquery:
+			if alias, d := m.findDerived(node); d != nil {
+				if d.pushed {
+					inDerived++
+					node.Format(buf)
+					inDerived--
+				} else {
+					buf.Myprintf("%a", ":"+m.bindDerived(alias, d))
+				}
+				return
+			}
 		case *sqlparser.ColName:
 			tableName := node.Qualifier.Name.String()
-			if tableName != "" {
+			if tableName != "" && inDerived == 0 {
 				if _, ok := m.referTables[tableName]; !ok {
 					buf.Myprintf("%a", ":"+node.Qualifier.Name.CompliantName()+"_"+node.Name.CompliantName())
 					return
@@ -363,3 +441,42 @@ func (m *MergeNode) GenerateFieldQuery() *sqlparser.ParsedQuery {
 	formatter(buf, m.Sel)
 	return buf.ParsedQuery()
 }
+
+// Derived returns the materialized derived tables by the bind names.
+func (m *MergeNode) Derived() map[string]*Derived {
+	return m.derived
+}
+
+// findDerived finds the derived table of the subquery node, including the ones in the pushed derived tables.
+func (m *MergeNode) findDerived(node *sqlparser.Subquery) (string, *Derived) {
+	for alias, tbInfo := range m.referTables {
+		d := tbInfo.derived
+		if d == nil {
+			continue
+		}
+		if tbInfo.tableExpr.Expr == sqlparser.SimpleTableExpr(node) {
+			return alias, d
+		}
+		if d.pushed {
+			if alias, d := d.Root.(*MergeNode).findDerived(node); d != nil {
+				return alias, d
+			}
+		}
+	}
+	return "", nil
+}
+
+// bindDerived returns the bind name of the materialized derived table.
+func (m *MergeNode) bindDerived(alias string, d *Derived) string {
+	if m.derived == nil {
+		m.derived = make(map[string]*Derived)
+	}
+	name := "derived_" + alias
+	for i := 1; ; i++ {
+		if old, ok := m.derived[name]; !ok || old == d {
+			m.derived[name] = d
+			return name
+		}
+		name = fmt.Sprintf("derived_%s_%d", alias, i)
+	}
+}
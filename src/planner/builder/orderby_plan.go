@@ -10,6 +10,7 @@ package builder
 
 import (
 	"encoding/json"
+	"fmt"
 
 	"github.com/pkg/errors"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
@@ -62,7 +63,7 @@ func NewOrderByPlan(log *xlog.Log, node sqlparser.OrderBy, root PlanNode) *Order
 // analyze used to check the 'order by' is at the support level.
 func (p *OrderByPlan) analyze() error {
 	tbInfos := p.root.getReferTables()
-	for _, o := range p.node {
+	for i, o := range p.node {
 		switch e := o.Expr.(type) {
 		case *sqlparser.ColName:
 			orderBy := OrderBy{}
@@ -117,10 +118,47 @@ func (p *OrderByPlan) analyze() error {
 				}
 			}
 			p.OrderBys = append(p.OrderBys, orderBy)
+		case *sqlparser.SQLVal:
+			// TODO: support order by 1,2.
+			return errors.Errorf("unsupported: orderby:[%+v].type.should.be.colname.or.expression", sqlparser.String(e))
 		default:
-			buf := sqlparser.NewTrackedBuffer(nil)
-			e.Format(buf)
-			return errors.Errorf("unsupported: orderby:[%+v].type.should.be.colname", buf.String())
+			orderBy := OrderBy{Direction: ASC}
+			if o.Direction == "desc" {
+				orderBy.Direction = DESC
+			}
+			field := sqlparser.String(e)
+			var tuple *selectTuple
+			for _, t := range p.root.getFields() {
+				if t.field == field {
+					tuple = &t
+					break
+				}
+			}
+			if tuple == nil {
+				if _, ok := p.root.(*UnionNode); ok {
+					return errors.Errorf("unsupported: unknown.column.'%s'.in.'order.clause'", field)
+				}
+				// The expression not in the select list is pushed as the hidden column, the alias is
+				// unique in the joined rows, such as:
+				// select a from t order by b*c -> select a, b * c as tmpo_0 from t order by b * c.
+				var err error
+				if tuple, err = parseHiddenExpr(e, tbInfos, "order.by"); err != nil {
+					return err
+				}
+				tuple.alias = fmt.Sprintf("tmpo_%d", i)
+				tuple.expr.(*sqlparser.AliasedExpr).As = sqlparser.NewColIdent(tuple.alias)
+				index, err := p.root.pushSelectExpr(*tuple)
+				if err != nil {
+					return err
+				}
+				p.RemovedIdxs = append(p.RemovedIdxs, index)
+			}
+
+			orderBy.Field = tuple.field
+			if tuple.alias != "" {
+				orderBy.Field = tuple.alias
+			}
+			p.OrderBys = append(p.OrderBys, orderBy)
 		}
 	}
 	return nil
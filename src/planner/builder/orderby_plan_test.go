@@ -62,14 +62,16 @@ func TestOrderByPlan(t *testing.T) {
 
 func TestOrderByPlanError(t *testing.T) {
 	querys := []string{
-		"select a,b from A order by rand()",
+		"select a,b from A order by 1",
 		"select A.* from A order by X.a",
 		"select A.a from A join B on A.id=B.id order by b",
+		"select a from A order by sum(b)",
 	}
 	results := []string{
-		"unsupported: orderby:[rand()].type.should.be.colname",
+		"unsupported: orderby:[1].type.should.be.colname.or.expression",
 		"unsupported: unknow.table.in.order.by.field[X.a]",
 		"unsupported: column.'b'.in.order.clause.is.ambiguous",
+		"unsupported: aggregation.in.order.by.clause[sum(b)]",
 	}
 
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
@@ -97,3 +99,68 @@ func TestOrderByPlanError(t *testing.T) {
 		}
 	}
 }
+
+func TestOrderByPlanExpr(t *testing.T) {
+	querys := []string{
+		"select a+1, b from A order by a+1 desc, b*c",
+		"select A.a from A join B on A.id=B.id order by A.a*2, B.b",
+	}
+	results := []string{
+		`{
+	"RemovedIdxs": [
+		2
+	],
+	"OrderBy(s)": [
+		{
+			"Field": "a + 1",
+			"Table": "",
+			"Direction": "DESC"
+		},
+		{
+			"Field": "tmpo_1",
+			"Table": "",
+			"Direction": "ASC"
+		}
+	]
+}`,
+		`{
+	"RemovedIdxs": [
+		1,
+		2
+	],
+	"OrderBy(s)": [
+		{
+			"Field": "tmpo_0",
+			"Table": "",
+			"Direction": "ASC"
+		},
+		{
+			"Field": "b",
+			"Table": "B",
+			"Direction": "ASC"
+		}
+	]
+}`,
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	err := route.CreateDatabase("sbtest")
+	assert.Nil(t, err)
+	err = route.AddForTest("sbtest", router.MockTableMConfig(), router.MockTableBConfig())
+	assert.Nil(t, err)
+	for i, query := range querys {
+		tree, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan, err := BuildNode(log, route, "sbtest", tree.(sqlparser.SelectStatement))
+		assert.Nil(t, err)
+		var got string
+		for _, child := range plan.Children() {
+			if child.Type() == ChildTypeOrderby {
+				got = child.JSON()
+			}
+		}
+		assert.Equal(t, results[i], got)
+	}
+}
@@ -10,11 +10,15 @@ package builder
 
 import (
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 
 	"router"
 
 	"github.com/pkg/errors"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 )
 
 // For example: select count(*), count(distinct x.a) as cstar, max(x.a) as mb, t.a as a1, x.b from t,x group by a1,b
@@ -36,6 +40,8 @@ type selectTuple struct {
 	//field in the aggregate function.
 	aggrField       string
 	distinct, isCol bool
+	// hidden marks the group by key which is not in the select list.
+	hidden bool
 }
 
 // parseSelectExpr parses the AliasedExpr to select tuple.
@@ -81,14 +87,18 @@ func parseSelectExpr(expr *sqlparser.AliasedExpr, tbInfos map[string]*tableInfo)
 			}
 			referTables = append(referTables, tableName)
 		case *sqlparser.FuncExpr:
-			distinct = node.Distinct
 			if node.IsAggregate() {
 				hasAggregates = true
 				if node != expr.Expr {
 					return false, errors.Errorf("unsupported: '%s'.contain.aggregate.in.select.exprs", field)
 				}
+				distinct = node.Distinct
 				funcName = node.Name.String()
-				if len(node.Exprs) != 1 {
+				args := 1
+				if node.Name.Lowered() == "approx_percentile" {
+					args = 2
+				}
+				if len(node.Exprs) != args {
 					return false, errors.Errorf("unsupported: invalid.use.of.group.function[%s]", funcName)
 				}
 				buf := sqlparser.NewTrackedBuffer(nil)
@@ -99,7 +109,20 @@ func parseSelectExpr(expr *sqlparser.AliasedExpr, tbInfos map[string]*tableInfo)
 				}
 			}
 		case *sqlparser.GroupConcatExpr:
-			return false, errors.Errorf("unsupported: group_concat.in.select.exprs")
+			hasAggregates = true
+			if node != expr.Expr {
+				return false, errors.Errorf("unsupported: '%s'.contain.aggregate.in.select.exprs", field)
+			}
+			distinct = node.Distinct != ""
+			funcName = "group_concat"
+			for _, order := range node.OrderBy {
+				if _, ok := order.Expr.(*sqlparser.SQLVal); ok {
+					return false, errors.Errorf("unsupported: group_concat.order.by.position")
+				}
+			}
+			buf := sqlparser.NewTrackedBuffer(nil)
+			node.Exprs.Format(buf)
+			aggrField = buf.String()
 		case *sqlparser.Subquery:
 			return false, errors.Errorf("unsupported: subqueries.in.select.exprs")
 		}
@@ -109,7 +132,7 @@ func parseSelectExpr(expr *sqlparser.AliasedExpr, tbInfos map[string]*tableInfo)
 		return nil, hasAggregates, err
 	}
 
-	return &selectTuple{expr, exprInfo{expr.Expr, referTables, cols, nil}, field, alias, funcName, aggrField, distinct, isCol}, hasAggregates, nil
+	return &selectTuple{expr, exprInfo{expr.Expr, referTables, cols, nil}, field, alias, funcName, aggrField, distinct, isCol, false}, hasAggregates, nil
 }
 
 func parseSelectExprs(exprs sqlparser.SelectExprs, root PlanNode) ([]selectTuple, aggrType, error) {
@@ -128,7 +151,7 @@ func parseSelectExprs(exprs sqlparser.SelectExprs, root PlanNode) ([]selectTuple
 			}
 			if hasAgg {
 				hasAggs = true
-				hasDist = hasDist || tuple.distinct
+				hasDist = hasDist || !canPushDown(tuple)
 			}
 			tuples = append(tuples, *tuple)
 		case *sqlparser.StarExpr:
@@ -176,6 +199,138 @@ func setAggregatorType(hasAggr, hasDist, isMergeNode bool) aggrType {
 	return nullAgg
 }
 
+// canPushDown returns true if the aggregate function can be computed on the shards and merged by the partial
+// results, the distinct ones and the group_concat with order by need all the rows.
+func canPushDown(tuple *selectTuple) bool {
+	if tuple.distinct {
+		return false
+	}
+	if expr, ok := tuple.expr.(*sqlparser.AliasedExpr).Expr.(*sqlparser.GroupConcatExpr); ok && len(expr.OrderBy) > 0 {
+		return false
+	}
+	return true
+}
+
+// checkDistinctAggrs used to check whether the aggregate functions which cannot be pushed down are all distinct on the
+// shard key, the values of the shard key are disjoint between the shards, so the aggregate functions can be pushed down.
+// such as: select count(distinct id), sum(distinct id) from t; -- id is the shard key.
+func checkDistinctAggrs(fields []selectTuple, router *router.Router, tbInfos map[string]*tableInfo) (aggrType, error) {
+	for i := range fields {
+		tuple := &fields[i]
+		if tuple.aggrFuc == "" || canPushDown(tuple) {
+			continue
+		}
+		if !tuple.distinct {
+			return notPush, nil
+		}
+
+		var arg sqlparser.SelectExprs
+		switch expr := tuple.expr.(*sqlparser.AliasedExpr).Expr.(type) {
+		case *sqlparser.FuncExpr:
+			arg = expr.Exprs
+		case *sqlparser.GroupConcatExpr:
+			if len(expr.OrderBy) > 0 {
+				return notPush, nil
+			}
+			arg = expr.Exprs
+		}
+		if len(arg) != 1 {
+			return notPush, nil
+		}
+		aliased, ok := arg[0].(*sqlparser.AliasedExpr)
+		if !ok {
+			return notPush, nil
+		}
+		col, ok := aliased.Expr.(*sqlparser.ColName)
+		if !ok {
+			return notPush, nil
+		}
+		table := col.Qualifier.Name.String()
+		if table == "" {
+			table, _ = getOneTableInfo(tbInfos)
+		}
+		isShard, err := checkShard(table, col.Name.String(), tbInfos, router)
+		if err != nil {
+			return notPush, err
+		}
+		if !isShard {
+			return notPush, nil
+		}
+	}
+	return canPush, nil
+}
+
+// hasApproxAggregates returns true if the select exprs contain the approximate aggregates,
+// they must be computed by radon even if the query can be pushed down.
+func hasApproxAggregates(exprs sqlparser.SelectExprs) bool {
+	has := false
+	sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		if fn, ok := node.(*sqlparser.FuncExpr); ok {
+			switch fn.Name.Lowered() {
+			case "approx_count_distinct", "approx_percentile":
+				has = true
+				return false, nil
+			}
+		}
+		return true, nil
+	}, exprs)
+	return has
+}
+
+// hasWindowFuncs returns true if the select exprs contain the window functions.
+func hasWindowFuncs(exprs sqlparser.SelectExprs) bool {
+	has := false
+	sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		if fn, ok := node.(*sqlparser.FuncExpr); ok && fn.IsWindow() {
+			has = true
+			return false, nil
+		}
+		return true, nil
+	}, exprs)
+	return has
+}
+
+// checkWindowFuncs used to check whether the window functions can be pushed down, that is,
+// the partition by of every window contains the shard key, otherwise they are evaluated by radon.
+func checkWindowFuncs(exprs sqlparser.SelectExprs, root PlanNode, router *router.Router) (bool, error) {
+	if _, ok := root.(*MergeNode); !ok {
+		return false, errors.New("unsupported: window.function.in.cross-shard.join")
+	}
+	tbInfos := root.getReferTables()
+	pushDown := true
+	err := sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		fn, ok := node.(*sqlparser.FuncExpr)
+		if !ok || !fn.IsWindow() {
+			return true, nil
+		}
+		partitioned := false
+		for _, e := range fn.Over.PartitionBy {
+			col, ok := e.(*sqlparser.ColName)
+			if !ok {
+				continue
+			}
+			table := col.Qualifier.Name.String()
+			if table == "" {
+				if len(tbInfos) != 1 {
+					continue
+				}
+				table, _ = getOneTableInfo(tbInfos)
+			}
+			isShardKey, err := checkShard(table, col.Name.String(), tbInfos, router)
+			if err != nil {
+				return false, err
+			}
+			if isShardKey {
+				partitioned = true
+				break
+			}
+		}
+		pushDown = pushDown && partitioned
+		return false, nil
+	}, exprs)
+	return pushDown, err
+}
+
 // checkIsWithNull used to check whether `tb.col is null` or `tb.col<=> null`.
 func checkIsWithNull(filter exprInfo, tbInfos map[string]*tableInfo) (bool, selectTuple) {
 	if !checkTbInNode(filter.referTables, tbInfos) {
@@ -237,32 +392,129 @@ func decomposeAvg(tuple *selectTuple) []*sqlparser.AliasedExpr {
 	if alias == "" {
 		alias = tuple.field
 	}
+	fn := tuple.expr.(*sqlparser.AliasedExpr).Expr.(*sqlparser.FuncExpr)
 	sum := &sqlparser.AliasedExpr{
 		Expr: &sqlparser.FuncExpr{
-			Name:  sqlparser.NewColIdent("sum"),
-			Exprs: tuple.expr.(*sqlparser.AliasedExpr).Expr.(*sqlparser.FuncExpr).Exprs,
+			Name:     sqlparser.NewColIdent("sum"),
+			Distinct: fn.Distinct,
+			Exprs:    fn.Exprs,
 		},
 		As: sqlparser.NewColIdent(alias),
 	}
 	count := &sqlparser.AliasedExpr{Expr: &sqlparser.FuncExpr{
-		Name:  sqlparser.NewColIdent("count"),
-		Exprs: tuple.expr.(*sqlparser.AliasedExpr).Expr.(*sqlparser.FuncExpr).Exprs,
+		Name:     sqlparser.NewColIdent("count"),
+		Distinct: fn.Distinct,
+		Exprs:    fn.Exprs,
 	}}
 	ret = append(ret, sum, count)
 	return ret
 }
 
+// decomposeVariance decomposes the stddev/variance family to count(a), sum(a) and sum(a*a).
+func decomposeVariance(tuple *selectTuple) []*sqlparser.AliasedExpr {
+	alias := tuple.alias
+	if alias == "" {
+		alias = tuple.field
+	}
+	exprs := tuple.expr.(*sqlparser.AliasedExpr).Expr.(*sqlparser.FuncExpr).Exprs
+	arg := exprs[0].(*sqlparser.AliasedExpr).Expr
+	if _, ok := arg.(*sqlparser.ColName); !ok {
+		arg = &sqlparser.ParenExpr{Expr: arg}
+	}
+	count := &sqlparser.AliasedExpr{
+		Expr: &sqlparser.FuncExpr{
+			Name:  sqlparser.NewColIdent("count"),
+			Exprs: exprs,
+		},
+		As: sqlparser.NewColIdent(alias),
+	}
+	sum := &sqlparser.AliasedExpr{Expr: &sqlparser.FuncExpr{
+		Name:  sqlparser.NewColIdent("sum"),
+		Exprs: exprs,
+	}}
+	sumsq := &sqlparser.AliasedExpr{Expr: &sqlparser.FuncExpr{
+		Name: sqlparser.NewColIdent("sum"),
+		Exprs: sqlparser.SelectExprs{&sqlparser.AliasedExpr{Expr: &sqlparser.BinaryExpr{
+			Operator: sqlparser.MultStr,
+			Left:     arg,
+			Right:    arg,
+		}}},
+	}}
+	return []*sqlparser.AliasedExpr{count, sum, sumsq}
+}
+
+// decomposeApproxCountDistinct decomposes approx_count_distinct(a) to the HyperLogLog registers, the rank of the
+// register and the register index computed from the md5 of a, the registers are grouped by the index.
+// such as: max(ifnull(48 - floor(log2(conv(substr(md5(a), 5, 12), 16, 10))), 49)) as `approx_count_distinct(a)`,
+// and the key: conv(left(md5(a), 4), 16, 10) >> 2.
+func decomposeApproxCountDistinct(tuple *selectTuple) (*sqlparser.AliasedExpr, []sqlparser.Expr, error) {
+	arg := sqlparser.String(tuple.expr.(*sqlparser.AliasedExpr).Expr.(*sqlparser.FuncExpr).Exprs[0])
+	rank := fmt.Sprintf("max(ifnull(%d - floor(log2(conv(substr(md5(%s), 5, %d), 16, 10))), %d))",
+		sqltypes.HLLRankBits, arg, sqltypes.HLLRankBits/4, sqltypes.HLLRankBits+1)
+	reg := fmt.Sprintf("conv(left(md5(%s), 4), 16, 10) >> %d", arg, 16-sqltypes.HLLPrecision)
+	return decomposeApprox(tuple, rank, reg)
+}
+
+// decomposeApproxPercentile decomposes approx_percentile(a, p) to the counts of the logarithmic buckets,
+// the buckets are grouped by the sign and the index.
+// such as: count(a) as `approx_percentile(a, 0.5)`, and the keys: sign(a), ceil(ln(abs(a)) / ln(gamma)).
+func decomposeApproxPercentile(tuple *selectTuple) (*sqlparser.AliasedExpr, []sqlparser.Expr, error) {
+	arg := sqlparser.String(tuple.expr.(*sqlparser.AliasedExpr).Expr.(*sqlparser.FuncExpr).Exprs[0])
+	count := fmt.Sprintf("count(%s)", arg)
+	sign := fmt.Sprintf("sign(%s)", arg)
+	index := fmt.Sprintf("ceil(ln(abs(%s)) / %s)", arg, strconv.FormatFloat(math.Log(sqltypes.QuantileGamma), 'g', -1, 64))
+	return decomposeApprox(tuple, count, sign, index)
+}
+
+func decomposeApprox(tuple *selectTuple, value string, keys ...string) (*sqlparser.AliasedExpr, []sqlparser.Expr, error) {
+	exprs := append([]string{value}, keys...)
+	stmt, err := sqlparser.Parse("select " + strings.Join(exprs, ", "))
+	if err != nil {
+		return nil, nil, err
+	}
+	alias := tuple.alias
+	if alias == "" {
+		alias = tuple.field
+	}
+
+	var ret []sqlparser.Expr
+	for _, expr := range stmt.(*sqlparser.Select).SelectExprs {
+		ret = append(ret, expr.(*sqlparser.AliasedExpr).Expr)
+	}
+	return &sqlparser.AliasedExpr{Expr: ret[0], As: sqlparser.NewColIdent(alias)}, ret[1:], nil
+}
+
 // decomposeAgg decomposes the aggregate function.
 // such as: avg(a) -> a as `avg(a)`.
+// group_concat(a, b) -> concat(a, b) as `group_concat(a, b)`.
 func decomposeAgg(tuple *selectTuple) *sqlparser.AliasedExpr {
 	var expr sqlparser.Expr
-	switch exp := tuple.expr.(*sqlparser.AliasedExpr).Expr.(*sqlparser.FuncExpr).Exprs[0].(type) {
-	case *sqlparser.StarExpr:
-		expr = sqlparser.NewIntVal([]byte("1"))
-	case *sqlparser.AliasedExpr:
-		expr = exp.Expr
-	case sqlparser.Nextval:
-		panic("unreachable")
+	var exprs sqlparser.SelectExprs
+	switch fn := tuple.expr.(*sqlparser.AliasedExpr).Expr.(type) {
+	case *sqlparser.FuncExpr:
+		exprs = fn.Exprs
+		if fn.Name.Lowered() == "approx_percentile" {
+			// The percentile is kept in the aggregator.
+			exprs = exprs[:1]
+		}
+	case *sqlparser.GroupConcatExpr:
+		exprs = fn.Exprs
+	}
+	if len(exprs) > 1 {
+		// The concat is NULL if any argument is NULL, which is skipped by group_concat.
+		expr = &sqlparser.FuncExpr{
+			Name:  sqlparser.NewColIdent("concat"),
+			Exprs: exprs,
+		}
+	} else {
+		switch exp := exprs[0].(type) {
+		case *sqlparser.StarExpr:
+			expr = sqlparser.NewIntVal([]byte("1"))
+		case *sqlparser.AliasedExpr:
+			expr = exp.Expr
+		case sqlparser.Nextval:
+			panic("unreachable")
+		}
 	}
 
 	alias := tuple.alias
@@ -317,51 +569,68 @@ func getMatchedField(fieldName string, colMap map[string]selectTuple) (selectTup
 }
 
 // checkGroupBy used to check groupby.
+// The group by key which is an expression or not in the select list is added as the hidden column, such as:
+// select count(*) from t group by date(c) -> select count(*), date(c) as tmpg_0 from t group by date(c).
 func checkGroupBy(exprs sqlparser.GroupBy, fields []selectTuple, router *router.Router, tbInfos map[string]*tableInfo, canOpt bool) ([]selectTuple, error) {
 	var groupTuples []selectTuple
 	hasShard := false
 	for _, expr := range exprs {
 		var group *selectTuple
-		// TODO: support group by 1,2.
-		col, ok := expr.(*sqlparser.ColName)
-		if !ok {
-			buf := sqlparser.NewTrackedBuffer(nil)
-			expr.Format(buf)
-			return nil, errors.Errorf("unsupported: group.by.[%s].type.should.be.colname", buf.String())
-		}
-		field := col.Name.String()
-		table := col.Qualifier.Name.String()
-		if table != "" {
-			if _, ok := tbInfos[table]; !ok {
-				return nil, errors.Errorf("unsupported: unknow.table.in.group.by.field[%s.%s]", table, field)
+		switch expr := expr.(type) {
+		case *sqlparser.ColName:
+			field := expr.Name.String()
+			table := expr.Qualifier.Name.String()
+			if table != "" {
+				if _, ok := tbInfos[table]; !ok {
+					return nil, errors.Errorf("unsupported: unknow.table.in.group.by.field[%s.%s]", table, field)
+				}
 			}
-		}
 
-		for _, tuple := range fields {
-			find := false
-			if table == "" && field == tuple.alias {
-				find = true
-			} else {
-				if tuple.isCol {
-					if field == tuple.field && (table == "" || table == tuple.info.referTables[0]) {
-						find = true
+			for _, tuple := range fields {
+				find := false
+				if table == "" && field == tuple.alias {
+					find = true
+				} else {
+					if tuple.isCol {
+						if field == tuple.field && (table == "" || table == tuple.info.referTables[0]) {
+							find = true
+						}
 					}
 				}
+				if find {
+					group = &tuple
+					break
+				}
 			}
-			if find {
-				group = &tuple
-				groupTuples = append(groupTuples, *group)
-				break
+			if group == nil && table == "" && len(tbInfos) > 1 {
+				return nil, errors.Errorf("unsupported: column.'%s'.in.group.by.clause.is.ambiguous", field)
+			}
+		case *sqlparser.SQLVal:
+			// TODO: support group by 1,2.
+			return nil, errors.Errorf("unsupported: group.by.[%s].type.should.be.colname.or.expression", sqlparser.String(expr))
+		default:
+			// The expression is in the select list, such as: select a+1 from t group by a+1.
+			field := sqlparser.String(expr)
+			for _, tuple := range fields {
+				if tuple.aggrFuc == "" && tuple.field == field {
+					group = &tuple
+					break
+				}
 			}
 		}
+
 		if group == nil {
-			if table != "" {
-				field = fmt.Sprintf("%s.%s", table, field)
+			tuple, err := parseHiddenExpr(expr, tbInfos, "group.by")
+			if err != nil {
+				return nil, err
 			}
-			return nil, errors.Errorf("unsupported: group.by.field[%s].should.be.in.select.list", field)
+			tuple.hidden = true
+			group = tuple
 		}
+		groupTuples = append(groupTuples, *group)
+
 		if canOpt && group.isCol && !hasShard {
-			table = group.info.referTables[0]
+			table := group.info.referTables[0]
 			var err error
 			// If fields contains shardkey, just push down the group by,
 			// neednot process groupby again. unsupport alias.
@@ -378,6 +647,22 @@ func checkGroupBy(exprs sqlparser.GroupBy, fields []selectTuple, router *router.
 	return groupTuples, nil
 }
 
+// parseHiddenExpr parses the group by or order by key which is not in the select list,
+// the key can't contain the aggregate function.
+func parseHiddenExpr(expr sqlparser.Expr, tbInfos map[string]*tableInfo, clause string) (*selectTuple, error) {
+	tuple, hasAggregates, err := parseSelectExpr(&sqlparser.AliasedExpr{Expr: expr}, tbInfos)
+	if err != nil {
+		return nil, err
+	}
+	if hasAggregates {
+		return nil, errors.Errorf("unsupported: aggregation.in.%s.clause[%s]", clause, tuple.field)
+	}
+	if hasWindowFuncs(sqlparser.SelectExprs{tuple.expr}) {
+		return nil, errors.Errorf("unsupported: window.function.in.%s.clause[%s]", clause, tuple.field)
+	}
+	return tuple, nil
+}
+
 // checkDistinct used to check the distinct, and convert distinct to groupby.
 func checkDistinct(node *sqlparser.Select, groups, fields []selectTuple, router *router.Router, tbInfos map[string]*tableInfo, canOpt bool) ([]selectTuple, error) {
 	// field in grouby must be contained in the select exprs, that mains groups is a subset of fields.
@@ -405,16 +690,23 @@ func checkDistinct(node *sqlparser.Select, groups, fields []selectTuple, router
 	}
 
 	// distinct convert to groupby.
-	for _, tuple := range fields {
+	for i, tuple := range fields {
 		expr, ok := tuple.expr.(*sqlparser.AliasedExpr)
-		if !ok {
+		if !ok || tuple.aggrFuc != "" {
 			return nil, errors.New("unsupported: distinct")
 		}
 		if expr.As.IsEmpty() {
-			if _, ok := expr.Expr.(*sqlparser.ColName); !ok {
-				return nil, errors.New("unsupported: distinct")
+			if _, ok := expr.Expr.(*sqlparser.ColName); ok {
+				node.GroupBy = append(node.GroupBy, expr.Expr)
+				continue
 			}
-			node.GroupBy = append(node.GroupBy, expr.Expr)
+			// The expression is grouped by the alias, such as:
+			// select distinct a+1 from t -> select a+1 as `a + 1` from t group by `a + 1`.
+			expr.As = sqlparser.NewColIdent(tuple.field)
+			fields[i].alias = tuple.field
+			node.GroupBy = append(node.GroupBy, &sqlparser.ColName{
+				Name: expr.As,
+			})
 		} else {
 			node.GroupBy = append(node.GroupBy, &sqlparser.ColName{
 				Name: expr.As,
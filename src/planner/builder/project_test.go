@@ -75,6 +75,9 @@ func TestCheckGroupBy(t *testing.T) {
 		"select A.id from A group by id",
 		"select id as a from A group by id",
 		"select id as a from A group by A.id",
+		"select a,b from A group by a,id",
+		"select a from A group by a+1,b",
+		"select A.a+1 from A,B group by A.a+1,B.b%2",
 	}
 	wants := []int{
 		1,
@@ -85,6 +88,9 @@ func TestCheckGroupBy(t *testing.T) {
 		0,
 		0,
 		0,
+		0,
+		2,
+		2,
 	}
 
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
@@ -120,12 +126,14 @@ func TestCheckGroupByError(t *testing.T) {
 	querys := []string{
 		"select a,b from A group by B.a",
 		"select a,b from A group by 1",
-		"select a,b from A group by a,id",
+		"select A.a from A,B group by b",
+		"select a from A group by count(b)",
 	}
 	wants := []string{
 		"unsupported: unknow.table.in.group.by.field[B.a]",
-		"unsupported: group.by.[1].type.should.be.colname",
-		"unsupported: group.by.field[id].should.be.in.select.list",
+		"unsupported: group.by.[1].type.should.be.colname.or.expression",
+		"unsupported: column.'b'.in.group.by.clause.is.ambiguous",
+		"unsupported: aggregation.in.group.by.clause[count(b)]",
 	}
 
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
@@ -162,11 +170,13 @@ func TestCheckDistinct(t *testing.T) {
 		"select distinct A.a,A.b as c from A",
 		"select distinct A.id from A",
 		"select distinct A.a,A.b,A.c from A group by a",
+		"select distinct A.a+1 as a, A.b*10 from A",
 	}
 	wants := []int{
 		2,
 		1,
 		1,
+		2,
 	}
 
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
@@ -201,7 +211,7 @@ func TestCheckDistinct(t *testing.T) {
 func TestCheckDistinctError(t *testing.T) {
 	querys := []string{
 		"select distinct * from A",
-		"select distinct A.a+1 as a, A.b*10 from A",
+		"select distinct count(A.a) from A",
 	}
 	wants := []string{
 		"unsupported: distinct",
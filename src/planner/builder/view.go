@@ -0,0 +1,103 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package builder
+
+import (
+	"config"
+	"router"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+/* scanView expands the reference of the view into a derived table, the tables in the
+ * definition are resolved in the database of the view.
+ * eg: create view v as select a from A; select * from v;
+ * to: select * from (select a from A) as v;
+ */
+func scanView(log *xlog.Log, r *router.Router, database string, tableExpr *sqlparser.AliasedTableExpr, view *config.ViewConfig) (PlanNode, error) {
+	stmt, err := sqlparser.Parse(view.Query)
+	if err != nil {
+		return nil, err
+	}
+	body, ok := stmt.(sqlparser.SelectStatement)
+	if !ok {
+		return nil, errors.Errorf("unsupported: view.'%s'.is.not.a.select", view.Name)
+	}
+	switch body := body.(type) {
+	case *sqlparser.Select:
+		if body.With != nil {
+			return nil, errors.New("unsupported: with.clause.in.view")
+		}
+	case *sqlparser.Union:
+		if body.With != nil {
+			return nil, errors.New("unsupported: with.clause.in.view")
+		}
+	}
+
+	columns := make(sqlparser.Columns, 0, len(view.Columns))
+	for _, column := range view.Columns {
+		columns = append(columns, sqlparser.NewColIdent(column))
+	}
+	if err := renameColumns(body, "view", view.Name, columns); err != nil {
+		return nil, err
+	}
+
+	if tableExpr.As.IsEmpty() {
+		tableExpr.As = sqlparser.NewTableIdent(view.Name)
+	}
+	tableExpr.Expr = &sqlparser.Subquery{Select: body}
+	return scanAliasedTableExpr(log, r, database, tableExpr)
+}
+
+// CheckView used to check the definition of the view before it's stored, the view can't refer to
+// itself directly or indirectly, and the definition must be planned.
+func CheckView(log *xlog.Log, r *router.Router, database string, view *config.ViewConfig) error {
+	stmt, err := sqlparser.Parse(view.Query)
+	if err != nil {
+		return err
+	}
+	if err := checkViewRecursion(r, database, database, view.Name, stmt); err != nil {
+		return err
+	}
+	_, err = scanView(log, r, database, &sqlparser.AliasedTableExpr{}, view)
+	return err
+}
+
+// checkViewRecursion returns error if the node refers to the view db.name, the views referred
+// by the node are checked recursively.
+func checkViewRecursion(r *router.Router, database, db, name string, node sqlparser.SQLNode) error {
+	return sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		expr, ok := node.(*sqlparser.AliasedTableExpr)
+		if !ok {
+			return true, nil
+		}
+		tb, ok := expr.Expr.(sqlparser.TableName)
+		if !ok {
+			return true, nil
+		}
+		qualifier := database
+		if !tb.Qualifier.IsEmpty() {
+			qualifier = tb.Qualifier.String()
+		}
+		if qualifier == db && tb.Name.String() == name {
+			return false, errors.Errorf("view.'%s.%s'.contains.view.recursion", db, name)
+		}
+		view := r.View(qualifier, tb.Name.String())
+		if view == nil {
+			return true, nil
+		}
+		stmt, err := sqlparser.Parse(view.Query)
+		if err != nil {
+			return false, err
+		}
+		return false, checkViewRecursion(r, qualifier, db, name, stmt)
+	}, node)
+}
@@ -0,0 +1,166 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package builder
+
+import (
+	"testing"
+
+	"config"
+	"router"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestView(t *testing.T) {
+	querys := []string{
+		"select * from v1",
+		"select x from sbtest.v1 where x > 1",
+		"select v.x, A.b from v1 as v join A on v.x=A.a where A.id=1",
+		"select * from v2",
+		"select * from v3",
+	}
+	wants := []string{
+		"select * from (select a as x from sbtest.A6 as A where id = 1) as v1",
+		"select x from (select a as x from sbtest.A6 as A where id = 1) as v1 where x > 1",
+		"select v.x, A.b from (select a as x from sbtest.A6 as A where id = 1) as v join sbtest.A6 as A on v.x = A.a where A.id = 1",
+		"select * from (select * from sbtest.G) as v2",
+		"select * from (select * from (select * from sbtest.G) as v2 join sbtest.G on v2.a = G.a) as v3",
+	}
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	err := route.CreateDatabase("sbtest")
+	assert.Nil(t, err)
+	err = route.AddForTest("sbtest", router.MockTableMConfig(), router.MockTableGConfig())
+	assert.Nil(t, err)
+	views := []*config.ViewConfig{
+		{Name: "v1", Columns: []string{"x"}, Query: "select a from A where id = 1"},
+		{Name: "v2", Query: "select * from G"},
+		{Name: "v3", Query: "select * from v2 join G on v2.a = G.a"},
+	}
+	for _, view := range views {
+		err = route.CreateView("sbtest", view, false)
+		assert.Nil(t, err)
+	}
+
+	for i, query := range querys {
+		tree, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan, err := BuildNode(log, route, "sbtest", tree.(sqlparser.SelectStatement))
+		assert.Nil(t, err, query)
+		m := plan.(*MergeNode)
+		assert.Equal(t, 1, len(m.Querys))
+		assert.Equal(t, wants[i], m.Querys[0].Query)
+	}
+
+	// The tables of the view are resolved in the database of the view.
+	{
+		err := route.CreateDatabase("other")
+		assert.Nil(t, err)
+		tree, err := sqlparser.Parse("select * from sbtest.v2")
+		assert.Nil(t, err)
+		plan, err := BuildNode(log, route, "other", tree.(sqlparser.SelectStatement))
+		assert.Nil(t, err)
+		assert.Equal(t, "select * from (select * from sbtest.G) as v2", plan.(*MergeNode).Querys[0].Query)
+	}
+}
+
+func TestViewError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	err := route.CreateDatabase("sbtest")
+	assert.Nil(t, err)
+	err = route.AddForTest("sbtest", router.MockTableMConfig())
+	assert.Nil(t, err)
+	views := []*config.ViewConfig{
+		{Name: "v1", Columns: []string{"x"}, Query: "select * from A"},
+		{Name: "v2", Columns: []string{"x", "y"}, Query: "select a from A"},
+		{Name: "v3", Query: "with t as (select a from A) select * from t"},
+		{Name: "v4", Query: "select a from B"},
+	}
+	for _, view := range views {
+		err = route.CreateView("sbtest", view, false)
+		assert.Nil(t, err)
+	}
+
+	querys := []string{
+		"select * from v1",
+		"select * from v2",
+		"select * from v3",
+		"select * from v4",
+	}
+	wants := []string{
+		"unsupported: view.'v1'.column.list.with.'*'",
+		"unsupported: view.'v2'.has.a.different.number.of.columns",
+		"unsupported: with.clause.in.view",
+		"Table 'B' doesn't exist (errno 1146) (sqlstate 42S02)",
+	}
+	for i, query := range querys {
+		tree, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		_, err = BuildNode(log, route, "sbtest", tree.(sqlparser.SelectStatement))
+		assert.NotNil(t, err, query)
+		if err != nil {
+			assert.Equal(t, wants[i], err.Error(), query)
+		}
+	}
+}
+
+func TestCheckView(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	err := route.CreateDatabase("sbtest")
+	assert.Nil(t, err)
+	err = route.AddForTest("sbtest", router.MockTableMConfig())
+	assert.Nil(t, err)
+	err = route.CreateView("sbtest", &config.ViewConfig{Name: "v1", Query: "select a from A"}, false)
+	assert.Nil(t, err)
+	err = route.CreateView("sbtest", &config.ViewConfig{Name: "v2", Query: "select v1.a from v1"}, false)
+	assert.Nil(t, err)
+
+	tcases := []struct {
+		view *config.ViewConfig
+		err  string
+	}{
+		{
+			view: &config.ViewConfig{Name: "v3", Query: "select x.a from A as x join v2 as x1 on x.a = x1.a"},
+		},
+		{
+			view: &config.ViewConfig{Name: "v1", Query: "select * from v2"},
+			err:  "view.'sbtest.v1'.contains.view.recursion",
+		},
+		{
+			view: &config.ViewConfig{Name: "v1", Query: "select * from (select * from sbtest.v1) as t"},
+			err:  "view.'sbtest.v1'.contains.view.recursion",
+		},
+		{
+			view: &config.ViewConfig{Name: "v3", Columns: []string{"x", "y"}, Query: "select a from A"},
+			err:  "unsupported: view.'v3'.has.a.different.number.of.columns",
+		},
+		{
+			view: &config.ViewConfig{Name: "v3", Query: "select a from B"},
+			err:  "Table 'B' doesn't exist (errno 1146) (sqlstate 42S02)",
+		},
+	}
+	for _, tcase := range tcases {
+		err := CheckView(log, route, "sbtest", tcase.view)
+		if tcase.err == "" {
+			assert.Nil(t, err, tcase.view.Query)
+		} else {
+			assert.NotNil(t, err, tcase.view.Query)
+			if err != nil {
+				assert.Equal(t, tcase.err, err.Error())
+			}
+		}
+	}
+}
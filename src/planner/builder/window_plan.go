@@ -0,0 +1,259 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/common"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+var (
+	_ ChildPlan = &WindowPlan{}
+)
+
+// WindowType type.
+type WindowType string
+
+const (
+	// WindowTypeRowNumber enum.
+	WindowTypeRowNumber WindowType = "ROW_NUMBER"
+
+	// WindowTypeRank enum.
+	WindowTypeRank WindowType = "RANK"
+
+	// WindowTypeDenseRank enum.
+	WindowTypeDenseRank WindowType = "DENSE_RANK"
+
+	// WindowTypeLag enum.
+	WindowTypeLag WindowType = "LAG"
+
+	// WindowTypeLead enum.
+	WindowTypeLead WindowType = "LEAD"
+
+	// WindowTypeAggregate enum, SUM/COUNT/AVG/MIN/MAX OVER.
+	WindowTypeAggregate WindowType = "AGGREGATE"
+)
+
+// WindowOrder is the order by key of the window, the key is in the column Index.
+type WindowOrder struct {
+	Index int
+	Desc  bool
+}
+
+// WindowFunc tuple.
+type WindowFunc struct {
+	Field string
+	Index int
+	Type  WindowType
+	// Aggregate is the aggregate type of the WindowTypeAggregate.
+	Aggregate sqltypes.AggrType `json:",omitempty"`
+	// Offset and Default are the lag/lead arguments, Default is the
+	// column of the default value, -1 means NULL.
+	Offset  int `json:",omitempty"`
+	Default int
+	// Partitions and Orders are the columns of the partition by and order by keys.
+	Partitions []int         `json:",omitempty"`
+	Orders     []WindowOrder `json:",omitempty"`
+}
+
+// WindowPlan represents window plan, the window functions are evaluated by radon
+// over the rows which are fetched from all the shards.
+type WindowPlan struct {
+	log       *xlog.Log
+	tuples    []selectTuple
+	rewritten sqlparser.SelectExprs
+
+	Windows []WindowFunc
+	// RemovedIdxs are the hidden partition by, order by and default columns.
+	RemovedIdxs []int
+
+	// type
+	typ ChildType
+}
+
+// NewWindowPlan used to create WindowPlan.
+func NewWindowPlan(log *xlog.Log, exprs sqlparser.SelectExprs, tuples []selectTuple) *WindowPlan {
+	return &WindowPlan{
+		log:       log,
+		tuples:    tuples,
+		rewritten: exprs,
+		typ:       ChildTypeWindow,
+	}
+}
+
+// analyze used to check the window functions are at the support level.
+// Supports:
+// ROW_NUMBER/RANK/DENSE_RANK/LAG/LEAD/SUM/COUNT/AVG/MIN/MAX OVER (PARTITION BY ... ORDER BY ...)
+// The window function is rewritten to its argument(NULL for the ranking functions), the partition by
+// and order by keys are fetched as the hidden columns.
+func (p *WindowPlan) analyze() error {
+	keys := make(map[string]int)
+	hidden := func(expr sqlparser.Expr) int {
+		field := sqlparser.String(expr)
+		if idx, ok := keys[field]; ok {
+			return idx
+		}
+		alias := fmt.Sprintf("tmpw_%d", len(keys))
+		p.rewritten = append(p.rewritten, &sqlparser.AliasedExpr{Expr: expr, As: sqlparser.NewColIdent(alias)})
+		idx := len(p.rewritten) - 1
+		keys[field] = idx
+		p.RemovedIdxs = append(p.RemovedIdxs, idx)
+		return idx
+	}
+
+	for i, tuple := range p.tuples {
+		if tuple.field == "*" {
+			return errors.Errorf("unsupported: exists.window.function.and.'*'.select.exprs")
+		}
+		fn, err := windowFunc(tuple)
+		if err != nil {
+			return err
+		}
+		if fn == nil {
+			continue
+		}
+
+		var arg sqlparser.Expr = &sqlparser.NullVal{}
+		win := WindowFunc{Field: tuple.field, Index: i, Default: -1}
+		name := fn.Name.Lowered()
+		switch name {
+		case "row_number", "rank", "dense_rank":
+			if len(fn.Exprs) != 0 {
+				return errors.Errorf("unsupported: invalid.use.of.window.function[%s]", tuple.field)
+			}
+			win.Type = WindowType(strings.ToUpper(name))
+		case "lag", "lead":
+			if len(fn.Exprs) < 1 || len(fn.Exprs) > 3 {
+				return errors.Errorf("unsupported: invalid.use.of.window.function[%s]", tuple.field)
+			}
+			win.Type = WindowType(strings.ToUpper(name))
+			win.Offset = 1
+			exprs := make([]sqlparser.Expr, len(fn.Exprs))
+			for j, e := range fn.Exprs {
+				aliased, ok := e.(*sqlparser.AliasedExpr)
+				if !ok {
+					return errors.Errorf("unsupported: invalid.use.of.window.function[%s]", tuple.field)
+				}
+				exprs[j] = aliased.Expr
+			}
+			arg = exprs[0]
+			if len(exprs) > 1 {
+				val, ok := exprs[1].(*sqlparser.SQLVal)
+				if !ok || val.Type != sqlparser.IntVal {
+					return errors.Errorf("unsupported: %s.offset.must.be.a.non-negative.integer", name)
+				}
+				offset, err := strconv.Atoi(common.BytesToString(val.Val))
+				if err != nil {
+					return errors.Errorf("unsupported: %s.offset.must.be.a.non-negative.integer", name)
+				}
+				win.Offset = offset
+			}
+			if len(exprs) > 2 {
+				win.Default = hidden(exprs[2])
+			}
+		case "sum", "count", "avg", "min", "max":
+			if len(fn.Exprs) != 1 || fn.Distinct {
+				return errors.Errorf("unsupported: invalid.use.of.window.function[%s]", tuple.field)
+			}
+			win.Type = WindowTypeAggregate
+			win.Aggregate = sqltypes.AggrType(strings.ToUpper(name))
+			switch e := fn.Exprs[0].(type) {
+			case *sqlparser.StarExpr:
+				if name != "count" {
+					return errors.Errorf("unsupported: syntax.error.at.'%s'", tuple.field)
+				}
+				arg = sqlparser.NewIntVal([]byte("1"))
+			case *sqlparser.AliasedExpr:
+				arg = e.Expr
+			}
+		default:
+			return errors.Errorf("unsupported: window.function:%s", name)
+		}
+
+		for _, e := range fn.Over.PartitionBy {
+			win.Partitions = append(win.Partitions, hidden(e))
+		}
+		for _, o := range fn.Over.OrderBy {
+			if _, ok := o.Expr.(*sqlparser.SQLVal); ok {
+				return errors.Errorf("unsupported: window.order.by.position")
+			}
+			win.Orders = append(win.Orders, WindowOrder{Index: hidden(o.Expr), Desc: o.Direction == sqlparser.DescScr})
+		}
+
+		alias := tuple.alias
+		if alias == "" {
+			alias = tuple.field
+		}
+		p.rewritten[i] = &sqlparser.AliasedExpr{Expr: arg, As: sqlparser.NewColIdent(alias)}
+		p.Windows = append(p.Windows, win)
+	}
+	return nil
+}
+
+// windowFunc returns the window function of the tuple, nil if not.
+// The window function must be the whole select expression.
+func windowFunc(tuple selectTuple) (*sqlparser.FuncExpr, error) {
+	expr, ok := tuple.expr.(*sqlparser.AliasedExpr)
+	if !ok {
+		return nil, nil
+	}
+	var fn *sqlparser.FuncExpr
+	err := sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		if f, ok := node.(*sqlparser.FuncExpr); ok && f.IsWindow() {
+			if f != expr.Expr {
+				return false, errors.Errorf("unsupported: '%s'.contain.window.function.in.select.exprs", tuple.field)
+			}
+			fn = f
+			return false, nil
+		}
+		return true, nil
+	}, expr.Expr)
+	return fn, err
+}
+
+// Build used to build distributed querys.
+func (p *WindowPlan) Build() error {
+	return p.analyze()
+}
+
+// Type returns the type of the plan.
+func (p *WindowPlan) Type() ChildType {
+	return p.typ
+}
+
+// JSON returns the plan info.
+func (p *WindowPlan) JSON() string {
+	type windows struct {
+		Windows   []WindowFunc
+		ReWritten string
+	}
+	w := &windows{Windows: p.Windows}
+	buf := sqlparser.NewTrackedBuffer(nil)
+	buf.Myprintf("%v", p.rewritten)
+	w.ReWritten = buf.String()
+
+	bout, err := json.MarshalIndent(w, "", "\t")
+	if err != nil {
+		return err.Error()
+	}
+	return string(bout)
+}
+
+// ReWritten used to re-write the SelectExprs clause.
+func (p *WindowPlan) ReWritten() sqlparser.SelectExprs {
+	return p.rewritten
+}
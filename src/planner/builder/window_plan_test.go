@@ -0,0 +1,194 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package builder
+
+import (
+	"testing"
+
+	"router"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestWindowPlan(t *testing.T) {
+	querys := []string{
+		"select a, row_number() over (partition by b order by c desc) as rn, lag(c, 2, 0) over (partition by b order by c desc) from A order by rn limit 1",
+		"select a, sum(c) over (order by a), count(*) over () as cnt, dense_rank() over (order by a) from A",
+	}
+	results := []string{
+		`{
+	"Windows": [
+		{
+			"Field": "row_number() over (partition by b order by c desc)",
+			"Index": 1,
+			"Type": "ROW_NUMBER",
+			"Default": -1,
+			"Partitions": [
+				3
+			],
+			"Orders": [
+				{
+					"Index": 4,
+					"Desc": true
+				}
+			]
+		},
+		{
+			"Field": "lag(c, 2, 0) over (partition by b order by c desc)",
+			"Index": 2,
+			"Type": "LAG",
+			"Offset": 2,
+			"Default": 5,
+			"Partitions": [
+				3
+			],
+			"Orders": [
+				{
+					"Index": 4,
+					"Desc": true
+				}
+			]
+		}
+	],
+	"ReWritten": "a, null as rn, c as ` + "`lag(c, 2, 0) over (partition by b order by c desc)`" + `, b as tmpw_0, c as tmpw_1, 0 as tmpw_2"
+}`,
+		`{
+	"Windows": [
+		{
+			"Field": "sum(c) over (order by a asc)",
+			"Index": 1,
+			"Type": "AGGREGATE",
+			"Aggregate": "SUM",
+			"Default": -1,
+			"Orders": [
+				{
+					"Index": 4,
+					"Desc": false
+				}
+			]
+		},
+		{
+			"Field": "count(*) over ()",
+			"Index": 2,
+			"Type": "AGGREGATE",
+			"Aggregate": "COUNT",
+			"Default": -1
+		},
+		{
+			"Field": "dense_rank() over (order by a asc)",
+			"Index": 3,
+			"Type": "DENSE_RANK",
+			"Default": -1,
+			"Orders": [
+				{
+					"Index": 4,
+					"Desc": false
+				}
+			]
+		}
+	],
+	"ReWritten": "a, c as ` + "`sum(c) over (order by a asc)`" + `, 1 as cnt, null as ` + "`dense_rank() over (order by a asc)`" + `, a as tmpw_0"
+}`,
+	}
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	err := route.CreateDatabase("sbtest")
+	assert.Nil(t, err)
+	err = route.AddForTest("sbtest", router.MockTableMConfig())
+	assert.Nil(t, err)
+	for i, query := range querys {
+		tree, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan, err := BuildNode(log, route, "sbtest", tree.(sqlparser.SelectStatement))
+		assert.Nil(t, err)
+		var got string
+		for _, child := range plan.Children() {
+			if child.Type() == ChildTypeWindow {
+				got = child.JSON()
+			}
+		}
+		assert.Equal(t, results[i], got)
+		log.Debug("%s", got)
+	}
+}
+
+// TestWindowPlanPushDown tests the windows partitioned by the shard key are pushed down.
+func TestWindowPlanPushDown(t *testing.T) {
+	querys := []string{
+		"select a, row_number() over (partition by id order by a) as rn from A limit 1",
+		"select a, sum(b) over (partition by A.id, a) from A group by id, a",
+	}
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	err := route.CreateDatabase("sbtest")
+	assert.Nil(t, err)
+	err = route.AddForTest("sbtest", router.MockTableMConfig())
+	assert.Nil(t, err)
+	for _, query := range querys {
+		tree, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan, err := BuildNode(log, route, "sbtest", tree.(sqlparser.SelectStatement))
+		assert.Nil(t, err)
+		for _, child := range plan.Children() {
+			assert.NotEqual(t, ChildTypeWindow, child.Type())
+		}
+		m := plan.(*MergeNode)
+		assert.Contains(t, sqlparser.String(m.Sel), " over (partition by ")
+	}
+}
+
+func TestWindowPlanError(t *testing.T) {
+	querys := []string{
+		"select row_number() over (order by a) + 1 from A",
+		"select *, rank() over (order by a) from A",
+		"select ntile(2) over (order by a) from A",
+		"select row_number(a) over () from A",
+		"select lag(a, b) over (order by a) from A",
+		"select avg(*) over () from A",
+		"select row_number() over (order by 1) from A",
+		"select a, count(a), row_number() over () from A group by a",
+		"select count(a), row_number() over (partition by id) from A",
+		"select A.a, row_number() over (partition by A.a) from A join B on A.a=B.a",
+		"select a from A order by row_number() over ()",
+	}
+	results := []string{
+		"unsupported: 'row_number() over (order by a asc) + 1'.contain.window.function.in.select.exprs",
+		"unsupported: exists.window.function.and.'*'.select.exprs",
+		"unsupported: window.function:ntile",
+		"unsupported: invalid.use.of.window.function[row_number(a) over ()]",
+		"unsupported: lag.offset.must.be.a.non-negative.integer",
+		"unsupported: syntax.error.at.'avg(*) over ()'",
+		"unsupported: window.order.by.position",
+		"unsupported: window.function.with.cross-shard.aggregation",
+		"unsupported: window.function.with.cross-shard.aggregation",
+		"unsupported: window.function.in.cross-shard.join",
+		"unsupported: window.function.in.order.by.clause[row_number() over ()]",
+	}
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	err := route.CreateDatabase("sbtest")
+	assert.Nil(t, err)
+	err = route.AddForTest("sbtest", router.MockTableMConfig(), router.MockTableBConfig())
+	assert.Nil(t, err)
+	for i, query := range querys {
+		tree, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		_, err = BuildNode(log, route, "sbtest", tree.(sqlparser.SelectStatement))
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		assert.Equal(t, results[i], got, query)
+	}
+}
@@ -0,0 +1,302 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package builder
+
+import (
+	"router"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// cte represents a common table expression in the WITH clause.
+type cte struct {
+	name    string
+	columns sqlparser.Columns
+	// sql is the definition, which is re-parsed for every inlined reference.
+	sql string
+	// scope is the common table expressions visible in the definition.
+	scope []*cte
+	// derived is the materialized derived table, nil if the cte is inlined.
+	derived *Derived
+}
+
+// withScope used to expand the common table expressions of the WITH clause.
+type withScope struct {
+	log      *xlog.Log
+	router   *router.Router
+	database string
+	ctes     []*cte
+	// links are the placeholders of the materialized ctes, which are linked after planned.
+	links map[*sqlparser.Subquery]*Derived
+}
+
+/* expandWith expands the WITH clause, the references of the ctes are replaced by the derived tables.
+ * If the cte can be pushed down to one backend(all the tables are on the same shard or are global tables),
+ * the reference is replaced by a copy of the definition, otherwise the cte is planned once and materialized
+ * by radon, the reference is replaced by a placeholder which is linked to the materialized one.
+ * eg: with t as (select a from A where id=1) select * from t;
+ * to: select * from (select a from A where id=1) as t;
+ */
+func expandWith(log *xlog.Log, router *router.Router, database string, node sqlparser.SelectStatement) (map[*sqlparser.Subquery]*Derived, error) {
+	var with *sqlparser.With
+	switch node := node.(type) {
+	case *sqlparser.Select:
+		with, node.With = node.With, nil
+	case *sqlparser.Union:
+		with, node.With = node.With, nil
+	}
+	if with == nil {
+		return nil, nil
+	}
+
+	s := &withScope{
+		log:      log,
+		router:   router,
+		database: database,
+		links:    make(map[*sqlparser.Subquery]*Derived),
+	}
+	for _, def := range with.CTEs {
+		if err := s.define(def, with.Recursive); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.resolve(node, s.ctes); err != nil {
+		return nil, err
+	}
+	return s.links, nil
+}
+
+// define used to define the cte, and decide whether it's inlined or materialized.
+func (s *withScope) define(def *sqlparser.CommonTableExpr, recursive bool) error {
+	name := def.Name.String()
+	if lookupCTE(s.ctes, name) != nil {
+		return errors.Errorf("unsupported: not.unique.table.or.alias:'%s'", name)
+	}
+	c := &cte{
+		name:    name,
+		columns: def.Columns,
+		sql:     sqlparser.String(def.Select),
+		scope:   s.ctes,
+	}
+	if recursive && refersTo(def.Select, name) {
+		return s.defineRecursive(c)
+	}
+
+	body, err := s.inline(c)
+	if err != nil {
+		return err
+	}
+	root, err := processPart(s.log, s.router, s.database, body)
+	if err != nil {
+		return err
+	}
+	if !pushable(root) {
+		linkDerived(root, s.links)
+		c.derived = &Derived{Name: name, Root: root}
+	}
+	s.ctes = append(s.ctes, c)
+	return nil
+}
+
+// defineRecursive used to define the recursive cte, which must be the UNION of the anchor part and the
+// recursive part, and only refers to the global tables. The recursive part is executed by radon
+// iteratively over the rows of the last iteration, until no new rows are produced.
+func (s *withScope) defineRecursive(c *cte) error {
+	stmt, err := sqlparser.Parse(c.sql)
+	if err != nil {
+		return err
+	}
+	union, ok := stmt.(*sqlparser.Union)
+	if !ok || len(union.OrderBy) > 0 || union.Limit != nil || refersTo(union.Left, c.name) {
+		return errors.Errorf("unsupported: recursive.cte.'%s'.must.be.the.union.of.anchor.and.recursive.part", c.name)
+	}
+	if err := renameColumns(union, "cte", c.name, c.columns); err != nil {
+		return err
+	}
+
+	self := &Derived{Name: c.name}
+	scope := append(c.scope[:len(c.scope):len(c.scope)], &cte{name: c.name, derived: self})
+	if err := s.resolve(union.Left, c.scope); err != nil {
+		return err
+	}
+	if err := s.resolve(union.Right, scope); err != nil {
+		return err
+	}
+	if err := s.checkGlobal(c.name, union); err != nil {
+		return err
+	}
+
+	anchor, err := processPart(s.log, s.router, s.database, union.Left)
+	if err != nil {
+		return err
+	}
+	recursive, err := processPart(s.log, s.router, s.database, union.Right)
+	if err != nil {
+		return err
+	}
+	linkDerived(anchor, s.links)
+	linkDerived(recursive, s.links)
+	c.derived = &Derived{
+		Name:      c.name,
+		Anchor:    anchor,
+		Recursive: recursive,
+		Self:      self,
+		Distinct:  union.Type != sqlparser.UnionAllStr,
+	}
+	s.ctes = append(s.ctes, c)
+	return nil
+}
+
+// inline returns a copy of the cte definition, the references of the other ctes in it are resolved.
+func (s *withScope) inline(c *cte) (sqlparser.SelectStatement, error) {
+	stmt, err := sqlparser.Parse(c.sql)
+	if err != nil {
+		return nil, err
+	}
+	body := stmt.(sqlparser.SelectStatement)
+	if err := renameColumns(body, "cte", c.name, c.columns); err != nil {
+		return nil, err
+	}
+	if err := s.resolve(body, c.scope); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// resolve replaces the references of the ctes in the node by the derived tables.
+func (s *withScope) resolve(node sqlparser.SQLNode, scope []*cte) error {
+	return sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		switch node := node.(type) {
+		case *sqlparser.Select:
+			if node.With != nil {
+				return false, errors.New("unsupported: nested.with.clause")
+			}
+		case *sqlparser.Union:
+			if node.With != nil {
+				return false, errors.New("unsupported: nested.with.clause")
+			}
+		case *sqlparser.AliasedTableExpr:
+			tb, ok := node.Expr.(sqlparser.TableName)
+			if !ok || !tb.Qualifier.IsEmpty() {
+				return true, nil
+			}
+			c := lookupCTE(scope, tb.Name.String())
+			if c == nil {
+				return true, nil
+			}
+			if node.As.IsEmpty() {
+				node.As = tb.Name
+			}
+			sub := &sqlparser.Subquery{}
+			if c.derived != nil {
+				sub.Select = placeholder()
+				s.links[sub] = c.derived
+			} else if sub.Select, err = s.inline(c); err != nil {
+				return false, err
+			}
+			node.Expr = sub
+			return false, nil
+		}
+		return true, nil
+	}, node)
+}
+
+// checkGlobal used to check all the tables of the recursive cte are global tables.
+func (s *withScope) checkGlobal(name string, node sqlparser.SQLNode) error {
+	return sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		if expr, ok := node.(*sqlparser.AliasedTableExpr); ok {
+			if tb, ok := expr.Expr.(sqlparser.TableName); ok && tb.Name.String() != "dual" {
+				database := s.database
+				if !tb.Qualifier.IsEmpty() {
+					database = tb.Qualifier.String()
+				}
+				conf, err := s.router.TableConfig(database, tb.Name.String())
+				if err != nil {
+					return false, err
+				}
+				if conf.ShardType != "GLOBAL" {
+					return false, errors.Errorf("unsupported: recursive.cte.'%s'.refers.to.non-global.table.'%s'", name, tb.Name.String())
+				}
+			}
+		}
+		return true, nil
+	}, node)
+}
+
+// lookupCTE finds the cte by name in the scope.
+func lookupCTE(scope []*cte, name string) *cte {
+	for _, c := range scope {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// refersTo returns true if the node refers to the table by the unqualified name.
+func refersTo(node sqlparser.SQLNode, name string) bool {
+	refer := false
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		if expr, ok := node.(*sqlparser.AliasedTableExpr); ok {
+			if tb, ok := expr.Expr.(sqlparser.TableName); ok && tb.Qualifier.IsEmpty() && tb.Name.String() == name {
+				refer = true
+				return false, nil
+			}
+		}
+		return !refer, nil
+	}, node)
+	return refer
+}
+
+// renameColumns renames the select exprs of the first select by the column list of the cte or view.
+func renameColumns(node sqlparser.SelectStatement, kind string, name string, columns sqlparser.Columns) error {
+	if len(columns) == 0 {
+		return nil
+	}
+	for {
+		switch n := node.(type) {
+		case *sqlparser.Union:
+			node = n.Left
+			continue
+		case *sqlparser.ParenSelect:
+			node = n.Select
+			continue
+		}
+		break
+	}
+	sel := node.(*sqlparser.Select)
+	for _, expr := range sel.SelectExprs {
+		if _, ok := expr.(*sqlparser.AliasedExpr); !ok {
+			return errors.Errorf("unsupported: %s.'%s'.column.list.with.'*'", kind, name)
+		}
+	}
+	if len(sel.SelectExprs) != len(columns) {
+		return errors.Errorf("unsupported: %s.'%s'.has.a.different.number.of.columns", kind, name)
+	}
+	for i, expr := range sel.SelectExprs {
+		expr.(*sqlparser.AliasedExpr).As = columns[i]
+	}
+	return nil
+}
+
+// placeholder returns the placeholder of the materialized cte, which is planned as a constant table.
+func placeholder() *sqlparser.Select {
+	return &sqlparser.Select{
+		SelectExprs: sqlparser.SelectExprs{&sqlparser.AliasedExpr{Expr: sqlparser.NewIntVal([]byte("1"))}},
+		From:        sqlparser.TableExprs{&sqlparser.AliasedTableExpr{Expr: sqlparser.TableName{Name: sqlparser.NewTableIdent("dual")}}},
+	}
+}
+
+// pushable returns true if the plan is a single route query without the sub plans.
+func pushable(root PlanNode) bool {
+	mn, ok := root.(*MergeNode)
+	return ok && mn.routeLen == 1 && len(mn.children) == 0
+}
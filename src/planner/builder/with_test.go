@@ -0,0 +1,143 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package builder
+
+import (
+	"testing"
+
+	"router"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestWith(t *testing.T) {
+	querys := []string{
+		"with t as (select a from A where id=1) select * from t",
+		"with t as (select * from G) select t.a, A.b from t join A on t.a=A.a where A.id=1",
+		"with t(x, n) as (select a, count(*) from A group by a) select * from t where n > 1 order by n",
+		"with t as (select a, count(*) as n from A group by a) select A.b, t.n from A join t on A.a=t.a where A.id=1",
+		"with t as (select a from A where id=1), u as (select * from t join G on t.a=G.a) select * from u",
+		"with c as (select a, count(*) as n from A group by a) select * from c where n > 1 union all select * from c as d",
+		"with recursive r(id, p) as (select id, p from G where p is null union all select G.id, G.p from G join r on G.p=r.id) select * from r",
+	}
+	wants := []string{
+		"select * from (select a from sbtest.A6 as A where id = 1) as t",
+		"select t.a, A.b from (select * from sbtest.G) as t join sbtest.A6 as A on t.a = A.a where A.id = 1",
+		"select * from :derived_t as t where n > 1 order by n asc",
+		"select A.b, t.n from sbtest.A6 as A join :derived_t as t on A.a = t.a where A.id = 1",
+		"select * from (select * from (select a from sbtest.A6 as A where id = 1) as t join sbtest.G on t.a = G.a) as u",
+		"select * from :derived_c as c where n > 1 union all select * from :derived_d as d",
+		"select * from :derived_r as r",
+	}
+	derived := []int{0, 0, 1, 1, 0, 2, 1}
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	err := route.CreateDatabase("sbtest")
+	assert.Nil(t, err)
+	err = route.AddForTest("sbtest", router.MockTableMConfig(), router.MockTableGConfig())
+	assert.Nil(t, err)
+	for i, query := range querys {
+		tree, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan, err := BuildNode(log, route, "sbtest", tree.(sqlparser.SelectStatement))
+		assert.Nil(t, err, query)
+		m := plan.(*MergeNode)
+		assert.Equal(t, 1, len(m.Querys))
+		assert.Equal(t, wants[i], m.Querys[0].Query)
+		assert.Equal(t, derived[i], len(m.Derived()))
+	}
+}
+
+// TestWithMaterializeOnce tests the references of the cte share one materialized derived table.
+func TestWithMaterializeOnce(t *testing.T) {
+	query := "with c as (select a, count(*) as n from A group by a) select * from c where n > 1 union all select * from c as d"
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	err := route.CreateDatabase("sbtest")
+	assert.Nil(t, err)
+	err = route.AddForTest("sbtest", router.MockTableMConfig())
+	assert.Nil(t, err)
+
+	tree, err := sqlparser.Parse(query)
+	assert.Nil(t, err)
+	plan, err := BuildNode(log, route, "sbtest", tree.(sqlparser.SelectStatement))
+	assert.Nil(t, err)
+	derived := plan.(*MergeNode).Derived()
+	assert.Equal(t, derived["derived_c"], derived["derived_d"])
+	assert.Equal(t, 6, len(derived["derived_c"].Root.(*MergeNode).Querys))
+}
+
+func TestWithRecursive(t *testing.T) {
+	query := "with recursive r(id, p) as (select id, p from G where p is null union select G.id, G.p from G join r on G.p=r.id) select * from r"
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	err := route.CreateDatabase("sbtest")
+	assert.Nil(t, err)
+	err = route.AddForTest("sbtest", router.MockTableGConfig())
+	assert.Nil(t, err)
+
+	tree, err := sqlparser.Parse(query)
+	assert.Nil(t, err)
+	plan, err := BuildNode(log, route, "sbtest", tree.(sqlparser.SelectStatement))
+	assert.Nil(t, err)
+	d := plan.(*MergeNode).Derived()["derived_r"]
+	assert.True(t, d.Distinct)
+	assert.Nil(t, d.Root)
+
+	anchor := d.Anchor.(*MergeNode)
+	assert.Equal(t, "select id as id, p as p from sbtest.G where p is null", anchor.Querys[0].Query)
+	recursive := d.Recursive.(*MergeNode)
+	assert.Equal(t, "select G.id, G.p from sbtest.G join :derived_r as r on G.p = r.id", recursive.Querys[0].Query)
+	assert.Equal(t, d.Self, recursive.Derived()["derived_r"])
+}
+
+func TestWithError(t *testing.T) {
+	querys := []string{
+		"with t as (select a from A), t as (select b from A) select * from t",
+		"with t(x) as (select a, b from A) select * from t",
+		"with t(x, y) as (select * from A) select * from t",
+		"with recursive r as (select id from A union all select A.id from A join r on A.a=r.id) select * from r",
+		"with recursive r as (select id from G union all select G.id from G join r on G.a=r.id order by id) select * from r",
+		"with recursive r as (select G.id from G join r on G.a=r.id) select * from r",
+		"with t as (with u as (select a from A) select * from u) select * from t",
+		"with t as (select a from C) select * from t",
+	}
+	wants := []string{
+		"unsupported: not.unique.table.or.alias:'t'",
+		"unsupported: cte.'t'.has.a.different.number.of.columns",
+		"unsupported: cte.'t'.column.list.with.'*'",
+		"unsupported: recursive.cte.'r'.refers.to.non-global.table.'A'",
+		"unsupported: recursive.cte.'r'.must.be.the.union.of.anchor.and.recursive.part",
+		"unsupported: recursive.cte.'r'.must.be.the.union.of.anchor.and.recursive.part",
+		"unsupported: nested.with.clause",
+		"Table 'C' doesn't exist (errno 1146) (sqlstate 42S02)",
+	}
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	err := route.CreateDatabase("sbtest")
+	assert.Nil(t, err)
+	err = route.AddForTest("sbtest", router.MockTableMConfig(), router.MockTableGConfig())
+	assert.Nil(t, err)
+	for i, query := range querys {
+		tree, err := sqlparser.Parse(query)
+		assert.Nil(t, err, query)
+		_, err = BuildNode(log, route, "sbtest", tree.(sqlparser.SelectStatement))
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		assert.Equal(t, wants[i], got, query)
+	}
+}
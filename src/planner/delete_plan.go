@@ -49,6 +49,9 @@ type DeletePlan struct {
 
 	// query and backend tuple
 	Querys []xcontext.QueryTuple
+
+	// Join is the cross-shard multiple-table delete, nil if it's pushed down.
+	Join *JoinDML
 }
 
 // NewDeletePlan used to create DeletePlan
@@ -84,6 +87,10 @@ func (p *DeletePlan) Build() error {
 	}
 
 	node := p.node
+	if node.TableExprs != nil {
+		return p.buildMultiple()
+	}
+
 	// Database.
 	database := p.database
 	if !node.Table.Qualifier.IsEmpty() {
@@ -117,6 +124,51 @@ func (p *DeletePlan) Build() error {
 	return nil
 }
 
+// buildMultiple used to build the multiple-table delete.
+// If the tables are co-located, the delete is pushed down as-is, otherwise
+// only one table can be deleted by the primary keys.
+func (p *DeletePlan) buildMultiple() error {
+	node := p.node
+	tables, err := dmlTables(p.database, node.TableExprs, p.router)
+	if err != nil {
+		return err
+	}
+
+	var target *dmlTable
+	var names sqlparser.TableNames
+	targets := make(map[string]*dmlTable)
+	for _, tb := range node.Targets {
+		if target, err = lookupTable(tables, tb, "delete"); err != nil {
+			return err
+		}
+		if _, ok := targets[target.alias]; !ok {
+			targets[target.alias] = target
+			names = append(names, sqlparser.TableName{Name: sqlparser.NewTableIdent(target.alias)})
+		}
+	}
+
+	join := newJoinDML(p.log, p.database, node.Comments, node.TableExprs, node.Where, p.router)
+	mn, err := buildDMLNode(join, tables, targets)
+	if err != nil {
+		return err
+	}
+	if mn != nil {
+		p.Querys, err = mn.GenerateDMLQuerys(func(buf *sqlparser.TrackedBuffer, sel *sqlparser.Select) {
+			buf.Myprintf("delete %v%v from %v%v", node.Comments, names, sel.From, sel.Where)
+		})
+		return err
+	}
+
+	if len(targets) > 1 {
+		return errors.New("unsupported: cross-shard.delete.of.multiple.tables")
+	}
+	if err := join.setTarget(target); err != nil {
+		return err
+	}
+	p.Join = join
+	return nil
+}
+
 // Type returns the type of the plan.
 func (p *DeletePlan) Type() PlanType {
 	return p.typ
@@ -127,6 +179,7 @@ func (p *DeletePlan) JSON() string {
 	type explain struct {
 		RawQuery   string                `json:",omitempty"`
 		Partitions []xcontext.QueryTuple `json:",omitempty"`
+		CrossShard string                `json:",omitempty"`
 	}
 
 	// Partitions.
@@ -136,6 +189,9 @@ func (p *DeletePlan) JSON() string {
 		RawQuery:   p.RawQuery,
 		Partitions: parts,
 	}
+	if p.Join != nil {
+		exp.CrossShard = p.Join.Target()
+	}
 	bout, err := json.MarshalIndent(exp, "", "\t")
 	if err != nil {
 		return err.Error()
@@ -149,5 +205,8 @@ func (p *DeletePlan) Size() int {
 	for _, q := range p.Querys {
 		size += len(q.Query)
 	}
+	if p.Join != nil {
+		size += len(p.Join.from)
+	}
 	return size
 }
@@ -221,3 +221,81 @@ func TestDeleteErrorPlan(t *testing.T) {
 		}
 	}
 }
+
+func TestDeleteMultiplePlan(t *testing.T) {
+	results := []string{
+		`{
+	"RawQuery": "delete b, C from B as b join C on b.id = C.a where C.z = 1",
+	"Partitions": [
+		{
+			"Query": "delete b, C from sbtest.B0 as b join sbtest.C0 as C on b.id = C.a where C.z = 1",
+			"Backend": "backend1",
+			"Range": "[0-512)"
+		},
+		{
+			"Query": "delete b, C from sbtest.B1 as b join sbtest.C1 as C on b.id = C.a where C.z = 1",
+			"Backend": "backend2",
+			"Range": "[512-4096)"
+		}
+	]
+}`,
+		`{
+	"RawQuery": "delete A from A join B on A.id = B.k where B.z = 1",
+	"CrossShard": "sbtest.A"
+}`,
+	}
+	querys := []string{
+		"delete b, C from B as b join C on b.id = C.a where C.z = 1",
+		"delete A from A join B on A.id = B.k where B.z = 1",
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.CreateDatabase(database)
+	assert.Nil(t, err)
+	err = route.AddForTest(database, router.MockTableMConfig(), router.MockTableBConfig(), router.MockTableCConfig())
+	assert.Nil(t, err)
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewDeletePlan(log, database, query, node.(*sqlparser.Delete), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, results[i], plan.JSON())
+	}
+}
+
+func TestDeleteMultipleUnsupportedPlan(t *testing.T) {
+	querys := []string{
+		"delete A, B from A join B on A.id = B.k where B.z = 1",
+		"delete X from A join B on A.id = B.k where B.z = 1",
+		"delete A from A join B on A.id = B.k where B.z in (select z from C)",
+	}
+	results := []string{
+		"unsupported: cross-shard.delete.of.multiple.tables",
+		"unsupported: unknown.table.'X'.in.multi.delete",
+		"unsupported: subqueries.in.delete",
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.CreateDatabase(database)
+	assert.Nil(t, err)
+	err = route.AddForTest(database, router.MockTableMConfig(), router.MockTableBConfig())
+	assert.Nil(t, err)
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewDeletePlan(log, database, query, node.(*sqlparser.Delete), route)
+		err = plan.Build()
+		assert.Equal(t, results[i], err.Error())
+	}
+}
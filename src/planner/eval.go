@@ -0,0 +1,361 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+var numberPrefix = regexp.MustCompile(`^\s*[-+]?(\d+(\.\d*)?|\.\d+)([eE][-+]?\d+)?`)
+
+const (
+	// divPrecisionIncrement is the default div_precision_increment of MySQL, the scale of the exact
+	// division result is the scale of the dividend plus it.
+	divPrecisionIncrement = 4
+	// maxDecimalScale is the max scale of the MySQL DECIMAL.
+	maxDecimalScale = 30
+)
+
+// evalValue used to evaluate the shard key value of the insert row to a literal, returns nil for NULL.
+// The literal replaces the expression in the row, so the row is stored as it's routed, and the
+// non-deterministic functions such as UUID() are evaluated only once by radon.
+func evalValue(shardKey string, expr sqlparser.Expr) (*sqlparser.SQLVal, error) {
+	switch expr := expr.(type) {
+	case *sqlparser.SQLVal:
+		switch expr.Type {
+		case sqlparser.StrVal, sqlparser.IntVal, sqlparser.FloatVal:
+			return expr, nil
+		case sqlparser.HexNum:
+			v, err := strconv.ParseUint(string(expr.Val), 0, 64)
+			if err != nil {
+				return nil, errors.Errorf("unsupported: shardkey[%v].value[%s].out.of.range", shardKey, expr.Val)
+			}
+			return intVal(int64(v)), nil
+		case sqlparser.HexVal:
+			v, err := expr.HexDecode()
+			if err != nil {
+				return nil, err
+			}
+			return sqlparser.NewStrVal(v), nil
+		case sqlparser.ValArg:
+			return nil, errors.Errorf("unsupported: shardkey[%v].bind.variable[%s].is.unbound", shardKey, expr.Val)
+		}
+	case *sqlparser.NullVal:
+		return nil, nil
+	case sqlparser.BoolVal:
+		if expr {
+			return intVal(1), nil
+		}
+		return intVal(0), nil
+	case *sqlparser.ParenExpr:
+		return evalValue(shardKey, expr.Expr)
+	case *sqlparser.UnaryExpr:
+		v, err := evalValue(shardKey, expr.Expr)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		switch expr.Operator {
+		case sqlparser.UPlusStr:
+			return v, nil
+		case sqlparser.UMinusStr:
+			i, f, isInt := toNumber(v)
+			if isInt && i != math.MinInt64 {
+				return intVal(-i), nil
+			}
+			return floatVal(-f), nil
+		}
+	case *sqlparser.BinaryExpr:
+		return evalArithmetic(shardKey, expr)
+	case *sqlparser.ConvertExpr:
+		return evalConvert(shardKey, expr)
+	case *sqlparser.FuncExpr:
+		return evalFunc(shardKey, expr)
+	}
+	return nil, errors.Errorf("unsupported: shardkey[%v].type.canot.be[%T]", shardKey, expr)
+}
+
+// evalArithmetic evaluates the + - * / DIV % of the numbers, the strings are converted to numbers
+// by the numeric prefix as MySQL does, the integer overflow is an error.
+func evalArithmetic(shardKey string, expr *sqlparser.BinaryExpr) (*sqlparser.SQLVal, error) {
+	switch expr.Operator {
+	case sqlparser.PlusStr, sqlparser.MinusStr, sqlparser.MultStr, sqlparser.DivStr, sqlparser.IntDivStr, sqlparser.ModStr:
+	default:
+		return nil, errors.Errorf("unsupported: shardkey[%v].operator[%s].cannot.be.evaluated", shardKey, expr.Operator)
+	}
+
+	left, err := evalValue(shardKey, expr.Left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := evalValue(shardKey, expr.Right)
+	if err != nil {
+		return nil, err
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+
+	li, lf, lint := toNumber(left)
+	ri, rf, rint := toNumber(right)
+	overflow := errors.Errorf("unsupported: shardkey[%v].bigint.value.is.out.of.range[%s]", shardKey, sqlparser.String(expr))
+	switch expr.Operator {
+	case sqlparser.PlusStr:
+		if lint && rint {
+			r := li + ri
+			if (li > 0 && ri > 0 && r < 0) || (li < 0 && ri < 0 && r >= 0) {
+				return nil, overflow
+			}
+			return intVal(r), nil
+		}
+		return floatVal(lf + rf), nil
+	case sqlparser.MinusStr:
+		if lint && rint {
+			r := li - ri
+			if (li >= 0 && ri < 0 && r < 0) || (li < 0 && ri > 0 && r >= 0) {
+				return nil, overflow
+			}
+			return intVal(r), nil
+		}
+		return floatVal(lf - rf), nil
+	case sqlparser.MultStr:
+		if lint && rint {
+			r := li * ri
+			if li != 0 && (r/li != ri || (li == -1 && ri == math.MinInt64)) {
+				return nil, overflow
+			}
+			return intVal(r), nil
+		}
+		return floatVal(lf * rf), nil
+	case sqlparser.DivStr:
+		if rf == 0 {
+			return nil, nil
+		}
+		// The exact numbers are divided as DECIMAL, such as 1/3 is 0.3333, the others as DOUBLE.
+		lscale, lexact := exactScale(left)
+		_, rexact := exactScale(right)
+		l, lok := new(big.Rat).SetString(string(left.Val))
+		r, rok := new(big.Rat).SetString(string(right.Val))
+		if lexact && rexact && lok && rok {
+			scale := lscale + divPrecisionIncrement
+			if scale > maxDecimalScale {
+				scale = maxDecimalScale
+			}
+			return sqlparser.NewFloatVal([]byte(l.Quo(l, r).FloatString(scale))), nil
+		}
+		return floatVal(lf / rf), nil
+	case sqlparser.IntDivStr:
+		if rf == 0 {
+			return nil, nil
+		}
+		if lint && rint {
+			return intVal(li / ri), nil
+		}
+		return intVal(int64(lf / rf)), nil
+	default:
+		if rf == 0 {
+			return nil, nil
+		}
+		if lint && rint {
+			return intVal(li % ri), nil
+		}
+		return floatVal(math.Mod(lf, rf)), nil
+	}
+}
+
+// evalConvert evaluates the CAST(expr AS type) and CONVERT(expr, type).
+func evalConvert(shardKey string, expr *sqlparser.ConvertExpr) (*sqlparser.SQLVal, error) {
+	v, err := evalValue(shardKey, expr.Expr)
+	if err != nil || v == nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(expr.Type.Type) {
+	case "signed", "unsigned":
+		var i int64
+		if v.Type == sqlparser.StrVal {
+			// The string is truncated to the integer prefix.
+			i, _, _ = toNumber(sqlparser.NewStrVal([]byte(strings.SplitN(string(v.Val), ".", 2)[0])))
+		} else {
+			var f float64
+			var isInt bool
+			if i, f, isInt = toNumber(v); !isInt {
+				i = int64(math.Round(f))
+			}
+		}
+		if i < 0 && strings.EqualFold(expr.Type.Type, "unsigned") {
+			return nil, errors.Errorf("unsupported: shardkey[%v].cast.negative.value.to.unsigned[%s]", shardKey, sqlparser.String(expr))
+		}
+		return intVal(i), nil
+	case "char", "nchar", "binary":
+		return sqlparser.NewStrVal(v.Val), nil
+	case "decimal":
+		_, f, _ := toNumber(v)
+		return floatVal(f), nil
+	}
+	return nil, errors.Errorf("unsupported: shardkey[%v].cast.type[%s].cannot.be.evaluated", shardKey, expr.Type.Type)
+}
+
+// evalFunc evaluates the string and math functions, and the UUID() which is evaluated once by radon.
+func evalFunc(shardKey string, expr *sqlparser.FuncExpr) (*sqlparser.SQLVal, error) {
+	name := expr.Name.Lowered()
+	if !expr.Qualifier.IsEmpty() || expr.Distinct {
+		return nil, errors.Errorf("unsupported: shardkey[%v].function[%s].cannot.be.evaluated", shardKey, sqlparser.String(expr))
+	}
+
+	args := make([]*sqlparser.SQLVal, 0, len(expr.Exprs))
+	for _, arg := range expr.Exprs {
+		aliased, ok := arg.(*sqlparser.AliasedExpr)
+		if !ok {
+			return nil, errors.Errorf("unsupported: shardkey[%v].function[%s].cannot.be.evaluated", shardKey, sqlparser.String(expr))
+		}
+		v, err := evalValue(shardKey, aliased.Expr)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+
+	argc := func(n int) error {
+		if len(args) != n {
+			return errors.Errorf("unsupported: shardkey[%v].function[%s].expects.%d.arguments", shardKey, name, n)
+		}
+		return nil
+	}
+	switch name {
+	case "uuid":
+		if err := argc(0); err != nil {
+			return nil, err
+		}
+		return sqlparser.NewStrVal([]byte(newUUID())), nil
+	case "concat":
+		var buf []byte
+		for _, arg := range args {
+			if arg == nil {
+				return nil, nil
+			}
+			buf = append(buf, arg.Val...)
+		}
+		return sqlparser.NewStrVal(buf), nil
+	case "concat_ws":
+		if len(args) == 0 {
+			return nil, argc(1)
+		}
+		if args[0] == nil {
+			return nil, nil
+		}
+		var strs []string
+		for _, arg := range args[1:] {
+			if arg != nil {
+				strs = append(strs, string(arg.Val))
+			}
+		}
+		return sqlparser.NewStrVal([]byte(strings.Join(strs, string(args[0].Val)))), nil
+	case "ifnull", "coalesce":
+		if name == "ifnull" {
+			if err := argc(2); err != nil {
+				return nil, err
+			}
+		}
+		for _, arg := range args {
+			if arg != nil {
+				return arg, nil
+			}
+		}
+		return nil, nil
+	case "lower", "lcase", "upper", "ucase", "abs", "floor", "ceil", "ceiling", "round":
+		if err := argc(1); err != nil {
+			return nil, err
+		}
+		v := args[0]
+		if v == nil {
+			return nil, nil
+		}
+		switch name {
+		case "lower", "lcase":
+			return sqlparser.NewStrVal([]byte(strings.ToLower(string(v.Val)))), nil
+		case "upper", "ucase":
+			return sqlparser.NewStrVal([]byte(strings.ToUpper(string(v.Val)))), nil
+		}
+		i, f, isInt := toNumber(v)
+		if isInt {
+			if name == "abs" && i < 0 {
+				if i == math.MinInt64 {
+					return nil, errors.Errorf("unsupported: shardkey[%v].bigint.value.is.out.of.range[%s]", shardKey, sqlparser.String(expr))
+				}
+				return intVal(-i), nil
+			}
+			return intVal(i), nil
+		}
+		switch name {
+		case "abs":
+			return floatVal(math.Abs(f)), nil
+		case "floor":
+			return intVal(int64(math.Floor(f))), nil
+		case "ceil", "ceiling":
+			return intVal(int64(math.Ceil(f))), nil
+		default:
+			return intVal(int64(math.Round(f))), nil
+		}
+	}
+	return nil, errors.Errorf("unsupported: shardkey[%v].function[%s].cannot.be.evaluated", shardKey, sqlparser.String(expr))
+}
+
+// toNumber converts the value to the number, returns isInt true if it's an integer.
+func toNumber(v *sqlparser.SQLVal) (int64, float64, bool) {
+	s := string(v.Val)
+	if v.Type == sqlparser.StrVal {
+		s = strings.TrimSpace(numberPrefix.FindString(s))
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, float64(i), true
+	}
+	f, _ := strconv.ParseFloat(s, 64)
+	return 0, f, false
+}
+
+// exactScale returns the digits after the decimal point if the value is the exact number literal,
+// the strings and the numbers with the exponent are approximate as MySQL does.
+func exactScale(v *sqlparser.SQLVal) (int, bool) {
+	s := string(v.Val)
+	switch {
+	case v.Type == sqlparser.IntVal:
+		return 0, true
+	case v.Type != sqlparser.FloatVal || strings.ContainsAny(s, "eE"):
+		return 0, false
+	case strings.Contains(s, "."):
+		return len(s) - strings.Index(s, ".") - 1, true
+	}
+	return 0, true
+}
+
+func intVal(i int64) *sqlparser.SQLVal {
+	return sqlparser.NewIntVal([]byte(strconv.FormatInt(i, 10)))
+}
+
+func floatVal(f float64) *sqlparser.SQLVal {
+	return sqlparser.NewFloatVal([]byte(strconv.FormatFloat(f, 'f', -1, 64)))
+}
+
+// newUUID returns the random UUID in the format of MySQL UUID().
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,120 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+func parseExpr(t *testing.T, expr string) sqlparser.Expr {
+	node, err := sqlparser.Parse("select " + expr)
+	assert.Nil(t, err)
+	return node.(*sqlparser.Select).SelectExprs[0].(*sqlparser.AliasedExpr).Expr
+}
+
+func TestEvalValue(t *testing.T) {
+	tcases := []struct {
+		expr string
+		want string
+	}{
+		{"1", "1"},
+		{"'a'", "'a'"},
+		{"1.5", "1.5"},
+		{"0x10", "16"},
+		{"X'61'", "'a'"},
+		{"true", "1"},
+		{"null", "null"},
+		{"(-(3))", "-3"},
+		{"+'7'", "'7'"},
+		{"1 + 2 * 3", "7"},
+		{"'12abc' + 1", "13"},
+		{"7 - 10", "-3"},
+		{"7 / 2", "3.5000"},
+		{"1 / 3", "0.3333"},
+		{"-2 / 3", "-0.6667"},
+		{"1.50 / 3", "0.500000"},
+		{"'7' / 2", "3.5"},
+		{"1e1 / 4", "2.5"},
+		{"3. / 2", "1.5000"},
+		{"7 div 2", "3"},
+		{"7 % 3", "1"},
+		{"1 / 0", "null"},
+		{"1 + null", "null"},
+		{"1.5 * 2", "3"},
+		{"cast('23.7abc' as signed)", "23"},
+		{"cast(23.5 as unsigned)", "24"},
+		{"cast(12 as char)", "'12'"},
+		{"convert(12, binary)", "'12'"},
+		{"cast('1.25' as decimal)", "1.25"},
+		{"concat('a', 1, 'b')", "'a1b'"},
+		{"concat('a', null)", "null"},
+		{"concat_ws('-', 'a', null, 'b')", "'a-b'"},
+		{"ifnull(null, 'x')", "'x'"},
+		{"coalesce(null, null, 2)", "2"},
+		{"lower('AbC')", "'abc'"},
+		{"ucase('AbC')", "'ABC'"},
+		{"abs(-3)", "3"},
+		{"floor(3.7)", "3"},
+		{"ceil(3.2)", "4"},
+		{"round(3.5)", "4"},
+	}
+
+	for _, tcase := range tcases {
+		got, err := evalValue("id", parseExpr(t, tcase.expr))
+		assert.Nil(t, err, tcase.expr)
+		if got == nil {
+			assert.Equal(t, tcase.want, "null", tcase.expr)
+			continue
+		}
+		assert.Equal(t, tcase.want, sqlparser.String(got), tcase.expr)
+	}
+}
+
+func TestEvalValueUUID(t *testing.T) {
+	uuid := regexp.MustCompile(`^'[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}'$`)
+
+	expr := parseExpr(t, "uuid()")
+	v1, err := evalValue("id", expr)
+	assert.Nil(t, err)
+	assert.Regexp(t, uuid, sqlparser.String(v1))
+	v2, err := evalValue("id", expr)
+	assert.Nil(t, err)
+	assert.NotEqual(t, sqlparser.String(v1), sqlparser.String(v2))
+}
+
+func TestEvalValueError(t *testing.T) {
+	tcases := []struct {
+		expr string
+		want string
+	}{
+		{"a", "unsupported: shardkey[id].type.canot.be[*sqlparser.ColName]"},
+		{"1 & 2", "unsupported: shardkey[id].operator[&].cannot.be.evaluated"},
+		{"-9223372036854775807 - 2", "unsupported: shardkey[id].bigint.value.is.out.of.range[-9223372036854775807 - 2]"},
+		{"4611686018427387904 * 2", "unsupported: shardkey[id].bigint.value.is.out.of.range[4611686018427387904 * 2]"},
+		{"cast(-1 as unsigned)", "unsupported: shardkey[id].cast.negative.value.to.unsigned[convert(-1, unsigned)]"},
+		{"cast(1 as date)", "unsupported: shardkey[id].cast.type[date].cannot.be.evaluated"},
+		{"now()", "unsupported: shardkey[id].function[now()].cannot.be.evaluated"},
+		{"uuid(1)", "unsupported: shardkey[id].function[uuid].expects.0.arguments"},
+		{"lower('a', 'b')", "unsupported: shardkey[id].function[lower].expects.1.arguments"},
+		{"concat(1, b)", "unsupported: shardkey[id].type.canot.be[*sqlparser.ColName]"},
+		{":v1", "unsupported: shardkey[id].bind.variable[:v1].is.unbound"},
+	}
+
+	for _, tcase := range tcases {
+		_, err := evalValue("id", parseExpr(t, tcase.expr))
+		assert.NotNil(t, err, tcase.expr)
+		if err != nil {
+			assert.Equal(t, tcase.want, err.Error(), tcase.expr)
+		}
+	}
+}
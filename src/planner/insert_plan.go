@@ -49,6 +49,9 @@ type InsertPlan struct {
 
 	// query and backend tuple
 	Querys []xcontext.QueryTuple
+
+	// RowCounts is the rows number of every query, used to report the rows per shard.
+	RowCounts []int
 }
 
 // NewInsertPlan used to create InsertPlan
@@ -101,6 +104,7 @@ func (p *InsertPlan) Build() error {
 				Range:   segment.Range.String(),
 			}
 			p.Querys = append(p.Querys, tuple)
+			p.RowCounts = append(p.RowCounts, len(rows))
 		}
 		return nil
 	}
@@ -121,8 +125,20 @@ func (p *InsertPlan) Build() error {
 			break
 		}
 	}
+	// The shard key column is omitted, fill in the default of the column.
 	if idx == -1 {
-		return errors.Errorf("unsupported: shardkey.column[%v].missing", shardKey)
+		def, err := p.shardKeyDefault(database, table, shardKey)
+		if err != nil {
+			return err
+		}
+		idx = len(node.Columns)
+		node.Columns = append(node.Columns, sqlparser.NewColIdent(shardKey))
+		for i := range rows {
+			if len(rows[i]) != idx {
+				return errors.Errorf("unsupported: shardkey[%v].out.of.index:[%v]", shardKey, idx)
+			}
+			rows[i] = append(rows[i], def)
+		}
 	}
 
 	// Rebuild distributed querys.
@@ -138,10 +154,20 @@ func (p *InsertPlan) Build() error {
 		if idx >= len(row) {
 			return errors.Errorf("unsupported: shardkey[%v].out.of.index:[%v]", shardKey, idx)
 		}
-		shardVal, ok := row[idx].(*sqlparser.SQLVal)
-		if !ok {
-			return errors.Errorf("unsupported: shardkey[%v].type.canot.be[%T]", shardKey, row[idx])
+		if _, ok := row[idx].(*sqlparser.Default); ok {
+			if row[idx], err = p.shardKeyDefault(database, table, shardKey); err != nil {
+				return err
+			}
 		}
+		// Evaluate the shard key in the proxy and replace it by the literal, so the row is stored as it's routed.
+		shardVal, err := evalValue(shardKey, row[idx])
+		if err != nil {
+			return err
+		}
+		if shardVal == nil {
+			return errors.Errorf("unsupported: shardkey[%v].can.not.be.null", shardKey)
+		}
+		row[idx] = shardVal
 
 		segments, err := p.router.Lookup(database, table, shardVal, shardVal)
 		if err != nil {
@@ -181,10 +207,27 @@ func (p *InsertPlan) Build() error {
 			Range:   v.rangi,
 		}
 		p.Querys = append(p.Querys, tuple)
+		p.RowCounts = append(p.RowCounts, len(v.vals))
 	}
 	return nil
 }
 
+// shardKeyDefault returns the DEFAULT of the shard key column.
+func (p *InsertPlan) shardKeyDefault(database string, table string, shardKey string) (sqlparser.Expr, error) {
+	tconf, err := p.router.TableConfig(database, table)
+	if err != nil {
+		return nil, err
+	}
+	if tconf.ShardKeyDefault == "" {
+		return nil, errors.Errorf("unsupported: shardkey.column[%v].missing", shardKey)
+	}
+	node, err := sqlparser.Parse("select " + tconf.ShardKeyDefault)
+	if err != nil {
+		return nil, err
+	}
+	return node.(*sqlparser.Select).SelectExprs[0].(*sqlparser.AliasedExpr).Expr, nil
+}
+
 // Type returns the type of the plan.
 func (p *InsertPlan) Type() PlanType {
 	return p.Typ
@@ -98,6 +98,84 @@ func TestInsertPlan(t *testing.T) {
 	}
 }
 
+func TestInsertPlanEvalShardKey(t *testing.T) {
+	results := []string{
+		`{
+	"RawQuery": "insert into A(id, b) values(65535 + 1, 1), (cast('23abc' as signed), 2), (concat(1), 3)",
+	"Partitions": [
+		{
+			"Query": "insert into sbtest.A5(id, b) values (65536, 1)",
+			"Backend": "backend5",
+			"Range": "[256-512)"
+		},
+		{
+			"Query": "insert into sbtest.A6(id, b) values (23, 2), ('1', 3)",
+			"Backend": "backend6",
+			"Range": "[512-4096)"
+		}
+	]
+}`,
+		`{
+	"RawQuery": "insert into A(b, c) values(1, 2), (3, 4)",
+	"Partitions": [
+		{
+			"Query": "insert into sbtest.A5(b, c, id) values (1, 2, 65536), (3, 4, 65536)",
+			"Backend": "backend5",
+			"Range": "[256-512)"
+		}
+	]
+}`,
+		`{
+	"RawQuery": "insert into A(id, b) values(default, 1), (1, 2)",
+	"Partitions": [
+		{
+			"Query": "insert into sbtest.A5(id, b) values (65536, 1)",
+			"Backend": "backend5",
+			"Range": "[256-512)"
+		},
+		{
+			"Query": "insert into sbtest.A6(id, b) values (1, 2)",
+			"Backend": "backend6",
+			"Range": "[512-4096)"
+		}
+	]
+}`,
+	}
+	querys := []string{
+		"insert into A(id, b) values(65535 + 1, 1), (cast('23abc' as signed), 2), (concat(1), 3)",
+		"insert into A(b, c) values(1, 2), (3, 4)",
+		"insert into A(id, b) values(default, 1), (1, 2)",
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.CreateDatabase(database)
+	assert.Nil(t, err)
+	tconf := router.MockTableMConfig()
+	tconf.ShardKeyDefault = "65536"
+	err = route.AddForTest(database, tconf)
+	assert.Nil(t, err)
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewInsertPlan(log, database, query, node.(*sqlparser.Insert), route)
+
+		// plan build
+		{
+			err := plan.Build()
+			assert.Nil(t, err)
+			got := plan.JSON()
+			log.Info("%s", got)
+			want := results[i]
+			assert.Equal(t, want, got)
+		}
+	}
+}
+
 func TestInsertPlanSort(t *testing.T) {
 	results := []string{
 		`{
@@ -170,7 +248,10 @@ func TestInsertUnsupportedPlan(t *testing.T) {
 		"insert into sbtest.A(b, c, id) values(1,2)",
 		"insert into sbtest.A(b, c, d) values(1,2, 3)",
 		"insert into sbtest.A(b, c, id) values(1,2,3) on duplicate key update id=1",
-		"insert into sbtest.A(b, c, id) values(1, floor(3), floor(3))",
+		"insert into sbtest.A(b, c, id) values(1, floor(3), b)",
+		"insert into sbtest.A(b, c, id) values(1, 2, rand())",
+		"insert into sbtest.A(b, c, id) values(1, 2, null)",
+		"insert into sbtest.A(b, c, id) values(1, 2, 9223372036854775807 + 1)",
 		"insert into sbtest.A select * from sbtest.B",
 		"insert into sbtest.A(b,c,id) select id,b,c from sbtest.A",
 		"insert into sbtest.G(b, c, id) select * from sbtest.A",
@@ -181,7 +262,10 @@ func TestInsertUnsupportedPlan(t *testing.T) {
 		"unsupported: shardkey[id].out.of.index:[2]",
 		"unsupported: shardkey.column[id].missing",
 		"unsupported: cannot.update.shard.key",
-		"unsupported: shardkey[id].type.canot.be[*sqlparser.FuncExpr]",
+		"unsupported: shardkey[id].type.canot.be[*sqlparser.ColName]",
+		"unsupported: shardkey[id].function[rand()].cannot.be.evaluated",
+		"unsupported: shardkey[id].can.not.be.null",
+		"unsupported: shardkey[id].bigint.value.is.out.of.range[9223372036854775807 + 1]",
 		"unsupported: rows.can.not.be.subquery[*sqlparser.Select]",
 		"unsupported: rows.can.not.be.subquery[*sqlparser.Select]",
 		"unsupported: rows.can.not.be.subquery[*sqlparser.Select]",
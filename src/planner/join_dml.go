@@ -0,0 +1,360 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"fmt"
+	"strings"
+
+	"config"
+	"planner/builder"
+	"router"
+	"xcontext"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// dmlTable is the table referred by the multiple-table UPDATE/DELETE.
+type dmlTable struct {
+	database string
+	table    string
+	alias    string
+	conf     *config.TableConfig
+}
+
+// dmlTables returns the tables in the table references by the alias(the table name if no alias).
+func dmlTables(database string, exprs sqlparser.TableExprs, r *router.Router) (map[string]*dmlTable, error) {
+	tables := make(map[string]*dmlTable)
+	err := sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		expr, ok := node.(*sqlparser.AliasedTableExpr)
+		if !ok {
+			return true, nil
+		}
+		tb, ok := expr.Expr.(sqlparser.TableName)
+		if !ok {
+			return false, nil
+		}
+		t := &dmlTable{
+			database: database,
+			table:    tb.Name.String(),
+			alias:    expr.As.String(),
+		}
+		if !tb.Qualifier.IsEmpty() {
+			t.database = tb.Qualifier.String()
+		}
+		if t.alias == "" {
+			t.alias = t.table
+		}
+		if t.conf, err = r.TableConfig(t.database, t.table); err != nil {
+			return false, err
+		}
+		tables[t.alias] = t
+		return false, nil
+	}, exprs)
+	return tables, err
+}
+
+// lookupTable finds the table by the qualifier of the column or the target of the DELETE.
+func lookupTable(tables map[string]*dmlTable, tb sqlparser.TableName, typ string) (*dmlTable, error) {
+	t, ok := tables[tb.Name.String()]
+	if !ok || (!tb.Qualifier.IsEmpty() && tb.Qualifier.String() != t.database) {
+		return nil, errors.Errorf("unsupported: unknown.table.'%s'.in.multi.%s", tb.Name.String(), typ)
+	}
+	return t, nil
+}
+
+// buildDMLNode used to plan the table references of the multiple-table DML, returns nil if it cannot be
+// pushed down. The global target table must be changed on all the backends, so it can be pushed down only
+// if all the tables are global.
+func buildDMLNode(p *JoinDML, tables, targets map[string]*dmlTable) (*builder.MergeNode, error) {
+	node, err := sqlparser.Parse("select 1 from " + p.from)
+	if err != nil {
+		return nil, err
+	}
+	mn, err := builder.BuildDMLNode(p.log, p.router, p.database, node.(*sqlparser.Select))
+	if err != nil || mn == nil {
+		return nil, err
+	}
+
+	nonGlobal := false
+	for _, t := range tables {
+		if t.conf.ShardType != "GLOBAL" {
+			nonGlobal = true
+		}
+	}
+	if nonGlobal {
+		for _, t := range targets {
+			if t.conf.ShardType == "GLOBAL" {
+				return nil, nil
+			}
+		}
+	}
+	return mn, nil
+}
+
+// JoinDML represents the multiple-table UPDATE/DELETE which cannot be pushed down.
+// Radon reads the primary keys of the target rows and the new values by the select plan,
+// then changes the rows by the primary keys on the shards in the transaction.
+type JoinDML struct {
+	log *xlog.Log
+
+	// router
+	router *router.Router
+
+	// database
+	database string
+
+	// comments of the DML.
+	comments sqlparser.Comments
+
+	// from is the table references and the where clause.
+	from string
+
+	// exprs are the update exprs, nil for the DELETE.
+	exprs sqlparser.UpdateExprs
+
+	// target is the changed table.
+	target *dmlTable
+
+	// shardIdx is the column index of the shard key in the rows, -1 if not sharded.
+	shardIdx int
+
+	// KeyQuery used to fetch the primary key columns of the target table.
+	KeyQuery xcontext.QueryTuple
+
+	// Keys are the primary key columns of the target table.
+	Keys []string
+
+	// Root is the select plan of the target rows.
+	Root builder.PlanNode
+}
+
+// newJoinDML used to create JoinDML.
+func newJoinDML(log *xlog.Log, database string, comments sqlparser.Comments, from sqlparser.TableExprs, where *sqlparser.Where, router *router.Router) *JoinDML {
+	return &JoinDML{
+		log:      log,
+		router:   router,
+		database: database,
+		comments: comments,
+		from:     sqlparser.String(from) + sqlparser.String(where),
+		shardIdx: -1,
+	}
+}
+
+// setTarget used to set the target table and generate the query of the primary key columns.
+func (p *JoinDML) setTarget(target *dmlTable) error {
+	segments, err := p.router.Lookup(target.database, target.table, nil, nil)
+	if err != nil {
+		return err
+	}
+	p.target = target
+	p.KeyQuery = xcontext.QueryTuple{
+		Query:   fmt.Sprintf("select column_name, column_key from information_schema.columns where table_schema='%s' and table_name='%s' order by ordinal_position", target.database, segments[0].Table),
+		Backend: segments[0].Backend,
+		Range:   segments[0].Range.String(),
+	}
+	return nil
+}
+
+// Target returns the target table.
+func (p *JoinDML) Target() string {
+	return fmt.Sprintf("%s.%s", p.target.database, p.target.table)
+}
+
+// Build used to build the select plan by the primary key columns of the target table.
+// The select exprs are: the primary keys, the shard key(if not in the primary keys) and the update values.
+func (p *JoinDML) Build(keys []string) error {
+	if len(keys) == 0 {
+		return errors.Errorf("unsupported: table.'%s'.has.no.primary.key", p.target.table)
+	}
+	p.Keys = keys
+	p.shardIdx = -1
+
+	alias := sqlparser.NewTableIdent(p.target.alias)
+	buf := sqlparser.NewTrackedBuffer(nil)
+	buf.Myprintf("select ")
+	for i, key := range keys {
+		if i > 0 {
+			buf.Myprintf(", ")
+		}
+		buf.Myprintf("%v.%v", alias, sqlparser.NewColIdent(key))
+		if strings.EqualFold(key, p.target.conf.ShardKey) {
+			p.shardIdx = i
+		}
+	}
+	if p.target.conf.ShardKey != "" && p.shardIdx < 0 {
+		buf.Myprintf(", %v.%v", alias, sqlparser.NewColIdent(p.target.conf.ShardKey))
+		p.shardIdx = len(keys)
+	}
+	for _, expr := range p.exprs {
+		buf.Myprintf(", %v", expr.Expr)
+	}
+	buf.Myprintf(" from %s for update", p.from)
+
+	node, err := sqlparser.Parse(buf.String())
+	if err != nil {
+		return err
+	}
+	p.Root, err = builder.BuildNode(p.log, p.router, p.database, node.(*sqlparser.Select))
+	return err
+}
+
+// Querys used to generate the primary key DML querys by the target rows.
+// The UPDATE is one query per row, the DELETE is one query per shard.
+func (p *JoinDML) Querys(rs *sqltypes.Result) ([]xcontext.QueryTuple, error) {
+	var all []router.Segment
+	var err error
+	if p.shardIdx < 0 {
+		if all, err = p.router.Lookup(p.target.database, p.target.table, nil, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	type batch struct {
+		segment router.Segment
+		rows    [][]sqltypes.Value
+	}
+	var batches []*batch
+	batchIdxs := make(map[string]int)
+	seen := make(map[string]struct{})
+	querys := make([]xcontext.QueryTuple, 0, len(rs.Rows))
+	for _, row := range rs.Rows {
+		// Skip the NULL-extended rows of the LEFT JOIN and the duplicate rows.
+		var key []byte
+		null := false
+		for _, v := range row[:len(p.Keys)] {
+			if v.IsNull() {
+				null = true
+				break
+			}
+			key = append(key, v.Raw()...)
+			key = append(key, 0)
+		}
+		if _, ok := seen[string(key)]; ok || null {
+			continue
+		}
+		seen[string(key)] = struct{}{}
+
+		segments := all
+		if p.shardIdx >= 0 {
+			v := row[p.shardIdx]
+			if v.IsNull() {
+				return nil, errors.Errorf("unsupported: shard.key.of.table.'%s'.is.null", p.target.table)
+			}
+			val := shardKeyVal(v)
+			if segments, err = p.router.Lookup(p.target.database, p.target.table, val, val); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, segment := range segments {
+			if p.exprs != nil {
+				querys = append(querys, p.update(segment, row))
+				continue
+			}
+			name := segment.Backend + "." + segment.Table
+			idx, ok := batchIdxs[name]
+			if !ok {
+				idx = len(batches)
+				batchIdxs[name] = idx
+				batches = append(batches, &batch{segment: segment})
+			}
+			batches[idx].rows = append(batches[idx].rows, row)
+		}
+	}
+
+	for _, b := range batches {
+		querys = append(querys, p.delete(b.segment, b.rows))
+	}
+	return querys, nil
+}
+
+// shardKeyVal returns the shard key value of the row as the literal of the INSERT,
+// the hash routes the IntVal, FloatVal and StrVal differently.
+func shardKeyVal(v sqltypes.Value) *sqlparser.SQLVal {
+	switch {
+	case v.IsIntegral():
+		return sqlparser.NewIntVal(v.Raw())
+	case v.IsFloat() || v.Type() == querypb.Type_DECIMAL:
+		return sqlparser.NewFloatVal(v.Raw())
+	}
+	return sqlparser.NewStrVal(v.Raw())
+}
+
+// update generates the update query of the row, such as:
+// update db.t_0001 set a = 1, b = 'x' where id = 1.
+func (p *JoinDML) update(segment router.Segment, row []sqltypes.Value) xcontext.QueryTuple {
+	values := row[len(row)-len(p.exprs):]
+	buf := sqlparser.NewTrackedBuffer(nil)
+	buf.Myprintf("update %v%s.%s set ", p.comments, p.target.database, segment.Table)
+	for i, expr := range p.exprs {
+		if i > 0 {
+			buf.Myprintf(", ")
+		}
+		buf.Myprintf("%v = ", expr.Name.Name)
+		values[i].EncodeSQL(buf)
+	}
+	buf.Myprintf(" where ")
+	for i, key := range p.Keys {
+		if i > 0 {
+			buf.Myprintf(" and ")
+		}
+		buf.Myprintf("%v = ", sqlparser.NewColIdent(key))
+		row[i].EncodeSQL(buf)
+	}
+	return xcontext.QueryTuple{
+		Query:   buf.String(),
+		Backend: segment.Backend,
+		Range:   segment.Range.String(),
+	}
+}
+
+// delete generates the delete query of the rows on the same shard, such as:
+// delete from db.t_0001 where (id, k) in ((1, 'a'), (2, 'b')).
+func (p *JoinDML) delete(segment router.Segment, rows [][]sqltypes.Value) xcontext.QueryTuple {
+	tuple := func(buf *sqlparser.TrackedBuffer, n int, fn func(i int)) {
+		if n > 1 {
+			buf.Myprintf("(")
+		}
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				buf.Myprintf(", ")
+			}
+			fn(i)
+		}
+		if n > 1 {
+			buf.Myprintf(")")
+		}
+	}
+
+	buf := sqlparser.NewTrackedBuffer(nil)
+	buf.Myprintf("delete %vfrom %s.%s where ", p.comments, p.target.database, segment.Table)
+	tuple(buf, len(p.Keys), func(i int) {
+		buf.Myprintf("%v", sqlparser.NewColIdent(p.Keys[i]))
+	})
+	buf.Myprintf(" in (")
+	for i, row := range rows {
+		if i > 0 {
+			buf.Myprintf(", ")
+		}
+		tuple(buf, len(p.Keys), func(j int) {
+			row[j].EncodeSQL(buf)
+		})
+	}
+	buf.Myprintf(")")
+	return xcontext.QueryTuple{
+		Query:   buf.String(),
+		Backend: segment.Backend,
+		Range:   segment.Range.String(),
+	}
+}
@@ -0,0 +1,195 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"router"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestJoinDMLUpdate(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.CreateDatabase(database)
+	assert.Nil(t, err)
+	err = route.AddForTest(database, router.MockTableMConfig(), router.MockTableBConfig())
+	assert.Nil(t, err)
+
+	query := "update A join B on A.id = B.k set A.x = B.y, A.z = 1 where B.z = 1"
+	node, err := sqlparser.Parse(query)
+	assert.Nil(t, err)
+	plan := NewUpdatePlan(log, database, query, node.(*sqlparser.Update), route)
+	err = plan.Build()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(plan.Querys))
+
+	join := plan.Join
+	assert.NotNil(t, join)
+	assert.Equal(t, "sbtest.A", join.Target())
+	assert.Equal(t, "select column_name, column_key from information_schema.columns where table_schema='sbtest' and table_name='A1' order by ordinal_position", join.KeyQuery.Query)
+	assert.Equal(t, "backend1", join.KeyQuery.Backend)
+
+	err = join.Build([]string{"id"})
+	assert.Nil(t, err)
+	assert.NotNil(t, join.Root)
+
+	rs := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "id", Type: querypb.Type_INT32},
+			{Name: "y", Type: querypb.Type_VARCHAR},
+			{Name: "1", Type: querypb.Type_INT64},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("a")),
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("1")),
+			},
+			{
+				sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("b")),
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("1")),
+			},
+			{
+				sqltypes.NULL,
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("c")),
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("1")),
+			},
+			{
+				sqltypes.MakeTrusted(querypb.Type_INT32, []byte("39")),
+				sqltypes.NULL,
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("1")),
+			},
+		},
+	}
+	querys, err := join.Querys(rs)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(querys))
+	assert.Equal(t, "update sbtest.A6 set x = 'a', z = 1 where id = 1", querys[0].Query)
+	assert.Equal(t, "backend6", querys[0].Backend)
+	assert.Equal(t, "update sbtest.A1 set x = null, z = 1 where id = 39", querys[1].Query)
+	assert.Equal(t, "backend1", querys[1].Backend)
+
+	// No primary key.
+	err = join.Build(nil)
+	assert.Equal(t, "unsupported: table.'A'.has.no.primary.key", err.Error())
+}
+
+func TestJoinDMLDelete(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.CreateDatabase(database)
+	assert.Nil(t, err)
+	err = route.AddForTest(database, router.MockTableMConfig(), router.MockTableBConfig(), router.MockTableGConfig())
+	assert.Nil(t, err)
+
+	// Composite primary key without the shard key.
+	{
+		query := "delete t from A as t join B on t.id = B.k where B.z = 1"
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewDeletePlan(log, database, query, node.(*sqlparser.Delete), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+
+		join := plan.Join
+		err = join.Build([]string{"k1", "k2"})
+		assert.Nil(t, err)
+
+		rs := &sqltypes.Result{
+			Rows: [][]sqltypes.Value{
+				{
+					sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1")),
+					sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("a")),
+					sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1")),
+				},
+				{
+					sqltypes.MakeTrusted(querypb.Type_INT32, []byte("2")),
+					sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("b")),
+					sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1")),
+				},
+				{
+					sqltypes.MakeTrusted(querypb.Type_INT32, []byte("3")),
+					sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("c")),
+					sqltypes.MakeTrusted(querypb.Type_INT32, []byte("39")),
+				},
+			},
+		}
+		querys, err := join.Querys(rs)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(querys))
+		assert.Equal(t, "delete from sbtest.A6 where (k1, k2) in ((1, 'a'), (2, 'b'))", querys[0].Query)
+		assert.Equal(t, "delete from sbtest.A1 where (k1, k2) in ((3, 'c'))", querys[1].Query)
+
+		// The shard key is routed by the type as the INSERT.
+		for _, v := range []sqltypes.Value{
+			sqltypes.MakeTrusted(querypb.Type_DECIMAL, []byte("39.50")),
+			sqltypes.MakeTrusted(querypb.Type_FLOAT64, []byte("39.5")),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("39.5")),
+		} {
+			val := sqlparser.NewFloatVal(v.Raw())
+			if v.IsText() {
+				val = sqlparser.NewStrVal(v.Raw())
+			}
+			want, err := route.Lookup(database, "A", val, val)
+			assert.Nil(t, err)
+			row := []sqltypes.Value{rs.Rows[2][0], rs.Rows[2][1], v}
+			querys, err := join.Querys(&sqltypes.Result{Rows: [][]sqltypes.Value{row}})
+			assert.Nil(t, err)
+			assert.Equal(t, "delete from sbtest."+want[0].Table+" where (k1, k2) in ((3, 'c'))", querys[0].Query)
+		}
+
+		// The shard key is null.
+		rs.Rows[0][2] = sqltypes.NULL
+		_, err = join.Querys(rs)
+		assert.Equal(t, "unsupported: shard.key.of.table.'A'.is.null", err.Error())
+	}
+
+	// The global table is deleted on all the backends.
+	{
+		query := "delete G from G join B on G.id = B.k where B.z = 1"
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewDeletePlan(log, database, query, node.(*sqlparser.Delete), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+
+		join := plan.Join
+		err = join.Build([]string{"id"})
+		assert.Nil(t, err)
+
+		rs := &sqltypes.Result{
+			Rows: [][]sqltypes.Value{
+				{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1"))},
+				{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("2"))},
+			},
+		}
+		querys, err := join.Querys(rs)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(querys))
+		assert.Equal(t, "delete from sbtest.G where id in (1, 2)", querys[0].Query)
+		assert.Equal(t, "backend1", querys[0].Backend)
+		assert.Equal(t, "delete from sbtest.G where id in (1, 2)", querys[1].Query)
+		assert.Equal(t, "backend2", querys[1].Backend)
+	}
+}
@@ -97,6 +97,7 @@ func (p *SelectPlan) JSON() string {
 		Aggregate   []string              `json:",omitempty"`
 		GatherMerge []string              `json:",omitempty"`
 		HashGroupBy []string              `json:",omitempty"`
+		Window      []string              `json:",omitempty"`
 		Limit       *limit                `json:",omitempty"`
 	}
 
@@ -126,6 +127,7 @@ func (p *SelectPlan) JSON() string {
 	var aggregate []string
 	var hashGroup []string
 	var gatherMerge []string
+	var window []string
 	var lim *limit
 	for _, sub := range p.Root.Children() {
 		switch sub.Type() {
@@ -146,6 +148,11 @@ func (p *SelectPlan) JSON() string {
 				}
 				gatherMerge = append(gatherMerge, field)
 			}
+		case builder.ChildTypeWindow:
+			plan := sub.(*builder.WindowPlan)
+			for _, win := range plan.Windows {
+				window = append(window, win.Field)
+			}
 		case builder.ChildTypeLimit:
 			plan := sub.(*builder.LimitPlan)
 			lim = &limit{Offset: plan.Offset, Limit: plan.Limit}
@@ -159,6 +166,7 @@ func (p *SelectPlan) JSON() string {
 		Aggregate:   aggregate,
 		GatherMerge: gatherMerge,
 		HashGroupBy: hashGroup,
+		Window:      window,
 		Limit:       lim,
 	}
 	bout, err := json.MarshalIndent(exp, "", "\t")
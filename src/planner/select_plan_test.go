@@ -257,12 +257,12 @@ func TestSelectPlan(t *testing.T) {
 	"Project": "tmp, b, sum(id), count(id)",
 	"Partitions": [
 		{
-			"Query": "select id as tmp, b, id as ` + "`sum(id)`" + `, id as ` + "`count(id)`" + ` from sbtest.B0 as B group by b order by b asc",
+			"Query": "select sum(distinct id) as tmp, count(distinct id), b, sum(id), count(id) from sbtest.B0 as B group by b order by b asc",
 			"Backend": "backend1",
 			"Range": "[0-512)"
 		},
 		{
-			"Query": "select id as tmp, b, id as ` + "`sum(id)`" + `, id as ` + "`count(id)`" + ` from sbtest.B1 as B group by b order by b asc",
+			"Query": "select sum(distinct id) as tmp, count(distinct id), b, sum(id), count(id) from sbtest.B1 as B group by b order by b asc",
 			"Backend": "backend2",
 			"Range": "[512-4096)"
 		}
@@ -270,6 +270,8 @@ func TestSelectPlan(t *testing.T) {
 	"Aggregate": [
 		"avg(distinct id)",
 		"sum(id)",
+		"count(id)",
+		"sum(id)",
 		"count(id)"
 	],
 	"HashGroupBy": [
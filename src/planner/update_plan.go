@@ -49,6 +49,9 @@ type UpdatePlan struct {
 
 	// query and backend tuple
 	Querys []xcontext.QueryTuple
+
+	// Join is the cross-shard multiple-table update, nil if it's pushed down.
+	Join *JoinDML
 }
 
 // NewUpdatePlan used to create UpdatePlan
@@ -84,6 +87,10 @@ func (p *UpdatePlan) Build() error {
 	}
 
 	node := p.node
+	if node.TableExprs != nil {
+		return p.buildMultiple()
+	}
+
 	// Database.
 	database := p.database
 	if !node.Table.Qualifier.IsEmpty() {
@@ -122,6 +129,58 @@ func (p *UpdatePlan) Build() error {
 	return nil
 }
 
+// buildMultiple used to build the multiple-table update, the updated columns must be qualified.
+// If the tables are co-located, the update is pushed down as-is, otherwise
+// only one table can be updated by the primary keys.
+func (p *UpdatePlan) buildMultiple() error {
+	node := p.node
+	if len(node.OrderBy) > 0 || node.Limit != nil {
+		return errors.New("unsupported: order.by.or.limit.in.multiple-table.update")
+	}
+	tables, err := dmlTables(p.database, node.TableExprs, p.router)
+	if err != nil {
+		return err
+	}
+
+	var target *dmlTable
+	targets := make(map[string]*dmlTable)
+	for _, expr := range node.Exprs {
+		if expr.Name.Qualifier.IsEmpty() {
+			return errors.Errorf("unsupported: column.'%s'.must.be.qualified.in.multiple-table.update", expr.Name.Name.String())
+		}
+		if target, err = lookupTable(tables, expr.Name.Qualifier, "update"); err != nil {
+			return err
+		}
+		if target.conf.ShardKey == expr.Name.Name.String() {
+			return errors.New("unsupported: cannot.update.shard.key")
+		}
+		expr.Name.Qualifier = sqlparser.TableName{Name: sqlparser.NewTableIdent(target.alias)}
+		targets[target.alias] = target
+	}
+
+	join := newJoinDML(p.log, p.database, node.Comments, node.TableExprs, node.Where, p.router)
+	mn, err := buildDMLNode(join, tables, targets)
+	if err != nil {
+		return err
+	}
+	if mn != nil {
+		p.Querys, err = mn.GenerateDMLQuerys(func(buf *sqlparser.TrackedBuffer, sel *sqlparser.Select) {
+			buf.Myprintf("update %v%v set %v%v", node.Comments, sel.From, node.Exprs, sel.Where)
+		})
+		return err
+	}
+
+	if len(targets) > 1 {
+		return errors.New("unsupported: cross-shard.update.of.multiple.tables")
+	}
+	join.exprs = node.Exprs
+	if err := join.setTarget(target); err != nil {
+		return err
+	}
+	p.Join = join
+	return nil
+}
+
 // Type returns the type of the plan.
 func (p *UpdatePlan) Type() PlanType {
 	return p.typ
@@ -132,6 +191,7 @@ func (p *UpdatePlan) JSON() string {
 	type explain struct {
 		RawQuery   string                `json:",omitempty"`
 		Partitions []xcontext.QueryTuple `json:",omitempty"`
+		CrossShard string                `json:",omitempty"`
 	}
 
 	// Partitions.
@@ -141,6 +201,9 @@ func (p *UpdatePlan) JSON() string {
 		RawQuery:   p.RawQuery,
 		Partitions: parts,
 	}
+	if p.Join != nil {
+		exp.CrossShard = p.Join.Target()
+	}
 	bout, err := json.MarshalIndent(exp, "", "\t")
 	if err != nil {
 		return err.Error()
@@ -154,5 +217,8 @@ func (p *UpdatePlan) Size() int {
 	for _, q := range p.Querys {
 		size += len(q.Query)
 	}
+	if p.Join != nil {
+		size += len(p.Join.from)
+	}
 	return size
 }
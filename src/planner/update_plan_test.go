@@ -257,3 +257,119 @@ func TestUpdateDatabaseNotFound(t *testing.T) {
 		assert.NotNil(t, err)
 	}
 }
+
+func TestUpdateMultiplePlan(t *testing.T) {
+	results := []string{
+		`{
+	"RawQuery": "update B join C on B.id = C.a set B.x = C.y where B.id = 1",
+	"Partitions": [
+		{
+			"Query": "update sbtest.B1 as B join sbtest.C1 as C on B.id = C.a set B.x = C.y where B.id = 1",
+			"Backend": "backend2",
+			"Range": "[512-4096)"
+		}
+	]
+}`,
+		`{
+	"RawQuery": "update sbtest.B as b, G set b.x = G.y where b.id = G.id",
+	"Partitions": [
+		{
+			"Query": "update sbtest.B0 as b, sbtest.G as G set b.x = G.y where b.id = G.id",
+			"Backend": "backend1",
+			"Range": "[0-512)"
+		},
+		{
+			"Query": "update sbtest.B1 as b, sbtest.G as G set b.x = G.y where b.id = G.id",
+			"Backend": "backend2",
+			"Range": "[512-4096)"
+		}
+	]
+}`,
+		`{
+	"RawQuery": "update G join G as g2 on G.id = g2.id set G.x = 1 where g2.y = 2",
+	"Partitions": [
+		{
+			"Query": "update sbtest.G as G join sbtest.G as g2 on G.id = g2.id set G.x = 1 where g2.y = 2",
+			"Backend": "backend1",
+			"Range": ""
+		},
+		{
+			"Query": "update sbtest.G as G join sbtest.G as g2 on G.id = g2.id set G.x = 1 where g2.y = 2",
+			"Backend": "backend2",
+			"Range": ""
+		}
+	]
+}`,
+		`{
+	"RawQuery": "update A join B on A.id = B.k set A.x = B.y where B.z = 1",
+	"CrossShard": "sbtest.A"
+}`,
+		`{
+	"RawQuery": "update G join B on G.id = B.id set G.x = B.y where B.z = 1",
+	"CrossShard": "sbtest.G"
+}`,
+	}
+	querys := []string{
+		"update B join C on B.id = C.a set B.x = C.y where B.id = 1",
+		"update sbtest.B as b, G set b.x = G.y where b.id = G.id",
+		"update G join G as g2 on G.id = g2.id set G.x = 1 where g2.y = 2",
+		"update A join B on A.id = B.k set A.x = B.y where B.z = 1",
+		"update G join B on G.id = B.id set G.x = B.y where B.z = 1",
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.CreateDatabase(database)
+	assert.Nil(t, err)
+	err = route.AddForTest(database, router.MockTableMConfig(), router.MockTableBConfig(), router.MockTableCConfig(), router.MockTableGConfig())
+	assert.Nil(t, err)
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewUpdatePlan(log, database, query, node.(*sqlparser.Update), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, results[i], plan.JSON())
+	}
+}
+
+func TestUpdateMultipleUnsupportedPlan(t *testing.T) {
+	querys := []string{
+		"update A join B on A.id = B.k set A.x = B.y, B.x = 1 where B.z = 1",
+		"update A join B on A.id = B.k set x = B.y where B.z = 1",
+		"update A join B on A.id = B.k set A.id = B.y where B.z = 1",
+		"update A join B on A.id = B.k set A.x = B.y where B.z = 1 limit 1",
+		"update A join B on A.id = B.k set X.x = B.y where B.z = 1",
+		"update A join B on A.id = B.k set A.x = B.y",
+	}
+	results := []string{
+		"unsupported: cross-shard.update.of.multiple.tables",
+		"unsupported: column.'x'.must.be.qualified.in.multiple-table.update",
+		"unsupported: cannot.update.shard.key",
+		"unsupported: order.by.or.limit.in.multiple-table.update",
+		"unsupported: unknown.table.'X'.in.multi.update",
+		"unsupported: missing.where.clause.in.DML",
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.CreateDatabase(database)
+	assert.Nil(t, err)
+	err = route.AddForTest(database, router.MockTableMConfig(), router.MockTableBConfig())
+	assert.Nil(t, err)
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewUpdatePlan(log, database, query, node.(*sqlparser.Update), route)
+		err = plan.Build()
+		assert.Equal(t, results[i], err.Error())
+	}
+}
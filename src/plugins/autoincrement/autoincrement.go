@@ -9,42 +9,51 @@
 package autoincrement
 
 import (
+	"fmt"
 	"sync"
-	"time"
 
+	"backend"
+	"config"
+	"plugins/sequence"
 	"router"
+	"xcontext"
 
 	"github.com/xelabs/go-mysqlstack/sqlparser"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
 // AutoIncrement struct.
-// Using Now().UnixNano as start seed seq.
+// The values are allocated from the sequence named by the table, the sequence is created
+// at the first insert with the start value max(column)+1 of the table.
 type AutoIncrement struct {
-	mu     sync.Mutex
-	log    *xlog.Log
-	seq    uint64
-	router *router.Router
+	mu       sync.Mutex
+	log      *xlog.Log
+	router   *router.Router
+	scatter  *backend.Scatter
+	sequence sequence.SequenceHandler
+	seeded   map[string]bool
 }
 
 // NewAutoIncrement -- creates new AutoIncrement.
-func NewAutoIncrement(log *xlog.Log, router *router.Router) AutoIncrementHandler {
+func NewAutoIncrement(log *xlog.Log, router *router.Router, scatter *backend.Scatter, sequence sequence.SequenceHandler) AutoIncrementHandler {
 	return &AutoIncrement{
-		log:    log,
-		router: router,
+		log:      log,
+		router:   router,
+		scatter:  scatter,
+		sequence: sequence,
+		seeded:   make(map[string]bool),
 	}
 }
 
 // Init -- used to init the plug module.
 func (autoinc *AutoIncrement) Init() error {
-	autoinc.seq = uint64(time.Now().UnixNano())
 	return nil
 }
 
 // Process -- process auto-increment.
 // Append the auto-increment column&value to the end of the row if not exists.
-func (autoinc *AutoIncrement) Process(database string, ins *sqlparser.Insert) error {
-	var seq uint64
+// Returns the first generated value, 0 if no value generated.
+func (autoinc *AutoIncrement) Process(database string, ins *sqlparser.Insert) (uint64, error) {
 	router := autoinc.router
 
 	// Qualifier is database in the insert query, such as "db.t1".
@@ -55,25 +64,79 @@ func (autoinc *AutoIncrement) Process(database string, ins *sqlparser.Insert) er
 
 	tblInfo, err := router.TableConfig(database, table)
 	if err != nil {
-		return err
+		return 0, err
 	}
-
-	// Get seq(thread-safe).
-	autoinc.mu.Lock()
-	seq = autoinc.seq
-	switch rows := ins.Rows.(type) {
-	case sqlparser.Values:
-		autoinc.seq += uint64(len(rows))
+	if tblInfo.AutoIncrement == nil {
+		return 0, nil
 	}
-	autoinc.mu.Unlock()
 
-	if tblInfo.AutoIncrement != nil {
-		modifyForAutoinc(ins, tblInfo.AutoIncrement, seq)
+	rows := autoincRows(ins, tblInfo.AutoIncrement)
+	if len(rows) == 0 {
+		return 0, nil
 	}
-	return nil
+	if err := autoinc.seed(database, table, tblInfo.AutoIncrement); err != nil {
+		return 0, err
+	}
+	seqs, err := autoinc.sequence.Next(database, table, len(rows))
+	if err != nil {
+		return 0, err
+	}
+	modifyForAutoinc(ins, tblInfo.AutoIncrement, seqs)
+	return seqs[0], nil
 }
 
 // Close -- close the plugin.
 func (autoinc *AutoIncrement) Close() error {
 	return nil
 }
+
+// seed used to create the sequence of the table if not exists, the start value is max(column)+1 of all the shards.
+func (autoinc *AutoIncrement) seed(database string, table string, conf *config.AutoIncrement) error {
+	key := database + "." + table
+	autoinc.mu.Lock()
+	defer autoinc.mu.Unlock()
+	if autoinc.seeded[key] {
+		return nil
+	}
+
+	segments, err := autoinc.router.Lookup(database, table, nil, nil)
+	if err != nil {
+		return err
+	}
+	querys := make([]xcontext.QueryTuple, 0, len(segments))
+	for _, segment := range segments {
+		querys = append(querys, xcontext.QueryTuple{
+			Query:   fmt.Sprintf("select ifnull(max(%s), 0) from %s.%s", sqlparser.String(sqlparser.NewColIdent(conf.Column)), database, segment.Table),
+			Backend: segment.Backend,
+			Range:   segment.Range.String(),
+		})
+	}
+
+	txn, err := autoinc.scatter.CreateTransaction()
+	if err != nil {
+		return err
+	}
+	defer txn.Finish()
+	qr, err := txn.Execute(&xcontext.RequestContext{Mode: xcontext.ReqNormal, Querys: querys})
+	if err != nil {
+		return err
+	}
+
+	var max uint64
+	for _, row := range qr.Rows {
+		v, err := row[0].ParseUint64()
+		if err != nil {
+			return err
+		}
+		if v > max {
+			max = v
+		}
+	}
+
+	if err := autoinc.sequence.Create(database, table, max+1, 1, autoinc.sequence.DefaultCache(), true); err != nil {
+		return err
+	}
+	autoinc.seeded[key] = true
+	autoinc.log.Info("autoincrement[%s].seeded.from.max[%d]", key, max)
+	return nil
+}
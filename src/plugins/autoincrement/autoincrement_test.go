@@ -11,8 +11,10 @@ package autoincrement
 import (
 	"testing"
 
+	"backend"
 	"config"
 	"errors"
+	"plugins/sequence"
 	"router"
 
 	"github.com/stretchr/testify/assert"
@@ -106,7 +108,7 @@ func TestPluginAutoincModifyForAutoinc(t *testing.T) {
 		node, err := sqlparser.Parse(test.query)
 		assert.Nil(t, err)
 		insert := node.(*sqlparser.Insert)
-		modifyForAutoinc(insert, test.autoinc, 65535)
+		modifyForAutoinc(insert, test.autoinc, []uint64{65536, 65537, 65538})
 
 		buf := sqlparser.NewTrackedBuffer(nil)
 		insert.Format(buf)
@@ -124,8 +126,15 @@ func TestPluginAutoIncrement(t *testing.T) {
 
 	err := route.CreateDatabase(db)
 	assert.Nil(t, err)
+
+	// Scatter.
+	scatter, fakedbs, scleanup := backend.MockScatter(log, 2)
+	defer scleanup()
+	MockInitAutoIncrement(fakedbs)
+
 	// Plugin.
-	autoplug := NewAutoIncrement(log, route)
+	seqplug := sequence.NewSequence(log, nil, route, scatter)
+	autoplug := NewAutoIncrement(log, route, scatter, seqplug)
 	err = autoplug.Init()
 	assert.Nil(t, err)
 	defer autoplug.Close()
@@ -133,50 +142,58 @@ func TestPluginAutoIncrement(t *testing.T) {
 	tests := []struct {
 		query   string
 		want    string
+		id      uint64
 		tblconf *config.TableConfig
 	}{
 		{
 			query: "insert into t1(b) values(1),(2),(3)",
-			want:  "insert into db1.t1(b, a)",
+			want:  "insert into t1(b, id) values (1, 1), (2, 2), (3, 3)",
+			id:    1,
 			tblconf: &config.TableConfig{
 				Name:          "t1",
 				ShardType:     "GLOBAL",
+				Partitions:    []*config.PartitionConfig{{Table: "t1", Backend: "backend0"}},
 				AutoIncrement: &config.AutoIncrement{Column: "id"},
 			},
 		},
 		{
-			query: "insert into db1.t2(b) values(1),(2),(3)",
-			want:  "insert into db1.t2(b, a)",
-			tblconf: &config.TableConfig{
-				Name:          "t2",
-				ShardType:     "GLOBAL",
-				AutoIncrement: &config.AutoIncrement{Column: "id"},
-			},
+			query: "insert into db1.t1(b) values(1)",
+			want:  "insert into db1.t1(b, id) values (1, 4)",
+			id:    4,
+		},
+		{
+			query: "insert into db1.t1(id, b) values(100, 1)",
+			want:  "insert into db1.t1(id, b) values (100, 1)",
 		},
 		{
 			query: "insert into db1.t3(b) values(1),(2),(3)",
-			want:  "insert into db1.t3(b, a)",
+			want:  "insert into db1.t3(b) values (1), (2), (3)",
 			tblconf: &config.TableConfig{
-				Name:      "t3",
-				ShardType: "GLOBAL",
+				Name:       "t3",
+				ShardType:  "GLOBAL",
+				Partitions: []*config.PartitionConfig{{Table: "t3", Backend: "backend0"}},
 			},
 		},
 	}
 
 	for _, test := range tests {
 		// Add router table config.
-		route.AddForTest(db, test.tblconf)
+		if test.tblconf != nil {
+			err := route.AddForTest(db, test.tblconf)
+			assert.Nil(t, err)
+		}
 
 		// Parse.
 		node, err := sqlparser.Parse(test.query)
 		assert.Nil(t, err)
 		insert := node.(*sqlparser.Insert)
-		err = autoplug.Process(db, insert)
+		id, err := autoplug.Process(db, insert)
 		assert.Nil(t, err)
+		assert.Equal(t, test.id, id)
 
 		// Check.
 		buf := sqlparser.NewTrackedBuffer(nil)
 		insert.Format(buf)
-		log.Debug("%v", buf.String())
+		assert.Equal(t, test.want, buf.String())
 	}
 }
@@ -24,7 +24,7 @@ var (
 
 type AutoIncrementHandler interface {
 	Init() error
-	Process(database string, ins *sqlparser.Insert) error
+	Process(database string, ins *sqlparser.Insert) (uint64, error)
 	Close() error
 }
 
@@ -47,24 +47,36 @@ func GetAutoIncrement(node *sqlparser.DDL) (*config.AutoIncrement, error) {
 	return nil, nil
 }
 
-func modifyForAutoinc(ins *sqlparser.Insert, autoinc *config.AutoIncrement, seq uint64) {
+// autoincRows returns the rows need the auto-increment values, nil if the insert has the autoinc column.
+func autoincRows(ins *sqlparser.Insert, autoinc *config.AutoIncrement) sqlparser.Values {
 	col := sqlparser.NewColIdent(autoinc.Column)
 
 	// Insert has autoinc column.
 	for _, column := range ins.Columns {
 		if col.Equal(column) {
-			return
+			return nil
 		}
 	}
 
+	rows, ok := ins.Rows.(sqlparser.Values)
+	if !ok {
+		return nil
+	}
+	return rows
+}
+
+func modifyForAutoinc(ins *sqlparser.Insert, autoinc *config.AutoIncrement, seqs []uint64) {
+	rows := autoincRows(ins, autoinc)
+	if rows == nil {
+		return
+	}
+
 	// Insert does not has autoinc column
 	// 1. append column info to the end.
-	ins.Columns = append(ins.Columns, col)
+	ins.Columns = append(ins.Columns, sqlparser.NewColIdent(autoinc.Column))
 
 	// 2. append vals to each row's end.
-	rows := ins.Rows.(sqlparser.Values)
 	for i := range rows {
-		seq++
-		rows[i] = append(rows[i], sqlparser.NewIntVal([]byte(strconv.FormatUint(seq, 10))))
+		rows[i] = append(rows[i], sqlparser.NewIntVal([]byte(strconv.FormatUint(seqs[i], 10))))
 	}
 }
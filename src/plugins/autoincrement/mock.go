@@ -0,0 +1,40 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package autoincrement
+
+import (
+	"fakedb"
+	"plugins/sequence"
+
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+var (
+	// MaxRs is the result of the max auto-increment value of the shard.
+	MaxRs = &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{
+				Name: "max",
+				Type: querypb.Type_INT64,
+			},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("0")),
+			},
+		},
+	}
+)
+
+// MockInitAutoIncrement used to mock the sequence storage and the max values of the tables.
+func MockInitAutoIncrement(fakedbs *fakedb.DB) {
+	sequence.MockInitSequence(fakedbs)
+	fakedbs.AddQueryPattern("select ifnull\\(max\\(.*", MaxRs)
+}
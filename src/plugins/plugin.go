@@ -15,6 +15,7 @@ import (
 
 	"plugins/autoincrement"
 	"plugins/privilege"
+	"plugins/sequence"
 	"plugins/shiftmanager"
 
 	"github.com/xelabs/go-mysqlstack/xlog"
@@ -26,6 +27,7 @@ type Plugin struct {
 	conf          *config.Config
 	router        *router.Router
 	scatter       *backend.Scatter
+	sequence      sequence.SequenceHandler
 	autoincrement autoincrement.AutoIncrementHandler
 	privilege     privilege.PrivilegeHandler
 	shiftMgr      shiftmanager.ShiftMgrHandler
@@ -48,8 +50,15 @@ func (plugin *Plugin) Init() error {
 	scatter := plugin.scatter
 	config := plugin.conf
 
+	// Register sequence plug.
+	sequencePlug := sequence.NewSequence(log, config, router, scatter)
+	if err := sequencePlug.Init(); err != nil {
+		return err
+	}
+	plugin.sequence = sequencePlug
+
 	// Register AutoIncrement plug.
-	autoincPlug := autoincrement.NewAutoIncrement(log, router)
+	autoincPlug := autoincrement.NewAutoIncrement(log, router, scatter, sequencePlug)
 	if err := autoincPlug.Init(); err != nil {
 		return err
 	}
@@ -75,10 +84,16 @@ func (plugin *Plugin) Init() error {
 // Close -- do nothing.
 func (plugin *Plugin) Close() {
 	plugin.autoincrement.Close()
+	plugin.sequence.Close()
 	plugin.privilege.Close()
 	plugin.shiftMgr.Close()
 }
 
+// PlugSequence -- return Sequence plug.
+func (plugin *Plugin) PlugSequence() sequence.SequenceHandler {
+	return plugin.sequence
+}
+
 // PlugAutoIncrement -- return AutoIncrement plug.
 func (plugin *Plugin) PlugAutoIncrement() autoincrement.AutoIncrementHandler {
 	return plugin.autoincrement
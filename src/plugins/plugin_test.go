@@ -32,6 +32,9 @@ func TestPlugins(t *testing.T) {
 	assert.Nil(t, err)
 	defer plugin.Close()
 
+	sequencePlug := plugin.PlugSequence()
+	assert.NotNil(t, sequencePlug)
+
 	autoincPlug := plugin.PlugAutoIncrement()
 	assert.NotNil(t, autoincPlug)
 
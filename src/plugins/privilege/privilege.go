@@ -123,6 +123,8 @@ func (p *Privilege) CheckPrivilege(db string, user string, node sqlparser.Statem
 			return (userpriv.priv.superPriv || userpriv.priv.selectPriv || dbpriv.priv.selectPriv)
 		case *sqlparser.Insert:
 			return (userpriv.priv.superPriv || userpriv.priv.insertPriv || dbpriv.priv.insertPriv)
+		case *sqlparser.LoadData:
+			return (userpriv.priv.superPriv || userpriv.priv.insertPriv || dbpriv.priv.insertPriv)
 		case *sqlparser.Update:
 			return (userpriv.priv.superPriv || userpriv.priv.updatePriv || dbpriv.priv.updatePriv)
 		case *sqlparser.Delete:
@@ -134,6 +136,11 @@ func (p *Privilege) CheckPrivilege(db string, user string, node sqlparser.Statem
 			//TODO: just grant part of the oprations and support
 			db := (dbpriv.priv.createPriv && dbpriv.priv.dropPriv && dbpriv.priv.alterPriv && dbpriv.priv.indexPriv)
 			return (userpriv.priv.superPriv || user || db)
+		case *sqlparser.Sequence:
+			if node.(*sqlparser.Sequence).Action == sqlparser.DropSequenceStr {
+				return (userpriv.priv.superPriv || userpriv.priv.dropPriv || dbpriv.priv.dropPriv)
+			}
+			return (userpriv.priv.superPriv || userpriv.priv.createPriv || dbpriv.priv.createPriv)
 		default:
 			log.Error("plugin.privileges.unsupported[%T]", node)
 			return false
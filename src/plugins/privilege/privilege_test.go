@@ -63,6 +63,14 @@ func TestLoadUserPrivilege(t *testing.T) {
 			err:  "",
 		},
 
+		{
+			name: "load.data.ok",
+			db:   "test",
+			user: "mock",
+			sql:  "load data local infile 'a.txt' into table t1",
+			err:  "",
+		},
+
 		{
 			name: "update.ok",
 			db:   "test",
@@ -103,6 +111,22 @@ func TestLoadUserPrivilege(t *testing.T) {
 			err:  "",
 		},
 
+		{
+			name: "sequence.ok",
+			db:   "test",
+			user: "mock",
+			sql:  "create sequence s1",
+			err:  "",
+		},
+
+		{
+			name: "sequence.ok",
+			db:   "test",
+			user: "mock",
+			sql:  "drop sequence test.s1",
+			err:  "",
+		},
+
 		{
 			name: "node.nil.ok",
 			db:   "test",
@@ -182,6 +206,14 @@ func TestLoadUserPrivilegeDenied(t *testing.T) {
 			sql:  "show table status",
 			err:  "Access denied for user 'mock'@'%' to database 'test' (errno 1045) (sqlstate 28000)",
 		},
+
+		{
+			name: "sequence.denied",
+			db:   "test",
+			user: "mock",
+			sql:  "create sequence s1",
+			err:  "Access denied for user 'mock'@'%' to database 'test' (errno 1045) (sqlstate 28000)",
+		},
 	}
 
 	for _, test := range tests {
@@ -0,0 +1,19 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package sequence
+
+// SequenceHandler interface.
+type SequenceHandler interface {
+	Init() error
+	Create(database string, name string, start uint64, increment uint64, cache uint64, ifNotExists bool) error
+	Drop(database string, name string, ifExists bool) error
+	Next(database string, name string, n int) ([]uint64, error)
+	DefaultCache() uint64
+	Close() error
+}
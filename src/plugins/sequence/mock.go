@@ -0,0 +1,54 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package sequence
+
+import (
+	"fakedb"
+
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+var (
+	// MetaRs is the result of the sequence increment and cache.
+	MetaRs = &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{
+				Name: "increment",
+				Type: querypb.Type_UINT64,
+			},
+			{
+				Name: "cache",
+				Type: querypb.Type_UINT64,
+			},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_UINT64, []byte("1")),
+				sqltypes.MakeTrusted(querypb.Type_UINT64, []byte("1000")),
+			},
+		},
+	}
+
+	// AllocateRs is the result of the allocation, the segment is [1, 1001).
+	AllocateRs = &sqltypes.Result{
+		RowsAffected: 1,
+		InsertID:     1001,
+	}
+)
+
+// MockInitSequence used to mock the sequence storage on the backends.
+func MockInitSequence(fakedbs *fakedb.DB) {
+	fakedbs.AddQueryPattern("create database if not exists radon", &sqltypes.Result{})
+	fakedbs.AddQueryPattern("create table if not exists radon.sequences.*", &sqltypes.Result{})
+	fakedbs.AddQueryPattern("insert ignore into radon.sequences.*", &sqltypes.Result{RowsAffected: 1})
+	fakedbs.AddQueryPattern("delete from radon.sequences .*", &sqltypes.Result{RowsAffected: 1})
+	fakedbs.AddQueryPattern("select increment, cache from radon.sequences .*", MetaRs)
+	fakedbs.AddQueryPattern("update radon.sequences set next_value = last_insert_id.*", AllocateRs)
+}
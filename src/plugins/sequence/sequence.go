@@ -0,0 +1,304 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package sequence
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"backend"
+	"config"
+	"metastore"
+	"router"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const (
+	// defaultCache is the values allocated per round trip if the sequence-cache is not configured.
+	defaultCache = 1000
+
+	// sequenceDatabase is the database of the sequence table on the backend.
+	sequenceDatabase = "radon"
+
+	// sequenceTable stores the sequences on the sequence backend.
+	sequenceTable = sequenceDatabase + ".sequences"
+
+	// sequenceKey is the key of the sequence backend pinned in the metastore.
+	sequenceKey = "sequence.json"
+
+	sequencePinRetries = 3
+)
+
+// sequencePin is the backend which stores the sequences, it's pinned in the metastore on the first use.
+type sequencePin struct {
+	Backend string `json:"backend"`
+}
+
+// segment is the values allocated from the storage but not handed out: [next, end) by the increment.
+type segment struct {
+	mu        sync.Mutex
+	loaded    bool
+	increment uint64
+	cache     uint64
+	next      uint64
+	end       uint64
+}
+
+// Sequence struct.
+// The next_value of the sequence row is the first value not allocated yet, every proxy grabs
+// a segment of the values by one atomic UPDATE and hands them out from the memory, so the values
+// are unique across the proxies and monotonic in one proxy.
+type Sequence struct {
+	mu       sync.Mutex
+	log      *xlog.Log
+	conf     *config.Config
+	router   *router.Router
+	scatter  *backend.Scatter
+	created  bool
+	pinned   string
+	segments map[string]*segment
+}
+
+// NewSequence -- creates new Sequence.
+func NewSequence(log *xlog.Log, conf *config.Config, router *router.Router, scatter *backend.Scatter) SequenceHandler {
+	return &Sequence{
+		log:      log,
+		conf:     conf,
+		router:   router,
+		scatter:  scatter,
+		segments: make(map[string]*segment),
+	}
+}
+
+// Init -- used to init the plug module.
+// The sequence table is created lazily, the backends may not be attached yet.
+func (s *Sequence) Init() error {
+	return nil
+}
+
+// DefaultCache returns the configured sequence-cache.
+func (s *Sequence) DefaultCache() uint64 {
+	if s.conf != nil && s.conf.Proxy != nil && s.conf.Proxy.SequenceCache > 0 {
+		return uint64(s.conf.Proxy.SequenceCache)
+	}
+	return defaultCache
+}
+
+// Create -- creates the sequence, the next value is start.
+func (s *Sequence) Create(database string, name string, start uint64, increment uint64, cache uint64, ifNotExists bool) error {
+	if increment == 0 {
+		return errors.Errorf("sequence.'%s.%s'.increment.must.be.positive", database, name)
+	}
+	if cache == 0 {
+		return errors.Errorf("sequence.'%s.%s'.cache.must.be.positive", database, name)
+	}
+
+	query := fmt.Sprintf("insert ignore into %s(db, name, next_value, increment, cache) values (%s, %s, %d, %d, %d)", sequenceTable, quote(database), quote(name), start, increment, cache)
+	qr, err := s.execute(query)
+	if err != nil {
+		return err
+	}
+	if qr.RowsAffected == 0 && !ifNotExists {
+		return errors.Errorf("sequence.'%s.%s'.already.exists", database, name)
+	}
+	return nil
+}
+
+// Drop -- drops the sequence and the cached values.
+func (s *Sequence) Drop(database string, name string, ifExists bool) error {
+	query := fmt.Sprintf("delete from %s where db = %s and name = %s", sequenceTable, quote(database), quote(name))
+	qr, err := s.execute(query)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.segments, key(database, name))
+	s.mu.Unlock()
+
+	if qr.RowsAffected == 0 && !ifExists {
+		return errors.Errorf("sequence.'%s.%s'.doesn't.exist", database, name)
+	}
+	return nil
+}
+
+// Next -- returns the next n values of the sequence.
+func (s *Sequence) Next(database string, name string, n int) ([]uint64, error) {
+	s.mu.Lock()
+	seg, ok := s.segments[key(database, name)]
+	if !ok {
+		seg = &segment{}
+		s.segments[key(database, name)] = seg
+	}
+	s.mu.Unlock()
+
+	seg.mu.Lock()
+	defer seg.mu.Unlock()
+	if !seg.loaded {
+		if err := s.load(database, name, seg); err != nil {
+			return nil, err
+		}
+	}
+
+	values := make([]uint64, 0, n)
+	for len(values) < n {
+		if seg.next >= seg.end {
+			count := seg.cache
+			if rest := uint64(n - len(values)); rest > count {
+				count = rest
+			}
+			if err := s.allocate(database, name, seg, count); err != nil {
+				return nil, err
+			}
+		}
+		values = append(values, seg.next)
+		seg.next += seg.increment
+	}
+	return values, nil
+}
+
+// Close -- close the plugin.
+func (s *Sequence) Close() error {
+	return nil
+}
+
+// load used to load the increment and cache of the sequence, they are immutable after created.
+func (s *Sequence) load(database string, name string, seg *segment) error {
+	query := fmt.Sprintf("select increment, cache from %s where db = %s and name = %s", sequenceTable, quote(database), quote(name))
+	qr, err := s.execute(query)
+	if err != nil {
+		return err
+	}
+	if len(qr.Rows) == 0 {
+		return errors.Errorf("sequence.'%s.%s'.doesn't.exist", database, name)
+	}
+
+	row := qr.Rows[0]
+	if seg.increment, err = row[0].ParseUint64(); err != nil {
+		return err
+	}
+	if seg.cache, err = row[1].ParseUint64(); err != nil {
+		return err
+	}
+	seg.loaded = true
+	return nil
+}
+
+// allocate used to grab count values from the storage, the new next_value is returned by the insert id:
+// update radon.sequences set next_value = last_insert_id(next_value + 1000) where db = 'db1' and name = 's1'.
+func (s *Sequence) allocate(database string, name string, seg *segment, count uint64) error {
+	delta := seg.increment * count
+	query := fmt.Sprintf("update %s set next_value = last_insert_id(next_value + %d) where db = %s and name = %s", sequenceTable, delta, quote(database), quote(name))
+	qr, err := s.execute(query)
+	if err != nil {
+		return err
+	}
+	if qr.RowsAffected == 0 {
+		seg.loaded = false
+		return errors.Errorf("sequence.'%s.%s'.doesn't.exist", database, name)
+	}
+
+	seg.next = qr.InsertID - delta
+	seg.end = qr.InsertID
+	s.log.Info("sequence[%s.%s].allocate.values[%d, %d)", database, name, seg.next, seg.end)
+	return nil
+}
+
+// backend returns the backend which stores the sequences, it's the sequence-backend of the config,
+// or the first backend pinned in the metastore on the first use, so the attached backends never move it.
+func (s *Sequence) backend() (string, error) {
+	if s.conf != nil && s.conf.Proxy != nil && s.conf.Proxy.SequenceBackend != "" {
+		return s.conf.Proxy.SequenceBackend, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pinned != "" {
+		return s.pinned, nil
+	}
+	store := s.router.MetaStore()
+	for i := 0; i < sequencePinRetries; i++ {
+		pin := &sequencePin{}
+		kv, err := store.Get(sequenceKey)
+		switch err {
+		case nil:
+			if err := json.Unmarshal(kv.Value, pin); err != nil {
+				return "", errors.WithStack(err)
+			}
+		case metastore.ErrNotFound:
+			backends := s.scatter.Backends()
+			if len(backends) == 0 {
+				return "", errors.New("sequence.no.backends")
+			}
+			pin.Backend = backends[0]
+			data, err := json.Marshal(pin)
+			if err != nil {
+				return "", errors.WithStack(err)
+			}
+			if _, err := store.Put(sequenceKey, data, metastore.RevisionNotExist); err != nil {
+				if err == metastore.ErrConflict {
+					continue
+				}
+				return "", err
+			}
+			s.log.Warning("sequence.pin.the.storage.to.backend[%s]", pin.Backend)
+		default:
+			return "", err
+		}
+		s.pinned = pin.Backend
+		return s.pinned, nil
+	}
+	return "", errors.New("sequence.pin.backend.too.many.conflicts")
+}
+
+// execute used to execute the query on the sequence backend, the sequence table is created if not exists.
+func (s *Sequence) execute(query string) (*sqltypes.Result, error) {
+	backend, err := s.backend()
+	if err != nil {
+		return nil, err
+	}
+
+	txn, err := s.scatter.CreateTransaction()
+	if err != nil {
+		return nil, err
+	}
+	defer txn.Finish()
+
+	s.mu.Lock()
+	created := s.created
+	s.mu.Unlock()
+	if !created {
+		creates := []string{
+			fmt.Sprintf("create database if not exists %s", sequenceDatabase),
+			fmt.Sprintf("create table if not exists %s(db varchar(64) not null, name varchar(64) not null, next_value bigint unsigned not null, increment bigint unsigned not null, cache bigint unsigned not null, primary key(db, name))", sequenceTable),
+		}
+		for _, create := range creates {
+			if _, err := txn.ExecuteOnThisBackend(backend, create); err != nil {
+				return nil, err
+			}
+		}
+		s.mu.Lock()
+		s.created = true
+		s.mu.Unlock()
+	}
+	return txn.ExecuteOnThisBackend(backend, query)
+}
+
+func key(database string, name string) string {
+	return database + "." + name
+}
+
+func quote(s string) string {
+	return sqlparser.String(sqlparser.NewStrVal([]byte(s)))
+}
@@ -0,0 +1,181 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package sequence
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"backend"
+	"config"
+	"metastore"
+	"router"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestSequence(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 3)
+	defer cleanup()
+	route, rcleanup := router.MockNewRouter(log)
+	defer rcleanup()
+	err := route.CreateDatabase("db1")
+	assert.Nil(t, err)
+
+	MockInitSequence(fakedbs)
+
+	seq := NewSequence(log, nil, route, scatter)
+	err = seq.Init()
+	assert.Nil(t, err)
+	defer seq.Close()
+
+	assert.Equal(t, uint64(1000), seq.DefaultCache())
+
+	err = seq.Create("db1", "s1", 1, 1, 1000, false)
+	assert.Nil(t, err)
+
+	values, err := seq.Next("db1", "s1", 3)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 2, 3}, values)
+
+	values, err = seq.Next("db1", "s1", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{4}, values)
+
+	err = seq.Drop("db1", "s1", false)
+	assert.Nil(t, err)
+}
+
+func TestSequenceAllocate(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 3)
+	defer cleanup()
+	route, rcleanup := router.MockNewRouter(log)
+	defer rcleanup()
+	err := route.CreateDatabase("db1")
+	assert.Nil(t, err)
+
+	conf := &config.Config{Proxy: config.DefaultProxyConfig()}
+	conf.Proxy.SequenceCache = 2
+	seq := NewSequence(log, conf, route, scatter)
+	assert.Equal(t, uint64(2), seq.DefaultCache())
+
+	// Increment 5, cache 2: the first segment is [1, 11).
+	fakedbs.AddQueryPattern("create database if not exists radon", &sqltypes.Result{})
+	fakedbs.AddQueryPattern("create table if not exists radon.sequences.*", &sqltypes.Result{})
+	fakedbs.AddQueryPattern("select increment, cache from radon.sequences .*", &sqltypes.Result{
+		Fields: MetaRs.Fields,
+		Rows:   [][]sqltypes.Value{{sqltypes.NewUint64(5), sqltypes.NewUint64(2)}},
+	})
+	fakedbs.AddQuery("update radon.sequences set next_value = last_insert_id(next_value + 10) where db = 'db1' and name = 's1'", &sqltypes.Result{RowsAffected: 1, InsertID: 11})
+	fakedbs.AddQuery("update radon.sequences set next_value = last_insert_id(next_value + 15) where db = 'db1' and name = 's1'", &sqltypes.Result{RowsAffected: 1, InsertID: 26})
+
+	values, err := seq.Next("db1", "s1", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1}, values)
+
+	// The rest of the segment and 3 values more than the cache.
+	values, err = seq.Next("db1", "s1", 4)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{6, 11, 16, 21}, values)
+}
+
+func TestSequenceError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 3)
+	defer cleanup()
+	route, rcleanup := router.MockNewRouter(log)
+	defer rcleanup()
+	err := route.CreateDatabase("db1")
+	assert.Nil(t, err)
+
+	seq := NewSequence(log, nil, route, scatter)
+	fakedbs.AddQueryPattern("create database if not exists radon", &sqltypes.Result{})
+	fakedbs.AddQueryPattern("create table if not exists radon.sequences.*", &sqltypes.Result{})
+	fakedbs.AddQueryPattern("insert ignore into radon.sequences.*", &sqltypes.Result{})
+	fakedbs.AddQueryPattern("delete from radon.sequences .*", &sqltypes.Result{})
+	fakedbs.AddQueryPattern("select increment, cache from radon.sequences where db = 'db1' and name = 's1'", &sqltypes.Result{})
+	fakedbs.AddQueryPattern("select increment, cache from radon.sequences where db = 'db1' and name = 's2'", MetaRs)
+	fakedbs.AddQueryPattern("update radon.sequences .*", &sqltypes.Result{})
+
+	err = seq.Create("db1", "s1", 1, 0, 1000, false)
+	assert.Equal(t, "sequence.'db1.s1'.increment.must.be.positive", err.Error())
+	err = seq.Create("db1", "s1", 1, 1, 0, false)
+	assert.Equal(t, "sequence.'db1.s1'.cache.must.be.positive", err.Error())
+
+	// Exists.
+	err = seq.Create("db1", "s1", 1, 1, 1000, false)
+	assert.Equal(t, "sequence.'db1.s1'.already.exists", err.Error())
+	err = seq.Create("db1", "s1", 1, 1, 1000, true)
+	assert.Nil(t, err)
+
+	// Not exists.
+	err = seq.Drop("db1", "s1", false)
+	assert.Equal(t, "sequence.'db1.s1'.doesn't.exist", err.Error())
+	err = seq.Drop("db1", "s1", true)
+	assert.Nil(t, err)
+	_, err = seq.Next("db1", "s1", 1)
+	assert.Equal(t, "sequence.'db1.s1'.doesn't.exist", err.Error())
+
+	// Dropped by others.
+	_, err = seq.Next("db1", "s2", 1)
+	assert.Equal(t, "sequence.'db1.s2'.doesn't.exist", err.Error())
+
+	// Storage error.
+	fakedbs.ResetAll()
+	fakedbs.AddQueryErrorPattern("create database if not exists radon", errors.New("mock.create.error"))
+	seq = NewSequence(log, nil, route, scatter)
+	err = seq.Create("db1", "s1", 1, 1, 1000, false)
+	assert.NotNil(t, err)
+}
+
+func TestSequencePinBackend(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 3)
+	defer cleanup()
+	route, rcleanup := router.MockNewRouter(log)
+	defer rcleanup()
+	err := route.CreateDatabase("db1")
+	assert.Nil(t, err)
+	MockInitSequence(fakedbs)
+
+	// The first backend is pinned on the first use.
+	{
+		seq := NewSequence(log, nil, route, scatter)
+		err := seq.Create("db1", "s1", 1, 1, 1000, false)
+		assert.Nil(t, err)
+		kv, err := route.MetaStore().Get(sequenceKey)
+		assert.Nil(t, err)
+		assert.Equal(t, `{"backend":"`+scatter.Backends()[0]+`"}`, string(kv.Value))
+	}
+
+	// The pinned backend is used even it's not the first one.
+	{
+		_, err := route.MetaStore().Put(sequenceKey, []byte(`{"backend":"xx"}`), metastore.RevisionAny)
+		assert.Nil(t, err)
+		seq := NewSequence(log, nil, route, scatter)
+		_, err = seq.Next("db1", "s1", 1)
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "xx"))
+	}
+
+	// The sequence-backend of the config wins.
+	{
+		conf := &config.Config{Proxy: config.DefaultProxyConfig()}
+		conf.Proxy.SequenceBackend = scatter.Backends()[1]
+		seq := NewSequence(log, conf, route, scatter)
+		values, err := seq.Next("db1", "s1", 1)
+		assert.Nil(t, err)
+		assert.Equal(t, []uint64{1}, values)
+	}
+}
@@ -13,6 +13,8 @@ import (
 	"runtime"
 	"sync"
 
+	"xbase"
+
 	"github.com/radondb/shift/build"
 	"github.com/radondb/shift/shift"
 	sxlog "github.com/radondb/shift/xlog"
@@ -108,7 +110,9 @@ func (shiftMgr *ShiftManager) NewShiftInstance(shiftInfo *ShiftInfo, typ ShiftTy
 		return nil, fmt.Errorf("shift.wrong.shifttype: [%+v].", typ)
 	}
 
-	shiftMgr.log.Info("shift.cfg:%+v", cfg)
+	logCfg := *cfg
+	logCfg.RadonURL = xbase.RedactURL(cfg.RadonURL)
+	shiftMgr.log.Info("shift.cfg:%+v", &logCfg)
 
 	slog := sxlog.NewStdLog(sxlog.Level(sxlog.WARNING))
 	return shift.NewShift(slog, cfg), nil
@@ -0,0 +1,411 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"strings"
+
+	"backend"
+	"router"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const (
+	// checkTableChunkSize is the rows of one chunk on the reference backend.
+	checkTableChunkSize = 1000
+
+	checkTableStatusOK       = "ok"
+	checkTableStatusDiverged = "diverged"
+	checkTableStatusSource   = "source"
+	checkTableStatusResynced = "resynced"
+)
+
+// CheckTable used to compare the copies of a GLOBAL table on all the backends.
+// The table is split into chunks by the primary key range, every chunk is
+// checksummed on every backend and the copies which differ are reported.
+type CheckTable struct {
+	log     *xlog.Log
+	scatter *backend.Scatter
+	router  *router.Router
+	spanner *Spanner
+}
+
+// checkTableInfo is the layout of the GLOBAL table.
+type checkTableInfo struct {
+	database string
+	table    string
+	backends []string
+	// tables is the physical table name on the backend.
+	tables  map[string]string
+	columns []string
+	keys    []string
+}
+
+// checkChunk is a primary key range (lower, upper], the empty bound is unbounded.
+type checkChunk struct {
+	id    int
+	lower string
+	upper string
+	// sums is the 'rows:checksum' of the chunk on the backend.
+	sums     map[string]string
+	majority string
+}
+
+// NewCheckTable -- creates new CheckTable handler.
+func NewCheckTable(log *xlog.Log, scatter *backend.Scatter, router *router.Router, spanner *Spanner) *CheckTable {
+	return &CheckTable{
+		log:     log,
+		scatter: scatter,
+		router:  router,
+		spanner: spanner,
+	}
+}
+
+// Check used to handle the 'RADON CHECK TABLE' command, it returns the diverged chunks on every backend.
+func (c *CheckTable) Check(database, table string) (*sqltypes.Result, error) {
+	info, err := c.tableInfo(database, table)
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := c.divergedChunks(info, "")
+	if err != nil {
+		return nil, err
+	}
+
+	qr := checkTableResult()
+	for _, chunk := range chunks {
+		for _, backend := range info.backends {
+			status := checkTableStatusDiverged
+			if chunk.sums[backend] == chunk.majority {
+				status = checkTableStatusOK
+			}
+			qr.Rows = append(qr.Rows, checkTableRow(chunk, backend, status))
+		}
+	}
+	qr.RowsAffected = uint64(len(qr.Rows))
+	return qr, nil
+}
+
+// Resync used to handle the 'RADON RESYNC TABLE' command.
+// The diverged chunks are copied from the source backend, if the source is empty
+// the version of the majority is used.
+// The copy isn't atomic with the writes to the table, it's better to do it when the table is quiet.
+func (c *CheckTable) Resync(database, table, source string) (*sqltypes.Result, error) {
+	log := c.log
+
+	if err := c.spanner.ddlJobs.checkIdle(database, table); err != nil {
+		return nil, err
+	}
+	info, err := c.tableInfo(database, table)
+	if err != nil {
+		return nil, err
+	}
+	if source != "" {
+		if _, ok := info.tables[source]; !ok {
+			return nil, errors.Errorf("resync.table[%s.%s].source.backend[%s].not.found", database, table, source)
+		}
+	}
+	chunks, err := c.divergedChunks(info, source)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check all the chunks before the copy.
+	refs := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		if source != "" {
+			refs[i] = source
+			continue
+		}
+		if chunk.majority == "" {
+			return nil, errors.Errorf("resync.table[%s.%s].chunk[%d].has.no.majority.please.resync.from.a.backend", database, table, chunk.id)
+		}
+		for _, backend := range info.backends {
+			if chunk.sums[backend] == chunk.majority {
+				refs[i] = backend
+				break
+			}
+		}
+	}
+
+	qr := checkTableResult()
+	for i, chunk := range chunks {
+		from := refs[i]
+		for _, backend := range info.backends {
+			status := checkTableStatusOK
+			switch {
+			case backend == from:
+				status = checkTableStatusSource
+			case chunk.sums[backend] != chunk.sums[from]:
+				if err := c.resyncChunk(info, chunk, from, backend); err != nil {
+					log.Error("resync.table[%s.%s].chunk[%d].from[%s].to[%s].error:%+v", database, table, chunk.id, from, backend, err)
+					return nil, err
+				}
+				log.Warning("resync.table[%s.%s].chunk[%d].from[%s].to[%s].done", database, table, chunk.id, from, backend)
+				status = checkTableStatusResynced
+			}
+			qr.Rows = append(qr.Rows, checkTableRow(chunk, backend, status))
+		}
+	}
+	qr.RowsAffected = uint64(len(qr.Rows))
+	return qr, nil
+}
+
+// tableInfo gets the backends and the columns of the GLOBAL table.
+func (c *CheckTable) tableInfo(database, table string) (*checkTableInfo, error) {
+	tconf, err := c.router.TableConfig(database, table)
+	if err != nil {
+		return nil, err
+	}
+	if tconf.ShardType != "GLOBAL" {
+		return nil, errors.Errorf("check.table[%s.%s].is.not.a.global.table", database, table)
+	}
+
+	info := &checkTableInfo{
+		database: database,
+		table:    table,
+		tables:   make(map[string]string),
+	}
+	for _, part := range tconf.Partitions {
+		info.backends = append(info.backends, part.Backend)
+		info.tables[part.Backend] = part.Table
+	}
+
+	backend := info.backends[0]
+	query := fmt.Sprintf("select column_name, column_key from information_schema.columns where table_schema='%s' and table_name='%s' order by ordinal_position", database, info.tables[backend])
+	qr, err := c.spanner.ExecuteOnThisBackend(backend, query)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range qr.Rows {
+		column := fmt.Sprintf("`%s`", row[0].String())
+		info.columns = append(info.columns, column)
+		if row[1].String() == "PRI" {
+			info.keys = append(info.keys, column)
+		}
+	}
+	if len(info.keys) == 0 {
+		return nil, errors.Errorf("check.table[%s.%s].has.no.primary.key", database, table)
+	}
+	return info, nil
+}
+
+// divergedChunks splits the table by the first primary key column on the reference backend,
+// and returns the chunks whose checksums are not the same on all the backends.
+func (c *CheckTable) divergedChunks(info *checkTableInfo, source string) ([]*checkChunk, error) {
+	ref := source
+	if ref == "" {
+		ref = info.backends[0]
+	}
+
+	var diverged []*checkChunk
+	lower := ""
+	for id := 0; ; id++ {
+		chunk := &checkChunk{
+			id:    id,
+			lower: lower,
+			sums:  make(map[string]string),
+		}
+		query := fmt.Sprintf("select %s from %s%s order by %s limit %d, 1", info.keys[0], info.name(ref), chunk.where(info), info.keys[0], checkTableChunkSize-1)
+		qr, err := c.spanner.ExecuteOnThisBackend(ref, query)
+		if err != nil {
+			return nil, err
+		}
+		if len(qr.Rows) > 0 {
+			buf := sqlparser.NewTrackedBuffer(nil)
+			qr.Rows[0][0].EncodeSQL(buf)
+			chunk.upper = buf.String()
+		}
+
+		if err := c.checksumChunk(info, chunk); err != nil {
+			return nil, err
+		}
+		if chunk.diverged() {
+			diverged = append(diverged, chunk)
+		}
+
+		if chunk.upper == "" {
+			break
+		}
+		lower = chunk.upper
+	}
+	return diverged, nil
+}
+
+// checksumChunk gets the rows and the checksum of the chunk on all the backends.
+func (c *CheckTable) checksumChunk(info *checkTableInfo, chunk *checkChunk) error {
+	nulls := make([]string, len(info.columns))
+	for i, column := range info.columns {
+		nulls[i] = fmt.Sprintf("isnull(%s)", column)
+	}
+	expr := fmt.Sprintf("coalesce(bit_xor(crc32(concat_ws('#', %s, concat(%s)))), 0)", strings.Join(info.columns, ", "), strings.Join(nulls, ", "))
+
+	counts := make(map[string]int)
+	for _, backend := range info.backends {
+		query := fmt.Sprintf("select count(*), %s from %s%s", expr, info.name(backend), chunk.where(info))
+		qr, err := c.spanner.ExecuteOnThisBackend(backend, query)
+		if err != nil {
+			return err
+		}
+		if len(qr.Rows) != 1 || len(qr.Rows[0]) != 2 {
+			return errors.Errorf("check.table[%s.%s].chunk[%d].on.backend[%s].got.invalid.checksum", info.database, info.table, chunk.id, backend)
+		}
+		sum := fmt.Sprintf("%s:%s", qr.Rows[0][0].String(), qr.Rows[0][1].String())
+		chunk.sums[backend] = sum
+		counts[sum]++
+	}
+
+	// The majority must be more than any others.
+	max := 0
+	for sum, n := range counts {
+		switch {
+		case n > max:
+			max = n
+			chunk.majority = sum
+		case n == max:
+			chunk.majority = ""
+		}
+	}
+	return nil
+}
+
+// resyncChunk copies the chunk rows from the source backend to the target backend.
+func (c *CheckTable) resyncChunk(info *checkTableInfo, chunk *checkChunk, from, to string) error {
+	columns := strings.Join(info.columns, ", ")
+	query := fmt.Sprintf("select %s from %s%s", columns, info.name(from), chunk.where(info))
+	qr, err := c.spanner.ExecuteOnThisBackend(from, query)
+	if err != nil {
+		return err
+	}
+
+	keyIdx := make([]int, 0, len(info.keys))
+	for _, key := range info.keys {
+		for i, column := range info.columns {
+			if column == key {
+				keyIdx = append(keyIdx, i)
+			}
+		}
+	}
+
+	values := sqlparser.NewTrackedBuffer(nil)
+	keys := sqlparser.NewTrackedBuffer(nil)
+	for i, row := range qr.Rows {
+		if i > 0 {
+			values.WriteString(", ")
+			keys.WriteString(", ")
+		}
+		values.WriteString("(")
+		for j, v := range row {
+			if j > 0 {
+				values.WriteString(", ")
+			}
+			v.EncodeSQL(values)
+		}
+		values.WriteString(")")
+
+		keys.WriteString("(")
+		for j, idx := range keyIdx {
+			if j > 0 {
+				keys.WriteString(", ")
+			}
+			row[idx].EncodeSQL(keys)
+		}
+		keys.WriteString(")")
+	}
+
+	// 1. Replace the rows of the source.
+	if len(qr.Rows) > 0 {
+		query = fmt.Sprintf("replace into %s(%s) values %s", info.name(to), columns, values.String())
+		if _, err := c.spanner.ExecuteOnThisBackend(to, query); err != nil {
+			return err
+		}
+	}
+
+	// 2. Delete the rows which are not in the source.
+	query = fmt.Sprintf("delete from %s%s", info.name(to), chunk.where(info))
+	if len(qr.Rows) > 0 {
+		cond := fmt.Sprintf("(%s) not in (%s)", strings.Join(info.keys, ", "), keys.String())
+		if chunk.lower == "" && chunk.upper == "" {
+			query = fmt.Sprintf("%s where %s", query, cond)
+		} else {
+			query = fmt.Sprintf("%s and %s", query, cond)
+		}
+	}
+	_, err = c.spanner.ExecuteOnThisBackend(to, query)
+	return err
+}
+
+// name returns the table name on the backend.
+func (info *checkTableInfo) name(backend string) string {
+	return fmt.Sprintf("`%s`.`%s`", info.database, info.tables[backend])
+}
+
+// where returns the where clause of the chunk range.
+func (chunk *checkChunk) where(info *checkTableInfo) string {
+	var conds []string
+	if chunk.lower != "" {
+		conds = append(conds, fmt.Sprintf("%s > %s", info.keys[0], chunk.lower))
+	}
+	if chunk.upper != "" {
+		conds = append(conds, fmt.Sprintf("%s <= %s", info.keys[0], chunk.upper))
+	}
+	if len(conds) == 0 {
+		return ""
+	}
+	return " where " + strings.Join(conds, " and ")
+}
+
+// diverged returns true if the chunk is not the same on all the backends.
+func (chunk *checkChunk) diverged() bool {
+	for _, sum := range chunk.sums {
+		if sum != chunk.majority {
+			return true
+		}
+	}
+	return false
+}
+
+func checkTableResult() *sqltypes.Result {
+	return &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "Chunk", Type: querypb.Type_INT64},
+			{Name: "Lower", Type: querypb.Type_VARCHAR},
+			{Name: "Upper", Type: querypb.Type_VARCHAR},
+			{Name: "Backend", Type: querypb.Type_VARCHAR},
+			{Name: "Rows", Type: querypb.Type_INT64},
+			{Name: "Checksum", Type: querypb.Type_VARCHAR},
+			{Name: "Status", Type: querypb.Type_VARCHAR},
+		},
+	}
+}
+
+func checkTableRow(chunk *checkChunk, backend, status string) []sqltypes.Value {
+	bound := func(b string) sqltypes.Value {
+		if b == "" {
+			return sqltypes.NULL
+		}
+		return sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(b))
+	}
+	sum := strings.SplitN(chunk.sums[backend], ":", 2)
+	return []sqltypes.Value{
+		sqltypes.MakeTrusted(querypb.Type_INT64, []byte(fmt.Sprintf("%d", chunk.id))),
+		bound(chunk.lower),
+		bound(chunk.upper),
+		sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(backend)),
+		sqltypes.MakeTrusted(querypb.Type_INT64, []byte(sum[0])),
+		sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(sum[1])),
+		sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(status)),
+	}
+}
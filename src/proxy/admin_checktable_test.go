@@ -0,0 +1,262 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"fakedb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const (
+	checkTableColumnsQuery  = "select column_name, column_key from information_schema.columns where table_schema='test' and table_name='g' order by ordinal_position"
+	checkTableBound0Query   = "select `id` from `test`.`g` order by `id` limit 999, 1"
+	checkTableBound1Query   = "select `id` from `test`.`g` where `id` > 1000 order by `id` limit 999, 1"
+	checkTableChecksumQuery = "select count(*), coalesce(bit_xor(crc32(concat_ws('#', `id`, `b`, concat(isnull(`id`), isnull(`b`))))), 0) from `test`.`g`"
+)
+
+func checkTableColumnsResult(key string) *sqltypes.Result {
+	return &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "column_name", Type: querypb.Type_VARCHAR},
+			{Name: "column_key", Type: querypb.Type_VARCHAR},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("id")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(key)),
+			},
+			{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("b")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("")),
+			},
+		},
+	}
+}
+
+func checkTableIntResult(rows ...[]string) *sqltypes.Result {
+	qr := &sqltypes.Result{}
+	for i := 0; len(rows) > 0 && i < len(rows[0]); i++ {
+		qr.Fields = append(qr.Fields, &querypb.Field{Name: fmt.Sprintf("c%d", i), Type: querypb.Type_INT64})
+	}
+	for _, row := range rows {
+		var values []sqltypes.Value
+		for _, v := range row {
+			if v == "" {
+				values = append(values, sqltypes.NULL)
+				continue
+			}
+			values = append(values, sqltypes.MakeTrusted(querypb.Type_INT64, []byte(v)))
+		}
+		qr.Rows = append(qr.Rows, values)
+	}
+	return qr
+}
+
+// mockCheckTable mocks two chunks, the first chunk got the sums in the backends order.
+func mockCheckTable(fakedbs *fakedb.DB, sums ...[]string) {
+	fakedbs.AddQuery(checkTableColumnsQuery, checkTableColumnsResult("PRI"))
+	fakedbs.AddQuery(checkTableBound0Query, checkTableIntResult([]string{"1000"}))
+	fakedbs.AddQuery(checkTableBound1Query, checkTableIntResult())
+	var results []*sqltypes.Result
+	for _, sum := range sums {
+		results = append(results, checkTableIntResult(sum))
+	}
+	fakedbs.AddQuerys(checkTableChecksumQuery+" where `id` <= 1000", results...)
+	fakedbs.AddQuery(checkTableChecksumQuery+" where `id` > 1000", checkTableIntResult([]string{"5", "333"}))
+}
+
+func checkTableStatus(qr *sqltypes.Result) map[string]string {
+	status := make(map[string]string)
+	for _, row := range qr.Rows {
+		status[row[3].String()] = row[6].String()
+	}
+	return status
+}
+
+func TestAdminCheckTable(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.g(id int primary key, b int) global",
+		"create table test.t1(id int primary key, b int) partition by hash(id) partitions 8",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+	tconf, err := proxy.Router().TableConfig("test", "g")
+	assert.Nil(t, err)
+	backends := make([]string, len(tconf.Partitions))
+	for i, part := range tconf.Partitions {
+		backends[i] = part.Backend
+	}
+	assert.Equal(t, 5, len(backends))
+
+	ok := []string{"1000", "111"}
+	bad := []string{"999", "222"}
+
+	// Consistent.
+	{
+		mockCheckTable(fakedbs, ok, ok, ok, ok, ok)
+		qr, err := client.FetchAll("radon check table test.g", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(qr.Rows))
+	}
+
+	// The third backend diverged.
+	{
+		mockCheckTable(fakedbs, ok, ok, bad, ok, ok)
+		qr, err := client.FetchAll("radon check table test.g", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 5, len(qr.Rows))
+		assert.True(t, qr.Rows[2][1].IsNull())
+		want := fmt.Sprintf("[1000 %s 999 222 diverged]", backends[2])
+		got := fmt.Sprintf("%+v", qr.Rows[2][2:])
+		assert.Equal(t, want, got)
+		status := checkTableStatus(qr)
+		for i, backend := range backends {
+			if i == 2 {
+				assert.Equal(t, "diverged", status[backend])
+			} else {
+				assert.Equal(t, "ok", status[backend])
+			}
+		}
+	}
+
+	// Not a global table.
+	{
+		_, err := client.FetchAll("radon check table test.t1", -1)
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "check.table[test.t1].is.not.a.global.table"))
+	}
+
+	// Table not exists.
+	{
+		_, err := client.FetchAll("radon check table test.xx", -1)
+		assert.NotNil(t, err)
+	}
+
+	// No primary key.
+	{
+		fakedbs.AddQuery(checkTableColumnsQuery, checkTableColumnsResult(""))
+		_, err := client.FetchAll("radon check table test.g", -1)
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "check.table[test.g].has.no.primary.key"))
+	}
+}
+
+func TestAdminResyncTable(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.g(id int primary key, b int) global",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+	tconf, err := proxy.Router().TableConfig("test", "g")
+	assert.Nil(t, err)
+	backends := make([]string, len(tconf.Partitions))
+	for i, part := range tconf.Partitions {
+		backends[i] = part.Backend
+	}
+
+	ok := []string{"1000", "111"}
+	bad := []string{"999", "222"}
+	other := []string{"998", "444"}
+	selectQuery := "select `id`, `b` from `test`.`g` where `id` <= 1000"
+	replaceQuery := "replace into `test`.`g`(`id`, `b`) values (1, 1), (2, null)"
+	deleteQuery := "delete from `test`.`g` where `id` <= 1000 and (`id`) not in ((1), (2))"
+	fakedbs.AddQuery(selectQuery, checkTableIntResult([]string{"1", "1"}, []string{"2", ""}))
+	fakedbs.AddQuery(replaceQuery, &sqltypes.Result{})
+	fakedbs.AddQuery(deleteQuery, &sqltypes.Result{})
+
+	// Resync from the majority.
+	{
+		mockCheckTable(fakedbs, ok, ok, bad, ok, ok)
+		qr, err := client.FetchAll("radon resync table test.g", -1)
+		assert.Nil(t, err)
+		status := checkTableStatus(qr)
+		assert.Equal(t, "source", status[backends[0]])
+		assert.Equal(t, "resynced", status[backends[2]])
+		assert.Equal(t, "ok", status[backends[4]])
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(replaceQuery))
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(deleteQuery))
+	}
+
+	// No majority.
+	{
+		mockCheckTable(fakedbs, ok, ok, bad, bad, other)
+		qr, err := client.FetchAll("radon check table test.g", -1)
+		assert.Nil(t, err)
+		for _, status := range checkTableStatus(qr) {
+			assert.Equal(t, "diverged", status)
+		}
+
+		mockCheckTable(fakedbs, ok, ok, bad, bad, other)
+		_, err = client.FetchAll("radon resync table test.g", -1)
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "resync.table[test.g].chunk[0].has.no.majority.please.resync.from.a.backend"))
+	}
+
+	// Resync from the chosen backend.
+	{
+		mockCheckTable(fakedbs, ok, ok, bad, bad, other)
+		qr, err := client.FetchAll(fmt.Sprintf("radon resync table test.g from '%s'", backends[1]), -1)
+		assert.Nil(t, err)
+		status := checkTableStatus(qr)
+		assert.Equal(t, "ok", status[backends[0]])
+		assert.Equal(t, "source", status[backends[1]])
+		assert.Equal(t, "resynced", status[backends[4]])
+		assert.Equal(t, 4, fakedbs.GetQueryCalledNum(replaceQuery))
+	}
+
+	// Source backend not found.
+	{
+		_, err := client.FetchAll("radon resync table test.g from 'xx'", -1)
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "resync.table[test.g].source.backend[xx].not.found"))
+	}
+}
@@ -0,0 +1,231 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"backend"
+	"config"
+	"metastore"
+	"router"
+
+	"github.com/pkg/errors"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// MetaHistory used to list, diff and rollback the versions of the metadata.
+type MetaHistory struct {
+	log     *xlog.Log
+	scatter *backend.Scatter
+	router  *router.Router
+	spanner *Spanner
+}
+
+// NewMetaHistory -- creates new MetaHistory handler.
+func NewMetaHistory(log *xlog.Log, scatter *backend.Scatter, router *router.Router, spanner *Spanner) *MetaHistory {
+	return &MetaHistory{
+		log:     log,
+		scatter: scatter,
+		router:  router,
+		spanner: spanner,
+	}
+}
+
+// Snapshots returns the recorded versions.
+func (h *MetaHistory) Snapshots() ([]*metastore.Snapshot, error) {
+	return h.spanner.history.Snapshots()
+}
+
+// Diff returns the changes from the version 'from' to the version 'to'.
+func (h *MetaHistory) Diff(from, to int64) ([]*metastore.Change, error) {
+	history := h.spanner.history
+	fromSnap, err := history.Snapshot(from)
+	if err != nil {
+		return nil, err
+	}
+	toSnap, err := history.Snapshot(to)
+	if err != nil {
+		return nil, err
+	}
+	return metastore.Diff(fromSnap, toSnap)
+}
+
+// Rollback used to restore the databases and tables of the version, it returns the changes from the current metadata.
+// The rollback is refused if the data layout doesn't match the version any more,
+// that is the backend of a partition is gone or the physical table does not exist on it.
+func (h *MetaHistory) Rollback(version int64, author string) ([]*metastore.Change, error) {
+	log := h.log
+	history := h.spanner.history
+
+	snapshot, err := history.Snapshot(version)
+	if err != nil {
+		return nil, err
+	}
+	current, err := history.Current()
+	if err != nil {
+		return nil, err
+	}
+	changes, err := metastore.Diff(current, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.check(snapshot, current); err != nil {
+		log.Error("meta.rollback.version[%d].check.error:%v", version, err)
+		return nil, err
+	}
+
+	// Record the current version first, so the rollback can be undone.
+	if _, err := history.Record(author, fmt.Sprintf("before rollback to version %d", version)); err != nil {
+		return nil, err
+	}
+	if err := history.Restore(snapshot); err != nil {
+		log.Error("meta.rollback.version[%d].restore.error:%v", version, err)
+		return nil, err
+	}
+	if err := h.router.LoadConfig(); err != nil {
+		log.Error("meta.rollback.version[%d].router.load.error:%v", version, err)
+		return nil, err
+	}
+	if _, err := history.Record(author, fmt.Sprintf("rollback to version %d", version)); err != nil {
+		return nil, err
+	}
+	log.Warning("meta.rollback.to.version[%d].by[%s].done", version, author)
+	return changes, nil
+}
+
+// check used to check no ddl job is running on the tables of the current and the snapshot,
+// and the partitions of the snapshot exist on the backends.
+func (h *MetaHistory) check(snapshot, current *metastore.Snapshot) error {
+	tables, err := snapshot.Tables()
+	if err != nil {
+		return err
+	}
+	currentTables, err := current.Tables()
+	if err != nil {
+		return err
+	}
+	for _, m := range []map[string]*config.TableConfig{tables, currentTables} {
+		for name := range m {
+			idx := strings.Index(name, ".")
+			if err := h.spanner.ddlJobs.checkIdle(name[:idx], name[idx+1:]); err != nil {
+				return err
+			}
+		}
+	}
+
+	backends := make(map[string]bool)
+	for _, name := range h.scatter.AllBackends() {
+		backends[name] = true
+	}
+
+	// The partitions on every backend, the key is '[db].[physical table]'.
+	parts := make(map[string]map[string]string)
+	for name, conf := range tables {
+		db := name[:strings.Index(name, ".")]
+		for _, part := range conf.Partitions {
+			if !backends[part.Backend] {
+				return errors.Errorf("meta.rollback.version[%d].table[%s].backend[%s].not.exists", snapshot.Version, name, part.Backend)
+			}
+			if parts[part.Backend] == nil {
+				parts[part.Backend] = make(map[string]string)
+			}
+			parts[part.Backend][db+"."+part.Table] = name
+		}
+	}
+
+	var names []string
+	for name := range parts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, backend := range names {
+		dbs := make(map[string]bool)
+		for part := range parts[backend] {
+			dbs[part[:strings.Index(part, ".")]] = true
+		}
+		var schemas []string
+		for db := range dbs {
+			schemas = append(schemas, fmt.Sprintf("'%s'", db))
+		}
+		sort.Strings(schemas)
+
+		query := fmt.Sprintf("select table_schema, table_name from information_schema.tables where table_schema in (%s)", strings.Join(schemas, ", "))
+		qr, err := h.spanner.ExecuteOnThisBackend(backend, query)
+		if err != nil {
+			return err
+		}
+		exists := make(map[string]bool)
+		for _, row := range qr.Rows {
+			exists[row[0].String()+"."+row[1].String()] = true
+		}
+
+		var missing []string
+		for part := range parts[backend] {
+			if !exists[part] {
+				missing = append(missing, part)
+			}
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			return errors.Errorf("meta.rollback.version[%d].table[%s].partition[%s].not.exists.on.backend[%s]", snapshot.Version, parts[backend][missing[0]], missing[0], backend)
+		}
+	}
+	return nil
+}
+
+// snapshotsResult returns the result of the versions.
+func snapshotsResult(snapshots []*metastore.Snapshot) *sqltypes.Result {
+	qr := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "Version", Type: querypb.Type_INT64},
+			{Name: "Time", Type: querypb.Type_VARCHAR},
+			{Name: "Author", Type: querypb.Type_VARCHAR},
+			{Name: "Cause", Type: querypb.Type_VARCHAR},
+		},
+	}
+	for _, snapshot := range snapshots {
+		qr.Rows = append(qr.Rows, []sqltypes.Value{
+			sqltypes.MakeTrusted(querypb.Type_INT64, []byte(fmt.Sprintf("%d", snapshot.Version))),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(snapshot.Time().Format("2006-01-02 15:04:05.000000"))),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(snapshot.Author)),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(snapshot.Cause)),
+		})
+	}
+	qr.RowsAffected = uint64(len(qr.Rows))
+	return qr
+}
+
+// changesResult returns the result of the changes.
+func changesResult(changes []*metastore.Change) *sqltypes.Result {
+	qr := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "Type", Type: querypb.Type_VARCHAR},
+			{Name: "Name", Type: querypb.Type_VARCHAR},
+			{Name: "Action", Type: querypb.Type_VARCHAR},
+			{Name: "From", Type: querypb.Type_VARCHAR},
+			{Name: "To", Type: querypb.Type_VARCHAR},
+		},
+	}
+	for _, change := range changes {
+		qr.Rows = append(qr.Rows, []sqltypes.Value{
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(change.Type)),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(change.Name)),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(change.Action)),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(change.From)),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(change.To)),
+		})
+	}
+	qr.RowsAffected = uint64(len(qr.Rows))
+	return qr
+}
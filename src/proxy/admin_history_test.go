@@ -0,0 +1,108 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const metaHistoryTablesQuery = "select table_schema, table_name from information_schema.tables where table_schema in ('test')"
+
+func TestAdminMetaHistory(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("drop .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.g(id int primary key, b int) global",
+		"drop table test.g",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	// Versions.
+	qr, err := client.FetchAll("radon meta versions", -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(qr.Rows))
+	for i, query := range querys {
+		assert.Equal(t, "mock", qr.Rows[i][2].String())
+		assert.Equal(t, query, qr.Rows[i][3].String())
+	}
+	v2, v3 := qr.Rows[1][0].String(), qr.Rows[2][0].String()
+
+	// Diff.
+	{
+		qr, err := client.FetchAll(fmt.Sprintf("radon meta diff %s %s", v2, v3), -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(qr.Rows))
+		assert.Equal(t, "[table test.g drop GLOBAL ]", fmt.Sprintf("%+v", qr.Rows[0]))
+
+		_, err = client.FetchAll(fmt.Sprintf("radon meta diff 1 %s", v3), -1)
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "meta.history.version[1].not.found"))
+	}
+
+	// Rollback refused, the physical table is gone.
+	{
+		fakedbs.AddQuery(metaHistoryTablesQuery, &sqltypes.Result{})
+		_, err := client.FetchAll(fmt.Sprintf("radon meta rollback %s", v2), -1)
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "partition[test.g].not.exists.on.backend"))
+		_, err = proxy.Router().TableConfig("test", "g")
+		assert.NotNil(t, err)
+	}
+
+	// Rollback.
+	{
+		fakedbs.AddQuery(metaHistoryTablesQuery, &sqltypes.Result{
+			Fields: []*querypb.Field{
+				{Name: "table_schema", Type: querypb.Type_VARCHAR},
+				{Name: "table_name", Type: querypb.Type_VARCHAR},
+			},
+			Rows: [][]sqltypes.Value{
+				{
+					sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("test")),
+					sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("g")),
+				},
+			},
+		})
+		qr, err := client.FetchAll(fmt.Sprintf("radon meta rollback %s", v2), -1)
+		assert.Nil(t, err)
+		assert.Equal(t, "[table test.g add  GLOBAL]", fmt.Sprintf("%+v", qr.Rows[0]))
+		_, err = proxy.Router().TableConfig("test", "g")
+		assert.Nil(t, err)
+
+		qr, err = client.FetchAll("radon meta versions", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 4, len(qr.Rows))
+		assert.Equal(t, "rollback to version "+v2, qr.Rows[3][3].String())
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"plugins"
 	"plugins/shiftmanager"
 	"router"
+	"xbase"
 
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
@@ -155,7 +156,7 @@ func RebalanceMigrate(log *xlog.Log, rebalance *Rebalance, max, min *BackendSize
 		ToPassword:             min.Passwd,
 		ToDatabase:             database,
 		ToTable:                table,
-		RadonURL:               "http://" + rebalance.spanner.conf.Proxy.PeerAddress,
+		RadonURL:               rebalance.spanner.RadonURL(),
 		Rebalance:              false,
 		Cleanup:                true,
 		MySQLDump:              "mysqldump",
@@ -174,8 +175,10 @@ func RebalanceMigrate(log *xlog.Log, rebalance *Rebalance, max, min *BackendSize
 	// check args.
 	if len(p.FromUser) == 0 || len(p.FromDatabase) == 0 || len(p.FromTable) == 0 ||
 		len(p.ToUser) == 0 || len(p.ToDatabase) == 0 || len(p.ToTable) == 0 {
-		log.Error("admin.rebalance[%+v].error:some param is empty", p)
-		err := fmt.Sprintf("admin.rebalance[%+v].error:some param is empty", p)
+		logp := *p
+		logp.RadonURL = xbase.RedactURL(p.RadonURL)
+		log.Error("admin.rebalance[%+v].error:some param is empty", &logp)
+		err := fmt.Sprintf("admin.rebalance[%+v].error:some param is empty", &logp)
 		return errors.New(err)
 	}
 
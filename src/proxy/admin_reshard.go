@@ -16,6 +16,7 @@ import (
 
 	"backend"
 	"router"
+	"syncer"
 
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
@@ -42,6 +43,7 @@ type Reshard struct {
 	tmpReshardTable string
 	ticker          *time.Ticker
 	handle          ReshardHandle
+	guard           *syncer.LockGuard
 	shiftProcessBar int
 	shiftStatus     error
 }
@@ -55,7 +57,11 @@ type ReshardHandle interface {
 
 // ShiftProcess is call the shift tool cmd.
 func (reshard *Reshard) ShiftProcess() error {
-	return shiftTableLow(reshard.db, reshard.singleTable, reshard.dstDB, reshard.reshardTable, reshard.user, reshard.spanner)
+	var lost <-chan bool
+	if reshard.guard != nil {
+		lost = reshard.guard.Lost()
+	}
+	return shiftTableLow(reshard.db, reshard.singleTable, reshard.dstDB, reshard.reshardTable, reshard.user, reshard.spanner, lost)
 }
 
 // ShiftProcessBar about status of the Shift Process Bar.
@@ -148,6 +154,14 @@ func (reshard *Reshard) IsSingleTable(db, singleTable string) (bool, error) {
 	return false, nil
 }
 
+// unlock used to release the cluster locks of the reshard.
+func (reshard *Reshard) unlock() {
+	if reshard.guard != nil {
+		reshard.guard.Unlock()
+		reshard.guard = nil
+	}
+}
+
 // ReShardTable just reshard single table to the sharding table now.
 func (reshard *Reshard) ReShardTable(db, singleTable, dstDB, dstTable string) (*sqltypes.Result, error) {
 	log := reshard.log
@@ -156,6 +170,7 @@ func (reshard *Reshard) ReShardTable(db, singleTable, dstDB, dstTable string) (*
 	if ok, err := reshard.CheckReshardDBTable(db, singleTable, dstDB, dstTable); ok != true {
 		log.Error("reshard.check[%s.%s->%s.%s].is.not.ok:%v.", db, singleTable, dstDB, dstTable, err)
 		err := fmt.Sprintf("reshard.check[%s.%s->%s.%s].is.not.ok:%v.", db, singleTable, dstDB, dstTable, err)
+		reshard.unlock()
 		return qr, errors.New(err)
 	}
 	reshard.db = db
@@ -176,6 +191,7 @@ func (reshard *Reshard) shiftTable(user string) error {
 
 	oneshift := func(db, srcTable, dstDB, dstTable string, user string, spanner *Spanner) {
 		defer wg.Done()
+		defer reshard.unlock()
 
 		err := reshard.handle.ShiftProcess()
 		reshard.SetShiftProcessBar(shiftFinished)
@@ -4,6 +4,7 @@ import (
 	"runtime"
 
 	"config"
+	"xbase"
 
 	"github.com/radondb/shift/build"
 	"github.com/radondb/shift/shift"
@@ -72,11 +73,12 @@ func getShiftInfo(db, srcTable, dstDB, dstTable string, spanner *Spanner, user s
 	shift.ToDatabase = dstDB
 	shift.ToTable = dstTable
 
-	shift.RadonURL = "http://" + spanner.conf.Proxy.PeerAddress
+	shift.RadonURL = spanner.RadonURL()
 	return &shift, nil
 }
 
-func shiftTableLow(db, srcTable, dstDB, dstTable, user string, spanner *Spanner) error {
+// shiftTableLow runs the shift and waits for it finished, the shift is stopped once the lost is closed.
+func shiftTableLow(db, srcTable, dstDB, dstTable, user string, spanner *Spanner, lost <-chan bool) error {
 	log := xlog.NewStdLog(xlog.Level(xlog.INFO))
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
@@ -116,7 +118,9 @@ func shiftTableLow(db, srcTable, dstDB, dstTable, user string, spanner *Spanner)
 		WaitTimeBeforeChecksum: waitTimeBeforeChecksum,
 	}
 
-	log.Info("shift.cfg:%+v", cfg)
+	logCfg := *cfg
+	logCfg.RadonURL = xbase.RedactURL(cfg.RadonURL)
+	log.Info("shift.cfg:%+v", &logCfg)
 
 	shift := shift.NewShift(log, cfg).(*shift.Shift)
 	if err := shift.Start(); err != nil {
@@ -124,6 +128,18 @@ func shiftTableLow(db, srcTable, dstDB, dstTable, user string, spanner *Spanner)
 		return err
 	}
 
+	// The cluster locks are lost, the others may change the tables.
+	finished := make(chan bool)
+	defer close(finished)
+	go func() {
+		select {
+		case <-lost:
+			log.Error("shift.stopped.since.the.cluster.locks.are.lost")
+			shift.SetStopSignal()
+		case <-finished:
+		}
+	}()
+
 	err = shift.WaitFinish()
 	if err != nil {
 		log.Error("shift.wait.finish.error:%+v", err)
@@ -28,6 +28,7 @@ func (spanner *Spanner) auditLog(session *driver.Session, m mode, typ string, qu
 	adit := spanner.audit
 	user := session.User()
 	host := session.Addr()
+	db := session.Schema()
 	connID := session.ID()
 	affected := uint64(0)
 	if qr != nil {
@@ -36,9 +37,9 @@ func (spanner *Spanner) auditLog(session *driver.Session, m mode, typ string, qu
 	now := time.Now().UTC()
 	switch m {
 	case R:
-		adit.LogReadEvent(typ, user, host, connID, query, status, affected, now)
+		adit.LogReadEvent(typ, user, host, db, connID, query, status, affected, now)
 	case W:
-		adit.LogWriteEvent(typ, user, host, connID, query, status, affected, now)
+		adit.LogWriteEvent(typ, user, host, db, connID, query, status, affected, now)
 	}
 	return nil
 }
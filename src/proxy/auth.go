@@ -10,12 +10,21 @@ package proxy
 
 import (
 	"bytes"
+	"crypto/rand"
 	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"net/url"
 	"strings"
 
+	"config"
+	"xbase"
+
+	"github.com/pkg/errors"
 	"github.com/xelabs/go-mysqlstack/driver"
 	"github.com/xelabs/go-mysqlstack/sqldb"
 )
@@ -64,6 +73,43 @@ func (spanner *Spanner) SessionCheck(s *driver.Session) error {
 	return nil
 }
 
+// authQuery returns the query of the authentication string of the user.
+func (spanner *Spanner) authQuery(user string) string {
+	// Diff query for different MySQL version.
+	versionStr := spanner.ServerVersion()
+	version, _ := parseVersionString(versionStr, false)
+	if version.atLeast(authenticationMySQLVersion) {
+		return fmt.Sprintf("select authentication_string from mysql.user where user='%s'", user)
+	}
+	return fmt.Sprintf("select password as authentication_string from mysql.user where user='%s'", user)
+}
+
+// PasswordCheck used to check the plain password of the radon user, such as the http basic auth of the admin api.
+func (spanner *Spanner) PasswordCheck(user, password string) error {
+	log := spanner.log
+	if user == "" || strings.ContainsAny(user, "'\\\"") {
+		return errors.Errorf("proxy.auth.user[%s].invalid", user)
+	}
+
+	qr, err := spanner.ExecuteSingle(spanner.authQuery(user))
+	if err != nil {
+		log.Error("proxy.auth.password.user[%s].error:%+v", user, err)
+		return errors.Errorf("proxy.auth.user[%s].denied", user)
+	}
+	if len(qr.Rows) == 0 {
+		return errors.Errorf("proxy.auth.user[%s].denied", user)
+	}
+
+	// mysql.user.authentication_string is ['*' + HEX(SHA1(SHA1(password)))]
+	stage1 := sha1.Sum([]byte(password))
+	stage2 := sha1.Sum(stage1[:])
+	want := strings.TrimPrefix(qr.Rows[0][0].String(), "*")
+	if !strings.EqualFold(want, hex.EncodeToString(stage2[:])) {
+		return errors.Errorf("proxy.auth.user[%s].denied", user)
+	}
+	return nil
+}
+
 // AuthCheck impl.
 func (spanner *Spanner) AuthCheck(s *driver.Session) error {
 	// Local login bypass.
@@ -79,17 +125,7 @@ func (spanner *Spanner) AuthCheck(s *driver.Session) error {
 	// Client response.
 	resp := s.Scramble()
 
-	// Diff query for different MySQL version.
-	var query string
-	versionStr := spanner.ServerVersion()
-	version, _ := parseVersionString(versionStr, false)
-	if version.atLeast(authenticationMySQLVersion) {
-		query = fmt.Sprintf("select authentication_string from mysql.user where user='%s'", user)
-	} else {
-		query = fmt.Sprintf("select password as authentication_string from mysql.user where user='%s'", user)
-	}
-
-	qr, err := spanner.ExecuteSingle(query)
+	qr, err := spanner.ExecuteSingle(spanner.authQuery(user))
 	if err != nil {
 		log.Error("proxy: auth.error:%+v", err)
 		return sqldb.NewSQLErrorf(sqldb.ER_ACCESS_DENIED_ERROR, "Access denied for user '%v'", user)
@@ -140,3 +176,59 @@ func (spanner *Spanner) AuthCheck(s *driver.Session) error {
 	}
 	return nil
 }
+
+// NewHTTPClient creates the client of the requests to the peers, the cluster secret is the token.
+func NewHTTPClient(conf *config.AdminConfig) (*xbase.HTTPClient, error) {
+	client := &xbase.HTTPClient{}
+	if conf == nil {
+		return client, nil
+	}
+	if conf.Auth {
+		client.Token = conf.ClusterSecret
+	}
+	if conf.TLSCert != "" {
+		client.TLS = &tls.Config{}
+		if conf.TLSCA != "" {
+			ca, err := ioutil.ReadFile(conf.TLSCA)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(ca) {
+				return nil, errors.Errorf("proxy.admin.tls.ca[%s].invalid", conf.TLSCA)
+			}
+			client.TLS.RootCAs = pool
+		}
+	}
+	return client, nil
+}
+
+// RadonURL returns the url of the admin api for the shift callbacks, with the shift token of the spanner
+// if the auth is enabled, the cluster secret is kept out of the url since the shift logs the url.
+func (spanner *Spanner) RadonURL() string {
+	conf := spanner.conf.Admin
+	u := &url.URL{Scheme: "http", Host: spanner.conf.Proxy.PeerAddress}
+	if conf != nil {
+		if conf.TLSCert != "" {
+			u.Scheme = "https"
+		}
+		if conf.Auth {
+			u.User = url.UserPassword(config.AdminPeerUser, spanner.shiftToken)
+		}
+	}
+	return u.String()
+}
+
+// ShiftToken returns the token of the shift callbacks, it's generated at the startup and only valid on this peer.
+func (spanner *Spanner) ShiftToken() string {
+	return spanner.shiftToken
+}
+
+// newShiftToken returns a random token.
+func newShiftToken() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
@@ -73,6 +73,24 @@ func tryGetShardKey(ddl *sqlparser.DDL) (string, error) {
 	return "", fmt.Errorf("The unique/primary constraint shoule be defined or add 'PARTITION BY HASH' to mandatory indication")
 }
 
+// getShardKeyDefault returns the literal DEFAULT of the shard key column, used to route the insert without the shard key.
+// Only the string and number literals are deterministic, others such as NULL or now() are ignored.
+func getShardKeyDefault(ddl *sqlparser.DDL, shardKey string) string {
+	if shardKey == "" {
+		return ""
+	}
+	for _, col := range ddl.TableSpec.Columns {
+		if col.Name.String() != shardKey || col.Type.Default == nil {
+			continue
+		}
+		switch col.Type.Default.Type {
+		case sqlparser.StrVal, sqlparser.IntVal, sqlparser.FloatVal:
+			return sqlparser.String(col.Type.Default)
+		}
+	}
+	return ""
+}
+
 func checkShardKey(ddl *sqlparser.DDL, shardKey string) error {
 	shardKeyOK := false
 	constraintCheckOK := true
@@ -129,6 +147,30 @@ func checkTableExists(database string, table string, router *router.Router) bool
 	return false
 }
 
+// ddlLockNames returns the names of the cluster locks taken by the ddl.
+func ddlLockNames(database string, ddl *sqlparser.DDL) []string {
+	switch ddl.Action {
+	case sqlparser.CreateDBStr, sqlparser.DropDBStr:
+		return []string{database}
+	case sqlparser.DropTableStr, sqlparser.DropViewStr:
+		var names []string
+		for _, tableIdent := range ddl.Tables {
+			db := database
+			if !tableIdent.Qualifier.IsEmpty() {
+				db = tableIdent.Qualifier.String()
+			}
+			names = append(names, fmt.Sprintf("%s.%s", db, tableIdent.Name.String()))
+		}
+		return names
+	case sqlparser.RenameStr:
+		return []string{
+			fmt.Sprintf("%s.%s", database, ddl.Table.Name.String()),
+			fmt.Sprintf("%s.%s", database, ddl.NewName.Name.String()),
+		}
+	}
+	return []string{fmt.Sprintf("%s.%s", database, ddl.Table.Name.String())}
+}
+
 // handleDDL used to handle the DDL command.
 // Here we need to deal with database.table grammar.
 // Supports:
@@ -139,6 +181,10 @@ func checkTableExists(database string, table string, router *router.Router) bool
 // 5. ALTER TABLE .. ADD COLUMN (column definition)
 // 6. ALTER TABLE .. MODIFY COLUMN column definition
 // 7. ALTER TABLE .. DROP COLUMN column
+// 8. ALTER TABLE .. PARTITION BY HASH/LIST or GLOBAL/SINGLE, see ExecuteReshardJob
+// 9. CREATE/ALTER/DROP VIEW, see handleView
+// The index and alter operations are executed as ddl jobs, see DDLJobs.
+// The cluster locks are held until the statement returns, the ddl jobs are also fenced by DDLJobs.checkIdle on the peer.
 func (spanner *Spanner) handleDDL(session *driver.Session, query string, node *sqlparser.DDL) (*sqltypes.Result, error) {
 	log := spanner.log
 	route := spanner.router
@@ -153,15 +199,16 @@ func (spanner *Spanner) handleDDL(session *driver.Session, query string, node *s
 
 	// Table operation.
 	// when Drop Table, maybe multiple tables, can't use the ddl.Table.Qualifier.
-	if ddl.Action != sqlparser.DropTableStr && !ddl.Table.Qualifier.IsEmpty() {
+	isDrop := ddl.Action == sqlparser.DropTableStr || ddl.Action == sqlparser.DropViewStr
+	if !isDrop && !ddl.Table.Qualifier.IsEmpty() {
 		database = ddl.Table.Qualifier.String()
 	}
 
 	var databases []string
-	if ddl.Action == sqlparser.DropTableStr {
+	if isDrop {
 		for _, tableIdent := range ddl.Tables {
 			if !tableIdent.Qualifier.IsEmpty() {
-				databases = append(databases, ddl.Table.Qualifier.String())
+				databases = append(databases, tableIdent.Qualifier.String())
 			}
 		}
 	}
@@ -179,6 +226,14 @@ func (spanner *Spanner) handleDDL(session *driver.Session, query string, node *s
 		}
 	}
 
+	// The ddl on the same database or table from the other peers must wait,
+	// the metadata is not changed if the locks are lost.
+	guard, err := spanner.ClusterLock(spanner.lockOwner(session), query, ddlLockNames(database, ddl)...)
+	if err != nil {
+		return nil, err
+	}
+	defer guard.Unlock()
+
 	switch ddl.Action {
 	case sqlparser.CreateDBStr:
 		if err := route.CheckDatabase(database); err == nil {
@@ -187,6 +242,9 @@ func (spanner *Spanner) handleDDL(session *driver.Session, query string, node *s
 				return &sqltypes.Result{}, nil
 			}
 		}
+		if err := guard.Err(); err != nil {
+			return nil, err
+		}
 		if err := route.CreateDatabase(database); err != nil {
 			return nil, err
 		}
@@ -204,6 +262,9 @@ func (spanner *Spanner) handleDDL(session *driver.Session, query string, node *s
 			return nil, err
 		}
 		// Drop database from router.
+		if err := guard.Err(); err != nil {
+			return nil, err
+		}
 		if err := route.DropDatabase(database); err != nil {
 			return nil, err
 		}
@@ -222,6 +283,11 @@ func (spanner *Spanner) handleDDL(session *driver.Session, query string, node *s
 			return &sqltypes.Result{}, nil
 		}
 
+		// The tmp table of the reshard job is created before the shift.
+		if spanner.ddlJobs.isReshardTmpTable(database, table) {
+			return &sqltypes.Result{}, nil
+		}
+
 		// Check engine.
 		if err := checkEngine(ddl); err != nil {
 			return nil, err
@@ -237,9 +303,13 @@ func (spanner *Spanner) handleDDL(session *driver.Session, query string, node *s
 			return nil, err
 		}
 		extra := &router.Extra{
-			AutoIncrement: autoinc,
+			AutoIncrement:   autoinc,
+			ShardKeyDefault: getShardKeyDefault(ddl, shardKey),
 		}
 
+		if err := guard.Err(); err != nil {
+			return nil, err
+		}
 		switch partOpt := ddl.PartitionOption.(type) {
 		case *sqlparser.PartOptHash:
 			tableType = router.TableTypePartitionHash
@@ -318,11 +388,18 @@ func (spanner *Spanner) handleDDL(session *driver.Session, query string, node *s
 				return &sqltypes.Result{}, nil
 			}
 
+			if err := spanner.ddlJobs.checkIdle(db, table); err != nil {
+				return nil, err
+			}
+
 			// Execute.
 			r, err := spanner.ExecuteDDL(session, db, query, node)
 			if err != nil {
 				log.Error("spanner.ddl.execute[%v].error[%+v]", query, err)
 			}
+			if err := guard.Err(); err != nil {
+				return nil, err
+			}
 			if err := route.DropTable(db, table); err != nil {
 				log.Error("spanner.ddl.router.drop.table[%s].error[%+v]", table, err)
 			}
@@ -334,8 +411,7 @@ func (spanner *Spanner) handleDDL(session *driver.Session, query string, node *s
 		return r, nil
 	case sqlparser.CreateIndexStr, sqlparser.DropIndexStr,
 		sqlparser.AlterEngineStr, sqlparser.AlterCharsetStr,
-		sqlparser.AlterAddColumnStr, sqlparser.AlterDropColumnStr, sqlparser.AlterModifyColumnStr,
-		sqlparser.TruncateTableStr:
+		sqlparser.AlterAddColumnStr, sqlparser.AlterDropColumnStr, sqlparser.AlterModifyColumnStr:
 
 		// Check the database
 		if err := route.CheckDatabase(database); err != nil {
@@ -346,6 +422,41 @@ func (spanner *Spanner) handleDDL(session *driver.Session, query string, node *s
 		if !checkTableExists(database, table, route) {
 			return nil, sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, table)
 		}
+		// Execute as a ddl job.
+		r, err := spanner.ExecuteDDLJob(session, database, table, query, node)
+		if err != nil {
+			log.Error("spanner.ddl[%v].error[%+v]", query, err)
+		}
+		return r, err
+	case sqlparser.AlterPartitionStr:
+		// Check the database
+		if err := route.CheckDatabase(database); err != nil {
+			return nil, err
+		}
+
+		table := ddl.Table.Name.String()
+		if !checkTableExists(database, table, route) {
+			return nil, sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, table)
+		}
+		// Execute as a reshard job.
+		r, err := spanner.ExecuteReshardJob(session, database, table, query, node)
+		if err != nil {
+			log.Error("spanner.ddl[%v].error[%+v]", query, err)
+		}
+		return r, err
+	case sqlparser.TruncateTableStr:
+		// Check the database
+		if err := route.CheckDatabase(database); err != nil {
+			return nil, err
+		}
+
+		table := ddl.Table.Name.String()
+		if !checkTableExists(database, table, route) {
+			return nil, sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, table)
+		}
+		if err := spanner.ddlJobs.checkIdle(database, table); err != nil {
+			return nil, err
+		}
 		// Execute.
 		r, err := spanner.ExecuteDDL(session, database, query, node)
 		if err != nil {
@@ -372,6 +483,10 @@ func (spanner *Spanner) handleDDL(session *driver.Session, query string, node *s
 			return nil, sqldb.NewSQLError(sqldb.ER_TABLE_EXISTS_ERROR, toTable)
 		}
 
+		if err := spanner.ddlJobs.checkIdle(database, fromTable); err != nil {
+			return nil, err
+		}
+
 		// Execute.
 		r, err := spanner.ExecuteDDL(session, database, query, node)
 		if err != nil {
@@ -379,14 +494,69 @@ func (spanner *Spanner) handleDDL(session *driver.Session, query string, node *s
 			return r, err
 		}
 
+		if err := guard.Err(); err != nil {
+			return nil, err
+		}
 		err = route.RenameTable(database, fromTable, toTable)
 		if err != nil {
 			log.Error("spanner.ddl.router.rename.fromtable[%s].totable[%s].error[%+v]", fromTable, toTable, err)
 			return r, err
 		}
 		return r, nil
+	case sqlparser.CreateViewStr, sqlparser.AlterViewStr, sqlparser.DropViewStr:
+		if err := guard.Err(); err != nil {
+			return nil, err
+		}
+		r, err := spanner.handleView(database, ddl)
+		if err != nil {
+			log.Error("spanner.ddl.view[%v].error[%+v]", query, err)
+		}
+		return r, err
 	default:
 		log.Error("spanner.unsupported[%s].from.session[%v]", query, session.ID())
 		return nil, sqldb.NewSQLErrorf(sqldb.ER_UNKNOWN_ERROR, "unsupported.query:%v", query)
 	}
 }
+
+// handleDDLJob used to handle the CANCEL/RESUME DDL JOB command.
+func (spanner *Spanner) handleDDLJob(session *driver.Session, query string, node *sqlparser.DDLJob) (*sqltypes.Result, error) {
+	log := spanner.log
+	privilegePlug := spanner.plugins.PlugPrivilege()
+	if !privilegePlug.IsSuperPriv(session.User()) {
+		return nil, sqldb.NewSQLErrorf(sqldb.ER_SPECIFIC_ACCESS_DENIED_ERROR, "Access denied; lacking super privilege for the operation")
+	}
+
+	id := node.JobID.AsUint64()
+	log.Warning("spanner.ddl.job[%d].%s.from.session[%v]", id, node.Action, session.ID())
+	switch node.Action {
+	case sqlparser.CancelDDLJobStr:
+		if err := spanner.ddlJobs.Cancel(id); err != nil {
+			return nil, err
+		}
+		return &sqltypes.Result{}, nil
+	case sqlparser.ResumeDDLJobStr:
+		job, err := spanner.ddlJobs.Job(id)
+		if err != nil {
+			return nil, err
+		}
+		if job.State == ddlJobStateDone {
+			return nil, fmt.Errorf("ddl.job[%d].is.done", id)
+		}
+		stmt, err := sqlparser.Parse(job.Query)
+		if err != nil {
+			return nil, err
+		}
+		ddl, ok := stmt.(*sqlparser.DDL)
+		if !ok {
+			return nil, fmt.Errorf("ddl.job[%d].query[%s].is.not.ddl", id, job.Query)
+		}
+		if !checkTableExists(job.Database, job.Table, spanner.router) {
+			return nil, sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, job.Table)
+		}
+		if ddl.Action == sqlparser.AlterPartitionStr {
+			return spanner.ExecuteReshardJob(session, job.Database, job.Table, job.Query, ddl)
+		}
+		return spanner.ExecuteDDLJob(session, job.Database, job.Table, job.Query, ddl)
+	}
+	return nil, sqldb.NewSQLErrorf(sqldb.ER_UNKNOWN_ERROR, "unsupported.query:%v", query)
+}
@@ -11,7 +11,9 @@ package proxy
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"fakedb"
 
@@ -307,6 +309,19 @@ func TestProxyDDLTable(t *testing.T) {
 		assert.Equal(t, want, got)
 	}
 
+	// drop table(ACL), every qualified table is checked.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+		assert.Nil(t, err)
+		query := "drop table if exists test.t2, mysql.t2"
+		_, err = client.FetchAll(query, -1)
+		want := "Access denied; lacking privileges for database mysql (errno 1227) (sqlstate 42000)"
+		assert.NotNil(t, err)
+		if err != nil {
+			assert.Equal(t, want, err.Error())
+		}
+	}
+
 	// create test table.
 	{
 		client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
@@ -790,6 +805,62 @@ func TestProxyDDLCreateTable(t *testing.T) {
 	}
 }
 
+func TestProxyDDLCreateTableShardKeyDefault(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("insert into test.t1_.*", &sqltypes.Result{})
+	}
+
+	// create database.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "create database test"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	tcases := []struct {
+		query string
+		table string
+		want  string
+	}{
+		{"create table t1(a varchar(32) default 'x', b int) partition by hash(a)", "t1", "'x'"},
+		{"create table t2(a int default 10, b int) partition by hash(a)", "t2", "10"},
+		{"create table t3(a int, b int default 1) partition by hash(a)", "t3", ""},
+		{"create table t4(a int default null, b int) partition by hash(a)", "t4", ""},
+		{"create table t5(a int default 1, b int) single", "t5", ""},
+	}
+	for _, tcase := range tcases {
+		client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+		assert.Nil(t, err)
+		_, err = client.FetchAll(tcase.query, -1)
+		assert.Nil(t, err)
+
+		tconf, err := proxy.Router().TableConfig("test", tcase.table)
+		assert.Nil(t, err)
+		assert.Equal(t, tcase.want, tconf.ShardKeyDefault)
+	}
+
+	// insert without the shard key.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+		assert.Nil(t, err)
+		_, err = client.FetchAll("insert into t1(b) values(1)", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("insert into t3(b) values(1)", -1)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "unsupported: shardkey.column[a].missing")
+	}
+}
+
 func TestProxyDDLCreateTableError(t *testing.T) {
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
 	fakedbs, proxy, cleanup := MockProxy(log)
@@ -1358,3 +1429,43 @@ func TestProxyDDLUnsupportedAlter(t *testing.T) {
 		assert.Equal(t, want, got)
 	}
 }
+
+func TestProxyDDLClusterLock(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	_, err = client.FetchAll("create database test", -1)
+	assert.Nil(t, err)
+
+	// The database is locked by the other peer.
+	guard, err := proxy.Syncer().Lock("127.0.0.1:9090/session:1/mock", "drop database test", time.Second*3, 0, "test")
+	assert.Nil(t, err)
+	{
+		_, err := client.FetchAll("create table test.t1(id int, b int) partition by hash(id) partitions 8", -1)
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "syncer.lock[test.t1].is.held.by[127.0.0.1:9090/session:1/mock].for[drop database test]"))
+		_, err = client.FetchAll("radon rebalance", -1)
+		assert.NotNil(t, err)
+	}
+
+	// Released.
+	guard.Unlock()
+	{
+		_, err := client.FetchAll("create table test.t1(id int, b int) partition by hash(id) partitions 8", -1)
+		assert.Nil(t, err)
+		locks, err := proxy.Syncer().Locks()
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(locks))
+	}
+}
@@ -0,0 +1,492 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"backend"
+	"config"
+	"plugins/shiftmanager"
+	"xbase"
+	"xcontext"
+
+	"github.com/pkg/errors"
+	"github.com/radondb/shift/shift"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const (
+	ddlJobStatePending   = "pending"
+	ddlJobStateRunning   = "running"
+	ddlJobStateDone      = "done"
+	ddlJobStateFailed    = "failed"
+	ddlJobStateCancelled = "cancelled"
+
+	// maxDDLJobHistory is the max number of the jobs not running we keep in the file.
+	maxDDLJobHistory = 128
+)
+
+// DDLTask tuple, the ddl on one partition.
+type DDLTask struct {
+	Query     string    `json:"query"`
+	Backend   string    `json:"backend"`
+	Range     string    `json:"range"`
+	State     string    `json:"state"`
+	Attempts  int       `json:"attempts"`
+	StartTime time.Time `json:"start-time"`
+	EndTime   time.Time `json:"end-time"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// DDLJob tuple, a distributed ddl with the tasks of all partitions.
+type DDLJob struct {
+	ID        uint64     `json:"id"`
+	Database  string     `json:"database"`
+	Table     string     `json:"table"`
+	Query     string     `json:"query"`
+	State     string     `json:"state"`
+	StartTime time.Time  `json:"start-time"`
+	EndTime   time.Time  `json:"end-time"`
+	Error     string     `json:"error,omitempty"`
+	Tasks     []*DDLTask `json:"tasks"`
+
+	cancelled bool
+	lastErr   error
+	txns      map[*backend.Txn]struct{}
+	reshard   *reshard
+}
+
+// Progress returns the number of the done and failed tasks.
+func (job *DDLJob) Progress() (done int, failed int) {
+	for _, task := range job.Tasks {
+		switch task.State {
+		case ddlJobStateDone:
+			done++
+		case ddlJobStateFailed:
+			failed++
+		}
+	}
+	return
+}
+
+func (job *DDLJob) finished() bool {
+	return job.State == ddlJobStateDone
+}
+
+func (job *DDLJob) active() bool {
+	return job.State == ddlJobStateRunning || job.State == ddlJobStatePending
+}
+
+func (job *DDLJob) clone() *DDLJob {
+	cp := *job
+	cp.Tasks = make([]*DDLTask, 0, len(job.Tasks))
+	for _, task := range job.Tasks {
+		t := *task
+		cp.Tasks = append(cp.Tasks, &t)
+	}
+	cp.lastErr = nil
+	cp.txns = nil
+	cp.reshard = nil
+	return &cp
+}
+
+type ddlJobsJSON struct {
+	NextID uint64    `json:"next-id"`
+	Jobs   []*DDLJob `json:"jobs"`
+}
+
+// DDLJobs tuple, manages the distributed ddl jobs.
+// The jobs are persisted in the node-local file metadir/ddljobs.json,
+// so an interrupted job only re-runs the partitions which are not done.
+type DDLJobs struct {
+	log     *xlog.Log
+	conf    *config.Config
+	scatter *backend.Scatter
+	file    string
+	mu      sync.Mutex
+	nextID  uint64
+	jobs    []*DDLJob
+
+	// newShift creates the shift of the reshard job.
+	newShift func(info *shiftmanager.ShiftInfo) (shift.ShiftHandler, error)
+}
+
+// NewDDLJobs creates the new DDLJobs.
+func NewDDLJobs(log *xlog.Log, conf *config.Config, scatter *backend.Scatter) *DDLJobs {
+	return &DDLJobs{
+		log:     log,
+		conf:    conf,
+		scatter: scatter,
+		file:    path.Join(conf.Proxy.MetaDir, config.DDLJobsJSONFile),
+		nextID:  1,
+	}
+}
+
+// Init used to load the jobs from the file.
+// The jobs were running when radon stopped are marked failed, they can be resumed.
+func (d *DDLJobs) Init() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	log := d.log
+	data, err := ioutil.ReadFile(d.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.WithStack(err)
+	}
+
+	all := &ddlJobsJSON{}
+	if err := json.Unmarshal(data, all); err != nil {
+		log.Error("ddljobs.init.unmarshal[%s].error:%+v", d.file, err)
+		return errors.WithStack(err)
+	}
+	if all.NextID > d.nextID {
+		d.nextID = all.NextID
+	}
+	for _, job := range all.Jobs {
+		if job.active() {
+			for _, task := range job.Tasks {
+				if task.State == ddlJobStateRunning || task.State == ddlJobStatePending {
+					task.State = ddlJobStateFailed
+					task.Error = "interrupted"
+				}
+			}
+			job.State = ddlJobStateFailed
+			job.Error = "interrupted"
+			log.Warning("ddljobs.init.job[%d].query[%s].was.interrupted", job.ID, job.Query)
+		}
+		d.jobs = append(d.jobs, job)
+	}
+	return nil
+}
+
+// persist writes the jobs to the file, the caller must hold the lock.
+func (d *DDLJobs) persist() {
+	var history []*DDLJob
+	for _, job := range d.jobs {
+		if !job.active() {
+			history = append(history, job)
+		}
+	}
+	// Drop the oldest jobs which are done, failed or cancelled.
+	if len(history) > maxDDLJobHistory {
+		drop := make(map[*DDLJob]struct{})
+		for _, job := range history[:len(history)-maxDDLJobHistory] {
+			drop[job] = struct{}{}
+		}
+		jobs := make([]*DDLJob, 0, len(d.jobs))
+		for _, job := range d.jobs {
+			if _, ok := drop[job]; !ok {
+				jobs = append(jobs, job)
+			}
+		}
+		d.jobs = jobs
+	}
+
+	all := &ddlJobsJSON{
+		NextID: d.nextID,
+		Jobs:   d.jobs,
+	}
+	b, err := json.MarshalIndent(all, "", "\t")
+	if err != nil {
+		d.log.Error("ddljobs.persist.marshal.error:%+v", err)
+		return
+	}
+	if err := xbase.WriteFile(d.file, b); err != nil {
+		d.log.Error("ddljobs.persist.write[%s].error:%+v", d.file, err)
+	}
+}
+
+// Jobs returns the snapshot of all the jobs.
+func (d *DDLJobs) Jobs() []*DDLJob {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	jobs := make([]*DDLJob, 0, len(d.jobs))
+	for _, job := range d.jobs {
+		jobs = append(jobs, job.clone())
+	}
+	return jobs
+}
+
+// Job returns the snapshot of the job.
+func (d *DDLJobs) Job(id uint64) (*DDLJob, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	job := d.get(id)
+	if job == nil {
+		return nil, errors.Errorf("ddl.job[%d].not.found", id)
+	}
+	return job.clone(), nil
+}
+
+func (d *DDLJobs) get(id uint64) *DDLJob {
+	for _, job := range d.jobs {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+// prepare returns the job to run.
+// If there is an unfinished job with the same query on the table, it is resumed,
+// the partitions which are done won't be executed again.
+func (d *DDLJobs) prepare(database, table, query string, querys []xcontext.QueryTuple) (*DDLJob, error) {
+	job, err := d.start(database, table, query)
+	if err != nil {
+		return nil, err
+	}
+	d.setTasks(job, querys, true)
+	return job, nil
+}
+
+// start marks the job running, the unfinished job with the same query on the table is reused.
+func (d *DDLJobs) start(database, table, query string) (*DDLJob, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var job *DDLJob
+	for _, j := range d.jobs {
+		if j.Database != database || j.Table != table {
+			continue
+		}
+		if j.active() {
+			return nil, errors.Errorf("ddl.job[%d].is.running.on.table[%s.%s]", j.ID, database, table)
+		}
+		if !j.finished() && j.Query == query {
+			job = j
+		}
+	}
+
+	if job != nil {
+		d.log.Warning("ddljobs.resume.job[%d].query[%s]", job.ID, query)
+	} else {
+		job = &DDLJob{
+			ID:       d.nextID,
+			Database: database,
+			Table:    table,
+			Query:    query,
+		}
+		d.nextID++
+		d.jobs = append(d.jobs, job)
+	}
+	job.State = ddlJobStateRunning
+	job.Error = ""
+	job.StartTime = time.Now()
+	job.EndTime = time.Time{}
+	job.cancelled = false
+	job.lastErr = nil
+	job.txns = make(map[*backend.Txn]struct{})
+	d.persist()
+	return job, nil
+}
+
+// setTasks rebuilds the tasks with the newest route, the partitions may have moved.
+// If keepDone is true, the tasks which are done before won't be executed again.
+func (d *DDLJobs) setTasks(job *DDLJob, querys []xcontext.QueryTuple, keepDone bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// The partition query contains the sub-table name, it's the key of the task.
+	tasks := make([]*DDLTask, 0, len(querys))
+	for _, qt := range querys {
+		task := &DDLTask{
+			Query:   qt.Query,
+			Backend: qt.Backend,
+			Range:   qt.Range,
+			State:   ddlJobStatePending,
+		}
+		for _, old := range job.Tasks {
+			if old.Query == task.Query {
+				task.Attempts = old.Attempts
+				task.StartTime = old.StartTime
+				task.EndTime = old.EndTime
+				if keepDone && old.State == ddlJobStateDone {
+					task.State = ddlJobStateDone
+				}
+			}
+		}
+		tasks = append(tasks, task)
+	}
+	job.Tasks = tasks
+	d.persist()
+}
+
+// Run used to execute the ddl querys as a job.
+// The querys of one backend are executed with ddl-concurrency workers,
+// every task has its own ddl-timeout and its state is persisted once it ends.
+func (d *DDLJobs) Run(database, table, query string, querys []xcontext.QueryTuple) (*DDLJob, error) {
+	job, err := d.prepare(database, table, query, querys)
+	if err != nil {
+		return nil, err
+	}
+
+	concurrency := d.conf.Proxy.DDLConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	queues := make(map[string]chan *DDLTask)
+	for _, task := range job.Tasks {
+		if task.State == ddlJobStateDone {
+			continue
+		}
+		queue, ok := queues[task.Backend]
+		if !ok {
+			queue = make(chan *DDLTask, len(job.Tasks))
+			queues[task.Backend] = queue
+		}
+		queue <- task
+	}
+
+	var wg sync.WaitGroup
+	for _, queue := range queues {
+		close(queue)
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func(queue chan *DDLTask) {
+				defer wg.Done()
+				for task := range queue {
+					d.runTask(job, task)
+				}
+			}(queue)
+		}
+	}
+	wg.Wait()
+	return d.finish(job)
+}
+
+// finish ends the job by the cancelled flag and the last error of the tasks.
+func (d *DDLJobs) finish(job *DDLJob) (*DDLJob, error) {
+	log := d.log
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	err := job.lastErr
+	job.EndTime = time.Now()
+	job.txns = nil
+	switch {
+	case job.cancelled:
+		job.State = ddlJobStateCancelled
+		job.Error = "cancelled"
+		err = errors.Errorf("ddl.job[%d].was.cancelled", job.ID)
+	case err != nil:
+		job.State = ddlJobStateFailed
+		job.Error = err.Error()
+	default:
+		job.State = ddlJobStateDone
+	}
+	d.persist()
+	if err != nil {
+		done, failed := job.Progress()
+		log.Error("ddljobs.job[%d].query[%s].%s.done[%d].failed[%d].total[%d]", job.ID, job.Query, job.State, done, failed, len(job.Tasks))
+	}
+	return job.clone(), err
+}
+
+func (d *DDLJobs) runTask(job *DDLJob, task *DDLTask) {
+	log := d.log
+
+	d.mu.Lock()
+	if job.cancelled {
+		task.State = ddlJobStateCancelled
+		d.mu.Unlock()
+		return
+	}
+	txn, err := d.scatter.CreateTransaction()
+	if err != nil {
+		task.State = ddlJobStateFailed
+		task.Error = err.Error()
+		job.lastErr = err
+		d.persist()
+		d.mu.Unlock()
+		return
+	}
+	defer txn.Finish()
+	txn.SetTimeout(d.conf.Proxy.DDLTimeout)
+	job.txns[txn] = struct{}{}
+	task.State = ddlJobStateRunning
+	task.Attempts++
+	task.StartTime = time.Now()
+	task.Error = ""
+	retry := task.Attempts > 1
+	d.persist()
+	d.mu.Unlock()
+
+	_, err = txn.ExecuteOnThisBackend(task.Backend, task.Query)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(job.txns, txn)
+	task.EndTime = time.Now()
+	switch {
+	case err == nil:
+		task.State = ddlJobStateDone
+	case retry && ddlAlreadyApplied(err):
+		// The ddl was applied by the interrupted attempt.
+		log.Warning("ddljobs.job[%d].task.on[%s].query[%s].already.applied:%v", job.ID, task.Backend, task.Query, err)
+		task.State = ddlJobStateDone
+	case job.cancelled:
+		task.State = ddlJobStateCancelled
+		task.Error = err.Error()
+	default:
+		log.Error("ddljobs.job[%d].task.on[%s].query[%s].error:%+v", job.ID, task.Backend, task.Query, err)
+		task.State = ddlJobStateFailed
+		task.Error = err.Error()
+		job.lastErr = err
+	}
+	d.persist()
+}
+
+// ddlAlreadyApplied returns true if the error means the ddl has been applied on the partition.
+func ddlAlreadyApplied(err error) bool {
+	if se, ok := err.(*sqldb.SQLError); ok {
+		switch se.Num {
+		// ER_DUP_FIELDNAME, ER_DUP_KEYNAME, ER_CANT_DROP_FIELD_OR_KEY.
+		case 1060, 1061, 1091:
+			return true
+		}
+	}
+	return false
+}
+
+// Cancel used to cancel the running job, the running tasks are aborted.
+// The tasks which are done won't be rolled back.
+func (d *DDLJobs) Cancel(id uint64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	job := d.get(id)
+	if job == nil {
+		return errors.Errorf("ddl.job[%d].not.found", id)
+	}
+	if !job.active() {
+		return errors.Errorf("ddl.job[%d].is.%s.can.not.be.cancelled", id, job.State)
+	}
+	job.cancelled = true
+	for txn := range job.txns {
+		txn.Abort()
+	}
+	if job.reshard != nil {
+		job.reshard.abort()
+	}
+	d.log.Warning("ddljobs.job[%d].query[%s].cancelled", job.ID, job.Query)
+	return nil
+}
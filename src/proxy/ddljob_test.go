@@ -0,0 +1,295 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyDDLJobs(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("alter table .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id) partitions 8",
+		"alter table test.t1 add column(c1 int)",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	// show ddl jobs.
+	{
+		qr, err := client.FetchAll("show ddl jobs", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(qr.Rows))
+		want := "[1 test t1 done 5 5 0]"
+		got := fmt.Sprintf("%+v", qr.Rows[0][:7])
+		assert.Equal(t, want, got)
+	}
+
+	// show ddl job.
+	{
+		qr, err := client.FetchAll("show ddl job 1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 5, len(qr.Rows))
+		for _, row := range qr.Rows {
+			assert.Equal(t, "done", row[2].String())
+			assert.Equal(t, "1", row[3].String())
+		}
+	}
+
+	// show ddl job not found.
+	{
+		_, err := client.FetchAll("show ddl job 100", -1)
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "ddl.job[100].not.found"))
+	}
+
+	// resume a done job.
+	{
+		_, err := client.FetchAll("resume ddl job 1", -1)
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "ddl.job[1].is.done"))
+	}
+
+	// cancel a done job.
+	{
+		_, err := client.FetchAll("cancel ddl job 1", -1)
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "ddl.job[1].is.done.can.not.be.cancelled"))
+	}
+}
+
+func TestProxyDDLJobsResume(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	spanner := proxy.Spanner()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("alter table .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id) partitions 8",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	// One partition failed.
+	query := "alter table test.t1 add column(c1 int)"
+	{
+		fakedbs.AddQueryErrorPattern("alter table test.t1_0003 .*", errors.New("mock.alter.error"))
+		_, err = client.FetchAll(query, -1)
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "mock.alter.error"))
+
+		job, err := spanner.ddlJobs.Job(1)
+		assert.Nil(t, err)
+		assert.Equal(t, ddlJobStateFailed, job.State)
+		done, failed := job.Progress()
+		assert.Equal(t, 4, done)
+		assert.Equal(t, 1, failed)
+	}
+
+	// Re-issue the same ddl, only the failed partition is executed.
+	{
+		fakedbs.ResetPatternErrors()
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+
+		jobs := spanner.ddlJobs.Jobs()
+		assert.Equal(t, 1, len(jobs))
+		job := jobs[0]
+		assert.Equal(t, ddlJobStateDone, job.State)
+		for _, task := range job.Tasks {
+			assert.Equal(t, ddlJobStateDone, task.State)
+			if strings.Contains(task.Query, "t1_0003") {
+				assert.Equal(t, 2, task.Attempts)
+			} else {
+				assert.Equal(t, 1, task.Attempts)
+			}
+		}
+	}
+
+	// Resume by id, the column exists on the partitions which were interrupted.
+	{
+		query = "alter table test.t1 add column(c2 int)"
+		fakedbs.AddQueryErrorPattern("alter table test.t1_0004 .*", errors.New("mock.alter.error"))
+		_, err = client.FetchAll(query, -1)
+		assert.NotNil(t, err)
+
+		fakedbs.ResetPatternErrors()
+		fakedbs.AddQueryErrorPattern("alter table test.t1_0004 .*", sqldb.NewSQLError1(1060, "42S21", "Duplicate column name 'c2'"))
+		_, err = client.FetchAll("resume ddl job 2", -1)
+		assert.Nil(t, err)
+
+		job, err := spanner.ddlJobs.Job(2)
+		assert.Nil(t, err)
+		assert.Equal(t, ddlJobStateDone, job.State)
+	}
+
+	// Reload the jobs from the file.
+	{
+		ddlJobs := NewDDLJobs(log, spanner.conf, spanner.scatter)
+		err := ddlJobs.Init()
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(ddlJobs.Jobs()))
+		assert.Equal(t, uint64(3), ddlJobs.nextID)
+	}
+}
+
+func TestProxyDDLJobsCancel(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	spanner := proxy.Spanner()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id) partitions 8",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	job, err := spanner.ddlJobs.prepare("test", "t1", "alter table test.t1 engine=tokudb", nil)
+	assert.Nil(t, err)
+
+	// The table has a running job.
+	{
+		_, err := client.FetchAll("alter table test.t1 add column(c1 int)", -1)
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "ddl.job[1].is.running.on.table[test.t1]"))
+	}
+
+	// Cancel.
+	{
+		_, err := client.FetchAll(fmt.Sprintf("cancel ddl job %d", job.ID), -1)
+		assert.Nil(t, err)
+		assert.True(t, job.cancelled)
+	}
+}
+
+func TestProxyDDLJobsInterrupted(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	_, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	spanner := proxy.Spanner()
+
+	job, err := spanner.ddlJobs.prepare("test", "t1", "alter table test.t1 engine=tokudb", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, ddlJobStateRunning, job.State)
+
+	// Restart.
+	ddlJobs := NewDDLJobs(log, spanner.conf, spanner.scatter)
+	err = ddlJobs.Init()
+	assert.Nil(t, err)
+	got, err := ddlJobs.Job(job.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, ddlJobStateFailed, got.State)
+	assert.Equal(t, "interrupted", got.Error)
+}
+
+func TestProxyDDLJobsPrivilegeN(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxyPrivilegeN(log, MockDefaultConfig())
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"show ddl jobs",
+		"show ddl job 1",
+		"cancel ddl job 1",
+		"resume ddl job 1",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		want := "Access denied; lacking super privilege for the operation (errno 1227) (sqlstate 42000)"
+		assert.Equal(t, want, err.Error())
+	}
+}
+
+func TestProxyDDLJobsHistory(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	_, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	ddlJobs := proxy.Spanner().ddlJobs
+
+	states := []string{ddlJobStateDone, ddlJobStateFailed, ddlJobStateCancelled}
+	for i := 0; i < maxDDLJobHistory+10; i++ {
+		job, err := ddlJobs.prepare("test", fmt.Sprintf("t%d", i), "alter table t engine=tokudb", nil)
+		assert.Nil(t, err)
+		ddlJobs.mu.Lock()
+		job.State = states[i%len(states)]
+		ddlJobs.persist()
+		ddlJobs.mu.Unlock()
+	}
+	running, err := ddlJobs.prepare("test", "t", "alter table t engine=tokudb", nil)
+	assert.Nil(t, err)
+
+	// The failed and cancelled jobs are dropped as the done ones, the running job is kept.
+	jobs := ddlJobs.Jobs()
+	assert.Equal(t, maxDDLJobHistory+1, len(jobs))
+	assert.Equal(t, uint64(11), jobs[0].ID)
+	assert.Equal(t, running.ID, jobs[len(jobs)-1].ID)
+}
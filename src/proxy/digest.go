@@ -0,0 +1,236 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"monitor"
+
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+const (
+	// digestBuckets is the number of the latency histogram buckets,
+	// the bucket i counts the latencies in [2^(i-1), 2^i) microseconds.
+	digestBuckets = 32
+
+	// digestTextMax is the max length of the digest text.
+	digestTextMax = 1024
+
+	// digestLabelMax is the max length of the digest text in the prometheus label.
+	digestLabelMax = 128
+
+	// DigestOverflow is the digest of the statements beyond the max digests.
+	DigestOverflow = "overflow"
+)
+
+// digestFormatter replaces the literals with '?' and collapses the value lists,
+// so the statements differ only in the values have the same digest text.
+func digestFormatter(buf *sqlparser.TrackedBuffer, node sqlparser.SQLNode) {
+	switch node := node.(type) {
+	case *sqlparser.SQLVal:
+		buf.WriteString("?")
+	case sqlparser.ValTuple:
+		for _, expr := range node {
+			switch expr.(type) {
+			case *sqlparser.SQLVal, *sqlparser.NullVal, sqlparser.BoolVal:
+			default:
+				buf.Myprintf("(%v)", sqlparser.Exprs(node))
+				return
+			}
+		}
+		buf.WriteString("(...)")
+	case sqlparser.Values:
+		if len(node) > 0 {
+			buf.Myprintf("values (%v)", sqlparser.Exprs(node[0]))
+		}
+	default:
+		node.Format(buf)
+	}
+}
+
+// QueryDigestOf returns the digest and the digest text of the statement.
+func QueryDigestOf(node sqlparser.Statement) (string, string) {
+	buf := sqlparser.NewTrackedBuffer(digestFormatter)
+	buf.Myprintf("%v", node)
+	text := buf.String()
+	sum := md5.Sum([]byte(text))
+	if len(text) > digestTextMax {
+		text = text[:digestTextMax]
+	}
+	return hex.EncodeToString(sum[:]), text
+}
+
+// QueryDigest tuple.
+type QueryDigest struct {
+	Digest       string        `json:"digest"`
+	Text         string        `json:"digest-text"`
+	Count        uint64        `json:"count"`
+	Errors       uint64        `json:"errors"`
+	TotalLatency time.Duration `json:"total-latency"`
+	MaxLatency   time.Duration `json:"max-latency"`
+	P95Latency   time.Duration `json:"p95-latency"`
+	P99Latency   time.Duration `json:"p99-latency"`
+	RowsSent     uint64        `json:"rows-sent"`
+	RowsAffected uint64        `json:"rows-affected"`
+	Shards       uint64        `json:"shards"`
+	Scatters     uint64        `json:"scatters"`
+	FirstSeen    time.Time     `json:"first-seen"`
+	LastSeen     time.Time     `json:"last-seen"`
+	buckets      [digestBuckets]uint64
+}
+
+// percentile returns the upper bound of the bucket which the percentile p falls in,
+// capped by the max latency.
+func (d *QueryDigest) percentile(p float64) time.Duration {
+	rank := uint64(math.Ceil(float64(d.Count) * p))
+	if rank == 0 {
+		rank = 1
+	}
+	var sum uint64
+	for i, n := range d.buckets {
+		sum += n
+		if sum >= rank {
+			upper := time.Duration(uint64(1)<<uint(i)) * time.Microsecond
+			if upper > d.MaxLatency {
+				upper = d.MaxLatency
+			}
+			return upper
+		}
+	}
+	return d.MaxLatency
+}
+
+// QueryDigests used to aggregate the statistics of the statements by digest.
+type QueryDigests struct {
+	mu      sync.Mutex
+	max     int
+	digests map[string]*QueryDigest
+}
+
+// NewQueryDigests creates the new QueryDigests, at most max digests are kept and
+// the others are aggregated to the overflow digest, nil is returned if max is 0.
+func NewQueryDigests(max int) *QueryDigests {
+	if max <= 0 {
+		return nil
+	}
+	return &QueryDigests{
+		max:     max,
+		digests: make(map[string]*QueryDigest),
+	}
+}
+
+// Digest returns the digest and the digest text of the statement, empty if disabled.
+// It must be called before the execution since the planner rewrites the statement.
+func (qd *QueryDigests) Digest(node sqlparser.Statement) (string, string) {
+	if qd == nil {
+		return "", ""
+	}
+	return QueryDigestOf(node)
+}
+
+// Record used to record the execution of the statement with the digest.
+func (qd *QueryDigests) Record(digest string, text string, latency time.Duration, qr *sqltypes.Result, err error, shards uint64) {
+	if qd == nil || digest == "" {
+		return
+	}
+	now := time.Now()
+
+	qd.mu.Lock()
+	defer qd.mu.Unlock()
+	d, ok := qd.digests[digest]
+	if !ok {
+		if len(qd.digests) >= qd.max {
+			digest, text = DigestOverflow, ""
+			d = qd.digests[digest]
+		}
+		if d == nil {
+			d = &QueryDigest{Digest: digest, Text: text, FirstSeen: now}
+			qd.digests[digest] = d
+		}
+	}
+	d.Count++
+	if err != nil {
+		d.Errors++
+	}
+	d.TotalLatency += latency
+	if latency > d.MaxLatency {
+		d.MaxLatency = latency
+	}
+	bucket := 0
+	for us := latency.Nanoseconds() / 1000; us > 0 && bucket < digestBuckets-1; us >>= 1 {
+		bucket++
+	}
+	d.buckets[bucket]++
+	if qr != nil {
+		d.RowsSent += uint64(len(qr.Rows))
+		d.RowsAffected += qr.RowsAffected
+	}
+	d.Shards += shards
+	if shards > 1 {
+		d.Scatters++
+	}
+	d.LastSeen = now
+}
+
+// Rows returns the copies of the digests order by the total latency desc, limit 0 means all.
+func (qd *QueryDigests) Rows(limit int) []*QueryDigest {
+	if qd == nil {
+		return nil
+	}
+	qd.mu.Lock()
+	rows := make([]*QueryDigest, 0, len(qd.digests))
+	for _, d := range qd.digests {
+		row := *d
+		row.P95Latency = d.percentile(0.95)
+		row.P99Latency = d.percentile(0.99)
+		rows = append(rows, &row)
+	}
+	qd.mu.Unlock()
+
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].TotalLatency != rows[j].TotalLatency {
+			return rows[i].TotalLatency > rows[j].TotalLatency
+		}
+		return rows[i].Digest < rows[j].Digest
+	})
+	if limit > 0 && len(rows) > limit {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+// Metrics returns the top digests for the prometheus export.
+func (qd *QueryDigests) Metrics(limit int) []*monitor.QueryDigestMetric {
+	rows := qd.Rows(limit)
+	metrics := make([]*monitor.QueryDigestMetric, 0, len(rows))
+	for _, row := range rows {
+		text := row.Text
+		if len(text) > digestLabelMax {
+			text = text[:digestLabelMax]
+		}
+		metrics = append(metrics, &monitor.QueryDigestMetric{
+			Digest:  row.Digest,
+			Text:    text,
+			Count:   row.Count,
+			Errors:  row.Errors,
+			Latency: row.TotalLatency.Seconds(),
+			Rows:    row.RowsSent + row.RowsAffected,
+			Shards:  row.Shards,
+		})
+	}
+	return metrics
+}
@@ -0,0 +1,88 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+func TestQueryDigestOf(t *testing.T) {
+	querys := []struct {
+		query string
+		text  string
+	}{
+		{"select * from t1 where a=1 and b='x'", "select * from t1 where a = ? and b = ?"},
+		{"select * from t1 where a in (1, 2, 3) limit 10", "select * from t1 where a in (...) limit ?"},
+		{"select * from t1 where a in (1, b)", "select * from t1 where a in (?, b)"},
+		{"insert into t1(a, b) values(1, 'x'), (2, 'y')", "insert into t1(a, b) values (?, ?)"},
+		{"update t1 set a=a+1 where id=3", "update t1 set a = a + ? where id = ?"},
+	}
+	for _, q := range querys {
+		node, err := sqlparser.Parse(q.query)
+		assert.Nil(t, err)
+		digest, text := QueryDigestOf(node)
+		assert.Equal(t, q.text, text)
+		assert.Equal(t, 32, len(digest))
+	}
+
+	// The statements differ only in the values have the same digest.
+	node1, _ := sqlparser.Parse("select * from t1 where a in (1, 2)")
+	node2, _ := sqlparser.Parse("select * from t1 where a in (3, 4, 5)")
+	digest1, _ := QueryDigestOf(node1)
+	digest2, _ := QueryDigestOf(node2)
+	assert.Equal(t, digest1, digest2)
+}
+
+func TestQueryDigests(t *testing.T) {
+	assert.Nil(t, NewQueryDigests(0))
+	var disabled *QueryDigests
+	digest, _ := disabled.Digest(nil)
+	assert.Equal(t, "", digest)
+	disabled.Record("d", "t", time.Second, nil, nil, 1)
+	assert.Nil(t, disabled.Rows(0))
+
+	qd := NewQueryDigests(2)
+	qd.Record("d1", "t1", time.Millisecond, &sqltypes.Result{Rows: make([][]sqltypes.Value, 3)}, nil, 1)
+	for i := 0; i < 99; i++ {
+		qd.Record("d2", "t2", time.Millisecond, &sqltypes.Result{RowsAffected: 1}, nil, 4)
+	}
+	qd.Record("d2", "t2", time.Second, nil, errors.New("mock.error"), 4)
+	// Beyond the max.
+	qd.Record("d3", "t3", time.Millisecond, nil, nil, 1)
+	qd.Record("d4", "t4", time.Millisecond, nil, nil, 1)
+
+	rows := qd.Rows(0)
+	assert.Equal(t, 3, len(rows))
+	d2 := rows[0]
+	assert.Equal(t, "d2", d2.Digest)
+	assert.EqualValues(t, 100, d2.Count)
+	assert.EqualValues(t, 1, d2.Errors)
+	assert.EqualValues(t, 99, d2.RowsAffected)
+	assert.EqualValues(t, 400, d2.Shards)
+	assert.EqualValues(t, 100, d2.Scatters)
+	assert.Equal(t, time.Second, d2.MaxLatency)
+	assert.True(t, d2.P95Latency >= time.Millisecond && d2.P95Latency < 2*time.Millisecond)
+	assert.True(t, d2.P99Latency >= time.Millisecond && d2.P99Latency < 2*time.Millisecond)
+
+	overflow := rows[1]
+	assert.Equal(t, DigestOverflow, overflow.Digest)
+	assert.EqualValues(t, 2, overflow.Count)
+	assert.EqualValues(t, 3, rows[2].RowsSent)
+
+	assert.Equal(t, 1, len(qd.Rows(1)))
+	metrics := qd.Metrics(2)
+	assert.Equal(t, 2, len(metrics))
+	assert.EqualValues(t, 499, metrics[0].Rows+metrics[0].Shards)
+}
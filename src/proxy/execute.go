@@ -9,6 +9,7 @@
 package proxy
 
 import (
+	"strconv"
 	"strings"
 
 	"executor"
@@ -33,11 +34,15 @@ func (spanner *Spanner) ExecuteMultiStmtsInTxn(session *driver.Session, database
 
 	sessions.MultiStmtTxnBinding(session, nil, node, query)
 
-	plans, err := optimizer.NewSimpleOptimizer(log, database, query, node, router).BuildPlanTree()
+	span := sessions.Trace(session)
+	so := optimizer.NewSimpleOptimizer(log, database, query, node, router)
+	so.SetTrace(span)
+	plans, err := so.BuildPlanTree()
 	if err != nil {
 		return nil, err
 	}
 	executors := executor.NewTree(log, plans, txSession.transaction)
+	executors.SetTrace(span)
 	qr, err := executors.Execute()
 	if err != nil {
 		// need the user to rollback
@@ -68,7 +73,9 @@ func (spanner *Spanner) ExecuteSingleStmtTxnTwoPC(session *driver.Session, datab
 	txn.SetTimeout(conf.Proxy.QueryTimeout)
 	txn.SetMaxResult(conf.Proxy.MaxResultSize)
 	txn.SetMaxJoinRows(conf.Proxy.MaxJoinRows)
+	txn.SetGroupConcatMaxLen(conf.Proxy.GroupConcatMaxLen)
 	txn.SetIsExecOnRep(isExecOnRep(conf.Proxy.LoadBalance, node))
+	txn.SetMaxReplicaLag(maxReplicaLag(conf.Proxy.MaxReplicaLag, node))
 
 	// binding.
 	sessions.TxnBinding(session, txn, node, query)
@@ -81,12 +88,16 @@ func (spanner *Spanner) ExecuteSingleStmtTxnTwoPC(session *driver.Session, datab
 	}
 
 	// Transaction execute.
-	plans, err := optimizer.NewSimpleOptimizer(log, database, query, node, router).BuildPlanTree()
+	span := sessions.Trace(session)
+	so := optimizer.NewSimpleOptimizer(log, database, query, node, router)
+	so.SetTrace(span)
+	plans, err := so.BuildPlanTree()
 	if err != nil {
 		return nil, err
 	}
 
 	executors := executor.NewTree(log, plans, txn)
+	executors.SetTrace(span)
 	qr, err := executors.Execute()
 	if err != nil {
 		if x := txn.RollbackPhaseOne(); x != nil {
@@ -122,6 +133,27 @@ func (spanner *Spanner) ExecuteDDL(session *driver.Session, database string, que
 	return spanner.executeWithTimeout(session, database, query, node, timeout)
 }
 
+// ExecuteDDLJob used to execute the ddl as a DDLJob, every partition is a task with DDLTimeout limits.
+// If the same ddl on the table failed before, only the partitions which are not done will be executed.
+func (spanner *Spanner) ExecuteDDLJob(session *driver.Session, database string, table string, query string, node *sqlparser.DDL) (*sqltypes.Result, error) {
+	log := spanner.log
+	log.Info("spanner.execute.ddl.job.query:%s", query)
+
+	txSession := spanner.sessions.getTxnSession(session)
+	if spanner.isTwoPC() && txSession.transaction != nil {
+		return nil, errors.Errorf("in.multiStmtTrans.unsupported.DDL:%v.", query)
+	}
+
+	plan := planner.NewDDLPlan(log, database, query, node, spanner.router)
+	if err := plan.Build(); err != nil {
+		return nil, err
+	}
+	if _, err := spanner.ddlJobs.Run(database, table, query, plan.Querys); err != nil {
+		return nil, err
+	}
+	return &sqltypes.Result{}, nil
+}
+
 // ExecuteNormal used to execute non-2pc querys to shards with timeout limits.
 // timeout:
 //    0x01. if timeout <= 0, no limits.
@@ -145,17 +177,23 @@ func (spanner *Spanner) executeWithTimeout(session *driver.Session, database str
 	txn.SetTimeout(timeout)
 	txn.SetMaxResult(conf.Proxy.MaxResultSize)
 	txn.SetMaxJoinRows(conf.Proxy.MaxJoinRows)
+	txn.SetGroupConcatMaxLen(conf.Proxy.GroupConcatMaxLen)
 	txn.SetIsExecOnRep(isExecOnRep(conf.Proxy.LoadBalance, node))
+	txn.SetMaxReplicaLag(maxReplicaLag(conf.Proxy.MaxReplicaLag, node))
 
 	// binding.
 	sessions.TxnBinding(session, txn, node, query)
 	defer sessions.TxnUnBinding(session)
 
-	plans, err := optimizer.NewSimpleOptimizer(log, database, query, node, router).BuildPlanTree()
+	span := sessions.Trace(session)
+	so := optimizer.NewSimpleOptimizer(log, database, query, node, router)
+	so.SetTrace(span)
+	plans, err := so.BuildPlanTree()
 	if err != nil {
 		return nil, err
 	}
 	executors := executor.NewTree(log, plans, txn)
+	executors.SetTrace(span)
 	qr, err := executors.Execute()
 	if err != nil {
 		return nil, err
@@ -199,6 +237,7 @@ func (spanner *Spanner) ExecuteStreamFetch(session *driver.Session, database str
 	reqCtx.Mode = m.ReqMode
 	reqCtx.Querys = m.GetQuery()
 	reqCtx.RawQuery = plan.RawQuery
+	reqCtx.Span = sessions.Trace(session)
 	streamBufferSize := spanner.conf.Proxy.StreamBufferSize
 	return txn.ExecuteStreamFetch(reqCtx, callback, streamBufferSize)
 }
@@ -282,3 +321,20 @@ func isExecOnRep(loadBalance int, node sqlparser.Statement) bool {
 	}
 	return false
 }
+
+// maxReplicaLag returns the max seconds of the replica lag for the query,
+// the hint /*+ max_replica_lag=N */ overrides the global `max-replica-lag`.
+func maxReplicaLag(lag int, node sqlparser.Statement) int {
+	if node, ok := node.(*sqlparser.Select); ok {
+		for _, c := range node.Comments {
+			comment := strings.Replace(common.BytesToString(c), " ", "", -1)
+			if strings.HasPrefix(comment, "/*+max_replica_lag=") && strings.HasSuffix(comment, "*/") {
+				val := strings.TrimSuffix(strings.TrimPrefix(comment, "/*+max_replica_lag="), "*/")
+				if n, err := strconv.Atoi(val); err == nil && n >= 0 {
+					return n
+				}
+			}
+		}
+	}
+	return lag
+}
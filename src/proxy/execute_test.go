@@ -17,6 +17,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/driver"
 	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
@@ -593,3 +594,21 @@ func TestProxyExecuteLoadBalance(t *testing.T) {
 		assert.Nil(t, err)
 	}
 }
+
+func TestMaxReplicaLag(t *testing.T) {
+	tests := []struct {
+		query string
+		lag   int
+	}{
+		{"select * from t1", 10},
+		{"select /*+ max_replica_lag=5 */ * from t1", 5},
+		{"select /*+ loadbalance=1 */ /*+ max_replica_lag = 0 */ * from t1", 0},
+		{"select /*+ max_replica_lag=x */ * from t1", 10},
+		{"insert into t1 values(1)", 10},
+	}
+	for _, test := range tests {
+		node, err := sqlparser.Parse(test.query)
+		assert.Nil(t, err)
+		assert.Equal(t, test.lag, maxReplicaLag(10, node), test.query)
+	}
+}
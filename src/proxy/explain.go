@@ -11,8 +11,10 @@ package proxy
 import (
 	"fmt"
 	"regexp"
+	"strings"
 
 	"optimizer"
+	"xtrace"
 
 	"github.com/pkg/errors"
 	"github.com/xelabs/go-mysqlstack/driver"
@@ -22,6 +24,9 @@ import (
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 )
 
+// AnalyzeRegexp matches the ANALYZE of 'EXPLAIN ANALYZE'.
+var AnalyzeRegexp = regexp.MustCompile(`^(?i)\s*analyze\s+`)
+
 // handleExplain used to handle the EXPLAIN command.
 func (spanner *Spanner) handleExplain(session *driver.Session, query string, node sqlparser.Statement) (*sqltypes.Result, error) {
 	log := spanner.log
@@ -39,6 +44,11 @@ func (spanner *Spanner) handleExplain(session *driver.Session, query string, nod
 		return nil, errors.Errorf("explain.query[%s].syntax.error", query)
 	}
 	cutQuery := query[idx[1]:]
+	analyze := false
+	if idx := AnalyzeRegexp.FindStringIndex(cutQuery); idx != nil {
+		cutQuery = cutQuery[idx[1]:]
+		analyze = true
+	}
 	subNode, err := sqlparser.Parse(cutQuery)
 	if err != nil {
 		msg := fmt.Sprintf("query[%s].parser.error: %v", cutQuery, err)
@@ -62,7 +72,7 @@ func (spanner *Spanner) handleExplain(session *driver.Session, query string, nod
 	case *sqlparser.Delete:
 	case *sqlparser.Insert:
 		autoincPlug := spanner.plugins.PlugAutoIncrement()
-		if err := autoincPlug.Process(database, subNode.(*sqlparser.Insert)); err != nil {
+		if _, err := autoincPlug.Process(database, subNode.(*sqlparser.Insert)); err != nil {
 			return nil, err
 		}
 	case *sqlparser.Update:
@@ -71,6 +81,14 @@ func (spanner *Spanner) handleExplain(session *driver.Session, query string, nod
 		return nil, sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, "explain only supports SELECT/DELETE/INSERT/UNION")
 	}
 
+	if analyze {
+		switch subNode.(type) {
+		case *sqlparser.Select, *sqlparser.Union:
+			return spanner.handleExplainAnalyze(session, database, cutQuery, subNode)
+		}
+		return nil, sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, "explain analyze only supports SELECT/UNION")
+	}
+
 	simOptimizer := optimizer.NewSimpleOptimizer(log, database, cutQuery, subNode, router)
 	planTree, err := simOptimizer.BuildPlanTree()
 	if err != nil {
@@ -88,3 +106,61 @@ func (spanner *Spanner) handleExplain(session *driver.Session, query string, nod
 	}
 	return qr, nil
 }
+
+// handleExplainAnalyze used to execute the statement and return the runtime statistics of every node,
+// the statistics are collected by the spans bound to the session during the execution.
+func (spanner *Spanner) handleExplainAnalyze(session *driver.Session, database string, query string, node sqlparser.Statement) (*sqltypes.Result, error) {
+	sessions := spanner.sessions
+
+	maxSpans := 0
+	if spanner.conf.Trace != nil {
+		maxSpans = spanner.conf.Trace.MaxSpans
+	}
+	root := xtrace.NewSpan("explain.analyze", maxSpans)
+	prev := sessions.Trace(session)
+	sessions.TraceBinding(session, root)
+	rs, err := spanner.ExecuteDML(session, database, query, node)
+	sessions.TraceBinding(session, prev)
+	if err != nil {
+		return nil, err
+	}
+	root.SetAttr("rows", len(rs.Rows))
+	root.Finish()
+
+	qr := &sqltypes.Result{}
+	qr.Fields = []*querypb.Field{
+		{Name: "Node", Type: querypb.Type_VARCHAR},
+		{Name: "Rows", Type: querypb.Type_INT64},
+		{Name: "Bytes", Type: querypb.Type_INT64},
+		{Name: "Time_ms", Type: querypb.Type_FLOAT64},
+		{Name: "Info", Type: querypb.Type_VARCHAR},
+	}
+	number := func(v string) sqltypes.Value {
+		if v == "" {
+			return sqltypes.NULL
+		}
+		return sqltypes.MakeTrusted(querypb.Type_INT64, []byte(v))
+	}
+	xtrace.WalkTrace(root.Spans(), func(span *xtrace.Span, depth int) {
+		var infos []string
+		for _, attr := range span.Attrs {
+			switch attr.Key {
+			case "rows", "bytes":
+			default:
+				infos = append(infos, fmt.Sprintf("%s=%s", attr.Key, attr.Value))
+			}
+		}
+		if span.Err != "" {
+			infos = append(infos, fmt.Sprintf("error=%s", span.Err))
+		}
+		row := []sqltypes.Value{
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(strings.Repeat("  ", depth)+"-> "+span.Name)),
+			number(span.Attr("rows")),
+			number(span.Attr("bytes")),
+			sqltypes.MakeTrusted(querypb.Type_FLOAT64, []byte(fmt.Sprintf("%.3f", float64(span.Duration().Nanoseconds())/1e6))),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(strings.Join(infos, " "))),
+		}
+		qr.Rows = append(qr.Rows, row)
+	})
+	return qr, nil
+}
@@ -9,10 +9,12 @@
 package proxy
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
@@ -229,7 +231,7 @@ func TestProxyExplain(t *testing.T) {
 	}
 }`
 		got := string(qr.Rows[0][0].Raw())
-		log.Info(got)
+		log.Info("%s", got)
 		assert.Equal(t, want, got)
 	}
 }
@@ -315,3 +317,74 @@ func TestProxyExplainPrivilege(t *testing.T) {
 		assert.NotNil(t, err)
 	}
 }
+
+func TestProxyExplainAnalyze(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select .* from test.t1_.*", &sqltypes.Result{
+			Fields: []*querypb.Field{{Name: "id", Type: querypb.Type_INT32}, {Name: "b", Type: querypb.Type_INT32}},
+			Rows: [][]sqltypes.Value{
+				{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1")), sqltypes.MakeTrusted(querypb.Type_INT32, []byte("11"))},
+			},
+		})
+	}
+
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		querys := []string{
+			"create database test",
+			"create table test.t1(id int, b int) partition by hash(id)",
+		}
+		for _, query := range querys {
+			_, err = client.FetchAll(query, -1)
+			assert.Nil(t, err)
+		}
+
+		// Single shard.
+		qr, err := client.FetchAll("explain analyze select id, b from test.t1 where id=1", -1)
+		assert.Nil(t, err)
+		var nodes []string
+		for _, row := range qr.Rows {
+			nodes = append(nodes, row[0].String())
+		}
+		want := []string{
+			"-> explain.analyze",
+			"  -> optimizer.build",
+			"  -> executor.select",
+			"    -> engine.merge",
+			"      -> backend.execute",
+		}
+		assert.Equal(t, want, nodes)
+		backend := qr.Rows[4]
+		assert.Equal(t, "1", backend[1].String())
+		assert.Equal(t, "3", backend[2].String())
+		assert.True(t, strings.Contains(backend[4].String(), "query=select id, b from test.t1_0017 as t1 where id = 1"))
+
+		// Scatter with the operators.
+		qr, err = client.FetchAll("explain analyze select id, b from test.t1 order by b limit 1", -1)
+		assert.Nil(t, err)
+		n := len(qr.Rows)
+		assert.True(t, n > 6)
+		assert.Equal(t, "1", qr.Rows[0][1].String())
+		assert.Equal(t, "    -> engine.merge", qr.Rows[3][0].String())
+		for _, row := range qr.Rows[4 : n-2] {
+			assert.Equal(t, "      -> backend.execute", row[0].String())
+		}
+		assert.Equal(t, "      -> operator.orderby", qr.Rows[n-2][0].String())
+		assert.Equal(t, "      -> operator.limit", qr.Rows[n-1][0].String())
+		assert.Equal(t, "1", qr.Rows[n-1][1].String())
+
+		_, err = client.FetchAll("explain analyze delete from test.t1 where id=1", -1)
+		assert.NotNil(t, err)
+		assert.True(t, strings.HasSuffix(err.Error(), "explain analyze only supports SELECT/UNION (errno 1149) (sqlstate 42000)"))
+	}
+}
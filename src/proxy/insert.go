@@ -20,8 +20,21 @@ func (spanner *Spanner) handleInsert(session *driver.Session, query string, node
 	autoincPlug := spanner.plugins.PlugAutoIncrement()
 
 	// AutoIncrement plugin process.
-	if err := autoincPlug.Process(database, node.(*sqlparser.Insert)); err != nil {
+	id, err := autoincPlug.Process(database, node.(*sqlparser.Insert))
+	if err != nil {
 		return nil, err
 	}
-	return spanner.ExecuteDML(session, database, query, node)
+	qr, err := spanner.ExecuteDML(session, database, query, node)
+	if err != nil {
+		return nil, err
+	}
+
+	// The first generated value is returned by the OK packet and LAST_INSERT_ID().
+	if id > 0 {
+		qr.InsertID = id
+		if txSession := spanner.sessions.getTxnSession(session); txSession != nil {
+			txSession.setLastInsertID(id)
+		}
+	}
+	return qr, nil
 }
@@ -0,0 +1,329 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"backend"
+	"planner"
+	"xcontext"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+var (
+	// loadDataBatchSize is the max bytes of the rows sent to the backends in one batch,
+	// it bounds the memory used by one LOAD DATA.
+	loadDataBatchSize = 1024 * 1024
+)
+
+// loadDataShard is the backend table of the partition range.
+type loadDataShard struct {
+	backend string
+	rng     string
+}
+
+// loadDataStat is the statistics of the LOAD DATA.
+type loadDataStat struct {
+	qr *sqltypes.Result
+	// shards is the rows number of every backend table.
+	shards   map[loadDataShard]int
+	warnings uint64
+}
+
+// handleLoadData used to handle the LOAD DATA LOCAL INFILE command.
+// The file is streamed from the client and parsed by the FIELDS/LINES options, every batch of the rows
+// is built as an INSERT and routed to the backends by the shard key.
+func (spanner *Spanner) handleLoadData(session *driver.Session, query string, node *sqlparser.LoadData) (*sqltypes.Result, error) {
+	log := spanner.log
+	router := spanner.router
+	sessions := spanner.sessions
+
+	database := session.Schema()
+	if !node.Table.Qualifier.IsEmpty() {
+		database = node.Table.Qualifier.String()
+	}
+	if database == "" {
+		return nil, sqldb.NewSQLError(sqldb.ER_NO_DB_ERROR)
+	}
+	table := node.Table.Name.String()
+
+	if !node.Local {
+		return nil, errors.New("unsupported: load.data.infile.without.local")
+	}
+	// The rows are sent as the strings in the utf8 connections of the backends.
+	switch strings.ToLower(node.Charset) {
+	case "", "utf8", "utf8mb4":
+	default:
+		return nil, errors.Errorf("unsupported: load.data.character.set[%s]", node.Charset)
+	}
+	privilegePlug := spanner.plugins.PlugPrivilege()
+	if err := privilegePlug.Check(session.Schema(), session.User(), node); err != nil {
+		return nil, err
+	}
+	if _, err := router.TableConfig(database, table); err != nil {
+		return nil, err
+	}
+	columns, numerics, err := spanner.loadDataColumns(database, table, node.Columns)
+	if err != nil {
+		return nil, err
+	}
+
+	// The client must send the file(maybe empty) after the request, the rest of the file
+	// is drained by Close if the load is broken.
+	file, err := session.LocalInfile(node.Infile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader, err := newLoadDataReader(file, node)
+	if err != nil {
+		return nil, err
+	}
+	if node.IgnoreLines != nil {
+		if err := reader.skipLines(int(node.IgnoreLines.AsUint64())); err != nil && err != io.EOF {
+			return nil, err
+		}
+	}
+
+	stat := &loadDataStat{
+		qr:     &sqltypes.Result{},
+		shards: make(map[loadDataShard]int),
+	}
+
+	txSession := sessions.getTxnSession(session)
+	if spanner.isTwoPC() && txSession.transaction != nil {
+		// In the multiple statements transaction, need the user to rollback if error.
+		sessions.MultiStmtTxnBinding(session, nil, node, query)
+		if err := spanner.loadDataRows(session, database, node, reader, columns, numerics, txSession.transaction, stat); err != nil {
+			return nil, err
+		}
+		sessions.MultiStmtTxnUnBinding(session, false)
+	} else {
+		txn, err := spanner.scatter.CreateTransaction()
+		if err != nil {
+			log.Error("spanner.txn.create.error:[%v]", err)
+			return nil, err
+		}
+		defer txn.Finish()
+		txn.SetTimeout(spanner.conf.Proxy.QueryTimeout)
+
+		// binding.
+		sessions.TxnBinding(session, txn, node, query)
+		defer sessions.TxnUnBinding(session)
+
+		if !spanner.isTwoPC() {
+			// Every batch is committed on its own, the batches before the failed one are kept.
+			if err := spanner.loadDataRows(session, database, node, reader, columns, numerics, txn, stat); err != nil {
+				return nil, err
+			}
+		} else {
+			// All the rows are loaded in one distributed transaction.
+			if err := txn.Begin(); err != nil {
+				log.Error("spanner.load.data.2pc.txn.begin.error:[%v]", err)
+				return nil, err
+			}
+			if err := spanner.loadDataRows(session, database, node, reader, columns, numerics, txn, stat); err != nil {
+				if x := txn.RollbackPhaseOne(); x != nil {
+					log.Error("spanner.load.data.2pc.error.to.rollback.phaseOne.still.error:[%v]", x)
+				}
+				return nil, err
+			}
+			if err := txn.Commit(); err != nil {
+				log.Error("spanner.load.data.2pc.txn.commit.error:[%v]", err)
+				return nil, err
+			}
+		}
+	}
+
+	// The rows of every backend table are returned as the notes.
+	var notes []string
+	for shard, rows := range stat.shards {
+		log.Info("proxy.load.data[%s.%s].backend[%s].range[%s].rows[%d]", database, table, shard.backend, shard.rng, rows)
+		notes = append(notes, fmt.Sprintf("load.data.backend[%s].range[%s].rows[%d]", shard.backend, shard.rng, rows))
+	}
+	sort.Strings(notes)
+	sessions.SetNotes(session, notes)
+	qr := stat.qr
+	qr.Warnings = uint16(math.Min(float64(stat.warnings+uint64(len(notes))), math.MaxUint16))
+	if qr.InsertID > 0 {
+		txSession.setLastInsertID(qr.InsertID)
+	}
+	return qr, nil
+}
+
+// loadDataRows used to read the rows from the reader and execute them batch by batch.
+func (spanner *Spanner) loadDataRows(session *driver.Session, database string, node *sqlparser.LoadData, reader *loadDataReader,
+	columns sqlparser.Columns, numerics []bool, txn backend.Transaction, stat *loadDataStat) error {
+	var size int
+	var rows sqlparser.Values
+	for {
+		fields, err := reader.next()
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if fields != nil {
+			row, n := loadDataRow(fields, numerics, stat)
+			rows = append(rows, row)
+			size += n
+		}
+
+		if len(rows) > 0 && (size >= loadDataBatchSize || err == io.EOF) {
+			if x := spanner.loadDataBatch(session, database, node, columns, rows, txn, stat); x != nil {
+				return x
+			}
+			rows, size = nil, 0
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// loadDataRow builds the row of the fields, the missing fields are set to DEFAULT and the
+// extra fields are ignored, both with a warning as MySQL does.
+func loadDataRow(fields []loadDataField, numerics []bool, stat *loadDataStat) (sqlparser.ValTuple, int) {
+	if len(fields) != len(numerics) {
+		stat.warnings++
+	}
+
+	size := 0
+	row := make(sqlparser.ValTuple, len(numerics))
+	for i := range numerics {
+		if i >= len(fields) {
+			row[i] = &sqlparser.Default{}
+			continue
+		}
+		field := fields[i]
+		size += len(field.val)
+		switch {
+		case field.null:
+			row[i] = &sqlparser.NullVal{}
+		case numerics[i]:
+			row[i] = loadDataNumber(field.val, stat)
+		default:
+			row[i] = sqlparser.NewStrVal(field.val)
+		}
+	}
+	return row, size
+}
+
+// loadDataNumber returns the number value of the numeric column, the shard key is routed by the
+// value type, so the number must be IntVal or FloatVal.
+func loadDataNumber(val []byte, stat *loadDataStat) *sqlparser.SQLVal {
+	s := strings.TrimSpace(string(val))
+	if s == "" {
+		stat.warnings++
+		return sqlparser.NewIntVal([]byte("0"))
+	}
+	if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return sqlparser.NewIntVal([]byte(s))
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return sqlparser.NewFloatVal([]byte(s))
+	}
+	return sqlparser.NewStrVal(val)
+}
+
+// loadDataBatch used to execute the rows as an INSERT in the transaction.
+func (spanner *Spanner) loadDataBatch(session *driver.Session, database string, node *sqlparser.LoadData, columns sqlparser.Columns,
+	rows sqlparser.Values, txn backend.Transaction, stat *loadDataStat) error {
+	ins := &sqlparser.Insert{
+		Action:  sqlparser.InsertStr,
+		Table:   node.Table,
+		Columns: columns,
+		Rows:    rows,
+	}
+	switch node.DupAction {
+	case sqlparser.ReplaceStr:
+		ins.Action = sqlparser.ReplaceStr
+	case sqlparser.IgnoreStr:
+		ins.Ignore = sqlparser.IgnoreStr
+	}
+
+	// AutoIncrement plugin process.
+	autoincPlug := spanner.plugins.PlugAutoIncrement()
+	id, err := autoincPlug.Process(database, ins)
+	if err != nil {
+		return err
+	}
+	if stat.qr.InsertID == 0 {
+		stat.qr.InsertID = id
+	}
+
+	plan := planner.NewInsertPlan(spanner.log, database, "", ins, spanner.router)
+	if err := plan.Build(); err != nil {
+		return err
+	}
+	reqCtx := xcontext.NewRequestContext()
+	reqCtx.Mode = plan.ReqMode
+	reqCtx.TxnMode = xcontext.TxnWrite
+	reqCtx.Querys = plan.Querys
+	reqCtx.RawQuery = sqlparser.String(node)
+	reqCtx.Span = spanner.sessions.Trace(session)
+	qr, err := txn.Execute(reqCtx)
+	if err != nil {
+		return err
+	}
+
+	stat.qr.RowsAffected += qr.RowsAffected
+	stat.warnings += uint64(qr.Warnings)
+	for i, tuple := range plan.Querys {
+		stat.shards[loadDataShard{backend: tuple.Backend, rng: tuple.Range}] += plan.RowCounts[i]
+	}
+	return nil
+}
+
+// loadDataColumns returns the columns of the rows and whether they're numeric, the column types
+// are fetched from the first backend table.
+func (spanner *Spanner) loadDataColumns(database string, table string, columns sqlparser.Columns) (sqlparser.Columns, []bool, error) {
+	segments, err := spanner.router.Lookup(database, table, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	query := fmt.Sprintf("select column_name, data_type from information_schema.columns where table_schema = '%s' and table_name = '%s' order by ordinal_position", database, segments[0].Table)
+	qr, err := spanner.ExecuteOnThisBackend(segments[0].Backend, query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	types := make(map[string]string, len(qr.Rows))
+	var all sqlparser.Columns
+	for _, row := range qr.Rows {
+		name := row[0].String()
+		types[strings.ToLower(name)] = strings.ToLower(row[1].String())
+		all = append(all, sqlparser.NewColIdent(name))
+	}
+	if len(columns) == 0 {
+		columns = all
+	}
+	if len(columns) == 0 {
+		return nil, nil, errors.Errorf("load.data.table[%s.%s].columns.not.found", database, table)
+	}
+
+	numerics := make([]bool, len(columns))
+	for i, column := range columns {
+		switch types[column.Lowered()] {
+		case "tinyint", "smallint", "mediumint", "int", "integer", "bigint", "decimal", "numeric", "float", "double", "real":
+			numerics[i] = true
+		}
+	}
+	return columns, numerics, nil
+}
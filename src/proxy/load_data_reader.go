@@ -0,0 +1,238 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+// loadDataField is a field of the LOAD DATA file, null for \N.
+type loadDataField struct {
+	val  []byte
+	null bool
+}
+
+// loadDataReader used to parse the LOAD DATA file by the FIELDS/LINES options as MySQL does:
+// FIELDS TERMINATED BY '\t' ESCAPED BY '\\' LINES TERMINATED BY '\n' without ENCLOSED BY and STARTING BY by default.
+type loadDataReader struct {
+	r          *bufio.Reader
+	fieldTerm  []byte
+	enclosed   []byte
+	escaped    []byte
+	lineStart  []byte
+	lineTerm   []byte
+	lineNumber int
+}
+
+func newLoadDataReader(r io.Reader, node *sqlparser.LoadData) (*loadDataReader, error) {
+	lr := &loadDataReader{
+		r:         bufio.NewReaderSize(r, 1<<16),
+		fieldTerm: []byte("\t"),
+		escaped:   []byte("\\"),
+		lineTerm:  []byte("\n"),
+	}
+	if node.FieldsTerminatedBy != nil {
+		lr.fieldTerm = node.FieldsTerminatedBy.Val
+	}
+	if node.FieldsEnclosedBy != nil {
+		lr.enclosed = node.FieldsEnclosedBy.Val
+	}
+	if node.FieldsEscapedBy != nil {
+		lr.escaped = node.FieldsEscapedBy.Val
+	}
+	if node.LinesStartingBy != nil {
+		lr.lineStart = node.LinesStartingBy.Val
+	}
+	if node.LinesTerminatedBy != nil {
+		lr.lineTerm = node.LinesTerminatedBy.Val
+	}
+
+	if len(lr.enclosed) > 1 || len(lr.escaped) > 1 {
+		return nil, errors.New("unsupported: load.data.enclosed.and.escaped.must.be.single.character")
+	}
+	if len(lr.fieldTerm) == 0 || len(lr.lineTerm) == 0 {
+		return nil, errors.New("unsupported: load.data.fixed-row.format")
+	}
+	return lr, nil
+}
+
+// skipLines used to skip the first n lines of IGNORE n LINES.
+func (lr *loadDataReader) skipLines(n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := lr.next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// next returns the fields of the next line, io.EOF if there is no more line.
+func (lr *loadDataReader) next() ([]loadDataField, error) {
+	if len(lr.lineStart) > 0 {
+		if err := lr.skipTo(lr.lineStart); err != nil {
+			return nil, err
+		}
+	} else if _, err := lr.r.Peek(1); err != nil {
+		return nil, err
+	}
+	lr.lineNumber++
+
+	var fields []loadDataField
+	for {
+		field, lineEnd, err := lr.nextField()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+		if lineEnd {
+			return fields, nil
+		}
+	}
+}
+
+// nextField returns the next field and whether it's the last field of the line.
+func (lr *loadDataReader) nextField() (loadDataField, bool, error) {
+	var buf []byte
+
+	isEnclosed := false
+	if len(lr.enclosed) > 0 && lr.match(lr.enclosed) {
+		isEnclosed = true
+		lr.r.Discard(1)
+	}
+
+	// nullMark is true if the field starts with the \N.
+	nullMark := false
+	for {
+		if !isEnclosed {
+			if lr.consume(lr.fieldTerm) {
+				return lr.field(buf, nullMark, false), false, nil
+			}
+			if lr.consume(lr.lineTerm) {
+				return lr.field(buf, nullMark, false), true, nil
+			}
+		}
+
+		b, err := lr.r.ReadByte()
+		if err == io.EOF {
+			if isEnclosed {
+				// The enclosed field is not closed, the enclosing character is a part of the field.
+				buf = append(append([]byte{}, lr.enclosed...), buf...)
+			}
+			return lr.field(buf, nullMark, false), true, nil
+		}
+		if err != nil {
+			return loadDataField{}, false, err
+		}
+
+		switch {
+		case len(lr.escaped) > 0 && b == lr.escaped[0]:
+			c, err := lr.r.ReadByte()
+			if err == io.EOF {
+				buf = append(buf, b)
+				continue
+			}
+			if err != nil {
+				return loadDataField{}, false, err
+			}
+			if c == 'N' && len(buf) == 0 && !nullMark {
+				nullMark = true
+				continue
+			}
+			buf = append(buf, unescape(c))
+		case isEnclosed && b == lr.enclosed[0]:
+			// The doubled enclosing character is the character itself.
+			if lr.match(lr.enclosed) {
+				lr.r.Discard(1)
+				buf = append(buf, b)
+				continue
+			}
+			if lr.consume(lr.fieldTerm) {
+				return lr.field(buf, nullMark, true), false, nil
+			}
+			if lr.consume(lr.lineTerm) {
+				return lr.field(buf, nullMark, true), true, nil
+			}
+			if _, err := lr.r.Peek(1); err == io.EOF {
+				return lr.field(buf, nullMark, true), true, nil
+			}
+			buf = append(buf, b)
+		default:
+			buf = append(buf, b)
+		}
+	}
+}
+
+// field returns the field of the value. The \N is NULL, and the unenclosed word NULL is NULL
+// if the ESCAPED BY is empty or the ENCLOSED BY is not empty.
+func (lr *loadDataReader) field(buf []byte, nullMark bool, isEnclosed bool) loadDataField {
+	if nullMark {
+		if len(buf) == 0 {
+			return loadDataField{null: true}
+		}
+		// The \N is followed by other characters, it's the N.
+		buf = append([]byte{'N'}, buf...)
+	}
+	if !isEnclosed && (len(lr.escaped) == 0 || len(lr.enclosed) > 0) && string(buf) == "NULL" {
+		return loadDataField{null: true}
+	}
+	if buf == nil {
+		buf = []byte{}
+	}
+	return loadDataField{val: buf}
+}
+
+// skipTo used to skip the content to the end of the prefix.
+func (lr *loadDataReader) skipTo(prefix []byte) error {
+	for {
+		if lr.consume(prefix) {
+			return nil
+		}
+		if _, err := lr.r.ReadByte(); err != nil {
+			return err
+		}
+	}
+}
+
+// match returns true if the next bytes are the sep.
+func (lr *loadDataReader) match(sep []byte) bool {
+	next, _ := lr.r.Peek(len(sep))
+	return len(next) == len(sep) && bytes.Equal(next, sep)
+}
+
+// consume used to discard the sep if the next bytes are the sep.
+func (lr *loadDataReader) consume(sep []byte) bool {
+	if lr.match(sep) {
+		lr.r.Discard(len(sep))
+		return true
+	}
+	return false
+}
+
+func unescape(c byte) byte {
+	switch c {
+	case '0':
+		return 0
+	case 'b':
+		return '\b'
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'Z':
+		return 26
+	}
+	return c
+}
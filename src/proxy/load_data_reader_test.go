@@ -0,0 +1,124 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+func readLoadData(t *testing.T, sql string, content string) []string {
+	node, err := sqlparser.Parse(sql)
+	assert.Nil(t, err)
+	reader, err := newLoadDataReader(strings.NewReader(content), node.(*sqlparser.LoadData))
+	assert.Nil(t, err)
+
+	var lines []string
+	for {
+		fields, err := reader.next()
+		if err == io.EOF {
+			return lines
+		}
+		assert.Nil(t, err)
+		strs := make([]string, len(fields))
+		for i, field := range fields {
+			if field.null {
+				strs[i] = "<null>"
+			} else {
+				strs[i] = string(field.val)
+			}
+		}
+		lines = append(lines, strings.Join(strs, "|"))
+	}
+}
+
+func TestLoadDataReader(t *testing.T) {
+	tcases := []struct {
+		sql     string
+		content string
+		want    []string
+	}{
+		{
+			sql:     "load data local infile 'a' into table t1",
+			content: "1\ta\n2\tb\\tc\n3\t\\N\n4\t\n",
+			want:    []string{"1|a", "2|b\tc", "3|<null>", "4|"},
+		},
+		{
+			// The last line without the terminator.
+			sql:     "load data local infile 'a' into table t1",
+			content: "1\ta\n2\t\\Nb",
+			want:    []string{"1|a", "2|Nb"},
+		},
+		{
+			sql:     "load data local infile 'a' into table t1 fields terminated by ',' enclosed by '\"' lines terminated by '\\r\\n'",
+			content: "1,\"a,b\"\r\n2,\"c\"\"d\"\r\n3,\"NULL\",NULL\r\n\"4\",\"e\r\nf\"\r\n",
+			want:    []string{"1|a,b", "2|c\"d", "3|NULL|<null>", "4|e\r\nf"},
+		},
+		{
+			sql:     "load data local infile 'a' into table t1 fields terminated by ',' escaped by '' lines starting by 'xx'",
+			content: "xx1,\\N\nyyxx2,NULL\nzz\n",
+			want:    []string{"1|\\N", "2|<null>"},
+		},
+		{
+			sql:     "load data local infile 'a' into table t1 fields terminated by '||' lines terminated by '##'",
+			content: "1||a\\##b##2||##",
+			want:    []string{"1|a##b", "2|"},
+		},
+	}
+
+	for _, tcase := range tcases {
+		got := readLoadData(t, tcase.sql, tcase.content)
+		assert.Equal(t, tcase.want, got, tcase.sql)
+	}
+}
+
+func TestLoadDataReaderSkipLines(t *testing.T) {
+	node, err := sqlparser.Parse("load data local infile 'a' into table t1 ignore 1 lines")
+	assert.Nil(t, err)
+	reader, err := newLoadDataReader(strings.NewReader("id\tname\n1\ta\n"), node.(*sqlparser.LoadData))
+	assert.Nil(t, err)
+
+	err = reader.skipLines(1)
+	assert.Nil(t, err)
+	fields, err := reader.next()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(fields))
+	assert.Equal(t, "1", string(fields[0].val))
+	_, err = reader.next()
+	assert.Equal(t, io.EOF, err)
+	err = reader.skipLines(1)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestLoadDataReaderError(t *testing.T) {
+	tcases := []struct {
+		sql  string
+		want string
+	}{
+		{
+			sql:  "load data local infile 'a' into table t1 fields terminated by '' enclosed by ''",
+			want: "unsupported: load.data.fixed-row.format",
+		},
+		{
+			sql:  "load data local infile 'a' into table t1 fields enclosed by 'ab'",
+			want: "unsupported: load.data.enclosed.and.escaped.must.be.single.character",
+		},
+	}
+
+	for _, tcase := range tcases {
+		node, err := sqlparser.Parse(tcase.sql)
+		assert.Nil(t, err)
+		_, err = newLoadDataReader(strings.NewReader(""), node.(*sqlparser.LoadData))
+		assert.Equal(t, tcase.want, err.Error())
+	}
+}
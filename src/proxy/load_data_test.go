@@ -0,0 +1,337 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+var (
+	loadDataColumnsResult = &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{
+				Name: "column_name",
+				Type: querypb.Type_VARCHAR,
+			},
+			{
+				Name: "data_type",
+				Type: querypb.Type_VARCHAR,
+			},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("id")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("int")),
+			},
+			{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("b")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("varchar")),
+			},
+		},
+	}
+)
+
+func loadDataFile(content string) driver.LocalInfileHandler {
+	return func(filename string) (io.Reader, error) {
+		return strings.NewReader(content), nil
+	}
+}
+
+func TestProxyLoadData(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select column_name, data_type from information_schema.columns .*", loadDataColumnsResult)
+		fakedbs.AddQueryPattern("insert .*", &sqltypes.Result{RowsAffected: 1})
+	}
+
+	client, err := driver.NewLocalInfileConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+
+	// create database and tables.
+	{
+		querys := []string{
+			"create database test",
+			"create table test.t1(id int, b varchar(10)) partition by hash(id)",
+			"create table test.t2(id int, b varchar(10)) single",
+		}
+		for _, query := range querys {
+			_, err = client.FetchAll(query, -1)
+			assert.Nil(t, err)
+		}
+	}
+
+	// load data to the single table.
+	{
+		query := "insert into test.t2(id, b) values (1, 'a'), (2, null), (3, default), (4, 'd')"
+		fakedbs.AddQuery(query, &sqltypes.Result{RowsAffected: 4})
+		client.SetLocalInfileHandler(loadDataFile("1\ta\n2\t\\N\n3\n4\td\textra\n"))
+		qr, err := client.FetchAll("load data local infile 'a.txt' into table test.t2", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(4), qr.RowsAffected)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(query))
+
+		// The rows of the backend table are the notes.
+		qr, err = client.FetchAll("show warnings", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(qr.Rows))
+		assert.Equal(t, "Note", qr.Rows[0][0].String())
+		assert.True(t, strings.HasSuffix(qr.Rows[0][2].String(), ".rows[4]"), qr.Rows[0][2].String())
+	}
+
+	// load data with options and columns.
+	{
+		query := "replace into test.t2(b, id) values ('x,y', 5)"
+		fakedbs.AddQuery(query, &sqltypes.Result{RowsAffected: 1})
+		client.SetLocalInfileHandler(loadDataFile("b,id\n\"x,y\",5\n"))
+		qr, err := client.FetchAll("load data local infile 'a.csv' replace into table test.t2 fields terminated by ',' optionally enclosed by '\"' ignore 1 lines (b, id)", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(1), qr.RowsAffected)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(query))
+	}
+
+	// load data to the partitioned table in batches.
+	{
+		defer func(size int) { loadDataBatchSize = size }(loadDataBatchSize)
+		loadDataBatchSize = 8
+
+		var lines []string
+		for i := 0; i < 100; i++ {
+			lines = append(lines, "1234567890\tabcdefghij")
+		}
+		client.SetLocalInfileHandler(loadDataFile(strings.Join(lines, "\n")))
+		_, err := client.FetchAll("load data local infile 'a.txt' ignore into table t1", -1)
+		assert.NotNil(t, err)
+
+		_, err = client.FetchAll("use test", -1)
+		assert.Nil(t, err)
+		qr, err := client.FetchAll("load data local infile 'a.txt' ignore into table t1 character set utf8mb4", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(100), qr.RowsAffected)
+
+		qr, err = client.FetchAll("show warnings", -1)
+		assert.Nil(t, err)
+		assert.True(t, len(qr.Rows) > 0)
+		for _, row := range qr.Rows {
+			assert.True(t, strings.HasPrefix(row[2].String(), "load.data.backend["), row[2].String())
+		}
+	}
+
+	// empty file.
+	{
+		client.SetLocalInfileHandler(loadDataFile(""))
+		qr, err := client.FetchAll("load data local infile 'a.txt' into table test.t1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(0), qr.RowsAffected)
+	}
+}
+
+func TestLoadDataRow(t *testing.T) {
+	stat := &loadDataStat{}
+	numerics := []bool{true, false, true}
+	tcases := []struct {
+		fields   []loadDataField
+		want     string
+		warnings uint64
+	}{
+		{
+			fields:   []loadDataField{{val: []byte("1")}, {val: []byte("a")}, {val: []byte("1.5")}},
+			want:     "(1, 'a', 1.5)",
+			warnings: 0,
+		},
+		{
+			fields:   []loadDataField{{val: []byte("x")}, {null: true}, {val: []byte("")}},
+			want:     "('x', null, 0)",
+			warnings: 1,
+		},
+		{
+			fields:   []loadDataField{{val: []byte("2")}},
+			want:     "(2, default, default)",
+			warnings: 2,
+		},
+		{
+			fields:   []loadDataField{{val: []byte("3")}, {val: []byte("b")}, {val: []byte("4")}, {val: []byte("c")}},
+			want:     "(3, 'b', 4)",
+			warnings: 3,
+		},
+	}
+	for _, tcase := range tcases {
+		row, _ := loadDataRow(tcase.fields, numerics, stat)
+		assert.Equal(t, tcase.want, sqlparser.String(row))
+		assert.Equal(t, tcase.warnings, stat.warnings)
+	}
+}
+
+func TestProxyLoadDataTwoPC(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	proxy.SetTwoPC(true)
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("XA .*", result1)
+		fakedbs.AddQueryPattern("select @@autocommit", autocommitResult1)
+		fakedbs.AddQueryPattern("select column_name, data_type from information_schema.columns .*", loadDataColumnsResult)
+		fakedbs.AddQueryPattern("insert .*", &sqltypes.Result{RowsAffected: 1})
+	}
+
+	client, err := driver.NewLocalInfileConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b varchar(10)) partition by hash(id)",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	// single statement transaction.
+	{
+		client.SetLocalInfileHandler(loadDataFile("1\ta\n2\tb\n"))
+		qr, err := client.FetchAll("load data local infile 'a.txt' into table test.t1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(2), qr.RowsAffected)
+	}
+
+	// multiple statements transaction.
+	{
+		client.SetLocalInfileHandler(loadDataFile("1\ta\n"))
+		querys := []string{
+			"begin",
+			"load data local infile 'a.txt' into table test.t1",
+			"commit",
+		}
+		for _, query := range querys {
+			_, err = client.FetchAll(query, -1)
+			assert.Nil(t, err)
+		}
+	}
+
+	// insert error, rollback.
+	{
+		fakedbs.ResetAll()
+		fakedbs.AddQueryPattern("XA .*", result1)
+		fakedbs.AddQueryPattern("select @@autocommit", autocommitResult1)
+		fakedbs.AddQueryPattern("select column_name, data_type from information_schema.columns .*", loadDataColumnsResult)
+		fakedbs.AddQueryErrorPattern("insert .*", errors.New("mock.insert.error"))
+		client.SetLocalInfileHandler(loadDataFile("1\ta\n2\tb\n"))
+		_, err := client.FetchAll("load data local infile 'a.txt' into table test.t1", -1)
+		assert.NotNil(t, err)
+
+		// The connection is still usable.
+		err = client.Ping()
+		assert.Nil(t, err)
+	}
+}
+
+func TestProxyLoadDataError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select column_name, data_type from information_schema.columns .*", loadDataColumnsResult)
+		fakedbs.AddQueryPattern("insert .*", &sqltypes.Result{RowsAffected: 1})
+	}
+
+	client, err := driver.NewLocalInfileConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b varchar(10)) partition by hash(id)",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	tcases := []struct {
+		query string
+		err   string
+	}{
+		{
+			query: "load data infile 'a.txt' into table test.t1",
+			err:   "unsupported: load.data.infile.without.local (errno 1105) (sqlstate HY000)",
+		},
+		{
+			query: "load data local infile 'a.txt' into table test.t2",
+			err:   "Table 't2' doesn't exist (errno 1146) (sqlstate 42S02)",
+		},
+		{
+			query: "load data local infile 'a.txt' into table test.t1 fields terminated by '' lines terminated by '\\n'",
+			err:   "unsupported: load.data.fixed-row.format (errno 1105) (sqlstate HY000)",
+		},
+		{
+			query: "load data local infile 'a.txt' into table test.t1 character set latin1",
+			err:   "unsupported: load.data.character.set[latin1] (errno 1105) (sqlstate HY000)",
+		},
+		{
+			query: "load data local infile 'a.txt' into table test.t1 (b)",
+			err:   "unsupported: shardkey.column[id].missing (errno 1105) (sqlstate HY000)",
+		},
+	}
+	client.SetLocalInfileHandler(loadDataFile("1\ta\n"))
+	for _, tcase := range tcases {
+		_, err := client.FetchAll(tcase.query, -1)
+		assert.NotNil(t, err, tcase.query)
+		if err != nil {
+			assert.Equal(t, tcase.err, err.Error(), tcase.query)
+		}
+	}
+
+	// The client refuses to send the file.
+	{
+		client.SetLocalInfileHandler(nil)
+		_, err := client.FetchAll("load data local infile 'a.txt' into table test.t1", -1)
+		assert.NotNil(t, err)
+	}
+
+	// The file can not be opened.
+	{
+		client.SetLocalInfileHandler(func(filename string) (io.Reader, error) {
+			return nil, errors.New("mock.open.error")
+		})
+		_, err := client.FetchAll("load data local infile 'a.txt' into table test.t1", -1)
+		assert.NotNil(t, err)
+	}
+
+	// The connection is still usable.
+	{
+		err := client.Ping()
+		assert.Nil(t, err)
+	}
+}
@@ -17,6 +17,7 @@ import (
 
 	"config"
 	"fakedb"
+	"plugins/autoincrement"
 	"plugins/privilege"
 
 	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
@@ -141,6 +142,9 @@ func MockProxy1(log *xlog.Log, conf *config.Config) (*fakedb.DB, *Proxy, func())
 	// the user with super privilege.
 	privilege.MockInitPrivilegeY(fakedbs)
 
+	// the sequence storage.
+	autoincrement.MockInitAutoIncrement(fakedbs)
+
 	// Proxy.
 	mockJSON := tmpDir + "/radon_mock.json"
 	proxy := NewProxy(log, mockJSON, "", conf)
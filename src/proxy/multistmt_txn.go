@@ -92,6 +92,7 @@ func (spanner *Spanner) ExecuteBegin(session *driver.Session, query string, node
 	txn.SetTimeout(conf.Proxy.QueryTimeout)
 	txn.SetMaxResult(conf.Proxy.MaxResultSize)
 	txn.SetMaxJoinRows(conf.Proxy.MaxJoinRows)
+	txn.SetGroupConcatMaxLen(conf.Proxy.GroupConcatMaxLen)
 	txn.SetMultiStmtTxn()
 	txn.SetIsExecOnRep(false)
 
@@ -14,6 +14,7 @@ import (
 	"audit"
 	"backend"
 	"config"
+	"metastore"
 	"plugins"
 	"router"
 	"syncer"
@@ -30,6 +31,7 @@ type Proxy struct {
 	conf          *config.Config
 	confPath      string
 	audit         *audit.Audit
+	store         metastore.Store
 	router        *router.Router
 	scatter       *backend.Scatter
 	syncer        *syncer.Syncer
@@ -45,15 +47,22 @@ type Proxy struct {
 // NewProxy creates new proxy.
 func NewProxy(log *xlog.Log, path string, serverVersion string, conf *config.Config) *Proxy {
 	audit := audit.NewAudit(log, conf.Audit)
-	router := router.NewRouter(log, conf.Proxy.MetaDir, conf.Router)
-	scatter := backend.NewScatter(log, conf.Proxy.MetaDir)
-	syncer := syncer.NewSyncer(log, conf.Proxy.MetaDir, conf.Proxy.PeerAddress, router, scatter)
+	store, err := metastore.New(log, conf.Proxy.MetaDir, conf.MetaStore)
+	if err != nil {
+		log.Panic("proxy.metastore.new.panic:%+v", err)
+	}
+	// The router and scatter write the metadata through the raft log of the syncer.
+	replicated := syncer.NewReplicatedStore(store)
+	router := router.NewRouterWithStore(log, replicated, conf.Router)
+	scatter := backend.NewScatterWithStore(log, replicated)
+	syncer := syncer.NewSyncer(log, conf.Proxy.MetaDir, replicated, conf.Proxy.PeerAddress, router, scatter)
 	plugins := plugins.NewPlugin(log, conf, router, scatter)
 	return &Proxy{
 		log:           log,
 		conf:          conf,
 		confPath:      path,
 		audit:         audit,
+		store:         store,
 		router:        router,
 		scatter:       scatter,
 		syncer:        syncer,
@@ -86,6 +95,11 @@ func (p *Proxy) Start() {
 	if err := audit.Init(); err != nil {
 		log.Panic("proxy.audit.init.panic:%+v", err)
 	}
+	client, err := NewHTTPClient(conf.Admin)
+	if err != nil {
+		log.Panic("proxy.http.client.panic:%+v", err)
+	}
+	syncer.SetHTTPClient(client)
 	if err := syncer.Init(); err != nil {
 		log.Panic("proxy.syncer.init.panic:%+v", err)
 	}
@@ -96,6 +110,8 @@ func (p *Proxy) Start() {
 		log.Panic("proxy.scatter.load.config.panic:%+v", err)
 	}
 
+	// The failover runs on the leading peer only.
+	scatter.SetLeading(syncer.Leading)
 	if err := scatter.Init(p.conf.Scatter); err != nil {
 		log.Panic("proxy.scatter.init.panic:%+v", err)
 	}
@@ -105,6 +121,7 @@ func (p *Proxy) Start() {
 	}
 
 	spanner := NewSpanner(log, conf, iptable, router, scatter, sessions, audit, throttle, plugins, serverVersion)
+	spanner.syncer = syncer
 	if err := spanner.Init(); err != nil {
 		log.Panic("proxy.spanner.init.panic:%+v", err)
 	}
@@ -130,6 +147,7 @@ func (p *Proxy) Stop() {
 	p.audit.Close()
 	p.syncer.Close()
 	p.plugins.Close()
+	p.store.Close()
 	log.Info("proxy.shutdown.complete...")
 }
 
@@ -148,6 +166,11 @@ func (p *Proxy) IPTable() *IPTable {
 	return p.iptable
 }
 
+// Audit returns the audit.
+func (p *Proxy) Audit() *audit.Audit {
+	return p.audit
+}
+
 // Scatter returns the scatter.
 func (p *Proxy) Scatter() *backend.Scatter {
 	return p.scatter
@@ -178,6 +201,11 @@ func (p *Proxy) Spanner() *Spanner {
 	return p.spanner
 }
 
+// MetaHistory returns the handler of the meta history.
+func (p *Proxy) MetaHistory() *MetaHistory {
+	return NewMetaHistory(p.log, p.scatter, p.router, p.spanner)
+}
+
 // SetMaxConnections used to set the max connections.
 func (p *Proxy) SetMaxConnections(connections int) {
 	p.mu.Lock()
@@ -202,6 +230,14 @@ func (p *Proxy) SetMaxJoinRows(size int) {
 	p.conf.Proxy.MaxJoinRows = size
 }
 
+// SetGroupConcatMaxLen used to set the max length of the cross-shard group_concat result.
+func (p *Proxy) SetGroupConcatMaxLen(max int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.log.Info("proxy.SetGroupConcatMaxLen:[%d->%d]", p.conf.Proxy.GroupConcatMaxLen, max)
+	p.conf.Proxy.GroupConcatMaxLen = max
+}
+
 // SetDDLTimeout used to set the ddl timeout.
 func (p *Proxy) SetDDLTimeout(timeout int) {
 	p.mu.Lock()
@@ -266,6 +302,16 @@ func (p *Proxy) SetReadOnly(val bool) {
 	p.spanner.SetReadOnly(val)
 }
 
+// ReshardReadOnly used to handle the readonly request from the shift of the reshard job.
+func (p *Proxy) ReshardReadOnly(id uint64, readonly bool) error {
+	return p.spanner.ddlJobs.ReshardReadOnly(id, readonly, p.spanner.reshardFence)
+}
+
+// ReshardThrottle used to handle the throttle request from the shift of the reshard job.
+func (p *Proxy) ReshardThrottle(id uint64, limits int) error {
+	return p.spanner.ddlJobs.ReshardThrottle(id, limits)
+}
+
 // SetLoadBalance used to set loadbalance.
 func (p *Proxy) SetLoadBalance(val int) {
 	p.mu.Lock()
@@ -274,6 +320,14 @@ func (p *Proxy) SetLoadBalance(val int) {
 	p.conf.Proxy.LoadBalance = val
 }
 
+// SetMaxReplicaLag used to set the max replica lag seconds.
+func (p *Proxy) SetMaxReplicaLag(val int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.log.Info("proxy.SetMaxReplicaLag:[%v->%v]", p.conf.Proxy.MaxReplicaLag, val)
+	p.conf.Proxy.MaxReplicaLag = val
+}
+
 // PeerAddress returns the peer address.
 func (p *Proxy) PeerAddress() string {
 	return p.conf.Proxy.PeerAddress
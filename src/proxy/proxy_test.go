@@ -45,6 +45,12 @@ func TestProxy1(t *testing.T) {
 		assert.Equal(t, 6666, proxy.conf.Proxy.MaxJoinRows)
 	}
 
+	// SetGroupConcatMaxLen
+	{
+		proxy.SetGroupConcatMaxLen(2048)
+		assert.Equal(t, 2048, proxy.conf.Proxy.GroupConcatMaxLen)
+	}
+
 	// SetDDLTimeout
 	{
 		proxy.SetDDLTimeout(6666)
@@ -105,6 +111,14 @@ func TestProxy1(t *testing.T) {
 		assert.Equal(t, 0, proxy.conf.Proxy.LoadBalance)
 	}
 
+	// SetMaxReplicaLag
+	{
+		proxy.SetMaxReplicaLag(10)
+		assert.Equal(t, 10, proxy.conf.Proxy.MaxReplicaLag)
+		proxy.SetMaxReplicaLag(0)
+		assert.Equal(t, 0, proxy.conf.Proxy.MaxReplicaLag)
+	}
+
 	// FlushConfig.
 	{
 		err := proxy.FlushConfig()
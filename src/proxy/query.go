@@ -107,8 +107,36 @@ func (spanner *Spanner) ComQuery(session *driver.Session, query string, bindVari
 		}
 	}
 
+	// Replace the sequence functions by the values.
+	changed, err := spanner.rewriteSequence(session, node)
+	if err != nil {
+		log.Error("query[%v].rewrite.sequence.error: %v", query, err)
+		return err
+	}
+	if changed {
+		query = sqlparser.String(node)
+	}
+
+	// The notes are kept for the next SHOW WARNINGS only.
+	if show, ok := node.(*sqlparser.Show); !ok || show.Type != sqlparser.ShowWarningsStr {
+		spanner.sessions.SetNotes(session, nil)
+	}
+
+	// Reshard write fence check.
+	if spanner.IsDMLWrite(node) {
+		if err := spanner.checkFence(session.Schema(), node); err != nil {
+			return err
+		}
+	}
+
+	digest, digestText := spanner.digests.Digest(node)
+	database := session.Schema()
+	span := spanner.traceStart(session, query)
 	defer func() {
+		spanner.slowLogRecord(session, database, query, span, timeStart, qr, err)
+		spanner.traceFinish(session, span, err)
 		queryStat(node, timeStart, slowQueryTime, err)
+		spanner.digests.Record(digest, digestText, time.Since(timeStart), qr, err, spanner.sessions.TakeShards(session))
 	}()
 	// The status of the execution result, zero for success and non-zero for failure.
 	status := uint16(0)
@@ -124,6 +152,8 @@ func (spanner *Spanner) ComQuery(session *driver.Session, query string, bindVari
 		if qr, err = spanner.handleDDL(session, query, node); err != nil {
 			log.Error("proxy.DDL[%s].from.session[%v].error:%+v", query, session.ID(), err)
 			status = 1
+		} else {
+			spanner.recordHistory(session.User(), query)
 		}
 		spanner.auditLog(session, W, xbase.DDL, query, qr, status)
 		return returnQuery(qr, callback, err)
@@ -162,6 +192,11 @@ func (spanner *Spanner) ComQuery(session *driver.Session, query string, bindVari
 				log.Error("proxy.show.create.table[%s].from.session[%v].error:%+v", query, session.ID(), err)
 				status = 1
 			}
+		case sqlparser.ShowCreateViewStr:
+			if qr, err = spanner.handleShowCreateView(session, query, node); err != nil {
+				log.Error("proxy.show.create.view[%s].from.session[%v].error:%+v", query, session.ID(), err)
+				status = 1
+			}
 		case sqlparser.ShowColumnsStr:
 			if qr, err = spanner.handleShowColumns(session, query, node); err != nil {
 				log.Error("proxy.show.colomns[%s].from.session[%v].error:%+v", query, session.ID(), err)
@@ -177,6 +212,16 @@ func (spanner *Spanner) ComQuery(session *driver.Session, query string, bindVari
 				log.Error("proxy.show.queryz[%s].from.session[%v].error:%+v", query, session.ID(), err)
 				status = 1
 			}
+		case sqlparser.ShowQueryDigestStr:
+			if qr, err = spanner.handleShowQueryDigest(session, query, node); err != nil {
+				log.Error("proxy.show.query.digest[%s].from.session[%v].error:%+v", query, session.ID(), err)
+				status = 1
+			}
+		case sqlparser.ShowAuditStatusStr:
+			if qr, err = spanner.handleShowAuditStatus(session, query, node); err != nil {
+				log.Error("proxy.show.audit.status[%s].from.session[%v].error:%+v", query, session.ID(), err)
+				status = 1
+			}
 		case sqlparser.ShowTxnzStr:
 			if qr, err = spanner.handleShowTxnz(session, query, node); err != nil {
 				log.Error("proxy.show.txnz[%s].from.session[%v].error:%+v", query, session.ID(), err)
@@ -194,7 +239,22 @@ func (spanner *Spanner) ComQuery(session *driver.Session, query string, bindVari
 				log.Error("proxy.show.table.status[%s].from.session[%v].error:%+v", query, session.ID(), err)
 				status = 1
 			}
-		case sqlparser.ShowWarningsStr, sqlparser.ShowVariablesStr:
+		case sqlparser.ShowDDLJobsStr:
+			if qr, err = spanner.handleShowDDLJobs(session, query, node); err != nil {
+				log.Error("proxy.show.ddl.jobs[%s].from.session[%v].error:%+v", query, session.ID(), err)
+				status = 1
+			}
+		case sqlparser.ShowDDLJobStr:
+			if qr, err = spanner.handleShowDDLJob(session, query, node); err != nil {
+				log.Error("proxy.show.ddl.job[%s].from.session[%v].error:%+v", query, session.ID(), err)
+				status = 1
+			}
+		case sqlparser.ShowWarningsStr:
+			if qr, err = spanner.handleShowWarnings(session, query, node); err != nil {
+				log.Error("proxy.show.warnings[%s].from.session[%v].error:%+v", query, session.ID(), err)
+				status = 1
+			}
+		case sqlparser.ShowVariablesStr:
 			// Support for JDBC.
 			if qr, err = spanner.handleJDBCShows(session, query, node); err != nil {
 				log.Error("proxy.JDBC.shows[%s].from.session[%v].error:%+v", query, session.ID(), err)
@@ -219,6 +279,13 @@ func (spanner *Spanner) ComQuery(session *driver.Session, query string, bindVari
 			spanner.auditLog(session, W, xbase.REPLACE, query, qr, status)
 		}
 		return returnQuery(qr, callback, err)
+	case *sqlparser.LoadData:
+		if qr, err = spanner.handleLoadData(session, query, node); err != nil {
+			log.Error("proxy.load.data[%s].from.session[%v].error:%+v", query, session.ID(), err)
+			status = 1
+		}
+		spanner.auditLog(session, W, xbase.LOADDATA, query, qr, status)
+		return returnQuery(qr, callback, err)
 	case *sqlparser.Delete:
 		if qr, err = spanner.handleDelete(session, query, node); err != nil {
 			log.Error("proxy.delete[%s].from.session[%v].error:%+v", query, session.ID(), err)
@@ -310,6 +377,22 @@ func (spanner *Spanner) ComQuery(session *driver.Session, query string, bindVari
 		}
 		spanner.auditLog(session, R, xbase.KILL, query, qr, status)
 		return returnQuery(qr, callback, err)
+	case *sqlparser.DDLJob:
+		if qr, err = spanner.handleDDLJob(session, query, node); err != nil {
+			log.Error("proxy.ddl.job[%s].from.session[%v].error:%+v", query, session.ID(), err)
+			status = 1
+		} else {
+			spanner.recordHistory(session.User(), query)
+		}
+		spanner.auditLog(session, W, xbase.DDL, query, qr, status)
+		return returnQuery(qr, callback, err)
+	case *sqlparser.Sequence:
+		if qr, err = spanner.handleSequence(session, query, node); err != nil {
+			log.Error("proxy.sequence[%s].from.session[%v].error:%+v", query, session.ID(), err)
+			status = 1
+		}
+		spanner.auditLog(session, W, xbase.DDL, query, qr, status)
+		return returnQuery(qr, callback, err)
 	case *sqlparser.Explain:
 		if qr, err = spanner.handleExplain(session, query, node); err != nil {
 			log.Error("proxy.explain[%s].from.session[%v].error:%+v", query, session.ID(), err)
@@ -330,6 +413,8 @@ func (spanner *Spanner) ComQuery(session *driver.Session, query string, bindVari
 		if qr, err = spanner.handleRadon(session, query, node); err != nil {
 			log.Error("proxy.admin[%s].from.session[%v].error:%+v", query, session.ID(), err)
 			status = 1
+		} else {
+			spanner.recordHistory(session.User(), query)
 		}
 		spanner.auditLog(session, R, xbase.RADON, query, qr, status)
 		return returnQuery(qr, callback, err)
@@ -370,7 +455,7 @@ func (spanner *Spanner) IsDML(node sqlparser.Statement) bool {
 // IsDMLWrite returns the DML write or not.
 func (spanner *Spanner) IsDMLWrite(node sqlparser.Statement) bool {
 	switch node.(type) {
-	case *sqlparser.Insert, *sqlparser.Delete, *sqlparser.Update:
+	case *sqlparser.Insert, *sqlparser.Delete, *sqlparser.Update, *sqlparser.LoadData:
 		return true
 	}
 	return false
@@ -379,7 +464,7 @@ func (spanner *Spanner) IsDMLWrite(node sqlparser.Statement) bool {
 // IsDDL returns the DDL query or not.
 func (spanner *Spanner) IsDDL(node sqlparser.Statement) bool {
 	switch node.(type) {
-	case *sqlparser.DDL:
+	case *sqlparser.DDL, *sqlparser.Sequence:
 		return true
 	}
 	return false
@@ -388,12 +473,15 @@ func (spanner *Spanner) IsDDL(node sqlparser.Statement) bool {
 // IsAdminCmd returns the Admin query or not.
 // Some of admin commands are prohibited when radon is read-only.
 func (spanner *Spanner) IsAdminCmd(node sqlparser.Statement) bool {
-	if node, ok := node.(*sqlparser.Radon); ok {
+	switch node := node.(type) {
+	case *sqlparser.Radon:
 		switch node.Action {
 		case sqlparser.AttachStr, sqlparser.DetachStr, sqlparser.ReshardStr, sqlparser.CleanupStr,
-			sqlparser.XACommitStr, sqlparser.XARollbackStr, sqlparser.RebalanceStr:
+			sqlparser.XACommitStr, sqlparser.XARollbackStr, sqlparser.RebalanceStr, sqlparser.ResyncTableStr:
 			return true
 		}
+	case *sqlparser.DDLJob:
+		return true
 	}
 	return false
 }
@@ -403,12 +491,14 @@ func queryStat(node sqlparser.Statement, timeStart time.Time, slowQueryTime time
 	switch node.(type) {
 	case *sqlparser.Use:
 		command = "Use"
-	case *sqlparser.DDL:
+	case *sqlparser.DDL, *sqlparser.DDLJob, *sqlparser.Sequence:
 		command = "DDL"
 	case *sqlparser.Show:
 		command = "Show"
 	case *sqlparser.Insert:
 		command = "Insert"
+	case *sqlparser.LoadData:
+		command = "LoadData"
 	case *sqlparser.Delete:
 		command = "Delete"
 	case *sqlparser.Update:
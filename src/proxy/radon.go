@@ -9,6 +9,10 @@
 package proxy
 
 import (
+	"strconv"
+
+	"syncer"
+
 	"github.com/pkg/errors"
 	"github.com/xelabs/go-mysqlstack/driver"
 	"github.com/xelabs/go-mysqlstack/sqldb"
@@ -59,15 +63,22 @@ func (spanner *Spanner) handleRadon(session *driver.Session, query string, node
 			newDatabase = snode.NewName.Qualifier.String()
 		}
 
+		// The locks are held until the shift in background finished.
+		guard, lockErr := spanner.ClusterLock(spanner.lockOwner(session), query, database+"."+table, newDatabase+"."+newTable)
+		if lockErr != nil {
+			err = lockErr
+			break
+		}
 		reshard := NewReshard(log, spanner.scatter, spanner.router, spanner, session.User())
 		reshard.SetHandle(reshard)
+		reshard.guard = guard
 		qr, err = reshard.ReShardTable(database, table, newDatabase, newTable)
 	case sqlparser.CleanupStr:
 		cleanup := NewCleanup(log, spanner.scatter, spanner.router, spanner)
-		qr, err = cleanup.Cleanup()
+		qr, err = spanner.withClusterLock(session, query, []string{syncer.LockCluster}, cleanup.Cleanup)
 	case sqlparser.RebalanceStr:
 		rebalance := NewRebalance(log, spanner.scatter, spanner.router, spanner, spanner.conf, spanner.plugins)
-		qr, err = rebalance.Rebalance()
+		qr, err = spanner.withClusterLock(session, query, []string{syncer.LockCluster}, rebalance.Rebalance)
 	case sqlparser.XARecoverStr:
 		adminXA := NewAdminXA(log, spanner.scatter, spanner.router, spanner)
 		qr, err = adminXA.Recover()
@@ -77,6 +88,23 @@ func (spanner *Spanner) handleRadon(session *driver.Session, query string, node
 	case sqlparser.XARollbackStr:
 		adminXA := NewAdminXA(log, spanner.scatter, spanner.router, spanner)
 		qr, err = adminXA.Rollback()
+	case sqlparser.CheckTableStr, sqlparser.ResyncTableStr:
+		table := snode.Table.Name.String()
+		database := session.Schema()
+		if !snode.Table.Qualifier.IsEmpty() {
+			database = snode.Table.Qualifier.String()
+		}
+
+		checkTable := NewCheckTable(log, spanner.scatter, spanner.router, spanner)
+		if snode.Action == sqlparser.CheckTableStr {
+			qr, err = checkTable.Check(database, table)
+		} else {
+			qr, err = spanner.withClusterLock(session, query, []string{database + "." + table}, func() (*sqltypes.Result, error) {
+				return checkTable.Resync(database, table, snode.Source)
+			})
+		}
+	case sqlparser.MetaVersionsStr, sqlparser.MetaDiffStr, sqlparser.MetaRollbackStr:
+		qr, err = spanner.handleMetaHistory(session, snode)
 	default:
 		log.Error("proxy.radon.unsupported[%s]", query)
 		err = sqldb.NewSQLErrorf(sqldb.ER_UNKNOWN_ERROR, "unsupported.query: %v", query)
@@ -87,3 +115,63 @@ func (spanner *Spanner) handleRadon(session *driver.Session, query string, node
 	}
 	return qr, err
 }
+
+// handleMetaHistory used to handle the command: radon meta versions/diff/rollback.
+func (spanner *Spanner) handleMetaHistory(session *driver.Session, snode *sqlparser.Radon) (*sqltypes.Result, error) {
+	versions := make([]int64, len(snode.Versions))
+	for i, v := range snode.Versions {
+		version, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("meta.history.invalid.version[%s]", v)
+		}
+		versions[i] = version
+	}
+
+	history := NewMetaHistory(spanner.log, spanner.scatter, spanner.router, spanner)
+	switch snode.Action {
+	case sqlparser.MetaVersionsStr:
+		snapshots, err := history.Snapshots()
+		if err != nil {
+			return nil, err
+		}
+		return snapshotsResult(snapshots), nil
+	case sqlparser.MetaDiffStr:
+		changes, err := history.Diff(versions[0], versions[1])
+		if err != nil {
+			return nil, err
+		}
+		return changesResult(changes), nil
+	default:
+		guard, err := spanner.ClusterLock(spanner.lockOwner(session), snode.Action, syncer.LockCluster)
+		if err != nil {
+			return nil, err
+		}
+		defer guard.Unlock()
+		if err := guard.Err(); err != nil {
+			return nil, err
+		}
+		changes, err := history.Rollback(versions[0], session.User())
+		if err != nil {
+			return nil, err
+		}
+		return changesResult(changes), nil
+	}
+}
+
+// withClusterLock runs the fn with the cluster locks of the names held.
+func (spanner *Spanner) withClusterLock(session *driver.Session, query string, names []string, fn func() (*sqltypes.Result, error)) (*sqltypes.Result, error) {
+	guard, err := spanner.ClusterLock(spanner.lockOwner(session), query, names...)
+	if err != nil {
+		return nil, err
+	}
+	defer guard.Unlock()
+	qr, err := fn()
+	if err != nil {
+		return nil, err
+	}
+	// The changes may conflict with the others if the locks are lost.
+	if err := guard.Err(); err != nil {
+		return nil, err
+	}
+	return qr, nil
+}
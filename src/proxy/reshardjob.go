@@ -0,0 +1,524 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"config"
+	"plugins/shiftmanager"
+	"xbase"
+	"xcontext"
+
+	"github.com/pkg/errors"
+	"github.com/radondb/shift/shift"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+const (
+	// The task query prefix of the reshard job.
+	reshardShiftTask = "shift "
+	reshardSwapTask  = "swap "
+)
+
+// reshardFenceTimeout is the max time to wait for the peers to reload the fence.
+const reshardFenceTimeout = time.Second * 10
+
+// reshard tuple, the runtime state of a running reshard job.
+// Every shift copies one source partition to the tmp table through radon,
+// when it catches up it calls the readonly api with the RadonURL of the job,
+// the call is blocked until all the shifts catch up and the writes to the
+// table are fenced on all the peers, the fence is released when the router
+// is swapped or the job fails.
+// The throttle api of the shifts limits the writes to the table on this node.
+type reshard struct {
+	tmpTable string
+	shifts   []shift.ShiftHandler
+	arrived  int
+	throttle *xbase.Throttle
+	fenced   chan struct{}
+	aborted  chan struct{}
+	once     sync.Once
+}
+
+func newReshard(tmpTable string) *reshard {
+	return &reshard{
+		tmpTable: tmpTable,
+		throttle: xbase.NewThrottle(0),
+		fenced:   make(chan struct{}),
+		aborted:  make(chan struct{}),
+	}
+}
+
+// abort wakes up the shifts waiting for the fence and stops all the shifts.
+func (r *reshard) abort() {
+	r.once.Do(func() {
+		close(r.aborted)
+		for _, s := range r.shifts {
+			s.SetStopSignal()
+		}
+	})
+}
+
+// ReshardReadOnly used to handle the readonly request from the shift of the reshard job.
+// The last shift fences the writes by the fence function, the job is aborted if it fails.
+// The readonly=false request returns at once, the fence is released by the job when all the shifts finish.
+func (d *DDLJobs) ReshardReadOnly(id uint64, readonly bool, fence func(job *DDLJob) error) error {
+	if !readonly {
+		return nil
+	}
+
+	d.mu.Lock()
+	job := d.get(id)
+	if job == nil || job.reshard == nil {
+		d.mu.Unlock()
+		return errors.Errorf("ddl.job[%d].is.not.a.running.reshard", id)
+	}
+	rs := job.reshard
+	rs.arrived++
+	last := rs.arrived == len(rs.shifts)
+	d.mu.Unlock()
+
+	if last {
+		if err := fence(job); err != nil {
+			d.log.Error("ddljobs.reshard.job[%d].fence.the.writes.to[%s.%s].error:%+v", id, job.Database, job.Table, err)
+			rs.abort()
+			return err
+		}
+		close(rs.fenced)
+		d.log.Warning("ddljobs.reshard.job[%d].all.shifts.caught.up.fence.the.writes.to[%s.%s]", id, job.Database, job.Table)
+	}
+
+	select {
+	case <-rs.fenced:
+		return nil
+	case <-rs.aborted:
+		return errors.Errorf("ddl.job[%d].was.aborted", id)
+	}
+}
+
+// ReshardThrottle used to handle the throttle request from the shift of the reshard job, 0 means no limits.
+func (d *DDLJobs) ReshardThrottle(id uint64, limits int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	job := d.get(id)
+	if job == nil || job.reshard == nil {
+		return errors.Errorf("ddl.job[%d].is.not.a.running.reshard", id)
+	}
+	job.reshard.throttle.Set(limits)
+	return nil
+}
+
+// reshardThrottle returns the throttle of the reshard job running on the table, nil if there is none.
+func (d *DDLJobs) reshardThrottle(database, table string) *xbase.Throttle {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, job := range d.jobs {
+		if job.reshard != nil && job.Database == database && job.Table == table {
+			return job.reshard.throttle
+		}
+	}
+	return nil
+}
+
+// checkFence returns error if the write query touches a table which is fenced by the reshard job,
+// and waits for the throttle of the reshard job running on the table.
+func (spanner *Spanner) checkFence(database string, node sqlparser.Statement) error {
+	route := spanner.router
+
+	var throttles []*xbase.Throttle
+	if err := sqlparser.Walk(func(n sqlparser.SQLNode) (bool, error) {
+		if t, ok := n.(sqlparser.TableName); ok {
+			db := database
+			if !t.Qualifier.IsEmpty() {
+				db = t.Qualifier.String()
+			}
+			table := t.Name.String()
+			if id := route.TableFence(db, table); id != 0 {
+				return false, errors.Errorf("table[%s.%s].is.being.resharded.by.ddl.job[%d].please.retry.later", db, table, id)
+			}
+			if throttle := spanner.ddlJobs.reshardThrottle(db, table); throttle != nil {
+				throttles = append(throttles, throttle)
+			}
+		}
+		return true, nil
+	}, node); err != nil {
+		return err
+	}
+	for _, throttle := range throttles {
+		throttle.Acquire()
+	}
+	return nil
+}
+
+// reshardFence fences the writes to the table of the job in the router, it returns after all
+// the peers reload the fence so that no peer writes the table after the shifts caught up.
+func (spanner *Spanner) reshardFence(job *DDLJob) error {
+	if err := spanner.router.SetTableFence(job.Database, job.Table, job.ID); err != nil {
+		return err
+	}
+	if spanner.syncer == nil {
+		return nil
+	}
+	return spanner.syncer.WaitReloaded(reshardFenceTimeout)
+}
+
+// reshardUnfence releases the fence of the table, it may be left by the last attempt of the job.
+func (spanner *Spanner) reshardUnfence(job *DDLJob) {
+	if spanner.router.TableFence(job.Database, job.Table) == 0 {
+		return
+	}
+	if err := spanner.router.SetTableFence(job.Database, job.Table, 0); err != nil {
+		spanner.log.Error("spanner.reshard.job[%d].unfence.table[%s.%s].error:%+v", job.ID, job.Database, job.Table, err)
+	}
+}
+
+// checkIdle returns error if there is a running job on the table.
+func (d *DDLJobs) checkIdle(database, table string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, job := range d.jobs {
+		if job.Database == database && job.Table == table && job.active() {
+			return errors.Errorf("ddl.job[%d].is.running.on.table[%s.%s]", job.ID, database, table)
+		}
+	}
+	return nil
+}
+
+// isReshardTmpTable returns true if the table is the tmp table of the running reshard job.
+func (d *DDLJobs) isReshardTmpTable(database, table string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, job := range d.jobs {
+		if job.reshard != nil && job.Database == database && job.reshard.tmpTable == table {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *DDLJobs) beginTask(job *DDLJob, task *DDLTask) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	task.State = ddlJobStateRunning
+	task.Attempts++
+	task.StartTime = time.Now()
+	task.Error = ""
+	d.persist()
+}
+
+func (d *DDLJobs) endTask(job *DDLJob, task *DDLTask, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	task.EndTime = time.Now()
+	switch {
+	case err == nil:
+		task.State = ddlJobStateDone
+	case job.cancelled:
+		task.State = ddlJobStateCancelled
+		task.Error = err.Error()
+	default:
+		d.log.Error("ddljobs.job[%d].task.on[%s].query[%s].error:%+v", job.ID, task.Backend, task.Query, err)
+		task.State = ddlJobStateFailed
+		task.Error = err.Error()
+		// The first error wins, the others are caused by the abort.
+		if job.lastErr == nil {
+			job.lastErr = err
+		}
+	}
+	d.persist()
+}
+
+func (d *DDLJobs) failJob(job *DDLJob, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if job.lastErr == nil {
+		job.lastErr = err
+	}
+}
+
+func (d *DDLJobs) setReshard(job *DDLJob, rs *reshard) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	job.reshard = rs
+}
+
+// checkReshardPartitionOption checks the table can be resharded to the partition option.
+func checkReshardPartitionOption(tconf *config.TableConfig, partOpt sqlparser.PartitionOption) error {
+	switch partOpt := partOpt.(type) {
+	case *sqlparser.PartOptGlobal:
+		if tconf.ShardType == "GLOBAL" {
+			return errors.Errorf("reshard.table[%s].is.already.global", tconf.Name)
+		}
+	case *sqlparser.PartOptSingle:
+		if tconf.ShardType == "SINGLE" && partOpt.BackendName == "" {
+			return errors.Errorf("reshard.table[%s].is.already.single", tconf.Name)
+		}
+	}
+	return nil
+}
+
+// reshardTasks returns the tasks of the reshard job:
+// shift every source partition to the tmp table, the GLOBAL table only shifts the first one,
+// swap the router entry, then drop the old partitions.
+func reshardTasks(database, tmpTable string, tconf *config.TableConfig) []xcontext.QueryTuple {
+	var querys []xcontext.QueryTuple
+	for i, part := range tconf.Partitions {
+		if i > 0 && tconf.ShardType == "GLOBAL" {
+			break
+		}
+		querys = append(querys, xcontext.QueryTuple{
+			Query:   fmt.Sprintf("%s%s.%s to %s.%s", reshardShiftTask, database, part.Table, database, tmpTable),
+			Backend: part.Backend,
+			Range:   part.Segment,
+		})
+	}
+	querys = append(querys, xcontext.QueryTuple{
+		Query: fmt.Sprintf("%s%s.%s with %s.%s", reshardSwapTask, database, tconf.Name, database, tmpTable),
+	})
+	for _, part := range tconf.Partitions {
+		querys = append(querys, xcontext.QueryTuple{
+			Query:   fmt.Sprintf("drop table if exists %s.%s", database, part.Table),
+			Backend: part.Backend,
+			Range:   part.Segment,
+		})
+	}
+	return querys
+}
+
+// ExecuteReshardJob used to change the partition option of the table online as a DDLJob.
+// 1. create the tmp table `table_reshard_<job>` with the new partition option.
+// 2. shift the source partitions to the tmp table, copy and catch up.
+// 3. fence the writes to the table once all the shifts catch up, then swap the router entry.
+// 4. drop the old partitions.
+// If the job fails before the swap, the tmp table is dropped and the table is untouched,
+// the resumed job starts the shifts from scratch; after the swap, only the drops are resumed.
+func (spanner *Spanner) ExecuteReshardJob(session *driver.Session, database string, table string, query string, node *sqlparser.DDL) (*sqltypes.Result, error) {
+	log := spanner.log
+	route := spanner.router
+	ddlJobs := spanner.ddlJobs
+	log.Info("spanner.execute.reshard.job.query:%s", query)
+
+	txSession := spanner.sessions.getTxnSession(session)
+	if spanner.isTwoPC() && txSession.transaction != nil {
+		return nil, errors.Errorf("in.multiStmtTrans.unsupported.DDL:%v.", query)
+	}
+
+	tconf, err := route.TableConfig(database, table)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := ddlJobs.start(database, table, query)
+	if err != nil {
+		return nil, err
+	}
+	tmpTable := fmt.Sprintf("%s_reshard_%d", table, job.ID)
+
+	swapped := false
+	for _, task := range job.Tasks {
+		if strings.HasPrefix(task.Query, reshardSwapTask) && task.State == ddlJobStateDone {
+			swapped = true
+		}
+	}
+	if !swapped {
+		ddlJobs.setTasks(job, reshardTasks(database, tmpTable, tconf), false)
+		if err := spanner.reshardSwap(session, job, tconf, tmpTable, node.PartitionOption); err != nil {
+			ddlJobs.failJob(job, err)
+			if checkTableExists(database, tmpTable, route) {
+				if err := spanner.reshardDropTable(session, database, tmpTable); err != nil {
+					log.Error("spanner.reshard.job[%d].drop.tmp.table[%s].error:%+v", job.ID, tmpTable, err)
+				}
+			}
+			_, err = ddlJobs.finish(job)
+			return nil, err
+		}
+	}
+
+	// Drop the old partitions.
+	for _, task := range job.Tasks {
+		if strings.HasPrefix(task.Query, reshardShiftTask) || strings.HasPrefix(task.Query, reshardSwapTask) {
+			continue
+		}
+		if task.State != ddlJobStateDone {
+			ddlJobs.runTask(job, task)
+		}
+	}
+	if _, err := ddlJobs.finish(job); err != nil {
+		return nil, err
+	}
+	return &sqltypes.Result{}, nil
+}
+
+// reshardSwap creates the tmp table, runs the shifts and swaps the router entry.
+func (spanner *Spanner) reshardSwap(session *driver.Session, job *DDLJob, tconf *config.TableConfig, tmpTable string, partOpt sqlparser.PartitionOption) error {
+	log := spanner.log
+	conf := spanner.conf
+	route := spanner.router
+	ddlJobs := spanner.ddlJobs
+	database := job.Database
+
+	if err := checkReshardPartitionOption(tconf, partOpt); err != nil {
+		return err
+	}
+
+	// The tmp table may be left by the last attempt.
+	if checkTableExists(database, tmpTable, route) {
+		if err := spanner.reshardDropTable(session, database, tmpTable); err != nil {
+			return err
+		}
+	}
+	if err := spanner.reshardCreateTable(session, database, tconf, tmpTable, partOpt); err != nil {
+		return err
+	}
+
+	backends := make(map[string]*config.BackendConfig)
+	for _, bconf := range spanner.scatter.BackendConfigsClone() {
+		backends[bconf.Name] = bconf
+	}
+
+	var shiftTasks []*DDLTask
+	var swapTask *DDLTask
+	for _, task := range job.Tasks {
+		switch {
+		case strings.HasPrefix(task.Query, reshardShiftTask):
+			shiftTasks = append(shiftTasks, task)
+		case strings.HasPrefix(task.Query, reshardSwapTask):
+			swapTask = task
+		}
+	}
+
+	// The shifts share the table but not the checksum, it's done by the shift only if there is one source.
+	rs := newReshard(tmpTable)
+	for i, task := range shiftTasks {
+		bconf, ok := backends[task.Backend]
+		if !ok {
+			return errors.Errorf("reshard.backend[%s].can.not.be.found", task.Backend)
+		}
+		info := &shiftmanager.ShiftInfo{
+			From:                   bconf.Address,
+			FromUser:               bconf.User,
+			FromPassword:           bconf.Password,
+			FromDatabase:           database,
+			FromTable:              tconf.Partitions[i].Table,
+			To:                     conf.Proxy.Endpoint,
+			ToUser:                 session.User(),
+			ToPassword:             bconf.Password,
+			ToDatabase:             database,
+			ToTable:                tmpTable,
+			Cleanup:                false,
+			Checksum:               len(shiftTasks) == 1,
+			MysqlDump:              mysqlDump,
+			Threads:                threads,
+			PosBehinds:             behinds,
+			WaitTimeBeforeChecksum: waitTimeBeforeChecksum,
+			RadonURL:               fmt.Sprintf("%s/v1/ddl/jobs/%d", spanner.RadonURL(), job.ID),
+		}
+		s, err := ddlJobs.newShift(info)
+		if err != nil {
+			return err
+		}
+		rs.shifts = append(rs.shifts, s)
+	}
+	ddlJobs.setReshard(job, rs)
+	defer ddlJobs.setReshard(job, nil)
+	// The fence is gone with the old table config after the swap.
+	spanner.reshardUnfence(job)
+	defer spanner.reshardUnfence(job)
+
+	var wg sync.WaitGroup
+	for i, s := range rs.shifts {
+		task := shiftTasks[i]
+		ddlJobs.beginTask(job, task)
+		if err := s.Start(); err != nil {
+			ddlJobs.endTask(job, task, err)
+			rs.abort()
+			break
+		}
+		wg.Add(1)
+		go func(s shift.ShiftHandler, task *DDLTask) {
+			defer wg.Done()
+			err := s.WaitFinish()
+			ddlJobs.endTask(job, task, err)
+			if err != nil {
+				rs.abort()
+			}
+		}(s, task)
+	}
+	wg.Wait()
+
+	ddlJobs.mu.Lock()
+	err := job.lastErr
+	if job.cancelled {
+		err = errors.Errorf("ddl.job[%d].was.cancelled", job.ID)
+	}
+	ddlJobs.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// All the shifts are done, the writes are fenced, swap it.
+	ddlJobs.beginTask(job, swapTask)
+	err = route.SwapTable(database, job.Table, tmpTable)
+	ddlJobs.endTask(job, swapTask, err)
+	if err != nil {
+		return err
+	}
+	log.Warning("spanner.reshard.job[%d].swap.table[%s.%s].with[%s].done", job.ID, database, job.Table, tmpTable)
+	return nil
+}
+
+// reshardCreateTable creates the tmp table with the schema of the first partition and the new partition option.
+func (spanner *Spanner) reshardCreateTable(session *driver.Session, database string, tconf *config.TableConfig, tmpTable string, partOpt sqlparser.PartitionOption) error {
+	part := tconf.Partitions[0]
+	qr, err := spanner.ExecuteOnThisBackend(part.Backend, fmt.Sprintf("show create table %s.%s", database, part.Table))
+	if err != nil {
+		return err
+	}
+	if len(qr.Rows) == 0 || len(qr.Rows[0]) < 2 {
+		return errors.Errorf("reshard.show.create.table[%s.%s].result.is.empty", database, part.Table)
+	}
+	stmt, err := sqlparser.Parse(qr.Rows[0][1].String())
+	if err != nil {
+		return err
+	}
+	ddl, ok := stmt.(*sqlparser.DDL)
+	if !ok || ddl.Action != sqlparser.CreateTableStr {
+		return errors.Errorf("reshard.show.create.table[%s.%s].result.is.not.create.table", database, part.Table)
+	}
+	name := sqlparser.TableName{Name: sqlparser.NewTableIdent(tmpTable), Qualifier: sqlparser.NewTableIdent(database)}
+	ddl.Table = name
+	ddl.NewName = name
+	ddl.PartitionOption = partOpt
+	_, err = spanner.handleDDL(session, sqlparser.String(ddl), ddl)
+	return err
+}
+
+func (spanner *Spanner) reshardDropTable(session *driver.Session, database string, table string) error {
+	query := fmt.Sprintf("drop table if exists %s.%s", database, table)
+	node, err := sqlparser.Parse(query)
+	if err != nil {
+		return sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, err.Error())
+	}
+	_, err = spanner.handleDDL(session, query, node.(*sqlparser.DDL))
+	return err
+}
@@ -0,0 +1,435 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"plugins/shiftmanager"
+
+	"github.com/radondb/shift/shift"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// mockReshardShift mocks the shift of the reshard job, it calls the readonly api like the shift does.
+type mockReshardShift struct {
+	proxy *Proxy
+	info  *shiftmanager.ShiftInfo
+	err   error
+	block bool
+	fence func()
+	stop  chan struct{}
+	once  sync.Once
+}
+
+func (s *mockReshardShift) Start() error {
+	return nil
+}
+
+func (s *mockReshardShift) WaitFinish() error {
+	if s.err != nil {
+		return s.err
+	}
+	if s.block {
+		<-s.stop
+		return errors.New("mock.shift.stopped")
+	}
+	id, _ := strconv.ParseUint(path.Base(s.info.RadonURL), 10, 64)
+	if err := s.proxy.ReshardThrottle(id, 1000); err != nil {
+		return err
+	}
+	if err := s.proxy.ReshardReadOnly(id, true); err != nil {
+		return err
+	}
+	if s.fence != nil {
+		s.fence()
+	}
+	return s.proxy.ReshardReadOnly(id, false)
+}
+
+func (s *mockReshardShift) ChecksumTable() error {
+	return nil
+}
+
+func (s *mockReshardShift) SetStopSignal() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+}
+
+// mockReshardShifts replaces the shifts of the reshard jobs, the setup is called for every new shift.
+func mockReshardShifts(proxy *Proxy, setup func(s *mockReshardShift)) *[]*mockReshardShift {
+	var shifts []*mockReshardShift
+	proxy.Spanner().ddlJobs.newShift = func(info *shiftmanager.ShiftInfo) (shift.ShiftHandler, error) {
+		s := &mockReshardShift{
+			proxy: proxy,
+			info:  info,
+			stop:  make(chan struct{}),
+		}
+		if setup != nil {
+			setup(s)
+		}
+		shifts = append(shifts, s)
+		return s, nil
+	}
+	return &shifts
+}
+
+func mockShowCreateTableResult() *sqltypes.Result {
+	return &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{
+				Name: "Table",
+				Type: querypb.Type_VARCHAR,
+			},
+			{
+				Name: "Create Table",
+				Type: querypb.Type_VARCHAR,
+			},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("t1_0000")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("CREATE TABLE `t1_0000` (\n  `id` int(11) DEFAULT NULL,\n  `b` int(11) DEFAULT NULL\n) ENGINE=InnoDB DEFAULT CHARSET=utf8")),
+			},
+		},
+	}
+}
+
+func TestProxyReshardJob(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	route := proxy.Router()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("drop .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("insert .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("show create table .*", mockShowCreateTableResult())
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id) partitions 8",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	// The writes are fenced when all the shifts caught up, the fence is in the table config.
+	var fenceErr error
+	var fence uint64
+	shifts := mockReshardShifts(proxy, func(s *mockReshardShift) {
+		s.fence = func() {
+			if fenceErr == nil {
+				fence = route.TableFence("test", "t1")
+				c, err := driver.NewConn("mock", "mock", address, "", "utf8")
+				if err != nil {
+					fenceErr = err
+					return
+				}
+				defer c.Close()
+				_, fenceErr = c.FetchAll("insert into test.t1(id, b) values(1, 1)", -1)
+			}
+		}
+	})
+
+	// HASH to GLOBAL.
+	{
+		_, err := client.FetchAll("alter table test.t1 global", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 5, len(*shifts))
+		assert.NotNil(t, fenceErr)
+		assert.True(t, strings.Contains(fenceErr.Error(), "table[test.t1].is.being.resharded.by.ddl.job[1]"))
+		assert.Equal(t, uint64(1), fence)
+		assert.Equal(t, uint64(0), route.TableFence("test", "t1"))
+
+		tconf, err := route.TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, "GLOBAL", tconf.ShardType)
+		assert.Equal(t, "t1_reshard_1", tconf.Partitions[0].Table)
+		assert.False(t, checkTableExists("test", "t1_reshard_1", route))
+
+		info := (*shifts)[0].info
+		assert.Equal(t, "t1_0000", info.FromTable)
+		assert.Equal(t, "t1_reshard_1", info.ToTable)
+		assert.False(t, info.Checksum)
+
+		qr, err := client.FetchAll("show ddl job 1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 11, len(qr.Rows))
+		for _, row := range qr.Rows {
+			assert.Equal(t, "done", row[2].String())
+		}
+
+		// The fence is released.
+		_, err = client.FetchAll("insert into test.t1(id, b) values(1, 1)", -1)
+		assert.Nil(t, err)
+	}
+
+	// GLOBAL to HASH, only the first partition is shifted.
+	{
+		fenceErr = errors.New("skip")
+		*shifts = nil
+		_, err := client.FetchAll("alter table test.t1 partition by hash(b)", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(*shifts))
+		assert.True(t, (*shifts)[0].info.Checksum)
+
+		tconf, err := route.TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, "HASH", tconf.ShardType)
+		assert.Equal(t, "b", tconf.ShardKey)
+		assert.Equal(t, "t1_reshard_2_0000", tconf.Partitions[0].Table)
+	}
+
+	// GLOBAL to GLOBAL.
+	{
+		_, err := client.FetchAll("alter table test.t1 global", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("alter table test.t1 global", -1)
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "reshard.table[t1].is.already.global"))
+	}
+
+	// Table not exists.
+	{
+		_, err := client.FetchAll("alter table test.t2 global", -1)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestProxyReshardJobShiftError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	route := proxy.Router()
+	spanner := proxy.Spanner()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("drop .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("show create table .*", mockShowCreateTableResult())
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id) partitions 8",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	// One shift failed, the others are aborted.
+	query := "alter table test.t1 partition by hash(b) partitions 16"
+	{
+		n := 0
+		mockReshardShifts(proxy, func(s *mockReshardShift) {
+			if n == 3 {
+				s.err = errors.New("mock.shift.error")
+			}
+			n++
+		})
+		_, err := client.FetchAll(query, -1)
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "mock.shift.error"))
+
+		job, err := spanner.ddlJobs.Job(1)
+		assert.Nil(t, err)
+		assert.Equal(t, ddlJobStateFailed, job.State)
+
+		// The table is untouched and the tmp table is dropped.
+		tconf, err := route.TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, "id", tconf.ShardKey)
+		assert.False(t, checkTableExists("test", "t1_reshard_1", route))
+	}
+
+	// Re-issue the same ddl, the job is resumed.
+	{
+		shifts := mockReshardShifts(proxy, nil)
+		_, err := client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 5, len(*shifts))
+
+		jobs := spanner.ddlJobs.Jobs()
+		assert.Equal(t, 1, len(jobs))
+		assert.Equal(t, ddlJobStateDone, jobs[0].State)
+		tconf, err := route.TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, "b", tconf.ShardKey)
+		assert.Equal(t, "t1_reshard_1_0000", tconf.Partitions[0].Table)
+	}
+}
+
+func TestProxyReshardJobDropError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	route := proxy.Router()
+	spanner := proxy.Spanner()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("drop .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("show create table .*", mockShowCreateTableResult())
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id) partitions 8",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	// The swap is done, drop the old partition failed.
+	shifts := mockReshardShifts(proxy, nil)
+	{
+		fakedbs.AddQueryErrorPattern("drop table if exists test.t1_0002", errors.New("mock.drop.error"))
+		_, err := client.FetchAll("alter table test.t1 global", -1)
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "mock.drop.error"))
+
+		tconf, err := route.TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, "GLOBAL", tconf.ShardType)
+	}
+
+	// Resume only drops the old partitions.
+	{
+		fakedbs.ResetPatternErrors()
+		_, err := client.FetchAll("resume ddl job 1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 5, len(*shifts))
+
+		job, err := spanner.ddlJobs.Job(1)
+		assert.Nil(t, err)
+		assert.Equal(t, ddlJobStateDone, job.State)
+		for _, task := range job.Tasks {
+			if strings.Contains(task.Query, "t1_0002") && strings.HasPrefix(task.Query, "drop") {
+				assert.Equal(t, 2, task.Attempts)
+			} else {
+				assert.Equal(t, 1, task.Attempts)
+			}
+		}
+	}
+}
+
+func TestProxyReshardJobCancel(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	route := proxy.Router()
+	spanner := proxy.Spanner()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("drop .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("show create table .*", mockShowCreateTableResult())
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id) partitions 8",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	mockReshardShifts(proxy, func(s *mockReshardShift) {
+		s.block = true
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer c.Close()
+		_, err = c.FetchAll("alter table test.t1 global", -1)
+		assert.NotNil(t, err)
+	}()
+
+	// Wait for the shifts.
+	for !spanner.ddlJobs.isReshardTmpTable("test", "t1_reshard_1") {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The tmp table is created by the job, the create from the shift is ignored.
+	{
+		_, err := client.FetchAll("create table test.t1_reshard_1(id int, b int)", -1)
+		assert.Nil(t, err)
+	}
+
+	// The table is busy, the lock is held by the alter.
+	{
+		_, err := client.FetchAll("truncate table test.t1", -1)
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "syncer.lock[test.t1].is.held.by"))
+		assert.True(t, strings.Contains(err.Error(), "for[alter table test.t1 global]"))
+		_, err = client.FetchAll("rename table test.t1 to test.t2", -1)
+		assert.NotNil(t, err)
+		_, err = client.FetchAll("drop table test.t1", -1)
+		assert.NotNil(t, err)
+	}
+
+	_, err = client.FetchAll(fmt.Sprintf("cancel ddl job %d", 1), -1)
+	assert.Nil(t, err)
+	wg.Wait()
+
+	job, err := spanner.ddlJobs.Job(1)
+	assert.Nil(t, err)
+	assert.Equal(t, ddlJobStateCancelled, job.State)
+	tconf, err := route.TableConfig("test", "t1")
+	assert.Nil(t, err)
+	assert.Equal(t, "HASH", tconf.ShardType)
+	assert.False(t, checkTableExists("test", "t1_reshard_1", route))
+}
@@ -0,0 +1,186 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+// handleSequence used to handle the CREATE/DROP SEQUENCE command.
+func (spanner *Spanner) handleSequence(session *driver.Session, query string, node *sqlparser.Sequence) (*sqltypes.Result, error) {
+	route := spanner.router
+	sequencePlug := spanner.plugins.PlugSequence()
+
+	database := session.Schema()
+	if !node.Name.Qualifier.IsEmpty() {
+		database = node.Name.Qualifier.String()
+	}
+	if database == "" {
+		return nil, sqldb.NewSQLError(sqldb.ER_NO_DB_ERROR)
+	}
+	if err := route.DatabaseACL(database); err != nil {
+		return nil, err
+	}
+	privilegePlug := spanner.plugins.PlugPrivilege()
+	if err := privilegePlug.Check(database, session.User(), node); err != nil {
+		return nil, err
+	}
+	if err := route.CheckDatabase(database); err != nil {
+		return nil, err
+	}
+
+	name := node.Name.Name.String()
+	switch node.Action {
+	case sqlparser.CreateSequenceStr:
+		start, increment, cache := uint64(1), uint64(1), sequencePlug.DefaultCache()
+		if node.Start != nil {
+			start = node.Start.AsUint64()
+		}
+		if node.Increment != nil {
+			increment = node.Increment.AsUint64()
+		}
+		if node.Cache != nil {
+			cache = node.Cache.AsUint64()
+		}
+		if err := sequencePlug.Create(database, name, start, increment, cache, node.IfNotExists); err != nil {
+			return nil, err
+		}
+	case sqlparser.DropSequenceStr:
+		if err := sequencePlug.Drop(database, name, node.IfExists); err != nil {
+			return nil, err
+		}
+	}
+	return &sqltypes.Result{}, nil
+}
+
+// rewriteSequence used to replace the NEXTVAL(seq) and LAST_INSERT_ID() calls by the values,
+// returns true if the node is changed.
+// Every NEXTVAL call takes a new value, so it's only supported in the select without tables and the insert values,
+// the LAST_INSERT_ID() is the first auto-increment value generated by the last insert of the session.
+func (spanner *Spanner) rewriteSequence(session *driver.Session, node sqlparser.Statement) (bool, error) {
+	nextvalSupported := false
+	switch node := node.(type) {
+	case *sqlparser.Select:
+		if !hasSequenceFunc(node) {
+			return false, nil
+		}
+		nextvalSupported = isDualSelect(node)
+		// Keep the column names of the client.
+		for _, expr := range node.SelectExprs {
+			if aliased, ok := expr.(*sqlparser.AliasedExpr); ok && aliased.As.IsEmpty() && hasSequenceFunc(aliased.Expr) {
+				aliased.As = sqlparser.NewColIdent(sqlparser.String(aliased.Expr))
+			}
+		}
+	case *sqlparser.Insert:
+		if !hasSequenceFunc(node) {
+			return false, nil
+		}
+		_, nextvalSupported = node.Rows.(sqlparser.Values)
+	default:
+		return false, nil
+	}
+
+	var err error
+	sequencePlug := spanner.plugins.PlugSequence()
+	sqlparser.Rewrite(node, func(cursor *sqlparser.Cursor) bool {
+		if err != nil {
+			return false
+		}
+		fn, ok := cursor.Node().(*sqlparser.FuncExpr)
+		if !ok {
+			return true
+		}
+		switch fn.Name.Lowered() {
+		case "nextval":
+			if !nextvalSupported {
+				err = errors.New("unsupported: nextval.only.in.select.without.tables.or.insert.values")
+				return false
+			}
+			var database, name string
+			if database, name, err = sequenceName(session, fn); err != nil {
+				return false
+			}
+			var values []uint64
+			if values, err = sequencePlug.Next(database, name, 1); err != nil {
+				return false
+			}
+			cursor.Replace(sqlparser.NewIntVal([]byte(strconv.FormatUint(values[0], 10))))
+		case "last_insert_id":
+			if len(fn.Exprs) > 0 {
+				err = errors.New("unsupported: last_insert_id.with.arguments")
+				return false
+			}
+			var id uint64
+			if txSession := spanner.sessions.getTxnSession(session); txSession != nil {
+				id = txSession.getLastInsertID()
+			}
+			cursor.Replace(sqlparser.NewIntVal([]byte(strconv.FormatUint(id, 10))))
+		}
+		return true
+	}, nil)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// hasSequenceFunc returns true if the node calls NEXTVAL or LAST_INSERT_ID.
+func hasSequenceFunc(node sqlparser.SQLNode) bool {
+	found := false
+	sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		if fn, ok := node.(*sqlparser.FuncExpr); ok {
+			switch fn.Name.Lowered() {
+			case "nextval", "last_insert_id":
+				found = true
+				return false, nil
+			}
+		}
+		return !found, nil
+	}, node)
+	return found
+}
+
+// isDualSelect returns true if the select has no tables, such as: select nextval(s1).
+func isDualSelect(node *sqlparser.Select) bool {
+	if len(node.From) != 1 {
+		return false
+	}
+	aliased, ok := node.From[0].(*sqlparser.AliasedTableExpr)
+	if !ok {
+		return false
+	}
+	tb, ok := aliased.Expr.(sqlparser.TableName)
+	return ok && tb.Qualifier.IsEmpty() && strings.EqualFold(tb.Name.String(), "dual")
+}
+
+// sequenceName returns the database and name of the sequence by the NEXTVAL argument: s1 or db1.s1.
+func sequenceName(session *driver.Session, fn *sqlparser.FuncExpr) (string, string, error) {
+	if len(fn.Exprs) == 1 {
+		if aliased, ok := fn.Exprs[0].(*sqlparser.AliasedExpr); ok {
+			if col, ok := aliased.Expr.(*sqlparser.ColName); ok {
+				database := session.Schema()
+				if !col.Qualifier.Name.IsEmpty() {
+					database = col.Qualifier.Name.String()
+				}
+				if database == "" {
+					return "", "", sqldb.NewSQLError(sqldb.ER_NO_DB_ERROR)
+				}
+				return database, col.Name.String(), nil
+			}
+		}
+	}
+	return "", "", errors.Errorf("unsupported: nextval.argument.must.be.the.sequence.name:%s", sqlparser.String(fn))
+}
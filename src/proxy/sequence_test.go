@@ -0,0 +1,108 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxySequence(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("insert .*", &sqltypes.Result{RowsAffected: 1})
+		fakedbs.AddQuery("select 1 as `nextval(s1)`, 0 as `last_insert_id()` from dual", &sqltypes.Result{
+			Fields: []*querypb.Field{{Name: "nextval(s1)", Type: querypb.Type_INT64}, {Name: "last_insert_id()", Type: querypb.Type_INT64}},
+			Rows:   [][]sqltypes.Value{{sqltypes.NewInt64(1), sqltypes.NewInt64(0)}},
+		})
+		fakedbs.AddQuery("select 1 as `last_insert_id()` from dual", &sqltypes.Result{
+			Fields: []*querypb.Field{{Name: "last_insert_id()", Type: querypb.Type_INT64}},
+			Rows:   [][]sqltypes.Value{{sqltypes.NewInt64(1)}},
+		})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+
+	// No database selected.
+	{
+		_, err = client.FetchAll("create sequence s1", -1)
+		assert.Equal(t, "No database selected (errno 1046) (sqlstate 3D000)", err.Error())
+	}
+
+	querys := []string{
+		"create database test",
+		"use test",
+		"create table t1(`id` bigint(20) unsigned NOT NULL AUTO_INCREMENT, b int) partition by hash(id)",
+		"create sequence s1 start with 1 increment by 1 cache 100",
+		"create sequence if not exists test.s1",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	// NEXTVAL and LAST_INSERT_ID in the select without tables.
+	{
+		qr, err := client.FetchAll("select nextval(s1), last_insert_id()", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, "nextval(s1)", qr.Fields[0].Name)
+		assert.Equal(t, "1", qr.Rows[0][0].String())
+	}
+
+	// The auto-increment value is returned by the OK packet and LAST_INSERT_ID().
+	{
+		qr, err := client.FetchAll("insert into t1(b) values(1), (2)", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(1), qr.InsertID)
+
+		qr, err = client.FetchAll("select last_insert_id()", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, "1", qr.Rows[0][0].String())
+	}
+
+	// NEXTVAL in the insert values.
+	{
+		_, err = client.FetchAll("insert into t1(id, b) values(nextval(test.s1), 1)", -1)
+		assert.Nil(t, err)
+	}
+
+	// Unsupported.
+	{
+		querys := []string{
+			"select nextval(s1) from t1",
+			"select nextval(1)",
+			"select last_insert_id(1)",
+			"insert into t1(id, b) select nextval(s1), 1 from t1",
+		}
+		for _, query := range querys {
+			_, err = client.FetchAll(query, -1)
+			assert.NotNil(t, err)
+		}
+	}
+
+	// Drop.
+	{
+		_, err = client.FetchAll("drop sequence if exists s1", -1)
+		assert.Nil(t, err)
+	}
+}
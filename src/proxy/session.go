@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"backend"
+	"xtrace"
 
 	"github.com/xelabs/go-mysqlstack/driver"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
@@ -35,6 +36,16 @@ type session struct {
 	timestamp    int64
 	capabilities bitmask
 	transaction  backend.Transaction
+	// shardBase is the shards of the transaction when the statement binding,
+	// shards are the shards touched by the statements not taken yet.
+	shardBase uint64
+	shards    uint64
+	// span is the root span of the statement, nil if not traced.
+	span *xtrace.Span
+	// lastInsertID is the first auto-increment value generated by the last insert, returned by LAST_INSERT_ID().
+	lastInsertID uint64
+	// notes are the notes of the last statement handled by radon itself, returned by SHOW WARNINGS.
+	notes []string
 }
 
 func (s *session) setStreamingFetchVar(r bool) {
@@ -49,6 +60,14 @@ func (s *session) getStreamingFetchVar() bool {
 	return s.capabilities&cap_streaming_fetch != 0
 }
 
+func (s *session) setLastInsertID(id uint64) {
+	s.lastInsertID = id
+}
+
+func (s *session) getLastInsertID() uint64 {
+	return s.lastInsertID
+}
+
 func newSession(log *xlog.Log, s *driver.Session) *session {
 	log.Debug("session[%v].created", s.ID())
 	return &session{
@@ -83,3 +102,11 @@ func (s *session) close() {
 		}
 	}
 }
+
+// countShards adds the shards touched by the bound transaction since the binding, the caller holds the lock.
+func (s *session) countShards() {
+	if s.transaction != nil {
+		s.shards += s.transaction.Shards() - s.shardBase
+		s.shardBase = s.transaction.Shards()
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"backend"
+	"xtrace"
 
 	"github.com/xelabs/go-mysqlstack/driver"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
@@ -124,6 +125,7 @@ func (ss *Sessions) TxnBinding(s *driver.Session, txn backend.Transaction, node
 	// Bind sid to txn.
 	txn.SetSessionID(s.ID())
 	session.transaction = txn
+	session.shardBase = txn.Shards()
 	session.timestamp = time.Now().Unix()
 }
 
@@ -139,6 +141,7 @@ func (ss *Sessions) TxnUnBinding(s *driver.Session) {
 
 	session.mu.Lock()
 	defer session.mu.Unlock()
+	session.countShards()
 	session.node = nil
 	session.query = ""
 	session.transaction = nil
@@ -170,6 +173,9 @@ func (ss *Sessions) MultiStmtTxnBinding(s *driver.Session, txn backend.Transacti
 		txn.SetSessionID(s.ID())
 		session.transaction = txn
 	}
+	if session.transaction != nil {
+		session.shardBase = session.transaction.Shards()
+	}
 	session.timestamp = time.Now().Unix()
 }
 
@@ -185,6 +191,7 @@ func (ss *Sessions) MultiStmtTxnUnBinding(s *driver.Session, isEnd bool) {
 
 	session.mu.Lock()
 	defer session.mu.Unlock()
+	session.countShards()
 	session.node = nil
 	session.query = ""
 	// If multiple-statement transaction is end or some errors happen, set transaction to be nil
@@ -194,6 +201,63 @@ func (ss *Sessions) MultiStmtTxnUnBinding(s *driver.Session, isEnd bool) {
 	session.timestamp = time.Now().Unix()
 }
 
+// TraceBinding used to bind the root span of the statement to the session, nil to unbind.
+func (ss *Sessions) TraceBinding(s *driver.Session, span *xtrace.Span) {
+	session := ss.getSession(s.ID())
+	if session == nil {
+		return
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	session.span = span
+}
+
+// Trace returns the root span of the statement of the session, nil if not traced.
+func (ss *Sessions) Trace(s *driver.Session) *xtrace.Span {
+	session := ss.getSession(s.ID())
+	if session == nil {
+		return nil
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return session.span
+}
+
+// TakeShards returns the shards touched by the session since the last take and resets it.
+func (ss *Sessions) TakeShards(s *driver.Session) uint64 {
+	session := ss.getSession(s.ID())
+	if session == nil {
+		return 0
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	shards := session.shards
+	session.shards = 0
+	return shards
+}
+
+// SetNotes sets the notes of the last statement, nil to clear them.
+func (ss *Sessions) SetNotes(s *driver.Session, notes []string) {
+	session := ss.getSession(s.ID())
+	if session == nil {
+		return
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	session.notes = notes
+}
+
+// Notes returns the notes of the last statement.
+func (ss *Sessions) Notes(s *driver.Session) []string {
+	session := ss.getSession(s.ID())
+	if session == nil {
+		return nil
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return session.notes
+}
+
 // Close used to close all sessions.
 func (ss *Sessions) Close() {
 	i := 0
@@ -14,6 +14,7 @@ import (
 	"fmt"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -229,10 +230,23 @@ func (spanner *Spanner) handleShowTables(session *driver.Session, query string,
 		qr.Fields = []*querypb.Field{
 			{Name: fmt.Sprintf("Tables_in_%s", database), Type: querypb.Type_VARCHAR},
 		}
-		for _, table := range tables {
-			row := []sqltypes.Value{sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(table))}
+		// SHOW FULL TABLES has the Table_type column, the views are stored in radon.
+		if ast.Full != "" {
+			qr.Fields = append(qr.Fields, &querypb.Field{Name: "Table_type", Type: querypb.Type_VARCHAR})
+		}
+		addRow := func(name string, tableType string) {
+			row := []sqltypes.Value{sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(name))}
+			if ast.Full != "" {
+				row = append(row, sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(tableType)))
+			}
 			qr.Rows = append(qr.Rows, row)
 		}
+		for _, table := range tables {
+			addRow(table, "BASE TABLE")
+		}
+		for _, view := range router.Views(database) {
+			addRow(view, "VIEW")
+		}
 	}
 	return qr, nil
 }
@@ -254,6 +268,11 @@ func (spanner *Spanner) handleShowCreateTable(session *driver.Session, query str
 		return nil, err
 	}
 
+	// The view is stored in radon, as MySQL does, show its CREATE VIEW.
+	if router.View(database, table) != nil {
+		return spanner.handleShowCreateView(session, query, node)
+	}
+
 	var qr *sqltypes.Result
 	var err error
 
@@ -576,6 +595,109 @@ func (spanner *Spanner) handleShowQueryz(session *driver.Session, query string,
 	return qr, nil
 }
 
+// handleShowQueryDigest used to handle the query "SHOW QUERY DIGEST [LIMIT n]".
+func (spanner *Spanner) handleShowQueryDigest(session *driver.Session, query string, node sqlparser.Statement) (*sqltypes.Result, error) {
+	privilegePlug := spanner.plugins.PlugPrivilege()
+	if !privilegePlug.IsSuperPriv(session.User()) {
+		return nil, sqldb.NewSQLErrorf(sqldb.ER_SPECIFIC_ACCESS_DENIED_ERROR, "Access denied; lacking super privilege for the operation")
+	}
+
+	limit := 0
+	if show := node.(*sqlparser.Show); show.Limit != nil {
+		val, ok := show.Limit.Rowcount.(*sqlparser.SQLVal)
+		if !ok || val.Type != sqlparser.IntVal {
+			return nil, sqldb.NewSQLErrorf(sqldb.ER_SYNTAX_ERROR, "Incorrect arguments to LIMIT")
+		}
+		n, err := strconv.Atoi(string(val.Val))
+		if err != nil {
+			return nil, sqldb.NewSQLErrorf(sqldb.ER_SYNTAX_ERROR, "Incorrect arguments to LIMIT")
+		}
+		limit = n
+	}
+
+	qr := &sqltypes.Result{}
+	qr.Fields = []*querypb.Field{
+		{Name: "Digest", Type: querypb.Type_VARCHAR},
+		{Name: "Digest_text", Type: querypb.Type_VARCHAR},
+		{Name: "Count", Type: querypb.Type_UINT64},
+		{Name: "Errors", Type: querypb.Type_UINT64},
+		{Name: "Total_latency", Type: querypb.Type_FLOAT64},
+		{Name: "Avg_latency", Type: querypb.Type_FLOAT64},
+		{Name: "Max_latency", Type: querypb.Type_FLOAT64},
+		{Name: "P95_latency", Type: querypb.Type_FLOAT64},
+		{Name: "P99_latency", Type: querypb.Type_FLOAT64},
+		{Name: "Rows_sent", Type: querypb.Type_UINT64},
+		{Name: "Rows_affected", Type: querypb.Type_UINT64},
+		{Name: "Shards", Type: querypb.Type_UINT64},
+		{Name: "Scatter_ratio", Type: querypb.Type_FLOAT64},
+		{Name: "First_seen", Type: querypb.Type_VARCHAR},
+		{Name: "Last_seen", Type: querypb.Type_VARCHAR},
+	}
+	// The latencies are in seconds.
+	seconds := func(d time.Duration) sqltypes.Value {
+		return sqltypes.MakeTrusted(querypb.Type_FLOAT64, []byte(fmt.Sprintf("%.6f", d.Seconds())))
+	}
+	count := func(v uint64) sqltypes.Value {
+		return sqltypes.MakeTrusted(querypb.Type_UINT64, []byte(fmt.Sprintf("%d", v)))
+	}
+	for _, d := range spanner.digests.Rows(limit) {
+		row := []sqltypes.Value{
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(d.Digest)),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(d.Text)),
+			count(d.Count),
+			count(d.Errors),
+			seconds(d.TotalLatency),
+			seconds(d.TotalLatency / time.Duration(d.Count)),
+			seconds(d.MaxLatency),
+			seconds(d.P95Latency),
+			seconds(d.P99Latency),
+			count(d.RowsSent),
+			count(d.RowsAffected),
+			count(d.Shards),
+			sqltypes.MakeTrusted(querypb.Type_FLOAT64, []byte(fmt.Sprintf("%.4f", float64(d.Scatters)/float64(d.Count)))),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(d.FirstSeen.Format("20060102150405.000"))),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(d.LastSeen.Format("20060102150405.000"))),
+		}
+		qr.Rows = append(qr.Rows, row)
+	}
+	return qr, nil
+}
+
+// handleShowAuditStatus used to handle the query "SHOW AUDIT STATUS".
+func (spanner *Spanner) handleShowAuditStatus(session *driver.Session, query string, node sqlparser.Statement) (*sqltypes.Result, error) {
+	privilegePlug := spanner.plugins.PlugPrivilege()
+	if !privilegePlug.IsSuperPriv(session.User()) {
+		return nil, sqldb.NewSQLErrorf(sqldb.ER_SPECIFIC_ACCESS_DENIED_ERROR, "Access denied; lacking super privilege for the operation")
+	}
+
+	status := spanner.audit.Status()
+	qr := &sqltypes.Result{}
+	qr.Fields = []*querypb.Field{
+		{Name: "Mode", Type: querypb.Type_VARCHAR},
+		{Name: "Sink", Type: querypb.Type_VARCHAR},
+		{Name: "Full_policy", Type: querypb.Type_VARCHAR},
+		{Name: "Queue_size", Type: querypb.Type_INT64},
+		{Name: "Queue_length", Type: querypb.Type_INT64},
+		{Name: "Filtered", Type: querypb.Type_UINT64},
+		{Name: "Dropped", Type: querypb.Type_UINT64},
+		{Name: "Written", Type: querypb.Type_UINT64},
+		{Name: "Errors", Type: querypb.Type_UINT64},
+	}
+	row := []sqltypes.Value{
+		sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(status.Mode)),
+		sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(status.Sink)),
+		sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(status.FullPolicy)),
+		sqltypes.MakeTrusted(querypb.Type_INT64, []byte(fmt.Sprintf("%d", status.QueueSize))),
+		sqltypes.MakeTrusted(querypb.Type_INT64, []byte(fmt.Sprintf("%d", status.QueueLength))),
+		sqltypes.MakeTrusted(querypb.Type_UINT64, []byte(fmt.Sprintf("%d", status.Filtered))),
+		sqltypes.MakeTrusted(querypb.Type_UINT64, []byte(fmt.Sprintf("%d", status.Dropped))),
+		sqltypes.MakeTrusted(querypb.Type_UINT64, []byte(fmt.Sprintf("%d", status.Written))),
+		sqltypes.MakeTrusted(querypb.Type_UINT64, []byte(fmt.Sprintf("%d", status.Errors))),
+	}
+	qr.Rows = append(qr.Rows, row)
+	return qr, nil
+}
+
 // handleShowTxnz used to handle the query "SHOW TXNZ".
 func (spanner *Spanner) handleShowTxnz(session *driver.Session, query string, node sqlparser.Statement) (*sqltypes.Result, error) {
 	privilegePlug := spanner.plugins.PlugPrivilege()
@@ -620,6 +742,118 @@ func (spanner *Spanner) handleShowVersions(session *driver.Session, query string
 	return qr, nil
 }
 
+// handleShowWarnings used to handle the 'SHOW WARNINGS', the notes of the last statement handled by radon
+// are returned, such as the rows of every backend table of the LOAD DATA, the others are sent to the backend.
+func (spanner *Spanner) handleShowWarnings(session *driver.Session, query string, node sqlparser.Statement) (*sqltypes.Result, error) {
+	notes := spanner.sessions.Notes(session)
+	if notes == nil {
+		return spanner.handleJDBCShows(session, query, node)
+	}
+
+	qr := &sqltypes.Result{}
+	qr.Fields = []*querypb.Field{
+		{Name: "Level", Type: querypb.Type_VARCHAR},
+		{Name: "Code", Type: querypb.Type_INT64},
+		{Name: "Message", Type: querypb.Type_VARCHAR},
+	}
+	for _, note := range notes {
+		row := []sqltypes.Value{
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("Note")),
+			sqltypes.MakeTrusted(querypb.Type_INT64, []byte(fmt.Sprintf("%d", sqldb.ER_UNKNOWN_ERROR))),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(note)),
+		}
+		qr.Rows = append(qr.Rows, row)
+	}
+	return qr, nil
+}
+
 func (spanner *Spanner) handleJDBCShows(session *driver.Session, query string, node sqlparser.Statement) (*sqltypes.Result, error) {
 	return spanner.ExecuteSingle(query)
 }
+
+// handleShowDDLJobs used to handle the query "SHOW DDL JOBS".
+func (spanner *Spanner) handleShowDDLJobs(session *driver.Session, query string, node sqlparser.Statement) (*sqltypes.Result, error) {
+	privilegePlug := spanner.plugins.PlugPrivilege()
+	if !privilegePlug.IsSuperPriv(session.User()) {
+		return nil, sqldb.NewSQLErrorf(sqldb.ER_SPECIFIC_ACCESS_DENIED_ERROR, "Access denied; lacking super privilege for the operation")
+	}
+
+	qr := &sqltypes.Result{}
+	qr.Fields = []*querypb.Field{
+		{Name: "Job_id", Type: querypb.Type_INT64},
+		{Name: "Database", Type: querypb.Type_VARCHAR},
+		{Name: "Table", Type: querypb.Type_VARCHAR},
+		{Name: "State", Type: querypb.Type_VARCHAR},
+		{Name: "Partitions", Type: querypb.Type_INT64},
+		{Name: "Done", Type: querypb.Type_INT64},
+		{Name: "Failed", Type: querypb.Type_INT64},
+		{Name: "Start", Type: querypb.Type_VARCHAR},
+		{Name: "End", Type: querypb.Type_VARCHAR},
+		{Name: "Query", Type: querypb.Type_VARCHAR},
+		{Name: "Error", Type: querypb.Type_VARCHAR},
+	}
+	for _, job := range spanner.ddlJobs.Jobs() {
+		done, failed := job.Progress()
+		row := []sqltypes.Value{
+			sqltypes.MakeTrusted(querypb.Type_INT64, []byte(fmt.Sprintf("%v", job.ID))),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(job.Database)),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(job.Table)),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(job.State)),
+			sqltypes.MakeTrusted(querypb.Type_INT64, []byte(fmt.Sprintf("%v", len(job.Tasks)))),
+			sqltypes.MakeTrusted(querypb.Type_INT64, []byte(fmt.Sprintf("%v", done))),
+			sqltypes.MakeTrusted(querypb.Type_INT64, []byte(fmt.Sprintf("%v", failed))),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(formatDDLJobTime(job.StartTime))),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(formatDDLJobTime(job.EndTime))),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(job.Query)),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(job.Error)),
+		}
+		qr.Rows = append(qr.Rows, row)
+	}
+	return qr, nil
+}
+
+// handleShowDDLJob used to handle the query "SHOW DDL JOB id", shows the tasks of the job.
+func (spanner *Spanner) handleShowDDLJob(session *driver.Session, query string, node *sqlparser.Show) (*sqltypes.Result, error) {
+	privilegePlug := spanner.plugins.PlugPrivilege()
+	if !privilegePlug.IsSuperPriv(session.User()) {
+		return nil, sqldb.NewSQLErrorf(sqldb.ER_SPECIFIC_ACCESS_DENIED_ERROR, "Access denied; lacking super privilege for the operation")
+	}
+
+	job, err := spanner.ddlJobs.Job(node.JobID.AsUint64())
+	if err != nil {
+		return nil, err
+	}
+
+	qr := &sqltypes.Result{}
+	qr.Fields = []*querypb.Field{
+		{Name: "Backend", Type: querypb.Type_VARCHAR},
+		{Name: "Range", Type: querypb.Type_VARCHAR},
+		{Name: "State", Type: querypb.Type_VARCHAR},
+		{Name: "Attempts", Type: querypb.Type_INT64},
+		{Name: "Start", Type: querypb.Type_VARCHAR},
+		{Name: "End", Type: querypb.Type_VARCHAR},
+		{Name: "Query", Type: querypb.Type_VARCHAR},
+		{Name: "Error", Type: querypb.Type_VARCHAR},
+	}
+	for _, task := range job.Tasks {
+		row := []sqltypes.Value{
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(task.Backend)),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(task.Range)),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(task.State)),
+			sqltypes.MakeTrusted(querypb.Type_INT64, []byte(fmt.Sprintf("%v", task.Attempts))),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(formatDDLJobTime(task.StartTime))),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(formatDDLJobTime(task.EndTime))),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(task.Query)),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(task.Error)),
+		}
+		qr.Rows = append(qr.Rows, row)
+	}
+	return qr, nil
+}
+
+func formatDDLJobTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("20060102150405.000")
+}
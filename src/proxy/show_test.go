@@ -15,6 +15,8 @@ import (
 	"testing"
 	"time"
 
+	"config"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/driver"
 	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
@@ -1300,3 +1302,119 @@ func TestProxyShowTxnzPrivilege(t *testing.T) {
 		assert.Equal(t, want, got)
 	}
 }
+
+func TestProxyShowQueryDigest(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("insert .*", &sqltypes.Result{RowsAffected: 1})
+		fakedbs.AddQueryPattern("select .*", &sqltypes.Result{})
+	}
+
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		querys := []string{
+			"create database test",
+			"create table test.t1(id int, b int) partition by hash(id)",
+			"insert into test.t1(id, b) values(1, 1)",
+			"insert into test.t1(id, b) values(2, 2), (3, 3)",
+			"select * from test.t1",
+		}
+		for _, query := range querys {
+			_, err = client.FetchAll(query, -1)
+			assert.Nil(t, err)
+		}
+
+		qr, err := client.FetchAll("show query digest", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 15, len(qr.Fields))
+		digests := make(map[string][]sqltypes.Value)
+		for _, row := range qr.Rows {
+			digests[row[1].String()] = row
+		}
+		insert := digests["insert into test.t1(id, b) values (?, ?)"]
+		assert.NotNil(t, insert)
+		assert.Equal(t, "2", insert[2].String())
+		assert.Equal(t, "3", insert[10].String())
+		selects := digests["select * from test.t1"]
+		assert.NotNil(t, selects)
+		assert.Equal(t, "1.0000", selects[12].String())
+
+		qr, err = client.FetchAll("show query digest limit 1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(qr.Rows))
+	}
+}
+
+func TestProxyShowAuditStatus(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := MockDefaultConfig()
+	conf.Audit.Mode = "A"
+	conf.Audit.Filters = []*config.AuditFilter{
+		{Exclude: true, Commands: []string{"show"}},
+	}
+	fakedbs, proxy, cleanup := MockProxy1(log, conf)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("select .*", &sqltypes.Result{})
+	}
+
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		_, err = client.FetchAll("select 1", -1)
+		assert.Nil(t, err)
+
+		qr, err := client.FetchAll("show audit status", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 9, len(qr.Fields))
+		row := qr.Rows[0]
+		assert.Equal(t, "A", row[0].String())
+		assert.Equal(t, "file", row[1].String())
+		assert.Equal(t, "block", row[2].String())
+		assert.Equal(t, "1024", row[3].String())
+		// The show is filtered after the status is returned.
+		assert.Equal(t, "0", row[5].String())
+
+		_, err = client.FetchAll("show audit status", -1)
+		assert.Nil(t, err)
+		qr, err = client.FetchAll("show audit status", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, "2", qr.Rows[0][5].String())
+		assert.Equal(t, "0", qr.Rows[0][6].String())
+	}
+}
+
+func TestProxyShowQueryDigestPrivilege(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxyPrivilegeN(log, MockDefaultConfig())
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+	}
+
+	// show query digest.
+	{
+		show, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+		assert.Nil(t, err)
+		_, err = show.FetchAll("show query digest", -1)
+		assert.NotNil(t, err)
+		want := fmt.Sprintf("Access denied; lacking super privilege for the operation (errno 1227) (sqlstate 42000)")
+		got := err.Error()
+		assert.Equal(t, want, got)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"slowlog"
+	"xcontext"
+	"xtrace"
+
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+// slowLogRecord used to write the statement to the slow log if it's slower than the long-query-time,
+// the per-shard executions are collected from the spans of the statement.
+func (spanner *Spanner) slowLogRecord(session *driver.Session, database string, query string, span *xtrace.Span,
+	start time.Time, qr *sqltypes.Result, err error) {
+	if spanner.slowLog == nil {
+		return
+	}
+	cost := time.Since(start)
+	if cost <= time.Duration(spanner.conf.Proxy.LongQueryTime)*time.Second {
+		return
+	}
+
+	entry := &slowlog.Entry{
+		Start:    start,
+		Cost:     cost,
+		User:     session.User(),
+		Host:     session.Addr(),
+		ThreadID: session.ID(),
+		Database: database,
+		Query:    query,
+		Plan:     slowlog.PlanNone,
+	}
+	if qr != nil {
+		entry.RowsSent = uint64(len(qr.Rows))
+		entry.RowsAffected = qr.RowsAffected
+	}
+	if err != nil {
+		entry.Errno = sqldb.ER_UNKNOWN_ERROR
+		if se, ok := err.(*sqldb.SQLError); ok {
+			entry.Errno = se.Num
+		}
+	}
+
+	// The root span isn't finished yet, the others are.
+	join := false
+	if span != nil {
+		spans := span.Spans()
+		sort.SliceStable(spans, func(i, j int) bool { return spans[i].Start.Before(spans[j].Start) })
+		for _, s := range spans {
+			switch s.Name {
+			case "engine.join":
+				join = true
+			case "backend.execute", "backend.stream":
+				rows, _ := strconv.ParseUint(s.Attr("rows"), 10, 64)
+				entry.Shards = append(entry.Shards, &slowlog.Shard{
+					QueryTuple: xcontext.QueryTuple{
+						Query:   s.Attr("query"),
+						Backend: s.Attr("backend"),
+					},
+					Cost:  s.Duration(),
+					Rows:  rows,
+					Error: s.Err,
+				})
+			}
+		}
+	}
+	switch {
+	case join:
+		entry.Plan = slowlog.PlanJoin
+	case len(entry.Shards) > 1:
+		entry.Plan = slowlog.PlanScatter
+	case len(entry.Shards) == 1:
+		entry.Plan = slowlog.PlanSingleShard
+	}
+	spanner.slowLog.Log(entry)
+}
@@ -0,0 +1,102 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"fakedb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxySlowLog(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	tmpDir := fakedb.GetTmpDir("", "radon_slowlog_", log)
+	defer os.RemoveAll(tmpDir)
+
+	conf := MockDefaultConfig()
+	conf.Proxy.SlowLogDir = tmpDir
+	conf.Proxy.LongQueryTime = 0
+	fakedbs, proxy, cleanup := MockProxy1(log, conf)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select .* from test.t1_.*", &sqltypes.Result{
+			Fields: []*querypb.Field{{Name: "id", Type: querypb.Type_INT32}, {Name: "b", Type: querypb.Type_INT32}},
+			Rows: [][]sqltypes.Value{
+				{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1")), sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1"))},
+			},
+		})
+		fakedbs.AddQueryPattern("select .* from test.t2_.*", &sqltypes.Result{
+			Fields: []*querypb.Field{{Name: "b", Type: querypb.Type_INT32}},
+		})
+	}
+
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		querys := []string{
+			"create database test",
+			"create table test.t1(id int, b int) partition by hash(id)",
+			"create table test.t2(id int, b int) partition by hash(id)",
+			"select id, b from test.t1 where id=1",
+			"select id, b from test.t1",
+			"select t1.id, t2.b from test.t1 join test.t2 on t1.b=t2.b where t1.id=1",
+		}
+		for _, query := range querys {
+			_, err = client.FetchAll(query, -1)
+			assert.Nil(t, err)
+		}
+	}
+	// Flush the slow log.
+	proxy.Spanner().slowLog.Close()
+
+	files, err := filepath.Glob(filepath.Join(tmpDir, "slow-*.log"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(files))
+	data, err := ioutil.ReadFile(files[0])
+	assert.Nil(t, err)
+	entries := strings.Split(string(data), "# Time: ")[1:]
+	assert.Equal(t, 6, len(entries))
+
+	// The ddl.
+	assert.True(t, strings.Contains(entries[0], "Radon_plan: none  Radon_shards: 0\n"), entries[0])
+	assert.True(t, strings.HasSuffix(entries[0], "\ncreate database test;\n"), entries[0])
+
+	// The single shard.
+	single := entries[3]
+	assert.True(t, strings.Contains(single, "Rows_sent: 1  Rows_examined: 1\n"), single)
+	assert.True(t, strings.Contains(single, "Radon_plan: single-shard  Radon_shards: 1\n"), single)
+	assert.True(t, strings.Contains(single, "# Radon_shard: backend"), single)
+	assert.True(t, strings.Contains(single, "Shard_rows: 1  Shard_query: select id, b from test.t1_0017 as t1 where id = 1\n"), single)
+
+	// The scatter.
+	scatter := entries[4]
+	assert.True(t, strings.Contains(scatter, "Radon_plan: scatter"), scatter)
+	assert.True(t, strings.Count(scatter, "# Radon_shard: ") > 1, scatter)
+
+	// The join.
+	join := entries[5]
+	assert.True(t, strings.Contains(join, "Radon_plan: join"), join)
+	assert.True(t, strings.Contains(join, "from test.t2_"), join)
+	assert.True(t, strings.HasSuffix(join, "\nselect t1.id, t2.b from test.t1 join test.t2 on t1.b=t2.b where t1.id=1;\n"), join)
+}
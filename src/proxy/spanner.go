@@ -9,16 +9,25 @@
 package proxy
 
 import (
+	"fmt"
+	"sync"
+	"time"
+
 	"audit"
 	"backend"
 	"config"
+	"metastore"
 	"monitor"
 	"plugins"
+	"plugins/shiftmanager"
 	"router"
-	"sync"
+	"slowlog"
+	"syncer"
 	"xbase"
 	"xbase/sync2"
+	"xtrace"
 
+	"github.com/radondb/shift/shift"
 	"github.com/xelabs/go-mysqlstack/driver"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
@@ -36,9 +45,16 @@ type Spanner struct {
 	plugins       *plugins.Plugin
 	diskChecker   *DiskCheck
 	manager       *Manager
+	ddlJobs       *DDLJobs
+	history       *metastore.History
+	syncer        *syncer.Syncer
+	digests       *QueryDigests
+	tracer        *xtrace.Tracer
+	slowLog       *slowlog.SlowLog
 	readonly      sync2.AtomicBool
 	mu            sync.RWMutex
 	serverVersion string
+	shiftToken    string
 }
 
 // NewSpanner creates a new spanner.
@@ -55,6 +71,7 @@ func NewSpanner(log *xlog.Log, conf *config.Config,
 		throttle:      throttle,
 		plugins:       plugins,
 		serverVersion: serverVersion,
+		shiftToken:    newShiftToken(),
 	}
 }
 
@@ -74,13 +91,89 @@ func (spanner *Spanner) Init() error {
 		return err
 	}
 	spanner.manager = mgr
+
+	ddlJobs := NewDDLJobs(log, conf, spanner.scatter)
+	if err := ddlJobs.Init(); err != nil {
+		return err
+	}
+	ddlJobs.newShift = func(info *shiftmanager.ShiftInfo) (shift.ShiftHandler, error) {
+		return spanner.plugins.PlugShiftMgr().NewShiftInstance(info, shiftmanager.ShiftTypeReshard)
+	}
+	spanner.ddlJobs = ddlJobs
+
+	historyMax := 0
+	if conf.MetaStore != nil {
+		historyMax = conf.MetaStore.HistoryMax
+	}
+	spanner.history = metastore.NewHistory(log, spanner.router.MetaStore(), historyMax)
+
+	digests := NewQueryDigests(conf.Proxy.QueryDigestMax)
+	if digests != nil {
+		monitor.QueryDigestSourceSet(func() []*monitor.QueryDigestMetric {
+			return digests.Metrics(conf.Proxy.QueryDigestMetrics)
+		})
+	}
+	spanner.digests = digests
+
+	tracer, err := xtrace.NewTracer(log, conf.Trace)
+	if err != nil {
+		return err
+	}
+	spanner.tracer = tracer
+
+	slowLog := slowlog.NewSlowLog(log, conf.Proxy)
+	if err := slowLog.Init(); err != nil {
+		return err
+	}
+	spanner.slowLog = slowLog
 	return nil
 }
 
+// QueryDigests returns the query digests, nil if disabled.
+func (spanner *Spanner) QueryDigests() *QueryDigests {
+	return spanner.digests
+}
+
+// History returns the meta history.
+func (spanner *Spanner) History() *metastore.History {
+	return spanner.history
+}
+
+// ClusterLock used to take the cluster locks of the names before the ddl or the admin command,
+// the name is a database 'db', a table 'db.table' or syncer.LockCluster.
+// It waits ddl-lock-wait for the locks held by others and fails with the holder.
+func (spanner *Spanner) ClusterLock(owner string, cause string, names ...string) (*syncer.LockGuard, error) {
+	conf := spanner.conf.Proxy
+	lease := time.Duration(conf.DDLLockLease) * time.Second
+	if lease <= 0 {
+		lease = time.Duration(config.DefaultProxyConfig().DDLLockLease) * time.Second
+	}
+	wait := time.Duration(conf.DDLLockWait) * time.Millisecond
+	return spanner.syncer.Lock(owner, cause, lease, wait, names...)
+}
+
+// lockOwner returns the owner identity of the session, the peer address is unique in the cluster.
+func (spanner *Spanner) lockOwner(session *driver.Session) string {
+	return fmt.Sprintf("%s/session:%d/%s", spanner.conf.Proxy.PeerAddress, session.ID(), session.User())
+}
+
+// recordHistory used to record the meta snapshot after the statement changed the metadata,
+// the error is logged only since the statement has been done.
+func (spanner *Spanner) recordHistory(author string, cause string) {
+	if _, err := spanner.history.Record(author, cause); err != nil {
+		spanner.log.Error("spanner.record.meta.history.cause[%s].error:%+v", cause, err)
+	}
+}
+
 // Close used to close spanner.
 func (spanner *Spanner) Close() error {
 	spanner.diskChecker.Close()
 	spanner.manager.Close()
+	if spanner.digests != nil {
+		monitor.QueryDigestSourceSet(nil)
+	}
+	spanner.tracer.Close()
+	spanner.slowLog.Close()
 	spanner.log.Info("spanner.closed...")
 	return nil
 }
@@ -0,0 +1,61 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"regexp"
+
+	"xtrace"
+
+	"github.com/xelabs/go-mysqlstack/driver"
+)
+
+// traceHint forces the statement to be traced regardless of the sample rate.
+var traceHint = regexp.MustCompile(`(?i)/\*\+\s*trace\s*\*/`)
+
+// traceStart starts the root span of the statement if it is sampled or has the hint '/*+ trace */',
+// the span is bound to the session for the planner, the executor and the backends.
+// If the slow log is enabled, the statements not sampled have the in-memory span for the per-shard executions,
+// it has no attributes since the slow log entry has the session and the query.
+func (spanner *Spanner) traceStart(session *driver.Session, query string) *xtrace.Span {
+	span := spanner.tracer.Start("query", traceHint.MatchString(query))
+	if span == nil {
+		if spanner.slowLog == nil {
+			return nil
+		}
+		maxSpans := 0
+		if spanner.conf.Trace != nil {
+			maxSpans = spanner.conf.Trace.MaxSpans
+		}
+		span = xtrace.NewSpan("query", maxSpans)
+		spanner.sessions.TraceBinding(session, span)
+		return span
+	}
+	span.SetAttr("session", session.ID())
+	span.SetAttr("user", session.User())
+	span.SetAttr("db", session.Schema())
+	span.SetAttr("query", query)
+	spanner.sessions.TraceBinding(session, span)
+	return span
+}
+
+// traceFinish finishes the root span of the statement and unbinds it from the session.
+func (spanner *Spanner) traceFinish(session *driver.Session, span *xtrace.Span, err error) {
+	if span == nil {
+		return
+	}
+	spanner.sessions.TraceBinding(session, nil)
+	span.SetError(err)
+	span.Finish()
+}
+
+// Tracer returns the tracer, nil if the tracing is disabled.
+func (spanner *Spanner) Tracer() *xtrace.Tracer {
+	return spanner.tracer
+}
@@ -0,0 +1,82 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyTrace(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	file := "/tmp/radon_test_proxy_trace.log"
+	os.Remove(file)
+	defer os.Remove(file)
+
+	conf := MockDefaultConfig()
+	conf.Trace = &config.TraceConfig{Exporter: config.TraceExporterFile, File: file, MaxSpans: 1024}
+	fakedbs, proxy, cleanup := MockProxy1(log, conf)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select .* from test.t1_.*", &sqltypes.Result{
+			Fields: []*querypb.Field{{Name: "id", Type: querypb.Type_INT32}, {Name: "b", Type: querypb.Type_INT32}},
+		})
+		fakedbs.AddQueryPattern("select .* from test.t2_.*", &sqltypes.Result{
+			Fields: []*querypb.Field{{Name: "b", Type: querypb.Type_INT32}},
+		})
+		fakedbs.AddQueryPattern("select .*", &sqltypes.Result{})
+	}
+
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		querys := []string{
+			"create database test",
+			"create table test.t1(id int, b int) partition by hash(id)",
+			"create table test.t2(id int, b int) partition by hash(id)",
+			// Not sampled.
+			"select * from test.t1",
+			"select /*+ trace */ t1.id, t2.b from test.t1 join test.t2 on t1.b=t2.b where t1.id=1",
+		}
+		for _, query := range querys {
+			_, err = client.FetchAll(query, -1)
+			assert.Nil(t, err)
+		}
+	}
+	proxy.Spanner().Tracer().Close()
+
+	data, err := ioutil.ReadFile(file)
+	assert.Nil(t, err)
+	got := string(data)
+	lines := strings.Split(strings.TrimSpace(got), "\n")
+	assert.True(t, strings.HasPrefix(got, "trace "), got)
+	assert.Equal(t, 0, strings.Count(got, "\ntrace "), got)
+	assert.True(t, strings.HasPrefix(lines[1], "  query "), got)
+	assert.True(t, strings.HasPrefix(lines[2], "    optimizer.build "), got)
+	assert.True(t, strings.HasPrefix(lines[3], "    executor.select "), got)
+	assert.True(t, strings.HasPrefix(lines[4], "      engine.join "), got)
+	assert.True(t, strings.HasPrefix(lines[5], "        engine.merge "), got)
+	assert.True(t, strings.HasPrefix(lines[6], "          backend.execute "), got)
+	assert.Equal(t, 2, strings.Count(got, "engine.merge "), got)
+}
@@ -0,0 +1,143 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+
+	"config"
+	"planner/builder"
+
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+// handleView used to handle the CREATE/ALTER/DROP VIEW, the views are stored in the router
+// rather than the backends, the references are expanded to the derived tables when planned.
+func (spanner *Spanner) handleView(database string, ddl *sqlparser.DDL) (*sqltypes.Result, error) {
+	route := spanner.router
+
+	switch ddl.Action {
+	case sqlparser.CreateViewStr, sqlparser.AlterViewStr:
+		if err := route.CheckDatabase(database); err != nil {
+			return nil, err
+		}
+		name := ddl.Table.Name.String()
+		if ddl.Action == sqlparser.CreateViewStr {
+			// The table and view share the namespace.
+			if checkTableExists(database, name, route) || (!ddl.OrReplace && route.View(database, name) != nil) {
+				return nil, sqldb.NewSQLError(sqldb.ER_TABLE_EXISTS_ERROR, name)
+			}
+		}
+		view := &config.ViewConfig{
+			Name:  name,
+			Query: sqlparser.String(ddl.ViewSelect),
+		}
+		for _, column := range ddl.ViewColumns {
+			view.Columns = append(view.Columns, column.String())
+		}
+		if err := builder.CheckView(spanner.log, route, database, view); err != nil {
+			return nil, err
+		}
+
+		if ddl.Action == sqlparser.AlterViewStr {
+			if err := route.AlterView(database, view); err != nil {
+				return nil, err
+			}
+		} else if err := route.CreateView(database, view, ddl.OrReplace); err != nil {
+			return nil, err
+		}
+	case sqlparser.DropViewStr:
+		for _, tableIdent := range ddl.Tables {
+			db := database
+			if !tableIdent.Qualifier.IsEmpty() {
+				db = tableIdent.Qualifier.String()
+			}
+			view := tableIdent.Name.String()
+			if err := route.CheckDatabase(db); err != nil {
+				return nil, err
+			}
+			if ddl.IfExists && route.View(db, view) == nil {
+				continue
+			}
+			if err := route.DropView(db, view); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &sqltypes.Result{}, nil
+}
+
+// handleShowCreateView used to handle the 'SHOW CREATE VIEW' command.
+func (spanner *Spanner) handleShowCreateView(session *driver.Session, query string, node *sqlparser.Show) (*sqltypes.Result, error) {
+	route := spanner.router
+
+	name := node.Table.Name.String()
+	database := session.Schema()
+	if !node.Table.Qualifier.IsEmpty() {
+		database = node.Table.Qualifier.String()
+	}
+	if database == "" {
+		return nil, sqldb.NewSQLError(sqldb.ER_NO_DB_ERROR)
+	}
+	// Check the database ACL.
+	if err := route.DatabaseACL(database); err != nil {
+		return nil, err
+	}
+
+	view := route.View(database, name)
+	if view == nil {
+		if checkTableExists(database, name, route) {
+			return nil, sqldb.NewSQLError(sqldb.ER_WRONG_OBJECT, fmt.Sprintf("%s.%s", database, name), "VIEW")
+		}
+		return nil, sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, fmt.Sprintf("%s.%s", database, name))
+	}
+	create, err := createViewSQL(view)
+	if err != nil {
+		return nil, err
+	}
+
+	qr := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "View", Type: querypb.Type_VARCHAR},
+			{Name: "Create View", Type: querypb.Type_VARCHAR},
+			{Name: "character_set_client", Type: querypb.Type_VARCHAR},
+			{Name: "collation_connection", Type: querypb.Type_VARCHAR},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(view.Name)),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(create)),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("utf8")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("utf8_general_ci")),
+			},
+		},
+	}
+	return qr, nil
+}
+
+// createViewSQL returns the CREATE VIEW statement of the view.
+func createViewSQL(view *config.ViewConfig) (string, error) {
+	stmt, err := sqlparser.Parse(view.Query)
+	if err != nil {
+		return "", err
+	}
+	ddl := &sqlparser.DDL{
+		Action:     sqlparser.CreateViewStr,
+		NewName:    sqlparser.TableName{Name: sqlparser.NewTableIdent(view.Name)},
+		ViewSelect: stmt.(sqlparser.SelectStatement),
+	}
+	for _, column := range view.Columns {
+		ddl.ViewColumns = append(ddl.ViewColumns, sqlparser.NewColIdent(column))
+	}
+	return sqlparser.String(ddl), nil
+}
@@ -0,0 +1,200 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyView(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("show tables from .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id)",
+		"create table test.t2(id int, c int) global",
+		"use test",
+		"create view v1 as select id, b from t1 where id = 1",
+		"create view test.v2(x) as select c from t2",
+		"create or replace view v2(y) as select c from t2",
+		"alter view v1(a, b) as select id, b from t1",
+	}
+	for _, query := range querys {
+		_, err := client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	// show full tables.
+	{
+		qr, err := client.FetchAll("show tables", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 4, len(qr.Rows))
+
+		qr, err = client.FetchAll("show full tables", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, "Table_type", qr.Fields[1].Name)
+		types := make(map[string]string)
+		for _, row := range qr.Rows {
+			types[row[0].String()] = row[1].String()
+		}
+		want := map[string]string{"t1": "BASE TABLE", "t2": "BASE TABLE", "v1": "VIEW", "v2": "VIEW"}
+		assert.Equal(t, want, types)
+	}
+
+	// show create view.
+	{
+		qr, err := client.FetchAll("show create view test.v2", -1)
+		assert.Nil(t, err)
+		want := "[[v2 create view v2(y) as select c from t2 utf8 utf8_general_ci]]"
+		assert.Equal(t, want, fmt.Sprintf("%+v", qr.Rows))
+
+		qr, err = client.FetchAll("show create table v1", -1)
+		assert.Nil(t, err)
+		want = "[[v1 create view v1(a, b) as select id, b from t1 utf8 utf8_general_ci]]"
+		assert.Equal(t, want, fmt.Sprintf("%+v", qr.Rows))
+	}
+
+	// select from the view.
+	{
+		result := &sqltypes.Result{
+			Fields: []*querypb.Field{{Name: "y", Type: querypb.Type_INT32}},
+			Rows: [][]sqltypes.Value{
+				{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("3"))},
+			},
+		}
+		fakedbs.AddQueryPattern("select \\* from \\(select c as y from test.t2\\) as v2", result)
+		qr, err := client.FetchAll("select * from v2", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, "[[3]]", fmt.Sprintf("%+v", qr.Rows))
+	}
+
+	// drop view.
+	{
+		querys := []string{
+			"drop view v1",
+			"drop view if exists test.v1, v2",
+		}
+		for _, query := range querys {
+			_, err := client.FetchAll(query, -1)
+			assert.Nil(t, err, query)
+		}
+		qr, err := client.FetchAll("show full tables", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(qr.Rows))
+	}
+}
+
+func TestProxyViewError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id)",
+		"create view test.v1 as select id from test.t1",
+	}
+	for _, query := range querys {
+		_, err := client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	tcases := []struct {
+		query string
+		err   string
+	}{
+		{
+			query: "create view v2 as select 1",
+			err:   "No database selected (errno 1046) (sqlstate 3D000)",
+		},
+		{
+			query: "create view xx.v2 as select 1",
+			err:   "Unknown database 'xx' (errno 1049) (sqlstate 42000)",
+		},
+		{
+			query: "create view test.v1 as select b from test.t1",
+			err:   "Table 'v1' already exists (errno 1050) (sqlstate 42S01)",
+		},
+		{
+			query: "create view test.t1 as select b from test.t1",
+			err:   "Table 't1' already exists (errno 1050) (sqlstate 42S01)",
+		},
+		{
+			query: "create view test.v2 as select b from test.t2",
+			err:   "Table 't2' doesn't exist (errno 1146) (sqlstate 42S02)",
+		},
+		{
+			query: "create view test.v2(a, b) as select b from test.t1",
+			err:   "unsupported: view.'v2'.has.a.different.number.of.columns (errno 1105) (sqlstate HY000)",
+		},
+		{
+			query: "alter view test.v1 as select * from test.v1",
+			err:   "view.'test.v1'.contains.view.recursion (errno 1105) (sqlstate HY000)",
+		},
+		{
+			query: "alter view test.v2 as select b from test.t1",
+			err:   "Table 'v2' doesn't exist (errno 1146) (sqlstate 42S02)",
+		},
+		{
+			query: "drop view test.v2",
+			err:   "Unknown table 'test.v2' (errno 1051) (sqlstate 42S02)",
+		},
+		{
+			query: "show create view test.t1",
+			err:   "'test.t1' is not VIEW (errno 1347) (sqlstate HY000)",
+		},
+		{
+			query: "show create view test.v2",
+			err:   "Table 'test.v2' doesn't exist (errno 1146) (sqlstate 42S02)",
+		},
+		{
+			query: "create table test.v1(id int, b int) partition by hash(id)",
+			err:   "Table 'v1' already exists (errno 1050) (sqlstate 42S01)",
+		},
+	}
+	for _, tcase := range tcases {
+		_, err := client.FetchAll(tcase.query, -1)
+		assert.NotNil(t, err, tcase.query)
+		if err != nil {
+			assert.Equal(t, tcase.err, err.Error(), tcase.query)
+		}
+	}
+}
@@ -75,7 +75,7 @@ func main() {
 	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
 	log.Info("radon.signal:%+v", <-ch)
 
-	// Stop the proxy and httpserver.
-	proxy.Stop()
+	// Stop the httpserver and proxy, the admin calls are audited by the proxy.
 	admin.Stop()
+	proxy.Stop()
 }
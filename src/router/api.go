@@ -10,6 +10,7 @@ package router
 
 import (
 	"config"
+	"metastore"
 
 	"github.com/pkg/errors"
 )
@@ -129,7 +130,7 @@ func (r *Router) changeTheRuleBackend(fromBackend string, toBackend string, data
 	}
 
 	// 3. Flush table config to disk.
-	if err := r.writeTableFrmData(database, table, tableConfig); err != nil {
+	if err := r.writeTableFrmData(database, table, tableConfig, r.revision(tableKey(database, table))); err != nil {
 		// Memory config reset.
 		if tableConfig.ShardType == "GLOBAL" {
 			tableConfig.Partitions = append(tableConfig.Partitions[:(len(tableConfig.Partitions) - 1)])
@@ -140,7 +141,7 @@ func (r *Router) changeTheRuleBackend(fromBackend string, toBackend string, data
 	}
 
 	// 4. Update the version.
-	if err := config.UpdateVersion(r.metadir); err != nil {
+	if err := metastore.UpdateVersion(r.store); err != nil {
 		log.Panicf("change.the.rule.table.update.version.error:%v", err)
 		return "", err
 	}
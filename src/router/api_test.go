@@ -11,6 +11,8 @@ package router
 import (
 	"testing"
 
+	"metastore"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
@@ -317,7 +319,7 @@ func TestApiPartitionRuleShiftErrors(t *testing.T) {
 
 	// writeFrmData err.
 	{
-		router.metadir = "/u100000/xx"
+		router.store = metastore.NewFileStore("/u100000/xx")
 		from := "backend8"
 		to := "backend4"
 		database := "sbtest"
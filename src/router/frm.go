@@ -10,12 +10,10 @@ package router
 
 import (
 	"fmt"
-	"io/ioutil"
-	"os"
-	"path"
 	"strings"
 
 	"config"
+	"metastore"
 
 	"github.com/pkg/errors"
 	"github.com/xelabs/go-mysqlstack/sqldb"
@@ -37,87 +35,108 @@ const (
 	TABLE_NAME_SUFFIX = 5 // table name suffix: "_0032"
 )
 
-// writeTableFrmData used to write table's json schema to file.
-// The file name is : [schema-dir]/[database]/[table].json.
-// If the [schema-dir]/[database] directoryis not exists, we will create it first.
-func (r *Router) writeTableFrmData(db string, table string, tconf *config.TableConfig) error {
+// tableKey returns the store key of the table: [database]/[table].json.
+func tableKey(db string, table string) string {
+	return fmt.Sprintf("%s/%s.json", db, table)
+}
+
+// databaseKey returns the store dir key of the database: [database]/.
+func databaseKey(db string) string {
+	return db + "/"
+}
+
+// revision returns the revision of the key read or written by the router,
+// metastore.RevisionNotExist if the key is unknown.
+func (r *Router) revision(key string) int64 {
+	if rev, ok := r.revisions[key]; ok {
+		return rev
+	}
+	return metastore.RevisionNotExist
+}
+
+// writeTableFrmData used to write table's json schema to the store if the revision matches.
+// The key is : [database]/[table].json.
+func (r *Router) writeTableFrmData(db string, table string, tconf *config.TableConfig, revision int64) error {
 	log := r.log
-	dir := path.Join(r.metadir, db)
 	if tconf == nil {
 		return errors.New("table.config..can't.be.nil")
 	}
 
 	log.Info("frm.write.data[db:%s, table:%s, shardType:%s]", db, table, tconf.ShardType)
-	file := path.Join(dir, fmt.Sprintf("%s.json", table))
-	if err := config.WriteConfig(file, tconf); err != nil {
-		log.Error("frm.write.to.file[%v].error:%v", file, err)
+	key := tableKey(db, table)
+	data, err := config.MarshalConfig(tconf)
+	if err != nil {
 		return err
 	}
+	rev, err := r.store.Put(key, data, revision)
+	if err != nil {
+		log.Error("frm.write.to.store[%v].error:%v", key, err)
+		return err
+	}
+	r.revisions[key] = rev
 	return nil
 }
 
-// removeTableFrmData used to remove table json file.
+// removeTableFrmData used to remove table json from the store.
 func (r *Router) removeTableFrmData(db string, table string) error {
 	log := r.log
-	dir := path.Join(r.metadir, db)
-	file := path.Join(dir, fmt.Sprintf("%s.json", table))
-	log.Warning("frm.remove.file[%v].for.[db:%s, table:%s]", file, db, table)
-	return os.Remove(file)
+	key := tableKey(db, table)
+	log.Warning("frm.remove.key[%v].for.[db:%s, table:%s]", key, db, table)
+	if err := r.store.Delete(key, r.revision(key)); err != nil {
+		return err
+	}
+	delete(r.revisions, key)
+	return nil
 }
 
-// readTableFrmData used to read json file to TableConfig.
-func (r *Router) readTableFrmData(file string) (*config.TableConfig, error) {
+// readTableFrmData used to read the json of the key to TableConfig.
+func (r *Router) readTableFrmData(key string) (*config.TableConfig, error) {
 	log := r.log
-	data, err := ioutil.ReadFile(file)
+	kv, err := r.store.Get(key)
 	if err != nil {
-		log.Error("frm.read.from.file[%v].error:%v", file, err)
+		log.Error("frm.read.from.store[%v].error:%v", key, err)
 		return nil, err
 	}
-	conf, err := config.ReadTableConfig(string(data))
+	conf, err := config.ReadTableConfig(string(kv.Value))
 	if err != nil {
-		log.Error("frm.read.parse.json.file[%v].error:%v", file, err)
+		log.Error("frm.read.parse.json[%v].error:%v", key, err)
 		return nil, err
 	}
+	r.revisions[key] = kv.Revision
 	return conf, nil
 }
 
-// loadTableFromFile used to add a table read from the json file.
-func (r *Router) loadTableFromFile(db, file string) error {
+// loadTableFromStore used to add a table read from the store.
+func (r *Router) loadTableFromStore(db, key string) error {
 	log := r.log
-	log.Info("frm.load.table.from.file:%v", file)
+	log.Info("frm.load.table.from.store:%v", key)
 
-	conf, err := r.readTableFrmData(file)
+	conf, err := r.readTableFrmData(key)
 	if err != nil {
-		log.Error("frm.load.table.read.file[%v].error:%+v", file, err)
+		log.Error("frm.load.table.read[%v].error:%+v", key, err)
 		return err
 	}
 	if err := r.addTable(db, conf); err != nil {
-		log.Error("frm.load.table.add.router[%v].error:%+v", file, err)
+		log.Error("frm.load.table.add.router[%v].error:%+v", key, err)
 		return err
 	}
 	return nil
 }
 
-// loadTable used to add a table read from the json file.
+// loadTable used to add a table read from the store.
 func (r *Router) loadTable(db string, table string) error {
 	log := r.log
 	log.Warning("frm.load.table[db:%s, table:%s]", db, table)
-
-	dir := path.Join(r.metadir, db)
-	file := path.Join(dir, fmt.Sprintf("%s.json", table))
-	return r.loadTableFromFile(db, file)
+	return r.loadTableFromStore(db, tableKey(db, table))
 }
 
 func (r *Router) writeDatabaseFrmData(db string) error {
 	log := r.log
-	dir := path.Join(r.metadir, db)
+	key := databaseKey(db)
 	log.Info("frm.write.database[db:%s]", db)
-	// Create dir.
-	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		if x := os.MkdirAll(dir, os.ModePerm); x != nil {
-			log.Error("frm.write.mkdir[%v].error:%v", dir, err)
-			return x
-		}
+	if _, err := r.store.Put(key, nil, metastore.RevisionNotExist); err != nil {
+		log.Error("frm.write.database[%v].error:%v", key, err)
+		return err
 	}
 	return nil
 }
@@ -146,7 +165,7 @@ func (r *Router) CreateDatabase(db string) error {
 		}
 		return err
 	}
-	if err := config.UpdateVersion(r.metadir); err != nil {
+	if err := metastore.UpdateVersion(r.store); err != nil {
 		log.Panicf("frm.create.table.update.version.error:%v", err)
 		return err
 	}
@@ -160,27 +179,59 @@ func (r *Router) DropDatabase(db string) error {
 	defer r.mu.Unlock()
 
 	log := r.log
+	// The tables must not be changed by others.
+	key := databaseKey(db)
+	revision, err := r.checkRevisions(key)
+	if err != nil {
+		log.Error("frm.drop.database[%v].check.revisions.error:%v", key, err)
+		return err
+	}
+
 	// Drop database from route.
 	if err := r.dropDatabase(db); err != nil {
 		return err
 	}
 
-	// Delete database dir.
-	dir := path.Join(r.metadir, db)
-	log.Info("frm.drop.database.file[%v]", dir)
-	if err := os.RemoveAll(dir); err != nil {
-		r.log.Error("frm.drop.database[%v].error:%v", dir, err)
+	// Delete the database and its tables.
+	log.Info("frm.drop.database.key[%v]", key)
+	if err := r.store.Delete(key, revision); err != nil && err != metastore.ErrNotFound {
+		r.log.Error("frm.drop.database[%v].error:%v", key, err)
 		return err
 	}
+	for name := range r.revisions {
+		if strings.HasPrefix(name, key) {
+			delete(r.revisions, name)
+		}
+	}
 
 	// Update version.
-	if err := config.UpdateVersion(r.metadir); err != nil {
+	if err := metastore.UpdateVersion(r.store); err != nil {
 		log.Panicf("frm.drop.database.update.version.error:%v", err)
 		return err
 	}
 	return nil
 }
 
+// checkRevisions returns metastore.ErrConflict if the keys under the dir key are changed since they're read
+// by the router, the revision of the dir key is returned, metastore.RevisionAny if it does not exist.
+func (r *Router) checkRevisions(dir string) (int64, error) {
+	kvs, err := r.store.List(dir)
+	if err != nil {
+		return 0, err
+	}
+	revision := metastore.RevisionAny
+	for _, kv := range kvs {
+		switch {
+		case kv.Key == dir:
+			revision = kv.Revision
+		case metastore.IsDir(kv.Key) || metastore.IsHistoryKey(kv.Key):
+		case kv.Revision != r.revision(kv.Key):
+			return 0, metastore.ErrConflict
+		}
+	}
+	return revision, nil
+}
+
 // CheckDatabase is used to check the Database exist.
 func (r *Router) CheckDatabase(db string) error {
 	r.mu.Lock()
@@ -277,6 +328,7 @@ func (r *Router) CreateHashTable(db, table, shardKey string, tableType string, b
 
 	if extra != nil {
 		tableConf.AutoIncrement = extra.AutoIncrement
+		tableConf.ShardKeyDefault = extra.ShardKeyDefault
 	}
 
 	return r.createTable(db, table, tableConf)
@@ -304,6 +356,7 @@ func (r *Router) CreateListTable(db, table, shardKey string, tableType string,
 
 	if extra != nil {
 		tableConf.AutoIncrement = extra.AutoIncrement
+		tableConf.ShardKeyDefault = extra.ShardKeyDefault
 	}
 
 	return r.createTable(db, table, tableConf)
@@ -333,19 +386,26 @@ func (r *Router) createTable(db, table string, tableConf *config.TableConfig) er
 		return errors.Errorf("invalid.table.name.currently.not.support.tablename[%v].contains.with.char:'/' or space ' '", table)
 	}
 
+	// The table and view share the namespace.
+	if schema, ok := r.Schemas[db]; ok {
+		if _, ok := schema.Views[table]; ok {
+			return sqldb.NewSQLError(sqldb.ER_TABLE_EXISTS_ERROR, table)
+		}
+	}
+
 	// add config to router.
 	if err = r.addTable(db, tableConf); err != nil {
 		log.Error("frm.create.add.route.error:%v", err)
 		return err
 	}
-	if err = r.writeTableFrmData(db, table, tableConf); err != nil {
+	if err = r.writeTableFrmData(db, table, tableConf, metastore.RevisionNotExist); err != nil {
 		// clear db/table cache in memory
 		r.removeTable(db, table)
 		log.Error("frm.create.table[db:%v, table:%v].file.error:%+v", db, tableConf.Name, err)
 		return err
 	}
 
-	if err = config.UpdateVersion(r.metadir); err != nil {
+	if err = metastore.UpdateVersion(r.store); err != nil {
 		log.Panicf("frm.create.table.update.version.error:%v", err)
 		return err
 	}
@@ -364,10 +424,14 @@ func (r *Router) DropTable(db, table string) error {
 	}
 	if err := r.removeTableFrmData(db, table); err != nil {
 		log.Error("frm.drop.table[%s.%s].remove.frmdata.error:%v", db, table, err)
+		// The table is changed by others, reload it from the store.
+		if err == metastore.ErrConflict {
+			r.loadTable(db, table)
+		}
 		return err
 	}
 
-	if err := config.UpdateVersion(r.metadir); err != nil {
+	if err := metastore.UpdateVersion(r.store); err != nil {
 		log.Panicf("frm.drop.table.update.version.error:%v", err)
 		return err
 	}
@@ -382,10 +446,14 @@ func (r *Router) dropTable(db, table string) error {
 	}
 	if err := r.removeTableFrmData(db, table); err != nil {
 		log.Error("frm.drop.table[%s.%s].remove.frmdata.error:%v", db, table, err)
+		// The table is changed by others, reload it from the store.
+		if err == metastore.ErrConflict {
+			r.loadTable(db, table)
+		}
 		return err
 	}
 
-	if err := config.UpdateVersion(r.metadir); err != nil {
+	if err := metastore.UpdateVersion(r.store); err != nil {
 		log.Panicf("frm.drop.table.update.version.error:%v", err)
 		return err
 	}
@@ -417,6 +485,84 @@ func (r *Router) RenameTable(db, fromTable, toTable string) error {
 	return nil
 }
 
+// SwapTable used to replace the partitions of the table with the tmpTable's, the tmpTable is removed.
+// The physical tables of the tmpTable are kept as the new partitions, the old ones are left to the caller.
+func (r *Router) SwapTable(db, table, tmpTable string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log := r.log
+	schema, ok := r.Schemas[db]
+	if !ok {
+		return errors.Errorf("router.can.not.find.db[%v]", db)
+	}
+	old, ok := schema.Tables[table]
+	if !ok {
+		return errors.Errorf("router.can.not.find.table[%v]", table)
+	}
+	tmp, ok := schema.Tables[tmpTable]
+	if !ok {
+		return errors.Errorf("router.can.not.find.table[%v]", tmpTable)
+	}
+
+	tableConfig := *tmp.TableConfig
+	tableConfig.Name = table
+	delete(schema.Tables, table)
+	delete(schema.Tables, tmpTable)
+	if err := r.addTable(db, &tableConfig); err != nil {
+		log.Error("frm.swap.table[%s.%s->%s].add.route.error:%v", db, tmpTable, table, err)
+		schema.Tables[table] = old
+		schema.Tables[tmpTable] = tmp
+		return err
+	}
+	if err := r.writeTableFrmData(db, table, &tableConfig, r.revision(tableKey(db, table))); err != nil {
+		log.Error("frm.swap.table[%s.%s->%s].file.error:%v", db, tmpTable, table, err)
+		schema.Tables[table] = old
+		schema.Tables[tmpTable] = tmp
+		return err
+	}
+	if err := r.removeTableFrmData(db, tmpTable); err != nil {
+		log.Error("frm.swap.table[%s.%s->%s].remove.frmdata.error:%v", db, tmpTable, table, err)
+	}
+
+	if err := metastore.UpdateVersion(r.store); err != nil {
+		log.Panicf("frm.swap.table.update.version.error:%v", err)
+		return err
+	}
+	return nil
+}
+
+// SetTableFence used to set the reshard ddl job which fences the writes to the table, 0 to release.
+// The fence is kept in the table config so that it's synced to the peers.
+// Lock.
+func (r *Router) SetTableFence(db, table string, job uint64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log := r.log
+	schema, ok := r.Schemas[db]
+	if !ok {
+		return errors.Errorf("router.can.not.find.db[%v]", db)
+	}
+	t, ok := schema.Tables[table]
+	if !ok {
+		return errors.Errorf("router.can.not.find.table[%v]", table)
+	}
+	tableConfig := *t.TableConfig
+	tableConfig.WriteFence = job
+	if err := r.writeTableFrmData(db, table, &tableConfig, r.revision(tableKey(db, table))); err != nil {
+		log.Error("frm.set.table[%s.%s].fence[%d].file.error:%v", db, table, job, err)
+		return err
+	}
+	t.TableConfig = &tableConfig
+
+	if err := metastore.UpdateVersion(r.store); err != nil {
+		log.Panicf("frm.set.table.fence.update.version.error:%v", err)
+		return err
+	}
+	return nil
+}
+
 // RefreshTable used to re-update the table from file.
 // Lock.
 func (r *Router) RefreshTable(db, table string) error {
@@ -445,49 +591,47 @@ func (r *Router) LoadConfig() error {
 	// Clear the router first.
 	r.clear()
 
-	// Check the schemadir, create it if not exists.
-	if _, err := os.Stat(r.metadir); os.IsNotExist(err) {
-		if x := os.MkdirAll(r.metadir, os.ModePerm); x != nil {
-			log.Error("router.load.create.dir[%v].error:%v", r.metadir, x)
-			return x
-		}
-		return nil
-	}
-
-	frms := make(map[string][]string)
-	files, err := ioutil.ReadDir(r.metadir)
+	kvs, err := r.store.List("")
 	if err != nil {
-		log.Error("router.load.readdir[%v].error:%v", r.metadir, err)
+		log.Error("router.load.list.store.error:%v", err)
 		return err
 	}
-	for _, f := range files {
-		if f.IsDir() {
-			dbName := f.Name()
-			jsons := []string{}
-			subdir := path.Join(r.metadir, dbName)
-			subFiles, err := ioutil.ReadDir(subdir)
-			if err != nil {
-				log.Error("router.load.readsubdir[%v].error:%v", subdir, err)
-				return err
-			}
-			for _, subFile := range subFiles {
-				if !subFile.IsDir() {
-					jsons = append(jsons, path.Join(subdir, subFile.Name()))
-				}
-			}
-			frms[dbName] = jsons
 
+	// The databases are the dir keys '[database]/', the tables are the keys '[database]/[table].json',
+	// the views are the keys '[database]/views/[view].json'.
+	frms := make(map[string][]string)
+	views := make(map[string][]string)
+	for _, kv := range kvs {
+		idx := strings.Index(kv.Key, "/")
+		if idx <= 0 || metastore.IsHistoryKey(kv.Key) {
+			continue
+		}
+		dbName := kv.Key[:idx]
+		switch rest := kv.Key[idx+1:]; {
+		case rest == "":
 			// Add database to router.
 			if err := r.addDatabase(dbName); err != nil {
 				return err
 			}
+		case !strings.Contains(rest, "/"):
+			frms[dbName] = append(frms[dbName], kv.Key)
+		case strings.HasPrefix(rest, "views/") && !metastore.IsDir(rest):
+			views[dbName] = append(views[dbName], kv.Key)
 		}
 	}
 
 	for k, v := range frms {
-		for _, file := range v {
-			if err := r.loadTableFromFile(k, file); err != nil {
-				log.Error("router.load.table..from.file[%v].error:%+v", file, err)
+		for _, key := range v {
+			if err := r.loadTableFromStore(k, key); err != nil {
+				log.Error("router.load.table..from.store[%v].error:%+v", key, err)
+				return err
+			}
+		}
+	}
+	for k, v := range views {
+		for _, key := range v {
+			if err := r.loadViewFromStore(k, key); err != nil {
+				log.Error("router.load.view.from.store[%v].error:%+v", key, err)
 				return err
 			}
 		}
@@ -15,6 +15,7 @@ import (
 	"testing"
 
 	"config"
+	"metastore"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
@@ -22,7 +23,7 @@ import (
 )
 
 func checkFileExistsForTest(router *Router, db, table string) bool {
-	file := path.Join(router.metadir, db, fmt.Sprintf("%s.json", table))
+	file := path.Join(router.store.(*metastore.FileStore).Dir(), db, fmt.Sprintf("%s.json", table))
 	if _, err := os.Stat(file); err != nil {
 		return false
 	}
@@ -30,7 +31,7 @@ func checkFileExistsForTest(router *Router, db, table string) bool {
 }
 
 func makeFileBrokenForTest(router *Router, db, table string) {
-	file := path.Join(router.metadir, db, fmt.Sprintf("%s.json", table))
+	file := path.Join(router.store.(*metastore.FileStore).Dir(), db, fmt.Sprintf("%s.json", table))
 	fd, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
 	if err != nil {
 		panic(err)
@@ -50,9 +51,12 @@ func TestFrmTable(t *testing.T) {
 	{
 		tmpRouter := router
 		backends := []string{"backend1", "backend2", "backend3"}
-		err := router.CreateHashTable("test", "t1", "id", TableTypePartitionHash, backends, nil, &Extra{&config.AutoIncrement{"id"}})
+		err := router.CreateHashTable("test", "t1", "id", TableTypePartitionHash, backends, nil, &Extra{AutoIncrement: &config.AutoIncrement{"id"}, ShardKeyDefault: "'a'"})
 		assert.Nil(t, err)
 		assert.True(t, checkFileExistsForTest(tmpRouter, "test", "t1"))
+		tconf, err := router.TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, "'a'", tconf.ShardKeyDefault)
 	}
 
 	// Add 2.
@@ -88,7 +92,7 @@ func TestFrmTable(t *testing.T) {
 	// Add global table.
 	{
 		backends := []string{"backend1", "backend2"}
-		err := router.CreateNonPartTable("test", "t3", TableTypeGlobal, backends, &Extra{&config.AutoIncrement{"id"}})
+		err := router.CreateNonPartTable("test", "t3", TableTypeGlobal, backends, &Extra{AutoIncrement: &config.AutoIncrement{"id"}})
 		assert.Nil(t, err)
 	}
 
@@ -216,7 +220,7 @@ func TestFrmTableError(t *testing.T) {
 
 	// Drop table.
 	{
-		router.metadir = "/u00000000001/"
+		router.store = metastore.NewFileStore("/u00000000001/")
 		err := router.DropTable("test", "t1")
 		assert.NotNil(t, err)
 	}
@@ -313,8 +317,8 @@ func TestFrmWriteFrmError(t *testing.T) {
 	router, cleanup := MockNewRouter(log)
 	defer cleanup()
 	{
-		router.metadir = "/u100000/xx"
-		err := router.writeTableFrmData("test", "t1", nil)
+		router.store = metastore.NewFileStore("/u100000/xx")
+		err := router.writeTableFrmData("test", "t1", nil, metastore.RevisionAny)
 		assert.NotNil(t, err)
 	}
 }
@@ -464,7 +468,7 @@ func TestFrmTableRenameError(t *testing.T) {
 		db := "test"
 		fromTable := "t2"
 		toTable := "t3"
-		dir := path.Join(router.metadir, db)
+		dir := path.Join(router.store.(*metastore.FileStore).Dir(), db)
 		file := path.Join(dir, fmt.Sprintf("%s.json", fromTable))
 		os.Remove(file)
 		err := router.RenameTable(db, fromTable, toTable)
@@ -475,7 +479,7 @@ func TestFrmTableRenameError(t *testing.T) {
 		db := "test"
 		fromTable := "t1"
 		toTable := "t4"
-		dir := path.Join(router.metadir, db)
+		dir := path.Join(router.store.(*metastore.FileStore).Dir(), db)
 		file := path.Join(dir, fmt.Sprintf("%s.json", toTable))
 		_, err := os.Create(file)
 		err = os.Chmod(file, 0400)
@@ -485,6 +489,95 @@ func TestFrmTableRenameError(t *testing.T) {
 	}
 }
 
+func TestFrmTableSwap(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	router.CreateDatabase("test")
+	backends := []string{"backend1", "backend2", "backend3"}
+	err := router.CreateHashTable("test", "t1", "id", TableTypePartitionHash, backends, nil, nil)
+	assert.Nil(t, err)
+	err = router.CreateNonPartTable("test", "t1_reshard_1", TableTypeGlobal, backends, nil)
+	assert.Nil(t, err)
+
+	// Swap.
+	{
+		err := router.SwapTable("test", "t1", "t1_reshard_1")
+		assert.Nil(t, err)
+		assert.True(t, checkFileExistsForTest(router, "test", "t1"))
+		assert.False(t, checkFileExistsForTest(router, "test", "t1_reshard_1"))
+
+		tconf, err := router.TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, "t1", tconf.Name)
+		assert.Equal(t, methodTypeGlobal, tconf.ShardType)
+		assert.Equal(t, 3, len(tconf.Partitions))
+		assert.Equal(t, "t1_reshard_1", tconf.Partitions[0].Table)
+
+		_, err = router.TableConfig("test", "t1_reshard_1")
+		assert.NotNil(t, err)
+	}
+
+	// Reload from the files.
+	{
+		err := router.LoadConfig()
+		assert.Nil(t, err)
+		tconf, err := router.TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, methodTypeGlobal, tconf.ShardType)
+	}
+
+	// Errors.
+	{
+		err := router.SwapTable("xx", "t1", "t1_reshard_1")
+		assert.NotNil(t, err)
+		err = router.SwapTable("test", "t2", "t1")
+		assert.NotNil(t, err)
+		err = router.SwapTable("test", "t1", "t1_reshard_1")
+		assert.NotNil(t, err)
+	}
+}
+
+func TestFrmTableFence(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	router.CreateDatabase("test")
+	backends := []string{"backend1", "backend2", "backend3"}
+	err := router.CreateHashTable("test", "t1", "id", TableTypePartitionHash, backends, nil, nil)
+	assert.Nil(t, err)
+	err = router.CreateNonPartTable("test", "t1_reshard_1", TableTypeGlobal, backends, nil)
+	assert.Nil(t, err)
+
+	// The fence is kept in the file.
+	{
+		err := router.SetTableFence("test", "t1", 1)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(1), router.TableFence("test", "t1"))
+		err = router.LoadConfig()
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(1), router.TableFence("test", "t1"))
+	}
+
+	// The fence is gone with the swap.
+	{
+		err := router.SwapTable("test", "t1", "t1_reshard_1")
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(0), router.TableFence("test", "t1"))
+	}
+
+	// Errors.
+	{
+		err := router.SetTableFence("xx", "t1", 1)
+		assert.NotNil(t, err)
+		err = router.SetTableFence("test", "t2", 1)
+		assert.NotNil(t, err)
+		assert.Equal(t, uint64(0), router.TableFence("test", "t2"))
+	}
+}
+
 func TestFrmCheckDatabase(t *testing.T) {
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
 	router, cleanup := MockNewRouter(log)
@@ -570,7 +663,7 @@ func TestFrmTableCreateListTable(t *testing.T) {
 		err = router.CreateListTable("test", "l", "id", TableTypePartitionList, sqlparser.PartitionDefinitions{}, nil)
 		assert.NotNil(t, err)
 
-		err = router.CreateListTable("test", "l", "id", TableTypePartitionList, partitionDef, &Extra{&config.AutoIncrement{"id"}})
+		err = router.CreateListTable("test", "l", "id", TableTypePartitionList, partitionDef, &Extra{AutoIncrement: &config.AutoIncrement{"id"}})
 		assert.NotNil(t, err)
 	}
 }
@@ -589,3 +682,54 @@ func TestCreateDatabaseError(t *testing.T) {
 	err = router.CreateDatabase("t0123456789012345678901234567890123456789012345678901234567890123")
 	assert.EqualError(t, err, "Identifier name 't0123456789012345678901234567890123456789012345678901234567890123' is too long (errno 1059) (sqlstate 42000)")
 }
+
+func TestFrmRevisionConflict(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	err := router.CreateDatabase("test")
+	assert.Nil(t, err)
+	err = router.CreateHashTable("test", "t1", "id", TableTypePartitionHash, []string{"backend1"}, nil, nil)
+	assert.Nil(t, err)
+	store := router.MetaStore()
+
+	// The table is changed by others.
+	{
+		kv, err := store.Get("test/t1.json")
+		assert.Nil(t, err)
+		_, err = store.Put("test/t1.json", append(kv.Value, '\n'), kv.Revision)
+		assert.Nil(t, err)
+
+		err = router.DropDatabase("test")
+		assert.Equal(t, metastore.ErrConflict, err)
+		assert.Nil(t, router.CheckDatabase("test"))
+
+		// The table is reloaded after the conflict.
+		err = router.DropTable("test", "t1")
+		assert.Equal(t, metastore.ErrConflict, err)
+		_, err = router.TableConfig("test", "t1")
+		assert.Nil(t, err)
+	}
+
+	// The table is created by others.
+	{
+		_, err := store.Put("test/t2.json", []byte("{}"), metastore.RevisionNotExist)
+		assert.Nil(t, err)
+		err = router.CreateHashTable("test", "t2", "id", TableTypePartitionHash, []string{"backend1"}, nil, nil)
+		assert.Equal(t, metastore.ErrConflict, err)
+		_, err = router.TableConfig("test", "t2")
+		assert.NotNil(t, err)
+		assert.Nil(t, store.Delete("test/t2.json", metastore.RevisionAny))
+	}
+
+	// The revisions are refreshed by the reload.
+	{
+		err := router.LoadConfig()
+		assert.Nil(t, err)
+		err = router.DropTable("test", "t1")
+		assert.Nil(t, err)
+		err = router.DropDatabase("test")
+		assert.Nil(t, err)
+	}
+}
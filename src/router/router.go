@@ -14,6 +14,7 @@ import (
 	"sync"
 
 	"config"
+	"metastore"
 
 	"github.com/pkg/errors"
 	"github.com/xelabs/go-mysqlstack/sqldb"
@@ -24,6 +25,8 @@ import (
 // Extra -- router extra params.
 type Extra struct {
 	AutoIncrement *config.AutoIncrement
+	// ShardKeyDefault is the literal DEFAULT of the shard key column, such as: 'a' or 1.
+	ShardKeyDefault string
 }
 
 // Table tuple.
@@ -44,32 +47,49 @@ type Schema struct {
 	DB string `json:",omitempty"`
 	// tables map, key is table name
 	Tables map[string]*Table `json:",omitempty"`
+	// views map, key is view name
+	Views map[string]*config.ViewConfig `json:",omitempty"`
 }
 
 // Router tuple.
 type Router struct {
-	log     *xlog.Log
-	mu      sync.RWMutex
-	metadir string
-	dbACL   *DatabaseACL
-	conf    *config.RouterConfig
+	log   *xlog.Log
+	mu    sync.RWMutex
+	store metastore.Store
+	dbACL *DatabaseACL
+	conf  *config.RouterConfig
+
+	// revisions are the revisions of the keys read or written by the router,
+	// the writes fail with metastore.ErrConflict if the keys are changed by others.
+	revisions map[string]int64
 
 	// schemas map, key is database name
 	Schemas map[string]*Schema `json:",omitempty"`
 }
 
-// NewRouter creates the new router.
+// NewRouter creates the new router which stores the metadata in the files of the metadir.
 func NewRouter(log *xlog.Log, metadir string, conf *config.RouterConfig) *Router {
+	return NewRouterWithStore(log, metastore.NewFileStore(metadir), conf)
+}
+
+// NewRouterWithStore creates the new router which stores the metadata in the store.
+func NewRouterWithStore(log *xlog.Log, store metastore.Store, conf *config.RouterConfig) *Router {
 	route := &Router{
-		log:     log,
-		metadir: metadir,
-		conf:    conf,
-		dbACL:   NewDatabaseACL(),
-		Schemas: make(map[string]*Schema),
+		log:       log,
+		store:     store,
+		conf:      conf,
+		dbACL:     NewDatabaseACL(),
+		Schemas:   make(map[string]*Schema),
+		revisions: make(map[string]int64),
 	}
 	return route
 }
 
+// MetaStore returns the store of the metadata.
+func (r *Router) MetaStore() metastore.Store {
+	return r.store
+}
+
 // addTable -- used to add a table router to schema map.
 func (r *Router) addTable(db string, tbl *config.TableConfig) error {
 	var table *Table
@@ -165,6 +185,9 @@ func (r *Router) getRenameTableConfig(db, fromTable, toTable string) (*config.Ta
 	if _, ok = schema.Tables[toTable]; ok {
 		return nil, errors.Errorf("router.find.table[%v].exists", toTable)
 	}
+	if _, ok = schema.Views[toTable]; ok {
+		return nil, errors.Errorf("router.find.view[%v].exists", toTable)
+	}
 
 	table := schema.Tables[fromTable]
 	tableConfig := table.TableConfig
@@ -180,7 +203,7 @@ func (r *Router) addDatabase(db string) error {
 		return errors.Errorf("router.database.should.not.be.empty")
 	}
 	if _, ok := r.Schemas[db]; !ok {
-		schema := &Schema{DB: db, Tables: make(map[string]*Table)}
+		schema := &Schema{DB: db, Tables: make(map[string]*Table), Views: make(map[string]*config.ViewConfig)}
 		r.Schemas[db] = schema
 		return nil
 	}
@@ -198,6 +221,7 @@ func (r *Router) dropDatabase(db string) error {
 // clear used to reset Schemas to new.
 func (r *Router) clear() {
 	r.Schemas = make(map[string]*Schema)
+	r.revisions = make(map[string]int64)
 }
 
 // DatabaseACL used to check whether the database is a system database.
@@ -276,6 +300,18 @@ func (r *Router) TableConfig(database string, tableName string) (*config.TableCo
 	return table.TableConfig, nil
 }
 
+// TableFence returns the reshard ddl job which fences the writes to the table, 0 if not fenced or not found.
+func (r *Router) TableFence(database string, tableName string) uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if schema, ok := r.Schemas[database]; ok {
+		if table, ok := schema.Tables[tableName]; ok {
+			return table.TableConfig.WriteFence
+		}
+	}
+	return 0
+}
+
 // Lookup used to lookup a router(partition table name and backend) through db&table
 func (r *Router) Lookup(database string, tableName string, startKey *sqlparser.SQLVal, endKey *sqlparser.SQLVal) ([]Segment, error) {
 	var ok bool
@@ -0,0 +1,195 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package router
+
+import (
+	"fmt"
+	"sort"
+
+	"config"
+	"metastore"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+)
+
+// viewsKey returns the store dir key of the views: [database]/views/.
+func viewsKey(db string) string {
+	return fmt.Sprintf("%s/views/", db)
+}
+
+// viewKey returns the store key of the view: [database]/views/[view].json.
+func viewKey(db string, view string) string {
+	return fmt.Sprintf("%s/views/%s.json", db, view)
+}
+
+// writeViewFrmData used to write the view's json to the store if the revision matches.
+func (r *Router) writeViewFrmData(db string, conf *config.ViewConfig, revision int64) error {
+	log := r.log
+	log.Info("frm.write.view[db:%s, view:%s]", db, conf.Name)
+
+	// The dir of the views must exist before the view.
+	dir := viewsKey(db)
+	if _, err := r.store.Get(dir); err == metastore.ErrNotFound {
+		if _, err := r.store.Put(dir, nil, metastore.RevisionNotExist); err != nil {
+			log.Error("frm.write.views.dir[%v].error:%v", dir, err)
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	key := viewKey(db, conf.Name)
+	data, err := config.MarshalConfig(conf)
+	if err != nil {
+		return err
+	}
+	rev, err := r.store.Put(key, data, revision)
+	if err != nil {
+		log.Error("frm.write.view.to.store[%v].error:%v", key, err)
+		return err
+	}
+	r.revisions[key] = rev
+	return nil
+}
+
+// loadViewFromStore used to add a view read from the store.
+func (r *Router) loadViewFromStore(db string, key string) error {
+	log := r.log
+	log.Info("frm.load.view.from.store:%v", key)
+
+	kv, err := r.store.Get(key)
+	if err != nil {
+		log.Error("frm.load.view.read[%v].error:%v", key, err)
+		return err
+	}
+	conf, err := config.ReadViewConfig(string(kv.Value))
+	if err != nil {
+		log.Error("frm.load.view.parse.json[%v].error:%v", key, err)
+		return err
+	}
+	if err := r.checkDatabase(db); err != nil {
+		return err
+	}
+	r.Schemas[db].Views[conf.Name] = conf
+	r.revisions[key] = kv.Revision
+	return nil
+}
+
+// CreateView used to add a view to router and flush it to the store.
+// If replace is true, the exists view is replaced.
+func (r *Router) CreateView(db string, conf *config.ViewConfig, replace bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log := r.log
+	if len(conf.Name) > NAME_CHAR_LEN {
+		return sqldb.NewSQLError(sqldb.ER_TOO_LONG_IDENT, conf.Name)
+	}
+	if r.checkNameInvalid(conf.Name) {
+		log.Error("frm.check.view.name[%v].invalid.contains.char:'/' or space ' '", conf.Name)
+		return errors.Errorf("invalid.view.name.currently.not.support.viewname[%v].contains.with.char:'/' or space ' '", conf.Name)
+	}
+	if err := r.checkDatabase(db); err != nil {
+		return err
+	}
+	schema := r.Schemas[db]
+	if _, ok := schema.Tables[conf.Name]; ok {
+		return sqldb.NewSQLError(sqldb.ER_TABLE_EXISTS_ERROR, conf.Name)
+	}
+	if _, ok := schema.Views[conf.Name]; ok && !replace {
+		return sqldb.NewSQLError(sqldb.ER_TABLE_EXISTS_ERROR, conf.Name)
+	}
+	return r.writeView(db, conf)
+}
+
+// AlterView used to change the definition of the exists view.
+func (r *Router) AlterView(db string, conf *config.ViewConfig) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkDatabase(db); err != nil {
+		return err
+	}
+	if _, ok := r.Schemas[db].Views[conf.Name]; !ok {
+		return sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, conf.Name)
+	}
+	return r.writeView(db, conf)
+}
+
+func (r *Router) writeView(db string, conf *config.ViewConfig) error {
+	log := r.log
+	if err := r.writeViewFrmData(db, conf, r.revision(viewKey(db, conf.Name))); err != nil {
+		log.Error("frm.write.view[%s.%s].error:%+v", db, conf.Name, err)
+		return err
+	}
+	r.Schemas[db].Views[conf.Name] = conf
+
+	if err := metastore.UpdateVersion(r.store); err != nil {
+		log.Panicf("frm.write.view.update.version.error:%v", err)
+		return err
+	}
+	return nil
+}
+
+// DropView used to remove the view from router and the store.
+func (r *Router) DropView(db string, view string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log := r.log
+	if err := r.checkDatabase(db); err != nil {
+		return err
+	}
+	schema := r.Schemas[db]
+	if _, ok := schema.Views[view]; !ok {
+		return sqldb.NewSQLError(sqldb.ER_BAD_TABLE_ERROR, fmt.Sprintf("%s.%s", db, view))
+	}
+
+	key := viewKey(db, view)
+	log.Warning("frm.remove.key[%v].for.[db:%s, view:%s]", key, db, view)
+	if err := r.store.Delete(key, r.revision(key)); err != nil && err != metastore.ErrNotFound {
+		log.Error("frm.drop.view[%s.%s].error:%v", db, view, err)
+		return err
+	}
+	delete(schema.Views, view)
+	delete(r.revisions, key)
+
+	if err := metastore.UpdateVersion(r.store); err != nil {
+		log.Panicf("frm.drop.view.update.version.error:%v", err)
+		return err
+	}
+	return nil
+}
+
+// View returns the config of the view, nil if the view does not exist.
+func (r *Router) View(db string, view string) *config.ViewConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schema, ok := r.Schemas[db]
+	if !ok {
+		return nil
+	}
+	return schema.Views[view]
+}
+
+// Views returns the sorted view names of the database.
+func (r *Router) Views(db string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var views []string
+	if schema, ok := r.Schemas[db]; ok {
+		for name := range schema.Views {
+			views = append(views, name)
+		}
+	}
+	sort.Strings(views)
+	return views
+}
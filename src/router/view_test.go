@@ -0,0 +1,143 @@
+/*
+ * Radon
+ *
+ * Copyright 2019 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package router
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"config"
+	"metastore"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestView(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	err := router.CreateDatabase("test")
+	assert.Nil(t, err)
+	err = router.CreateHashTable("test", "t1", "id", TableTypePartitionHash, []string{"backend1", "backend2"}, nil, nil)
+	assert.Nil(t, err)
+
+	// Create.
+	{
+		conf := &config.ViewConfig{Name: "v1", Columns: []string{"a"}, Query: "select id from t1"}
+		err := router.CreateView("test", conf, false)
+		assert.Nil(t, err)
+		file := path.Join(router.store.(*metastore.FileStore).Dir(), "test", "views", "v1.json")
+		_, err = os.Stat(file)
+		assert.Nil(t, err)
+		assert.Equal(t, conf, router.View("test", "v1"))
+
+		err = router.CreateView("test", &config.ViewConfig{Name: "v2", Query: "select 1"}, false)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"v1", "v2"}, router.Views("test"))
+		assert.Nil(t, router.View("test", "v3"))
+		assert.Nil(t, router.View("xx", "v1"))
+		assert.Nil(t, router.Views("xx"))
+	}
+
+	// Replace and alter.
+	{
+		conf := &config.ViewConfig{Name: "v1", Query: "select id, b from t1"}
+		err := router.CreateView("test", conf, true)
+		assert.Nil(t, err)
+		assert.Equal(t, conf, router.View("test", "v1"))
+
+		conf = &config.ViewConfig{Name: "v2", Query: "select 2"}
+		err = router.AlterView("test", conf)
+		assert.Nil(t, err)
+		assert.Equal(t, conf, router.View("test", "v2"))
+	}
+
+	// Load.
+	{
+		router1, cleanup1 := MockNewRouter(log)
+		defer cleanup1()
+		err := router1.LoadConfig()
+		assert.Nil(t, err)
+		assert.Equal(t, router, router1)
+	}
+
+	// Drop.
+	{
+		err := router.DropView("test", "v2")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"v1"}, router.Views("test"))
+
+		err = router.DropDatabase("test")
+		assert.Nil(t, err)
+		assert.Nil(t, router.View("test", "v1"))
+	}
+}
+
+func TestViewError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	err := router.CreateDatabase("test")
+	assert.Nil(t, err)
+	err = router.CreateHashTable("test", "t1", "id", TableTypePartitionHash, []string{"backend1"}, nil, nil)
+	assert.Nil(t, err)
+	err = router.CreateView("test", &config.ViewConfig{Name: "v1", Query: "select 1"}, false)
+	assert.Nil(t, err)
+
+	tcases := []struct {
+		fn   func() error
+		want string
+	}{
+		{
+			fn:   func() error { return router.CreateView("xx", &config.ViewConfig{Name: "v1"}, false) },
+			want: "Unknown database 'xx' (errno 1049) (sqlstate 42000)",
+		},
+		{
+			fn:   func() error { return router.CreateView("test", &config.ViewConfig{Name: "t1"}, true) },
+			want: "Table 't1' already exists (errno 1050) (sqlstate 42S01)",
+		},
+		{
+			fn:   func() error { return router.CreateView("test", &config.ViewConfig{Name: "v1"}, false) },
+			want: "Table 'v1' already exists (errno 1050) (sqlstate 42S01)",
+		},
+		{
+			fn:   func() error { return router.CreateView("test", &config.ViewConfig{Name: "v/1"}, false) },
+			want: "invalid.view.name.currently.not.support.viewname[v/1].contains.with.char:'/' or space ' '",
+		},
+		{
+			fn:   func() error { return router.AlterView("test", &config.ViewConfig{Name: "v2"}) },
+			want: "Table 'v2' doesn't exist (errno 1146) (sqlstate 42S02)",
+		},
+		{
+			fn:   func() error { return router.DropView("test", "v2") },
+			want: "Unknown table 'test.v2' (errno 1051) (sqlstate 42S02)",
+		},
+		{
+			fn: func() error {
+				return router.CreateHashTable("test", "v1", "id", TableTypePartitionHash, []string{"backend1"}, nil, nil)
+			},
+			want: "Table 'v1' already exists (errno 1050) (sqlstate 42S01)",
+		},
+		{
+			fn:   func() error { return router.RenameTable("test", "t1", "v1") },
+			want: "router.find.view[v1].exists",
+		},
+	}
+	for _, tcase := range tcases {
+		err := tcase.fn()
+		assert.NotNil(t, err)
+		if err != nil {
+			assert.Equal(t, tcase.want, err.Error())
+		}
+	}
+}
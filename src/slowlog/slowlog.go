@@ -0,0 +1,233 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package slowlog
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"config"
+	"xbase"
+	"xcontext"
+
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const (
+	prefix    = "slow-"
+	extension = ".log"
+
+	// queueSize is the entries waiting for the write, the others are dropped.
+	queueSize = 1024
+)
+
+const (
+	// PlanNone is the plan of the statements without the backend execution.
+	PlanNone = "none"
+	// PlanSingleShard is the plan of the statements executed on one shard.
+	PlanSingleShard = "single-shard"
+	// PlanScatter is the plan of the statements executed on more than one shard.
+	PlanScatter = "scatter"
+	// PlanJoin is the plan of the statements joined by radon.
+	PlanJoin = "join"
+)
+
+// Shard tuple, the execution of the generated query on the backend.
+type Shard struct {
+	xcontext.QueryTuple
+	Cost  time.Duration
+	Rows  uint64
+	Error string
+}
+
+// Entry tuple, the slow statement.
+type Entry struct {
+	Start        time.Time
+	Cost         time.Duration
+	User         string
+	Host         string // the client address with the port
+	ThreadID     uint32
+	Database     string
+	Query        string
+	RowsSent     uint64
+	RowsAffected uint64
+	Errno        uint16
+	Plan         string
+	Shards       []*Shard
+}
+
+// RowsExamined returns the rows returned by the backends.
+func (e *Entry) RowsExamined() uint64 {
+	var rows uint64
+	for _, shard := range e.Shards {
+		rows += shard.Rows
+	}
+	return rows
+}
+
+// oneLine replaces the line breaks, the per-shard lines must be the comments.
+func oneLine(s string) string {
+	return strings.Replace(strings.Replace(s, "\r", " ", -1), "\n", " ", -1)
+}
+
+// Format returns the entry in the MySQL slow query log format, the radon attributes are the extra comment lines:
+// # Time: 2018-10-19T10:58:09.515954Z
+// # User@Host: root[root] @  [127.0.0.1]  Id:     5
+// # Query_time: 5.000123  Lock_time: 0.000000 Rows_sent: 1  Rows_examined: 2
+// # Rows_affected: 0  Last_errno: 0  Radon_plan: scatter  Radon_shards: 2
+// # Radon_shard: backend1  Shard_time: 4.998712  Shard_rows: 1  Shard_query: select * from test.t1_0000 as t1
+// # Radon_shard: backend2  Shard_time: 0.001102  Shard_rows: 1  Shard_query: select * from test.t1_0001 as t1
+// use test;
+// SET timestamp=1539946684;
+// select * from t1;
+func (e *Entry) Format() []byte {
+	var buf bytes.Buffer
+	end := e.Start.Add(e.Cost).UTC()
+	host, _, err := net.SplitHostPort(e.Host)
+	if err != nil {
+		host = e.Host
+	}
+
+	fmt.Fprintf(&buf, "# Time: %s\n", end.Format("2006-01-02T15:04:05.000000Z"))
+	fmt.Fprintf(&buf, "# User@Host: %s[%s] @  [%s]  Id: %5d\n", e.User, e.User, host, e.ThreadID)
+	fmt.Fprintf(&buf, "# Query_time: %.6f  Lock_time: 0.000000 Rows_sent: %d  Rows_examined: %d\n", e.Cost.Seconds(), e.RowsSent, e.RowsExamined())
+	fmt.Fprintf(&buf, "# Rows_affected: %d  Last_errno: %d  Radon_plan: %s  Radon_shards: %d\n", e.RowsAffected, e.Errno, e.Plan, len(e.Shards))
+	for _, shard := range e.Shards {
+		fmt.Fprintf(&buf, "# Radon_shard: %s  Shard_time: %.6f  Shard_rows: %d", shard.Backend, shard.Cost.Seconds(), shard.Rows)
+		if shard.Range != "" {
+			fmt.Fprintf(&buf, "  Shard_range: %s", oneLine(shard.Range))
+		}
+		if shard.Error != "" {
+			fmt.Fprintf(&buf, "  Shard_error: %s", oneLine(shard.Error))
+		}
+		fmt.Fprintf(&buf, "  Shard_query: %s\n", oneLine(shard.Query))
+	}
+	if e.Database != "" {
+		fmt.Fprintf(&buf, "use %s;\n", e.Database)
+	}
+	fmt.Fprintf(&buf, "SET timestamp=%d;\n", e.Start.Unix())
+	buf.WriteString(strings.TrimSuffix(e.Query, ";"))
+	buf.WriteString(";\n")
+	return buf.Bytes()
+}
+
+// SlowLog tuple, writes the slow statements to the rotating files in the background.
+type SlowLog struct {
+	log      *xlog.Log
+	dir      string
+	maxFiles int
+	rfile    xbase.RotateFile
+	queue    chan *Entry
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	closed   bool
+}
+
+// NewSlowLog creates the new SlowLog, nil is returned if the slow-log-dir is empty.
+func NewSlowLog(log *xlog.Log, conf *config.ProxyConfig) *SlowLog {
+	if conf.SlowLogDir == "" {
+		return nil
+	}
+	return &SlowLog{
+		log:      log,
+		dir:      conf.SlowLogDir,
+		maxFiles: conf.SlowLogMaxFiles,
+		rfile:    xbase.NewRotateFile(conf.SlowLogDir, prefix, extension, conf.SlowLogMaxSize),
+		queue:    make(chan *Entry, queueSize),
+	}
+}
+
+// Init used to create the slow log dir and start the writer.
+func (s *SlowLog) Init() error {
+	if s == nil {
+		return nil
+	}
+	if err := os.MkdirAll(s.dir, 0744); err != nil {
+		return err
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.writer()
+	}()
+	s.log.Info("slowlog.init.dir[%s].done", s.dir)
+	return nil
+}
+
+// Log used to queue the slow statement, it's dropped if the queue is full.
+func (s *SlowLog) Log(e *Entry) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- e:
+	default:
+		s.log.Warning("slowlog.queue.is.full.query[%s].dropped", e.Query)
+	}
+}
+
+// Close used to flush the queued statements and close the file.
+func (s *SlowLog) Close() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+	s.wg.Wait()
+	s.rfile.Sync()
+	s.rfile.Close()
+	s.log.Info("slowlog.closed")
+}
+
+func (s *SlowLog) writer() {
+	log := s.log
+	for e := range s.queue {
+		name := s.rfile.Name()
+		if _, err := s.rfile.Write(e.Format()); err != nil {
+			log.Error("slowlog.write.file.error:%v", err)
+		}
+		// Purge the old files once rotated.
+		if s.rfile.Name() != name {
+			s.purge()
+		}
+	}
+}
+
+// purge removes the oldest files beyond the max files.
+func (s *SlowLog) purge() {
+	log := s.log
+	if s.maxFiles <= 0 {
+		return
+	}
+	oldLogs, err := s.rfile.GetOldLogInfos()
+	if err != nil {
+		log.Error("slowlog.get.old.loginfos.error:%v", err)
+		return
+	}
+	for i := 0; i < len(oldLogs)-s.maxFiles; i++ {
+		os.Remove(filepath.Join(s.dir, oldLogs[i].Name))
+	}
+}
@@ -0,0 +1,116 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package slowlog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"config"
+	"fakedb"
+	"xcontext"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestSlowLogFormat(t *testing.T) {
+	start := time.Date(2018, 10, 19, 10, 58, 4, 515954000, time.UTC)
+	entry := &Entry{
+		Start:        start,
+		Cost:         5*time.Second + 123*time.Microsecond,
+		User:         "root",
+		Host:         "127.0.0.1:5566",
+		ThreadID:     5,
+		Database:     "test",
+		Query:        "select * from t1;",
+		RowsSent:     2,
+		RowsAffected: 0,
+		Plan:         PlanScatter,
+		Shards: []*Shard{
+			{
+				QueryTuple: xcontext.QueryTuple{Query: "select * from test.t1_0000 as t1", Backend: "backend1"},
+				Cost:       4998712 * time.Microsecond,
+				Rows:       1,
+			},
+			{
+				QueryTuple: xcontext.QueryTuple{Query: "select *\nfrom test.t1_0001 as t1", Backend: "backend2", Range: "[512-1024)"},
+				Cost:       1102 * time.Microsecond,
+				Rows:       2,
+				Error:      "lost connection",
+			},
+		},
+	}
+	want := `# Time: 2018-10-19T10:58:09.516077Z
+# User@Host: root[root] @  [127.0.0.1]  Id:     5
+# Query_time: 5.000123  Lock_time: 0.000000 Rows_sent: 2  Rows_examined: 3
+# Rows_affected: 0  Last_errno: 0  Radon_plan: scatter  Radon_shards: 2
+# Radon_shard: backend1  Shard_time: 4.998712  Shard_rows: 1  Shard_query: select * from test.t1_0000 as t1
+# Radon_shard: backend2  Shard_time: 0.001102  Shard_rows: 2  Shard_range: [512-1024)  Shard_error: lost connection  Shard_query: select * from test.t1_0001 as t1
+use test;
+SET timestamp=1539946684;
+select * from t1;
+`
+	assert.Equal(t, want, string(entry.Format()))
+}
+
+func TestSlowLog(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	tmpDir := fakedb.GetTmpDir("", "radon_slowlog_", log)
+	defer os.RemoveAll(tmpDir)
+
+	// Disabled.
+	{
+		slowLog := NewSlowLog(log, config.DefaultProxyConfig())
+		assert.Nil(t, slowLog)
+		assert.Nil(t, slowLog.Init())
+		slowLog.Log(&Entry{})
+		slowLog.Close()
+	}
+
+	conf := config.DefaultProxyConfig()
+	conf.SlowLogDir = tmpDir
+	conf.SlowLogMaxSize = 1024
+	conf.SlowLogMaxFiles = 2
+	slowLog := NewSlowLog(log, conf)
+	err := slowLog.Init()
+	assert.Nil(t, err)
+	n := 100
+	for i := 0; i < n; i++ {
+		slowLog.Log(&Entry{
+			Start:    time.Now(),
+			Cost:     time.Second,
+			User:     "root",
+			Host:     "127.0.0.1:5566",
+			Database: "test",
+			Query:    "select * from t1 where id=1",
+			Plan:     PlanNone,
+		})
+	}
+	slowLog.Close()
+	slowLog.Close()
+	slowLog.Log(&Entry{})
+
+	// At most the current file and the 2 old files are kept.
+	files, err := filepath.Glob(filepath.Join(tmpDir, prefix+"*"+extension))
+	assert.Nil(t, err)
+	assert.True(t, len(files) > 0 && len(files) <= 3)
+	var data []byte
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		assert.Nil(t, err)
+		data = append(data, b...)
+	}
+	got := strings.Count(string(data), "# Time: ")
+	assert.True(t, got > 0 && got < n)
+}
@@ -0,0 +1,384 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package syncer
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"metastore"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// lockJSONFile is the key of the locks in the shared store.
+	lockJSONFile = "locks.json"
+
+	// leaderJSONFile is the key of the leader lease in the shared store.
+	leaderJSONFile = "leader.json"
+
+	// leaderLease is the lease of the leader in the shared store, it's renewed by Leading.
+	leaderLease = 10 * time.Second
+
+	// lockRestURL url.
+	lockRestURL = "v1/meta/lock"
+
+	// LockCluster is the name of the lock which conflicts with all the others.
+	LockCluster = "*"
+
+	// LockOpLock acquires or renews the lock.
+	LockOpLock = "lock"
+
+	// LockOpUnlock releases the lock.
+	LockOpUnlock = "unlock"
+
+	// LockOpList lists the locks.
+	LockOpList = "list"
+
+	lockStoreRetries = 16
+)
+
+// Lock is the lease of the named resource, the name is a database 'db', a table 'db.table' or LockCluster.
+// The lock of the database conflicts with the locks of its tables.
+type Lock struct {
+	Name   string `json:"name"`
+	Owner  string `json:"owner"`
+	Cause  string `json:"cause"`
+	Expire int64  `json:"expire"`
+}
+
+// LockRequest is sent to the coordinator of the locks.
+// The Renew is set if the owner renews the lock it holds.
+type LockRequest struct {
+	Op    string `json:"op"`
+	Name  string `json:"name"`
+	Owner string `json:"owner"`
+	Cause string `json:"cause"`
+	Lease int64  `json:"lease"` // milliseconds
+	Renew bool   `json:"renew,omitempty"`
+}
+
+// LockResponse tuple, the Holder is set if the lock is held by the other owner.
+type LockResponse struct {
+	Holder *Lock   `json:"holder,omitempty"`
+	Locks  []*Lock `json:"locks,omitempty"`
+}
+
+// lockConflict returns true if the two names can't be locked by different owners at the same time.
+func lockConflict(a, b string) bool {
+	return a == b || a == LockCluster || b == LockCluster || strings.HasPrefix(a, b+".") || strings.HasPrefix(b, a+".")
+}
+
+// lockTable is the locks on the coordinator.
+type lockTable map[string]*Lock
+
+// handle applies the request at the time now, the holder is returned if the lock conflicts.
+func (t lockTable) handle(req *LockRequest, now time.Time) *LockResponse {
+	for name, lock := range t {
+		if lock.Expire <= now.UnixNano() {
+			delete(t, name)
+		}
+	}
+
+	rsp := &LockResponse{}
+	switch req.Op {
+	case LockOpLock:
+		for _, lock := range t {
+			if lock.Owner != req.Owner && lockConflict(lock.Name, req.Name) {
+				rsp.Holder = lock
+				return rsp
+			}
+		}
+		t[req.Name] = &Lock{
+			Name:   req.Name,
+			Owner:  req.Owner,
+			Cause:  req.Cause,
+			Expire: now.Add(time.Duration(req.Lease) * time.Millisecond).UnixNano(),
+		}
+	case LockOpUnlock:
+		if lock, ok := t[req.Name]; ok && lock.Owner == req.Owner {
+			delete(t, req.Name)
+		}
+	}
+	for _, lock := range t {
+		rsp.Locks = append(rsp.Locks, lock)
+	}
+	sort.Slice(rsp.Locks, func(i, j int) bool { return rsp.Locks[i].Name < rsp.Locks[j].Name })
+	return rsp
+}
+
+// HandleLock handles the lock request as the coordinator.
+// The locks are kept in the shared store if it's shared, or else in the memory of the raft leader.
+// After the leader changed, the holders take the locks again on the next renewal, the new leader
+// refuses the new locks for a lease so that the locks granted by the old leader expire or are renewed.
+func (s *Syncer) HandleLock(req *LockRequest) (*LockResponse, error) {
+	if s.store.Shared() {
+		return s.handleStoreLock(lockJSONFile, req)
+	}
+
+	s.lockMu.Lock()
+	defer s.lockMu.Unlock()
+	now := time.Now()
+	if len(s.peer.Clone()) > 1 {
+		status := s.raft.Status()
+		if status.Role != RaftLeader {
+			return nil, errors.Errorf("syncer.lock[%s].is.not.the.coordinator[%s]", s.peer.self, status.Leader)
+		}
+		if status.Term != s.lockTerm {
+			s.locks = make(lockTable)
+			s.lockTerm = status.Term
+			s.lockSince = now
+		}
+		lease := time.Duration(req.Lease) * time.Millisecond
+		if req.Op == LockOpLock && !req.Renew && now.Before(s.lockSince.Add(lease)) {
+			return nil, errors.Errorf("syncer.lock[%s].coordinator.is.waiting.for.the.locks.of.the.old.leader.until[%s]", req.Name, s.lockSince.Add(lease).Format("2006-01-02 15:04:05"))
+		}
+	}
+	return s.locks.handle(req, now), nil
+}
+
+// handleStoreLock applies the request to the locks of the key in the store with the compare and swap.
+func (s *Syncer) handleStoreLock(key string, req *LockRequest) (*LockResponse, error) {
+	for i := 0; i < lockStoreRetries; i++ {
+		locks := make(lockTable)
+		revision := metastore.RevisionNotExist
+		kv, err := s.store.Get(key)
+		switch err {
+		case nil:
+			if err := json.Unmarshal(kv.Value, &locks); err != nil {
+				return nil, errors.WithStack(err)
+			}
+			revision = kv.Revision
+		case metastore.ErrNotFound:
+		default:
+			return nil, err
+		}
+
+		rsp := locks.handle(req, time.Now())
+		if req.Op == LockOpList || rsp.Holder != nil {
+			return rsp, nil
+		}
+		data, err := json.Marshal(locks)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if _, err := s.store.Put(key, data, revision); err != nil {
+			if err == metastore.ErrConflict {
+				continue
+			}
+			return nil, err
+		}
+		return rsp, nil
+	}
+	return nil, errors.Errorf("syncer.lock[%s].too.many.conflicts", req.Name)
+}
+
+// coordinator returns the peer which handles the lock requests.
+func (s *Syncer) coordinator() (string, error) {
+	self := s.peer.self
+	if s.store.Shared() || len(s.peer.Clone()) <= 1 {
+		return self, nil
+	}
+	leader := s.raft.Status().Leader
+	if leader == "" {
+		return "", errors.New("syncer.lock.no.coordinator")
+	}
+	return leader, nil
+}
+
+// callLock sends the request to the coordinator.
+func (s *Syncer) callLock(req *LockRequest) (*LockResponse, error) {
+	coordinator, err := s.coordinator()
+	if err != nil {
+		return nil, err
+	}
+	if coordinator == s.peer.self {
+		return s.HandleLock(req)
+	}
+	rsp := &LockResponse{}
+	if err := raftCall(s.client, coordinator, lockRestURL, req, rsp); err != nil {
+		return nil, err
+	}
+	return rsp, nil
+}
+
+// TryLock used to take or renew the lock once, it fails if the lock is held by the other owner.
+func (s *Syncer) TryLock(name, owner, cause string, lease time.Duration) error {
+	req := &LockRequest{Op: LockOpLock, Name: name, Owner: owner, Cause: cause, Lease: int64(lease / time.Millisecond)}
+	rsp, err := s.callLock(req)
+	if err != nil {
+		return err
+	}
+	if holder := rsp.Holder; holder != nil {
+		return errors.Errorf("syncer.lock[%s].is.held.by[%s].for[%s].until[%s]", name, holder.Owner, holder.Cause, time.Unix(0, holder.Expire).Format("2006-01-02 15:04:05"))
+	}
+	return nil
+}
+
+// Unlock used to release the lock of the owner.
+func (s *Syncer) Unlock(name, owner string) error {
+	_, err := s.callLock(&LockRequest{Op: LockOpUnlock, Name: name, Owner: owner})
+	return err
+}
+
+// Locks returns the locks held in the cluster.
+func (s *Syncer) Locks() ([]*Lock, error) {
+	rsp, err := s.callLock(&LockRequest{Op: LockOpList})
+	if err != nil {
+		return nil, err
+	}
+	return rsp.Locks, nil
+}
+
+// Leading returns true if the peer runs the cluster-wide checks such as the backend failover.
+// It's the raft leader, or the holder of the leader lease if the store is shared, the lease
+// is kept apart from the locks so that it never blocks the DDL.
+func (s *Syncer) Leading() bool {
+	self := s.peer.self
+	if s.store.Shared() {
+		req := &LockRequest{Op: LockOpLock, Name: "leader", Owner: self, Cause: "leader", Lease: int64(leaderLease / time.Millisecond)}
+		rsp, err := s.handleStoreLock(leaderJSONFile, req)
+		return err == nil && rsp.Holder == nil
+	}
+	if len(s.peer.Clone()) <= 1 {
+		return true
+	}
+	return s.raft.Status().Role == RaftLeader
+}
+
+// LockGuard holds the locks and renews them until Unlock.
+// The locks are lost if they are held by the other owner or can't be renewed before the lease expires,
+// the guarded operation must check Err before it changes anything, or abort when Lost is closed.
+type LockGuard struct {
+	syncer *Syncer
+	names  []string
+	owner  string
+	cause  string
+	lease  time.Duration
+	expire time.Time
+	done   chan bool
+	wg     sync.WaitGroup
+
+	mu   sync.Mutex
+	err  error
+	lost chan bool
+}
+
+// Lock used to take the locks of the names for the owner, it retries until the wait is exceeded, 0 to fail fast.
+// The locks are renewed every lease/3 until the guard is unlocked.
+func (s *Syncer) Lock(owner, cause string, lease, wait time.Duration, names ...string) (*LockGuard, error) {
+	log := s.log
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+
+	deadline := time.Now().Add(wait)
+	guard := &LockGuard{syncer: s, owner: owner, cause: cause, lease: lease, done: make(chan bool), lost: make(chan bool)}
+	guard.expire = time.Now().Add(lease)
+	for _, name := range names {
+		for {
+			err := s.TryLock(name, owner, cause, lease)
+			if err == nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				log.Error("syncer.lock[%s].owner[%s].cause[%s].error:%v", name, owner, cause, err)
+				guard.release()
+				return nil, err
+			}
+			time.Sleep(time.Millisecond * 100)
+		}
+		guard.names = append(guard.names, name)
+	}
+
+	guard.wg.Add(1)
+	go func() {
+		defer guard.wg.Done()
+		ticker := time.NewTicker(lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if !guard.renew() {
+					return
+				}
+			case <-guard.done:
+				return
+			}
+		}
+	}()
+	return guard, nil
+}
+
+// renew used to renew the locks, it returns false if the locks are lost.
+func (g *LockGuard) renew() bool {
+	log := g.syncer.log
+	now := time.Now()
+	for _, name := range g.names {
+		req := &LockRequest{Op: LockOpLock, Name: name, Owner: g.owner, Cause: g.cause, Lease: int64(g.lease / time.Millisecond), Renew: true}
+		rsp, err := g.syncer.callLock(req)
+		if err == nil && rsp.Holder == nil {
+			continue
+		}
+		if err == nil {
+			holder := rsp.Holder
+			g.fence(errors.Errorf("syncer.lock[%s].is.lost.to[%s].for[%s]", name, holder.Owner, holder.Cause))
+			return false
+		}
+		log.Error("syncer.lock[%s].owner[%s].renew.error:%v", name, g.owner, err)
+		// The lock may be taken by the others once the lease expires, fence before the next renewal.
+		if now.Add(g.lease / 3).After(g.expire) {
+			g.fence(errors.Errorf("syncer.lock[%s].is.lost.since.the.lease.expired:%v", name, err))
+			return false
+		}
+		return true
+	}
+	g.expire = now.Add(g.lease)
+	return true
+}
+
+// fence used to mark the locks lost.
+func (g *LockGuard) fence(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.syncer.log.Error("syncer.lock.owner[%s].cause[%s].fenced:%v", g.owner, g.cause, err)
+	g.err = err
+	close(g.lost)
+}
+
+// Err returns the error if the locks are lost, the guarded operation must not go on.
+func (g *LockGuard) Err() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.err
+}
+
+// Lost returns the channel which is closed when the locks are lost.
+func (g *LockGuard) Lost() <-chan bool {
+	return g.lost
+}
+
+// release used to release the locks taken.
+func (g *LockGuard) release() {
+	for _, name := range g.names {
+		if err := g.syncer.Unlock(name, g.owner); err != nil {
+			g.syncer.log.Error("syncer.unlock[%s].owner[%s].error:%v", name, g.owner, err)
+		}
+	}
+}
+
+// Unlock used to stop the renewal and release the locks.
+func (g *LockGuard) Unlock() {
+	close(g.done)
+	g.wg.Wait()
+	g.release()
+}
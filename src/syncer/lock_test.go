@@ -0,0 +1,241 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package syncer
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"metastore"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestLockTable(t *testing.T) {
+	now := time.Now()
+	locks := make(lockTable)
+	lock := func(name, owner string) *LockResponse {
+		return locks.handle(&LockRequest{Op: LockOpLock, Name: name, Owner: owner, Lease: 1000}, now)
+	}
+
+	assert.Nil(t, lock("db1.t1", "a").Holder)
+	assert.Nil(t, lock("db1.t1", "a").Holder)
+	assert.Nil(t, lock("db1.t2", "b").Holder)
+	assert.Nil(t, lock("db10", "b").Holder)
+
+	// The database conflicts with its tables.
+	rsp := lock("db1", "b")
+	assert.Equal(t, "a", rsp.Holder.Owner)
+	assert.Equal(t, "db1.t1", rsp.Holder.Name)
+	assert.NotNil(t, lock("db1.t1", "b").Holder)
+	assert.NotNil(t, lock(LockCluster, "c").Holder)
+
+	// Unlock by the other owner is ignored.
+	locks.handle(&LockRequest{Op: LockOpUnlock, Name: "db1.t1", Owner: "b"}, now)
+	assert.NotNil(t, lock("db1.t1", "b").Holder)
+	rsp = locks.handle(&LockRequest{Op: LockOpUnlock, Name: "db1.t1", Owner: "a"}, now)
+	assert.Equal(t, 2, len(rsp.Locks))
+	assert.Equal(t, "db1.t2", rsp.Locks[0].Name)
+
+	// The expired locks are removed.
+	rsp = locks.handle(&LockRequest{Op: LockOpLock, Name: LockCluster, Owner: "c", Lease: 1000}, now.Add(time.Second))
+	assert.Nil(t, rsp.Holder)
+	assert.Equal(t, 1, len(rsp.Locks))
+}
+
+func TestSyncerClusterLock(t *testing.T) {
+	defer testRemoveMetadir()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	syncers, cleanup := mockSyncer(log, 3)
+	defer cleanup()
+	leader := mockWaitLeader("", syncers...)
+	assert.NotEqual(t, "", leader)
+
+	var follower1, follower2 *Syncer
+	for _, syncer := range syncers {
+		if syncer.peer.self == leader {
+			continue
+		}
+		if follower1 == nil {
+			follower1 = syncer
+		} else {
+			follower2 = syncer
+		}
+	}
+
+	// The followers forward to the leader, the new leader refuses the new locks for a lease.
+	_, err := follower1.Lock("peer1", "create table db1.t1", time.Second*3, 0, "db1.t1")
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "coordinator.is.waiting.for.the.locks.of.the.old.leader"))
+	guard, err := follower1.Lock("peer1", "create table db1.t1", time.Second*3, time.Second*5, "db1.t1")
+	assert.Nil(t, err)
+
+	err = follower2.TryLock("db1", "peer2", "drop database db1", time.Second*3)
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "syncer.lock[db1].is.held.by[peer1].for[create table db1.t1]"))
+
+	// The follower is not the coordinator.
+	_, err = follower2.HandleLock(&LockRequest{Op: LockOpList})
+	assert.NotNil(t, err)
+
+	// Renewed beyond the lease.
+	time.Sleep(time.Millisecond * 3500)
+	locks, err := follower2.Locks()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(locks))
+	assert.Equal(t, "peer1", locks[0].Owner)
+
+	// Wait for the holder.
+	go func() {
+		time.Sleep(time.Millisecond * 300)
+		guard.Unlock()
+	}()
+	_, err = follower2.Lock("peer2", "drop database db1", time.Second*3, 0, "db1")
+	assert.NotNil(t, err)
+	guard2, err := follower2.Lock("peer2", "drop database db1", time.Second*3, time.Second*5, "db1")
+	assert.Nil(t, err)
+	guard2.Unlock()
+
+	locks, err = follower1.Locks()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(locks))
+}
+
+func TestSyncerClusterLockLeaderChange(t *testing.T) {
+	defer testRemoveMetadir()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	syncers, stop, cleanup := mockSyncerWithStop(log, 3)
+	defer cleanup()
+	leader := mockWaitLeader("", syncers...)
+	assert.NotEqual(t, "", leader)
+
+	var alive []*Syncer
+	for _, syncer := range syncers {
+		if syncer.peer.self != leader {
+			alive = append(alive, syncer)
+		}
+	}
+	// The lease covers the election.
+	guard, err := alive[0].Lock("peer1", "create table db1.t1", time.Second*6, time.Second*8, "db1.t1")
+	assert.Nil(t, err)
+	defer guard.Unlock()
+
+	for i, syncer := range syncers {
+		if syncer.peer.self == leader {
+			stop(i)
+		}
+	}
+	assert.NotEqual(t, "", mockWaitLeader(leader, alive...))
+
+	// The new leader takes the renewal of the holder and refuses the others.
+	err = alive[1].TryLock("db1", "peer2", "drop database db1", time.Second*3)
+	assert.NotNil(t, err)
+	for i := 0; i < 50; i++ {
+		if locks, err := alive[1].Locks(); err == nil && len(locks) == 1 && locks[0].Owner == "peer1" {
+			break
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+	time.Sleep(time.Second * 3)
+	err = alive[1].TryLock("db1", "peer2", "drop database db1", time.Second*3)
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "syncer.lock[db1].is.held.by[peer1]"))
+	assert.Nil(t, guard.Err())
+}
+
+func TestSyncerClusterLockLost(t *testing.T) {
+	defer testRemoveMetadir()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	syncers, cleanup := mockSyncer(log, 1)
+	defer cleanup()
+	syncer := syncers[0]
+
+	guard, err := syncer.Lock("peer1", "create table db1.t1", time.Millisecond*600, 0, "db1.t1")
+	assert.Nil(t, err)
+	defer guard.Unlock()
+
+	// The lock is taken by the other owner, the guard is fenced at the renewal.
+	syncer.lockMu.Lock()
+	syncer.locks = make(lockTable)
+	syncer.lockMu.Unlock()
+	assert.Nil(t, syncer.TryLock("db1.t1", "peer2", "drop table db1.t1", time.Second))
+	select {
+	case <-guard.Lost():
+	case <-time.After(time.Second * 2):
+		assert.Fail(t, "the.lock.is.not.lost")
+	}
+	assert.NotNil(t, guard.Err())
+	assert.True(t, strings.Contains(guard.Err().Error(), "syncer.lock[db1.t1].is.lost.to[peer2]"))
+}
+
+func TestSyncerSharedStoreLock(t *testing.T) {
+	defer testRemoveMetadir()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	os.MkdirAll(testMetadir, 0777)
+	store := &sharedStore{FileStore: metastore.NewFileStore(testMetadir)}
+
+	syncer1 := NewSyncer(log, testMetadir, store, "127.0.0.1:8081", nil, nil)
+	syncer2 := NewSyncer(log, testMetadir, store, "127.0.0.1:8082", nil, nil)
+
+	guard, err := syncer1.Lock("peer1", "radon rebalance", time.Second, 0, LockCluster)
+	assert.Nil(t, err)
+	err = syncer2.TryLock("db1.t1", "peer2", "create table db1.t1", time.Second)
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "is.held.by[peer1].for[radon rebalance]"))
+
+	guard.Unlock()
+	assert.Nil(t, syncer2.TryLock("db1.t1", "peer2", "create table db1.t1", time.Second))
+	locks, err := syncer1.Locks()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(locks))
+
+	// The locks are not the metadata.
+	metas, err := syncer1.metas()
+	assert.Nil(t, err)
+	_, ok := metas[lockJSONFile]
+	assert.False(t, ok)
+}
+
+func TestSyncerLeading(t *testing.T) {
+	defer testRemoveMetadir()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	syncers, cleanup := mockSyncer(log, 3)
+	defer cleanup()
+	leader := mockWaitLeader("", syncers...)
+	assert.NotEqual(t, "", leader)
+	assert.True(t, mockWaitSynced(log, syncers...))
+	for _, syncer := range syncers {
+		assert.Equal(t, syncer.peer.self == leader, syncer.Leading())
+	}
+}
+
+func TestSyncerSharedStoreLeading(t *testing.T) {
+	defer testRemoveMetadir()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	os.MkdirAll(testMetadir, 0777)
+	store := &sharedStore{FileStore: metastore.NewFileStore(testMetadir)}
+	syncer1 := NewSyncer(log, testMetadir, store, "127.0.0.1:8081", nil, nil)
+	syncer2 := NewSyncer(log, testMetadir, store, "127.0.0.1:8082", nil, nil)
+	assert.True(t, syncer1.Leading())
+	assert.False(t, syncer2.Leading())
+	assert.True(t, syncer1.Leading())
+
+	// The lease doesn't block the cluster lock.
+	guard, err := syncer2.Lock("peer2", "radon rebalance", time.Second, 0, LockCluster)
+	assert.Nil(t, err)
+	guard.Unlock()
+
+	metas, err := syncer1.metas()
+	assert.Nil(t, err)
+	_, ok := metas[leaderJSONFile]
+	assert.False(t, ok)
+}
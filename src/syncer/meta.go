@@ -19,6 +19,7 @@ import (
 	"time"
 
 	"config"
+	"metastore"
 	"xbase"
 
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/common"
@@ -31,6 +32,9 @@ const (
 
 	// versionRestURL url.
 	versionRestURL = "v1/meta/versions"
+
+	// backendJSONFile file name.
+	backendJSONFile = "backend.json"
 )
 
 // Meta tuple.
@@ -62,7 +66,7 @@ func writeFile(log *xlog.Log, file string, data string) error {
 func (s *Syncer) MetaVersion() int64 {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return config.ReadVersion(s.metadir)
+	return metastore.ReadVersion(s.store)
 }
 
 // MetaVersionCheck used to check the version is synced or not.
@@ -76,8 +80,8 @@ func (s *Syncer) MetaVersionCheck() (bool, []string) {
 	peers := s.peer.Clone()
 	for _, peer := range peers {
 		if peer != self {
-			versionURL := "http://" + path.Join(peer, versionRestURL)
-			peerVerStr, err := xbase.HTTPGet(versionURL)
+			versionURL := s.client.Scheme() + "://" + path.Join(peer, versionRestURL)
+			peerVerStr, err := s.client.Get(versionURL)
 			if err != nil {
 				log.Error("syncer.check.version.get[%s].error:%+v", peerVerStr, err)
 				continue
@@ -95,7 +99,7 @@ func (s *Syncer) MetaVersionCheck() (bool, []string) {
 		}
 	}
 
-	selfVer := config.ReadVersion(s.metadir)
+	selfVer := metastore.ReadVersion(s.store)
 	if maxVer > selfVer {
 		return false, s.peer.peers
 	}
@@ -107,32 +111,41 @@ func (s *Syncer) MetaJSON() (*Meta, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	log := s.log
-	meta := &Meta{
-		Metas: make(map[string]string),
+	metas, err := s.metas()
+	if err != nil {
+		return nil, err
 	}
-
-	if err := filepath.Walk(s.metadir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			log.Error("syncer.meta.json.walk.read.file[%s].error:%+v", path, err)
-			return err
+	for name := range metas {
+		if strings.HasSuffix(name, "/") {
+			delete(metas, name)
 		}
+	}
+	s.log.Warning("syncer.get.meta.json:%+v", metas)
+	return &Meta{Metas: metas}, nil
+}
 
-		if !info.IsDir() {
-			file := strings.TrimPrefix(strings.TrimPrefix(path, s.metadir), "/")
-			data, err := readFile(log, path)
-			if err != nil {
-				log.Error("syncer.meta.json.walk.read.file[%s].error:%+v", path, err)
-				return err
-			}
-			meta.Metas[file] = data
-		}
-		return nil
-	}); err != nil {
+// metas reads the keys of the store except the local ones.
+func (s *Syncer) metas() (map[string]string, error) {
+	kvs, err := s.store.List("")
+	if err != nil {
+		s.log.Error("syncer.meta.list.store.error:%+v", err)
 		return nil, err
 	}
-	log.Warning("syncer.get.meta.json:%+v", meta.Metas)
-	return meta, nil
+
+	metas := make(map[string]string)
+	for _, kv := range kvs {
+		// The ddl jobs and raft state are local to the node, the locks are leases rather than the metadata.
+		if kv.Key == config.DDLJobsJSONFile || kv.Key == raftJSONFile || kv.Key == lockJSONFile || kv.Key == leaderJSONFile {
+			continue
+		}
+		// The snapshots of the meta history are recorded by every peer itself.
+		if metastore.IsHistoryKey(kv.Key) {
+			continue
+		}
+		// The dir of database is kept with the suffix '/', even it's empty.
+		metas[kv.Key] = string(kv.Value)
+	}
+	return metas, nil
 }
 
 // MetaRebuild use to re-build the metadir infos from the meta json.
@@ -164,6 +177,16 @@ func (s *Syncer) MetaRebuild(meta *Meta) {
 		}
 		log.Warning("syncer.meta.rebuild.create.file[%s].done...", file)
 	}
+
+	// Keep the local ddl jobs and raft state.
+	for _, name := range []string{config.DDLJobsJSONFile, raftJSONFile} {
+		file := path.Join(backupMetaDir, name)
+		if _, err := os.Stat(file); err == nil {
+			if data, err := readFile(log, file); err == nil {
+				writeFile(log, path.Join(s.metadir, name), data)
+			}
+		}
+	}
 	log.Warning("syncer.meta.rebuild.all.done...")
 }
 
@@ -14,9 +14,9 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
-	"time"
 
 	"config"
+	"metastore"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/xlog"
@@ -35,7 +35,7 @@ func TestMeta(t *testing.T) {
 	defer testRemoveMetadir()
 
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
-	syncer := NewSyncer(log, testMetadir, "", nil, nil)
+	syncer := NewSyncer(log, testMetadir, metastore.NewFileStore(testMetadir), "", nil, nil)
 	assert.NotNil(t, syncer)
 
 	err := syncer.Init()
@@ -80,15 +80,62 @@ func TestMeta(t *testing.T) {
 	}
 }
 
+func TestMetaDDLJobsLocal(t *testing.T) {
+	defer testRemoveMetadir()
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	syncer := NewSyncer(log, testMetadir, metastore.NewFileStore(testMetadir), "", nil, nil)
+	assert.NotNil(t, syncer)
+
+	err := syncer.Init()
+	assert.Nil(t, err)
+
+	ddlJobsFile := path.Join(testMetadir, config.DDLJobsJSONFile)
+	err = writeFile(log, ddlJobsFile, "ddljobs")
+	assert.Nil(t, err)
+
+	// MetaJson without the ddl jobs.
+	{
+		got, err := syncer.MetaJSON()
+		assert.Nil(t, err)
+		_, ok := got.Metas[config.DDLJobsJSONFile]
+		assert.False(t, ok)
+	}
+
+	// Rebuild keeps the ddl jobs.
+	{
+		meta := &Meta{
+			Metas: map[string]string{
+				"version.json":   "12345",
+				"sbtest/t1.json": "t1.json",
+			},
+		}
+		syncer.MetaRebuild(meta)
+		data, err := readFile(log, ddlJobsFile)
+		assert.Nil(t, err)
+		assert.Equal(t, "ddljobs", data)
+	}
+}
+
 func TestMetaError(t *testing.T) {
 	defer testRemoveMetadir()
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
-	syncer := NewSyncer(log, testMetadir, "", nil, nil)
+	syncer := NewSyncer(log, testMetadir, metastore.NewFileStore(testMetadir), "", nil, nil)
 	assert.NotNil(t, syncer)
 
-	// MetaJson.
+	// MetaJson, the metadir not exists.
 	{
-		_, err := syncer.MetaJSON()
+		meta, err := syncer.MetaJSON()
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(meta.Metas))
+	}
+
+	// MetaJson, the metadir is a file.
+	{
+		os.MkdirAll(testDirRm, 0777)
+		err := writeFile(log, testMetadir, "")
+		assert.Nil(t, err)
+		_, err = syncer.MetaJSON()
 		assert.NotNil(t, err)
 	}
 }
@@ -121,7 +168,7 @@ func TestMetaVersionCheck(t *testing.T) {
 	checked, _ := syncer0.MetaVersionCheck()
 	assert.False(t, checked)
 
-	time.Sleep(time.Second * 2)
+	assert.True(t, mockWaitSynced(log, syncers...))
 	checked, _ = syncer0.MetaVersionCheck()
 	assert.True(t, checked)
 }
@@ -12,6 +12,7 @@ import (
 
 	"backend"
 	"config"
+	"metastore"
 	"router"
 
 	"github.com/ant0ine/go-json-rest/rest"
@@ -19,6 +20,12 @@ import (
 )
 
 func mockSyncer(log *xlog.Log, n int) ([]*Syncer, func()) {
+	syncers, _, cleanup := mockSyncerWithStop(log, n)
+	return syncers, cleanup
+}
+
+// mockSyncerWithStop mocks n peers over loopback, the stop func used to stop the ith peer like it's crashed.
+func mockSyncerWithStop(log *xlog.Log, n int) ([]*Syncer, func(i int), func()) {
 	var peers []string
 	var httpServers []*http.Server
 	var syncers []*Syncer
@@ -38,16 +45,19 @@ func mockSyncer(log *xlog.Log, n int) ([]*Syncer, func()) {
 		os.Mkdir(metadir, 0777)
 		peerAddr := fmt.Sprintf("127.0.0.1:%d", 8081+i)
 
+		// The changes after the syncer initialized are committed by the raft.
+		store := NewReplicatedStore(metastore.NewFileStore(metadir))
+
 		// scatter.
 		conf1 := backend.MockBackendConfigDefault(fmt.Sprintf("node%d", i), peerAddr)
-		scatter := backend.NewScatter(log, metadir)
+		scatter := backend.NewScatterWithStore(log, store)
 		if err := scatter.Add(conf1); err != nil {
 			log.Panicf("mock.syncer.error:%+v", err)
 		}
 		scatter.FlushConfig()
 
 		// router.
-		router := router.NewRouter(log, metadir, config.DefaultRouterConfig())
+		router := router.NewRouterWithStore(log, store, config.DefaultRouterConfig())
 		db := fmt.Sprintf("sbtest%d", i)
 		router.CreateDatabase(db)
 
@@ -56,7 +66,7 @@ func mockSyncer(log *xlog.Log, n int) ([]*Syncer, func()) {
 			log.Panicf("mock.syncer.error:%+v", err)
 		}
 
-		syncer := NewSyncer(log, metadir, peerAddr, router, scatter)
+		syncer := NewSyncer(log, metadir, store, peerAddr, router, scatter)
 		syncer.Init()
 		syncers = append(syncers, syncer)
 		peers = append(peers, peerAddr)
@@ -73,26 +83,79 @@ func mockSyncer(log *xlog.Log, n int) ([]*Syncer, func()) {
 		}
 	}
 
-	return syncers, func() {
+	stopped := make(map[int]bool)
+	stop := func(i int) {
+		stopped[i] = true
+		syncers[i].Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServers[i].Shutdown(ctx)
+	}
+
+	return syncers, stop, func() {
 		// Check the SHA of the syncers's metadir.
 		var oldSha1 [20]byte
+		first := true
 		for i := 0; i < n; i++ {
 			syncer := syncers[i]
-			sha1 := mockSHA(log, syncer)
-			if i != 0 {
-				if oldSha1 != sha1 {
-					log.Panic("syncer.mock.check.sha.error:oldsha1[%+v],sha1:[%+v]", oldSha1, sha1)
+			if !stopped[i] {
+				sha1 := mockSHA(log, syncer)
+				if !first {
+					if oldSha1 != sha1 {
+						log.Panic("syncer.mock.check.sha.error:oldsha1[%+v],sha1:[%+v]", oldSha1, sha1)
+					}
 				}
+				oldSha1 = sha1
+				first = false
+				stop(i)
 			}
-			oldSha1 = sha1
-			syncer.Close()
 			os.RemoveAll(syncer.metadir + "/")
+		}
+	}
+}
 
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
-			httpServers[i].Shutdown(ctx)
+// mockWaitSynced waits until the metadirs of the syncers are the same.
+func mockWaitSynced(log *xlog.Log, syncers ...*Syncer) bool {
+	// The lock makes sure the applied changes are reloaded.
+	sha := func(syncer *Syncer) [20]byte {
+		syncer.RLock()
+		defer syncer.RUnlock()
+		return mockSHA(log, syncer)
+	}
+	for i := 0; i < 300; i++ {
+		synced := true
+		sha1 := sha(syncers[0])
+		for _, syncer := range syncers[1:] {
+			if sha(syncer) != sha1 {
+				synced = false
+				break
+			}
 		}
+		if synced {
+			return true
+		}
+		time.Sleep(time.Millisecond * 100)
 	}
+	return false
+}
+
+// mockWaitLeader waits until the syncers agree on a leader which is not the old one.
+func mockWaitLeader(old string, syncers ...*Syncer) string {
+	for i := 0; i < 300; i++ {
+		leader := syncers[0].RaftStatus().Leader
+		agreed := leader != "" && leader != old
+		for _, syncer := range syncers[1:] {
+			if syncer.RaftStatus().Leader != leader {
+				agreed = false
+				break
+			}
+		}
+		if agreed {
+			return leader
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+	return ""
 }
 
 type mockHandler func(log *xlog.Log, syncer *Syncer) rest.HandlerFunc
@@ -104,6 +167,11 @@ func mockHTTP(log *xlog.Log, syncer *Syncer, version mockHandler, metas mockHand
 	router, err := rest.MakeRouter(
 		rest.Get("/v1/meta/versions", version(log, syncer)),
 		rest.Get("/v1/meta/metas", metas(log, syncer)),
+		rest.Post("/v1/meta/raft/vote", mockRaftVote(log, syncer)),
+		rest.Post("/v1/meta/raft/append", mockRaftAppend(log, syncer)),
+		rest.Post("/v1/meta/raft/propose", mockRaftPropose(log, syncer)),
+		rest.Post("/v1/meta/lock", mockLock(log, syncer)),
+		rest.Get("/v1/meta/raft", mockRaftStatus(log, syncer)),
 	)
 	if err != nil {
 		log.Panicf("mock.rest.make.router.error:%+v", err)
@@ -144,10 +212,80 @@ func mockMetas(log *xlog.Log, syncer *Syncer) rest.HandlerFunc {
 	return f
 }
 
+func mockRaftStatus(log *xlog.Log, syncer *Syncer) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(syncer.RaftStatus())
+	}
+	return f
+}
+
+func mockRaftVote(log *xlog.Log, syncer *Syncer) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		req := &VoteRequest{}
+		if err := r.DecodeJsonPayload(req); err != nil {
+			rest.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteJson(syncer.RaftVote(req))
+	}
+	return f
+}
+
+func mockRaftAppend(log *xlog.Log, syncer *Syncer) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		req := &AppendRequest{}
+		if err := r.DecodeJsonPayload(req); err != nil {
+			rest.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteJson(syncer.RaftAppend(req))
+	}
+	return f
+}
+
+func mockRaftPropose(log *xlog.Log, syncer *Syncer) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		entry := &Entry{}
+		if err := r.DecodeJsonPayload(entry); err != nil {
+			rest.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		rsp, err := syncer.RaftPropose(entry)
+		if err != nil {
+			rest.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteJson(rsp)
+	}
+	return f
+}
+
+func mockLock(log *xlog.Log, syncer *Syncer) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		req := &LockRequest{}
+		if err := r.DecodeJsonPayload(req); err != nil {
+			rest.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		rsp, err := syncer.HandleLock(req)
+		if err != nil {
+			rest.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteJson(rsp)
+	}
+	return f
+}
+
 func mockSHA(log *xlog.Log, syncer *Syncer) [20]byte {
 	var datas []byte
 	if err := filepath.Walk(syncer.metadir, func(path string, info os.FileInfo, err error) error {
-		if !info.IsDir() {
+		// The meta history is local to the peer.
+		if err == nil && info.IsDir() && info.Name()+"/" == metastore.HistoryPrefix {
+			return filepath.SkipDir
+		}
+		// The raft state is local to the peer.
+		if err == nil && !info.IsDir() && info.Name() != raftJSONFile {
 			data, err := readFile(log, path)
 			if err != nil {
 				log.Panicf("mock.sha.read.error:%+v", err)
@@ -12,10 +12,10 @@ import (
 	"encoding/json"
 	"errors"
 	"monitor"
-	"os"
-	"path"
 	"sync"
 
+	"metastore"
+
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -26,21 +26,21 @@ const (
 
 // Peer tuple.
 type Peer struct {
-	log     *xlog.Log
-	metadir string
-	peers   []string
+	log   *xlog.Log
+	store metastore.Store
+	peers []string
 
 	// host:port
 	self string
 	mu   sync.Mutex
 }
 
-// NewPeer creates a new peer.
-func NewPeer(log *xlog.Log, metadir string, self string) *Peer {
+// NewPeer creates a new peer which stores the peers in the store.
+func NewPeer(log *xlog.Log, store metastore.Store, self string) *Peer {
 	return &Peer{
-		log:     log,
-		self:    self,
-		metadir: metadir,
+		log:   log,
+		self:  self,
+		store: store,
 	}
 }
 
@@ -50,8 +50,7 @@ func (p *Peer) LoadConfig() error {
 	defer p.mu.Unlock()
 
 	log := p.log
-	file := path.Join(p.metadir, peersJSONFile)
-	if _, err := os.Stat(file); os.IsNotExist(err) {
+	if _, err := p.store.Get(peersJSONFile); err == metastore.ErrNotFound {
 		// peers.json does not exists.
 		p.peers = append(p.peers, p.self)
 		monitor.PeerNumSet(1)
@@ -116,14 +115,14 @@ func (p *Peer) readJSON() ([]string, error) {
 	var peers []string
 	log := p.log
 
-	file := path.Join(p.metadir, peersJSONFile)
-	buf, err := readFile(log, file)
+	file := peersJSONFile
+	kv, err := p.store.Get(file)
 	if err != nil {
 		log.Error("syncer.peer.read.json[%s].error:%+v", file, err)
 		return nil, err
 	}
 
-	err = json.Unmarshal([]byte(buf), &peers)
+	err = json.Unmarshal(kv.Value, &peers)
 	if err != nil {
 		log.Error("syncer.peer.unmarshal.json[%s].error:%+v", file, err)
 		return nil, err
@@ -135,7 +134,7 @@ func (p *Peer) readJSON() ([]string, error) {
 func (p *Peer) writeJSON(peers []string) error {
 	log := p.log
 
-	file := path.Join(p.metadir, peersJSONFile)
+	file := peersJSONFile
 	log.Warning("syncer.peer.write.json[%s].peers[%+v]", file, peers)
 
 	peersJSON, err := json.Marshal(peers)
@@ -144,7 +143,7 @@ func (p *Peer) writeJSON(peers []string) error {
 		return err
 	}
 
-	if err := writeFile(log, file, string(peersJSON)); err != nil {
+	if _, err := p.store.Put(file, peersJSON, metastore.RevisionAny); err != nil {
 		log.Error("syncer.peer.write.json[%s].error:%+v", file, err)
 		return err
 	}
@@ -12,6 +12,8 @@ import (
 	"os"
 	"testing"
 
+	"metastore"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
@@ -33,7 +35,7 @@ func TestPeer(t *testing.T) {
 	}
 	defer testRemovePeerdir()
 
-	peer := NewPeer(log, testPeerdir, "192.168.0.1:8080")
+	peer := NewPeer(log, metastore.NewFileStore(testPeerdir), "192.168.0.1:8080")
 	assert.NotNil(t, peer)
 
 	// peer.json not exist
@@ -86,7 +88,7 @@ func TestPeerError(t *testing.T) {
 	defer testRemovePeerdir()
 
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
-	peer := NewPeer(log, testPeerdir, "192.168.0.1:8080")
+	peer := NewPeer(log, metastore.NewFileStore(testPeerdir), "192.168.0.1:8080")
 
 	// Dir not exist, add fail.
 	{
@@ -0,0 +1,879 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package syncer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"metastore"
+	"xbase"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const (
+	// raftJSONFile file name, it's local to the node and not synced to the peers.
+	raftJSONFile = "raft.json"
+
+	// raftVoteRestURL url.
+	raftVoteRestURL = "v1/meta/raft/vote"
+
+	// raftAppendRestURL url.
+	raftAppendRestURL = "v1/meta/raft/append"
+
+	// raftProposeRestURL url.
+	raftProposeRestURL = "v1/meta/raft/propose"
+
+	// raftStatusRestURL url.
+	raftStatusRestURL = "v1/meta/raft"
+
+	raftHeartbeat        = time.Millisecond * 100
+	raftElectionTimeout  = time.Millisecond * 1000 // randomized in [1s, 2s)
+	raftMaxAppendEntries = 64
+	raftMaxLogEntries    = 1024
+)
+
+const (
+	// RaftFollower role.
+	RaftFollower = "follower"
+
+	// RaftCandidate role.
+	RaftCandidate = "candidate"
+
+	// RaftLeader role.
+	RaftLeader = "leader"
+)
+
+// Entry is a metadata change in the replicated log.
+// The Puts and Deletes are the files relative to the metadir.
+type Entry struct {
+	Index uint64 `json:"index"`
+	Term  uint64 `json:"term"`
+	// Leader is the leader who appended the entry, with the Term it identifies the entry
+	// even if two clusters with their own logs are merged.
+	Leader  string            `json:"leader"`
+	Origin  string            `json:"origin,omitempty"`
+	Puts    map[string]string `json:"puts,omitempty"`
+	Deletes []string          `json:"deletes,omitempty"`
+	// Expects are the values of the files the changes are based on, nil if the file does not exist.
+	// The entry is rejected at the apply if any of them is changed in the state machine.
+	Expects map[string]*string `json:"expects,omitempty"`
+}
+
+// rejected returns true if the state machine does not match the expected values of the entry.
+func (e *Entry) rejected(metas map[string]string) bool {
+	for file, expect := range e.Expects {
+		data, ok := metas[file]
+		if ok != (expect != nil) || (ok && data != *expect) {
+			return true
+		}
+	}
+	return false
+}
+
+// Snapshot is the metadata at the index of the log.
+type Snapshot struct {
+	Index  uint64            `json:"index"`
+	Term   uint64            `json:"term"`
+	Leader string            `json:"leader"`
+	Metas  map[string]string `json:"metas"`
+}
+
+// VoteRequest tuple.
+type VoteRequest struct {
+	Term      uint64 `json:"term"`
+	Candidate string `json:"candidate"`
+	LastIndex uint64 `json:"last-index"`
+	LastTerm  uint64 `json:"last-term"`
+}
+
+// VoteResponse tuple.
+type VoteResponse struct {
+	Term    uint64 `json:"term"`
+	Granted bool   `json:"granted"`
+}
+
+// AppendRequest tuple.
+type AppendRequest struct {
+	Term       uint64    `json:"term"`
+	Leader     string    `json:"leader"`
+	PrevIndex  uint64    `json:"prev-index"`
+	PrevTerm   uint64    `json:"prev-term"`
+	PrevLeader string    `json:"prev-leader"`
+	Entries    []*Entry  `json:"entries"`
+	Commit     uint64    `json:"commit"`
+	Snapshot   *Snapshot `json:"snapshot,omitempty"`
+}
+
+// AppendResponse tuple.
+// The Conflict is set if the applied entries conflict with the leader, the leader sends its snapshot.
+type AppendResponse struct {
+	Term      uint64 `json:"term"`
+	Success   bool   `json:"success"`
+	Conflict  bool   `json:"conflict,omitempty"`
+	LastIndex uint64 `json:"last-index"`
+}
+
+// ProposeResponse tuple.
+type ProposeResponse struct {
+	Index uint64 `json:"index"`
+	Term  uint64 `json:"term"`
+}
+
+// RaftStatus tuple.
+type RaftStatus struct {
+	Self      string `json:"self"`
+	Leader    string `json:"leader"`
+	Role      string `json:"role"`
+	Term      uint64 `json:"term"`
+	Commit    uint64 `json:"commit"`
+	Applied   uint64 `json:"applied"`
+	LastIndex uint64 `json:"last-index"`
+	Reloaded  uint64 `json:"reloaded"` // the applied index which changes are reloaded by the syncer
+}
+
+// raftState is persisted to the raft.json.
+type raftState struct {
+	Term     uint64    `json:"term"`
+	VotedFor string    `json:"voted-for"`
+	Snapshot *Snapshot `json:"snapshot"`
+	Entries  []*Entry  `json:"entries"`
+	// Metas is the state machine at the Applied.
+	Applied uint64            `json:"applied"`
+	Metas   map[string]string `json:"metas"`
+}
+
+// Raft replicates the metadata changes to the peers through a log with a leader,
+// the committed entries are applied in the same order on every peer.
+// The members are the peers of the syncer, one membership change at a time.
+type Raft struct {
+	mu     sync.Mutex
+	wg     sync.WaitGroup
+	log    *xlog.Log
+	file   string
+	self   string
+	peers  func() []string
+	client *xbase.HTTPClient
+	done   chan bool
+	ticker *time.Ticker
+
+	state      raftState
+	role       string
+	leader     string
+	commit     uint64
+	deadline   time.Time
+	rand       *rand.Rand
+	votes      map[string]bool
+	nextIndex  map[string]uint64
+	matchIndex map[string]uint64
+	acks       map[string]time.Time
+	inflight   map[string]bool
+	// snapshots are the peers whose applied entries conflict, they need the snapshot of the applied state.
+	snapshots map[string]bool
+
+	// installedFrom is the state machine before the snapshot installed, nil if no snapshot to apply.
+	installedFrom map[string]string
+}
+
+// NewRaft creates the new raft.
+func NewRaft(log *xlog.Log, metadir string, self string, peers func() []string) *Raft {
+	return &Raft{
+		log:   log,
+		file:  path.Join(metadir, raftJSONFile),
+		self:  self,
+		peers: peers,
+		done:  make(chan bool),
+		role:  RaftFollower,
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+		state: raftState{
+			Snapshot: &Snapshot{Metas: make(map[string]string)},
+			Metas:    make(map[string]string),
+		},
+	}
+}
+
+// Init used to load the state from the file and start the raft thread.
+func (r *Raft) Init() error {
+	log := r.log
+
+	if _, err := os.Stat(r.file); err == nil {
+		data, err := readFile(log, r.file)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(data), &r.state); err != nil {
+			log.Error("syncer.raft.unmarshal.json[%s].error:%+v", r.file, err)
+			return err
+		}
+		if r.state.Metas == nil {
+			r.state.Metas = make(map[string]string)
+		}
+		// The applied entries are committed.
+		r.commit = r.state.Applied
+	}
+	r.resetDeadline()
+	// The single peer is elected at once.
+	if peers := r.peers(); len(peers) == 1 && peers[0] == r.self {
+		r.campaign(peers)
+	}
+	log.Info("syncer.raft.init.term[%d].applied[%d].last.index[%d]", r.state.Term, r.state.Applied, r.lastIndex())
+
+	r.ticker = time.NewTicker(raftHeartbeat)
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer r.ticker.Stop()
+
+		for {
+			select {
+			case <-r.ticker.C:
+				r.tick()
+			case <-r.done:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Close used to stop the raft thread.
+func (r *Raft) Close() {
+	close(r.done)
+	r.wg.Wait()
+}
+
+// Status returns the status of the raft.
+func (r *Raft) Status() *RaftStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &RaftStatus{
+		Self:      r.self,
+		Leader:    r.leader,
+		Role:      r.role,
+		Term:      r.state.Term,
+		Commit:    r.commit,
+		Applied:   r.state.Applied,
+		LastIndex: r.lastIndex(),
+	}
+}
+
+// Metas returns a copy of the state machine and the applied index.
+func (r *Raft) Metas() (map[string]string, uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return copyMetas(r.state.Metas), r.state.Applied
+}
+
+// Propose used to append the entry to the log of the leader, returns the index of the entry.
+func (r *Raft) Propose(entry *Entry) (*ProposeResponse, error) {
+	r.mu.Lock()
+	leader := r.leader
+	r.mu.Unlock()
+
+	switch leader {
+	case "":
+		return nil, errors.New("syncer.raft.no.leader")
+	case r.self:
+		return r.HandlePropose(entry)
+	}
+	rsp := &ProposeResponse{}
+	if err := raftCall(r.client, leader, raftProposeRestURL, entry, rsp); err != nil {
+		return nil, err
+	}
+	return rsp, nil
+}
+
+// Apply used to apply the committed entries to the state machine in order,
+// the fn is called with the changes before they are applied, the rejected entry changes nothing.
+func (r *Raft) Apply(fn func(entry *Entry, rejected bool)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log := r.log
+	if r.installedFrom == nil && r.state.Applied >= r.commit {
+		return
+	}
+	if r.installedFrom != nil {
+		fn(diffMetas(r.installedFrom, r.state.Metas), false)
+		r.installedFrom = nil
+	}
+	for r.state.Applied < r.commit {
+		entry := r.entryAt(r.state.Applied + 1)
+		if entry == nil {
+			break
+		}
+		rejected := entry.rejected(r.state.Metas)
+		fn(entry, rejected)
+		r.state.Applied = entry.Index
+		if rejected {
+			log.Warning("syncer.raft.entry.index[%d].term[%d].is.rejected.by.the.expects", entry.Index, entry.Term)
+			continue
+		}
+		for file, data := range entry.Puts {
+			r.state.Metas[file] = data
+		}
+		for _, file := range entry.Deletes {
+			delete(r.state.Metas, file)
+			// Deleting the dir key removes all the keys under it.
+			if metastore.IsDir(file) {
+				for name := range r.state.Metas {
+					if strings.HasPrefix(name, file) {
+						delete(r.state.Metas, name)
+					}
+				}
+			}
+		}
+	}
+	r.compact()
+	r.save()
+}
+
+// HandleVote handles the vote request from the candidate.
+func (r *Raft) HandleVote(req *VoteRequest) *VoteResponse {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if req.Term > r.state.Term {
+		r.becomeFollower(req.Term, "")
+	}
+	granted := false
+	if req.Term == r.state.Term && (r.state.VotedFor == "" || r.state.VotedFor == req.Candidate) {
+		lastTerm, _ := r.termAt(r.lastIndex())
+		if req.LastTerm > lastTerm || (req.LastTerm == lastTerm && req.LastIndex >= r.lastIndex()) {
+			granted = true
+			r.state.VotedFor = req.Candidate
+			r.resetDeadline()
+		}
+	}
+	r.save()
+	return &VoteResponse{Term: r.state.Term, Granted: granted}
+}
+
+// HandleAppend handles the append request from the leader.
+func (r *Raft) HandleAppend(req *AppendRequest) *AppendResponse {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log := r.log
+	if req.Term < r.state.Term {
+		return &AppendResponse{Term: r.state.Term, LastIndex: r.lastIndex()}
+	}
+	if req.Term == r.state.Term && (r.role == RaftLeader || (r.leader != "" && r.leader != req.Leader)) {
+		// Two leaders in the same term, the clusters with their own logs are merging.
+		// Move to the next term and elect again.
+		log.Warning("syncer.raft.another.leader[%s].in.term[%d].leader[%s]", req.Leader, req.Term, r.leader)
+		r.becomeFollower(req.Term+1, "")
+		r.save()
+		return &AppendResponse{Term: r.state.Term, LastIndex: r.lastIndex()}
+	}
+
+	before := r.fingerprint()
+	defer func() {
+		if r.fingerprint() != before {
+			r.save()
+		}
+	}()
+	r.becomeFollower(req.Term, req.Leader)
+	r.resetDeadline()
+
+	if snap := req.Snapshot; snap != nil {
+		// The snapshot is installed if it's newer or the applied entry at its index conflicts.
+		if term, leader := r.termAt(snap.Index); snap.Index > r.state.Applied || term != snap.Term || leader != snap.Leader {
+			r.installSnapshot(snap)
+		}
+	}
+
+	fail := &AppendResponse{Term: r.state.Term}
+	if req.PrevIndex > r.lastIndex() {
+		fail.LastIndex = r.lastIndex()
+		return fail
+	}
+	if req.PrevIndex > r.state.Snapshot.Index {
+		if term, leader := r.termAt(req.PrevIndex); term != req.PrevTerm || leader != req.PrevLeader {
+			fail.Conflict = !r.truncate(req.PrevIndex)
+			fail.LastIndex = r.lastIndex()
+			return fail
+		}
+	}
+
+	for _, entry := range req.Entries {
+		if entry.Index <= r.state.Snapshot.Index {
+			continue
+		}
+		if entry.Index <= r.lastIndex() {
+			if term, leader := r.termAt(entry.Index); term == entry.Term && leader == entry.Leader {
+				continue
+			}
+			if !r.truncate(entry.Index) {
+				fail.Conflict = true
+				fail.LastIndex = r.lastIndex()
+				return fail
+			}
+		}
+		r.state.Entries = append(r.state.Entries, entry)
+	}
+
+	last := req.PrevIndex + uint64(len(req.Entries))
+	if last < r.state.Snapshot.Index {
+		last = r.state.Snapshot.Index
+	}
+	if commit := req.Commit; commit > r.commit {
+		if commit > last {
+			commit = last
+		}
+		if commit > r.commit {
+			r.commit = commit
+		}
+	}
+	return &AppendResponse{Term: r.state.Term, Success: true, LastIndex: last}
+}
+
+// HandlePropose appends the entry to the log if it's the leader.
+func (r *Raft) HandlePropose(entry *Entry) (*ProposeResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.role != RaftLeader {
+		return nil, errors.Errorf("syncer.raft[%s].is.not.the.leader[%s]", r.self, r.leader)
+	}
+	entry.Index = r.lastIndex() + 1
+	entry.Term = r.state.Term
+	entry.Leader = r.self
+	r.state.Entries = append(r.state.Entries, entry)
+	r.save()
+	r.advanceCommit(r.peers())
+	return &ProposeResponse{Index: entry.Index, Term: entry.Term}, nil
+}
+
+func (r *Raft) tick() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log := r.log
+	peers := r.peers()
+	switch r.role {
+	case RaftLeader:
+		if !r.checkQuorum(peers) {
+			log.Warning("syncer.raft.leader[%s].lost.the.quorum.of[%v]", r.self, peers)
+			r.becomeFollower(r.state.Term, "")
+			r.resetDeadline()
+			return
+		}
+		r.advanceCommit(peers)
+		for _, peer := range peers {
+			if peer == r.self || r.inflight[peer] {
+				continue
+			}
+			r.inflight[peer] = true
+			req := r.appendRequest(peer)
+			r.wg.Add(1)
+			go r.sendAppend(peer, req)
+		}
+	default:
+		if time.Now().After(r.deadline) && contains(peers, r.self) {
+			r.campaign(peers)
+		}
+	}
+}
+
+func (r *Raft) campaign(peers []string) {
+	log := r.log
+	r.state.Term++
+	r.state.VotedFor = r.self
+	r.role = RaftCandidate
+	r.leader = ""
+	r.votes = map[string]bool{r.self: true}
+	r.resetDeadline()
+	r.save()
+	log.Warning("syncer.raft[%s].campaign.term[%d].peers[%v]", r.self, r.state.Term, peers)
+
+	if len(r.votes) >= quorum(peers) {
+		r.becomeLeader(peers)
+		return
+	}
+	lastTerm, _ := r.termAt(r.lastIndex())
+	req := &VoteRequest{
+		Term:      r.state.Term,
+		Candidate: r.self,
+		LastIndex: r.lastIndex(),
+		LastTerm:  lastTerm,
+	}
+	for _, peer := range peers {
+		if peer != r.self {
+			r.wg.Add(1)
+			go r.sendVote(peer, req)
+		}
+	}
+}
+
+func (r *Raft) sendVote(peer string, req *VoteRequest) {
+	defer r.wg.Done()
+	rsp := &VoteResponse{}
+	if err := raftCall(r.client, peer, raftVoteRestURL, req, rsp); err != nil {
+		r.log.Error("syncer.raft.vote.to[%s].error:%+v", peer, err)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if rsp.Term > r.state.Term {
+		r.becomeFollower(rsp.Term, "")
+		r.save()
+		return
+	}
+	if r.role != RaftCandidate || r.state.Term != req.Term || !rsp.Granted {
+		return
+	}
+	r.votes[peer] = true
+	if peers := r.peers(); len(r.votes) >= quorum(peers) {
+		r.becomeLeader(peers)
+	}
+}
+
+func (r *Raft) sendAppend(peer string, req *AppendRequest) {
+	defer r.wg.Done()
+	rsp := &AppendResponse{}
+	err := raftCall(r.client, peer, raftAppendRestURL, req, rsp)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.inflight, peer)
+	if err != nil {
+		r.log.Error("syncer.raft.append.to[%s].error:%+v", peer, err)
+		return
+	}
+	if rsp.Term > r.state.Term {
+		r.becomeFollower(rsp.Term, "")
+		r.resetDeadline()
+		r.save()
+		return
+	}
+	if r.role != RaftLeader || r.state.Term != req.Term {
+		return
+	}
+	r.acks[peer] = time.Now()
+	if rsp.Success {
+		if rsp.LastIndex > r.matchIndex[peer] {
+			r.matchIndex[peer] = rsp.LastIndex
+		}
+		r.nextIndex[peer] = r.matchIndex[peer] + 1
+		r.advanceCommit(r.peers())
+		return
+	}
+	if rsp.Conflict {
+		r.log.Warning("syncer.raft.peer[%s].conflicts.with.the.applied.entries.send.the.snapshot", peer)
+		r.snapshots[peer] = true
+		return
+	}
+	next := r.nextIndex[peer] - 1
+	if rsp.LastIndex+1 < next {
+		next = rsp.LastIndex + 1
+	}
+	if next < 1 {
+		next = 1
+	}
+	r.nextIndex[peer] = next
+}
+
+func (r *Raft) appendRequest(peer string) *AppendRequest {
+	next, ok := r.nextIndex[peer]
+	if !ok {
+		next = r.lastIndex() + 1
+		r.nextIndex[peer] = next
+	}
+	req := &AppendRequest{
+		Term:   r.state.Term,
+		Leader: r.self,
+		Commit: r.commit,
+	}
+	switch {
+	case r.snapshots[peer]:
+		// The snapshot of the applied state replaces the conflicting entries of the peer.
+		term, leader := r.termAt(r.state.Applied)
+		req.Snapshot = &Snapshot{
+			Index:  r.state.Applied,
+			Term:   term,
+			Leader: leader,
+			Metas:  copyMetas(r.state.Metas),
+		}
+		next = r.state.Applied + 1
+		delete(r.snapshots, peer)
+	case next <= r.state.Snapshot.Index:
+		req.Snapshot = r.state.Snapshot
+		next = r.state.Snapshot.Index + 1
+	}
+	req.PrevIndex = next - 1
+	req.PrevTerm, req.PrevLeader = r.termAt(req.PrevIndex)
+	for i := next; i <= r.lastIndex() && len(req.Entries) < raftMaxAppendEntries; i++ {
+		req.Entries = append(req.Entries, r.entryAt(i))
+	}
+	return req
+}
+
+func (r *Raft) becomeFollower(term uint64, leader string) {
+	if term > r.state.Term {
+		r.state.Term = term
+		r.state.VotedFor = ""
+	}
+	if r.role != RaftFollower || r.leader != leader {
+		r.log.Warning("syncer.raft[%s].become.follower.term[%d].leader[%s]", r.self, r.state.Term, leader)
+	}
+	r.role = RaftFollower
+	r.leader = leader
+}
+
+func (r *Raft) becomeLeader(peers []string) {
+	log := r.log
+	r.role = RaftLeader
+	r.leader = r.self
+	r.nextIndex = make(map[string]uint64)
+	r.matchIndex = make(map[string]uint64)
+	r.acks = make(map[string]time.Time)
+	r.inflight = make(map[string]bool)
+	r.snapshots = make(map[string]bool)
+	now := time.Now()
+	for _, peer := range peers {
+		r.nextIndex[peer] = r.lastIndex() + 1
+		r.acks[peer] = now
+	}
+	// Commit the entries of the previous terms by an entry of the current term.
+	r.state.Entries = append(r.state.Entries, &Entry{
+		Index:  r.lastIndex() + 1,
+		Term:   r.state.Term,
+		Leader: r.self,
+	})
+	r.save()
+	r.advanceCommit(peers)
+	log.Warning("syncer.raft[%s].become.leader.term[%d].peers[%v]", r.self, r.state.Term, peers)
+}
+
+// checkQuorum returns false if the leader is not acked by the majority in the election timeout.
+func (r *Raft) checkQuorum(peers []string) bool {
+	acked := 0
+	for _, peer := range peers {
+		if peer == r.self {
+			acked++
+			continue
+		}
+		ack, ok := r.acks[peer]
+		if !ok {
+			// The new peer.
+			r.acks[peer] = time.Now()
+			ack = r.acks[peer]
+		}
+		if time.Since(ack) < raftElectionTimeout*2 {
+			acked++
+		}
+	}
+	return acked >= quorum(peers)
+}
+
+// advanceCommit commits the entries of the current term replicated to the majority.
+func (r *Raft) advanceCommit(peers []string) {
+	for n := r.lastIndex(); n > r.commit; n-- {
+		if term, _ := r.termAt(n); term != r.state.Term {
+			break
+		}
+		count := 0
+		for _, peer := range peers {
+			if peer == r.self || r.matchIndex[peer] >= n {
+				count++
+			}
+		}
+		if count >= quorum(peers) {
+			r.commit = n
+			return
+		}
+	}
+}
+
+func (r *Raft) installSnapshot(snap *Snapshot) {
+	log := r.log
+	log.Warning("syncer.raft.install.snapshot.index[%d].term[%d]", snap.Index, snap.Term)
+	if r.installedFrom == nil {
+		r.installedFrom = r.state.Metas
+	}
+
+	var entries []*Entry
+	if term, leader := r.termAt(snap.Index); term == snap.Term && leader == snap.Leader {
+		for _, entry := range r.state.Entries {
+			if entry.Index > snap.Index {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	r.state.Snapshot = snap
+	r.state.Entries = entries
+	r.state.Applied = snap.Index
+	r.state.Metas = copyMetas(snap.Metas)
+	if r.commit < snap.Index || r.commit > r.lastIndex() {
+		r.commit = snap.Index
+	}
+}
+
+// truncate removes the entries from the index, it returns false if the entry at the index is applied,
+// the applied entries are kept until the snapshot of the leader is installed.
+func (r *Raft) truncate(index uint64) bool {
+	log := r.log
+	if index <= r.state.Applied || index <= r.state.Snapshot.Index {
+		log.Error("syncer.raft.log.conflict.at[%d].applied[%d].wait.for.the.snapshot", index, r.state.Applied)
+		return false
+	}
+	r.state.Entries = r.state.Entries[:index-r.state.Snapshot.Index-1]
+	if r.commit >= index {
+		r.commit = index - 1
+	}
+	return true
+}
+
+// compact drops the applied entries into the snapshot if the log is too long.
+func (r *Raft) compact() {
+	if len(r.state.Entries) <= raftMaxLogEntries {
+		return
+	}
+	term, leader := r.termAt(r.state.Applied)
+	r.state.Snapshot = &Snapshot{
+		Index:  r.state.Applied,
+		Term:   term,
+		Leader: leader,
+		Metas:  copyMetas(r.state.Metas),
+	}
+	var entries []*Entry
+	for _, entry := range r.state.Entries {
+		if entry.Index > r.state.Applied {
+			entries = append(entries, entry)
+		}
+	}
+	r.state.Entries = entries
+}
+
+func (r *Raft) lastIndex() uint64 {
+	if n := len(r.state.Entries); n > 0 {
+		return r.state.Entries[n-1].Index
+	}
+	return r.state.Snapshot.Index
+}
+
+// termAt returns the term and leader of the entry at the index.
+func (r *Raft) termAt(index uint64) (uint64, string) {
+	if index == r.state.Snapshot.Index {
+		return r.state.Snapshot.Term, r.state.Snapshot.Leader
+	}
+	if entry := r.entryAt(index); entry != nil {
+		return entry.Term, entry.Leader
+	}
+	return 0, ""
+}
+
+func (r *Raft) entryAt(index uint64) *Entry {
+	if index <= r.state.Snapshot.Index || index > r.lastIndex() {
+		return nil
+	}
+	return r.state.Entries[index-r.state.Snapshot.Index-1]
+}
+
+// fingerprint identifies the persistent state to skip the needless save.
+func (r *Raft) fingerprint() string {
+	term, leader := r.termAt(r.lastIndex())
+	return fmt.Sprintf("%d/%s/%d/%d/%s/%d/%d", r.state.Term, r.state.VotedFor, r.lastIndex(), term, leader, r.state.Snapshot.Index, r.state.Applied)
+}
+
+func (r *Raft) resetDeadline() {
+	r.deadline = time.Now().Add(raftElectionTimeout + time.Duration(r.rand.Int63n(int64(raftElectionTimeout))))
+}
+
+func (r *Raft) save() {
+	log := r.log
+	data, err := json.Marshal(&r.state)
+	if err != nil {
+		log.Error("syncer.raft.marshal.json[%s].error:%+v", r.file, err)
+		return
+	}
+	writeFile(log, r.file, string(data))
+}
+
+// raftCall posts the request to the peer and decodes the response.
+func raftCall(client *xbase.HTTPClient, peer string, url string, req interface{}, rsp interface{}) error {
+	resp, cleanup, err := client.Post(client.Scheme()+"://"+path.Join(peer, url), req)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	body := xbase.HTTPReadBody(resp)
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("syncer.raft.call[%s/%s].status[%d]:%s", peer, url, resp.StatusCode, body)
+	}
+	return json.Unmarshal([]byte(body), rsp)
+}
+
+func quorum(peers []string) int {
+	return len(peers)/2 + 1
+}
+
+func contains(peers []string, peer string) bool {
+	for _, p := range peers {
+		if p == peer {
+			return true
+		}
+	}
+	return false
+}
+
+func copyMetas(metas map[string]string) map[string]string {
+	c := make(map[string]string, len(metas))
+	for k, v := range metas {
+		c[k] = v
+	}
+	return c
+}
+
+// expectMetas returns the values of the files in the metas as the Expects of the entry.
+func expectMetas(metas map[string]string, files ...string) map[string]*string {
+	expects := make(map[string]*string, len(files))
+	for _, file := range files {
+		var expect *string
+		if data, ok := metas[file]; ok {
+			expect = &data
+		}
+		expects[file] = expect
+	}
+	return expects
+}
+
+// diffMetas returns the changes from the old metas to the new, the snapshots of the meta history
+// are skipped since they are local to the peer, the old logs may still have them.
+func diffMetas(old map[string]string, new map[string]string) *Entry {
+	entry := &Entry{Puts: make(map[string]string)}
+	for file, data := range new {
+		if metastore.IsHistoryKey(file) {
+			continue
+		}
+		if o, ok := old[file]; !ok || o != data {
+			entry.Puts[file] = data
+		}
+	}
+	for file := range old {
+		if metastore.IsHistoryKey(file) {
+			continue
+		}
+		if _, ok := new[file]; !ok {
+			entry.Deletes = append(entry.Deletes, file)
+		}
+	}
+	return entry
+}
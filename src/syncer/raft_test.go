@@ -0,0 +1,286 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package syncer
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"metastore"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestRaftReplicate(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	syncers, cleanup := mockSyncer(log, 3)
+	defer cleanup()
+
+	leader := mockWaitLeader("", syncers...)
+	assert.NotEqual(t, "", leader)
+	assert.True(t, mockWaitSynced(log, syncers...))
+
+	// The concurrent DDLs on two peers are both kept.
+	{
+		r0, r1 := syncers[0].router, syncers[1].router
+		assert.Nil(t, r0.CreateDatabase("db0"))
+		assert.Nil(t, r1.CreateDatabase("db1"))
+		assert.Nil(t, r0.CreateHashTable("db0", "a", "id", "hash", []string{"127.0.0.1:8081"}, nil, nil))
+		assert.Nil(t, r1.CreateHashTable("db1", "b", "id", "hash", []string{"127.0.0.1:8082"}, nil, nil))
+		assert.Nil(t, syncers[1].WaitReloaded(time.Second*5))
+		_, err := syncers[0].router.TableConfig("db1", "b")
+		assert.Nil(t, err)
+		assert.True(t, mockWaitSynced(log, syncers...))
+
+		for _, syncer := range syncers {
+			_, err := syncer.router.TableConfig("db0", "a")
+			assert.Nil(t, err)
+			_, err = syncer.router.TableConfig("db1", "b")
+			assert.Nil(t, err)
+		}
+	}
+
+	// The stale value is rejected at the apply.
+	{
+		// The same value is expected on two peers but only the first commit wins.
+		expects := expectMetas(nil, "x.json")
+		assert.Nil(t, syncers[1].commit(&Entry{Puts: map[string]string{"x.json": "1"}, Expects: expects}))
+		assert.Equal(t, metastore.ErrConflict, syncers[0].commit(&Entry{Puts: map[string]string{"x.json": "2"}, Expects: expects}))
+		assert.True(t, mockWaitSynced(log, syncers...))
+		for _, syncer := range syncers {
+			kv, err := syncer.store.Get("x.json")
+			assert.Nil(t, err)
+			assert.Equal(t, "1", string(kv.Value))
+		}
+
+		// The revision is carried by the ReplicatedStore.
+		store := &ReplicatedStore{Store: syncers[0].store, syncer: syncers[0]}
+		kv, err := store.Get("x.json")
+		assert.Nil(t, err)
+		_, err = store.Put("x.json", []byte("3"), kv.Revision)
+		assert.Nil(t, err)
+		_, err = store.Put("x.json", []byte("4"), kv.Revision)
+		assert.Equal(t, metastore.ErrConflict, err)
+		assert.Nil(t, store.Delete("x.json", metastore.RevisionAny))
+		assert.True(t, mockWaitSynced(log, syncers...))
+	}
+
+	// Drop on a peer.
+	{
+		assert.Nil(t, syncers[2].router.DropDatabase("db0"))
+		assert.True(t, mockWaitSynced(log, syncers...))
+		for _, syncer := range syncers {
+			_, err := syncer.router.TableConfig("db0", "a")
+			assert.NotNil(t, err)
+			_, err = os.Stat(syncer.metadir + "/db0")
+			assert.True(t, os.IsNotExist(err))
+		}
+	}
+
+	// The meta history is local to the peer.
+	{
+		history := metastore.NewHistory(log, syncers[0].router.MetaStore(), 10)
+		snap, err := history.Record("root", "create database db2")
+		assert.Nil(t, err)
+		assert.NotNil(t, snap)
+		assert.Nil(t, syncers[0].router.CreateDatabase("db2"))
+		assert.True(t, mockWaitSynced(log, syncers...))
+
+		for i, syncer := range syncers {
+			kvs, err := syncer.store.List(metastore.HistoryPrefix)
+			assert.Nil(t, err)
+			assert.Equal(t, i == 0, len(kvs) > 0)
+		}
+		entry := diffMetas(map[string]string{"db2/": ""}, map[string]string{"db2/": "", metastore.HistoryPrefix: ""})
+		assert.Equal(t, 0, len(entry.Puts))
+	}
+
+	// The peers are replicated.
+	{
+		assert.Nil(t, syncers[0].AddPeer("127.0.0.1:9901"))
+		assert.Nil(t, syncers[0].RemovePeer("127.0.0.1:9901"))
+		assert.True(t, mockWaitSynced(log, syncers...))
+		want := syncers[0].Peers()
+		for _, syncer := range syncers {
+			assert.Equal(t, want, syncer.Peers())
+		}
+	}
+}
+
+func TestRaftLeaderDown(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	syncers, stop, cleanup := mockSyncerWithStop(log, 3)
+	defer cleanup()
+
+	leader := mockWaitLeader("", syncers...)
+	assert.True(t, mockWaitSynced(log, syncers...))
+
+	var alive []*Syncer
+	for i, syncer := range syncers {
+		if syncer.peer.self == leader {
+			stop(i)
+			continue
+		}
+		alive = append(alive, syncer)
+	}
+
+	newLeader := mockWaitLeader(leader, alive...)
+	assert.NotEqual(t, "", newLeader)
+	assert.NotEqual(t, leader, newLeader)
+
+	assert.Nil(t, alive[0].router.CreateDatabase("db2"))
+	assert.True(t, mockWaitSynced(log, alive...))
+	assert.Nil(t, alive[1].router.CheckDatabase("db2"))
+}
+
+func TestRaftAppendConflict(t *testing.T) {
+	defer testRemoveMetadir()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	os.MkdirAll(testMetadir, 0777)
+	r := NewRaft(log, testMetadir, "127.0.0.1:1", func() []string { return []string{"127.0.0.1:1"} })
+
+	// Elected as a single node.
+	{
+		r.tick()
+		r.deadline = r.deadline.AddDate(-1, 0, 0)
+		r.tick()
+		assert.Equal(t, RaftLeader, r.Status().Role)
+		rsp, err := r.HandlePropose(&Entry{Puts: map[string]string{"a.json": "a"}})
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(2), rsp.Index)
+
+		var got []*Entry
+		r.Apply(func(entry *Entry, rejected bool) { got = append(got, entry) })
+		assert.Equal(t, 2, len(got))
+		metas, applied := r.Metas()
+		assert.Equal(t, uint64(2), applied)
+		assert.Equal(t, map[string]string{"a.json": "a"}, metas)
+	}
+
+	// Another leader in the same term.
+	{
+		rsp := r.HandleAppend(&AppendRequest{Term: 1, Leader: "127.0.0.1:2"})
+		assert.False(t, rsp.Success)
+		assert.Equal(t, uint64(2), rsp.Term)
+		assert.Equal(t, RaftFollower, r.Status().Role)
+	}
+
+	// The applied entries conflict with the leader, they are kept until the snapshot installed.
+	{
+		rsp := r.HandleAppend(&AppendRequest{Term: 3, Leader: "127.0.0.1:2", PrevIndex: 1, PrevTerm: 1, PrevLeader: "127.0.0.1:2"})
+		assert.False(t, rsp.Success)
+		assert.True(t, rsp.Conflict)
+		assert.Equal(t, uint64(2), rsp.LastIndex)
+
+		rsp = r.HandleAppend(&AppendRequest{
+			Term:   3,
+			Leader: "127.0.0.1:2",
+			Entries: []*Entry{
+				{Index: 1, Term: 1, Leader: "127.0.0.1:2", Puts: map[string]string{"b.json": "b"}},
+			},
+			Commit: 1,
+		})
+		assert.False(t, rsp.Success)
+		assert.True(t, rsp.Conflict)
+		metas, applied := r.Metas()
+		assert.Equal(t, uint64(2), applied)
+		assert.Equal(t, map[string]string{"a.json": "a"}, metas)
+
+		// The snapshot of the leader at the applied index.
+		snap := &Snapshot{Index: 1, Term: 1, Leader: "127.0.0.1:2", Metas: map[string]string{"b.json": "b"}}
+		rsp = r.HandleAppend(&AppendRequest{Term: 3, Leader: "127.0.0.1:2", PrevIndex: 1, PrevTerm: 1, PrevLeader: "127.0.0.1:2", Snapshot: snap, Commit: 1})
+		assert.True(t, rsp.Success)
+		var got *Entry
+		r.Apply(func(entry *Entry, rejected bool) { got = entry })
+		assert.Equal(t, map[string]string{"b.json": "b"}, got.Puts)
+		assert.Equal(t, []string{"a.json"}, got.Deletes)
+		metas, applied = r.Metas()
+		assert.Equal(t, uint64(1), applied)
+		assert.Equal(t, map[string]string{"b.json": "b"}, metas)
+	}
+
+	// Install the snapshot.
+	{
+		snap := &Snapshot{Index: 10, Term: 3, Leader: "127.0.0.1:2", Metas: map[string]string{"c.json": "c"}}
+		rsp := r.HandleAppend(&AppendRequest{Term: 3, Leader: "127.0.0.1:2", PrevIndex: 10, PrevTerm: 3, PrevLeader: "127.0.0.1:2", Snapshot: snap, Commit: 10})
+		assert.True(t, rsp.Success)
+		var got *Entry
+		r.Apply(func(entry *Entry, rejected bool) { got = entry })
+		assert.Equal(t, map[string]string{"c.json": "c"}, got.Puts)
+		assert.Equal(t, []string{"b.json"}, got.Deletes)
+		assert.Equal(t, uint64(10), r.Status().Applied)
+	}
+
+	// The state is reloaded from the file.
+	{
+		r2 := NewRaft(log, testMetadir, "127.0.0.1:1", func() []string { return nil })
+		err := r2.Init()
+		assert.Nil(t, err)
+		defer r2.Close()
+		status := r2.Status()
+		assert.Equal(t, uint64(3), status.Term)
+		assert.Equal(t, uint64(10), status.Applied)
+		metas, _ := r2.Metas()
+		assert.Equal(t, map[string]string{"c.json": "c"}, metas)
+	}
+}
+
+func TestRaftEntryRejected(t *testing.T) {
+	defer testRemoveMetadir()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	os.MkdirAll(testMetadir, 0777)
+	r := NewRaft(log, testMetadir, "127.0.0.1:1", func() []string { return []string{"127.0.0.1:1"} })
+	r.tick()
+	r.deadline = r.deadline.AddDate(-1, 0, 0)
+	r.tick()
+	assert.Equal(t, RaftLeader, r.Status().Role)
+
+	_, err := r.HandlePropose(&Entry{Puts: map[string]string{"a.json": "a"}, Expects: expectMetas(nil, "a.json")})
+	assert.Nil(t, err)
+	_, err = r.HandlePropose(&Entry{Puts: map[string]string{"a.json": "b"}, Expects: expectMetas(nil, "a.json")})
+	assert.Nil(t, err)
+	_, err = r.HandlePropose(&Entry{Puts: map[string]string{"a.json": "c"}, Expects: expectMetas(map[string]string{"a.json": "a"}, "a.json")})
+	assert.Nil(t, err)
+	_, err = r.HandlePropose(&Entry{Deletes: []string{"a.json"}, Expects: expectMetas(map[string]string{"a.json": "a"}, "a.json")})
+	assert.Nil(t, err)
+
+	var rejects []bool
+	r.Apply(func(entry *Entry, rejected bool) { rejects = append(rejects, rejected) })
+	assert.Equal(t, []bool{false, false, true, false, true}, rejects)
+	metas, applied := r.Metas()
+	assert.Equal(t, uint64(5), applied)
+	assert.Equal(t, map[string]string{"a.json": "c"}, metas)
+}
+
+func TestRaftNoQuorum(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	syncers, stop, cleanup := mockSyncerWithStop(log, 3)
+	defer cleanup()
+
+	leader := mockWaitLeader("", syncers...)
+	assert.NotEqual(t, "", leader)
+	assert.True(t, mockWaitSynced(log, syncers...))
+
+	// The DDL fails on the minority and nothing is written.
+	var alive *Syncer
+	for i, syncer := range syncers {
+		if alive == nil && syncer.peer.self != leader {
+			alive = syncer
+			continue
+		}
+		stop(i)
+	}
+	err := alive.router.CreateDatabase("db3")
+	assert.NotNil(t, err)
+	assert.NotNil(t, alive.router.CheckDatabase("db3"))
+	_, err = os.Stat(alive.metadir + "/db3")
+	assert.True(t, os.IsNotExist(err))
+}
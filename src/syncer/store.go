@@ -0,0 +1,106 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package syncer
+
+import (
+	"metastore"
+)
+
+// ReplicatedStore writes the metadata through the raft log of the syncer, the changes are written
+// to the underlying store only after they are committed, so the writes fail without the quorum.
+// The writes go to the underlying store directly if it's shared or the syncer is not initialized,
+// so are the snapshots of the meta history which are local to the peer.
+type ReplicatedStore struct {
+	metastore.Store
+	syncer *Syncer
+}
+
+// NewReplicatedStore creates the store on the underlying store, it's bound to the syncer by NewSyncer.
+func NewReplicatedStore(store metastore.Store) *ReplicatedStore {
+	return &ReplicatedStore{Store: store}
+}
+
+// Put writes the key after the change is committed, the revision of the key is carried
+// as the expected value of the entry, and checked again when the entry is applied.
+func (rs *ReplicatedStore) Put(key string, value []byte, revision int64) (int64, error) {
+	if !rs.replicated(key) {
+		return rs.Store.Put(key, value, revision)
+	}
+	expects, err := rs.expects(key, revision)
+	if err != nil {
+		return 0, err
+	}
+	if err := rs.syncer.commit(&Entry{Puts: map[string]string{key: string(value)}, Expects: expects}); err != nil {
+		return 0, err
+	}
+	kv, err := rs.Store.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	return kv.Revision, nil
+}
+
+// Delete removes the key after the change is committed.
+func (rs *ReplicatedStore) Delete(key string, revision int64) error {
+	if !rs.replicated(key) {
+		return rs.Store.Delete(key, revision)
+	}
+	if _, err := rs.Store.Get(key); err != nil {
+		return err
+	}
+	expects, err := rs.expects(key, revision)
+	if err != nil {
+		return err
+	}
+	return rs.syncer.commit(&Entry{Deletes: []string{key}, Expects: expects})
+}
+
+// Batch writes the puts and removes the deletes after they are committed in one entry,
+// so the peers apply them at once.
+func (rs *ReplicatedStore) Batch(puts map[string][]byte, deletes []string) error {
+	if !rs.replicated("") {
+		return rs.Store.Batch(puts, deletes)
+	}
+	entry := &Entry{Puts: make(map[string]string, len(puts)), Deletes: deletes}
+	for key, value := range puts {
+		entry.Puts[key] = string(value)
+	}
+	return rs.syncer.commit(entry)
+}
+
+// replicated returns true if the changes of the key need to be committed by the raft.
+func (rs *ReplicatedStore) replicated(key string) bool {
+	return rs.syncer != nil && !rs.Store.Shared() && rs.syncer.raftStarted() && !metastore.IsHistoryKey(key)
+}
+
+// expects returns the applied value of the key as the Expects of the entry, nil if any revision.
+// It returns ErrConflict if the revision of the key in the store does not match, the entry is rejected
+// with ErrConflict at the apply if another change of the key is committed before it.
+// The expected value is read from the state machine rather than the store, since the local changes
+// of the store may be not proposed yet.
+func (rs *ReplicatedStore) expects(key string, revision int64) (map[string]*string, error) {
+	if revision == metastore.RevisionAny {
+		return nil, nil
+	}
+	kv, err := rs.Store.Get(key)
+	switch err {
+	case nil:
+		if kv.Revision != revision {
+			return nil, metastore.ErrConflict
+		}
+	case metastore.ErrNotFound:
+		if revision != metastore.RevisionNotExist {
+			return nil, metastore.ErrConflict
+		}
+	default:
+		return nil, err
+	}
+	metas, _ := rs.syncer.raft.Metas()
+	return expectMetas(metas, key), nil
+}
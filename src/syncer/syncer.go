@@ -12,14 +12,17 @@ import (
 	"encoding/json"
 	"os"
 	"path"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"backend"
-	"config"
+	"metastore"
 	"router"
 	"xbase"
 
+	"github.com/pkg/errors"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -31,22 +34,70 @@ type Syncer struct {
 	done    chan bool
 	peer    *Peer
 	metadir string
+	store   metastore.Store
+	watcher *metastore.Watcher
 	ticker  *time.Ticker
 	router  *router.Router
 	scatter *backend.Scatter
+	raft    *Raft
+	client  *xbase.HTTPClient
+
+	// proposed is the last proposal of the local changes.
+	proposed ProposeResponse
+
+	// applyMu protects the applying to the store, the changed keys to reload
+	// and the proposals of the ReplicatedStore waiting to be applied.
+	// The reloaded is the applied index which changes are reloaded to the configs.
+	applyMu   sync.Mutex
+	started   bool
+	changed   map[string]bool
+	proposals map[uint64]*proposal
+	reloaded  uint64
+
+	// locks are held by the coordinator, they are cleared when the raft term changed,
+	// lockSince is the time the coordinator starts to handle the locks in the lockTerm.
+	lockMu    sync.Mutex
+	locks     lockTable
+	lockTerm  uint64
+	lockSince time.Time
 }
 
-// NewSyncer creates the new syncer.
-func NewSyncer(log *xlog.Log, metadir string, peerAddr string, router *router.Router, scatter *backend.Scatter) *Syncer {
-	return &Syncer{
-		log:     log,
-		metadir: metadir,
-		router:  router,
-		scatter: scatter,
-		done:    make(chan bool),
-		peer:    NewPeer(log, metadir, peerAddr),
-		ticker:  time.NewTicker(time.Duration(time.Millisecond * 500)), // 0.5s
+// proposal is the change of the ReplicatedStore waiting to be applied.
+type proposal struct {
+	term     uint64
+	applied  bool
+	lost     bool
+	rejected bool
+}
+
+// NewSyncer creates the new syncer, the metadir keeps the local state such as the raft log.
+// If the store is a ReplicatedStore, it's bound to the syncer and the syncer uses the underlying store.
+func NewSyncer(log *xlog.Log, metadir string, store metastore.Store, peerAddr string, router *router.Router, scatter *backend.Scatter) *Syncer {
+	syncer := &Syncer{
+		log:       log,
+		metadir:   metadir,
+		router:    router,
+		scatter:   scatter,
+		done:      make(chan bool),
+		locks:     make(lockTable),
+		changed:   make(map[string]bool),
+		proposals: make(map[uint64]*proposal),
+		ticker:    time.NewTicker(time.Duration(time.Millisecond * 500)), // 0.5s
+	}
+	if rs, ok := store.(*ReplicatedStore); ok {
+		rs.syncer = syncer
+		store = rs.Store
 	}
+	syncer.store = store
+	syncer.peer = NewPeer(log, store, peerAddr)
+	syncer.raft = NewRaft(log, metadir, peerAddr, syncer.peer.Clone)
+	return syncer
+}
+
+// SetHTTPClient used to set the client of the requests to the other peers, it must be called before Init.
+func (s *Syncer) SetHTTPClient(client *xbase.HTTPClient) {
+	s.client = client
+	s.raft.client = client
 }
 
 // Init used to load the peers from the file and start the check thread.
@@ -64,6 +115,40 @@ func (s *Syncer) Init() error {
 	}
 	log.Info("syncer.init.peers:%v", s.peer.peers)
 
+	// The shared store needs no replication, only reload the changes of the other peers.
+	if s.store.Shared() {
+		watcher, err := s.store.Watch("")
+		if err != nil {
+			return err
+		}
+		s.watcher = watcher
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.ticker.Stop()
+
+			for {
+				select {
+				case event := <-watcher.C:
+					s.watch(event)
+				case <-s.done:
+					return
+				}
+			}
+		}()
+		log.Info("syncer.init.shared.store.done")
+		return nil
+	}
+
+	// Raft.
+	if err := s.raft.Init(); err != nil {
+		return err
+	}
+	s.applyMu.Lock()
+	s.started = true
+	s.applyMu.Unlock()
+
 	s.wg.Add(1)
 	go func() {
 		defer s.wg.Done()
@@ -86,6 +171,11 @@ func (s *Syncer) Init() error {
 func (s *Syncer) Close() {
 	close(s.done)
 	s.wg.Wait()
+	if s.watcher != nil {
+		s.watcher.Close()
+		return
+	}
+	s.raft.Close()
 }
 
 // AddPeer used to add new peer to syncer.
@@ -113,50 +203,265 @@ func (s *Syncer) RUnlock() {
 	s.mu.RUnlock()
 }
 
+// check applies the committed changes, proposes the local changes and reloads the changed configs.
 func (s *Syncer) check() {
-	log := s.log
-	maxVer := int64(0)
-	maxPeer := ""
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.applyMu.Lock()
+	s.apply()
+	s.propose()
+	changed := s.changed
+	s.changed = make(map[string]bool)
+	applied := s.raft.Status().Applied
+	s.applyMu.Unlock()
+
+	if len(changed) > 0 {
+		s.log.Warning("syncer.apply.changed.files:%v", changed)
+		s.reload(changed)
+	}
+	s.applyMu.Lock()
+	s.reloaded = applied
+	s.applyMu.Unlock()
+}
+
+// WaitReloaded waits until all the other peers reload the changes applied on this peer,
+// it fails if any of them doesn't catch up in the timeout.
+// The shared store needs no waiting, the changes are visible to the peers once they're written.
+func (s *Syncer) WaitReloaded(timeout time.Duration) error {
+	if s.store.Shared() {
+		return nil
+	}
+
 	self := s.peer.self
-	peers := s.peer.Clone()
-	for _, peer := range peers {
-		if peer != self {
-			versionURL := "http://" + path.Join(peer, versionRestURL)
-			peerVerStr, err := xbase.HTTPGet(versionURL)
-			if err != nil {
-				log.Error("syncer.check.version.get[%s].error:%+v", peerVerStr, err)
-				continue
+	index := s.raft.Status().Applied
+	deadline := time.Now().Add(timeout)
+	for _, peer := range s.peer.Clone() {
+		if peer == self {
+			continue
+		}
+		for {
+			status := &RaftStatus{}
+			body, err := s.client.Get(s.client.Scheme() + "://" + path.Join(peer, raftStatusRestURL))
+			if err == nil {
+				err = json.Unmarshal([]byte(body), status)
 			}
-
-			version := &config.Version{}
-			if err := json.Unmarshal([]byte(peerVerStr), version); err != nil {
-				log.Error("syncer.version.unmarshal[%s].error:%+v", peerVerStr, err)
-				return
+			if err == nil && status.Reloaded >= index {
+				break
 			}
-			peerVer := version.Ts
-			if peerVer > maxVer {
-				maxVer = peerVer
-				maxPeer = peer
+			if time.Now().After(deadline) {
+				return errors.Errorf("syncer.peer[%s].reloaded[%d].is.behind.the.index[%d].error:%v", peer, status.Reloaded, index, err)
 			}
+			time.Sleep(raftHeartbeat)
 		}
 	}
+	return nil
+}
+
+// raftStarted returns true if the changes are replicated by the raft.
+func (s *Syncer) raftStarted() bool {
+	s.applyMu.Lock()
+	defer s.applyMu.Unlock()
+	return s.started
+}
+
+// commit proposes the changes of the ReplicatedStore and waits until they are applied to the store,
+// it fails if there is no leader or the entry is not committed in time.
+// The changes are not reloaded, the caller updates its configs.
+func (s *Syncer) commit(entry *Entry) error {
+	rsp, err := s.raft.Propose(entry)
+	if err != nil {
+		return err
+	}
+	p := &proposal{term: rsp.Term}
+	s.applyMu.Lock()
+	s.proposals[rsp.Index] = p
+	s.applyMu.Unlock()
+	defer func() {
+		s.applyMu.Lock()
+		delete(s.proposals, rsp.Index)
+		s.applyMu.Unlock()
+	}()
 
-	selfVer := config.ReadVersion(s.metadir)
-	if maxVer > selfVer {
-		log.Warning("syncer.version[%v,%s].larger.than.self[%v, %s]", maxVer, maxPeer, selfVer, self)
-		metaURL := "http://" + path.Join(maxPeer, metaRestURL)
-		metaStr, err := xbase.HTTPGet(metaURL)
-		if err != nil {
-			log.Error("syncer.check.meta.get[%s].error:%+v", metaStr, err)
-			return
+	deadline := time.Now().Add(raftElectionTimeout * 2)
+	for {
+		s.applyMu.Lock()
+		s.apply()
+		applied, lost, rejected := p.applied, p.lost, p.rejected
+		s.applyMu.Unlock()
+
+		switch {
+		case lost:
+			return errors.Errorf("syncer.raft.proposal.index[%d].term[%d].is.overwritten.by.the.leader", rsp.Index, rsp.Term)
+		case rejected:
+			return metastore.ErrConflict
+		case applied:
+			return nil
+		case s.raft.Status().Applied >= rsp.Index:
+			return errors.Errorf("syncer.raft.proposal.index[%d].term[%d].is.replaced.by.the.snapshot", rsp.Index, rsp.Term)
+		case time.Now().After(deadline):
+			return errors.Errorf("syncer.raft.proposal.index[%d].term[%d].is.not.committed.by.the.quorum", rsp.Index, rsp.Term)
 		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
 
-		meta := &Meta{}
-		if err := json.Unmarshal([]byte(metaStr), meta); err != nil {
-			log.Error("syncer.check.meta.unmarshal[%s].error:%+v", metaStr, err)
+// apply writes the committed changes to the store, the changed keys are collected to reload.
+// It must be called with the applyMu held.
+func (s *Syncer) apply() {
+	log := s.log
+	self := s.peer.self
+	store := s.store
+	s.raft.Apply(func(entry *Entry, rejected bool) {
+		// The changes proposed by the diff of this peer are already in the store.
+		if entry.Origin == self {
+			return
+		}
+		// The changes of the ReplicatedStore are reloaded by the waiting caller.
+		reload := true
+		if p, ok := s.proposals[entry.Index]; ok {
+			p.applied = true
+			p.lost = entry.Term != p.term
+			p.rejected = rejected
+			reload = p.lost
+		}
+		if rejected {
 			return
 		}
-		s.MetaRebuild(meta)
-		s.MetaReload()
+		// The dir keys are put before the keys under them.
+		names := make([]string, 0, len(entry.Puts))
+		for name := range entry.Puts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			data := entry.Puts[name]
+			kv, err := store.Get(name)
+			if err == nil && string(kv.Value) == data {
+				continue
+			}
+			if _, err := store.Put(name, []byte(data), metastore.RevisionAny); err != nil {
+				log.Panicf("syncer.apply.put[%v].error:%v", name, err)
+			}
+			if reload {
+				s.changed[name] = true
+			}
+		}
+		for _, name := range entry.Deletes {
+			if err := store.Delete(name, metastore.RevisionAny); err != nil {
+				if err == metastore.ErrNotFound {
+					continue
+				}
+				log.Panicf("syncer.apply.delete[%v].error:%v", name, err)
+			}
+			if reload {
+				s.changed[name] = true
+			}
+		}
+	})
+}
+
+// watch reloads the configs changed in the shared store, the pending events are merged.
+func (s *Syncer) watch(event *metastore.Event) {
+	changed := map[string]bool{event.KV.Key: true}
+	for len(s.watcher.C) > 0 {
+		event := <-s.watcher.C
+		changed[event.KV.Key] = true
 	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.log.Warning("syncer.watch.changed.keys:%v", changed)
+	s.reload(changed)
+}
+
+// reload used to reload the configs of the changed keys.
+func (s *Syncer) reload(changed map[string]bool) {
+	log := s.log
+	reloadScatter, reloadRouter, reloadPeer := false, false, false
+	for name := range changed {
+		switch {
+		case name == backendJSONFile:
+			reloadScatter = true
+		case name == peersJSONFile:
+			reloadPeer = true
+		case metastore.IsHistoryKey(name):
+			// The snapshots of the meta history are read on demand.
+		case strings.Contains(name, "/"):
+			reloadRouter = true
+		}
+	}
+	if reloadScatter {
+		if err := s.scatter.LoadConfig(); err != nil {
+			log.Panicf("syncer.apply.scatter.load.config.error:%+v", err)
+		}
+	}
+	if reloadRouter {
+		if err := s.router.LoadConfig(); err != nil {
+			log.Panicf("syncer.apply.router.load.config.error:%+v", err)
+		}
+	}
+	if reloadPeer {
+		if err := s.peer.LoadConfig(); err != nil {
+			log.Panicf("syncer.apply.peer.load.config.error:%+v", err)
+		}
+	}
+}
+
+// propose sends the local changes which are not in the committed metadata to the leader.
+func (s *Syncer) propose() {
+	log := s.log
+	metas, applied := s.raft.Metas()
+	// Wait for the last proposal unless the leader changed.
+	if applied < s.proposed.Index && s.raft.Status().Term == s.proposed.Term {
+		return
+	}
+
+	local, err := s.metas()
+	if err != nil {
+		return
+	}
+	entry := diffMetas(metas, local)
+	if len(entry.Puts) == 0 && len(entry.Deletes) == 0 {
+		return
+	}
+	// The diff is based on the applied state, it's rejected if the files are changed by the others meanwhile,
+	// and the changes of the others are written to the store at the apply.
+	files := append([]string{}, entry.Deletes...)
+	for file := range entry.Puts {
+		files = append(files, file)
+	}
+	entry.Expects = expectMetas(metas, files...)
+	entry.Origin = s.peer.self
+	rsp, err := s.raft.Propose(entry)
+	if err != nil {
+		log.Warning("syncer.propose.error:%+v", err)
+		return
+	}
+	log.Info("syncer.proposed.index[%d].puts[%d].deletes[%v]", rsp.Index, len(entry.Puts), entry.Deletes)
+	s.proposed = *rsp
+}
+
+// RaftVote handles the vote request from the peer.
+func (s *Syncer) RaftVote(req *VoteRequest) *VoteResponse {
+	return s.raft.HandleVote(req)
+}
+
+// RaftAppend handles the append request from the leader.
+func (s *Syncer) RaftAppend(req *AppendRequest) *AppendResponse {
+	return s.raft.HandleAppend(req)
+}
+
+// RaftPropose handles the proposal from the peer.
+func (s *Syncer) RaftPropose(entry *Entry) (*ProposeResponse, error) {
+	return s.raft.HandlePropose(entry)
+}
+
+// RaftStatus returns the raft status of this peer.
+func (s *Syncer) RaftStatus() *RaftStatus {
+	status := s.raft.Status()
+	s.applyMu.Lock()
+	status.Reloaded = s.reloaded
+	s.applyMu.Unlock()
+	return status
 }
@@ -9,9 +9,15 @@
 package syncer
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
+	"backend"
+	"config"
+	"metastore"
+	"router"
+
 	"github.com/fortytw2/leaktest"
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/xlog"
@@ -23,8 +29,8 @@ func TestSyncer(t *testing.T) {
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
 	syncers, cleanup := mockSyncer(log, 3)
 	assert.NotNil(t, syncers)
-	time.Sleep(time.Second * 2)
 	defer cleanup()
+	assert.True(t, mockWaitSynced(log, syncers...))
 }
 
 func TestSyncerLock(t *testing.T) {
@@ -75,3 +81,50 @@ func TestSyncerAddRemovePeers(t *testing.T) {
 		assert.Equal(t, want, got)
 	}
 }
+
+// sharedStore mocks the store shared by the peers with the files.
+type sharedStore struct {
+	*metastore.FileStore
+}
+
+func (s *sharedStore) Shared() bool {
+	return true
+}
+
+func TestSyncerSharedStore(t *testing.T) {
+	defer testRemoveMetadir()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := config.DefaultMetaStoreConfig()
+	conf.WatchInterval = 10
+	fileStore, err := metastore.New(log, testMetadir, conf)
+	assert.Nil(t, err)
+	store := &sharedStore{FileStore: fileStore.(*metastore.FileStore)}
+
+	var syncers []*Syncer
+	for i := 0; i < 2; i++ {
+		router := router.NewRouterWithStore(log, store, config.DefaultRouterConfig())
+		scatter := backend.NewScatterWithStore(log, store)
+		syncer := NewSyncer(log, testMetadir, store, fmt.Sprintf("127.0.0.1:%d", 8081+i), router, scatter)
+		assert.Nil(t, syncer.Init())
+		defer syncer.Close()
+		syncers = append(syncers, syncer)
+	}
+
+	// The changes of a peer are reloaded by the other.
+	{
+		assert.Nil(t, syncers[0].router.CreateDatabase("db1"))
+		assert.Nil(t, syncers[0].router.CreateHashTable("db1", "t1", "id", "hash", []string{"backend1"}, nil, nil))
+		for {
+			if _, err := syncers[1].router.TableConfig("db1", "t1"); err == nil {
+				break
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+	}
+
+	// The raft is not used.
+	{
+		assert.Equal(t, RaftFollower, syncers[1].RaftStatus().Role)
+		assert.Equal(t, uint64(0), syncers[1].RaftStatus().Term)
+	}
+}
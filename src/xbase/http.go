@@ -10,11 +10,14 @@ package xbase
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -43,19 +46,82 @@ func makeSimpleRequest(ctx context.Context, method string, url string, payload i
 }
 
 func httpDo(method string, url string, payload interface{}) (*http.Response, func(), error) {
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
+	return (*HTTPClient)(nil).do(method, url, payload)
+}
+
+// HTTPClient is used to do the requests to the radon peers,
+// the Token is sent as the bearer credential and the TLS is used for the https.
+type HTTPClient struct {
+	Token string
+	TLS   *tls.Config
+
+	once   sync.Once
+	client *http.Client
+}
+
+// defaultClient is the client without the tls.
+var defaultClient = &http.Client{}
+
+// httpClient returns the http client, the transport of the tls is built once and reused.
+func (c *HTTPClient) httpClient() *http.Client {
+	if c == nil {
+		return defaultClient
+	}
+	c.once.Do(func() {
+		c.client = defaultClient
+		if c.TLS != nil {
+			c.client = &http.Client{Transport: &http.Transport{TLSClientConfig: c.TLS}}
+		}
+	})
+	return c.client
+}
+
+// Scheme returns the scheme of the peer urls, https if the TLS is set.
+func (c *HTTPClient) Scheme() string {
+	if c != nil && c.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// Post used to do restful post request.
+func (c *HTTPClient) Post(url string, payload interface{}) (*http.Response, func(), error) {
+	return c.do("POST", url, payload)
+}
+
+// Get used to do restful get request.
+func (c *HTTPClient) Get(url string) (string, error) {
+	resp, cleanup, err := c.do("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+	return HTTPReadBody(resp), nil
+}
+
+func (c *HTTPClient) do(method string, url string, payload interface{}) (*http.Response, func(), error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	req, err := makeSimpleRequest(ctx, method, url, payload)
 	if err != nil {
+		cancel()
 		return nil, nil, err
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	return resp, func() {
+	if c != nil && c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := c.httpClient().Do(req)
+	// The timeout covers reading the body, so the context is canceled by the cleanup.
+	cleanup := func() {
 		if resp != nil && resp.Body != nil {
 			resp.Body.Close()
 		}
-	}, err
+		cancel()
+	}
+	if err != nil {
+		cleanup()
+	}
+	return resp, cleanup, err
 }
 
 // HTTPPost used to do restful post request.
@@ -89,3 +155,15 @@ func HTTPReadBody(resp *http.Response) string {
 	}
 	return ""
 }
+
+// RedactURL returns the url with the password of the userinfo masked, used to log the urls.
+func RedactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
@@ -28,6 +28,9 @@ const (
 	// REPLACE type.
 	REPLACE = "REPLACE"
 
+	// LOADDATA type.
+	LOADDATA = "LOADDATA"
+
 	// EXPLAIN type.
 	EXPLAIN = "EXPLAIN"
 
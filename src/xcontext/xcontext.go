@@ -9,6 +9,8 @@
 package xcontext
 
 import (
+	"xtrace"
+
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 )
 
@@ -43,6 +45,12 @@ const (
 // ResultContext tuple.
 type ResultContext struct {
 	Results *sqltypes.Result
+
+	// Span is the parent span of the execution, nil if not traced.
+	Span *xtrace.Span
+
+	// GroupConcatMaxLen is the max length of the group_concat result, 0 means unlimited.
+	GroupConcatMaxLen int
 }
 
 // NewResultContext returns the result context.
@@ -56,6 +64,9 @@ type RequestContext struct {
 	Mode     RequestMode
 	TxnMode  TxnMode
 	Querys   []QueryTuple
+
+	// Span is the parent span of the backend executions, nil if not traced.
+	Span *xtrace.Span
 }
 
 // NewRequestContext creates RequestContext
@@ -0,0 +1,191 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package xtrace
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"xbase"
+
+	"github.com/pkg/errors"
+)
+
+// FileExporter writes the traces to the file as the readable span trees, such as:
+//
+//	trace 4bf92f3577b34da6a3ce929d0e0e4736
+//	  query 3.021ms query="select * from t1 join t2 on t1.a=t2.a"
+//	    optimizer.build 0.154ms
+//	    executor.select 2.803ms
+//	      engine.join 2.790ms
+type FileExporter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileExporter creates the new FileExporter appending to the file.
+func NewFileExporter(name string) (*FileExporter, error) {
+	if name == "" {
+		return nil, errors.New("trace.file.can.not.be.empty")
+	}
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &FileExporter{file: file}, nil
+}
+
+// Export impl.
+func (e *FileExporter) Export(spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err := e.file.WriteString(FormatTrace(spans))
+	return err
+}
+
+// Close impl.
+func (e *FileExporter) Close() error {
+	return e.file.Close()
+}
+
+// FormatTrace returns the spans as the readable tree, the children are ordered by the start time.
+func FormatTrace(spans []*Span) string {
+	buf := bytes.NewBuffer(nil)
+	WalkTrace(spans, func(span *Span, depth int) {
+		if depth == 0 {
+			buf.WriteString(fmt.Sprintf("trace %s\n", span.TraceID))
+		}
+		buf.WriteString(strings.Repeat("  ", depth+1))
+		buf.WriteString(fmt.Sprintf("%s %.3fms", span.Name, float64(span.Duration().Nanoseconds())/1e6))
+		for _, attr := range span.Attrs {
+			buf.WriteString(fmt.Sprintf(" %s=%q", attr.Key, attr.Value))
+		}
+		if span.Err != "" {
+			buf.WriteString(fmt.Sprintf(" error=%q", span.Err))
+		}
+		buf.WriteString("\n")
+	})
+	return buf.String()
+}
+
+// OTLPExporter sends the traces to the OpenTelemetry collector by OTLP/HTTP with the json encoding.
+type OTLPExporter struct {
+	endpoint string
+}
+
+// NewOTLPExporter creates the new OTLPExporter, the endpoint is the traces url of the collector.
+func NewOTLPExporter(endpoint string) *OTLPExporter {
+	return &OTLPExporter{endpoint: endpoint}
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []otlpAttr `json:"attributes,omitempty"`
+	Status            otlpStatus `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttr `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+const (
+	// otlpKindInternal is the SPAN_KIND_INTERNAL.
+	otlpKindInternal = 1
+	// otlpKindServer is the SPAN_KIND_SERVER of the root span.
+	otlpKindServer = 2
+	// otlpStatusError is the STATUS_CODE_ERROR.
+	otlpStatusError = 2
+)
+
+// otlpTraceRequest converts the spans to the ExportTraceServiceRequest.
+func otlpTraceRequest(spans []*Span) *otlpRequest {
+	scope := otlpScopeSpans{}
+	scope.Scope.Name = "radon"
+	for _, span := range spans {
+		s := otlpSpan{
+			TraceID:           span.TraceID,
+			SpanID:            span.SpanID,
+			ParentSpanID:      span.ParentID,
+			Name:              span.Name,
+			Kind:              otlpKindInternal,
+			StartTimeUnixNano: fmt.Sprintf("%d", span.Start.UnixNano()),
+			EndTimeUnixNano:   fmt.Sprintf("%d", span.End.UnixNano()),
+		}
+		if span.ParentID == "" {
+			s.Kind = otlpKindServer
+		}
+		for _, attr := range span.Attrs {
+			s.Attributes = append(s.Attributes, otlpAttr{Key: attr.Key, Value: otlpValue{StringValue: attr.Value}})
+		}
+		if span.Err != "" {
+			s.Status = otlpStatus{Code: otlpStatusError, Message: span.Err}
+		}
+		scope.Spans = append(scope.Spans, s)
+	}
+
+	rs := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	rs.Resource.Attributes = []otlpAttr{{Key: "service.name", Value: otlpValue{StringValue: "radon"}}}
+	return &otlpRequest{ResourceSpans: []otlpResourceSpans{rs}}
+}
+
+// Export impl.
+func (e *OTLPExporter) Export(spans []*Span) error {
+	resp, cleanup, err := xbase.HTTPPost(e.endpoint, otlpTraceRequest(spans))
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("trace.otlp.export.to[%s].status[%d]:%s", e.endpoint, resp.StatusCode, xbase.HTTPReadBody(resp))
+	}
+	return nil
+}
+
+// Close impl.
+func (e *OTLPExporter) Close() error {
+	return nil
+}
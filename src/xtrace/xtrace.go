@@ -0,0 +1,355 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package xtrace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	mrand "math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"config"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const (
+	// traceQueueSize is the traces waiting for the export, the others are dropped.
+	traceQueueSize = 1024
+
+	// attrValueMax is the max length of the attribute value, such as the query.
+	attrValueMax = 1024
+)
+
+// Attr is the key/value attribute of the span.
+type Attr struct {
+	Key   string
+	Value string
+}
+
+// trace collects the finished spans of a trace.
+type trace struct {
+	mu       sync.Mutex
+	spans    []*Span
+	started  int
+	max      int
+	dropped  int
+	exported bool
+}
+
+// Span tuple, a timed operation of the statement.
+// All the methods are nil-safe, a nil span means the statement is not traced.
+type Span struct {
+	tracer   *Tracer
+	trace    *trace
+	mu       sync.Mutex
+	TraceID  string
+	SpanID   string
+	ParentID string
+	Name     string
+	Start    time.Time
+	End      time.Time
+	Attrs    []Attr
+	Err      string
+}
+
+func newID(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		mrand.Read(b)
+	}
+	return hex.EncodeToString(b)
+}
+
+// NewSpan creates the root span which is not sampled or exported,
+// the spans are collected in memory and returned by Spans after the root finished.
+// The ids are the sequence in the trace rather than the random ones, they are never exported.
+func NewSpan(name string, maxSpans int) *Span {
+	if maxSpans <= 0 {
+		maxSpans = config.DefaultTraceConfig().MaxSpans
+	}
+	return &Span{
+		trace:  &trace{max: maxSpans},
+		SpanID: "0",
+		Name:   name,
+		Start:  time.Now(),
+	}
+}
+
+// StartChild starts the child span, nil if the trace has max spans,
+// so the dropped spans never break the tree.
+func (s *Span) StartChild(name string) *Span {
+	if s == nil {
+		return nil
+	}
+	t := s.trace
+	t.mu.Lock()
+	if t.started >= t.max {
+		t.dropped++
+		t.mu.Unlock()
+		return nil
+	}
+	t.started++
+	seq := t.started
+	t.mu.Unlock()
+
+	var id string
+	if s.tracer == nil {
+		id = strconv.Itoa(seq)
+	} else {
+		id = newID(8)
+	}
+	return &Span{
+		tracer:   s.tracer,
+		trace:    s.trace,
+		TraceID:  s.TraceID,
+		SpanID:   id,
+		ParentID: s.SpanID,
+		Name:     name,
+		Start:    time.Now(),
+	}
+}
+
+// SetAttr sets the attribute of the span.
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	v := fmt.Sprintf("%v", value)
+	if len(v) > attrValueMax {
+		v = v[:attrValueMax]
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Attrs = append(s.Attrs, Attr{Key: key, Value: v})
+}
+
+// SetError marks the span failed if the err is not nil.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Err = err.Error()
+}
+
+// Finish ends the span, the trace is exported when the root span finished.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.End = time.Now()
+	s.mu.Unlock()
+
+	t := s.trace
+	t.mu.Lock()
+	if t.exported {
+		t.dropped++
+		t.mu.Unlock()
+		return
+	}
+	t.spans = append(t.spans, s)
+	spans, dropped := t.spans, t.dropped
+	if s.ParentID == "" {
+		t.exported = true
+	}
+	t.mu.Unlock()
+
+	if s.ParentID == "" {
+		if dropped > 0 {
+			s.SetAttr("dropped.spans", dropped)
+		}
+		s.tracer.export(spans)
+	}
+}
+
+// Duration returns the duration of the finished span.
+func (s *Span) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// Attr returns the value of the attribute, empty if not set.
+func (s *Span) Attr(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, attr := range s.Attrs {
+		if attr.Key == key {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// Spans returns the finished spans of the trace.
+func (s *Span) Spans() []*Span {
+	t := s.trace
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	spans := make([]*Span, len(t.spans))
+	copy(spans, t.spans)
+	return spans
+}
+
+// WalkTrace walks the span tree from the root in depth-first order,
+// the children are ordered by the start time.
+func WalkTrace(spans []*Span, fn func(span *Span, depth int)) {
+	var root *Span
+	children := make(map[string][]*Span)
+	for _, span := range spans {
+		if span.ParentID == "" {
+			root = span
+			continue
+		}
+		children[span.ParentID] = append(children[span.ParentID], span)
+	}
+	if root == nil {
+		return
+	}
+
+	var walk func(span *Span, depth int)
+	walk = func(span *Span, depth int) {
+		fn(span, depth)
+		subs := children[span.SpanID]
+		sort.SliceStable(subs, func(i, j int) bool { return subs[i].Start.Before(subs[j].Start) })
+		for _, sub := range subs {
+			walk(sub, depth+1)
+		}
+	}
+	walk(root, 0)
+}
+
+// Exporter used to export the finished traces.
+type Exporter interface {
+	Export(spans []*Span) error
+	Close() error
+}
+
+// Tracer tuple, samples the statements and exports the traces in the background.
+type Tracer struct {
+	log      *xlog.Log
+	conf     *config.TraceConfig
+	exporter Exporter
+	queue    chan []*Span
+	done     chan struct{}
+	mu       sync.Mutex
+	rand     *mrand.Rand
+	closed   bool
+}
+
+// NewTracer creates the new Tracer, nil is returned if the exporter is empty.
+func NewTracer(log *xlog.Log, conf *config.TraceConfig) (*Tracer, error) {
+	if conf == nil || conf.Exporter == "" {
+		return nil, nil
+	}
+
+	var err error
+	var exporter Exporter
+	switch conf.Exporter {
+	case config.TraceExporterFile:
+		if exporter, err = NewFileExporter(conf.File); err != nil {
+			return nil, err
+		}
+	case config.TraceExporterOTLP:
+		if conf.OTLPEndpoint == "" {
+			return nil, errors.New("trace.otlp-endpoint.can.not.be.empty")
+		}
+		exporter = NewOTLPExporter(conf.OTLPEndpoint)
+	default:
+		return nil, errors.Errorf("trace.exporter[%s].unsupported", conf.Exporter)
+	}
+
+	t := &Tracer{
+		log:      log,
+		conf:     conf,
+		exporter: exporter,
+		queue:    make(chan []*Span, traceQueueSize),
+		done:     make(chan struct{}),
+		rand:     mrand.New(mrand.NewSource(time.Now().UnixNano())),
+	}
+	go t.exportLoop()
+	log.Info("tracer.started.exporter[%s].sample-rate[%v]", conf.Exporter, conf.SampleRate)
+	return t, nil
+}
+
+// Start starts the root span if the statement is sampled or forced by the hint.
+func (t *Tracer) Start(name string, force bool) *Span {
+	if t == nil {
+		return nil
+	}
+	if !force {
+		t.mu.Lock()
+		sampled := t.rand.Float64() < t.conf.SampleRate
+		t.mu.Unlock()
+		if !sampled {
+			return nil
+		}
+	}
+	max := t.conf.MaxSpans
+	if max <= 0 {
+		max = config.DefaultTraceConfig().MaxSpans
+	}
+	return &Span{
+		tracer:  t,
+		trace:   &trace{max: max},
+		TraceID: newID(16),
+		SpanID:  newID(8),
+		Name:    name,
+		Start:   time.Now(),
+	}
+}
+
+func (t *Tracer) export(spans []*Span) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	select {
+	case t.queue <- spans:
+	default:
+		t.log.Warning("tracer.queue.is.full.trace[%s].dropped", spans[0].TraceID)
+	}
+}
+
+func (t *Tracer) exportLoop() {
+	defer close(t.done)
+	for spans := range t.queue {
+		if err := t.exporter.Export(spans); err != nil {
+			t.log.Error("tracer.export.trace[%s].error:%+v", spans[0].TraceID, err)
+		}
+	}
+}
+
+// Close used to export the queued traces and close the exporter.
+func (t *Tracer) Close() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return
+	}
+	t.closed = true
+	close(t.queue)
+	t.mu.Unlock()
+	<-t.done
+	t.exporter.Close()
+	t.log.Info("tracer.closed...")
+}
@@ -0,0 +1,145 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package xtrace
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestTracerFile(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	file := "/tmp/radon_test_trace.log"
+	os.Remove(file)
+	defer os.Remove(file)
+
+	// Disabled.
+	{
+		tracer, err := NewTracer(log, config.DefaultTraceConfig())
+		assert.Nil(t, err)
+		assert.Nil(t, tracer)
+		assert.Nil(t, tracer.Start("query", true))
+		tracer.Close()
+	}
+
+	// Errors.
+	{
+		_, err := NewTracer(log, &config.TraceConfig{Exporter: config.TraceExporterFile})
+		assert.Equal(t, "trace.file.can.not.be.empty", err.Error())
+		_, err = NewTracer(log, &config.TraceConfig{Exporter: config.TraceExporterOTLP})
+		assert.Equal(t, "trace.otlp-endpoint.can.not.be.empty", err.Error())
+		_, err = NewTracer(log, &config.TraceConfig{Exporter: "zipkin"})
+		assert.Equal(t, "trace.exporter[zipkin].unsupported", err.Error())
+	}
+
+	conf := &config.TraceConfig{Exporter: config.TraceExporterFile, File: file, MaxSpans: 3}
+	tracer, err := NewTracer(log, conf)
+	assert.Nil(t, err)
+
+	// Not sampled.
+	assert.Nil(t, tracer.Start("query", false))
+
+	root := tracer.Start("query", true)
+	root.SetAttr("query", "select * from t1")
+	plan := root.StartChild("optimizer.build")
+	plan.Finish()
+	exec := root.StartChild("executor.select")
+	for i := 0; i < 3; i++ {
+		backend := exec.StartChild("backend.execute")
+		backend.SetError(errors.New("mock.error"))
+		backend.Finish()
+	}
+	exec.Finish()
+	root.Finish()
+	// Finished after the root.
+	plan.StartChild("late").Finish()
+	tracer.Close()
+
+	data, err := ioutil.ReadFile(file)
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Equal(t, 5, len(lines))
+	assert.Equal(t, "trace "+root.TraceID, lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "  query "))
+	assert.True(t, strings.HasSuffix(lines[1], `query="select * from t1" dropped.spans="2"`))
+	assert.True(t, strings.HasPrefix(lines[2], "    optimizer.build "))
+	assert.True(t, strings.HasPrefix(lines[3], "    executor.select "))
+	assert.True(t, strings.HasPrefix(lines[4], "      backend.execute "))
+	assert.True(t, strings.HasSuffix(lines[4], `error="mock.error"`))
+}
+
+func TestTracerOTLP(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	requests := make(chan *otlpRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &otlpRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err == nil {
+			requests <- req
+		}
+	}))
+	defer server.Close()
+
+	conf := &config.TraceConfig{Exporter: config.TraceExporterOTLP, OTLPEndpoint: server.URL + "/v1/traces", SampleRate: 1}
+	tracer, err := NewTracer(log, conf)
+	assert.Nil(t, err)
+	defer tracer.Close()
+
+	root := tracer.Start("query", false)
+	child := root.StartChild("backend.execute")
+	child.SetAttr("backend", "node1")
+	child.SetError(errors.New("mock.error"))
+	child.Finish()
+	root.Finish()
+
+	select {
+	case req := <-requests:
+		spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+		assert.Equal(t, 2, len(spans))
+		assert.Equal(t, "backend.execute", spans[0].Name)
+		assert.Equal(t, root.SpanID, spans[0].ParentSpanID)
+		assert.Equal(t, 32, len(spans[0].TraceID))
+		assert.Equal(t, otlpStatusError, spans[0].Status.Code)
+		assert.Equal(t, "node1", spans[0].Attributes[0].Value.StringValue)
+		assert.Equal(t, otlpKindServer, spans[1].Kind)
+	case <-time.After(5 * time.Second):
+		t.Fatal("otlp.export.timeout")
+	}
+}
+
+func TestSpanLocal(t *testing.T) {
+	root := NewSpan("explain", 2)
+	child := root.StartChild("engine.merge")
+	sub := child.StartChild("backend.execute")
+	sub.SetAttr("rows", 3)
+	sub.Finish()
+	child.Finish()
+	// The max spans reached.
+	assert.Nil(t, root.StartChild("backend.execute"))
+	root.Finish()
+
+	assert.Equal(t, "", root.TraceID)
+	var names []string
+	WalkTrace(root.Spans(), func(span *Span, depth int) {
+		names = append(names, strings.Repeat(" ", depth)+span.Name)
+	})
+	assert.Equal(t, []string{"explain", " engine.merge", "  backend.execute"}, names)
+	assert.Equal(t, "3", sub.Attr("rows"))
+}